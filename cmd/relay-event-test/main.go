@@ -8,11 +8,7 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/comunifi/relay/internal/config"
-	"github.com/comunifi/relay/internal/ethrequest"
-	"github.com/comunifi/relay/pkg/common"
-	"github.com/fiatjaf/eventstore/postgresql"
-	"github.com/fiatjaf/khatru"
+	"github.com/comunifi/relay/internal/app"
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -41,64 +37,17 @@ func main() {
 	println("env", *env)
 
 	////////////////////
-	// config
-	conf, err := config.New(ctx, *env)
+	// config, chain and database
+	a, err := app.New(ctx, *env, app.WithChain(true), app.WithEventStore(), app.WithRelay())
 	if err != nil {
 		log.Fatal(err)
 	}
-	////////////////////
-	////////////////////
-	// evm
-	rpcUrl := conf.RPCWSURL
-
-	evm, err := ethrequest.NewEthService(ctx, rpcUrl)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	chid, err := evm.ChainID()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	log.Default().Println("node running for chain: ", chid.String())
-	////////////////////
-	////////////////////
-	// db
-	log.Default().Println("starting internal db service...")
-
-	db := postgresql.PostgresBackend{
-		DatabaseURL: fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", conf.DBUser, conf.DBPassword, conf.DBHost, conf.DBPort, conf.DBName),
-	}
+	defer a.Close()
 
-	err = db.Init()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-	////////////////////
-	////////////////////
-	// pubkey
-	pubkey, err := common.PrivateKeyToPublicKey(conf.RelayPrivateKey)
-	if err != nil {
-		log.Fatal(err)
-	}
+	conf, db, relay, pubkey := a.Conf, a.NDB, a.Relay, a.Pubkey
 
+	app.UseEventStore(relay, db)
 	////////////////////
-	////////////////////
-	// nostr
-	relay := khatru.NewRelay()
-
-	relay.Info.Name = conf.RelayInfoName
-	relay.Info.PubKey = pubkey
-	relay.Info.Description = conf.RelayInfoDescription
-	relay.Info.Icon = conf.RelayInfoIcon
-
-	relay.StoreEvent = append(relay.StoreEvent, db.SaveEvent)
-	relay.QueryEvents = append(relay.QueryEvents, db.QueryEvents)
-	relay.CountEvents = append(relay.CountEvents, db.CountEvents)
-	relay.DeleteEvent = append(relay.DeleteEvent, db.DeleteEvent)
-	relay.ReplaceEvent = append(relay.ReplaceEvent, db.ReplaceEvent)
 
 	ev := &nostr.Event{
 		PubKey:    pubkey,
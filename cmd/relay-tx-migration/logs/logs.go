@@ -3,7 +3,6 @@ package logs
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"math/big"
@@ -19,7 +18,6 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 
 	nost "github.com/comunifi/relay/internal/nostr"
-	"github.com/nbd-wtf/go-nostr"
 )
 
 // getERC20Symbol calls the symbol() method on an ERC20 contract
@@ -116,25 +114,12 @@ func MigrateLogs(ctx context.Context, evm *ethrequest.EthService, chainID *big.I
 
 			for _, log := range logs {
 
-				nostrethLog := &nostreth.Log{
-					Hash:      log.Hash,
-					TxHash:    log.TxHash,
-					ChainID:   chainID.String(),
-					Topic:     topic,
-					CreatedAt: log.CreatedAt,
-					UpdatedAt: log.UpdatedAt,
-					Nonce:     log.Nonce,
-					Sender:    log.Sender,
-					To:        log.To,
-					Value:     log.Value,
-					Data:      log.Data,
-				}
-
-				nostrethLog.Hash = nostrethLog.GenerateUniqueHash()
+				l := log.Log(chainID.String(), topic)
+				l.Hash = l.GenerateUniqueHash()
 
-				ev := convertLogToEvent(topic, nostrethLog)
-				if ev == nil {
-					return errors.New("something went wrong parsing an event from a log")
+				ev, err := relay.NewLogEvent(l)
+				if err != nil {
+					return err
 				}
 
 				sev, err := n.SignAndSaveEvent(ctx, ev)
@@ -172,16 +157,3 @@ func MigrateLogs(ctx context.Context, evm *ethrequest.EthService, chainID *big.I
 	}
 	return nil
 }
-
-func convertLogToEvent(topic string, log *nostreth.Log) *nostr.Event {
-	var txEv *nostr.Event
-	switch topic {
-	case nostreth.TopicERC20Transfer:
-		txEv, _ = nostreth.CreateTxTransferEvent(*log)
-
-	default:
-		txEv, _ = nostreth.CreateTxLogEvent(*log)
-	}
-
-	return txEv
-}
@@ -3,17 +3,11 @@ package main
 import (
 	"context"
 	"flag"
-	"fmt"
 	"log"
 
 	"github.com/comunifi/relay/cmd/relay-tx-migration/logs"
 	"github.com/comunifi/relay/cmd/relay-tx-migration/logs/logdb"
-	"github.com/comunifi/relay/internal/config"
-	"github.com/comunifi/relay/internal/ethrequest"
-	nost "github.com/comunifi/relay/internal/nostr"
-	"github.com/comunifi/relay/pkg/common"
-	"github.com/fiatjaf/eventstore/postgresql"
-	"github.com/fiatjaf/khatru"
+	"github.com/comunifi/relay/internal/app"
 )
 
 func main() {
@@ -33,82 +27,26 @@ func main() {
 	println("env", *env)
 
 	////////////////////
-	// config
-	conf, err := config.New(ctx, *env)
+	// config, chain and nostr
+	a, err := app.New(ctx, *env, app.WithChain(true), app.WithEventStore(), app.WithRelay(), app.WithNostr())
 	if err != nil {
 		log.Fatal(err)
 	}
-	////////////////////
-	////////////////////
-	// evm
-	rpcUrl := conf.RPCWSURL
-
-	evm, err := ethrequest.NewEthService(ctx, rpcUrl)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	chid, err := evm.ChainID()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	log.Default().Println("node running for chain: ", chid.String())
-	////////////////////
-	////////////////////
-	// nostr-postgres
-	log.Default().Println("starting internal db service...")
+	defer a.Close()
 
-	ndb := postgresql.PostgresBackend{
-		DatabaseURL: fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", conf.DBUser, conf.DBPassword, conf.DBHost, conf.DBPort, conf.DBName),
-	}
+	conf, evm, chid, n := a.Conf, a.EVM, a.ChainID, a.Nostr
 
-	err = ndb.Init()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer ndb.Close()
+	app.UseEventStore(a.Relay, a.NDB)
 	////////////////////
 	////////////////////
 	// db
-	log.Default().Println("starting internal db service...")
-
 	d, err := logdb.NewDB(chid, conf.DBSecret, conf.DBUser, conf.DBPassword, conf.DBName, conf.DBPort, conf.DBHost, conf.DBReaderHost)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer d.Close()
 	////////////////////
-	////////////////////
-	// pubkey
-	pubkey, err := common.PrivateKeyToPublicKey(conf.RelayPrivateKey)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	////////////////////
-	////////////////////
-	// nostr
-	relay := khatru.NewRelay()
-
-	relay.Info.Name = conf.RelayInfoName
-	relay.Info.PubKey = pubkey
-	relay.Info.Description = conf.RelayInfoDescription
-	relay.Info.Icon = conf.RelayInfoIcon
-
-	relay.StoreEvent = append(relay.StoreEvent, ndb.SaveEvent)
-	relay.QueryEvents = append(relay.QueryEvents, ndb.QueryEvents)
-	relay.CountEvents = append(relay.CountEvents, ndb.CountEvents)
-	relay.DeleteEvent = append(relay.DeleteEvent, ndb.DeleteEvent)
-	relay.ReplaceEvent = append(relay.ReplaceEvent, ndb.ReplaceEvent)
-
-	////////////////////
-	////////////////////
-	// nostr-service
-	n := nost.NewNostr(conf.RelayPrivateKey, &ndb, relay, conf.RelayUrl)
-
-	////////////////////
-	err = logs.MigrateLogs(ctx, evm, chid, group, conf.RelayPrivateKey, pubkey, d, n)
+	err = logs.MigrateLogs(ctx, evm, chid, group, conf.RelayPrivateKey, a.Pubkey, d, n)
 	if err != nil {
 		log.Fatal(err)
 	}
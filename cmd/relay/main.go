@@ -1,19 +1,72 @@
+//go:build !nostronly
+
 package main
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math/big"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/comunifi/relay/internal/accounting"
+	"github.com/comunifi/relay/internal/adminauth"
+	"github.com/comunifi/relay/internal/antivirus"
+	"github.com/comunifi/relay/internal/api"
+	"github.com/comunifi/relay/internal/app"
+	"github.com/comunifi/relay/internal/backup"
+	"github.com/comunifi/relay/internal/blobgc"
 	"github.com/comunifi/relay/internal/blossom"
-	"github.com/comunifi/relay/internal/config"
+	"github.com/comunifi/relay/internal/bridge"
+	"github.com/comunifi/relay/internal/bucket"
+	"github.com/comunifi/relay/internal/calendar"
+	"github.com/comunifi/relay/internal/chain"
+	"github.com/comunifi/relay/internal/contacts"
+	"github.com/comunifi/relay/internal/debug"
+	"github.com/comunifi/relay/internal/denylist"
+	"github.com/comunifi/relay/internal/dev"
+	"github.com/comunifi/relay/internal/dms"
+	"github.com/comunifi/relay/internal/email"
 	"github.com/comunifi/relay/internal/ethrequest"
+	"github.com/comunifi/relay/internal/gas"
+	"github.com/comunifi/relay/internal/groupcheck"
+	"github.com/comunifi/relay/internal/groupprofiles"
 	"github.com/comunifi/relay/internal/groups"
-	"github.com/comunifi/relay/pkg/common"
-	"github.com/fiatjaf/eventstore/postgresql"
-	"github.com/fiatjaf/khatru"
+	"github.com/comunifi/relay/internal/grouptokens"
+	"github.com/comunifi/relay/internal/hooks"
+	"github.com/comunifi/relay/internal/indexer"
+	"github.com/comunifi/relay/internal/ingest"
+	"github.com/comunifi/relay/internal/integrity"
+	"github.com/comunifi/relay/internal/load"
+	"github.com/comunifi/relay/internal/maintenance"
+	"github.com/comunifi/relay/internal/notify"
+	"github.com/comunifi/relay/internal/oracle"
+	"github.com/comunifi/relay/internal/outbox"
+	"github.com/comunifi/relay/internal/paymaster"
+	"github.com/comunifi/relay/internal/polls"
+	"github.com/comunifi/relay/internal/presence"
+	"github.com/comunifi/relay/internal/privacy"
+	"github.com/comunifi/relay/internal/queue"
+	"github.com/comunifi/relay/internal/signatures"
+	"github.com/comunifi/relay/internal/signer"
+	"github.com/comunifi/relay/internal/startup"
+	"github.com/comunifi/relay/internal/status"
+	"github.com/comunifi/relay/internal/tokengate"
+	"github.com/comunifi/relay/internal/transcode"
+	"github.com/comunifi/relay/internal/transfernotify"
+	"github.com/comunifi/relay/internal/uploads"
+	"github.com/comunifi/relay/internal/userophooks"
+	"github.com/comunifi/relay/internal/webhook"
+	"github.com/comunifi/relay/internal/wordfilter"
+	gethcommon "github.com/ethereum/go-ethereum/common"
+	gonostr "github.com/nbd-wtf/go-nostr"
 )
 
 func main() {
@@ -21,134 +74,952 @@ func main() {
 
 	////////////////////
 	// flags
-	// port := flag.Int("port", 3001, "port to listen on")
+	port := flag.Int("port", 3001, "port to listen on")
 
 	env := flag.String("env", ".env", "path to .env file")
 
-	// polling := flag.Bool("polling", false, "enable polling")
+	polling := flag.Bool("polling", false, "enable polling")
+
+	noindex := flag.Bool("noindex", false, "disable indexing")
 
-	// noindex := flag.Bool("noindex", false, "disable indexing")
+	useropqbf := flag.Int("buffer", 1000, "userop queue buffer size (default: 1000)")
 
-	// useropqbf := flag.Int("buffer", 1000, "userop queue buffer size (default: 1000)")
+	notifyFlag := flag.Bool("notify", false, "enable webhook notifications")
 
-	// notify := flag.Bool("notify", false, "enable webhook notifications")
+	devmode := flag.Bool("dev", false, "seed a local anvil/hardhat chain with a sponsor, a demo event and a demo group")
 
 	flag.Parse()
 	////////////////////
 
 	ctx := context.Background()
 
-	println("env", *env)
-
 	////////////////////
-	// config
-	conf, err := config.New(ctx, *env)
-	if err != nil {
-		log.Fatal(err)
+	// config, chain and databases
+	if !*polling {
+		log.Default().Println("running in streaming mode...")
+	} else {
+		log.Default().Println("running in polling mode...")
 	}
-	////////////////////
-	////////////////////
-	// evm
-	rpcUrl := conf.RPCWSURL
 
-	evm, err := ethrequest.NewEthService(ctx, rpcUrl)
+	a, err := app.New(ctx, *env,
+		app.WithFaults(),
+		app.WithChain(!*polling),
+		app.WithEventStore(),
+		app.WithDB(),
+		app.WithRelay(),
+		app.WithNostr(),
+	)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer a.Close()
+
+	conf, bo, fi := a.Conf, a.Backoff, a.Faults
+	evm, chid := a.EVM, a.ChainID
+	ndb, d := a.NDB, a.DB
 
-	chid, err := evm.ChainID()
+	profile, err := ethrequest.LoadProfile(chid.String(), conf.ChainProfile)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	log.Default().Println("node running for chain: ", chid.String())
+	evm.SetProfile(profile)
+	log.Default().Printf("using the %s chain profile, %s blocks, %s gas strategy", profile.Name, profile.BlockTime, profile.GasStrategy)
+
+	entryPoints := []gethcommon.Address{}
+	for _, ep := range profile.EntryPoints {
+		entryPoints = append(entryPoints, gethcommon.HexToAddress(ep))
+	}
+	////////////////////
+
 	////////////////////
+	// main error channel
+	quitAck := make(chan error)
+	defer close(quitAck)
 	////////////////////
-	// db
-	log.Default().Println("starting internal db service...")
 
-	db := postgresql.PostgresBackend{
-		DatabaseURL: fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", conf.DBUser, conf.DBPassword, conf.DBHost, conf.DBPort, conf.DBName),
+	pools := a.Pools
+
+	////////////////////
+	// webhook
+	log.Default().Println("starting webhook service...")
+
+	w := webhook.NewMessager(conf.DiscordURL, fmt.Sprintf("%s-relay", conf.ChainName), *notifyFlag)
+	w.SetLimits(webhook.Limits{
+		DedupeWindow: conf.WebhookDedupeWindow,
+		PerMinute: map[webhook.Severity]int{
+			webhook.SeverityInfo:    conf.WebhookInfoRate,
+			webhook.SeverityWarning: conf.WebhookWarningRate,
+			webhook.SeverityError:   conf.WebhookErrorRate,
+		},
+		FlushInterval: conf.WebhookFlushInterval,
+	})
+
+	go func() {
+		quitAck <- w.Start(ctx)
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			// in case of a panic, notify the webhook messager with an error notification
+			err := fmt.Errorf("recovered from panic: %v", r)
+			log.Default().Println(err)
+			w.NotifyError(ctx, err)
+			// sentry.CaptureException(err)
+		}
+	}()
+
+	w.Notify(ctx, "engine started")
+	////////////////////
+
+	////////////////////
+	// secrets
+	if sw := conf.SecretsWatcher(); sw != nil && conf.SecretsRefresh > 0 {
+		go sw.Run(ctx, conf.SecretsRefresh, func(name string) {
+			// secrets are only read at startup
+			w.NotifyWarning(ctx, fmt.Errorf("%s was rotated at its source, restart the relay to use the new value", name))
+		})
 	}
+	////////////////////
+
+	////////////////////
+	// push queue
+	log.Default().Println("starting push queue service...")
+
+	pu := queue.NewPushService()
+
+	pushqueue, pushqerr := queue.NewService("push", 3, *useropqbf, ctx)
+	pushqueue.SetSlowThreshold(conf.QueueSlowThreshold)
+	defer pushqueue.Close()
+
+	go func() {
+		for err := range pushqerr {
+			// TODO: handle errors coming from the queue
+			w.NotifyError(ctx, err)
+			log.Default().Println(err.Error())
+		}
+	}()
+
+	go func() {
+		quitAck <- pushqueue.Start(pu)
+	}()
+
+	// batch non-urgent activity into digests before pushing
+	digest := queue.NewDigestService(ctx, conf.PushDigestWindow, pushqueue)
+
+	go func() {
+		quitAck <- digest.Start()
+	}()
+	////////////////////
 
-	err = db.Init()
+	////////////////////
+	// nostr
+	relay, pubkey, n := a.Relay, a.Pubkey, a.Nostr
+
+	g := groups.NewGroupsService(ndb, pubkey, conf.RelayPrivateKey)
+
+	// events the relay signs but fails to store are retried until they are
+	ob := outbox.NewService(ctx, d.OutboxDB, n, conf.OutboxInterval)
+	n.SetOutbox(ob)
+	g.SetOutbox(ob)
+
+	go func() {
+		quitAck <- ob.Start()
+	}()
+
+	// membership is checked against groups projected from their moderation events, a projection
+	// that was never built is built from the events already stored
+	g.SetProjection(d.GroupStateDB)
+	projected, err := d.GroupStateDB.HasGroups()
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+
+	if !projected {
+		replayed, err := g.RebuildProjection(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Default().Printf("projected the state of groups from %d moderation events", replayed)
+	}
+
+	// tokens minted by group admins let bots post and upload into a single group
+	gt := grouptokens.NewService(d, g, ndb)
+	g.SetBots(gt)
+
+	// keyword filters of the relay and of group admins
+	wf := wordfilter.NewService(ndb, g, d.FilteredContentDB, conf.WordFilterDefaults, conf.WordFilterAction)
+	g.SetFilters(wf)
 	////////////////////
+
 	////////////////////
-	// pubkey
-	pubkey, err := common.PrivateKeyToPublicKey(conf.RelayPrivateKey)
-	if err != nil {
-		log.Fatal(err)
+	// dev
+	if *devmode {
+		log.Default().Println("running in dev mode...")
+
+		err = dev.NewService(ctx, chid, conf.RelayPrivateKey, evm, d, ndb, g).Seed(dev.Config{
+			Paymaster: conf.DevPaymaster,
+			Token:     conf.DevToken,
+			GroupID:   conf.DevGroupID,
+			GroupName: conf.DevGroupName,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	////////////////////
+
+	////////////////////
+	// userop queue
+	log.Default().Println("starting userop queue service...")
+
+	mempool := queue.NewMempool()
+
+	op := queue.NewUserOpService(ctx, chid, d, n, evm, mempool, pushqueue)
+
+	// sponsors can keep their key out of the database, in KMS or behind a json-rpc signer
+	kmsRegion := conf.KMSRegion
+	if kmsRegion == "" {
+		kmsRegion = conf.AWSDefaultRegion
+	}
+	op.SetSigners(signer.NewCache(&signer.KMSConfig{
+		Region:      kmsRegion,
+		AccessKeyID: conf.AWSAccessKeyID,
+		SecretKey:   conf.AWSSecretAccessKey,
+		Endpoint:    conf.KMSEndpoint,
+	}))
+
+	// high value bundles are confirmed once a second node agrees on their receipt
+	if conf.RPCVerifyURL != "" {
+		verifier, err := ethrequest.NewEthService(ctx, conf.RPCVerifyURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer verifier.Close()
+
+		vchid, err := verifier.ChainID()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if vchid.Cmp(chid) != 0 {
+			log.Fatalf("RPC_VERIFY_URL is on chain %s, expected %s", vchid.String(), chid.String())
+		}
+
+		threshold, _ := new(big.Int).SetString(conf.RPCVerifyThreshold, 10)
+		op.SetReceiptVerifier(verifier, threshold)
+	}
+
+	// bundles go to a private mempool on chains that have one so that they can't be frontrun
+	if privateURL := conf.PrivateRPC(chid.String()); privateURL != "" {
+		private, err := ethrequest.NewEthService(ctx, privateURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer private.Close()
+
+		log.Default().Println("submitting bundles to a private mempool")
+		op.SetPrivateSubmission(private, conf.PrivateRPCTimeout)
 	}
 
+	useropq, qerr := queue.NewService("userop", 3, *useropqbf, ctx)
+	useropq.SetSlowThreshold(conf.QueueSlowThreshold)
+	defer useropq.Close()
+
+	// bundles that aren't urgent wait for the gas price to calm down, the state is served by /v1/gas
+	gp := gas.NewTracker(evm, conf.GasSampleInterval, conf.GasSmoothing, conf.GasSpikeMultiple)
+	op.SetGasGuard(gp, useropq)
+
+	go func() {
+		quitAck <- gp.Start(ctx)
+	}()
+
+	go func() {
+		quitAck <- op.ReleaseHeld(conf.GasSampleInterval)
+	}()
+
+	go func() {
+		for err := range qerr {
+			// TODO: handle errors coming from the queue
+			w.NotifyError(ctx, err)
+			log.Default().Println(err.Error())
+		}
+	}()
+
+	go func() {
+		quitAck <- useropq.Start(op)
+	}()
+
+	// ops that sit in the queue for too long are failed instead of staying pending forever
+	go func() {
+		quitAck <- op.StartExpiry(conf.UserOpTTL)
+	}()
 	////////////////////
+
 	////////////////////
-	// nostr
-	relay := khatru.NewRelay()
+	// price oracle
+	var pp oracle.Provider
+	switch conf.OracleProvider {
+	case "chainlink":
+		pp, err = oracle.NewChainlink(evm, gethcommon.HexToAddress(conf.OracleChainlinkFeed), conf.OracleChainlinkAge)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "coingecko":
+		pp = oracle.NewCoinGecko(conf.OracleCoinGeckoURL, conf.OracleCoinGeckoID)
+	default:
+		pp = oracle.NewFixed(conf.OracleFixedPrice)
+	}
 
-	relay.Info.Name = conf.RelayInfoName
-	relay.Info.PubKey = pubkey
-	relay.Info.Description = conf.RelayInfoDescription
-	relay.Info.Icon = conf.RelayInfoIcon
+	o := oracle.NewService(pp, conf.OracleCurrency, conf.OracleCacheTTL)
 
-	relay.StoreEvent = append(relay.StoreEvent, db.SaveEvent)
-	relay.QueryEvents = append(relay.QueryEvents, db.QueryEvents)
-	relay.CountEvents = append(relay.CountEvents, db.CountEvents)
-	relay.DeleteEvent = append(relay.DeleteEvent, db.DeleteEvent)
-	relay.ReplaceEvent = append(relay.ReplaceEvent, db.ReplaceEvent)
+	log.Default().Println("using price oracle:", pp.Name())
+	////////////////////
 
 	////////////////////
-	// NIP-29 Groups enforcement
-	log.Default().Println("initializing NIP-29 groups enforcement...")
+	// event signatures
+	sigs := signatures.NewRegistry(conf.SignatureDBURL)
+	////////////////////
 
-	groupsService := groups.NewGroupsService(&db, pubkey, conf.RelayPrivateKey)
-	groupsService.AddHooks(relay)
+	////////////////////
+	// nostr hooks
+	pipeline := hooks.NewPipeline()
+	pipeline.SetTimeout(conf.HookTimeout)
+	pipeline.SetFailOpen(conf.HooksFailOpen...)
+	pipeline.SetWorkers(conf.HookWorkers, conf.HookQueue)
 
-	log.Default().Println("NIP-29 groups enforcement initialized (closed groups with admin/member roles)")
+	go func() {
+		quitAck <- pipeline.Start(ctx)
+	}()
 	////////////////////
 
 	////////////////////
-	// blossom (media storage)
-	if conf.AWSS3BucketName != "" && conf.AWSAccessKeyID != "" && conf.AWSSecretAccessKey != "" {
-		log.Default().Println("starting blossom media service...")
+	// maintenance mode, writes are rejected while it is on
+	mm := maintenance.New(conf.Maintenance, conf.MaintenanceReason)
+	if mm.Enabled() {
+		log.Default().Println("relay starting in read-only maintenance mode")
+	}
+	////////////////////
+
+	////////////////////
+	// load signals for autoscalers, served by /v1/admin/load
+	ls := load.NewSampler(conf.LoadSampleInterval)
+	ls.AddQueue("userop", useropq)
+	ls.AddQueue("push", pushqueue)
+	ls.AddQueue("mempool", mempool)
+	ls.AddQueue("hooks", pipeline)
+	ls.AddConnections(pools)
+	ls.SetLatency(d.Latency)
+
+	go func() {
+		quitAck <- ls.Start(ctx)
+	}()
+	////////////////////
+
+	////////////////////
+	// api
+	err = a.Use(app.WithAPI(useropq, mempool))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := a.API
+	s.SetEntryPoints(entryPoints)
+	s.SetMaintenance(mm)
+	s.SetLoad(ls)
+	s.SetGas(gas.NewHandlers(gp))
+	s.AddCollectors(gp, queue.Latencies{useropq, pushqueue})
+	s.SetGroups(g)
+	s.SetGroupTokens(gt)
+	s.SetCalendar(calendar.NewService(g))
+	ct := contacts.NewService(ndb, d.AccountLinkDB, g)
+	s.SetContacts(ct)
+	s.SetWordFilter(wf)
+	prof, err := groupprofiles.NewService(ndb, n, g, conf.RelayPrivateKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.SetGroupProfiles(prof)
+	pv := privacy.NewService(d, g, n)
+	err = pv.RecoverPurges()
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.SetPrivacy(pv)
+	up := uploads.NewService(d, conf.UploadIPKey, &uploads.Config{
+		Window:     conf.UploadFlagWindow,
+		MaxUploads: conf.UploadFlagCount,
+		MaxBytes:   conf.UploadFlagBytes,
+		Cost: &uploads.StorageCost{
+			ArchiveAfter: time.Duration(conf.BlobArchiveAfterDays) * 24 * time.Hour,
+			Standard:     conf.BlobPriceStandard,
+			Archive:      conf.BlobPriceArchive,
+		},
+	}, w)
+	up.SetGroups(g)
+	s.SetUploads(up)
+	bgc := blobgc.NewCollector(ctx, d, nil, &blobgc.Config{
+		Interval: conf.BlobGCInterval,
+		Grace:    conf.BlobGCGrace,
+		DryRun:   conf.BlobGCDryRun,
+	}, w)
+	s.SetBlobGC(blobgc.NewHandlers(bgc))
+	if conf.EmailDomain != "" {
+		s.SetEmail(email.NewService(d, g, n, conf.EmailDomain, conf.EmailSigningKey))
+	}
+	s.SetLegacyLogsSunset(conf.LegacyLogsSunset)
+
+	// membership of token gated groups follows token holdings
+	if conf.TokenGateConfig != "" {
+		tcfg, err := tokengate.LoadConfig(conf.TokenGateConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		tg, err := tokengate.NewSyncer(ctx, g, d, evm, n, tcfg, conf.TokenGateInterval, conf.TokenGateDryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s.SetTokenGate(tokengate.NewHandlers(tg))
+
+		go func() {
+			quitAck <- tg.Start()
+		}()
+	}
+
+	// runtime state of the queues, dumped by /debug/runtime
+	dh := debug.NewHandlers()
+	dh.Register("userop_queue", useropq)
+	dh.Register("push_queue", pushqueue)
+	dh.Register("mempool", mempool)
+	dh.Register("hooks", pipeline)
+
+	if conf.DebugEndpoints {
+		s.SetDebug(dh)
+	}
+
+	// operator dashboard, served under /v1/admin
+	st := status.NewService(d, evm, ndb, w)
+	st.SetRotation(conf.SponsorKeyRotation, conf.SponsorSignerRotation)
+	st.AddQueue("userop_queue", useropq)
+	st.AddQueue("push_queue", pushqueue)
+	st.AddQueue("mempool", mempool)
+	s.SetStatus(st)
+
+	// operators log in to the admin routes with their keys, sign-in messages are for the relay's host
+	if conf.AdminSessionKey != "" {
+		key, err := hex.DecodeString(conf.AdminSessionKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		relayURL, err := url.Parse(conf.RelayUrl)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s.SetAdminAuth(adminauth.NewService(&adminauth.Config{
+			Addresses: conf.AdminAddresses,
+			Pubkeys:   conf.AdminPubkeys,
+			Key:       key,
+			TTL:       conf.AdminSessionTTL,
+			Domain:    relayURL.Host,
+			ChainID:   chid,
+		}))
+	}
+	if conf.IngestAPIKey != "" {
+		s.SetIngest(ingest.NewService(n, conf.IngestChains), conf.IngestAPIKey)
+	}
+
+	// webhooks of the senders and paymasters of user ops
+	uh := userophooks.NewService(d.UserOpWebhookDB)
+	n.OnSaved = append(n.OnSaved, uh.OnSaved)
+	s.SetUserOpHooks(uh)
+
+	go func() {
+		quitAck <- uh.Start(ctx)
+	}()
+
+	s.AddChecks(evm.Breaker())
+	s.AddCollectors(evm.Breaker(), pipeline, mm)
+	if fi.Enabled() {
+		s.AddCollectors(fi)
+	}
+
+	// recently served blobs kept on the local disk, in front of S3
+	var blobCache *blossom.Cache
+	if conf.BlobCacheDir != "" {
+		blobCache, err = blossom.NewCache(conf.BlobCacheDir, conf.BlobCacheSize, conf.BlobCacheMaxBlob)
+		if err != nil {
+			log.Fatal("failed to open blob cache:", err)
+		}
+		s.AddCollectors(blobCache)
+	}
+	s.SetRPCLimits(
+		api.LimitConfig{Concurrency: conf.RPCProxyConcurrency, Queue: conf.RPCProxyQueue, Wait: conf.RPCProxyWait},
+		api.LimitConfig{Concurrency: conf.RPCUserOpConcurrency, Queue: conf.RPCUserOpQueue, Wait: conf.RPCUserOpWait},
+	)
+	s.SetChainLimits(chain.Limits{
+		Methods:           conf.ChainMethods,
+		MaxCallData:       conf.ChainMaxCallData,
+		MaxBlockRange:     conf.ChainMaxBlockRange,
+		MaxResponseSize:   conf.ChainMaxResponseSize,
+		MaxLogsBlockRange: conf.ChainMaxLogsRange,
+		MaxLogsAddresses:  conf.ChainMaxLogsAddrs,
+		LogsCacheTTL:      conf.ChainLogsCacheTTL,
+	})
+	sponsorLimits := paymaster.Limits{
+		Ops:    conf.SponsorMaxOps,
+		Gas:    conf.SponsorMaxGas,
+		Window: conf.SponsorWindow,
+	}
+	s.SetSponsorLimits(sponsorLimits)
+
+	// denied user ops are always recorded, announcing them lets wallet developers follow them live
+	var announcer paymaster.Announcer
+	if conf.SponsorDenialEvents {
+		announcer = n
+	}
+	denials := paymaster.NewDenials(d, announcer)
+	s.SetDenials(denials)
+
+	// blobs and events banned across all groups, for takedowns
+	bans := denylist.NewService(d.BanDB, ndb, conf.DenylistURL)
+	err = bans.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.SetBans(bans)
+
+	if conf.DenylistURL != "" {
+		go func() {
+			quitAck <- bans.Start(ctx, conf.DenylistSyncInterval)
+		}()
+	}
+
+	providers := []bucket.Provider{bucket.NewPinata(conf.PinataBaseURL, conf.PinataAPIKey, conf.PinataAPISecret)}
+	if conf.KuboAPIURL != "" {
+		providers = append(providers, bucket.NewKubo(conf.KuboAPIURL))
+	}
+
+	bu := bucket.NewBucket(bucket.Options{
+		Timeout: conf.BucketTimeout,
+		Retries: conf.BucketRetries,
+		Backoff: conf.BucketBackoff,
+		Quorum:  conf.BucketQuorum,
+
+		GatewayURL: conf.IPFSGatewayURL,
+	}, d.PinDB, providers...)
+
+	acs := accounting.NewService(chid.String(), d, o)
+
+	// blobs of groups kept in buckets of their own
+	var residency *blossom.ResidencyConfig
+	if conf.BlobResidencyConfig != "" {
+		residency, err = blossom.LoadResidencyConfig(conf.BlobResidencyConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// integrity checks, blobs are only verified when the blob storage is configured
+	var blobs func() backup.BlobStore
+	if app.BlobStorage(conf) {
+		if residency != nil {
+			// blobs are searched in the buckets of groups too
+			st, err := blossom.NewStorages(ctx, &blossom.BlossomConfig{
+				AWSAccessKeyID:  conf.AWSAccessKeyID,
+				AWSSecretKey:    conf.AWSSecretAccessKey,
+				AWSRegion:       conf.AWSDefaultRegion,
+				AWSEndpointURL:  conf.AWSEndpointUrl,
+				AWSS3BucketName: conf.AWSS3BucketName,
+			}, residency)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			blobs = func() backup.BlobStore {
+				return st
+			}
+		} else {
+			s3c, err := backup.NewS3Client(ctx, &backup.Config{
+				AWSAccessKeyID:  conf.AWSAccessKeyID,
+				AWSSecretKey:    conf.AWSSecretAccessKey,
+				AWSRegion:       conf.AWSDefaultRegion,
+				AWSEndpointURL:  conf.AWSEndpointUrl,
+				AWSS3BucketName: conf.AWSS3BucketName,
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			blobs = func() backup.BlobStore {
+				return backup.NewS3Blobs(s3c, conf.AWSS3BucketName)
+			}
+		}
+	}
+
+	ic := integrity.NewChecker(ctx, ndb, evm, blobs, &integrity.Config{
+		Interval: conf.IntegrityInterval,
+		Sample:   conf.IntegritySample,
+	}, w)
+	ic.SetRewrites(d.BlobRewriteDB)
+
+	if conf.IntegrityCheck {
+		go func() {
+			quitAck <- ic.Start()
+		}()
+	}
+
+	// group membership is replayed from moderation events and compared to what was derived from them
+	gc := groupcheck.NewChecker(ctx, g, &groupcheck.Config{
+		Interval: conf.GroupCheckInterval,
+		Repair:   conf.GroupCheckRepair,
+	}, w)
+	gc.SetProjection(d.GroupStateDB)
+	s.SetGroupCheck(groupcheck.NewHandlers(gc))
+
+	if conf.GroupCheck {
+		go func() {
+			quitAck <- gc.Start()
+		}()
+	}
+
+	// the indexer is started once the api listens, its lag is served by the api
+	var idx *indexer.Indexer
+	if !*noindex {
+		err = a.Use(app.WithIndexer(sigs))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		idx = a.Indexer
+		dh.Register("indexer", idx)
+		st.SetIndexer(idx)
+		s.SetIndexer(indexer.NewHandlers(idx))
+		s.AddCollectors(idx)
+
+		if conf.IndexerTxSender {
+			idx.SetTxSenderLookup(conf.IndexerSenderCache)
+		}
+
+		if conf.IndexerLagThreshold > 0 {
+			idx.SetLagAlerts(w, conf.IndexerLagThreshold)
+		}
+
+		idx.SetConfirmations(profile.Confirmations)
+
+		// recipients that can't be reached by push hear about their transfers on nostr
+		if conf.PushTransferDM {
+			tokens, err := transfernotify.NewERC20Tokens(evm)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			dm, err := transfernotify.NewDMNotifier(n, conf.RelayPrivateKey)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			tn := transfernotify.NewService(ctx, transfernotify.NewDBRecipients(d), tokens)
+			tn.AddNotifier(dm)
+			idx.AddLogHook(tn.OnLog)
+
+			go func() {
+				quitAck <- tn.Start()
+			}()
+		}
+	}
+
+	wsr := s.CreateBaseRouter()
+	wsr = s.AddMiddleware(wsr)
+	wsr = s.AddRoutes(wsr, bu, accounting.NewHandlers(acs), integrity.NewHandlers(ic), sigs, conf.APIKey)
+
+	go func() {
+		quitAck <- s.Start(*port, wsr)
+	}()
+
+	log.Default().Println("listening on port: ", *port)
+	////////////////////
+	////////////////////
+	// indexer
+	if idx != nil {
+		log.Default().Println("starting indexer service...")
+
+		go func() {
+			quitAck <- idx.MonitorLag(conf.IndexerLagInterval)
+		}()
+
+		if conf.IndexerFinality > 0 {
+			go func() {
+				quitAck <- idx.MonitorFinality(conf.IndexerFinality)
+			}()
+		}
+
+		go func() {
+			if conf.StartupPartial {
+				// keep serving nostr while the indexer waits for the rpc node
+				quitAck <- startup.Supervise(ctx, "indexer", bo, idx.Start)
+				return
+			}
+
+			quitAck <- idx.Start()
+		}()
+	}
+	////////////////////
+	////////////////////
+	// nostr
+	hpm := paymaster.NewService(evm, d, chid, sponsorLimits)
+	hpm.SetDenials(denials)
+
+	r := hooks.NewRouter(evm, d, n, hpm, useropq, mempool, chid, ndb)
+	r.SetEntryPoints(entryPoints)
+	relay = r.AddHooks(relay)
+
+	pipeline.Register("groups", g)
+
+	// votes on group polls, tallied by the relay
+	pipeline.Register("polls", polls.NewService(ndb, d, evm, n))
 
-		// Create a separate database connection for blob metadata
-		// Note: Using same DB for simplicity, but could use a separate DB in production
-		blobDB := postgresql.PostgresBackend{
-			DatabaseURL: fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", conf.DBUser, conf.DBPassword, conf.DBHost, conf.DBPort, conf.DBName),
+	// group announcements and pinned messages mirrored to discord and telegram
+	if conf.BridgeConfig != "" {
+		bcfg, err := bridge.LoadConfig(conf.BridgeConfig)
+		if err != nil {
+			log.Fatal(err)
 		}
-		if err := blobDB.Init(); err != nil {
-			log.Fatal("failed to initialize blob metadata database:", err)
+
+		mediaURL := conf.BridgeMediaURL
+		if mediaURL == "" {
+			mediaURL = conf.RelayUrl
 		}
-		defer blobDB.Close()
 
-		blossomCfg := &blossom.BlossomConfig{
-			ServiceURL:      conf.RelayUrl,
+		br, err := bridge.New(bcfg, g, pubkey, mediaURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		pipeline.Register("bridge", br)
+	}
+	pipeline.Register("userop", r.UserOps())
+	pipeline.Register("notify", notify.NewService(g, d, digest))
+
+	err = pipeline.Apply(relay, conf.Hooks, conf.HooksDisabled)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// banned events never reach a hook
+	relay.RejectEvent = slices.Insert(relay.RejectEvent, 0, bans.RejectEvent)
+
+	// checked before any hook so that nothing is written in maintenance mode
+	relay.RejectEvent = slices.Insert(relay.RejectEvent, 0, mm.RejectEvent)
+
+	// address books are always private to their author, whichever hooks are enabled
+	ct.AddHooks(relay)
+
+	// direct messages are always held to their policy, whichever hooks are enabled
+	dm := dms.NewService(ndb, d.AccountLinkDB, conf.DMTTL)
+	dm.AddHooks(relay)
+
+	go func() {
+		quitAck <- dm.Start(ctx)
+	}()
+
+	// presence is only relayed to members, whichever hooks are enabled
+	ps := presence.NewService(g, conf.PresenceTTL, conf.PresenceTypingTTL, conf.PresenceInterval)
+	ps.AddHooks(relay)
+
+	go func() {
+		quitAck <- ps.Start(ctx)
+	}()
+
+	// references to blobs are always tracked, a blob whose references were missed would be collected
+	blobgc.NewTracker(d).AddHooks(relay)
+
+	// runs after every other store so that only stored events count towards the ingest rate
+	relay.StoreEvent = append(relay.StoreEvent, func(ctx context.Context, ev *gonostr.Event) error {
+		ls.Ingest(1)
+		return nil
+	})
+
+	nostrConns := &load.Gauge{}
+	relay.OnConnect = append(relay.OnConnect, func(ctx context.Context) { nostrConns.Add(1) })
+	relay.OnDisconnect = append(relay.OnDisconnect, func(ctx context.Context) { nostrConns.Add(-1) })
+	ls.AddConnections(nostrConns)
+
+	log.Default().Println("nostr hooks:", strings.Join(pipeline.Enabled(), ", "))
+	////////////////////
+
+	////////////////////
+	// accounting export
+	if conf.AccountingExport && conf.AWSS3BucketName != "" {
+		log.Default().Println("starting accounting exporter...")
+
+		exp, err := accounting.NewExporter(ctx, acs, &accounting.ExporterConfig{
 			AWSAccessKeyID:  conf.AWSAccessKeyID,
 			AWSSecretKey:    conf.AWSSecretAccessKey,
 			AWSRegion:       conf.AWSDefaultRegion,
 			AWSEndpointURL:  conf.AWSEndpointUrl,
 			AWSS3BucketName: conf.AWSS3BucketName,
+			Prefix:          conf.AccountingS3Prefix,
+		}, w)
+		if err != nil {
+			log.Fatal("failed to initialize accounting exporter:", err)
 		}
+		exp.SetFaults(fi)
 
-		// Pass blobDB for blob metadata, and db for querying group membership events
-		_, err := blossom.NewBlossomService(ctx, relay, &blobDB, &db, blossomCfg)
+		go func() {
+			quitAck <- exp.Start()
+		}()
+	}
+	////////////////////
+
+	////////////////////
+	// backups
+	if conf.Backup && conf.AWSS3BucketName != "" {
+		log.Default().Println("starting backups...")
+
+		bk, err := backup.NewBackuper(ctx, chid.String(), d, ndb, &backup.Config{
+			AWSAccessKeyID:  conf.AWSAccessKeyID,
+			AWSSecretKey:    conf.AWSSecretAccessKey,
+			AWSRegion:       conf.AWSDefaultRegion,
+			AWSEndpointURL:  conf.AWSEndpointUrl,
+			AWSS3BucketName: conf.AWSS3BucketName,
+			Prefix:          conf.BackupS3Prefix,
+			Key:             conf.BackupKey,
+			Interval:        conf.BackupInterval,
+		}, w)
 		if err != nil {
-			log.Fatal("failed to initialize blossom service:", err)
+			log.Fatal("failed to initialize backups:", err)
 		}
+		bk.SetFaults(fi)
+
+		go func() {
+			quitAck <- bk.Start()
+		}()
+	}
+	////////////////////
+
+	////////////////////
+	// blossom (media storage)
+	var relayHandler http.Handler = relay
+	if app.BlobStorage(conf) {
+		err := a.Use(app.WithBlossom(residency))
+		switch {
+		case errors.Is(err, app.ErrBlobStorage) && conf.StartupPartial:
+			log.Default().Println("blossom media service disabled:", err)
+			w.NotifyWarning(ctx, err)
+		case err != nil:
+			log.Fatal(err)
+		default:
+			bs := a.Blossom
+			bs.SetBots(gt)
+			pv.SetBlobs(bs)
+			bs.SetUploads(up)
+			bgc.SetBlobs(bs)
+			bs.SetRewrites(d.BlobRewriteDB)
+			bs.SetDenylist(bans)
+			bans.SetBlobs(bs)
+			if blobCache != nil {
+				bs.SetCache(blobCache)
+			}
+
+			if conf.BlobArchiveAfterDays > 0 {
+				err := bs.ApplyLifecycle(ctx, &blossom.LifecycleConfig{
+					ArchiveAfterDays: conf.BlobArchiveAfterDays,
+					ArchiveClass:     conf.BlobArchiveClass,
+				})
+				if err != nil {
+					// blobs stay in the standard class, the relay works the same
+					log.Default().Println("failed to apply the blob lifecycle:", err)
+					w.NotifyWarning(ctx, err)
+				}
+			}
+
+			if conf.BlobGC {
+				go func() {
+					quitAck <- bgc.Start()
+				}()
+			}
 
-		log.Default().Println("blossom media service initialized with 50MB upload limit")
+			// uploaded videos converted to a mobile friendly mp4
+			var tr transcode.Transcoder
+			switch {
+			case conf.TranscodeFFmpeg != "":
+				tr = transcode.NewFFmpeg(conf.TranscodeFFmpeg)
+			case conf.TranscodeURL != "":
+				tr = transcode.NewHTTP(conf.TranscodeURL)
+			}
+
+			if tr != nil {
+				tc := transcode.NewService(ctx, d, tr, n, &transcode.Config{
+					Workers: conf.TranscodeWorkers,
+					Timeout: conf.TranscodeTimeout,
+					Queue:   conf.TranscodeQueue,
+				})
+				tc.SetBlobs(bs)
+				bs.SetTranscoder(tc)
+
+				go func() {
+					quitAck <- tc.Start()
+				}()
+			}
+
+			// risky uploads quarantined until they are scanned for malware
+			var sc antivirus.Scanner
+			switch {
+			case conf.ScanClamAVAddr != "":
+				sc = antivirus.NewClamAV(conf.ScanClamAVAddr)
+			case conf.ScanURL != "":
+				sc = antivirus.NewHTTP(conf.ScanURL)
+			}
+
+			if sc != nil {
+				av := antivirus.NewService(ctx, d, sc, n, w, &antivirus.Config{
+					Threshold: conf.ScanRiskThreshold,
+					Workers:   conf.ScanWorkers,
+					Timeout:   conf.ScanTimeout,
+					Queue:     conf.ScanQueue,
+				})
+				av.SetBlobs(bs)
+				bs.SetQuarantine(av)
+
+				go func() {
+					quitAck <- av.Start()
+				}()
+			}
+
+			// clients check whether an upload would be accepted before sending it
+			relayHandler = bs.UploadCheck(relayHandler)
+
+			// clients that speak NIP-96 rather than blossom upload to the same storage
+			relayHandler = bs.NIP96(relayHandler)
+
+			bl := bs.Blossom()
+			bl.RejectUpload = slices.Insert(bl.RejectUpload, 0, mm.RejectUpload, bans.RejectUpload)
+			bl.RejectDelete = slices.Insert(bl.RejectDelete, 0, mm.RejectDelete)
+
+			log.Default().Println("blossom media service initialized with 50MB upload limit")
+		}
 	} else {
 		log.Default().Println("blossom media service disabled (S3 credentials not configured)")
 	}
 	////////////////////
 
-	fmt.Println("running on :3334")
-	http.ListenAndServe(":3334", relay)
-
+	go func() {
+		log.Default().Println("relay running on port: 3334")
+		quitAck <- http.ListenAndServe(":3334", blossom.ClientIPMiddleware(relayHandler))
+	}()
 	////////////////////
+
+	for err := range quitAck {
+		if err != nil {
+			w.NotifyError(ctx, err)
+			// sentry.CaptureException(err)
+			log.Fatal(err)
+		}
+	}
+
 	log.Default().Println("engine stopped")
 }
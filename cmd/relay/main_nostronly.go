@@ -0,0 +1,81 @@
+//go:build nostronly
+
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/comunifi/relay/internal/app"
+	"github.com/comunifi/relay/internal/blossom"
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/internal/presence"
+)
+
+// the nostr-only relay serves nostr events, NIP-29 groups and media without a chain, no rpc node,
+// indexer, user ops or api
+func main() {
+	log.Default().Println("starting nostr-only relay...")
+
+	////////////////////
+	// flags
+	env := flag.String("env", ".env", "path to .env file")
+
+	flag.Parse()
+	////////////////////
+
+	ctx := context.Background()
+
+	////////////////////
+	// config and database
+	a, err := app.New(ctx, *env, app.WithEventStore(), app.WithRelay())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer a.Close()
+
+	conf, ndb, relay := a.Conf, a.NDB, a.Relay
+
+	app.UseEventStore(relay, ndb)
+	////////////////////
+
+	////////////////////
+	// NIP-29 Groups enforcement
+	log.Default().Println("initializing NIP-29 groups enforcement...")
+
+	g := groups.NewGroupsService(ndb, a.Pubkey, conf.RelayPrivateKey)
+	g.AddHooks(relay)
+
+	log.Default().Println("NIP-29 groups enforcement initialized (closed groups with admin/member roles)")
+
+	ps := presence.NewService(g, conf.PresenceTTL, conf.PresenceTypingTTL, conf.PresenceInterval)
+	ps.AddHooks(relay)
+
+	go ps.Start(ctx)
+	////////////////////
+
+	////////////////////
+	// blossom (media storage)
+	if app.BlobStorage(conf) {
+		err := a.Use(app.WithBlossom(nil))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Default().Println("blossom media service initialized with 50MB upload limit")
+	} else {
+		log.Default().Println("blossom media service disabled (S3 credentials not configured)")
+	}
+	////////////////////
+
+	log.Default().Println("relay running on port: 3334")
+	err = http.ListenAndServe(":3334", blossom.ClientIPMiddleware(relay))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	////////////////////
+	log.Default().Println("engine stopped")
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/comunifi/relay/internal/backup"
+	"github.com/comunifi/relay/internal/config"
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/doctor"
+	"github.com/comunifi/relay/internal/ethrequest"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// runDoctor validates the configuration against the services the relay depends on, without changing
+// anything but a probe object in the bucket
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+
+	env := fs.String("env", ".env", "path to .env file, missing files are ignored")
+
+	fs.Parse(args)
+
+	ctx := context.Background()
+
+	var (
+		conf    *config.Config
+		chainID *big.Int
+		pool    *pgxpool.Pool
+		missing []string
+	)
+
+	needConfig := func() error {
+		if conf == nil {
+			return doctor.Skip("the configuration is invalid")
+		}
+		return nil
+	}
+
+	needDB := func() error {
+		if err := needConfig(); err != nil {
+			return err
+		}
+		if pool == nil {
+			return doctor.Skip("postgres is unreachable")
+		}
+		if chainID == nil {
+			return doctor.Skip("the chain id is unknown")
+		}
+		return nil
+	}
+
+	checks := []doctor.Check{
+		{Name: "config", Run: func(ctx context.Context) error {
+			c, err := config.New(ctx, *env)
+			if err != nil {
+				return err
+			}
+
+			conf = c
+			return nil
+		}},
+		{Name: "relay key", Run: func(ctx context.Context) error {
+			if err := needConfig(); err != nil {
+				return err
+			}
+
+			if conf.RelayPrivateKey == "" {
+				return errors.New("RELAY_PRIVATE_KEY is not set")
+			}
+
+			_, err := nostr.GetPublicKey(conf.RelayPrivateKey)
+			if err != nil {
+				return fmt.Errorf("RELAY_PRIVATE_KEY is not a valid key: %w", err)
+			}
+
+			return nil
+		}},
+		{Name: "rpc", Run: func(ctx context.Context) error {
+			if err := needConfig(); err != nil {
+				return err
+			}
+
+			id, err := rpcChainID(ctx, conf.RPCURL)
+			if err != nil {
+				return fmt.Errorf("RPC_URL: %w", err)
+			}
+
+			wsID, err := rpcChainID(ctx, conf.RPCWSURL)
+			if err != nil {
+				return fmt.Errorf("RPC_WS_URL: %w", err)
+			}
+
+			if id.Cmp(wsID) != 0 {
+				return fmt.Errorf("RPC_URL is on chain %s but RPC_WS_URL is on chain %s", id, wsID)
+			}
+
+			chainID = id
+			return nil
+		}},
+		{Name: "postgres", Run: func(ctx context.Context) error {
+			if err := needConfig(); err != nil {
+				return err
+			}
+
+			p, err := pgxpool.New(ctx, fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable", conf.DBUser, conf.DBPassword, conf.DBName, conf.DBHost, conf.DBPort))
+			if err != nil {
+				return err
+			}
+
+			err = p.Ping(ctx)
+			if err != nil {
+				p.Close()
+				return err
+			}
+
+			pool = p
+			return nil
+		}},
+		{Name: "schema", Run: func(ctx context.Context) error {
+			if err := needDB(); err != nil {
+				return err
+			}
+
+			var err error
+			missing, err = db.CheckSchema(ctx, pool, chainID.String())
+			if err != nil {
+				return err
+			}
+
+			if len(missing) > 0 {
+				return fmt.Errorf("missing %s, start the relay once to migrate the database", strings.Join(missing, ", "))
+			}
+
+			return nil
+		}},
+		{Name: "events", Run: func(ctx context.Context) error {
+			if err := needDB(); err != nil {
+				return err
+			}
+
+			if slices.Contains(missing, "t_events") {
+				return doctor.Skip("t_events is missing")
+			}
+
+			ids, err := db.EventChainIDs(ctx, pool)
+			if err != nil {
+				return err
+			}
+
+			if len(ids) > 0 && !slices.Contains(ids, chainID.String()) {
+				return fmt.Errorf("events are registered for chain %s but the rpc is on chain %s", strings.Join(ids, ", "), chainID)
+			}
+
+			return nil
+		}},
+		{Name: "sponsor keys", Run: func(ctx context.Context) error {
+			if err := needDB(); err != nil {
+				return err
+			}
+
+			if slices.Contains(missing, "t_sponsors_"+chainID.String()) {
+				return doctor.Skip("the sponsors table is missing")
+			}
+
+			sdb, err := db.NewSponsorDB(ctx, pool, pool, chainID.String(), conf.DBSecret)
+			if err != nil {
+				return err
+			}
+
+			// every key has to decrypt with DB_SECRET
+			_, err = sdb.GetSponsors()
+			if err != nil {
+				return fmt.Errorf("sponsor keys don't decrypt with DB_SECRET: %w", err)
+			}
+
+			return nil
+		}},
+		{Name: "s3", Run: func(ctx context.Context) error {
+			if err := needConfig(); err != nil {
+				return err
+			}
+
+			if conf.AWSS3BucketName == "" {
+				return doctor.Skip("AWS_S3_BUCKET_NAME is not set")
+			}
+
+			return checkBucket(ctx, conf)
+		}},
+	}
+
+	r := doctor.Run(ctx, checks, os.Stdout)
+
+	if pool != nil {
+		pool.Close()
+	}
+
+	if !r.OK() {
+		os.Exit(1)
+	}
+}
+
+// rpcChainID returns the chain id of a node
+func rpcChainID(ctx context.Context, url string) (*big.Int, error) {
+	evm, err := ethrequest.NewEthService(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer evm.Close()
+
+	return evm.ChainID()
+}
+
+// checkBucket puts, reads back and deletes a probe object
+func checkBucket(ctx context.Context, conf *config.Config) error {
+	client, err := backup.NewS3Client(ctx, &backup.Config{
+		AWSAccessKeyID:  conf.AWSAccessKeyID,
+		AWSSecretKey:    conf.AWSSecretAccessKey,
+		AWSRegion:       conf.AWSDefaultRegion,
+		AWSEndpointURL:  conf.AWSEndpointUrl,
+		AWSS3BucketName: conf.AWSS3BucketName,
+	})
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("doctor/%s", nostr.GeneratePrivateKey()[:16])
+	body := []byte("relay doctor")
+
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(conf.AWSS3BucketName),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(body),
+	})
+	if err != nil {
+		return fmt.Errorf("put: %w", err)
+	}
+
+	obj, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(conf.AWSS3BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+
+	got, err := io.ReadAll(obj.Body)
+	obj.Body.Close()
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(conf.AWSS3BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	if !bytes.Equal(got, body) {
+		return errors.New("get: the probe object came back different")
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/comunifi/relay/internal/app"
+	"github.com/comunifi/relay/internal/groups"
+)
+
+// rebuildGroups replays the moderation events of every group into the projected group state,
+// after a restore or when the projection went out of sync with the events
+func rebuildGroups(args []string) {
+	fs := flag.NewFlagSet("rebuild-groups", flag.ExitOnError)
+
+	env := fs.String("env", ".env", "path to .env file")
+
+	fs.Parse(args)
+
+	ctx := context.Background()
+
+	a, err := app.New(ctx, *env, app.WithChain(true), app.WithEventStore(), app.WithDB())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer a.Close()
+
+	g := groups.NewGroupsService(a.NDB, a.Pubkey, a.Conf.RelayPrivateKey)
+	g.SetProjection(a.DB.GroupStateDB)
+
+	replayed, err := g.RebuildProjection(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Default().Printf("projected the state of groups from %d moderation events", replayed)
+}
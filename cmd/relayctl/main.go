@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/comunifi/relay/internal/app"
+	"github.com/comunifi/relay/internal/backup"
+	"github.com/comunifi/relay/internal/blossom"
+	"github.com/comunifi/relay/internal/config"
+	"github.com/comunifi/relay/internal/signer"
+	comm "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: relayctl <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  restore        replay a backup into the configured database")
+	fmt.Fprintln(os.Stderr, "  config         list the settings with their defaults and validate the environment")
+	fmt.Fprintln(os.Stderr, "  doctor         check the configuration against postgres, the rpc and the bucket")
+	fmt.Fprintln(os.Stderr, "  migrate-blobs  move the blobs of a group to the bucket BLOB_RESIDENCY_CONFIG assigns it")
+	fmt.Fprintln(os.Stderr, "  rebuild-groups replay the moderation events of every group into the projected group state")
+	fmt.Fprintln(os.Stderr, "  rotate-key     replace the sponsor or the signer key of a paymaster")
+	fmt.Fprintln(os.Stderr, "  set-signer     submit the bundles of a paymaster with a key in AWS KMS or a json-rpc signer")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "restore":
+		restore(os.Args[2:])
+	case "config":
+		checkConfig(os.Args[2:])
+	case "doctor":
+		runDoctor(os.Args[2:])
+	case "migrate-blobs":
+		migrateBlobs(os.Args[2:])
+	case "rebuild-groups":
+		rebuildGroups(os.Args[2:])
+	case "rotate-key":
+		rotateKey(os.Args[2:])
+	case "set-signer":
+		setSigner(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func checkConfig(args []string) {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+
+	env := fs.String("env", ".env", "path to .env file, missing files are ignored")
+
+	show := fs.Bool("show", false, "print the loaded values, secrets are redacted")
+
+	fs.Parse(args)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENV\tSECTION\tTYPE\tDEFAULT\tREQUIRED")
+	for _, f := range config.Fields() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%v\n", f.Env, f.Section, f.Type, f.Default, f.Required)
+	}
+	tw.Flush()
+
+	fmt.Println()
+
+	conf, err := config.New(context.Background(), *env)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *show {
+		fmt.Println(conf)
+		fmt.Println()
+	}
+
+	fmt.Println("configuration is valid")
+}
+
+func restore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+
+	env := fs.String("env", ".env", "path to .env file")
+
+	key := fs.String("key", "", "S3 key of the backup to restore (default: the latest backup of the chain)")
+
+	file := fs.String("file", "", "restore from a local file instead of S3")
+
+	verifyBlobs := fs.Bool("verify-blobs", true, "check the content of every blob against its hash")
+
+	fs.Parse(args)
+
+	ctx := context.Background()
+
+	////////////////////
+	// config
+	a, err := app.New(ctx, *env)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer a.Close()
+
+	conf := a.Conf
+
+	if conf.BackupKey == "" {
+		log.Fatal("BACKUP_KEY is required to restore a backup")
+	}
+	////////////////////
+	////////////////////
+	// chain and databases
+	err = a.Use(app.WithChain(true), app.WithEventStore(), app.WithDB())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	chid, ndb, d := a.ChainID, a.NDB, a.DB
+
+	log.Default().Println("restoring for chain: ", chid.String())
+	////////////////////
+
+	var client *s3.Client
+	if conf.AWSS3BucketName != "" {
+		client, err = backup.NewS3Client(ctx, &backup.Config{
+			AWSAccessKeyID:  conf.AWSAccessKeyID,
+			AWSSecretKey:    conf.AWSSecretAccessKey,
+			AWSRegion:       conf.AWSDefaultRegion,
+			AWSEndpointURL:  conf.AWSEndpointUrl,
+			AWSS3BucketName: conf.AWSS3BucketName,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var src io.ReadCloser
+	switch {
+	case *file != "":
+		src, err = os.Open(*file)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case client != nil:
+		if *key == "" {
+			*key, err = backup.Latest(ctx, client, conf.AWSS3BucketName, conf.BackupS3Prefix, chid.String())
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		log.Default().Println("downloading backup: ", *key)
+
+		result, err := client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(conf.AWSS3BucketName),
+			Key:    aws.String(*key),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		src = result.Body
+	default:
+		log.Fatal("either -file or an S3 bucket is required")
+	}
+	defer src.Close()
+
+	var blobs backup.BlobStore
+	if *verifyBlobs {
+		if client == nil {
+			log.Fatal("verifying blobs requires an S3 bucket, use -verify-blobs=false to skip")
+		}
+
+		blobs = backup.NewS3Blobs(client, conf.AWSS3BucketName)
+
+		// blobs of groups can be kept in other buckets
+		if conf.BlobResidencyConfig != "" {
+			blobs, err = storages(ctx, conf)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	r := backup.NewRestorer(ctx, chid.String(), d, ndb, blobs)
+	r.SetRewrites(d.BlobRewriteDB)
+
+	stats, err := r.Restore(src, conf.BackupKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Default().Println("restored:", stats)
+}
+
+func migrateBlobs(args []string) {
+	fs := flag.NewFlagSet("migrate-blobs", flag.ExitOnError)
+
+	env := fs.String("env", ".env", "path to .env file")
+
+	group := fs.String("group", "", "id of the group whose blobs are moved")
+
+	dryRun := fs.Bool("dry-run", false, "list the blobs that would be moved without moving them")
+
+	fs.Parse(args)
+
+	if *group == "" {
+		log.Fatal("-group is required")
+	}
+
+	ctx := context.Background()
+
+	conf, err := config.New(ctx, *env)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if conf.AWSS3BucketName == "" {
+		log.Fatal("AWS_S3_BUCKET_NAME is required to migrate blobs")
+	}
+
+	st, err := storages(ctx, conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	m, err := st.MigrateGroup(ctx, *group, *dryRun)
+	if m != nil {
+		for _, sha := range m.Moved {
+			fmt.Println(sha)
+		}
+
+		verb := "moved"
+		if *dryRun {
+			verb = "would move"
+		}
+		log.Default().Printf("%s %d blobs (%d bytes) of %s to %s", verb, len(m.Moved), m.Bytes, m.Group, m.To)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func rotateKey(args []string) {
+	fs := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+
+	env := fs.String("env", ".env", "path to .env file")
+
+	paymaster := fs.String("paymaster", "", "address of the paymaster")
+
+	role := fs.String("role", "signer", "key to rotate: signer signs the paymaster data, sponsor submits the bundles")
+
+	keyFile := fs.String("key-file", "", "file with the new hex private key (default: a new key is generated)")
+
+	fs.Parse(args)
+
+	if !common.IsHexAddress(*paymaster) {
+		log.Fatal("-paymaster must be an address")
+	}
+
+	if *role != "signer" && *role != "sponsor" {
+		log.Fatal("-role must be signer or sponsor")
+	}
+
+	ctx := context.Background()
+
+	a, err := app.New(ctx, *env)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer a.Close()
+
+	var pk string
+	if *keyFile != "" {
+		b, err := os.ReadFile(*keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		pk = strings.TrimPrefix(strings.TrimSpace(string(b)), "0x")
+	} else {
+		pk, _, err = relay.GenerateHexPrivateKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	key, err := comm.HexToPrivateKey(pk)
+	if err != nil {
+		log.Fatal("invalid private key: ", err)
+	}
+
+	err = a.Use(app.WithChain(true), app.WithDB())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	d := a.DB
+
+	contract := common.HexToAddress(*paymaster).Hex()
+	now := time.Now().UTC()
+
+	if *role == "signer" {
+		err = d.SponsorDB.RotateSignerKey(contract, pk, now)
+	} else {
+		err = d.SponsorDB.RotateSponsorKey(contract, pk, now)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	addr := crypto.PubkeyToAddress(key.PublicKey).Hex()
+
+	// the relay only holds the keys, the paymaster and the chain have to know about the new one
+	if *role == "signer" {
+		log.Default().Printf("rotated the signer of %s to %s, set it as the sponsor of the paymaster contract", contract, addr)
+		return
+	}
+
+	log.Default().Printf("rotated the sponsor of %s to %s, fund it to keep submitting bundles", contract, addr)
+}
+
+func setSigner(args []string) {
+	fs := flag.NewFlagSet("set-signer", flag.ExitOnError)
+
+	env := fs.String("env", ".env", "path to .env file")
+
+	paymaster := fs.String("paymaster", "", "address of the paymaster")
+
+	remote := fs.String("remote", "", "kms:<key id> or rpc:<url> of the signer")
+
+	address := fs.String("address", "", "address the signer signs for, required for rpc signers")
+
+	fs.Parse(args)
+
+	if !common.IsHexAddress(*paymaster) {
+		log.Fatal("-paymaster must be an address")
+	}
+
+	if _, _, err := signer.ParseRemote(*remote); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	a, err := app.New(ctx, *env)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer a.Close()
+
+	conf := a.Conf
+
+	kmsRegion := conf.KMSRegion
+	if kmsRegion == "" {
+		kmsRegion = conf.AWSDefaultRegion
+	}
+
+	// reach the signer before the private key is removed
+	sg, err := signer.NewRemote(ctx, &signer.KMSConfig{
+		Region:      kmsRegion,
+		AccessKeyID: conf.AWSAccessKeyID,
+		SecretKey:   conf.AWSSecretAccessKey,
+		Endpoint:    conf.KMSEndpoint,
+	}, *remote, *address)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = a.Use(app.WithChain(true), app.WithDB())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	d := a.DB
+
+	contract := common.HexToAddress(*paymaster).Hex()
+
+	sp, err := d.SponsorDB.GetSponsor(contract)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// without its own signer key the paymaster data was signed with the private key that is removed
+	if sp.SignerKey == "" && sp.PrivateKey != "" {
+		err = d.SponsorDB.RotateSignerKey(contract, sp.PrivateKey, sp.KeyRotatedAt)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	err = d.SponsorDB.SetRemoteSigner(contract, *remote, sg.Address().Hex(), time.Now().UTC())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Default().Printf("bundles of %s are now submitted by %s, fund it to keep submitting bundles", contract, sg.Address().Hex())
+}
+
+// storages returns the buckets blobs are kept in, with the ones of BLOB_RESIDENCY_CONFIG
+func storages(ctx context.Context, conf *config.Config) (*blossom.Storages, error) {
+	var rc *blossom.ResidencyConfig
+	if conf.BlobResidencyConfig != "" {
+		var err error
+		rc, err = blossom.LoadResidencyConfig(conf.BlobResidencyConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return blossom.NewStorages(ctx, &blossom.BlossomConfig{
+		AWSAccessKeyID:  conf.AWSAccessKeyID,
+		AWSSecretKey:    conf.AWSSecretAccessKey,
+		AWSRegion:       conf.AWSDefaultRegion,
+		AWSEndpointURL:  conf.AWSEndpointUrl,
+		AWSS3BucketName: conf.AWSS3BucketName,
+	}, rc)
+}
@@ -0,0 +1,124 @@
+package accounting
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/oracle"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+const MonthFormat = "2006-01"
+
+type Service struct {
+	chainID string
+	db      *db.DB
+	oracle  PriceOracle
+}
+
+func NewService(chainID string, db *db.DB, oracle PriceOracle) *Service {
+	return &Service{
+		chainID: chainID,
+		db:      db,
+		oracle:  oracle,
+	}
+}
+
+// MonthRange returns the start of the month and the start of the next month
+func MonthRange(month time.Time) (time.Time, time.Time) {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	return from, from.AddDate(0, 1, 0)
+}
+
+// Report builds the monthly accounting report of a paymaster
+func (s *Service) Report(ctx context.Context, paymaster string, month time.Time) (*relay.AccountingReport, error) {
+	from, to := MonthRange(month)
+
+	lines, err := s.db.SpendDB.GetSpendLines(paymaster, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// price at the end of the month, or now for the current month
+	at := to
+	if at.After(time.Now()) {
+		at = time.Now()
+	}
+
+	price, err := s.oracle.Price(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &relay.AccountingReport{
+		ChainID:   s.chainID,
+		Paymaster: paymaster,
+		Month:     from.Format(MonthFormat),
+		Currency:  s.oracle.Currency(),
+		Price:     price.Text('f', 6),
+		GasUsed:   big.NewInt(0),
+		FeeWei:    big.NewInt(0),
+		Lines:     lines,
+	}
+
+	for _, l := range lines {
+		l.FeeFiat = toFiat(l.FeeWei, price)
+
+		report.Ops += l.Ops
+		report.GasUsed.Add(report.GasUsed, l.GasUsed)
+		report.FeeWei.Add(report.FeeWei, l.FeeWei)
+	}
+
+	report.FeeFiat = toFiat(report.FeeWei, price)
+
+	return report, nil
+}
+
+// toFiat converts an amount of wei to fiat
+func toFiat(wei *big.Int, price *big.Float) string {
+	return oracle.ToFiat(wei, 18, price).Text('f', 6)
+}
+
+// WriteCSV writes a report as csv, one row per destination and sender
+func WriteCSV(w io.Writer, report *relay.AccountingReport) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"chain_id", "month", "paymaster", "destination", "sender", "ops", "gas_used", "fee_wei", "fee_fiat", "currency"})
+	if err != nil {
+		return err
+	}
+
+	for _, l := range report.Lines {
+		err = cw.Write([]string{
+			report.ChainID,
+			report.Month,
+			report.Paymaster,
+			l.Destination,
+			l.Sender,
+			strconv.FormatInt(l.Ops, 10),
+			l.GasUsed.String(),
+			l.FeeWei.String(),
+			l.FeeFiat,
+			report.Currency,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// ReportName returns the file name of a report
+func ReportName(report *relay.AccountingReport, ext string) string {
+	return fmt.Sprintf("%s_%s_%s.%s", report.ChainID, report.Paymaster, report.Month, ext)
+}
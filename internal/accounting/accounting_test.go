@@ -0,0 +1,59 @@
+package accounting
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+func TestMonthRange(t *testing.T) {
+	from, to := MonthRange(time.Date(2024, time.December, 15, 12, 0, 0, 0, time.UTC))
+
+	if !from.Equal(time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected start of month %s", from)
+	}
+
+	if !to.Equal(time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected end of month %s", to)
+	}
+}
+
+func TestToFiat(t *testing.T) {
+	// 0.5 token at 2.0 per token
+	wei, _ := new(big.Int).SetString("500000000000000000", 10)
+
+	if v := toFiat(wei, big.NewFloat(2)); v != "1.000000" {
+		t.Errorf("expected 1.000000, got %s", v)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	report := &relay.AccountingReport{
+		ChainID:   "100",
+		Paymaster: "0xpm",
+		Month:     "2024-12",
+		Currency:  "USD",
+		Lines: []*relay.AccountingLine{
+			{Destination: "0xdest", Sender: "0xsender", Ops: 2, GasUsed: big.NewInt(100), FeeWei: big.NewInt(1000), FeeFiat: "0.000000"},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+
+	if rows[1] != "100,2024-12,0xpm,0xdest,0xsender,2,100,1000,0.000000,USD" {
+		t.Errorf("unexpected row %s", rows[1])
+	}
+}
@@ -0,0 +1,165 @@
+package accounting
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/comunifi/relay/internal/faults"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+// how often the exporter checks if a month has ended
+const exportInterval = time.Hour
+
+type ExporterConfig struct {
+	AWSAccessKeyID  string
+	AWSSecretKey    string
+	AWSRegion       string
+	AWSEndpointURL  string
+	AWSS3BucketName string
+	Prefix          string
+}
+
+// Exporter uploads the reports of the previous month to S3 and notifies the webhook
+type Exporter struct {
+	ctx    context.Context
+	s      *Service
+	s3     *s3.Client
+	config *ExporterConfig
+	w      relay.WebhookMessager
+	faults *faults.Injector
+}
+
+func NewExporter(ctx context.Context, s *Service, cfg *ExporterConfig, w relay.WebhookMessager) (*Exporter, error) {
+	creds := credentials.NewStaticCredentialsProvider(cfg.AWSAccessKeyID, cfg.AWSSecretKey, "")
+
+	awsCfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(cfg.AWSRegion),
+		config.WithCredentialsProvider(creds),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.AWSEndpointURL != "" {
+			o.BaseEndpoint = aws.String(cfg.AWSEndpointURL)
+			o.UsePathStyle = true // Required for most S3-compatible services
+		}
+	})
+
+	return &Exporter{
+		ctx:    ctx,
+		s:      s,
+		s3:     client,
+		config: cfg,
+		w:      w,
+	}, nil
+}
+
+// SetFaults sets the injector that randomly fails uploads, for testing only
+func (e *Exporter) SetFaults(f *faults.Injector) {
+	e.faults = f
+}
+
+// Start exports the reports of the previous month whenever they are missing
+func (e *Exporter) Start() error {
+	log.Default().Println("starting accounting exporter")
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	for {
+		err := e.ExportMonth(time.Now().UTC().AddDate(0, -1, 0))
+		if err != nil {
+			log.Default().Println("error exporting accounting reports:", err)
+			e.w.NotifyError(e.ctx, err)
+		}
+
+		select {
+		case <-e.ctx.Done():
+			log.Default().Println("stopping accounting exporter")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExportMonth uploads the reports of all paymasters that spent gas during the month
+func (e *Exporter) ExportMonth(month time.Time) error {
+	from, to := MonthRange(month)
+
+	paymasters, err := e.s.db.SpendDB.GetPaymasters(from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, pm := range paymasters {
+		report, err := e.s.Report(e.ctx, pm, month)
+		if err != nil {
+			return err
+		}
+
+		key := fmt.Sprintf("%s/%s", e.config.Prefix, ReportName(report, "csv"))
+
+		exists, err := e.exists(key)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			continue
+		}
+
+		var buf bytes.Buffer
+		err = WriteCSV(&buf, report)
+		if err != nil {
+			return err
+		}
+
+		if err := e.faults.Fail(faults.S3Put); err != nil {
+			return fmt.Errorf("failed to upload accounting report: %w", err)
+		}
+
+		_, err = e.s3.PutObject(e.ctx, &s3.PutObjectInput{
+			Bucket:        aws.String(e.config.AWSS3BucketName),
+			Key:           aws.String(key),
+			Body:          bytes.NewReader(buf.Bytes()),
+			ContentLength: aws.Int64(int64(buf.Len())),
+			ContentType:   aws.String("text/csv"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to upload accounting report: %w", err)
+		}
+
+		e.w.Notify(e.ctx, fmt.Sprintf("accounting report %s uploaded: %d ops, %s wei (%s %s)", key, report.Ops, report.FeeWei.String(), report.FeeFiat, report.Currency))
+	}
+
+	return nil
+}
+
+func (e *Exporter) exists(key string) (bool, error) {
+	_, err := e.s3.HeadObject(e.ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(e.config.AWSS3BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var nf *types.NotFound
+		if errors.As(err, &nf) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
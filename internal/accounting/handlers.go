@@ -0,0 +1,57 @@
+package accounting
+
+import (
+	"net/http"
+	"time"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handlers struct {
+	s *Service
+}
+
+func NewHandlers(s *Service) *Handlers {
+	return &Handlers{
+		s: s,
+	}
+}
+
+// Get returns the accounting report of a paymaster for a month as json or csv (?format=csv)
+func (h *Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	paymaster := chi.URLParam(r, "pm_address")
+	if !common.IsHexAddress(paymaster) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	month, err := time.Parse(MonthFormat, chi.URLParam(r, "month"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.s.Report(r.Context(), com.ChecksumAddress(paymaster), month)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Add("Content-Type", "text/csv")
+		w.Header().Add("Content-Disposition", "attachment; filename=\""+ReportName(report, "csv")+"\"")
+
+		err = WriteCSV(w, report)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = com.Body(w, report, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
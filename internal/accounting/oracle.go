@@ -0,0 +1,13 @@
+package accounting
+
+import (
+	"context"
+	"math/big"
+	"time"
+)
+
+// PriceOracle returns the fiat price of the native token of the chain
+type PriceOracle interface {
+	Currency() string
+	Price(ctx context.Context, at time.Time) (*big.Float, error)
+}
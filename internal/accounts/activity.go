@@ -0,0 +1,122 @@
+package accounts
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/comunifi/relay/internal/logs"
+	"github.com/comunifi/relay/internal/nostr"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+)
+
+// Activity godoc
+//
+//	@Summary		Fetch the activity of an account
+//	@Description	get the transfers, user ops, group joins and profile updates of an account in a single feed, newest first
+//	@Tags			accounts
+//	@Produce		json
+//	@Param			acc_addr	path		string	true	"Account Address"
+//	@Param			types		query		string	false	"Comma separated types to include: transfer, userop, group_join, profile"
+//	@Param			cursor		query		string	false	"Cursor of the page, from the next field of the previous page"
+//	@Param			limit		query		int		false	"Page size, at most 100"
+//	@Param			total		query		string	false	"How the total is counted: exact (default) or estimate"
+//	@Success		200	{object}	common.Response
+//	@Failure		400
+//	@Failure		500
+//	@Router			/v1/accounts/{acc_addr}/activity [get]
+func (s *Service) Activity(w http.ResponseWriter, r *http.Request) {
+	q, err := parseActivityQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// group joins and profile updates are published by the nostr keys linked to the account
+	q.Pubkeys, err = s.db.AccountLinkDB.GetPubkeys(q.Account)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	feed, next, err := s.n.GetActivityPage(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	total, err := s.n.CountActivity(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	meta := com.CursorPagination{Limit: q.Limit, Total: total}
+	if next != nil {
+		meta.Next = next.String()
+		meta.HasMore = true
+	}
+
+	err = com.BodyMultiple(w, feed, meta)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// parseActivityQuery reads an activity query from a request, pages are sized like the ones of the logs
+func parseActivityQuery(r *http.Request) (*nostr.ActivityQuery, error) {
+	addr := chi.URLParam(r, "acc_addr")
+	if !common.IsHexAddress(addr) {
+		return nil, errors.New("invalid account address")
+	}
+
+	params := r.URL.Query()
+
+	q := &nostr.ActivityQuery{
+		Account: com.ChecksumAddress(addr),
+		Limit:   logs.DefaultLimit,
+	}
+
+	count, err := nostr.ParseCountMode(params.Get("total"))
+	if err != nil {
+		return nil, err
+	}
+	q.Count = count
+
+	if v := params.Get("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !slices.Contains(relay.ActivityTypes, t) {
+				return nil, fmt.Errorf("unknown type %q, expected one of %s", t, strings.Join(relay.ActivityTypes, ", "))
+			}
+
+			q.Types = append(q.Types, t)
+		}
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return nil, errors.New("invalid limit")
+		}
+
+		q.Limit = min(limit, logs.MaxLimit)
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		c, err := nostr.ParseLogCursor(v)
+		if err != nil {
+			return nil, err
+		}
+
+		q.After = c
+	}
+
+	return q, nil
+}
@@ -0,0 +1,359 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const accountFactoryABI = `[{"inputs":[{"internalType":"address","name":"owner","type":"address"},{"internalType":"uint256","name":"salt","type":"uint256"}],"name":"createAccount","outputs":[{"internalType":"contract Account","name":"ret","type":"address"}],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"address","name":"owner","type":"address"},{"internalType":"uint256","name":"salt","type":"uint256"}],"name":"getAddress","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"}]`
+
+const accountABI = `[{"inputs":[{"internalType":"address","name":"dest","type":"address"},{"internalType":"uint256","name":"value","type":"uint256"},{"internalType":"bytes","name":"func","type":"bytes"}],"name":"execute","outputs":[],"stateMutability":"nonpayable","type":"function"}]`
+
+var (
+	factoryABI abi.ABI
+	accABI     abi.ABI
+
+	userOpArgs     abi.Arguments
+	userOpHashArgs abi.Arguments
+)
+
+// gas limits of a deployment user op, the call itself does nothing
+var (
+	deployCallGasLimit         = big.NewInt(50_000)
+	deployVerificationGasLimit = big.NewInt(1_000_000)
+	deployPreVerificationGas   = big.NewInt(100_000)
+)
+
+// seconds the paymaster signature of a deployment is valid, the owner still needs to sign and send it
+const deploySponsorValidity = int64(60 * 10)
+
+func init() {
+	factoryABI, _ = abi.JSON(strings.NewReader(accountFactoryABI))
+	accABI, _ = abi.JSON(strings.NewReader(accountABI))
+
+	addressTy, _ := abi.NewType("address", "address", nil)
+	uint256Ty, _ := abi.NewType("uint256", "uint256", nil)
+	bytes32Ty, _ := abi.NewType("bytes32", "bytes32", nil)
+
+	userOpArgs = abi.Arguments{
+		{Type: addressTy}, // sender
+		{Type: uint256Ty}, // nonce
+		{Type: bytes32Ty}, // keccak256(initCode)
+		{Type: bytes32Ty}, // keccak256(callData)
+		{Type: uint256Ty}, // callGasLimit
+		{Type: uint256Ty}, // verificationGasLimit
+		{Type: uint256Ty}, // preVerificationGas
+		{Type: uint256Ty}, // maxFeePerGas
+		{Type: uint256Ty}, // maxPriorityFeePerGas
+		{Type: bytes32Ty}, // keccak256(paymasterAndData)
+	}
+
+	userOpHashArgs = abi.Arguments{
+		{Type: bytes32Ty}, // keccak256(userOp)
+		{Type: addressTy}, // entrypoint
+		{Type: uint256Ty}, // chain id
+	}
+}
+
+type factoryRequest struct {
+	Contract   string `json:"contract"`
+	Paymaster  string `json:"paymaster"`
+	EntryPoint string `json:"entrypoint"`
+}
+
+// RegisterFactory registers an account factory whose deployments are sponsored by a paymaster
+func (s *Service) RegisterFactory(w http.ResponseWriter, r *http.Request) {
+	var req factoryRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !common.IsHexAddress(req.Contract) || !common.IsHexAddress(req.Paymaster) || !common.IsHexAddress(req.EntryPoint) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f := &relay.AccountFactory{
+		Contract:   com.ChecksumAddress(req.Contract),
+		Paymaster:  com.ChecksumAddress(req.Paymaster),
+		EntryPoint: com.ChecksumAddress(req.EntryPoint),
+	}
+
+	bytecode, err := s.evm.CodeAt(context.Background(), common.HexToAddress(f.Contract), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	if len(bytecode) == 0 {
+		http.Error(w, "factory contract does not exist", http.StatusUnprocessableEntity)
+		return
+	}
+
+	// deployments can only be sponsored by a paymaster the relay operates
+	_, err = s.db.SponsorDB.GetSponsor(f.Paymaster)
+	if err != nil {
+		http.Error(w, "paymaster has no sponsor", http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = s.db.FactoryDB.SetFactory(f)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	f, err = s.db.FactoryDB.GetFactory(f.Contract)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, f, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetFactories returns the account factories accounts can be deployed from
+func (s *Service) GetFactories(w http.ResponseWriter, r *http.Request) {
+	factories, err := s.db.FactoryDB.GetFactories()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.BodyMultiple(w, factories, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// RemoveFactory removes an account factory from the registry, accounts can no longer be deployed from it
+func (s *Service) RemoveFactory(w http.ResponseWriter, r *http.Request) {
+	factory := chi.URLParam(r, "factory")
+	if !common.IsHexAddress(factory) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err := s.db.FactoryDB.RemoveFactory(com.ChecksumAddress(factory))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, nil, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+type deployRequest struct {
+	Owner   string `json:"owner"`
+	Factory string `json:"factory"`
+	Salt    int64  `json:"salt"`
+}
+
+// Deploy returns the counterfactual address of an account and its deployment status, when the account
+// does not exist yet a sponsored deployment user op is built for the owner to sign and send
+func (s *Service) Deploy(w http.ResponseWriter, r *http.Request) {
+	var req deployRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !common.IsHexAddress(req.Owner) || !common.IsHexAddress(req.Factory) || req.Salt < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f, err := s.db.FactoryDB.GetFactory(com.ChecksumAddress(req.Factory))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			http.Error(w, "factory is not registered", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	d, err := s.Prepare(f, common.HexToAddress(req.Owner), big.NewInt(req.Salt))
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	err = com.Body(w, d, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Prepare returns the counterfactual address of the account of an owner and its deployment status,
+// with a sponsored deployment user op for the owner to sign and send when it does not exist yet
+func (s *Service) Prepare(f *relay.AccountFactory, owner common.Address, salt *big.Int) (*relay.AccountDeployment, error) {
+	sender, err := s.counterfactualAddress(common.HexToAddress(f.Contract), owner, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &relay.AccountDeployment{
+		Address: sender.Hex(),
+		Owner:   owner.Hex(),
+		Factory: f.Contract,
+	}
+
+	d.Status, err = s.deploymentStatus(sender)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Status == relay.AccountStatusUndeployed {
+		op, err := s.deploymentUserOp(f, sender, owner, salt)
+		if err != nil {
+			return nil, err
+		}
+
+		d.UserOp = op
+		d.UserOpHash = userOpHash(op, common.HexToAddress(f.EntryPoint), s.chainID).Hex()
+		d.EntryPoint = f.EntryPoint
+		d.Paymaster = f.Paymaster
+	}
+
+	return d, nil
+}
+
+// counterfactualAddress asks the factory for the address of the account of an owner
+func (s *Service) counterfactualAddress(factory, owner common.Address, salt *big.Int) (common.Address, error) {
+	data, err := factoryABI.Pack("getAddress", owner, salt)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	out, err := s.evm.CallContract(ethereum.CallMsg{To: &factory, Data: data}, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	values, err := factoryABI.Unpack("getAddress", out)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	addr, ok := values[0].(common.Address)
+	if !ok {
+		return common.Address{}, errors.New("invalid factory response")
+	}
+
+	return addr, nil
+}
+
+// deploymentStatus returns whether the account exists or a deployment is in progress
+func (s *Service) deploymentStatus(sender common.Address) (string, error) {
+	bytecode, err := s.evm.CodeAt(context.Background(), sender, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if len(bytecode) > 0 {
+		return relay.AccountStatusDeployed, nil
+	}
+
+	if s.n == nil {
+		return relay.AccountStatusUndeployed, nil
+	}
+
+	states, err := s.n.GetLatestUserOps(sender.Hex(), 1, 0)
+	if err != nil {
+		return "", err
+	}
+
+	for _, st := range states {
+		switch st.Status {
+		case string(nostreth.EventTypeUserOpSubmitted), string(nostreth.EventTypeUserOpExecuted):
+			return relay.AccountStatusPending, nil
+		}
+	}
+
+	return relay.AccountStatusUndeployed, nil
+}
+
+// deploymentUserOp builds a sponsored user op that deploys the account with a call that does nothing
+func (s *Service) deploymentUserOp(f *relay.AccountFactory, sender, owner common.Address, salt *big.Int) (*relay.UserOp, error) {
+	create, err := factoryABI.Pack("createAccount", owner, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	initCode := append(common.HexToAddress(f.Contract).Bytes(), create...)
+
+	callData, err := accABI.Pack("execute", sender, big.NewInt(0), []byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	gasPrice, err := s.evm.EstimateGasPrice()
+	if err != nil {
+		return nil, err
+	}
+
+	op := relay.UserOp{
+		Sender:               sender,
+		Nonce:                big.NewInt(0),
+		InitCode:             initCode,
+		CallData:             callData,
+		CallGasLimit:         deployCallGasLimit,
+		VerificationGasLimit: deployVerificationGasLimit,
+		PreVerificationGas:   deployPreVerificationGas,
+		MaxFeePerGas:         gasPrice,
+		MaxPriorityFeePerGas: gasPrice,
+		Signature:            []byte{},
+	}
+
+	op.PaymasterAndData, err = s.pm.SponsorUserOp(common.HexToAddress(f.Paymaster), op, deploySponsorValidity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &op, nil
+}
+
+// userOpHash is the hash the entrypoint expects the owner to sign
+func userOpHash(op *relay.UserOp, entryPoint common.Address, chainID *big.Int) common.Hash {
+	packed, _ := userOpArgs.Pack(
+		op.Sender,
+		op.Nonce,
+		crypto.Keccak256Hash(op.InitCode),
+		crypto.Keccak256Hash(op.CallData),
+		op.CallGasLimit,
+		op.VerificationGasLimit,
+		op.PreVerificationGas,
+		op.MaxFeePerGas,
+		op.MaxPriorityFeePerGas,
+		crypto.Keccak256Hash(op.PaymasterAndData),
+	)
+
+	encoded, _ := userOpHashArgs.Pack(crypto.Keccak256Hash(packed), entryPoint, chainID)
+
+	return crypto.Keccak256Hash(encoded)
+}
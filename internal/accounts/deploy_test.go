@@ -0,0 +1,85 @@
+package accounts
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type testEVM struct {
+	relay.EVMRequester
+
+	account common.Address
+	calls   []ethereum.CallMsg
+}
+
+func (e *testEVM) CallContract(call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	e.calls = append(e.calls, call)
+	return common.LeftPadBytes(e.account.Bytes(), 32), nil
+}
+
+func TestCounterfactualAddress(t *testing.T) {
+	factory := common.HexToAddress("0x7cC54D54bBFc65d1f0af7ACee5e4042654AF8185")
+	owner := common.HexToAddress("0x5FbDB2315678afecb367f032d93F642f64180aa3")
+
+	evm := &testEVM{account: common.HexToAddress("0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512")}
+	s := NewService(evm, nil, nil, nil, big.NewInt(100))
+
+	addr, err := s.counterfactualAddress(factory, owner, big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if addr != evm.account {
+		t.Fatalf("expected %s, got %s", evm.account, addr)
+	}
+
+	if len(evm.calls) != 1 || *evm.calls[0].To != factory {
+		t.Fatalf("expected a call to the factory, got %+v", evm.calls)
+	}
+
+	if !bytes.Equal(evm.calls[0].Data[:4], factoryABI.Methods["getAddress"].ID) {
+		t.Fatal("expected getAddress to be called")
+	}
+}
+
+func TestUserOpHash(t *testing.T) {
+	op := &relay.UserOp{
+		Sender:               common.HexToAddress("0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512"),
+		Nonce:                big.NewInt(0),
+		InitCode:             []byte{0x01},
+		CallData:             []byte{0x02},
+		CallGasLimit:         deployCallGasLimit,
+		VerificationGasLimit: deployVerificationGasLimit,
+		PreVerificationGas:   deployPreVerificationGas,
+		MaxFeePerGas:         big.NewInt(1),
+		MaxPriorityFeePerGas: big.NewInt(1),
+		PaymasterAndData:     []byte{0x03},
+	}
+
+	ep := common.HexToAddress("0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789")
+
+	h := userOpHash(op, ep, big.NewInt(100))
+	if h != userOpHash(op, ep, big.NewInt(100)) {
+		t.Fatal("expected the hash to be deterministic")
+	}
+
+	// the signature is not part of the hash
+	op.Signature = []byte{0x04}
+	if h != userOpHash(op, ep, big.NewInt(100)) {
+		t.Fatal("expected the signature not to change the hash")
+	}
+
+	if h == userOpHash(op, ep, big.NewInt(1)) {
+		t.Fatal("expected the chain id to change the hash")
+	}
+
+	op.PaymasterAndData = []byte{0x05}
+	if h == userOpHash(op, ep, big.NewInt(100)) {
+		t.Fatal("expected the paymaster data to change the hash")
+	}
+}
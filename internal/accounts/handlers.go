@@ -2,9 +2,12 @@ package accounts
 
 import (
 	"context"
+	"math/big"
 	"net/http"
 
 	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/nostr"
+	"github.com/comunifi/relay/internal/paymaster"
 	com "github.com/comunifi/relay/pkg/common"
 	"github.com/comunifi/relay/pkg/relay"
 
@@ -16,12 +19,19 @@ type Service struct {
 	evm relay.EVMRequester
 
 	db *db.DB
+	n  *nostr.Nostr
+	pm *paymaster.Service
+
+	chainID *big.Int
 }
 
-func NewService(evm relay.EVMRequester, db *db.DB) *Service {
+func NewService(evm relay.EVMRequester, db *db.DB, n *nostr.Nostr, pm *paymaster.Service, chainID *big.Int) *Service {
 	return &Service{
-		evm: evm,
-		db:  db,
+		evm:     evm,
+		db:      db,
+		n:       n,
+		pm:      pm,
+		chainID: chainID,
 	}
 }
 
@@ -0,0 +1,327 @@
+// Package adminauth signs operators in to the admin endpoints with their own keys, so that
+// operator tooling doesn't need the api key.
+//
+// A login starts with a challenge, GET /v1/admin/login/challenge, whose nonce is answered once
+// within challengeTTL by either:
+//
+//   - a sign-in with Ethereum message (EIP-4361) for the relay's domain and chain, signed with
+//     personal_sign by an account in ADMIN_ADDRESSES: POST /v1/admin/login/ethereum
+//   - a NIP-98 event for the login url with a ["nonce", "<nonce>"] tag, signed by a pubkey in
+//     ADMIN_PUBKEYS: POST /v1/admin/login/nostr
+//
+// Both return a short lived session, a JWT signed with ADMIN_SESSION_KEY, which the admin
+// endpoints accept as a bearer token and the dashboard as a cookie.
+package adminauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// how long a challenge can be answered
+	challengeTTL = 5 * time.Minute
+
+	// most challenges waiting for an answer, a login has to start again when they are exceeded
+	maxChallenges = 1000
+
+	// CookieName is the cookie the dashboard keeps its session in
+	CookieName = "relay_admin_session"
+
+	// audience of the sessions, tokens minted for anything else are refused
+	audience = "relay-admin"
+)
+
+var (
+	ErrUnknownChallenge  = errors.New("unknown or expired challenge")
+	ErrTooManyChallenges = errors.New("too many pending challenges")
+	ErrInvalidMessage    = errors.New("invalid sign-in message")
+	ErrInvalidSignature  = errors.New("invalid signature")
+	ErrNotAdmin          = errors.New("not an admin")
+	ErrInvalidSession    = errors.New("invalid session")
+)
+
+type Config struct {
+	Addresses []string      // ethereum accounts that can sign in
+	Pubkeys   []string      // nostr pubkeys that can sign in
+	Key       []byte        // signs the sessions
+	TTL       time.Duration // how long a session lasts
+	Domain    string        // host the sign-in messages are for
+	ChainID   *big.Int
+}
+
+type Service struct {
+	addresses map[common.Address]bool
+	pubkeys   map[string]bool
+	key       []byte
+	ttl       time.Duration
+	domain    string
+	chainID   string
+
+	mu         sync.Mutex
+	challenges map[string]time.Time // nonce to expiry
+
+	now func() time.Time
+}
+
+func NewService(cfg *Config) *Service {
+	s := &Service{
+		addresses:  map[common.Address]bool{},
+		pubkeys:    map[string]bool{},
+		key:        cfg.Key,
+		ttl:        cfg.TTL,
+		domain:     cfg.Domain,
+		chainID:    cfg.ChainID.String(),
+		challenges: map[string]time.Time{},
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+
+	for _, a := range cfg.Addresses {
+		s.addresses[common.HexToAddress(a)] = true
+	}
+
+	for _, pk := range cfg.Pubkeys {
+		s.pubkeys[strings.ToLower(pk)] = true
+	}
+
+	return s
+}
+
+// NewChallenge returns a nonce that can be used for a single login
+func (s *Service) NewChallenge() (*relay.AdminChallenge, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	nonce := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for n, exp := range s.challenges {
+		if !now.Before(exp) {
+			delete(s.challenges, n)
+		}
+	}
+
+	if len(s.challenges) >= maxChallenges {
+		return nil, ErrTooManyChallenges
+	}
+
+	expiresAt := now.Add(challengeTTL)
+	s.challenges[nonce] = expiresAt
+
+	return &relay.AdminChallenge{
+		Nonce:     nonce,
+		Domain:    s.domain,
+		ChainID:   s.chainID,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// consume answers a challenge, a nonce can't be used twice
+func (s *Service) consume(nonce string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.challenges[nonce]
+	if !ok {
+		return ErrUnknownChallenge
+	}
+	delete(s.challenges, nonce)
+
+	if !s.now().Before(exp) {
+		return ErrUnknownChallenge
+	}
+
+	return nil
+}
+
+// loginEthereum opens a session for the account that signed a sign-in with Ethereum message
+func (s *Service) loginEthereum(message, signature string) (*relay.AdminSession, error) {
+	msg, err := parseMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.domain != s.domain || msg.chainID != s.chainID {
+		return nil, ErrInvalidMessage
+	}
+
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	signer, err := com.RecoverPersonalSign(accounts.TextHash([]byte(message)), sig)
+	if err != nil || signer != msg.address {
+		return nil, ErrInvalidSignature
+	}
+
+	if !s.addresses[msg.address] {
+		return nil, ErrNotAdmin
+	}
+
+	err = s.consume(msg.nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.newSession(msg.address.Hex())
+}
+
+// loginNostr opens a session for the pubkey that signed a NIP-98 login event, the event has to
+// be checked against the request it came with first
+func (s *Service) loginNostr(ev *nostr.Event) (*relay.AdminSession, error) {
+	ok, err := ev.CheckSignature()
+	if err != nil || !ok {
+		return nil, ErrInvalidSignature
+	}
+
+	if !s.pubkeys[ev.PubKey] {
+		return nil, ErrNotAdmin
+	}
+
+	nonce := ev.Tags.Find("nonce")
+	if nonce == nil {
+		return nil, ErrUnknownChallenge
+	}
+
+	err = s.consume(nonce[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return s.newSession(ev.PubKey)
+}
+
+type claims struct {
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// jwtHeader is the only header sessions are signed with
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// newSession signs a session for an admin
+func (s *Service) newSession(subject string) (*relay.AdminSession, error) {
+	now := s.now()
+	expiresAt := now.Add(s.ttl)
+
+	payload, err := json.Marshal(&claims{
+		Subject:   subject,
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return &relay.AdminSession{
+		Token:     signed + "." + s.sign(signed),
+		Subject:   subject,
+		ExpiresAt: time.Unix(expiresAt.Unix(), 0).UTC(),
+	}, nil
+}
+
+// Authenticate returns the admin of a session token
+func (s *Service) Authenticate(token string) (string, error) {
+	header, rest, ok := strings.Cut(token, ".")
+	if !ok || header != jwtHeader {
+		return "", ErrInvalidSession
+	}
+
+	payload, sig, ok := strings.Cut(rest, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(header+"."+payload))) {
+		return "", ErrInvalidSession
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidSession
+	}
+
+	var c claims
+	err = json.Unmarshal(b, &c)
+	if err != nil || c.Audience != audience || s.now().Unix() >= c.ExpiresAt {
+		return "", ErrInvalidSession
+	}
+
+	// admins removed from the config lose their sessions
+	if !s.pubkeys[c.Subject] && !(common.IsHexAddress(c.Subject) && s.addresses[common.HexToAddress(c.Subject)]) {
+		return "", ErrInvalidSession
+	}
+
+	return c.Subject, nil
+}
+
+func (s *Service) sign(signed string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// message is what a login needs from a sign-in with Ethereum message
+type message struct {
+	domain  string
+	address common.Address
+	chainID string
+	nonce   string
+}
+
+// parseMessage reads the fields of an EIP-4361 message that a login checks
+func parseMessage(m string) (*message, error) {
+	lines := strings.Split(m, "\n")
+	if len(lines) < 2 {
+		return nil, ErrInvalidMessage
+	}
+
+	domain, ok := strings.CutSuffix(lines[0], " wants you to sign in with your Ethereum account:")
+	if !ok || !common.IsHexAddress(lines[1]) {
+		return nil, ErrInvalidMessage
+	}
+
+	msg := &message{
+		domain:  domain,
+		address: common.HexToAddress(lines[1]),
+	}
+
+	for _, l := range lines[2:] {
+		if v, ok := strings.CutPrefix(l, "Chain ID: "); ok {
+			msg.chainID = v
+		}
+
+		if v, ok := strings.CutPrefix(l, "Nonce: "); ok {
+			msg.nonce = v
+		}
+	}
+
+	if msg.chainID == "" || msg.nonce == "" {
+		return nil, ErrInvalidMessage
+	}
+
+	return msg, nil
+}
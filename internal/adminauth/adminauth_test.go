@@ -0,0 +1,176 @@
+package adminauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func siweMessage(domain, address, chainID, nonce string) string {
+	return fmt.Sprintf(`%s wants you to sign in with your Ethereum account:
+%s
+
+Log in to the relay admin
+
+URI: https://%s
+Version: 1
+Chain ID: %s
+Nonce: %s
+Issued At: 2025-01-01T00:00:00Z`, domain, address, domain, chainID, nonce)
+}
+
+func TestLoginEthereum(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	admin := crypto.PubkeyToAddress(key.PublicKey)
+
+	s := NewService(&Config{
+		Addresses: []string{admin.Hex()},
+		Key:       []byte("secret"),
+		TTL:       time.Minute,
+		Domain:    "relay.example.com",
+		ChainID:   big.NewInt(100),
+	})
+
+	sign := func(msg string) string {
+		sig, err := crypto.Sign(accounts.TextHash([]byte(msg)), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig[crypto.RecoveryIDOffset] += 27
+		return hexutil.Encode(sig)
+	}
+
+	c, err := s.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// messages for another relay or chain are refused before the nonce is used
+	for _, msg := range []string{
+		siweMessage("evil.example.com", admin.Hex(), "100", c.Nonce),
+		siweMessage("relay.example.com", admin.Hex(), "1", c.Nonce),
+	} {
+		_, err := s.loginEthereum(msg, sign(msg))
+		if !errors.Is(err, ErrInvalidMessage) {
+			t.Fatalf("expected an invalid message, got %v", err)
+		}
+	}
+
+	msg := siweMessage("relay.example.com", admin.Hex(), "100", c.Nonce)
+
+	// the signature has to be from the account of the message
+	other, _ := crypto.GenerateKey()
+	_, err = s.loginEthereum(siweMessage("relay.example.com", crypto.PubkeyToAddress(other.PublicKey).Hex(), "100", c.Nonce), sign(msg))
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected an invalid signature, got %v", err)
+	}
+
+	session, err := s.loginEthereum(msg, sign(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := s.Authenticate(session.Token)
+	if err != nil || subject != admin.Hex() {
+		t.Fatalf("expected a session of %s, got %s %v", admin.Hex(), subject, err)
+	}
+
+	// a nonce can't be used twice
+	_, err = s.loginEthereum(msg, sign(msg))
+	if !errors.Is(err, ErrUnknownChallenge) {
+		t.Fatalf("expected the challenge to be used, got %v", err)
+	}
+
+	// sessions expire
+	s.now = func() time.Time { return time.Now().UTC().Add(2 * time.Minute) }
+	_, err = s.Authenticate(session.Token)
+	if !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("expected the session to expire, got %v", err)
+	}
+}
+
+func TestLoginNostr(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+
+	s := NewService(&Config{
+		Pubkeys: []string{pk},
+		Key:     []byte("secret"),
+		TTL:     time.Minute,
+		Domain:  "relay.example.com",
+		ChainID: big.NewInt(100),
+	})
+
+	login := func(sk, nonce string) *httptest.ResponseRecorder {
+		ev := nostr.Event{
+			Kind:      nostr.KindHTTPAuth,
+			CreatedAt: nostr.Now(),
+			Tags: nostr.Tags{
+				{"u", "https://relay.example.com/v1/admin/login/nostr"},
+				{"method", http.MethodPost},
+				{"nonce", nonce},
+			},
+		}
+		err := ev.Sign(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := json.Marshal(ev)
+		r := httptest.NewRequest(http.MethodPost, "https://relay.example.com/v1/admin/login/nostr", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		s.LoginNostr(rec, r)
+
+		return rec
+	}
+
+	c, err := s.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := login(nostr.GeneratePrivateKey(), c.Nonce)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected %d for another pubkey, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	rec = login(sk, "unknown")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d without a challenge, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	rec = login(sk, c.Nonce)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	// the dashboard gets the session as a cookie
+	r := httptest.NewRequest(http.MethodGet, "/v1/admin/dashboard", nil)
+	for _, c := range rec.Result().Cookies() {
+		r.AddCookie(c)
+	}
+
+	subject, err := s.AuthenticateRequest(r)
+	if err != nil || subject != pk {
+		t.Fatalf("expected a session of %s, got %s %v", pk, subject, err)
+	}
+
+	// a tampered session is refused
+	r = httptest.NewRequest(http.MethodGet, "/v1/admin/status", nil)
+	r.Header.Set("Authorization", "Bearer "+rec.Result().Cookies()[0].Value+"x")
+	_, err = s.AuthenticateRequest(r)
+	if !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("expected an invalid session, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package adminauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// how far a NIP-98 login event can be from now
+const requestMaxAge = time.Minute
+
+// Challenge returns a nonce to sign for a login
+func (s *Service) Challenge(w http.ResponseWriter, r *http.Request) {
+	c, err := s.NewChallenge()
+	if err != nil {
+		if errors.Is(err, ErrTooManyChallenges) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, c, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// LoginEthereum opens a session with a sign-in with Ethereum message and its signature
+func (s *Service) LoginEthereum(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message   string `json:"message"`
+		Signature string `json:"signature"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	session, err := s.loginEthereum(req.Message, req.Signature)
+	s.respond(w, session, err)
+}
+
+// LoginNostr opens a session with a NIP-98 event signed for this request
+func (s *Service) LoginNostr(w http.ResponseWriter, r *http.Request) {
+	var ev nostr.Event
+	err := json.NewDecoder(r.Body).Decode(&ev)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// a login event signed for another relay or endpoint can't be replayed here
+	err = com.CheckRequestEvent(r, &ev)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	age := s.now().Sub(ev.CreatedAt.Time())
+	if age > requestMaxAge || age < -requestMaxAge {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	session, err := s.loginNostr(&ev)
+	s.respond(w, session, err)
+}
+
+// respond returns the session of a login and keeps it in a cookie for the dashboard
+func (s *Service) respond(w http.ResponseWriter, session *relay.AdminSession, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotAdmin):
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, ErrInvalidMessage):
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrUnknownChallenge):
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    session.Token,
+		Path:     "/v1/admin",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	err = com.Body(w, session, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// AuthenticateRequest returns the admin of the session of a request, given as a bearer token or
+// in the dashboard cookie
+func (s *Service) AuthenticateRequest(r *http.Request) (string, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return s.Authenticate(token)
+	}
+
+	c, err := r.Cookie(CookieName)
+	if err != nil {
+		return "", ErrInvalidSession
+	}
+
+	return s.Authenticate(c.Value)
+}
@@ -0,0 +1,280 @@
+// Package antivirus scans risky uploads for malware before they are served.
+//
+// Every upload gets a risk level from its mime type: media is low risk, text a bit higher,
+// documents and svg images can carry scripts, and a type the relay doesn't recognize is the riskiest.
+// Uploads at or above the configured threshold are stored in a quarantine prefix of the bucket and
+// queued for a scan with ClamAV or an external scanning service. Downloads of a blob are refused
+// until its scan is clean.
+//
+// A clean blob is moved out of quarantine and served like any other upload. An infected blob is
+// deleted with its index entries, the uploader is notified with a NIP-56 report (kind 1984) signed
+// by the relay and the operators are alerted with the signature that was found.
+//
+// Scans are recorded before they run, the ones that didn't finish are queued again when the relay
+// restarts.
+package antivirus
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// KindReport is the NIP-56 kind the uploader of an infected blob is notified with
+const KindReport = 1984
+
+// Risk levels of uploads, by mime type
+const (
+	RiskLow     = iota // images, audio and video
+	RiskMedium         // plain text and json
+	RiskHigh           // documents and svg images, which can carry scripts
+	RiskUnknown        // anything the relay doesn't recognize
+)
+
+// Result is the verdict of a scanner, the signature names what was found
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner scans the content of a blob
+type Scanner interface {
+	Scan(ctx context.Context, body []byte) (*Result, error)
+}
+
+// Blobs reads, releases and discards quarantined blobs
+type Blobs interface {
+	ReadQuarantined(ctx context.Context, sha256, groupID string) ([]byte, error)
+	Release(ctx context.Context, sha256, pubkey, groupID, mime string) error
+	Discard(ctx context.Context, sha256, groupID string) error
+}
+
+// Store signs the notifications of the relay
+type Store interface {
+	SignAndSaveEvent(ctx context.Context, ev *nostr.Event) (*nostr.Event, error)
+}
+
+type Config struct {
+	// uploads with a risk at or above the threshold are scanned, RiskLow scans every upload
+	Threshold int
+
+	Workers int
+	Timeout time.Duration // of a single scan
+	Queue   int
+}
+
+type job struct {
+	sha256  string
+	pubkey  string
+	groupID string
+	mime    string
+}
+
+// Service queues the quarantined blobs and scans them
+type Service struct {
+	ctx   context.Context
+	db    *db.DB
+	sc    Scanner
+	blobs Blobs
+	n     Store
+	w     relay.WebhookMessager
+	cfg   *Config
+
+	jobs chan job
+
+	now func() time.Time
+}
+
+// NewService scans quarantined blobs with sc, blobs is set once media is enabled
+func NewService(ctx context.Context, d *db.DB, sc Scanner, n Store, w relay.WebhookMessager, cfg *Config) *Service {
+	return &Service{
+		ctx:  ctx,
+		db:   d,
+		sc:   sc,
+		n:    n,
+		w:    w,
+		cfg:  cfg,
+		jobs: make(chan job, cfg.Queue),
+		now:  func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// SetBlobs sets the blob storage, it must be set before the service is started
+func (s *Service) SetBlobs(b Blobs) {
+	s.blobs = b
+}
+
+// Risk returns the risk level of an upload of this mime type
+func Risk(mime string) int {
+	switch {
+	case mime == "image/svg+xml":
+		return RiskHigh
+	case strings.HasPrefix(mime, "image/"), strings.HasPrefix(mime, "audio/"), strings.HasPrefix(mime, "video/"):
+		return RiskLow
+	case mime == "text/plain", mime == "application/json":
+		return RiskMedium
+	case mime == "application/pdf":
+		return RiskHigh
+	}
+
+	return RiskUnknown
+}
+
+// ShouldScan tells whether an upload of this mime type is quarantined until it is scanned
+func (s *Service) ShouldScan(mime string) bool {
+	return Risk(mime) >= s.cfg.Threshold
+}
+
+// Enqueue records a quarantined blob to scan and queues it. A full queue doesn't block the upload,
+// the scan runs when the relay restarts.
+func (s *Service) Enqueue(ctx context.Context, sha256, pubkey, groupID, mime string) error {
+	added, err := s.db.ScanDB.AddScan(&relay.Scan{
+		SHA256:    sha256,
+		Pubkey:    pubkey,
+		GroupID:   groupID,
+		Mime:      mime,
+		Status:    relay.ScanStatusPending,
+		CreatedAt: s.now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if !added {
+		return nil
+	}
+
+	select {
+	case s.jobs <- job{sha256: sha256, pubkey: pubkey, groupID: groupID, mime: mime}:
+	default:
+		log.Printf("scan queue is full, %s is left for the next restart", sha256)
+	}
+
+	return nil
+}
+
+// Blocked tells whether a blob can't be downloaded, either because it wasn't scanned yet or
+// because it was found infected
+func (s *Service) Blocked(ctx context.Context, sha256 string) (bool, error) {
+	scan, err := s.db.ScanDB.GetScan(sha256)
+	if err != nil {
+		return false, err
+	}
+
+	return scan != nil && scan.Status != relay.ScanStatusClean, nil
+}
+
+// Start queues the scans that didn't finish and runs the workers until the context is done
+func (s *Service) Start() error {
+	log.Default().Println("starting antivirus scans")
+
+	pending, err := s.db.ScanDB.GetPendingScans()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < max(s.cfg.Workers, 1); i++ {
+		go s.work()
+	}
+
+	for _, sc := range pending {
+		select {
+		case s.jobs <- job{sha256: sc.SHA256, pubkey: sc.Pubkey, groupID: sc.GroupID, mime: sc.Mime}:
+		case <-s.ctx.Done():
+			return nil
+		}
+	}
+
+	<-s.ctx.Done()
+	log.Default().Println("stopping antivirus scans")
+
+	return nil
+}
+
+func (s *Service) work() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case j := <-s.jobs:
+			// a failed scan stays pending and quarantined, it is tried again after a restart
+			err := s.run(j)
+			if err != nil {
+				log.Printf("failed to scan %s: %v", j.sha256, err)
+				s.w.NotifyError(s.ctx, fmt.Errorf("antivirus scan of blob %s: %w", j.sha256, err))
+			}
+		}
+	}
+}
+
+// run scans a quarantined blob, releases it when it is clean and discards it when it is infected
+func (s *Service) run(j job) error {
+	ctx, cancel := context.WithTimeout(s.ctx, s.cfg.Timeout)
+	defer cancel()
+
+	body, err := s.blobs.ReadQuarantined(ctx, j.sha256, j.groupID)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.sc.Scan(ctx, body)
+	if err != nil {
+		return err
+	}
+
+	if !res.Infected {
+		err = s.blobs.Release(ctx, j.sha256, j.pubkey, j.groupID, j.mime)
+		if err != nil {
+			return err
+		}
+
+		return s.db.ScanDB.SetClean(j.sha256, s.now())
+	}
+
+	err = s.blobs.Discard(ctx, j.sha256, j.groupID)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.ScanDB.SetInfected(j.sha256, res.Signature, s.now())
+	if err != nil {
+		return err
+	}
+
+	log.Printf("blob %s uploaded by %s is infected with %s, it was deleted", j.sha256, j.pubkey, res.Signature)
+	s.w.NotifyError(s.ctx, fmt.Errorf("infected blob %s uploaded by %s to group %q was deleted: %s", j.sha256, j.pubkey, j.groupID, res.Signature))
+
+	// the blob is gone, a failed notification doesn't fail the scan
+	err = s.notify(ctx, j, res)
+	if err != nil {
+		log.Printf("failed to notify the uploader of %s: %v", j.sha256, err)
+	}
+
+	return nil
+}
+
+// notify tells the uploader that its blob was deleted and why
+func (s *Service) notify(ctx context.Context, j job, res *Result) error {
+	tags := nostr.Tags{
+		{"x", j.sha256, "malware"},
+		{"p", j.pubkey},
+	}
+	if j.groupID != "" {
+		tags = append(tags, nostr.Tag{"h", j.groupID})
+	}
+
+	_, err := s.n.SignAndSaveEvent(ctx, &nostr.Event{
+		Kind:      KindReport,
+		CreatedAt: nostr.Now(),
+		Tags:      tags,
+		Content:   fmt.Sprintf("Your upload was deleted, it is infected with %s", res.Signature),
+	})
+
+	return err
+}
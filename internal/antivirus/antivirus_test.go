@@ -0,0 +1,212 @@
+package antivirus
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+type fakeScanner struct{}
+
+func (fakeScanner) Scan(ctx context.Context, body []byte) (*Result, error) {
+	if string(body) == "eicar" {
+		return &Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+
+	return &Result{}, nil
+}
+
+type fakeBlobs struct {
+	released  []string
+	discarded []string
+}
+
+func (b *fakeBlobs) ReadQuarantined(ctx context.Context, sha256, groupID string) ([]byte, error) {
+	return []byte(sha256), nil
+}
+
+func (b *fakeBlobs) Release(ctx context.Context, sha256, pubkey, groupID, mime string) error {
+	b.released = append(b.released, sha256)
+	return nil
+}
+
+func (b *fakeBlobs) Discard(ctx context.Context, sha256, groupID string) error {
+	b.discarded = append(b.discarded, sha256)
+	return nil
+}
+
+type fakeWebhook struct {
+	errors []error
+}
+
+func (w *fakeWebhook) Notify(ctx context.Context, message string) error {
+	return nil
+}
+
+func (w *fakeWebhook) NotifyWarning(ctx context.Context, err error) error {
+	return nil
+}
+
+func (w *fakeWebhook) NotifyError(ctx context.Context, err error) error {
+	w.errors = append(w.errors, err)
+	return nil
+}
+
+func TestRisk(t *testing.T) {
+	s := NewService(context.Background(), nil, fakeScanner{}, nil, nil, &Config{Threshold: RiskHigh, Queue: 1})
+
+	for mime, scan := range map[string]bool{
+		"image/png":                false,
+		"video/mp4":                false,
+		"text/plain":               false,
+		"application/pdf":          true,
+		"image/svg+xml":            true,
+		"application/octet-stream": true,
+	} {
+		if s.ShouldScan(mime) != scan {
+			t.Errorf("expected scan of %s to be %v", mime, scan)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	d := testutil.NewDB(t)
+	ctx := context.Background()
+
+	blobs := &fakeBlobs{}
+	n := &testutil.FakeStore{}
+	w := &fakeWebhook{}
+
+	s := NewService(ctx, d, fakeScanner{}, n, w, &Config{Threshold: RiskHigh, Workers: 1, Timeout: time.Minute, Queue: 10})
+	s.SetBlobs(blobs)
+
+	for _, sha := range []string{"clean", "eicar", "eicar"} {
+		err := s.Enqueue(ctx, sha, "alice", "demo", "application/pdf")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a blob waiting for a scan isn't queued twice
+	if len(s.jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(s.jobs))
+	}
+
+	for _, sha := range []string{"clean", "eicar", "unknown"} {
+		blocked, err := s.Blocked(ctx, sha)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if blocked != (sha != "unknown") {
+			t.Fatalf("expected %s to be blocked until it is scanned", sha)
+		}
+	}
+
+	for range 2 {
+		err := s.run(<-s.jobs)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(blobs.released) != 1 || blobs.released[0] != "clean" {
+		t.Fatalf("expected the clean blob to be released, got %v", blobs.released)
+	}
+
+	if len(blobs.discarded) != 1 || blobs.discarded[0] != "eicar" {
+		t.Fatalf("expected the infected blob to be discarded, got %v", blobs.discarded)
+	}
+
+	blocked, err := s.Blocked(ctx, "clean")
+	if err != nil || blocked {
+		t.Fatalf("expected the clean blob to be served, got %v %v", blocked, err)
+	}
+
+	scan, err := d.ScanDB.GetScan("eicar")
+	if err != nil || scan == nil || scan.Status != relay.ScanStatusInfected || scan.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("expected the blob to be infected, got %+v %v", scan, err)
+	}
+
+	// the uploader is notified and the operators alerted
+	if len(n.Events) != 1 || n.Events[0].Kind != KindReport || n.Events[0].Tags.GetFirst([]string{"p", "alice"}) == nil || n.Events[0].Tags.GetFirst([]string{"x", "eicar"}) == nil {
+		t.Fatalf("unexpected notifications %+v", n.Events)
+	}
+
+	if len(w.errors) != 1 {
+		t.Fatalf("expected an alert, got %v", w.errors)
+	}
+
+	// an infected blob uploaded again is scanned again
+	err = s.Enqueue(ctx, "eicar", "bob", "demo", "application/pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.jobs) != 1 {
+		t.Fatalf("expected the blob to be queued again, got %d jobs", len(s.jobs))
+	}
+}
+
+func TestClamAV(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			// the command and the stream are read until the empty chunk
+			buf := make([]byte, 64)
+			read := []byte{}
+			for len(read) < 4 || string(read[len(read)-4:]) != "\x00\x00\x00\x00" {
+				n, err := conn.Read(buf)
+				if err != nil {
+					break
+				}
+				read = append(read, buf[:n]...)
+			}
+
+			if string(read[:len("zINSTREAM\x00")]) != "zINSTREAM\x00" {
+				conn.Write([]byte("UNKNOWN COMMAND\x00"))
+			} else if len(read) > 20 {
+				conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+			} else {
+				conn.Write([]byte("stream: OK\x00"))
+			}
+			conn.Close()
+		}
+	}()
+
+	c := NewClamAV(l.Addr().String())
+
+	res, err := c.Scan(context.Background(), []byte("ok"))
+	if err != nil || res.Infected {
+		t.Fatalf("expected a clean verdict, got %+v %v", res, err)
+	}
+
+	res, err = c.Scan(context.Background(), []byte("an infected blob"))
+	if err != nil || !res.Infected || res.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("expected an infected verdict, got %+v %v", res, err)
+	}
+
+	_, err = parseClamReply("INSTREAM size limit exceeded. ERROR")
+	if err == nil {
+		t.Fatal("expected an error from a clamd error")
+	}
+}
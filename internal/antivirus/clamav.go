@@ -0,0 +1,83 @@
+package antivirus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// size of the chunks a blob is streamed to clamd in, below its default StreamMaxLength
+const clamChunk = 64 * 1024
+
+// ClamAV scans blobs with a clamd daemon over tcp with the INSTREAM command
+type ClamAV struct {
+	addr string
+}
+
+// NewClamAV scans with the clamd listening at addr, e.g. localhost:3310
+func NewClamAV(addr string) *ClamAV {
+	return &ClamAV{addr: addr}
+}
+
+func (c *ClamAV) Scan(ctx context.Context, body []byte) (*Result, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return nil, err
+	}
+
+	// the blob is sent in chunks prefixed with their length, an empty chunk ends the stream
+	size := make([]byte, 4)
+	for start := 0; start < len(body); start += clamChunk {
+		chunk := body[start:min(start+clamChunk, len(body))]
+
+		binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+		_, err = conn.Write(append(size, chunk...))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	binary.BigEndian.PutUint32(size, 0)
+	_, err = conn.Write(size)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseClamReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamReply reads the verdict of clamd: "stream: OK", "stream: <signature> FOUND" or an error
+func parseClamReply(reply string) (*Result, error) {
+	verdict, ok := strings.CutPrefix(reply, "stream: ")
+	if !ok {
+		return nil, fmt.Errorf("clamd answered %q", reply)
+	}
+
+	switch {
+	case verdict == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	}
+
+	return nil, fmt.Errorf("clamd answered %q", reply)
+}
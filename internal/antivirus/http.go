@@ -0,0 +1,53 @@
+package antivirus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// HTTP scans blobs with an external service: the blob is posted and the service answers with
+// {"infected": true, "signature": "..."}
+type HTTP struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTP scans with the service at url, requests are bound by the scan timeout
+func NewHTTP(url string) *HTTP {
+	return &HTTP{url: url, client: &http.Client{}}
+}
+
+func (h *HTTP) Scan(ctx context.Context, body []byte) (*Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scanning service answered %s", resp.Status)
+	}
+
+	var verdict struct {
+		Infected  bool   `json:"infected"`
+		Signature string `json:"signature"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&verdict)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Infected: verdict.Infected, Signature: verdict.Signature}, nil
+}
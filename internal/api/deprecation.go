@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/comunifi/relay/internal/metrics"
+)
+
+// Deprecation marks routes that have a successor, clients are told with the Deprecation, Sunset
+// and Link headers and the remaining calls are counted so operators can tell when to remove them
+type Deprecation struct {
+	name      string
+	sunset    time.Time // zero when no date is set
+	successor func(path string) string
+
+	calls atomic.Uint64
+}
+
+func NewDeprecation(name string, sunset time.Time, successor func(path string) string) *Deprecation {
+	return &Deprecation{
+		name:      name,
+		sunset:    sunset,
+		successor: successor,
+	}
+}
+
+func (d *Deprecation) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.calls.Add(1)
+
+		w.Header().Set("Deprecation", "true")
+		if !d.sunset.IsZero() {
+			w.Header().Set("Sunset", d.sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.successor != nil {
+			w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", d.successor(r.URL.Path)))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WriteMetrics writes the number of calls to the deprecated routes in the prometheus text format
+func (d *Deprecation) WriteMetrics(w io.Writer) {
+	metrics.Help(w, "relay_deprecated_requests_total", "counter", "requests to deprecated routes")
+	metrics.Sample(w, "relay_deprecated_requests_total", float64(d.calls.Load()), "routes", d.name)
+}
+
+// legacyLogsSuccessor maps the v1 log routes to the v2 route that replaces them
+func legacyLogsSuccessor(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	path = strings.TrimSuffix(path, "/all")
+	path = strings.TrimSuffix(path, "/new")
+
+	return strings.Replace(path, "/v1/logs/", "/v2/logs/", 1)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLegacyLogsSuccessor(t *testing.T) {
+	tests := map[string]string{
+		"/v1/logs/0xabc/0xtopic":         "/v2/logs/0xabc/0xtopic",
+		"/v1/logs/0xabc/0xtopic/":        "/v2/logs/0xabc/0xtopic",
+		"/v1/logs/0xabc/0xtopic/all":     "/v2/logs/0xabc/0xtopic",
+		"/v1/logs/0xabc/0xtopic/new":     "/v2/logs/0xabc/0xtopic",
+		"/v1/logs/0xabc/0xtopic/new/all": "/v2/logs/0xabc/0xtopic",
+		"/v1/logs/0xabc/tx/0xhash":       "/v2/logs/0xabc/tx/0xhash",
+	}
+
+	for path, want := range tests {
+		got := legacyLogsSuccessor(path)
+		if got != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+}
+
+func TestDeprecation(t *testing.T) {
+	sunset := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := NewDeprecation("legacy_logs", sunset, legacyLogsSuccessor)
+
+	h := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/logs/0xabc/0xtopic/new", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the route to keep working, got %d", rec.Code)
+	}
+
+	if rec.Header().Get("Deprecation") != "true" {
+		t.Error("expected a Deprecation header")
+	}
+
+	if got := rec.Header().Get("Sunset"); got != "Fri, 01 Jan 2027 00:00:00 GMT" {
+		t.Errorf("unexpected Sunset header %q", got)
+	}
+
+	if got := rec.Header().Get("Link"); got != `</v2/logs/0xabc/0xtopic>; rel="successor-version"` {
+		t.Errorf("unexpected Link header %q", got)
+	}
+
+	var buf bytes.Buffer
+	d.WriteMetrics(&buf)
+	if !strings.Contains(buf.String(), `relay_deprecated_requests_total{routes="legacy_logs"} 1`) {
+		t.Errorf("expected the call to be counted, got %s", buf.String())
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/comunifi/relay/internal/adminauth"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+// identity authenticates the callers of the routes, whichever credentials they use, and puts
+// who they are in the request context as a relay.Principal, which handlers read with
+// relay.GetPrincipal instead of looking at the credentials themselves
+type identity struct {
+	evm       relay.EVMRequester
+	links     AccountLinks
+	apiKey    string
+	ingestKey string // of the external indexers that push logs
+	admin     *adminauth.Service
+}
+
+// account serves requests made for an account: a body signed by the account or a NIP-98 event
+// signed by a pubkey linked to it
+func (id *identity) account(h http.HandlerFunc) http.HandlerFunc {
+	return withSignature(id.evm, id.links, h)
+}
+
+// multiPartAccount is like account for multi-part requests
+func (id *identity) multiPartAccount(h http.HandlerFunc) http.HandlerFunc {
+	return withMultiPartSignature(id.evm, id.links, h)
+}
+
+// operator serves requests made with the api key or an admin session
+func (id *identity) operator(h http.HandlerFunc) http.HandlerFunc {
+	return withAdmin(id.admin, id.apiKey, h)
+}
+
+// operatorPage is like operator for pages opened in a browser
+func (id *identity) operatorPage(h http.HandlerFunc) http.HandlerFunc {
+	return withAdminPage(id.admin, id.apiKey, h)
+}
+
+// ingester serves requests made with the key of the external indexers, or by operators
+func (id *identity) ingester(h http.HandlerFunc) http.HandlerFunc {
+	operator := id.operator(h)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id.ingestKey == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(relay.APIKeyHeader)), []byte(id.ingestKey)) != 1 {
+			operator(w, r)
+			return
+		}
+
+		h(w, r.WithContext(relay.WithPrincipal(r.Context(), &relay.Principal{Scopes: []relay.Scope{relay.ScopeIngest}})))
+	})
+}
+
+// accountOrOperator serves requests made for an account or by an operator, handlers check which
+// one with the scopes of the principal
+func (id *identity) accountOrOperator(h http.HandlerFunc) http.HandlerFunc {
+	account := id.account(h)
+	operator := id.operator(h)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(relay.SignatureHeader) != "" || hasNostrAuth(r) {
+			account(w, r)
+			return
+		}
+
+		operator(w, r)
+	})
+}
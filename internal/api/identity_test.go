@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+func TestIdentityOperator(t *testing.T) {
+	id := &identity{apiKey: "secret"}
+
+	var principal *relay.Principal
+	h := id.operator(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = relay.GetPrincipal(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/admin/groups", nil)
+	r.Header.Set(relay.APIKeyHeader, "secret")
+
+	w := httptest.NewRecorder()
+	h(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the key to be accepted, got %d", w.Code)
+	}
+
+	if principal == nil || !principal.Has(relay.ScopeOperator) || principal.Has(relay.ScopeAccount) {
+		t.Fatalf("expected an operator principal, got %v", principal)
+	}
+
+	// the api key doesn't act for an account
+	_, ok := relay.GetAddressFromContext(relay.WithPrincipal(r.Context(), principal))
+	if ok {
+		t.Fatal("expected no account for an operator")
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/comunifi/relay/internal/metrics"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+const (
+	// json-rpc error code returned when a method's concurrency limit is saturated
+	ErrCodeLimitExceeded = -32005
+)
+
+var (
+	DefaultProxyLimit  = LimitConfig{Concurrency: 64, Queue: 128, Wait: 5 * time.Second}
+	DefaultUserOpLimit = LimitConfig{Concurrency: 16, Queue: 64, Wait: 10 * time.Second}
+)
+
+// LimitExceededError is returned when a request could not be admitted in time
+type LimitExceededError struct {
+	Class string
+}
+
+func (e *LimitExceededError) Error() string {
+	return "limit exceeded"
+}
+
+func (e *LimitExceededError) ErrorCode() int {
+	return ErrCodeLimitExceeded
+}
+
+// LimitConfig configures how many requests of a class run at once and how many may wait
+type LimitConfig struct {
+	Concurrency int
+	Queue       int
+	Wait        time.Duration
+}
+
+// ConcurrencyLimit admits a bounded number of concurrent requests, requests beyond that
+// wait in a bounded queue and are rejected when it is full or they waited too long
+type ConcurrencyLimit struct {
+	class string
+	wait  time.Duration
+
+	slots chan struct{}
+	queue chan struct{}
+
+	rejected atomic.Uint64
+}
+
+func NewConcurrencyLimit(class string, conf LimitConfig) *ConcurrencyLimit {
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = 1
+	}
+
+	if conf.Queue < 0 {
+		conf.Queue = 0
+	}
+
+	return &ConcurrencyLimit{
+		class: class,
+		wait:  conf.Wait,
+		slots: make(chan struct{}, conf.Concurrency),
+		queue: make(chan struct{}, conf.Queue),
+	}
+}
+
+// Acquire takes a slot, the returned func releases it
+func (l *ConcurrencyLimit) Acquire(ctx context.Context) (func(), error) {
+	release := func() { <-l.slots }
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	// no free slot, join the queue if there is room
+	select {
+	case l.queue <- struct{}{}:
+	default:
+		l.rejected.Add(1)
+		return nil, &LimitExceededError{Class: l.class}
+	}
+	defer func() { <-l.queue }()
+
+	var timeout <-chan time.Time
+	if l.wait > 0 {
+		t := time.NewTimer(l.wait)
+		defer t.Stop()
+
+		timeout = t.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-timeout:
+		l.rejected.Add(1)
+		return nil, &LimitExceededError{Class: l.class}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ConcurrencyLimits exposes the usage of several limits
+type ConcurrencyLimits []*ConcurrencyLimit
+
+// WriteMetrics writes the usage of the limits in the prometheus text format
+func (ls ConcurrencyLimits) WriteMetrics(w io.Writer) {
+	metrics.Help(w, "relay_rpc_limit_in_flight", "gauge", "json-rpc requests being handled")
+	for _, l := range ls {
+		metrics.Sample(w, "relay_rpc_limit_in_flight", float64(len(l.slots)), "class", l.class)
+	}
+
+	metrics.Help(w, "relay_rpc_limit_queued", "gauge", "json-rpc requests waiting for a slot")
+	for _, l := range ls {
+		metrics.Sample(w, "relay_rpc_limit_queued", float64(len(l.queue)), "class", l.class)
+	}
+
+	metrics.Help(w, "relay_rpc_limit_rejected_total", "counter", "json-rpc requests rejected because the limit was saturated")
+	for _, l := range ls {
+		metrics.Sample(w, "relay_rpc_limit_rejected_total", float64(l.rejected.Load()), "class", l.class)
+	}
+}
+
+// withLimit runs a json-rpc handler once the limit admits it
+func withLimit(l *ConcurrencyLimit, h relay.RPCHandlerFunc) relay.RPCHandlerFunc {
+	return func(r *http.Request) (any, error) {
+		release, err := l.Acquire(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		return h(r)
+	}
+}
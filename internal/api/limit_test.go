@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	l := NewConcurrencyLimit("test", LimitConfig{Concurrency: 1, Queue: 1, Wait: time.Second})
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second request waits in the queue
+	admitted := make(chan error)
+	go func() {
+		release, err := l.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		admitted <- err
+	}()
+
+	// wait for the second request to be queued
+	for len(l.queue) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queue is full, the third request is rejected straight away
+	_, err = l.Acquire(context.Background())
+
+	var limitErr *LimitExceededError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected limit exceeded, got %v", err)
+	}
+
+	if limitErr.ErrorCode() != ErrCodeLimitExceeded {
+		t.Fatalf("expected code %d, got %d", ErrCodeLimitExceeded, limitErr.ErrorCode())
+	}
+
+	release()
+
+	err = <-admitted
+	if err != nil {
+		t.Fatalf("expected queued request to be admitted, got %v", err)
+	}
+
+	if l.rejected.Load() != 1 {
+		t.Fatalf("expected 1 rejected request, got %d", l.rejected.Load())
+	}
+}
+
+func TestConcurrencyLimitWait(t *testing.T) {
+	l := NewConcurrencyLimit("test", LimitConfig{Concurrency: 1, Queue: 1, Wait: 10 * time.Millisecond})
+
+	_, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = l.Acquire(context.Background())
+
+	var limitErr *LimitExceededError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected limit exceeded after waiting, got %v", err)
+	}
+
+	if len(l.queue) != 0 {
+		t.Fatal("expected the queue to be released")
+	}
+}
+
+func TestWithLimitJSONRPC(t *testing.T) {
+	proxy := NewConcurrencyLimit("proxy", LimitConfig{Concurrency: 1})
+	userop := NewConcurrencyLimit("userop", LimitConfig{Concurrency: 1})
+
+	ok := func(r *http.Request) (any, error) { return "ok", nil }
+
+	h := withJSONRPCRequest(map[string]relay.RPCHandlerFunc{
+		"eth_call":              withLimit(proxy, ok),
+		"eth_sendUserOperation": withLimit(userop, ok),
+	})
+
+	// saturate the proxy limit
+	release, err := proxy.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	call := func(method string) *httptest.ResponseRecorder {
+		body := `{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":[]}`
+
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+		return w
+	}
+
+	w := call("eth_call")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+
+	var res relay.JsonRPCResponse
+	err = json.Unmarshal(w.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Error == nil || res.Error.Code != ErrCodeLimitExceeded {
+		t.Fatalf("expected json-rpc error %d, got %+v", ErrCodeLimitExceeded, res.Error)
+	}
+
+	// user operations are not starved by proxy calls
+	w = call("eth_sendUserOperation")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/comunifi/relay/internal/maintenance"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+// ReadOnlyMiddleware rejects writes while the relay is in maintenance mode, operator and debug
+// routes stay available so the mode can be turned off and json-rpc writes are rejected per method
+func ReadOnlyMiddleware(m *maintenance.Mode) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if strings.HasPrefix(r.URL.Path, "/v1/admin/") || strings.HasPrefix(r.URL.Path, "/debug/") || strings.HasPrefix(r.URL.Path, "/v1/rpc/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			err := m.Check()
+			if err != nil {
+				w.Header().Set("Retry-After", "60")
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// withReadOnly rejects a json-rpc method that writes while the relay is in maintenance mode
+func withReadOnly(m *maintenance.Mode, h relay.RPCHandlerFunc) relay.RPCHandlerFunc {
+	return func(r *http.Request) (any, error) {
+		err := m.Check()
+		if err != nil {
+			return nil, err
+		}
+
+		return h(r)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/comunifi/relay/internal/maintenance"
+)
+
+func TestReadOnlyMiddleware(t *testing.T) {
+	m := maintenance.New(true, "migrating")
+
+	h := ReadOnlyMiddleware(m)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/v1/logs/0x1/0x2", http.StatusOK},
+		{http.MethodPost, "/v1/accounts/deploy", http.StatusServiceUnavailable},
+		{http.MethodPut, "/v1/push/nostr/abc", http.StatusServiceUnavailable},
+		{http.MethodPut, "/v1/admin/maintenance", http.StatusOK},
+		{http.MethodPost, "/v1/rpc/0x1", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.status, rec.Code)
+		}
+	}
+
+	m.Set(false, "")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/accounts/deploy", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected writes once maintenance is off, got %d", rec.Code)
+	}
+}
+
+func TestWithReadOnly(t *testing.T) {
+	m := maintenance.New(true, "")
+
+	called := false
+	h := withReadOnly(m, func(r *http.Request) (any, error) {
+		called = true
+		return nil, nil
+	})
+
+	_, err := h(httptest.NewRequest(http.MethodPost, "/", nil))
+
+	var roErr *maintenance.ReadOnlyError
+	if !errors.As(err, &roErr) || roErr.ErrorCode() != maintenance.ErrCodeReadOnly {
+		t.Fatalf("expected a read-only error, got %v", err)
+	}
+
+	if called {
+		t.Fatal("handler should not be called in maintenance mode")
+	}
+}
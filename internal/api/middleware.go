@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"io"
 	"math/big"
 	"net/http"
@@ -11,6 +13,8 @@ import (
 	"time"
 
 	"github.com/citizenwallet/smartcontracts/pkg/contracts/account"
+	"github.com/comunifi/relay/internal/adminauth"
+	"github.com/comunifi/relay/internal/grouptokens"
 	comm "github.com/comunifi/relay/pkg/common"
 	"github.com/comunifi/relay/pkg/relay"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
@@ -46,6 +50,8 @@ var (
 		relay.SignatureHeader,
 		relay.AddressHeader,
 		relay.AppVersionHeader,
+		relay.APIKeyHeader,
+		relay.GroupTokenHeader,
 	}
 
 	MAGIC_VALUE = [4]byte{0x16, 0x26, 0xba, 0x7e}
@@ -63,6 +69,43 @@ func HealthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+type readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// ReadinessMiddleware responds to readiness checks, 503 while any check fails
+func ReadinessMiddleware(checks []Checker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/readyz" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res := readiness{Ready: true, Checks: map[string]string{}}
+			for _, c := range checks {
+				err := c.Ready()
+				if err != nil {
+					res.Ready = false
+					res.Checks[c.Name()] = err.Error()
+					continue
+				}
+
+				res.Checks[c.Name()] = "ok"
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+
+			if !res.Ready {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+
+			json.NewEncoder(w).Encode(res)
+		})
+	}
+}
+
 // OptionsMiddleware ensures that we return the correct headers for CORS requests
 func OptionsMiddleware(h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
@@ -127,6 +170,107 @@ func RequestSizeLimitMiddleware(limit int64) func(http.Handler) http.Handler {
 	}
 }
 
+// withAPIKey is a middleware that only allows requests with the configured api key, an empty key disables the endpoint
+func withAPIKey(key string, h http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(relay.APIKeyHeader)), []byte(key)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		h(w, r.WithContext(relay.WithPrincipal(r.Context(), &relay.Principal{Scopes: []relay.Scope{relay.ScopeOperator}})))
+	})
+}
+
+// withAdminLogin is like withAPIKey for pages opened in a browser, the api key can also be given
+// as the password of basic auth, which the browser asks for
+func withAdminLogin(key string, h http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		given := r.Header.Get(relay.APIKeyHeader)
+		if _, password, ok := r.BasicAuth(); ok {
+			given = password
+		}
+
+		if subtle.ConstantTimeCompare([]byte(given), []byte(key)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="relay admin", charset="UTF-8"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		h(w, r.WithContext(relay.WithPrincipal(r.Context(), &relay.Principal{Scopes: []relay.Scope{relay.ScopeOperator}})))
+	})
+}
+
+// withAdmin is like withAPIKey for the operator routes, operators that logged in with their keys
+// can use their session instead of the api key
+func withAdmin(a *adminauth.Service, key string, h http.HandlerFunc) http.HandlerFunc {
+	return withAdminSession(a, h, withAPIKey(key, h))
+}
+
+// withAdminPage is like withAdminLogin for the pages of the operator routes
+func withAdminPage(a *adminauth.Service, key string, h http.HandlerFunc) http.HandlerFunc {
+	return withAdminSession(a, h, withAdminLogin(key, h))
+}
+
+// withAdminSession serves the requests with an admin session, the others are left to fallback
+func withAdminSession(a *adminauth.Service, h, fallback http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return fallback
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin, err := a.AuthenticateRequest(r)
+		if err != nil {
+			fallback(w, r)
+			return
+		}
+
+		p := &relay.Principal{Pubkey: admin, Scopes: []relay.Scope{relay.ScopeOperator}}
+		if common.IsHexAddress(admin) {
+			p = &relay.Principal{Address: admin, Scopes: []relay.Scope{relay.ScopeOperator}}
+		}
+
+		h(w, r.WithContext(relay.WithPrincipal(r.Context(), p)))
+	})
+}
+
+// withGroupToken is a middleware that only allows requests with an active group token of the given scope,
+// minted for the group in the url
+func withGroupToken(gt *grouptokens.Service, scope relay.GroupTokenScope, h http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, err := gt.Authenticate(r.Header.Get(relay.GroupTokenHeader))
+		if err != nil {
+			if err == grouptokens.ErrInvalidToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if t.GroupID != chi.URLParam(r, "group_id") || t.Scope != scope {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), relay.ContextKeyGroupToken, t)
+		ctx = relay.WithPrincipal(ctx, &relay.Principal{Pubkey: t.Pubkey, Scopes: []relay.Scope{relay.GroupScope(t.Scope)}})
+
+		h(w, r.WithContext(ctx))
+	})
+}
+
 type BodyEncoding string
 
 const (
@@ -141,8 +285,14 @@ type signedBody struct {
 }
 
 // withSignature is a middleware that checks the signature of the request against the request headers
-func withSignature(evm relay.EVMRequester, h http.HandlerFunc) http.HandlerFunc {
+// or against a NIP-98 event signed by a pubkey linked to the account, in which case the body is passed as is
+func withSignature(evm relay.EVMRequester, links AccountLinks, h http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasNostrAuth(r) {
+			withNostrAuth(links, h)(w, r)
+			return
+		}
+
 		// check signature
 		signature := r.Header.Get(relay.SignatureHeader)
 		if signature == "" {
@@ -192,7 +342,7 @@ func withSignature(evm relay.EVMRequester, h http.HandlerFunc) http.HandlerFunc
 		r.Body = io.NopCloser(strings.NewReader(string(req.Data)))
 		r.ContentLength = int64(len(req.Data))
 
-		ctx := context.WithValue(r.Context(), relay.ContextKeyAddress, addr)
+		ctx := relay.WithPrincipal(r.Context(), &relay.Principal{Address: addr, Scopes: []relay.Scope{relay.ScopeAccount}})
 		ctx = context.WithValue(ctx, relay.ContextKeySignature, signature)
 
 		h(w, r.WithContext(ctx))
@@ -201,8 +351,14 @@ func withSignature(evm relay.EVMRequester, h http.HandlerFunc) http.HandlerFunc
 }
 
 // withMultiPartSignature is a middleware that checks the signature of the request against a multi-part request headers
-func withMultiPartSignature(evm relay.EVMRequester, h http.HandlerFunc) http.HandlerFunc {
+// or against a NIP-98 event signed by a pubkey linked to the account, in which case the body field holds the data as is
+func withMultiPartSignature(evm relay.EVMRequester, links AccountLinks, h http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasNostrAuth(r) {
+			withNostrAuth(links, h)(w, r)
+			return
+		}
+
 		// check signature
 		signature := r.Header.Get(relay.SignatureHeader)
 		if signature == "" {
@@ -252,13 +408,28 @@ func withMultiPartSignature(evm relay.EVMRequester, h http.HandlerFunc) http.Han
 
 		r.MultipartForm.Value["body"] = []string{string(req.Data)}
 
-		ctx := context.WithValue(r.Context(), relay.ContextKeyAddress, addr)
+		ctx := relay.WithPrincipal(r.Context(), &relay.Principal{Address: addr, Scopes: []relay.Scope{relay.ScopeAccount}})
 
 		h(w, r.WithContext(ctx))
 		return
 	})
 }
 
+// withNostrAuth is a middleware that checks the NIP-98 event of the request and its link to the account of the request headers
+func withNostrAuth(links AccountLinks, h http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, ev, err := verifyNostrAuth(links, r)
+		if err != nil {
+			w.WriteHeader(nostrAuthStatus(err))
+			return
+		}
+
+		ctx := relay.WithPrincipal(r.Context(), &relay.Principal{Address: addr, Pubkey: ev.PubKey, Scopes: []relay.Scope{relay.ScopeAccount}})
+
+		h(w, r.WithContext(ctx))
+	})
+}
+
 // with1271Signature is a middleware that checks the owner's signature of the request against the request headers and the actual account on-chain
 func with1271Signature(evm relay.EVMRequester, h http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -294,7 +465,7 @@ func with1271Signature(evm relay.EVMRequester, h http.HandlerFunc) http.HandlerF
 		r.Body = io.NopCloser(strings.NewReader(string(req.Data)))
 		r.ContentLength = int64(len(req.Data))
 
-		ctx := context.WithValue(r.Context(), relay.ContextKeyAddress, addr)
+		ctx := relay.WithPrincipal(r.Context(), &relay.Principal{Address: addr, Scopes: []relay.Scope{relay.ScopeAccount}})
 		ctx = context.WithValue(ctx, relay.ContextKeySignature, signature)
 
 		h(w, r.WithContext(ctx))
@@ -302,6 +473,18 @@ func with1271Signature(evm relay.EVMRequester, h http.HandlerFunc) http.HandlerF
 	})
 }
 
+// setErrorHeaders sets the headers of handler errors that carry some
+func setErrorHeaders(w http.ResponseWriter, err error) {
+	var hErr relay.HeaderError
+	if !errors.As(err, &hErr) {
+		return
+	}
+
+	for k, v := range hErr.Headers() {
+		w.Header()[k] = v
+	}
+}
+
 // withJSONRPCRequest is a middleware that handles a JSON RPC request
 func withJSONRPCRequest(hmap map[string]relay.RPCHandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -348,6 +531,15 @@ func withJSONRPCRequest(hmap map[string]relay.RPCHandlerFunc) http.HandlerFunc {
 				println(err.Error())
 			}
 
+			setErrorHeaders(w, err)
+
+			var limitErr *LimitExceededError
+			if errors.As(err, &limitErr) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+			}
+
 			comm.JSONRPCBody(w, req.ID, body, nil, err)
 			return
 		}
@@ -375,6 +567,8 @@ func withJSONRPCRequest(hmap map[string]relay.RPCHandlerFunc) http.HandlerFunc {
 				println(err.Error())
 			}
 
+			setErrorHeaders(w, err)
+
 			ids = append(ids, req.ID)
 			bodies = append(bodies, body)
 			errors = append(errors, err)
@@ -2,9 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/comunifi/relay/pkg/relay"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
@@ -73,3 +76,40 @@ func TestSignatureVerification(t *testing.T) {
 		}
 	})
 }
+
+func TestAdminLogin(t *testing.T) {
+	h := withAdminLogin("secret", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(set func(r *http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/v1/admin/dashboard", nil)
+		set(r)
+
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		return w
+	}
+
+	// the browser is asked for the key
+	w := serve(func(r *http.Request) {})
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected a basic auth challenge, got %d", w.Code)
+	}
+
+	w = serve(func(r *http.Request) { r.SetBasicAuth("admin", "wrong") })
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong key to be refused, got %d", w.Code)
+	}
+
+	w = serve(func(r *http.Request) { r.SetBasicAuth("admin", "secret") })
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the key as password to be accepted, got %d", w.Code)
+	}
+
+	w = serve(func(r *http.Request) { r.Header.Set(relay.APIKeyHeader, "secret") })
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the key header to be accepted, got %d", w.Code)
+	}
+}
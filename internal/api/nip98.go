@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	comm "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// nostrAuthScheme prefixes the base64 NIP-98 event of the Authorization header
+	nostrAuthScheme = "Nostr "
+
+	// how far a NIP-98 event can be from now
+	nostrAuthMaxAge = time.Minute
+)
+
+var (
+	errInvalidNostrAuth = errors.New("invalid nostr authorization")
+	errNotLinked        = errors.New("pubkey is not linked to the account")
+)
+
+// AccountLinks returns the nostr pubkeys linked to an account
+type AccountLinks interface {
+	GetPubkeys(account string) ([]string, error)
+}
+
+// hasNostrAuth checks if a request is authorized with a NIP-98 event instead of a signed body
+func hasNostrAuth(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), nostrAuthScheme)
+}
+
+// verifyNostrAuth checks the NIP-98 event of a request against its method, url and body, and that
+// its pubkey is linked to the account of the X-Address header. The body is put back for the handler.
+func verifyNostrAuth(links AccountLinks, r *http.Request) (string, *nostr.Event, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(r.Header.Get("Authorization"), nostrAuthScheme))
+	if err != nil {
+		return "", nil, errInvalidNostrAuth
+	}
+
+	var ev nostr.Event
+	err = json.Unmarshal(b, &ev)
+	if err != nil {
+		return "", nil, errInvalidNostrAuth
+	}
+
+	ok, err := ev.CheckSignature()
+	if err != nil || !ok {
+		return "", nil, errInvalidNostrAuth
+	}
+
+	err = comm.CheckRequestEvent(r, &ev)
+	if err != nil {
+		return "", nil, err
+	}
+
+	age := time.Since(ev.CreatedAt.Time())
+	if age > nostrAuthMaxAge || age < -nostrAuthMaxAge {
+		return "", nil, errInvalidNostrAuth
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	// a request with a body is only authorized for that body
+	payload := ev.Tags.Find("payload")
+	if len(body) > 0 || payload != nil {
+		sum := sha256.Sum256(body)
+		if payload == nil || !strings.EqualFold(payload[1], hex.EncodeToString(sum[:])) {
+			return "", nil, errInvalidNostrAuth
+		}
+	}
+
+	addr := r.Header.Get(relay.AddressHeader)
+	if !common.IsHexAddress(addr) {
+		return "", nil, errInvalidNostrAuth
+	}
+
+	pubkeys, err := links.GetPubkeys(common.HexToAddress(addr).Hex())
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !slices.Contains(pubkeys, ev.PubKey) {
+		return "", nil, errNotLinked
+	}
+
+	return addr, &ev, nil
+}
+
+// nostrAuthStatus is the status of a request whose NIP-98 event could not be verified
+func nostrAuthStatus(err error) int {
+	if errors.Is(err, errInvalidNostrAuth) || errors.Is(err, errNotLinked) || errors.Is(err, comm.ErrRequestEventMismatch) {
+		return http.StatusUnauthorized
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type fakeLinks map[string][]string
+
+func (l fakeLinks) GetPubkeys(account string) ([]string, error) {
+	return l[account], nil
+}
+
+func TestWithNostrAuth(t *testing.T) {
+	const account = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+
+	links := fakeLinks{account: {pk}}
+
+	authorization := func(method, u string, body string, createdAt nostr.Timestamp) string {
+		sum := sha256.Sum256([]byte(body))
+		ev := nostr.Event{
+			Kind:      nostr.KindHTTPAuth,
+			CreatedAt: createdAt,
+			Tags: nostr.Tags{
+				{"u", u},
+				{"method", method},
+				{"payload", hex.EncodeToString(sum[:])},
+			},
+		}
+		err := ev.Sign(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return nostrAuthScheme + base64.StdEncoding.EncodeToString(b)
+	}
+
+	var gotAddr, gotPubkey, gotBody string
+	h := withSignature(nil, links, func(w http.ResponseWriter, r *http.Request) {
+		p, _ := relay.GetPrincipal(r.Context())
+		gotAddr, gotPubkey = p.Address, p.Pubkey
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	body := `{"token":"abc"}`
+	u := "https://relay.example.com/v1/push/" + account
+
+	cases := []struct {
+		name   string
+		auth   string
+		body   string
+		addr   string
+		status int
+	}{
+		{"valid", authorization(http.MethodPut, u, body, nostr.Now()), body, account, http.StatusOK},
+		{"other body", authorization(http.MethodPut, u, body, nostr.Now()), `{"token":"xyz"}`, account, http.StatusUnauthorized},
+		{"other method", authorization(http.MethodDelete, u, body, nostr.Now()), body, account, http.StatusUnauthorized},
+		{"other url", authorization(http.MethodPut, "https://relay.example.com/v1/profiles/"+account, body, nostr.Now()), body, account, http.StatusUnauthorized},
+		{"expired", authorization(http.MethodPut, u, body, nostr.Now()-120), body, account, http.StatusUnauthorized},
+		{"not linked", authorization(http.MethodPut, u, body, nostr.Now()), body, "0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512", http.StatusUnauthorized},
+		{"not base64", nostrAuthScheme + "nope", body, account, http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		gotAddr, gotPubkey, gotBody = "", "", ""
+
+		r := httptest.NewRequest(http.MethodPut, u, strings.NewReader(c.body))
+		r.Header.Set("Authorization", c.auth)
+		r.Header.Set(relay.AddressHeader, c.addr)
+
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		if w.Code != c.status {
+			t.Fatalf("%s: expected status %d, got %d", c.name, c.status, w.Code)
+		}
+
+		if c.status != http.StatusOK {
+			continue
+		}
+
+		if gotAddr != account || gotPubkey != pk || gotBody != body {
+			t.Fatalf("%s: expected %s %s %s, got %s %s %s", c.name, account, pk, body, gotAddr, gotPubkey, gotBody)
+		}
+	}
+}
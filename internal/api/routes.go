@@ -1,15 +1,27 @@
 package api
 
 import (
+	"expvar"
+	"net/http/pprof"
+
+	"github.com/comunifi/relay/internal/accounting"
 	"github.com/comunifi/relay/internal/accounts"
 	"github.com/comunifi/relay/internal/bucket"
 	"github.com/comunifi/relay/internal/chain"
 	"github.com/comunifi/relay/internal/events"
+	"github.com/comunifi/relay/internal/integrity"
+	"github.com/comunifi/relay/internal/ipfs"
 	"github.com/comunifi/relay/internal/legacylogs"
+	"github.com/comunifi/relay/internal/load"
+	"github.com/comunifi/relay/internal/logs"
+	"github.com/comunifi/relay/internal/maintenance"
+	"github.com/comunifi/relay/internal/metrics"
+	"github.com/comunifi/relay/internal/onboarding"
 	"github.com/comunifi/relay/internal/paymaster"
 	"github.com/comunifi/relay/internal/profiles"
 	"github.com/comunifi/relay/internal/push"
 	"github.com/comunifi/relay/internal/rpc"
+	"github.com/comunifi/relay/internal/signatures"
 	"github.com/comunifi/relay/internal/userop"
 	"github.com/comunifi/relay/internal/version"
 	"github.com/comunifi/relay/pkg/relay"
@@ -32,54 +44,188 @@ func (s *Server) AddMiddleware(cr *chi.Mux) *chi.Mux {
 	// configure custom middleware
 	cr.Use(OptionsMiddleware)
 	cr.Use(HealthMiddleware)
+	cr.Use(ReadinessMiddleware(s.checks))
+	cr.Use(ReadOnlyMiddleware(s.maintenance))
 	cr.Use(RequestSizeLimitMiddleware(10 << 20)) // Limit request bodies to 10MB
 	cr.Use(middleware.Compress(9))
 
 	return cr
 }
 
-func (s *Server) AddRoutes(cr *chi.Mux, b *bucket.Bucket) *chi.Mux {
+func (s *Server) AddRoutes(cr *chi.Mux, b *bucket.Bucket, acs *accounting.Handlers, ic *integrity.Handlers, sigs *signatures.Registry, apiKey string) *chi.Mux {
 	// instantiate handlers
 	v := version.NewService()
-	ev := events.NewHandlers(s.chainID.String(), s.db, s.pools)
+	ev := events.NewHandlers(s.chainID.String(), s.db, s.pools, s.evm, sigs)
 	rpc := rpc.NewHandlers()
-	pm := paymaster.NewService(s.evm, s.db)
-	uop := userop.NewService(s.evm, s.db, s.n, s.useropq, s.chainID)
-	ch := chain.NewService(s.evm, s.chainID)
+	pm := paymaster.NewService(s.evm, s.db, s.chainID, s.sponsorLimits)
+	pm.SetDenials(s.denials)
+	uop := userop.NewService(s.evm, s.db, s.n, pm, s.useropq, s.mempool, s.chainID)
+	uop.SetEntryPoints(s.entryPoints)
+	ch := chain.NewService(s.evm, s.chainID, s.chainLimits)
 	pr := profiles.NewService(b, s.evm)
 	pu := push.NewService(s.db)
 	l := legacylogs.NewService(s.chainID, s.n, s.evm)
-	acc := accounts.NewService(s.evm, s.db)
+	lv2 := logs.NewService(s.chainID, s.n)
+	acc := accounts.NewService(s.evm, s.db, s.n, pm, s.chainID)
+	ip := ipfs.NewService(b, s.db)
+	mm := maintenance.NewHandlers(s.maintenance)
+	ld := load.NewHandlers(s.load)
+
+	// who the callers of the routes are, whichever credentials they use
+	id := &identity{evm: s.evm, links: s.db.AccountLinkDB, apiKey: apiKey, ingestKey: s.ingestKey, admin: s.adminAuth}
+
+	// json-rpc methods, proxied chain methods share a limit so they can't starve user operations
+	rpcMethods := map[string]relay.RPCHandlerFunc{
+		"pm_sponsorUserOperation":   withReadOnly(s.maintenance, withLimit(s.useropLimit, pm.Sponsor)),
+		"pm_ooSponsorUserOperation": withReadOnly(s.maintenance, withLimit(s.useropLimit, pm.OOSponsor)),
+		"eth_sendUserOperation":     withReadOnly(s.maintenance, withLimit(s.useropLimit, uop.Send)),
+	}
+
+	for method, h := range ch.Methods() {
+		if method == "eth_chainId" {
+			rpcMethods[method] = h
+			continue
+		}
+
+		if method == "eth_sendRawTransaction" {
+			h = withReadOnly(s.maintenance, h)
+		}
+
+		rpcMethods[method] = withLimit(s.proxyLimit, h)
+	}
 
 	// configure routes
+	s.collectors = append(s.collectors, ConcurrencyLimits{s.proxyLimit, s.useropLimit}, s.legacyLogs)
+	cr.Get("/metrics", metrics.Handler(s.collectors...))
+
 	cr.Route("/version", func(cr chi.Router) {
 		cr.Get("/", v.Current)
 	})
 
+	// operator debugging, only when enabled
+	if s.debug != nil {
+		cr.Route("/debug", func(cr chi.Router) {
+			cr.Get("/pprof/*", id.operator(pprof.Index))
+			cr.Get("/pprof/cmdline", id.operator(pprof.Cmdline))
+			cr.Get("/pprof/profile", id.operator(pprof.Profile))
+			cr.Get("/pprof/symbol", id.operator(pprof.Symbol))
+			cr.Post("/pprof/symbol", id.operator(pprof.Symbol))
+			cr.Get("/pprof/trace", id.operator(pprof.Trace))
+			cr.Get("/vars", id.operator(expvar.Handler().ServeHTTP))
+			cr.Get("/runtime", id.operator(s.debug.Runtime))
+			cr.Get("/log-level", id.operator(s.debug.GetLevel))
+			cr.Put("/log-level", id.operator(s.debug.SetLevel))
+		})
+	}
+
 	// legacy routes that are maintained for v1 compatibility
 	cr.Route("/v1", func(cr chi.Router) {
 		// accounts
 		cr.Route("/accounts", func(cr chi.Router) {
 			cr.Get("/{acc_addr}/exists", acc.Exists)
+			cr.Get("/{acc_addr}/activity", acc.Activity)
+			cr.Post("/deploy", acc.Deploy)
+			cr.Get("/factories", acc.GetFactories)
+			cr.Post("/factories", id.operator(acc.RegisterFactory))
+			cr.Delete("/factories/{factory}", id.operator(acc.RemoveFactory))
 		})
 
+		// onboarding, account, group and profile of a new user in a single signed request
+		if s.groups != nil {
+			ob := onboarding.NewService(acc, s.db, s.groups, s.n)
+			cr.Post("/onboarding", ob.Onboard)
+		}
+
 		// profiles
 		cr.Route("/profiles", func(cr chi.Router) {
 			cr.Route("/{contract_address}", func(cr chi.Router) {
-				cr.Put("/{acc_addr}", withMultiPartSignature(s.evm, pr.PinMultiPartProfile))
-				cr.Patch("/{acc_addr}", withSignature(s.evm, pr.PinProfile))
-				cr.Delete("/{acc_addr}", withSignature(s.evm, pr.Unpin))
+				cr.Put("/{acc_addr}", id.multiPartAccount(pr.PinMultiPartProfile))
+				cr.Patch("/{acc_addr}", id.account(pr.PinProfile))
+				cr.Delete("/{acc_addr}", id.account(pr.Unpin))
 			})
 		})
 
+		// group tokens, managed by group admins with signed requests
+		if s.groupTokens != nil {
+			cr.Route("/groups/{group_id}", func(cr chi.Router) {
+				cr.Post("/tokens", s.groupTokens.Mint)
+				cr.Post("/tokens/list", s.groupTokens.List)
+				cr.Post("/tokens/{token_id}/revoke", s.groupTokens.Revoke)
+				cr.Get("/analytics", withGroupToken(s.groupTokens, relay.GroupTokenScopeAnalytics, s.groupTokens.Analytics))
+			})
+		}
+
+		// media of groups, listed by members with signed requests
+		if s.uploads != nil && s.groups != nil {
+			cr.Post("/groups/{group_id}/media/list", s.uploads.Media)
+		}
+
+		// group calendars, subscribed to from calendar apps
+		if s.calendar != nil {
+			cr.Get("/groups/{group_id}/calendar.ics", s.calendar.ICS)
+		}
+
+		// names of the accounts of a group, resolved for members with signed requests
+		if s.contacts != nil {
+			cr.Post("/groups/{group_id}/contacts/resolve", s.contacts.Resolve)
+		}
+
+		// messages that matched a keyword filter, listed for group admins with signed requests
+		if s.wordFilter != nil {
+			cr.Post("/groups/{group_id}/filtered/list", s.wordFilter.Filtered)
+		}
+
+		// the public-facing identity of groups, set by their admins with signed requests
+		if s.profiles != nil {
+			cr.Get("/groups/{group_id}/profile", s.profiles.GetProfile)
+			cr.Post("/groups/{group_id}/profile", s.profiles.SetProfile)
+		}
+
+		// email gateway, mails are forwarded by the inbound email provider and senders managed by group admins
+		if s.email != nil {
+			cr.Post("/email/inbound", s.email.Receive)
+			cr.Post("/groups/{group_id}/email/senders", s.email.AddSender)
+			cr.Post("/groups/{group_id}/email/senders/list", s.email.ListSenders)
+			cr.Post("/groups/{group_id}/email/senders/remove", s.email.RemoveSender)
+		}
+
+		// personal data, exported and erased with requests signed by the pubkey
+		if s.privacy != nil {
+			cr.Post("/privacy/export", s.privacy.Export)
+			cr.Post("/privacy/erase", s.privacy.Erase)
+			cr.Post("/privacy/purge", s.privacy.RequestPurge)
+		}
+
 		// push
+		cr.Route("/push/nostr/{pubkey}", func(cr chi.Router) {
+			cr.Get("/", pu.GetNostrPreference)
+			cr.Put("/", pu.AddNostrToken)
+			cr.Post("/remove", pu.RemoveNostrToken)
+		})
+
 		cr.Route("/push/{contract_address}", func(cr chi.Router) {
-			cr.Put("/{acc_addr}", withSignature(s.evm, pu.AddToken))
-			cr.Delete("/{acc_addr}/{token}", withSignature(s.evm, pu.RemoveAccountToken))
+			cr.Put("/{acc_addr}", id.account(pu.AddToken))
+			cr.Delete("/{acc_addr}/{token}", id.account(pu.RemoveAccountToken))
 		})
 
-		// logs
+		// ipfs
+		cr.Get("/ipfs/{cid}", ip.Get)
+
+		// accounting
+		cr.Get("/accounting/{pm_address}/{month}", id.operator(acs.Get))
+
+		// logs of several hashes at once, for clients hydrating the hashes they cached
+		cr.Post("/logs/batch", l.GetBatch)
+
+		// logs pushed by trusted indexers of chains the relay can't stream from
+		if s.ingest != nil {
+			cr.Post("/logs/ingest", id.ingester(s.ingest.Push))
+		}
+
+		// logs, deprecated in favour of /v2/logs
 		cr.Route("/logs/{contract_address}", func(cr chi.Router) {
+			cr.Use(s.legacyLogs.Middleware)
+
 			cr.Route("/{topic}", func(cr chi.Router) {
 				cr.Get("/", l.Get)
 				cr.Get("/all", l.GetAll)
@@ -91,28 +237,105 @@ func (s *Server) AddRoutes(cr *chi.Mux, b *bucket.Bucket) *chi.Mux {
 			cr.Get("/tx/{hash}", l.GetSingle)
 		})
 
+		// gas price, bundles are held back while it spikes
+		if s.gas != nil {
+			cr.Get("/gas", s.gas.Get)
+		}
+
+		// user operations
+		cr.Route("/userops", func(cr chi.Router) {
+			cr.Get("/{userop_hash}", uop.GetLatest)
+			cr.Get("/sender/{acc_addr}", uop.GetAccountLatest)
+
+			// senders and paymasters are told about the transitions of their user ops
+			if s.userOpHooks != nil {
+				cr.Route("/webhooks/{address}", func(cr chi.Router) {
+					cr.Post("/", id.accountOrOperator(s.userOpHooks.Register))
+					cr.Get("/", id.accountOrOperator(s.userOpHooks.List))
+					cr.Delete("/{id}", id.accountOrOperator(s.userOpHooks.Remove))
+				})
+			}
+		})
+
+		// operators
+		cr.Route("/admin", func(cr chi.Router) {
+			// operators log in with their keys instead of using the api key
+			if s.adminAuth != nil {
+				cr.Get("/login/challenge", s.adminAuth.Challenge)
+				cr.Post("/login/ethereum", s.adminAuth.LoginEthereum)
+				cr.Post("/login/nostr", s.adminAuth.LoginNostr)
+			}
+
+			cr.Get("/mempool", id.operator(uop.GetMempool))
+			cr.Delete("/mempool/{userop_hash}", id.operator(uop.DropMempoolOp))
+			cr.Get("/integrity", id.operator(ic.Get))
+			cr.Get("/maintenance", id.operator(mm.Get))
+			cr.Put("/maintenance", id.operator(mm.Set))
+			cr.Get("/load", id.operator(ld.Get))
+			if s.tokenGate != nil {
+				cr.Get("/tokengate", id.operator(s.tokenGate.Get))
+			}
+			if s.groupCheck != nil {
+				cr.Get("/groups/consistency", id.operator(s.groupCheck.Get))
+			}
+			if s.profiles != nil {
+				cr.Put("/groups/{group_id}/profile", id.operator(s.profiles.PutProfile))
+			}
+			if s.privacy != nil {
+				cr.Get("/erasures", id.operator(s.privacy.Requests))
+				cr.Get("/purges", id.operator(s.privacy.Purges))
+				cr.Get("/purges/{id}", id.operator(s.privacy.GetPurge))
+				cr.Post("/purges/{id}/approve", id.operator(s.privacy.ApprovePurge))
+				cr.Post("/purges/{id}/reject", id.operator(s.privacy.RejectPurge))
+			}
+			if s.uploads != nil {
+				cr.Get("/uploads", id.operator(s.uploads.Get))
+				cr.Get("/uploads/flags", id.operator(s.uploads.Flags))
+				cr.Get("/uploads/stats", id.operator(s.uploads.Stats))
+				cr.Delete("/uploads/flags/{pubkey}", id.operator(s.uploads.ClearFlag))
+			}
+			if s.blobGC != nil {
+				cr.Get("/blobs/gc", id.operator(s.blobGC.Get))
+				cr.Post("/blobs/gc", id.operator(s.blobGC.Run))
+			}
+			if s.denials != nil {
+				cr.Get("/denials", id.operator(s.denials.Get))
+			}
+			if s.bans != nil {
+				cr.Get("/bans", id.operator(s.bans.Get))
+				cr.Post("/bans", id.operator(s.bans.Add))
+				cr.Delete("/bans/{kind}/{value}", id.operator(s.bans.Remove))
+			}
+			if s.indexer != nil {
+				cr.Get("/indexer", id.operator(s.indexer.Get))
+			}
+			if s.status != nil {
+				cr.Get("/status", id.operator(s.status.Get))
+				cr.Get("/dashboard", id.operatorPage(s.status.Page))
+			}
+		})
+
 		// rpc
 		cr.Route("/rpc/{pm_address}", func(cr chi.Router) {
-			cr.Post("/", withJSONRPCRequest(map[string]relay.RPCHandlerFunc{
-				"pm_sponsorUserOperation":   pm.Sponsor,
-				"pm_ooSponsorUserOperation": pm.OOSponsor,
-				"eth_sendUserOperation":     uop.Send,
-				"eth_chainId":               ch.ChainId,
-				"eth_call":                  ch.EthCall,
-				"eth_blockNumber":           ch.EthBlockNumber,
-				"eth_getBlockByNumber":      ch.EthGetBlockByNumber,
-				"eth_maxPriorityFeePerGas":  ch.EthMaxPriorityFeePerGas,
-				"eth_getTransactionReceipt": ch.EthGetTransactionReceipt,
-				"eth_getTransactionCount":   ch.EthGetTransactionCount,
-				"eth_estimateGas":           ch.EthEstimateGas,
-				"eth_gasPrice":              ch.EthGasPrice,
-				"eth_sendRawTransaction":    ch.EthSendRawTransaction,
-			}))
+			cr.Post("/", withJSONRPCRequest(rpcMethods))
 		})
 
+		// events
+		cr.Post("/events", id.operator(ev.Register))
+		cr.Post("/events/abi", id.operator(ev.RegisterABI))
+
 		cr.Get("/events/{contract}/{topic}", ev.HandleConnection) // for listening to events
 		cr.Get("/rpc", rpc.HandleConnection)                      // for sending RPC calls
 	})
 
+	cr.Route("/v2", func(cr chi.Router) {
+		// logs
+		cr.Route("/logs/{contract_address}", func(cr chi.Router) {
+			cr.Get("/{topic}", lv2.Get)
+			cr.Get("/{topic}/export", lv2.Export)
+			cr.Get("/tx/{hash}", lv2.GetSingle)
+		})
+	})
+
 	return cr
 }
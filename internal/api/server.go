@@ -5,12 +5,39 @@ import (
 	"log"
 	"math/big"
 	"net/http"
+	"time"
 
+	"github.com/comunifi/relay/internal/adminauth"
+	"github.com/comunifi/relay/internal/blobgc"
+	"github.com/comunifi/relay/internal/calendar"
+	"github.com/comunifi/relay/internal/chain"
+	"github.com/comunifi/relay/internal/contacts"
 	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/debug"
+	"github.com/comunifi/relay/internal/denylist"
+	"github.com/comunifi/relay/internal/email"
+	"github.com/comunifi/relay/internal/gas"
+	"github.com/comunifi/relay/internal/groupcheck"
+	"github.com/comunifi/relay/internal/groupprofiles"
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/internal/grouptokens"
+	"github.com/comunifi/relay/internal/indexer"
+	"github.com/comunifi/relay/internal/ingest"
+	"github.com/comunifi/relay/internal/load"
+	"github.com/comunifi/relay/internal/maintenance"
+	"github.com/comunifi/relay/internal/metrics"
 	"github.com/comunifi/relay/internal/nostr"
+	"github.com/comunifi/relay/internal/paymaster"
+	"github.com/comunifi/relay/internal/privacy"
 	"github.com/comunifi/relay/internal/queue"
+	"github.com/comunifi/relay/internal/status"
+	"github.com/comunifi/relay/internal/tokengate"
+	"github.com/comunifi/relay/internal/uploads"
+	"github.com/comunifi/relay/internal/userophooks"
+	"github.com/comunifi/relay/internal/wordfilter"
 	"github.com/comunifi/relay/internal/ws"
 	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
 )
 
 type Server struct {
@@ -18,12 +45,225 @@ type Server struct {
 	db      *db.DB
 	n       *nostr.Nostr
 	useropq *queue.Service
+	mempool *queue.Mempool
 	evm     relay.EVMRequester
 	pools   *ws.ConnectionPools
+
+	maintenance *maintenance.Mode
+	debug       *debug.Handlers // nil unless the debug endpoints are enabled
+	legacyLogs  *Deprecation
+	load        *load.Sampler
+	groups      *groups.GroupsService  // nil unless groups are served
+	groupTokens *grouptokens.Service   // nil unless groups are served
+	email       *email.Service         // nil unless an email domain is configured
+	calendar    *calendar.Service      // nil unless groups are served
+	contacts    *contacts.Service      // nil unless groups are served
+	wordFilter  *wordfilter.Service    // nil unless groups are served
+	tokenGate   *tokengate.Handlers    // nil unless groups are gated by tokens
+	groupCheck  *groupcheck.Handlers   // nil unless groups are served
+	profiles    *groupprofiles.Service // nil unless groups are served
+	privacy     *privacy.Service       // nil unless groups are served
+	uploads     *uploads.Service       // nil unless groups are served
+	blobGC      *blobgc.Handlers       // nil unless groups are served
+	status      *status.Service
+	adminAuth   *adminauth.Service   // nil unless operators can log in with their keys
+	ingest      *ingest.Service      // nil unless external indexers can push logs
+	ingestKey   string               // of the external indexers that push logs
+	userOpHooks *userophooks.Service // webhooks of the senders and paymasters of user ops
+	indexer     *indexer.Handlers    // nil unless the indexer runs
+	gas         *gas.Handlers
+	entryPoints []common.Address // entry points user operations can target, empty allows any
+
+	checks     []Checker
+	collectors []metrics.Collector
+
+	// json-rpc proxy calls and user operations are limited separately so that
+	// a burst of cheap calls can't starve sponsorship
+	proxyLimit  *ConcurrencyLimit
+	useropLimit *ConcurrencyLimit
+
+	chainLimits   chain.Limits
+	sponsorLimits paymaster.Limits
+	denials       *paymaster.Denials // nil unless denied user ops are recorded
+	bans          *denylist.Service
+}
+
+// Checker reports whether a dependency is ready to serve requests
+type Checker interface {
+	Name() string
+	Ready() error
+}
+
+func NewServer(chainID *big.Int, db *db.DB, n *nostr.Nostr, useropq *queue.Service, mempool *queue.Mempool, evm relay.EVMRequester, pools *ws.ConnectionPools) *Server {
+	return &Server{
+		chainID:       chainID,
+		db:            db,
+		n:             n,
+		useropq:       useropq,
+		mempool:       mempool,
+		evm:           evm,
+		pools:         pools,
+		maintenance:   maintenance.New(false, ""),
+		legacyLogs:    NewDeprecation("legacy_logs", time.Time{}, legacyLogsSuccessor),
+		load:          load.NewSampler(load.DefaultInterval),
+		proxyLimit:    NewConcurrencyLimit("proxy", DefaultProxyLimit),
+		useropLimit:   NewConcurrencyLimit("userop", DefaultUserOpLimit),
+		chainLimits:   chain.DefaultLimits,
+		sponsorLimits: paymaster.DefaultLimits,
+	}
+}
+
+// SetRPCLimits configures the concurrency limits of the json-rpc routes
+func (s *Server) SetRPCLimits(proxy, userop LimitConfig) {
+	s.proxyLimit = NewConcurrencyLimit("proxy", proxy)
+	s.useropLimit = NewConcurrencyLimit("userop", userop)
+}
+
+// SetMaintenance sets the mode that decides whether the api accepts writes
+func (s *Server) SetMaintenance(m *maintenance.Mode) {
+	s.maintenance = m
+}
+
+// SetLegacyLogsSunset announces when the v1 log routes will be removed
+func (s *Server) SetLegacyLogsSunset(t time.Time) {
+	s.legacyLogs.sunset = t
+}
+
+// SetLoad sets the sampler behind /v1/admin/load
+func (s *Server) SetLoad(l *load.Sampler) {
+	s.load = l
+}
+
+// SetGroups exposes the onboarding route, which joins groups on behalf of new users
+func (s *Server) SetGroups(g *groups.GroupsService) {
+	s.groups = g
+}
+
+// SetGroupTokens exposes the group token and analytics routes under /v1/groups
+func (s *Server) SetGroupTokens(gt *grouptokens.Service) {
+	s.groupTokens = gt
+}
+
+// SetCalendar exposes the calendar feeds of groups
+func (s *Server) SetCalendar(c *calendar.Service) {
+	s.calendar = c
+}
+
+// SetContacts exposes the resolution of addresses to the names members know them by
+func (s *Server) SetContacts(c *contacts.Service) {
+	s.contacts = c
+}
+
+// SetWordFilter exposes the messages that matched a keyword filter to the admins of their group
+func (s *Server) SetWordFilter(f *wordfilter.Service) {
+	s.wordFilter = f
+}
+
+// SetGroupCheck exposes the report of the latest group consistency check under /v1/admin
+func (s *Server) SetGroupCheck(h *groupcheck.Handlers) {
+	s.groupCheck = h
+}
+
+// SetGroupProfiles exposes the profiles of groups, set by their admins or by operators under /v1/admin
+func (s *Server) SetGroupProfiles(p *groupprofiles.Service) {
+	s.profiles = p
+}
+
+// SetTokenGate exposes the report of the latest token gate sync under /v1/admin
+func (s *Server) SetTokenGate(h *tokengate.Handlers) {
+	s.tokenGate = h
+}
+
+// SetEmail exposes the inbound email gateway and the email sender routes of groups
+func (s *Server) SetEmail(e *email.Service) {
+	s.email = e
+}
+
+// SetPrivacy exposes the personal data export, erasure and purge routes, and their admin routes under /v1/admin
+func (s *Server) SetPrivacy(p *privacy.Service) {
+	s.privacy = p
+}
+
+// SetUploads exposes the upload log and the flagged uploaders under /v1/admin, and the media of groups
+func (s *Server) SetUploads(u *uploads.Service) {
+	s.uploads = u
+}
+
+// SetBlobGC exposes the report of the latest blob garbage collection under /v1/admin
+func (s *Server) SetBlobGC(h *blobgc.Handlers) {
+	s.blobGC = h
+}
+
+// SetStatus exposes the state of the relay under /v1/admin/status, and as a dashboard
+func (s *Server) SetStatus(st *status.Service) {
+	s.status = st
+}
+
+// SetAdminAuth lets operators log in with their keys and use the admin routes with a session
+func (s *Server) SetAdminAuth(a *adminauth.Service) {
+	s.adminAuth = a
+}
+
+// SetIngest lets trusted external indexers push logs with their key
+func (s *Server) SetIngest(i *ingest.Service, key string) {
+	s.ingest = i
+	s.ingestKey = key
+}
+
+// SetUserOpHooks lets senders and paymasters register webhooks for the transitions of their
+// user ops
+func (s *Server) SetUserOpHooks(h *userophooks.Service) {
+	s.userOpHooks = h
+}
+
+// SetIndexer exposes how far the indexer is behind the chain under /v1/admin
+func (s *Server) SetIndexer(h *indexer.Handlers) {
+	s.indexer = h
+}
+
+// SetEntryPoints restricts the entry points user operations sent to the api can target
+func (s *Server) SetEntryPoints(eps []common.Address) {
+	s.entryPoints = eps
+}
+
+// SetGas exposes the gas price and whether bundles are held back under /v1/gas
+func (s *Server) SetGas(h *gas.Handlers) {
+	s.gas = h
+}
+
+// SetDebug exposes the pprof, expvar and runtime endpoints under /debug
+func (s *Server) SetDebug(d *debug.Handlers) {
+	s.debug = d
+}
+
+// AddChecks adds dependencies that are checked by /readyz
+func (s *Server) AddChecks(cs ...Checker) {
+	s.checks = append(s.checks, cs...)
+}
+
+// AddCollectors adds collectors that are exposed on /metrics
+func (s *Server) AddCollectors(cs ...metrics.Collector) {
+	s.collectors = append(s.collectors, cs...)
+}
+
+// SetChainLimits configures what can be proxied to the upstream node
+func (s *Server) SetChainLimits(l chain.Limits) {
+	s.chainLimits = l
+}
+
+// SetSponsorLimits configures what a single account can be sponsored within a window
+func (s *Server) SetSponsorLimits(l paymaster.Limits) {
+	s.sponsorLimits = l
+}
+
+// SetDenials records why user ops are refused and lists them under /v1/admin/denials
+func (s *Server) SetDenials(d *paymaster.Denials) {
+	s.denials = d
 }
 
-func NewServer(chainID *big.Int, db *db.DB, n *nostr.Nostr, useropq *queue.Service, evm relay.EVMRequester, pools *ws.ConnectionPools) *Server {
-	return &Server{chainID: chainID, db: db, n: n, evm: evm, pools: pools}
+// SetBans lets operators ban blobs and events under /v1/admin/bans
+func (s *Server) SetBans(b *denylist.Service) {
+	s.bans = b
 }
 
 func (s *Server) Start(port int, handler http.Handler) error {
@@ -0,0 +1,422 @@
+// Package app holds the wiring shared by the binaries of the relay: the configuration, the
+// connection to the chain, the databases, the nostr relay and the services built on top of them.
+//
+// A binary creates an App with the options it needs and wires its own services on top of it,
+// options can be applied later with Use when they depend on services of the binary. Options
+// check that what they build on was set up before them.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/comunifi/relay/internal/api"
+	"github.com/comunifi/relay/internal/blossom"
+	"github.com/comunifi/relay/internal/config"
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/debug"
+	"github.com/comunifi/relay/internal/ethrequest"
+	"github.com/comunifi/relay/internal/faults"
+	"github.com/comunifi/relay/internal/indexer"
+	"github.com/comunifi/relay/internal/nostr"
+	"github.com/comunifi/relay/internal/queue"
+	"github.com/comunifi/relay/internal/signatures"
+	"github.com/comunifi/relay/internal/startup"
+	"github.com/comunifi/relay/internal/ws"
+	"github.com/comunifi/relay/pkg/common"
+	"github.com/fiatjaf/eventstore/postgresql"
+	"github.com/fiatjaf/khatru"
+)
+
+// ErrBlobStorage is returned by WithBlossom when the blob storage can't be reached
+var ErrBlobStorage = errors.New("blob storage is unreachable")
+
+// App is the wiring of a binary, fields are nil until the option that sets them up is applied
+type App struct {
+	ctx context.Context
+
+	Conf    *config.Config
+	Backoff startup.Backoff // dependencies might not be up yet when a binary starts
+	Pubkey  string          // of the relay
+	Pools   *ws.ConnectionPools
+
+	Faults *faults.Injector
+
+	EVM     *ethrequest.EthService
+	ChainID *big.Int
+
+	NDB *postgresql.PostgresBackend
+	DB  *db.DB
+
+	Relay *khatru.Relay
+	Nostr *nostr.Nostr
+
+	Indexer *indexer.Indexer
+	API     *api.Server
+	Blossom *blossom.BlossomService
+
+	closers []func()
+}
+
+// Option sets up a part of an App
+type Option func(a *App) error
+
+// New loads the configuration from an .env file and the environment and applies the options in
+// order
+func New(ctx context.Context, envpath string, opts ...Option) (*App, error) {
+	conf, err := LoadConfig(ctx, envpath)
+	if err != nil {
+		return nil, err
+	}
+
+	pubkey, err := common.PrivateKeyToPublicKey(conf.RelayPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &App{
+		ctx:     ctx,
+		Conf:    conf,
+		Backoff: Backoff(conf),
+		Pubkey:  pubkey,
+		Pools:   ws.NewConnectionPools(),
+	}
+
+	err = a.Use(opts...)
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Use applies options to an App that was already created
+func (a *App) Use(opts ...Option) error {
+	for _, opt := range opts {
+		err := opt(a)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close releases what the options opened, last opened first
+func (a *App) Close() {
+	for _, c := range slices.Backward(a.closers) {
+		c()
+	}
+
+	a.closers = nil
+}
+
+func (a *App) onClose(c func()) {
+	a.closers = append(a.closers, c)
+}
+
+// WithFaults injects the faults of FAULTS into the services that support it, for staging only
+func WithFaults() Option {
+	return func(a *App) error {
+		if a.Conf.Faults == "" {
+			return nil
+		}
+
+		rates, err := faults.ParseRates(a.Conf.Faults)
+		if err != nil {
+			return err
+		}
+
+		a.Faults = faults.New(rates, time.Now().UnixNano())
+		log.Default().Println("WARNING: fault injection enabled, do not run this in production:", a.Faults.String())
+
+		return nil
+	}
+}
+
+// WithChain connects to the rpc node, over websockets when streaming and over http otherwise
+func WithChain(streaming bool) Option {
+	return func(a *App) error {
+		rpcURL := a.Conf.RPCURL
+		if streaming {
+			rpcURL = a.Conf.RPCWSURL
+		}
+
+		evm, chid, err := ConnectEVM(a.ctx, a.Conf, rpcURL, a.Backoff, a.Faults)
+		if err != nil {
+			return err
+		}
+
+		a.EVM = evm
+		a.ChainID = chid
+		a.onClose(evm.Close)
+
+		return nil
+	}
+}
+
+// WithEventStore opens the postgres store of nostr events
+func WithEventStore() Option {
+	return func(a *App) error {
+		log.Default().Println("starting internal db service...")
+
+		ndb, err := OpenEventStore(a.ctx, a.Conf, "postgres", a.Backoff)
+		if err != nil {
+			return err
+		}
+
+		a.NDB = ndb
+		a.onClose(ndb.Close)
+
+		return nil
+	}
+}
+
+// WithDB opens the database of the chain, it needs WithChain
+func WithDB() Option {
+	return func(a *App) error {
+		if a.ChainID == nil {
+			return errors.New("app: the db needs the chain")
+		}
+
+		log.Default().Println("starting internal db service...")
+
+		var d *db.DB
+		err := startup.Retry(a.ctx, "db", a.Backoff, func() error {
+			var err error
+			d, err = db.NewDB(a.ChainID, a.Conf.DBSecret, a.Conf.DBUser, a.Conf.DBPassword, a.Conf.DBName, a.Conf.DBPort, a.Conf.DBHost, a.Conf.DBReaderHost)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		d.SponsorshipDB.SetFaults(a.Faults)
+
+		a.DB = d
+		a.onClose(d.Close)
+
+		return nil
+	}
+}
+
+// WithRelay creates the nostr relay described by the configuration, hooks are registered by the
+// binary
+func WithRelay() Option {
+	return func(a *App) error {
+		relay, _, err := NewRelay(a.Conf)
+		if err != nil {
+			return err
+		}
+
+		a.Relay = relay
+
+		return nil
+	}
+}
+
+// WithNostr creates the service the relay signs and stores its own events with, it needs
+// WithEventStore and WithRelay
+func WithNostr() Option {
+	return func(a *App) error {
+		if a.NDB == nil || a.Relay == nil {
+			return errors.New("app: nostr needs the event store and the relay")
+		}
+
+		a.Nostr = nostr.NewNostr(a.Conf.RelayPrivateKey, a.NDB, a.Relay, a.Conf.RelayUrl)
+
+		return nil
+	}
+}
+
+// WithIndexer creates the indexer of the chain, it is started by the binary. It needs WithDB and
+// WithNostr.
+func WithIndexer(sigs *signatures.Registry) Option {
+	return func(a *App) error {
+		if a.DB == nil || a.Nostr == nil {
+			return errors.New("app: the indexer needs the db and nostr")
+		}
+
+		a.Indexer = indexer.NewIndexer(a.ctx, a.Conf.RelayPrivateKey, a.ChainID, a.DB, a.Nostr, a.EVM, a.Pools, sigs)
+
+		return nil
+	}
+}
+
+// WithAPI creates the api server, its routes are added and it is started by the binary. It needs
+// WithDB and WithNostr.
+func WithAPI(useropq *queue.Service, mempool *queue.Mempool) Option {
+	return func(a *App) error {
+		if a.DB == nil || a.Nostr == nil {
+			return errors.New("app: the api needs the db and nostr")
+		}
+
+		a.API = api.NewServer(a.ChainID, a.DB, a.Nostr, useropq, mempool, a.EVM, a.Pools)
+
+		return nil
+	}
+}
+
+// WithBlossom serves media from the blob storage of the configuration, blobs of groups are kept
+// in the buckets residency assigns them when it isn't nil. It needs WithEventStore and WithRelay,
+// errors wrap ErrBlobStorage when the storage can't be reached.
+func WithBlossom(residency *blossom.ResidencyConfig) Option {
+	return func(a *App) error {
+		if a.NDB == nil || a.Relay == nil {
+			return errors.New("app: blossom needs the event store and the relay")
+		}
+
+		log.Default().Println("starting blossom media service...")
+
+		// blob metadata is kept in a connection of its own
+		blobDB, err := OpenEventStore(a.ctx, a.Conf, "blob metadata db", a.Backoff)
+		if err != nil {
+			return fmt.Errorf("failed to initialize blob metadata database: %w", err)
+		}
+		a.onClose(blobDB.Close)
+
+		cfg := &blossom.BlossomConfig{
+			ServiceURL:      a.Conf.RelayUrl,
+			AWSAccessKeyID:  a.Conf.AWSAccessKeyID,
+			AWSSecretKey:    a.Conf.AWSSecretAccessKey,
+			AWSRegion:       a.Conf.AWSDefaultRegion,
+			AWSEndpointURL:  a.Conf.AWSEndpointUrl,
+			AWSS3BucketName: a.Conf.AWSS3BucketName,
+			Residency:       residency,
+			StripMetadata:   a.Conf.BlobStripMetadata,
+		}
+
+		err = startup.Retry(a.ctx, "s3", a.Backoff, func() error {
+			return blossom.Ping(a.ctx, cfg)
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrBlobStorage, err)
+		}
+
+		// blobDB for blob metadata, and the event store for querying group membership events
+		bs, err := blossom.NewBlossomService(a.ctx, a.Relay, blobDB, a.NDB, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to initialize blossom service: %w", err)
+		}
+		bs.SetFaults(a.Faults)
+
+		a.Blossom = bs
+
+		return nil
+	}
+}
+
+// BlobStorage tells whether the configuration has a bucket to keep blobs in
+func BlobStorage(conf *config.Config) bool {
+	return conf.AWSS3BucketName != "" && conf.AWSAccessKeyID != "" && conf.AWSSecretAccessKey != ""
+}
+
+// LoadConfig loads the configuration from an .env file and the environment and applies its log
+// level
+func LoadConfig(ctx context.Context, envpath string) (*config.Config, error) {
+	conf, err := config.New(ctx, envpath)
+	if err != nil {
+		return nil, err
+	}
+
+	level, err := debug.ParseLevel(conf.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	debug.SetLevel(level)
+
+	return conf, nil
+}
+
+// Backoff returns how long to wait for dependencies that might not be up yet when the relay starts
+func Backoff(conf *config.Config) startup.Backoff {
+	return startup.Backoff{
+		Retries: conf.StartupRetries,
+		Initial: conf.StartupBackoff,
+		Max:     conf.StartupMaxBackoff,
+	}
+}
+
+// ConnectEVM connects to the rpc node and returns the chain it runs, fi can be nil
+func ConnectEVM(ctx context.Context, conf *config.Config, rpcURL string, bo startup.Backoff, fi *faults.Injector) (*ethrequest.EthService, *big.Int, error) {
+	var evm *ethrequest.EthService
+	var chid *big.Int
+	err := startup.Retry(ctx, "rpc", bo, func() error {
+		var err error
+		evm, err = ethrequest.NewEthService(ctx, rpcURL)
+		if err != nil {
+			return err
+		}
+
+		evm.SetBreaker(ethrequest.NewBreaker(conf.RPCBreakerThreshold, conf.RPCBreakerCooldown))
+		evm.SetFaults(fi)
+
+		chid, err = evm.ChainID()
+		if err != nil {
+			evm.Close()
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Default().Println("node running for chain: ", chid.String())
+
+	return evm, chid, nil
+}
+
+// DatabaseURL is the url of the postgres database
+func DatabaseURL(conf *config.Config) string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", conf.DBUser, conf.DBPassword, conf.DBHost, conf.DBPort, conf.DBName)
+}
+
+// OpenEventStore opens the postgres store of nostr events, name tells the stores apart in the logs
+func OpenEventStore(ctx context.Context, conf *config.Config, name string, bo startup.Backoff) (*postgresql.PostgresBackend, error) {
+	ndb := &postgresql.PostgresBackend{
+		DatabaseURL: DatabaseURL(conf),
+	}
+
+	err := startup.Retry(ctx, name, bo, ndb.Init)
+	if err != nil {
+		return nil, err
+	}
+
+	return ndb, nil
+}
+
+// NewRelay creates the nostr relay described by the configuration, it returns the public key of
+// the relay
+func NewRelay(conf *config.Config) (*khatru.Relay, string, error) {
+	pubkey, err := common.PrivateKeyToPublicKey(conf.RelayPrivateKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	relay := khatru.NewRelay()
+
+	relay.Info.Name = conf.RelayInfoName
+	relay.Info.PubKey = pubkey
+	relay.Info.Description = conf.RelayInfoDescription
+	relay.Info.Icon = conf.RelayInfoIcon
+
+	return relay, pubkey, nil
+}
+
+// UseEventStore stores and queries the events of the relay in an event store, for binaries that
+// don't register the hooks of the full relay
+func UseEventStore(relay *khatru.Relay, ndb *postgresql.PostgresBackend) {
+	relay.StoreEvent = append(relay.StoreEvent, ndb.SaveEvent)
+	relay.QueryEvents = append(relay.QueryEvents, ndb.QueryEvents)
+	relay.CountEvents = append(relay.CountEvents, ndb.CountEvents)
+	relay.DeleteEvent = append(relay.DeleteEvent, ndb.DeleteEvent)
+	relay.ReplaceEvent = append(relay.ReplaceEvent, ndb.ReplaceEvent)
+}
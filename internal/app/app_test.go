@@ -0,0 +1,42 @@
+package app
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/comunifi/relay/internal/config"
+)
+
+func TestOptionsNeedTheirDependencies(t *testing.T) {
+	a := &App{ctx: context.Background(), Conf: &config.Config{}}
+
+	for name, opt := range map[string]Option{
+		"db":      WithDB(),
+		"nostr":   WithNostr(),
+		"indexer": WithIndexer(nil),
+		"api":     WithAPI(nil, nil),
+		"blossom": WithBlossom(nil),
+	} {
+		err := a.Use(opt)
+		if err == nil {
+			t.Errorf("expected %s to fail without its dependencies", name)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	a := &App{}
+
+	closed := []int{}
+	for i := range 3 {
+		a.onClose(func() { closed = append(closed, i) })
+	}
+
+	a.Close()
+	a.Close()
+
+	if !slices.Equal(closed, []int{2, 1, 0}) {
+		t.Fatalf("expected the last opened to be closed first and once, got %v", closed)
+	}
+}
@@ -0,0 +1,387 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/faults"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/eventstore/postgresql"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type RecordType string
+
+const (
+	RecordMeta         RecordType = "meta"
+	RecordEvent        RecordType = "event"
+	RecordSponsor      RecordType = "sponsor"
+	RecordRegistration RecordType = "registration"
+	RecordFactory      RecordType = "factory"
+)
+
+type Meta struct {
+	ChainID   string    `json:"chain_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Record is a single line of a backup, only the field matching its type is set
+type Record struct {
+	Type         RecordType            `json:"type"`
+	Meta         *Meta                 `json:"meta,omitempty"`
+	Event        *nostr.Event          `json:"event,omitempty"`
+	Sponsor      *relay.Sponsor        `json:"sponsor,omitempty"`
+	Registration *relay.Event          `json:"registration,omitempty"`
+	Factory      *relay.AccountFactory `json:"factory,omitempty"`
+}
+
+type Stats struct {
+	Events        int `json:"events"`
+	Sponsors      int `json:"sponsors"`
+	Registrations int `json:"registrations"`
+	Factories     int `json:"factories"`
+	Skipped       int `json:"skipped"`
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("%d events, %d sponsors, %d registrations, %d factories, %d skipped", s.Events, s.Sponsors, s.Registrations, s.Factories, s.Skipped)
+}
+
+// Writer writes records as gzipped json lines, encrypted with the backup key
+type Writer struct {
+	enc *encrypter
+	gz  *gzip.Writer
+	js  *json.Encoder
+}
+
+func NewWriter(w io.Writer, key string) (*Writer, error) {
+	enc, err := newEncrypter(w, key)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(enc)
+
+	return &Writer{
+		enc: enc,
+		gz:  gz,
+		js:  json.NewEncoder(gz),
+	}, nil
+}
+
+func (w *Writer) Write(r *Record) error {
+	return w.js.Encode(r)
+}
+
+// Close flushes the remaining records, the backup is incomplete until it is called
+func (w *Writer) Close() error {
+	err := w.gz.Close()
+	if err != nil {
+		return err
+	}
+
+	return w.enc.Close()
+}
+
+// Reader reads the records written by a Writer
+type Reader struct {
+	gz *gzip.Reader
+	js *json.Decoder
+}
+
+func NewReader(r io.Reader, key string) (*Reader, error) {
+	dec, err := newDecrypter(r, key)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		gz: gz,
+		js: json.NewDecoder(gz),
+	}, nil
+}
+
+// Next returns the next record or io.EOF once the backup was read completely
+func (r *Reader) Next() (*Record, error) {
+	var rec Record
+	err := r.js.Decode(&rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rec, nil
+}
+
+type Config struct {
+	AWSAccessKeyID  string
+	AWSSecretKey    string
+	AWSRegion       string
+	AWSEndpointURL  string
+	AWSS3BucketName string
+	Prefix          string
+	Key             string
+	Interval        time.Duration
+}
+
+// Backuper periodically dumps the nostr events, sponsors, event registrations and account
+// factories of a chain to S3
+type Backuper struct {
+	ctx     context.Context
+	chainID string
+	db      *db.DB
+	ndb     *postgresql.PostgresBackend
+	s3      *s3.Client
+	config  *Config
+	w       relay.WebhookMessager
+	faults  *faults.Injector
+}
+
+func NewBackuper(ctx context.Context, chainID string, d *db.DB, ndb *postgresql.PostgresBackend, cfg *Config, w relay.WebhookMessager) (*Backuper, error) {
+	if cfg.Key == "" {
+		return nil, errors.New("backup key is required")
+	}
+
+	client, err := NewS3Client(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backuper{
+		ctx:     ctx,
+		chainID: chainID,
+		db:      d,
+		ndb:     ndb,
+		s3:      client,
+		config:  cfg,
+		w:       w,
+	}, nil
+}
+
+func NewS3Client(ctx context.Context, cfg *Config) (*s3.Client, error) {
+	creds := credentials.NewStaticCredentialsProvider(cfg.AWSAccessKeyID, cfg.AWSSecretKey, "")
+
+	awsCfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(cfg.AWSRegion),
+		config.WithCredentialsProvider(creds),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.AWSEndpointURL != "" {
+			o.BaseEndpoint = aws.String(cfg.AWSEndpointURL)
+			o.UsePathStyle = true // Required for most S3-compatible services
+		}
+	}), nil
+}
+
+// SetFaults sets the injector that randomly fails uploads, for testing only
+func (b *Backuper) SetFaults(f *faults.Injector) {
+	b.faults = f
+}
+
+// Start uploads a backup every interval
+func (b *Backuper) Start() error {
+	log.Default().Println("starting backups")
+
+	ticker := time.NewTicker(b.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			log.Default().Println("stopping backups")
+			return nil
+		case <-ticker.C:
+			key, stats, err := b.Run()
+			if err != nil {
+				log.Default().Println("error backing up:", err)
+				b.w.NotifyError(b.ctx, err)
+				continue
+			}
+
+			b.w.Notify(b.ctx, fmt.Sprintf("backup %s uploaded: %s", key, stats))
+		}
+	}
+}
+
+// Run dumps the db to a temporary file and uploads it, it returns the key of the backup
+func (b *Backuper) Run() (string, *Stats, error) {
+	f, err := os.CreateTemp("", "relay-backup-*")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	stats, err := b.Dump(f)
+	if err != nil {
+		return "", nil, err
+	}
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := fmt.Sprintf("%s/%s/%s.bak", b.config.Prefix, b.chainID, time.Now().UTC().Format("20060102T150405Z"))
+
+	if err := b.faults.Fail(faults.S3Put); err != nil {
+		return "", nil, fmt.Errorf("failed to upload backup: %w", err)
+	}
+
+	_, err = b.s3.PutObject(b.ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(b.config.AWSS3BucketName),
+		Key:           aws.String(key),
+		Body:          f,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String("application/octet-stream"),
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to upload backup: %w", err)
+	}
+
+	return key, stats, nil
+}
+
+// Dump writes a full backup to w
+func (b *Backuper) Dump(w io.Writer) (*Stats, error) {
+	bw, err := NewWriter(w, b.config.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bw.Write(&Record{Type: RecordMeta, Meta: &Meta{ChainID: b.chainID, CreatedAt: time.Now().UTC()}})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+
+	// nostr events, this includes the blob index
+	rows, err := b.ndb.DB.QueryContext(b.ctx, `SELECT id, pubkey, created_at, kind, tags, content, sig FROM event ORDER BY created_at ASC, id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var evt nostr.Event
+		var timestamp int64
+		err = rows.Scan(&evt.ID, &evt.PubKey, &timestamp, &evt.Kind, &evt.Tags, &evt.Content, &evt.Sig)
+		if err != nil {
+			return nil, err
+		}
+		evt.CreatedAt = nostr.Timestamp(timestamp)
+
+		err = bw.Write(&Record{Type: RecordEvent, Event: &evt})
+		if err != nil {
+			return nil, err
+		}
+		stats.Events++
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	sponsors, err := b.db.SponsorDB.GetSponsors()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sponsor := range sponsors {
+		err = bw.Write(&Record{Type: RecordSponsor, Sponsor: sponsor})
+		if err != nil {
+			return nil, err
+		}
+		stats.Sponsors++
+	}
+
+	registrations, err := b.db.EventDB.GetEvents(b.chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, registration := range registrations {
+		err = bw.Write(&Record{Type: RecordRegistration, Registration: registration})
+		if err != nil {
+			return nil, err
+		}
+		stats.Registrations++
+	}
+
+	factories, err := b.db.FactoryDB.GetFactories()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, factory := range factories {
+		err = bw.Write(&Record{Type: RecordFactory, Factory: factory})
+		if err != nil {
+			return nil, err
+		}
+		stats.Factories++
+	}
+
+	err = bw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// Latest returns the key of the most recent backup of a chain
+func Latest(ctx context.Context, client *s3.Client, bucket, prefix, chainID string) (string, error) {
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(fmt.Sprintf("%s/%s/", prefix, chainID)),
+	})
+
+	keys := []string{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+
+	if len(keys) == 0 {
+		return "", fmt.Errorf("no backups found for chain %s", chainID)
+	}
+
+	// keys end with a sortable timestamp
+	sort.Strings(keys)
+
+	return keys[len(keys)-1], nil
+}
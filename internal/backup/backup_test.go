@@ -0,0 +1,221 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func writeBackup(t *testing.T, key string, records ...*Record) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range records {
+		err = w.Write(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	records := []*Record{
+		{Type: RecordMeta, Meta: &Meta{ChainID: "100"}},
+		{Type: RecordSponsor, Sponsor: &relay.Sponsor{Contract: "0xpm", PrivateKey: "secret"}},
+	}
+
+	// enough events to span several chunks
+	for i := 0; i < 2000; i++ {
+		records = append(records, &Record{Type: RecordEvent, Event: &nostr.Event{Kind: 1, Content: strings.Repeat("x", 100) + strconv.Itoa(i)}})
+	}
+
+	data := writeBackup(t, "key", records...)
+
+	if bytes.Contains(data, []byte("secret")) {
+		t.Fatal("backup is not encrypted")
+	}
+
+	r, err := NewReader(bytes.NewReader(data), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rec.Type != records[n].Type {
+			t.Fatalf("record %d: expected %s, got %s", n, records[n].Type, rec.Type)
+		}
+		n++
+	}
+
+	if n != len(records) {
+		t.Fatalf("expected %d records, got %d", len(records), n)
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	data := writeBackup(t, "key", &Record{Type: RecordMeta, Meta: &Meta{ChainID: "100"}})
+
+	_, err := NewReader(bytes.NewReader(data), "other")
+	if err == nil {
+		t.Fatal("expected an error with the wrong key")
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	// random content doesn't compress, the backup spans several chunks
+	records := []*Record{}
+	for i := 0; i < 2000; i++ {
+		content := make([]byte, 100)
+		_, err := rand.Read(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		records = append(records, &Record{Type: RecordEvent, Event: &nostr.Event{Content: hex.EncodeToString(content)}})
+	}
+
+	data := writeBackup(t, "key", records...)
+
+	// cut the last chunk
+	r, err := NewReader(bytes.NewReader(data[:len(data)-10]), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		_, err = r.Next()
+		if err != nil {
+			break
+		}
+	}
+
+	if err == io.EOF {
+		t.Fatal("expected a truncated backup to fail")
+	}
+}
+
+func TestNotABackup(t *testing.T) {
+	_, err := NewReader(strings.NewReader("hello"), "key")
+	if !errors.Is(err, ErrNotABackup) {
+		t.Fatalf("expected ErrNotABackup, got %v", err)
+	}
+}
+
+type memBlobs map[string][]byte
+
+func (m memBlobs) Open(ctx context.Context, hash string) (io.ReadCloser, error) {
+	b, ok := m[hash]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func blobIndex(hash string) *nostr.Event {
+	pubkey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	evt := &nostr.Event{
+		PubKey: pubkey,
+		Kind:   blobIndexKind,
+		Tags:   nostr.Tags{{"x", hash}, {"type", "image/png"}, {"size", "5"}},
+	}
+	evt.ID = evt.GetID()
+
+	return evt
+}
+
+func TestVerifyEvent(t *testing.T) {
+	content := []byte("hello")
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	signed := &nostr.Event{Kind: 1, Content: "hi", CreatedAt: nostr.Now()}
+	err := signed.Sign(nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := *signed
+	tampered.Content = "bye"
+
+	corrupted := blobIndex(hash)
+
+	tests := []struct {
+		name  string
+		evt   *nostr.Event
+		blobs BlobStore
+		ok    bool
+	}{
+		{"signed", signed, nil, true},
+		{"tampered", &tampered, nil, false},
+		{"blob index", blobIndex(hash), nil, true},
+		{"blob index bad hash", blobIndex("nothex"), nil, false},
+		{"blob index bad id", func() *nostr.Event { e := blobIndex(hash); e.Tags = append(e.Tags, nostr.Tag{"t", "x"}); return e }(), nil, false},
+		{"blob content", blobIndex(hash), memBlobs{hash: content}, true},
+		{"blob content mismatch", corrupted, memBlobs{hash: []byte("other")}, false},
+		{"blob missing", blobIndex(hash), memBlobs{}, false},
+	}
+
+	for _, tt := range tests {
+		r := &Restorer{ctx: context.Background(), blobs: tt.blobs}
+
+		err := r.verifyEvent(tt.evt)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: expected ok %v, got %v", tt.name, tt.ok, err)
+		}
+	}
+
+	// a blob the relay rewrote is checked against the hash of its stored content
+	stripped := []byte("hello without metadata")
+	strippedSum := sha256.Sum256(stripped)
+
+	r := &Restorer{ctx: context.Background(), blobs: memBlobs{hash: stripped}}
+	r.SetRewrites(memRewrites{hash: hex.EncodeToString(strippedSum[:])})
+
+	err = r.verifyEvent(blobIndex(hash))
+	if err != nil {
+		t.Errorf("expected the rewritten blob to be verified, got %v", err)
+	}
+}
+
+type memRewrites map[string]string
+
+func (m memRewrites) ContentHash(hash string) (string, error) {
+	if content, ok := m[hash]; ok {
+		return content, nil
+	}
+
+	return hash, nil
+}
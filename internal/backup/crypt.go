@@ -0,0 +1,209 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// a backup is a header followed by sealed chunks, each chunk is prefixed by its length and
+// the last one is flagged so that a truncated backup can't be mistaken for a complete one
+const (
+	magic     = "RLYBAK1\n"
+	chunkSize = 64 * 1024
+)
+
+var (
+	ErrNotABackup = errors.New("not a relay backup")
+	ErrTruncated  = errors.New("backup is truncated")
+)
+
+func newAEAD(key string) (cipher.AEAD, error) {
+	if key == "" {
+		return nil, errors.New("backup key is required")
+	}
+
+	k := sha256.Sum256([]byte(key))
+
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypter seals everything written to it in chunks, Close must be called to write the last chunk
+type encrypter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix [4]byte
+	n      uint64
+	buf    []byte
+}
+
+func newEncrypter(w io.Writer, key string) (*encrypter, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &encrypter{
+		w:    w,
+		aead: aead,
+		buf:  make([]byte, 0, chunkSize),
+	}
+
+	_, err = rand.Read(e.prefix[:])
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(append([]byte(magic), e.prefix[:]...))
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *encrypter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+
+		if len(e.buf) == cap(e.buf) {
+			err := e.seal(false)
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (e *encrypter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encrypter) seal(last bool) error {
+	sealed := e.aead.Seal(nil, e.nonce(), e.buf, chunkAD(last))
+	e.n++
+	e.buf = e.buf[:0]
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(sealed)))
+
+	_, err := e.w.Write(append(size[:], sealed...))
+	return err
+}
+
+func (e *encrypter) nonce() []byte {
+	nonce := make([]byte, e.aead.NonceSize())
+	copy(nonce, e.prefix[:])
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], e.n)
+
+	return nonce
+}
+
+// decrypter opens the chunks written by an encrypter, a chunk that was tampered with or
+// a backup that ends before its last chunk is an error
+type decrypter struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	prefix [4]byte
+	n      uint64
+	buf    []byte
+	done   bool
+}
+
+func newDecrypter(r io.Reader, key string) (*decrypter, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decrypter{
+		r:    bufio.NewReader(r),
+		aead: aead,
+	}
+
+	header := make([]byte, len(magic)+len(d.prefix))
+	_, err = io.ReadFull(d.r, header)
+	if err != nil || string(header[:len(magic)]) != magic {
+		return nil, ErrNotABackup
+	}
+
+	copy(d.prefix[:], header[len(magic):])
+
+	return d, nil
+}
+
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		err := d.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+
+	return n, nil
+}
+
+func (d *decrypter) open() error {
+	var size [4]byte
+	_, err := io.ReadFull(d.r, size[:])
+	if err != nil {
+		return ErrTruncated
+	}
+
+	sealed := make([]byte, binary.BigEndian.Uint32(size[:]))
+	_, err = io.ReadFull(d.r, sealed)
+	if err != nil {
+		return ErrTruncated
+	}
+
+	nonce := make([]byte, d.aead.NonceSize())
+	copy(nonce, d.prefix[:])
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], d.n)
+
+	// try as a regular chunk first, then as the last one
+	plain, err := d.aead.Open(nil, nonce, sealed, chunkAD(false))
+	if err != nil {
+		plain, err = d.aead.Open(nil, nonce, sealed, chunkAD(true))
+		if err != nil {
+			return errors.New("unable to decrypt backup, wrong key or corrupted data")
+		}
+
+		d.done = true
+	}
+
+	d.n++
+	d.buf = plain
+
+	return nil
+}
+
+func chunkAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+
+	return []byte{0}
+}
@@ -0,0 +1,285 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/comunifi/relay/internal/db"
+	"github.com/fiatjaf/eventstore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// kind of the unsigned events khatru uses to index blossom blobs
+const blobIndexKind = 24242
+
+// BlobStore gives access to the content of the blobs referenced by the blob index
+type BlobStore interface {
+	Open(ctx context.Context, sha256 string) (io.ReadCloser, error)
+}
+
+// Rewrites tells the hash of the content stored for a blob, which differs from the hash of the
+// blob when the relay rewrote it, e.g. to strip the metadata of an image
+type Rewrites interface {
+	ContentHash(sha256 string) (string, error)
+}
+
+// Restorer replays a backup into a database, records that can't be verified are skipped
+type Restorer struct {
+	ctx     context.Context
+	chainID string
+	db      *db.DB
+	ndb     eventstore.Store
+	blobs   BlobStore
+	rw      Rewrites
+}
+
+// NewRestorer creates a restorer, blobs is optional and the content of the blobs is only
+// verified when it is set
+func NewRestorer(ctx context.Context, chainID string, d *db.DB, ndb eventstore.Store, blobs BlobStore) *Restorer {
+	return &Restorer{
+		ctx:     ctx,
+		chainID: chainID,
+		db:      d,
+		ndb:     ndb,
+		blobs:   blobs,
+	}
+}
+
+// SetRewrites verifies the blobs the relay rewrote against the hash of their stored content
+func (r *Restorer) SetRewrites(rw Rewrites) {
+	r.rw = rw
+}
+
+// Restore reads a backup and writes its records to the database
+func (r *Restorer) Restore(src io.Reader, key string) (*Stats, error) {
+	br, err := NewReader(src, key)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+
+	for {
+		rec, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		switch rec.Type {
+		case RecordMeta:
+			if rec.Meta == nil || rec.Meta.ChainID != r.chainID {
+				return stats, fmt.Errorf("backup is not for chain %s", r.chainID)
+			}
+		case RecordEvent:
+			if rec.Event == nil {
+				stats.Skipped++
+				continue
+			}
+
+			err = r.verifyEvent(rec.Event)
+			if err != nil {
+				log.Default().Printf("skipping event %s: %s", rec.Event.ID, err)
+				stats.Skipped++
+				continue
+			}
+
+			err = r.ndb.SaveEvent(r.ctx, rec.Event)
+			if err != nil && !errors.Is(err, eventstore.ErrDupEvent) {
+				return stats, err
+			}
+			stats.Events++
+		case RecordSponsor:
+			if rec.Sponsor == nil {
+				stats.Skipped++
+				continue
+			}
+
+			err = r.db.SponsorDB.AddSponsor(rec.Sponsor)
+			if err != nil {
+				// already there, keep the key from the backup
+				err = r.db.SponsorDB.UpdateSponsor(rec.Sponsor)
+				if err != nil {
+					return stats, err
+				}
+			}
+			stats.Sponsors++
+		case RecordRegistration:
+			ev := rec.Registration
+			if ev == nil || ev.ChainID != r.chainID {
+				stats.Skipped++
+				continue
+			}
+
+			err = r.db.EventDB.AddEvent(ev.ChainID, ev.Contract, ev.Topic, ev.Alias, ev.EventSignature, ev.Name, ev.GroupID)
+			if err != nil {
+				return stats, err
+			}
+
+			if ev.ABI != "" {
+				err = r.db.EventDB.SetEventABI(ev.ChainID, ev.Contract, ev.Topic, ev.ABI)
+				if err != nil {
+					return stats, err
+				}
+			}
+			stats.Registrations++
+		case RecordFactory:
+			if rec.Factory == nil {
+				stats.Skipped++
+				continue
+			}
+
+			err = r.db.FactoryDB.SetFactory(rec.Factory)
+			if err != nil {
+				return stats, err
+			}
+			stats.Factories++
+		default:
+			stats.Skipped++
+		}
+	}
+
+	return stats, nil
+}
+
+// verifyEvent checks the signature of an event, blob index entries are not signed so their id
+// is checked instead, along with the hash of the blob when a blob store is set
+func (r *Restorer) verifyEvent(evt *nostr.Event) error {
+	if evt.Kind == blobIndexKind && evt.Sig == "" {
+		if evt.ID != evt.GetID() {
+			return errors.New("invalid blob index id")
+		}
+
+		x := evt.Tags.Find("x")
+		if x == nil || !isSHA256(x[1]) {
+			return errors.New("invalid blob hash")
+		}
+
+		if r.blobs == nil {
+			return nil
+		}
+
+		return VerifyBlob(r.ctx, r.blobs, r.rw, x[1])
+	}
+
+	ok, err := evt.CheckSignature()
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+// VerifyBlob checks that the content of a blob matches its sha256, or the hash of the content
+// the relay stored for it when rw is set
+func VerifyBlob(ctx context.Context, blobs BlobStore, rw Rewrites, hash string) error {
+	content := hash
+	if rw != nil {
+		var err error
+		content, err = rw.ContentHash(hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	rc, err := blobs.Open(ctx, hash)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, rc)
+	if err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != content {
+		return errors.New("blob content does not match its hash")
+	}
+
+	return nil
+}
+
+func isSHA256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size
+}
+
+// S3Blobs reads the blobs stored by the blossom service
+type S3Blobs struct {
+	s3     *s3.Client
+	bucket string
+	keys   map[string]string
+}
+
+func NewS3Blobs(client *s3.Client, bucket string) *S3Blobs {
+	return &S3Blobs{
+		s3:     client,
+		bucket: bucket,
+	}
+}
+
+func (b *S3Blobs) Open(ctx context.Context, hash string) (io.ReadCloser, error) {
+	if b.keys == nil {
+		err := b.index(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key, ok := b.keys[hash]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not found", hash)
+	}
+
+	result, err := b.s3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Body, nil
+}
+
+// index lists the blobs once, they are stored under blobs/{sha256} or blobs/{group}/{sha256}
+func (b *S3Blobs) index(ctx context.Context) error {
+	keys := map[string]string{}
+
+	paginator := s3.NewListObjectsV2Paginator(b.s3, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String("blobs/"),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			keys[key[strings.LastIndex(key, "/")+1:]] = key
+		}
+	}
+
+	b.keys = keys
+
+	return nil
+}
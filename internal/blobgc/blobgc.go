@@ -0,0 +1,257 @@
+// Package blobgc deletes the blobs no stored event references anymore.
+//
+// The Tracker records which blobs events reference, in imeta tags, media url tags, urls in the
+// content and the pictures of profiles. References are dropped when the event is deleted, when a
+// group admin deletes it from a group or when the group itself is deleted.
+//
+// The Collector then deletes, for every owner, the blobs that have no reference left once the grace
+// period since their upload is over, so that a blob uploaded just before the event that uses it is
+// kept. Blobs uploaded before references were tracked are never collected, the events that use them
+// may not have been seen. A dry run reports the blobs it would delete without deleting them.
+package blobgc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/khatru/blossom"
+)
+
+// Blobs lists and removes the indexed blobs
+type Blobs interface {
+	IndexedBlobs(ctx context.Context, since, until time.Time) ([]blossom.BlobDescriptor, error)
+	UploadedBefore(ctx context.Context, shas []string, t time.Time) ([]string, error)
+	RemoveBlob(ctx context.Context, sha256 string) error
+}
+
+type Config struct {
+	Interval time.Duration
+	Grace    time.Duration // blobs younger than this are kept
+	DryRun   bool          // scheduled runs only report
+}
+
+// Orphan is a blob no event references
+type Orphan struct {
+	SHA256   string    `json:"sha256"`
+	Owners   []string  `json:"owners"`
+	Size     int       `json:"size"`
+	Type     string    `json:"type"`
+	Uploaded time.Time `json:"uploaded"`
+}
+
+type Report struct {
+	RanAt    time.Time `json:"ran_at"`
+	Duration float64   `json:"duration"` // seconds
+	DryRun   bool      `json:"dry_run"`
+	Scanned  int       `json:"scanned"`
+	Orphans  []*Orphan `json:"orphans"`
+	Deleted  int       `json:"deleted"`
+	Bytes    int64     `json:"bytes"` // size of the orphans
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+// Collector periodically deletes the blobs no event references
+type Collector struct {
+	ctx   context.Context
+	db    *db.DB
+	blobs Blobs
+	w     relay.WebhookMessager
+
+	config *Config
+
+	mu   sync.Mutex
+	last *Report
+
+	now func() time.Time
+}
+
+// NewCollector creates a collector, blobs may be nil while media is disabled
+func NewCollector(ctx context.Context, d *db.DB, blobs Blobs, cfg *Config, w relay.WebhookMessager) *Collector {
+	return &Collector{
+		ctx:    ctx,
+		db:     d,
+		blobs:  blobs,
+		w:      w,
+		config: cfg,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// SetBlobs sets the blob storage once media is enabled
+func (c *Collector) SetBlobs(b Blobs) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.blobs = b
+}
+
+// Start runs a collection every interval
+func (c *Collector) Start() error {
+	log.Default().Println("starting blob garbage collector")
+
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			log.Default().Println("stopping blob garbage collector")
+			return nil
+		case <-ticker.C:
+			report := c.Run(c.config.DryRun)
+
+			for _, e := range report.Errors {
+				c.w.NotifyError(c.ctx, fmt.Errorf("blob garbage collection: %s", e))
+			}
+		}
+	}
+}
+
+// Run deletes the unreferenced blobs past the grace period, or only reports them on a dry run, the
+// report is kept as the latest one
+func (c *Collector) Run(dryRun bool) *Report {
+	start := time.Now()
+
+	report := &Report{
+		RanAt:   c.now(),
+		DryRun:  dryRun,
+		Orphans: []*Orphan{},
+	}
+
+	err := c.collect(report)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	report.Duration = time.Since(start).Seconds()
+
+	c.mu.Lock()
+	c.last = report
+	c.mu.Unlock()
+
+	return report
+}
+
+// Last returns the report of the latest run, nil if none ran yet
+func (c *Collector) Last() *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.last
+}
+
+func (c *Collector) collect(report *Report) error {
+	c.mu.Lock()
+	blobs := c.blobs
+	c.mu.Unlock()
+
+	if blobs == nil {
+		return fmt.Errorf("media is disabled")
+	}
+
+	since, err := c.db.BlobRefDB.TrackingSince()
+	if err != nil {
+		return err
+	}
+
+	indexed, err := blobs.IndexedBlobs(c.ctx, since, report.RanAt.Add(-c.config.Grace))
+	if err != nil {
+		return err
+	}
+
+	orphans, err := c.orphans(indexed)
+	if err != nil {
+		return err
+	}
+
+	// an owner may have uploaded the same blob before references were tracked, for events that
+	// were never seen
+	orphans, err = c.tracked(blobs, orphans, since)
+	if err != nil {
+		return err
+	}
+
+	report.Scanned = len(indexed)
+	report.Orphans = orphans
+
+	for _, o := range orphans {
+		report.Bytes += int64(o.Size)
+
+		if report.DryRun {
+			continue
+		}
+
+		err = blobs.RemoveBlob(c.ctx, o.SHA256)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", o.SHA256, err))
+			continue
+		}
+		report.Deleted++
+	}
+
+	return nil
+}
+
+// orphans returns the indexed blobs no event references, with all their owners
+func (c *Collector) orphans(indexed []blossom.BlobDescriptor) ([]*Orphan, error) {
+	bySHA := map[string]*Orphan{}
+	shas := []string{}
+	for _, bd := range indexed {
+		o, ok := bySHA[bd.SHA256]
+		if !ok {
+			o = &Orphan{
+				SHA256:   bd.SHA256,
+				Owners:   []string{},
+				Size:     bd.Size,
+				Type:     bd.Type,
+				Uploaded: bd.Uploaded.Time().UTC(),
+			}
+			bySHA[bd.SHA256] = o
+			shas = append(shas, bd.SHA256)
+		}
+		o.Owners = append(o.Owners, bd.Owner)
+	}
+
+	if len(shas) == 0 {
+		return []*Orphan{}, nil
+	}
+
+	unreferenced, err := c.db.BlobRefDB.GetUnreferenced(shas)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := []*Orphan{}
+	for _, sha := range unreferenced {
+		orphans = append(orphans, bySHA[sha])
+	}
+
+	return orphans, nil
+}
+
+// tracked leaves out the orphans that an owner uploaded before references were tracked
+func (c *Collector) tracked(blobs Blobs, orphans []*Orphan, since time.Time) ([]*Orphan, error) {
+	if len(orphans) == 0 {
+		return orphans, nil
+	}
+
+	shas := []string{}
+	for _, o := range orphans {
+		shas = append(shas, o.SHA256)
+	}
+
+	untracked, err := blobs.UploadedBefore(c.ctx, shas, since)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(orphans, func(o *Orphan) bool {
+		return slices.Contains(untracked, o.SHA256)
+	}), nil
+}
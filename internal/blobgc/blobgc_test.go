@@ -0,0 +1,178 @@
+package blobgc
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/fiatjaf/khatru/blossom"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+var (
+	shaA = strings.Repeat("a", 64)
+	shaB = strings.Repeat("b", 64)
+	shaC = strings.Repeat("c", 64)
+	shaD = strings.Repeat("d", 64)
+)
+
+func TestBlobRefs(t *testing.T) {
+	for name, tc := range map[string]struct {
+		ev   *nostr.Event
+		shas []string
+	}{
+		"imeta": {
+			ev:   &nostr.Event{Kind: 9, Tags: nostr.Tags{{"imeta", "url https://relay.example/" + shaA + ".png", "m image/png", "x " + shaB}}},
+			shas: []string{shaA, shaB},
+		},
+		"url tags": {
+			ev:   &nostr.Event{Kind: groups.KindEditMetadata, Tags: nostr.Tags{{"h", "demo"}, {"picture", "https://relay.example/" + shaA}, {"url", "https://example.com/page"}}},
+			shas: []string{shaA},
+		},
+		"content": {
+			ev:   &nostr.Event{Kind: 9, Content: "look https://relay.example/" + shaC + ".jpg and https://relay.example/" + shaC},
+			shas: []string{shaC},
+		},
+		"profile": {
+			ev:   &nostr.Event{Kind: nostr.KindProfileMetadata, Content: `{"name":"alice","picture":"https://relay.example/` + shaA + `.png?size=64","banner":"https://cdn.example/banner.png"}`},
+			shas: []string{shaA},
+		},
+		"no media": {
+			ev:   &nostr.Event{Kind: 9, Content: "hello", Tags: nostr.Tags{{"h", "demo"}, {"imeta", "x nothex"}}},
+			shas: []string{},
+		},
+	} {
+		if shas := BlobRefs(tc.ev); !slices.Equal(shas, tc.shas) {
+			t.Errorf("%s: expected %v, got %v", name, tc.shas, shas)
+		}
+	}
+}
+
+type fakeBlobs struct {
+	indexed []blossom.BlobDescriptor
+	removed []string
+}
+
+func (b *fakeBlobs) IndexedBlobs(ctx context.Context, since, until time.Time) ([]blossom.BlobDescriptor, error) {
+	blobs := []blossom.BlobDescriptor{}
+	for _, bd := range b.indexed {
+		uploaded := bd.Uploaded.Time()
+		if !uploaded.Before(since) && !uploaded.After(until) {
+			blobs = append(blobs, bd)
+		}
+	}
+
+	return blobs, nil
+}
+
+func (b *fakeBlobs) UploadedBefore(ctx context.Context, shas []string, t time.Time) ([]string, error) {
+	uploaded := []string{}
+	for _, bd := range b.indexed {
+		if slices.Contains(shas, bd.SHA256) && bd.Uploaded.Time().Before(t) && !slices.Contains(uploaded, bd.SHA256) {
+			uploaded = append(uploaded, bd.SHA256)
+		}
+	}
+
+	return uploaded, nil
+}
+
+func (b *fakeBlobs) RemoveBlob(ctx context.Context, sha256 string) error {
+	b.removed = append(b.removed, sha256)
+	return nil
+}
+
+func TestCollector(t *testing.T) {
+	d := testutil.NewDB(t)
+	ctx := context.Background()
+
+	since, err := d.BlobRefDB.TrackingSince()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := since.Add(10 * 24 * time.Hour)
+	ts := func(t time.Time) nostr.Timestamp { return nostr.Timestamp(t.Unix()) }
+
+	b := &fakeBlobs{indexed: []blossom.BlobDescriptor{
+		{SHA256: shaA, Owner: "alice", Size: 10, Uploaded: ts(now.Add(-5 * 24 * time.Hour))},
+		{SHA256: shaA, Owner: "bob", Size: 10, Uploaded: ts(now.Add(-4 * 24 * time.Hour))},
+		{SHA256: shaB, Owner: "alice", Size: 20, Uploaded: ts(now.Add(-5 * 24 * time.Hour))},
+		// within the grace period
+		{SHA256: shaC, Owner: "alice", Size: 30, Uploaded: ts(now.Add(-time.Hour))},
+		// uploaded before references were tracked
+		{SHA256: shaD, Owner: "alice", Size: 40, Uploaded: ts(since.Add(-time.Hour))},
+	}}
+
+	tr := NewTracker(d)
+
+	msg := &nostr.Event{ID: "msg", Kind: 9, CreatedAt: ts(now.Add(-5 * 24 * time.Hour)), Tags: nostr.Tags{{"h", "demo"}, {"imeta", "url https://relay.example/" + shaA + ".png"}}}
+	other := &nostr.Event{ID: "other", Kind: 9, CreatedAt: ts(now.Add(-5 * 24 * time.Hour)), Tags: nostr.Tags{{"h", "demo"}, {"imeta", "x " + shaB}}}
+	tr.onEventSaved(ctx, msg)
+	tr.onEventSaved(ctx, other)
+
+	c := NewCollector(ctx, d, b, &Config{Interval: time.Hour, Grace: 72 * time.Hour}, nil)
+	c.now = func() time.Time { return now }
+
+	report := c.Run(false)
+	if len(report.Errors) != 0 || report.Scanned != 3 || len(report.Orphans) != 0 {
+		t.Fatalf("expected every blob to be referenced, got %+v", report)
+	}
+
+	// the admin deletes the message and the author deletes the other one
+	tr.onEventSaved(ctx, &nostr.Event{ID: "del", Kind: groups.KindDeleteEvent, CreatedAt: ts(now), Tags: nostr.Tags{{"h", "demo"}, {"e", "msg"}}})
+	tr.onEventDeleted(ctx, other)
+
+	report = c.Run(true)
+	if len(report.Orphans) != 2 || report.Bytes != 30 || report.Deleted != 0 || len(b.removed) != 0 {
+		t.Fatalf("expected a dry run to report both orphans, got %+v", report)
+	}
+	if !slices.Equal(report.Orphans[0].Owners, []string{"alice", "bob"}) {
+		t.Fatalf("expected every owner of the orphan, got %v", report.Orphans[0].Owners)
+	}
+
+	report = c.Run(false)
+	if report.Deleted != 2 || !slices.Equal(b.removed, []string{shaA, shaB}) {
+		t.Fatalf("expected both orphans to be deleted, got %+v %v", report, b.removed)
+	}
+
+	if c.Last() != report {
+		t.Fatal("expected the report to be kept as the latest one")
+	}
+}
+
+func TestCollectorKeepsBlobsUploadedBeforeTracking(t *testing.T) {
+	d := testutil.NewDB(t)
+	ctx := context.Background()
+
+	since, err := d.BlobRefDB.TrackingSince()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := since.Add(10 * 24 * time.Hour)
+	ts := func(t time.Time) nostr.Timestamp { return nostr.Timestamp(t.Unix()) }
+
+	// alice's events using the blob were never tracked, bob uploaded it again since
+	b := &fakeBlobs{indexed: []blossom.BlobDescriptor{
+		{SHA256: shaA, Owner: "alice", Size: 10, Uploaded: ts(since.Add(-time.Hour))},
+		{SHA256: shaA, Owner: "bob", Size: 10, Uploaded: ts(now.Add(-5 * 24 * time.Hour))},
+		{SHA256: shaB, Owner: "bob", Size: 20, Uploaded: ts(now.Add(-5 * 24 * time.Hour))},
+	}}
+
+	c := NewCollector(ctx, d, b, &Config{Interval: time.Hour, Grace: 72 * time.Hour}, nil)
+	c.now = func() time.Time { return now }
+
+	report := c.Run(false)
+	if len(report.Errors) != 0 || report.Scanned != 2 || len(report.Orphans) != 1 || !slices.Equal(b.removed, []string{shaB}) {
+		t.Fatalf("expected only the blob uploaded since tracking to be deleted, got %+v %v", report, b.removed)
+	}
+}
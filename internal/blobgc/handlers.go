@@ -0,0 +1,50 @@
+package blobgc
+
+import (
+	"net/http"
+	"strconv"
+
+	com "github.com/comunifi/relay/pkg/common"
+)
+
+type Handlers struct {
+	c *Collector
+}
+
+func NewHandlers(c *Collector) *Handlers {
+	return &Handlers{
+		c: c,
+	}
+}
+
+// Get returns the report of the latest garbage collection
+func (h *Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	report := h.c.Last()
+	if report == nil {
+		http.Error(w, "no blob garbage collection ran yet", http.StatusNotFound)
+		return
+	}
+
+	err := com.Body(w, report, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Run collects the unreferenced blobs now, ?dry_run=true only reports them
+func (h *Handlers) Run(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if d := r.URL.Query().Get("dry_run"); d != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(d)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := com.Body(w, h.c.Run(dryRun), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,166 @@
+package blobgc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// blob urls end with the sha256 of the blob and an optional extension
+var blobPath = regexp.MustCompile(`^([0-9a-f]{64})(\.[A-Za-z0-9]+)?$`)
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// blob urls in the text of messages
+var contentURL = regexp.MustCompile(`https?://[^\s"'<>]+/[0-9a-f]{64}(\.[A-Za-z0-9]+)?`)
+
+// tags whose value is the url of a media
+var urlTags = []string{"url", "image", "picture", "thumb", "banner"}
+
+// BlobRefs returns the sha256 of the blobs an event references, in imeta tags, media url tags, urls
+// in the content and the picture and banner of profiles
+func BlobRefs(ev *nostr.Event) []string {
+	shas := []string{}
+	add := func(sha string) {
+		if sha != "" && !slices.Contains(shas, sha) {
+			shas = append(shas, sha)
+		}
+	}
+
+	for _, tag := range ev.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+
+		switch {
+		case tag[0] == "imeta":
+			// imeta fields are "name value" pairs
+			for _, field := range tag[1:] {
+				name, value, ok := strings.Cut(field, " ")
+				if !ok {
+					continue
+				}
+
+				switch name {
+				case "url", "thumb", "image":
+					add(blobFromURL(value))
+				case "x":
+					if sha256Hex.MatchString(value) {
+						add(value)
+					}
+				}
+			}
+		case slices.Contains(urlTags, tag[0]):
+			add(blobFromURL(tag[1]))
+		}
+	}
+
+	// clients don't always add imeta tags for the media of messages
+	for _, u := range contentURL.FindAllString(ev.Content, -1) {
+		add(blobFromURL(u))
+	}
+
+	if ev.Kind == nostr.KindProfileMetadata {
+		var profile struct {
+			Picture string `json:"picture"`
+			Banner  string `json:"banner"`
+		}
+		if json.Unmarshal([]byte(ev.Content), &profile) == nil {
+			add(blobFromURL(profile.Picture))
+			add(blobFromURL(profile.Banner))
+		}
+	}
+
+	slices.Sort(shas)
+
+	return shas
+}
+
+// blobFromURL returns the sha256 of the blob a url points to, empty if it isn't a blob url
+func blobFromURL(u string) string {
+	parsed, err := url.Parse(strings.TrimSpace(u))
+	if err != nil || parsed.Path == "" {
+		return ""
+	}
+
+	m := blobPath.FindStringSubmatch(path.Base(parsed.Path))
+	if m == nil {
+		return ""
+	}
+
+	return m[1]
+}
+
+// Tracker keeps the references of stored events to blobs up to date
+type Tracker struct {
+	db *db.DB
+}
+
+func NewTracker(d *db.DB) *Tracker {
+	return &Tracker{
+		db: d,
+	}
+}
+
+// AddHooks tracks the references of saved events and drops those of deleted events, deleted
+// group events and deleted groups
+func (t *Tracker) AddHooks(relay *khatru.Relay) {
+	relay.OnEventSaved = append(relay.OnEventSaved, t.onEventSaved)
+	relay.DeleteEvent = append(relay.DeleteEvent, t.onEventDeleted)
+}
+
+func (t *Tracker) onEventSaved(ctx context.Context, ev *nostr.Event) {
+	var err error
+
+	switch ev.Kind {
+	case groups.KindDeleteEvent:
+		ids := []string{}
+		for _, tag := range ev.Tags {
+			if len(tag) >= 2 && tag[0] == "e" {
+				ids = append(ids, tag[1])
+			}
+		}
+		_, err = t.db.BlobRefDB.RemoveEventRefs(ids)
+	case groups.KindDeleteGroup:
+		if h := ev.Tags.Find("h"); h != nil {
+			_, err = t.db.BlobRefDB.RemoveGroupRefs(h[1], ev.CreatedAt.Time().UTC())
+		}
+	default:
+		shas := BlobRefs(ev)
+		if len(shas) == 0 {
+			return
+		}
+
+		groupID := ""
+		if h := ev.Tags.Find("h"); h != nil {
+			groupID = h[1]
+		}
+
+		err = t.db.BlobRefDB.AddRefs(ev.ID, groupID, shas, ev.CreatedAt.Time().UTC())
+	}
+
+	if err != nil {
+		log.Printf("failed to track blob references of %s: %v", ev.ID, err)
+	}
+}
+
+// onEventDeleted runs after the event was deleted, a failure doesn't fail the deletion and only
+// keeps blobs around
+func (t *Tracker) onEventDeleted(ctx context.Context, ev *nostr.Event) error {
+	_, err := t.db.BlobRefDB.RemoveEventRefs([]string{ev.ID})
+	if err != nil {
+		log.Printf("failed to drop blob references of %s: %v", ev.ID, err)
+	}
+
+	return nil
+}
@@ -3,19 +3,27 @@ package blossom
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/comunifi/relay/internal/faults"
+	"github.com/comunifi/relay/internal/imagemeta"
+	"github.com/comunifi/relay/pkg/relay"
 	"github.com/fiatjaf/eventstore"
+	"github.com/fiatjaf/eventstore/postgresql"
 	"github.com/fiatjaf/khatru"
 	"github.com/fiatjaf/khatru/blossom"
+	"github.com/lib/pq"
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -34,6 +42,13 @@ const (
 	KindGroupMembers  = 39002 // Group members list (has d tag with p tags)
 )
 
+// KindBlobIndex is the kind of the unsigned events khatru indexes blobs with, one per owner, it
+// is the kind of the authorization events of blossom requests
+const KindBlobIndex = 24242
+
+// index entries listed at a time
+const blobIndexPage = 100
+
 type BlossomConfig struct {
 	ServiceURL      string
 	AWSAccessKeyID  string
@@ -41,24 +56,67 @@ type BlossomConfig struct {
 	AWSRegion       string
 	AWSEndpointURL  string
 	AWSS3BucketName string
+
+	// StripMetadata removes the EXIF, XMP and text metadata of uploaded images before they are stored
+	StripMetadata bool
+
+	// Residency keeps the blobs of some groups in other buckets, nil keeps every blob in the
+	// bucket above
+	Residency *ResidencyConfig
 }
 
 type BlossomService struct {
 	config     *BlossomConfig
-	s3Client   *s3.Client
+	storages   *Storages
 	blossom    *blossom.BlossomServer
+	blobStore  *postgresql.PostgresBackend
 	eventStore eventstore.Store
-
-	// pendingUploads maps sha256 -> groupID for uploads in progress
+	faults     *faults.Injector
+	bots       Bots
+	uploads    Uploads
+	transcoder Transcoder
+	quarantine Quarantine
+	cache      *Cache
+	rewrites   Rewrites
+	denylist   Denylist
+
+	// pendingUploads maps sha256 -> pendingUpload for uploads in progress
 	pendingUploads sync.Map
 }
 
+// pendingUpload is what the upload authorization says about a blob being uploaded
+type pendingUpload struct {
+	groupID string
+	pubkey  string
+}
+
+// Bots decides whether a pubkey that is not a member may upload media to a group on behalf of an admin
+type Bots interface {
+	CanUpload(ctx context.Context, pubkey, groupID string) (bool, error)
+}
+
+// Uploads records uploaded blobs for abuse handling and for the media listings of groups
+type Uploads interface {
+	Record(ctx context.Context, u *relay.Upload, ip string) error
+	Removed(ctx context.Context, sha256 string) error
+}
+
+// Rewrites records the blobs stored with another content than the uploaded one
+type Rewrites interface {
+	AddRewrite(sha256, contentSha256 string) error
+}
+
+// Denylist tells which blobs are banned from the relay
+type Denylist interface {
+	IsBlobBanned(sha256 string) bool
+}
+
 // NewBlossomService creates a new blossom service with S3 backend
 // - blobStore: used for blob metadata storage (can be separate from relay events)
 // - eventStore: used for querying group membership events (should be the main relay eventstore)
-func NewBlossomService(ctx context.Context, relay *khatru.Relay, blobStore eventstore.Store, eventStore eventstore.Store, cfg *BlossomConfig) (*BlossomService, error) {
-	// Create S3 client
-	s3Client, err := createS3Client(ctx, cfg)
+func NewBlossomService(ctx context.Context, relay *khatru.Relay, blobStore *postgresql.PostgresBackend, eventStore eventstore.Store, cfg *BlossomConfig) (*BlossomService, error) {
+	// Create the S3 clients of the buckets
+	storages, err := NewStorages(ctx, cfg, cfg.Residency)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create S3 client: %w", err)
 	}
@@ -76,8 +134,9 @@ func NewBlossomService(ctx context.Context, relay *khatru.Relay, blobStore event
 
 	service := &BlossomService{
 		config:     cfg,
-		s3Client:   s3Client,
+		storages:   storages,
 		blossom:    bl,
+		blobStore:  blobStore,
 		eventStore: eventStore,
 	}
 
@@ -126,21 +185,107 @@ func createS3Client(ctx context.Context, cfg *BlossomConfig) (*s3.Client, error)
 	return s3Client, nil
 }
 
-// storeBlob stores a blob to S3 under the group folder
+// Ping checks that the buckets are reachable with the configured credentials, it is meant to be
+// called before the service is created since that registers the blossom routes on the relay
+func Ping(ctx context.Context, cfg *BlossomConfig) error {
+	storages, err := NewStorages(ctx, cfg, cfg.Residency)
+	if err != nil {
+		return err
+	}
+
+	return storages.Ping(ctx)
+}
+
+// SetFaults sets the injector that randomly fails blob uploads, for testing only
+func (s *BlossomService) SetFaults(f *faults.Injector) {
+	s.faults = f
+}
+
+// SetBots allows bots holding a token minted by a group admin to upload media to that group
+func (s *BlossomService) SetBots(b Bots) {
+	s.bots = b
+}
+
+// SetUploads records every uploaded blob with its uploader and client ip
+func (s *BlossomService) SetUploads(u Uploads) {
+	s.uploads = u
+}
+
+// SetRewrites records the hash of the content stored for the images stripped of their metadata,
+// so that integrity checks know what to expect
+func (s *BlossomService) SetRewrites(rw Rewrites) {
+	s.rewrites = rw
+}
+
+// SetCache serves recently requested blobs from a local disk cache
+func (s *BlossomService) SetCache(c *Cache) {
+	s.cache = c
+}
+
+// SetDenylist refuses to store banned blobs, whatever hash their upload announced
+func (s *BlossomService) SetDenylist(d Denylist) {
+	s.denylist = d
+}
+
+// storeBlob stores a blob to S3 under the group folder, in the bucket of the group
 func (s *BlossomService) storeBlob(ctx context.Context, sha256 string, body []byte) error {
 	// Get the group ID from pending uploads
-	groupID := ""
-	if gid, ok := s.pendingUploads.LoadAndDelete(sha256); ok {
-		groupID = gid.(string)
+	var pending pendingUpload
+	if p, ok := s.pendingUploads.LoadAndDelete(sha256); ok {
+		pending = p.(pendingUpload)
 	}
+	groupID := pending.groupID
 
-	key := s.buildS3Key(groupID, sha256)
+	// the reject hooks only see the hash the upload announced, this is the hash of the content;
+	// blossom uploads keep their index entry before the blob is stored, it is removed
+	if s.denylist != nil && s.denylist.IsBlobBanned(sha256) {
+		err := s.removeIndexEntries(ctx, sha256)
+		if err != nil {
+			log.Printf("Failed to remove the index entries of banned blob %s: %v", sha256, err)
+		}
+
+		return errors.New("this blob is banned from the relay")
+	}
 
 	// Detect content type from the body
 	contentType := detectContentType(body)
 
-	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:        aws.String(s.config.AWSS3BucketName),
+	if s.config.StripMetadata {
+		// the blob keeps the hash it was uploaded with, the stored content is recorded
+		stripped, changed, err := imagemeta.Strip(body, contentType)
+		if err != nil {
+			return fmt.Errorf("failed to strip image metadata: %w", err)
+		}
+
+		if changed {
+			if s.rewrites != nil {
+				err = s.rewrites.AddRewrite(sha256, hashOf(stripped))
+				if err != nil {
+					return fmt.Errorf("failed to record stripped image: %w", err)
+				}
+			}
+
+			log.Printf("Stripped metadata of blob %s (%d -> %d bytes)", sha256, len(body), len(stripped))
+			body = stripped
+		}
+	}
+
+	// risky blobs are kept out of the blobs folder until they are scanned
+	quarantined := s.quarantine != nil && s.quarantine.ShouldScan(contentType)
+
+	key := s.buildS3Key(groupID, sha256)
+	if quarantined {
+		key = quarantineKey(groupID, sha256)
+	}
+
+	if err := s.faults.Fail(faults.S3Put); err != nil {
+		return fmt.Errorf("failed to store blob to S3: %w", err)
+	}
+
+	st := s.storages.forGroup(groupID)
+
+	_, err := st.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(st.bucket),
 		Key:           aws.String(key),
 		Body:          bytes.NewReader(body),
 		ContentLength: aws.Int64(int64(len(body))),
@@ -150,74 +295,87 @@ func (s *BlossomService) storeBlob(ctx context.Context, sha256 string, body []by
 		return fmt.Errorf("failed to store blob to S3: %w", err)
 	}
 
-	log.Printf("Stored blob %s to S3 (group: %s)", sha256, groupID)
+	log.Printf("Stored blob %s to S3 (group: %s, storage: %s, quarantined: %v)", sha256, groupID, st, quarantined)
+
+	if s.uploads != nil {
+		// the blob is stored, a failure to record it doesn't fail the upload
+		err = s.uploads.Record(ctx, &relay.Upload{
+			SHA256:  sha256,
+			Pubkey:  pending.pubkey,
+			GroupID: groupID,
+			Size:    int64(len(body)),
+			Mime:    contentType,
+		}, ClientIP(ctx))
+		if err != nil {
+			log.Printf("Failed to record upload of blob %s: %v", sha256, err)
+		}
+	}
+
+	if quarantined {
+		// a blob that isn't queued stays in quarantine, it can't be served
+		err = s.quarantine.Enqueue(ctx, sha256, pending.pubkey, groupID, contentType)
+		if err != nil {
+			return fmt.Errorf("failed to queue scan of blob: %w", err)
+		}
+
+		// the blob is transcoded once it is released
+		return nil
+	}
+
+	if s.transcoder != nil {
+		err = s.transcoder.Enqueue(ctx, sha256, pending.pubkey, groupID, contentType)
+		if err != nil {
+			log.Printf("Failed to queue transcode of blob %s: %v", sha256, err)
+		}
+	}
+
 	return nil
 }
 
-// loadBlob loads a blob from S3
+// loadBlob opens a blob from S3, it is read with ranged requests as it is served so that large
+// media isn't held in memory and Range headers can be honored with partial responses
 // Note: For loading, we need to search for the blob since we don't know the group
 func (s *BlossomService) loadBlob(ctx context.Context, sha256 string) (io.ReadSeeker, error) {
-	// First try to find the blob by listing possible locations
-	// Try the root blobs folder first, then search in group folders
-	key, err := s.findBlobKey(ctx, sha256)
-	if err != nil {
-		return nil, fmt.Errorf("blob not found: %w", err)
+	if s.cache != nil {
+		if r, ok := s.cache.Open(ctx, sha256); ok {
+			return r, nil
+		}
 	}
 
-	result, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(s.config.AWSS3BucketName),
-		Key:    aws.String(key),
-	})
+	// The blob is searched in every bucket, from the root blobs folder to the group folders
+	r, err := s.storages.OpenRange(ctx, sha256)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load blob from S3: %w", err)
 	}
 
-	// Read the entire object into memory to return as ReadSeeker
-	data, err := io.ReadAll(result.Body)
-	result.Body.Close()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read blob data: %w", err)
-	}
-
-	return bytes.NewReader(data), nil
-}
-
-// findBlobKey searches for a blob in S3 and returns its key
-func (s *BlossomService) findBlobKey(ctx context.Context, sha256 string) (string, error) {
-	// Search for any object ending with the sha256 hash
-	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
-		Bucket: aws.String(s.config.AWSS3BucketName),
-		Prefix: aws.String("blobs/"),
-	})
-
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
+	if s.cache != nil {
+		// the size is known from the head request, seeking doesn't fetch the blob
+		size, err := r.Seek(0, io.SeekEnd)
+		if err == nil {
+			_, err = r.Seek(0, io.SeekStart)
+		}
 		if err != nil {
-			return "", err
+			return nil, fmt.Errorf("failed to load blob from S3: %w", err)
 		}
 
-		for _, obj := range page.Contents {
-			key := aws.ToString(obj.Key)
-			// Check if this key ends with our sha256
-			if strings.HasSuffix(key, "/"+sha256) || strings.HasSuffix(key, sha256) {
-				return key, nil
-			}
-		}
+		s.cache.Fill(sha256, size, func(ctx context.Context) (io.ReadCloser, error) {
+			return s.storages.Open(ctx, sha256)
+		})
 	}
 
-	return "", fmt.Errorf("blob %s not found", sha256)
+	return r, nil
 }
 
 // deleteBlob deletes a blob from S3
 func (s *BlossomService) deleteBlob(ctx context.Context, sha256 string) error {
 	// Find the blob first
-	key, err := s.findBlobKey(ctx, sha256)
+	st, key, err := s.storages.find(ctx, sha256)
 	if err != nil {
 		return fmt.Errorf("failed to find blob for deletion: %w", err)
 	}
 
-	_, err = s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(s.config.AWSS3BucketName),
+	_, err = st.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(st.bucket),
 		Key:    aws.String(key),
 	})
 	if err != nil {
@@ -225,6 +383,19 @@ func (s *BlossomService) deleteBlob(ctx context.Context, sha256 string) error {
 	}
 
 	log.Printf("Deleted blob %s from S3", sha256)
+
+	if s.cache != nil {
+		s.cache.Remove(sha256)
+	}
+
+	if s.uploads != nil {
+		// the blob is gone, a failure to record it only leaves it listed
+		err = s.uploads.Removed(ctx, sha256)
+		if err != nil {
+			log.Printf("Failed to record removal of blob %s: %v", sha256, err)
+		}
+	}
+
 	return nil
 }
 
@@ -259,13 +430,22 @@ func (s *BlossomService) rejectUpload(ctx context.Context, auth *nostr.Event, si
 		if err != nil {
 			return true, "error checking group membership", 500
 		}
+		if !isMember && s.bots != nil {
+			isMember, err = s.bots.CanUpload(ctx, auth.PubKey, groupID)
+			if err != nil {
+				return true, "error checking group membership", 500
+			}
+		}
 		if !isMember {
 			return true, "not a member of the specified group", 403
 		}
 	}
 
-	// Store the group ID for use in storeBlob
-	s.pendingUploads.Store((*sha256)[1], groupID)
+	// Store the group ID for use in storeBlob, unless only checking whether the upload would be accepted
+	if isPrecheck(ctx) {
+		return false, "", 0
+	}
+	s.pendingUploads.Store((*sha256)[1], pendingUpload{groupID: groupID, pubkey: auth.PubKey})
 
 	return false, "", 0
 }
@@ -392,3 +572,188 @@ func isText(data []byte) bool {
 func (s *BlossomService) Blossom() *blossom.BlossomServer {
 	return s.blossom
 }
+
+// ListBlobs returns the blobs a pubkey uploaded
+func (s *BlossomService) ListBlobs(ctx context.Context, pubkey string) ([]blossom.BlobDescriptor, error) {
+	ch, err := s.blossom.Store.List(ctx, pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := []blossom.BlobDescriptor{}
+	for bd := range ch {
+		blobs = append(blobs, bd)
+	}
+
+	return blobs, nil
+}
+
+// DeleteBlobs removes every blob a pubkey uploaded and returns how many, the content of a blob
+// stays in S3 while another pubkey still owns it
+func (s *BlossomService) DeleteBlobs(ctx context.Context, pubkey string) (int, error) {
+	deleted := 0
+
+	// the index returns a page of blobs at a time, pages are listed until none is left
+	for {
+		blobs, err := s.ListBlobs(ctx, pubkey)
+		if err != nil {
+			return deleted, err
+		}
+
+		if len(blobs) == 0 {
+			return deleted, nil
+		}
+
+		for _, bd := range blobs {
+			err := s.blossom.Store.Delete(ctx, bd.SHA256, pubkey)
+			if err != nil {
+				return deleted, err
+			}
+			deleted++
+
+			owner, err := s.blossom.Store.Get(ctx, bd.SHA256)
+			if err != nil {
+				return deleted, err
+			}
+
+			if owner == nil {
+				err = s.deleteBlob(ctx, bd.SHA256)
+				if err != nil {
+					return deleted, err
+				}
+			}
+		}
+	}
+}
+
+// IndexedBlobs returns the index entries of the blobs uploaded within a time range, a blob has an
+// entry per owner. Entries are paged on their upload time, blob and owner so that a page full of
+// entries uploaded in the same second doesn't end the listing early.
+func (s *BlossomService) IndexedBlobs(ctx context.Context, since, until time.Time) ([]blossom.BlobDescriptor, error) {
+	blobs := []blossom.BlobDescriptor{}
+
+	uploaded, sha256, owner := since.Unix(), "", ""
+	for {
+		rows, err := s.blobStore.DB.QueryContext(ctx, `
+		SELECT pubkey, created_at, tags
+		FROM event
+		WHERE kind = $1 AND created_at <= $2 AND (created_at, tags->0->>1, pubkey) > ($3, $4, $5)
+		ORDER BY created_at, tags->0->>1, pubkey
+		LIMIT $6
+		`, KindBlobIndex, until.Unix(), uploaded, sha256, owner, blobIndexPage)
+		if err != nil {
+			return nil, err
+		}
+
+		n := 0
+		for rows.Next() {
+			var evt nostr.Event
+			var timestamp int64
+			err = rows.Scan(&evt.PubKey, &timestamp, &evt.Tags)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			evt.CreatedAt = nostr.Timestamp(timestamp)
+			n++
+
+			bd, ok := parseIndexEntry(&evt)
+			if ok {
+				blobs = append(blobs, bd)
+			}
+
+			uploaded, owner = timestamp, evt.PubKey
+			if len(evt.Tags) > 0 && len(evt.Tags[0]) > 1 {
+				sha256 = evt.Tags[0][1]
+			}
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if n < blobIndexPage {
+			return blobs, nil
+		}
+	}
+}
+
+// UploadedBefore returns the blobs among shas that an owner uploaded before a time
+func (s *BlossomService) UploadedBefore(ctx context.Context, shas []string, t time.Time) ([]string, error) {
+	rows, err := s.blobStore.DB.QueryContext(ctx, `
+	SELECT DISTINCT tags->0->>1
+	FROM event
+	WHERE kind = $1 AND created_at < $2 AND tagvalues && $3
+	`, KindBlobIndex, t.Unix(), pq.Array(shas))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploaded := []string{}
+	for rows.Next() {
+		var sha256 string
+		err = rows.Scan(&sha256)
+		if err != nil {
+			return nil, err
+		}
+
+		uploaded = append(uploaded, sha256)
+	}
+
+	return uploaded, rows.Err()
+}
+
+// RemoveBlob removes a blob for every owner and deletes its content
+func (s *BlossomService) RemoveBlob(ctx context.Context, sha256 string) error {
+	err := s.removeIndexEntries(ctx, sha256)
+	if err != nil {
+		return err
+	}
+
+	return s.deleteBlob(ctx, sha256)
+}
+
+// removeIndexEntries removes the index entries of a blob, of every owner
+func (s *BlossomService) removeIndexEntries(ctx context.Context, sha256 string) error {
+	ch, err := s.blobStore.QueryEvents(ctx, nostr.Filter{
+		Kinds: []int{KindBlobIndex},
+		Tags:  nostr.TagMap{"x": []string{sha256}},
+	})
+	if err != nil {
+		return err
+	}
+
+	entries := []*nostr.Event{}
+	for evt := range ch {
+		entries = append(entries, evt)
+	}
+
+	for _, evt := range entries {
+		err = s.blobStore.DeleteEvent(ctx, evt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseIndexEntry reads the blob descriptor of an index entry, the tags are the ones khatru writes
+func parseIndexEntry(evt *nostr.Event) (blossom.BlobDescriptor, bool) {
+	if len(evt.Tags) < 3 || len(evt.Tags[0]) < 2 || len(evt.Tags[1]) < 2 || len(evt.Tags[2]) < 2 {
+		return blossom.BlobDescriptor{}, false
+	}
+
+	size, _ := strconv.Atoi(evt.Tags[2][1])
+
+	return blossom.BlobDescriptor{
+		Owner:    evt.PubKey,
+		Uploaded: evt.CreatedAt,
+		SHA256:   evt.Tags[0][1],
+		Type:     evt.Tags[1][1],
+		Size:     size,
+	}, true
+}
@@ -0,0 +1,265 @@
+package blossom
+
+import (
+	"cmp"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/comunifi/relay/internal/metrics"
+)
+
+// Cache keeps recently served blobs on a local disk so that busy groups don't fetch the same
+// avatars and images from S3 over and over. Blobs are content addressed, a cached copy never goes
+// stale and is only dropped when the blob is deleted or evicted.
+//
+// A blob is cached after a miss, in the background, when it is no larger than the max blob size.
+// The least recently served blobs are evicted once the cache goes over its size.
+type Cache struct {
+	dir      string
+	maxBytes int64
+	maxBlob  int64
+
+	mu      sync.Mutex
+	lru     *list.List // of *cacheEntry, most recently served first
+	entries map[string]*list.Element
+	filling map[string]bool
+	bytes   int64
+
+	hits   int64
+	misses int64
+}
+
+type cacheEntry struct {
+	sha256 string
+	size   int64
+}
+
+// NewCache opens a cache in dir, the blobs already in it are kept from their modification time
+func NewCache(dir string, maxBytes, maxBlob int64) (*Cache, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxBlob:  maxBlob,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		filling:  map[string]bool{},
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type cached struct {
+		entry   *cacheEntry
+		modTime int64
+	}
+
+	existing := []cached{}
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		// leftovers of fills that didn't finish
+		if filepath.Ext(f.Name()) == ".tmp" {
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+
+		existing = append(existing, cached{&cacheEntry{sha256: f.Name(), size: info.Size()}, info.ModTime().UnixNano()})
+	}
+
+	slices.SortFunc(existing, func(a, b cached) int {
+		return cmp.Compare(b.modTime, a.modTime)
+	})
+
+	for _, e := range existing {
+		c.entries[e.entry.sha256] = c.lru.PushBack(e.entry)
+		c.bytes += e.entry.size
+	}
+
+	c.evict()
+
+	log.Printf("Blob cache in %s holds %d blobs (%d bytes)", dir, len(c.entries), c.bytes)
+
+	return c, nil
+}
+
+func (c *Cache) path(sha256 string) string {
+	return filepath.Join(c.dir, sha256)
+}
+
+// Open opens a cached blob, false when it isn't cached. The file is closed once the context is done.
+func (c *Cache) Open(ctx context.Context, sha256 string) (io.ReadSeeker, bool) {
+	c.mu.Lock()
+	el, ok := c.entries[sha256]
+	if ok {
+		c.lru.MoveToFront(el)
+		c.hits++
+	} else {
+		c.misses++
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	f, err := os.Open(c.path(sha256))
+	if err != nil {
+		// the file was removed behind the cache's back
+		c.Remove(sha256)
+		return nil, false
+	}
+
+	context.AfterFunc(ctx, func() {
+		f.Close()
+	})
+
+	return f, true
+}
+
+// Fill caches a blob in the background, a blob that is too large or already being cached is left
+// alone. open is only called when the blob is cached.
+func (c *Cache) Fill(sha256 string, size int64, open func(ctx context.Context) (io.ReadCloser, error)) {
+	if size > c.maxBlob || size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	if _, ok := c.entries[sha256]; ok || c.filling[sha256] {
+		c.mu.Unlock()
+		return
+	}
+	c.filling[sha256] = true
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.filling, sha256)
+			c.mu.Unlock()
+		}()
+
+		err := c.fill(sha256, open)
+		if err != nil {
+			log.Printf("Failed to cache blob %s: %v", sha256, err)
+		}
+	}()
+}
+
+func (c *Cache) fill(sha256 string, open func(ctx context.Context) (io.ReadCloser, error)) error {
+	body, err := open(context.Background())
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(c.dir, sha256+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// the blob may be larger than the storage said, the copy stops past the max blob size
+	size, err := io.Copy(tmp, io.LimitReader(body, c.maxBlob+1))
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if size > c.maxBlob {
+		return fmt.Errorf("blob is larger than %d bytes", c.maxBlob)
+	}
+
+	err = os.Rename(tmp.Name(), c.path(sha256))
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the blob was deleted while it was being cached
+	if !c.filling[sha256] {
+		os.Remove(c.path(sha256))
+		return nil
+	}
+
+	c.entries[sha256] = c.lru.PushFront(&cacheEntry{sha256: sha256, size: size})
+	c.bytes += size
+
+	c.evict()
+
+	return nil
+}
+
+// Remove drops a blob from the cache, a fill in progress is discarded
+func (c *Cache) Remove(sha256 string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.filling, sha256)
+
+	el, ok := c.entries[sha256]
+	if !ok {
+		return
+	}
+
+	c.drop(el)
+}
+
+// evict drops the least recently served blobs until the cache fits its size, the lock must be held
+func (c *Cache) evict() {
+	for c.bytes > c.maxBytes {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+
+		c.drop(el)
+	}
+}
+
+// drop removes an entry and its file, the lock must be held
+func (c *Cache) drop(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.sha256)
+	c.bytes -= e.size
+
+	err := os.Remove(c.path(e.sha256))
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove cached blob %s: %v", e.sha256, err)
+	}
+}
+
+func (c *Cache) WriteMetrics(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics.Help(w, "relay_blob_cache_hits_total", "counter", "blobs served from the local disk cache")
+	metrics.Sample(w, "relay_blob_cache_hits_total", float64(c.hits))
+
+	metrics.Help(w, "relay_blob_cache_misses_total", "counter", "blobs that were not in the local disk cache")
+	metrics.Sample(w, "relay_blob_cache_misses_total", float64(c.misses))
+
+	metrics.Help(w, "relay_blob_cache_bytes", "gauge", "size of the blobs in the local disk cache")
+	metrics.Sample(w, "relay_blob_cache_bytes", float64(c.bytes))
+
+	metrics.Help(w, "relay_blob_cache_blobs", "gauge", "blobs in the local disk cache")
+	metrics.Sample(w, "relay_blob_cache_blobs", float64(len(c.entries)))
+}
@@ -0,0 +1,97 @@
+package blossom
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fillAndWait caches a blob and waits for the background fill to finish
+func fillAndWait(t *testing.T, c *Cache, sha256, body string) {
+	t.Helper()
+
+	c.Fill(sha256, int64(len(body)), func(ctx context.Context) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(body)), nil
+	})
+
+	for range 100 {
+		c.mu.Lock()
+		filling := c.filling[sha256]
+		c.mu.Unlock()
+
+		if !filling {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("blob %s was not cached", sha256)
+}
+
+func readCached(t *testing.T, c *Cache, sha256 string) (string, bool) {
+	t.Helper()
+
+	r, ok := c.Open(t.Context(), sha256)
+	if !ok {
+		return "", false
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b), true
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := NewCache(dir, 10, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fillAndWait(t, c, "a", "aaaa")
+	fillAndWait(t, c, "b", "bbbb")
+
+	// blobs larger than the max blob size aren't cached
+	fillAndWait(t, c, "large", "llllll")
+
+	if body, ok := readCached(t, c, "a"); !ok || body != "aaaa" {
+		t.Fatalf("expected a to be cached, got %q", body)
+	}
+
+	if _, ok := readCached(t, c, "large"); ok {
+		t.Fatal("expected the large blob not to be cached")
+	}
+
+	// b is the least recently served, it is evicted to make room for c
+	fillAndWait(t, c, "c", "cccc")
+
+	if _, ok := readCached(t, c, "b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+
+	if _, ok := readCached(t, c, "a"); !ok {
+		t.Fatal("expected a to be kept")
+	}
+
+	c.Remove("a")
+
+	if _, ok := readCached(t, c, "a"); ok {
+		t.Fatal("expected a to be removed")
+	}
+
+	// the blobs on disk are kept across restarts
+	c, err = NewCache(dir, 10, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, ok := readCached(t, c, "c"); !ok || body != "cccc" {
+		t.Fatalf("expected c to be cached after a restart, got %q", body)
+	}
+}
@@ -0,0 +1,25 @@
+package blossom
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fiatjaf/khatru"
+)
+
+type clientIPKey struct{}
+
+// ClientIPMiddleware keeps the ip of the client in the context of requests, the blossom hooks only
+// get the context of the upload request
+func ClientIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey{}, khatru.GetIPFromRequest(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ClientIP returns the ip of the client of a request that went through ClientIPMiddleware
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
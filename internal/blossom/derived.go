@@ -0,0 +1,77 @@
+package blossom
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/fiatjaf/khatru/blossom"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Transcoder converts uploaded videos once they are stored
+type Transcoder interface {
+	Enqueue(ctx context.Context, sha256, pubkey, groupID, mime string) error
+}
+
+// SetTranscoder queues every stored video for transcoding
+func (s *BlossomService) SetTranscoder(t Transcoder) {
+	s.transcoder = t
+}
+
+// ReadBlob reads a whole blob, from whichever storage it is kept in
+func (s *BlossomService) ReadBlob(ctx context.Context, hash string) ([]byte, error) {
+	body, err := s.storages.Open(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+// StoreDerived stores a blob the relay made from an upload, such as a transcoded video, in the
+// storage of the group and indexes it as owned by the uploader so that it is served and deleted
+// like an upload
+func (s *BlossomService) StoreDerived(ctx context.Context, pubkey, groupID string, body []byte, mime string) (blossom.BlobDescriptor, error) {
+	hash := hashOf(body)
+
+	st := s.storages.forGroup(groupID)
+
+	_, err := st.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(st.bucket),
+		Key:           aws.String(s.buildS3Key(groupID, hash)),
+		Body:          bytes.NewReader(body),
+		ContentLength: aws.Int64(int64(len(body))),
+		ContentType:   aws.String(mime),
+	})
+	if err != nil {
+		return blossom.BlobDescriptor{}, fmt.Errorf("failed to store blob to S3: %w", err)
+	}
+
+	bd := blossom.BlobDescriptor{
+		URL:      s.blossom.ServiceURL + "/" + hash,
+		SHA256:   hash,
+		Size:     len(body),
+		Type:     mime,
+		Uploaded: nostr.Now(),
+	}
+
+	err = s.blossom.Store.Keep(ctx, bd, pubkey)
+	if err != nil {
+		return blossom.BlobDescriptor{}, err
+	}
+
+	return bd, nil
+}
+
+// hashOf returns the hex sha256 of a content
+func hashOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package blossom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// archiveRuleID identifies the lifecycle rule of the relay, the other rules of a bucket are kept
+const archiveRuleID = "relay-archive-blobs"
+
+// ArchiveClasses are the storage classes blobs can be archived to, they are all served without a
+// restore. Glacier and deep archive are left out since their blobs can't be downloaded.
+var ArchiveClasses = []string{
+	string(types.TransitionStorageClassStandardIa),
+	string(types.TransitionStorageClassOnezoneIa),
+	string(types.TransitionStorageClassIntelligentTiering),
+	string(types.TransitionStorageClassGlacierIr),
+}
+
+// LifecycleConfig moves blobs to a cheaper storage class once they are old enough
+type LifecycleConfig struct {
+	ArchiveAfterDays int
+	ArchiveClass     string
+}
+
+// ApplyLifecycle enforces the archive rule on every bucket, it replaces the rule of a previous
+// start so that changing the config takes effect on restart
+func (s *BlossomService) ApplyLifecycle(ctx context.Context, lc *LifecycleConfig) error {
+	return s.storages.ApplyLifecycle(ctx, lc)
+}
+
+// ApplyLifecycle enforces the archive rule on every bucket
+func (st *Storages) ApplyLifecycle(ctx context.Context, lc *LifecycleConfig) error {
+	if !slices.Contains(ArchiveClasses, lc.ArchiveClass) {
+		return fmt.Errorf("unsupported archive class %q", lc.ArchiveClass)
+	}
+
+	for _, s := range st.all() {
+		err := s.applyLifecycle(ctx, lc)
+		if err != nil {
+			return fmt.Errorf("storage %s: %w", s, err)
+		}
+
+		log.Printf("Blobs of storage %s move to %s after %d days", s, lc.ArchiveClass, lc.ArchiveAfterDays)
+	}
+
+	return nil
+}
+
+func (s *storage) applyLifecycle(ctx context.Context, lc *LifecycleConfig) error {
+	rules, err := s.lifecycleRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules = slices.DeleteFunc(rules, func(r types.LifecycleRule) bool {
+		return aws.ToString(r.ID) == archiveRuleID
+	})
+
+	// quarantined blobs are left in the standard class, they are released or deleted soon
+	rules = append(rules, types.LifecycleRule{
+		ID:     aws.String(archiveRuleID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{
+			Prefix: aws.String("blobs/"),
+		},
+		Transitions: []types.Transition{
+			{
+				Days:         aws.Int32(int32(lc.ArchiveAfterDays)),
+				StorageClass: types.TransitionStorageClass(lc.ArchiveClass),
+			},
+		},
+	})
+
+	_, err = s.client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String(s.bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{
+			Rules: rules,
+		},
+	})
+
+	return err
+}
+
+// lifecycleRules returns the lifecycle rules of the bucket, none when it has no lifecycle
+func (s *storage) lifecycleRules(ctx context.Context) ([]types.LifecycleRule, error) {
+	out, err := s.client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration" {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return out.Rules, nil
+}
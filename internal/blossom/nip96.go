@@ -0,0 +1,463 @@
+package blossom
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/fiatjaf/khatru/blossom"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// path of the NIP-96 api and of its discovery document
+const (
+	nip96Path          = "/api/v2/media"
+	nip96WellKnownPath = "/.well-known/nostr/nip96.json"
+)
+
+// how far the http auth event of a NIP-96 request can be from now
+const httpAuthMaxAge = time.Minute
+
+// files listed in a page of the NIP-96 api by default, and at most
+const (
+	defaultNIP96Count = 10
+	maxNIP96Count     = 100
+)
+
+// room for the multipart framing around a file of the maximum size
+const multipartOverhead = 64 * 1024
+
+var ErrNotOwner = errors.New("blob is not owned by the pubkey")
+
+// ErrBlobNotFound is returned for a blob that isn't in any storage
+var ErrBlobNotFound = errors.New("blob not found")
+
+// RejectedError is an upload or a deletion refused by a blossom hook, with the status to answer
+type RejectedError struct {
+	Reason string
+	Status int
+}
+
+func (e *RejectedError) Error() string {
+	return e.Reason
+}
+
+// nip94Event is the unsigned file metadata event of a NIP-96 response
+type nip94Event struct {
+	Tags      nostr.Tags      `json:"tags"`
+	Content   string          `json:"content"`
+	CreatedAt nostr.Timestamp `json:"created_at,omitempty"`
+}
+
+// Upload stores a blob a pubkey uploaded to a group without a blossom request. The upload hooks
+// decide whether it is accepted the way they do for blossom uploads, a refusal is a *RejectedError.
+func (s *BlossomService) Upload(ctx context.Context, pubkey, groupID string, body []byte) (blossom.BlobDescriptor, error) {
+	hash := hashOf(body)
+	mimeType := detectContentType(body)
+
+	ext := ""
+	exts, _ := mime.ExtensionsByType(mimeType)
+	if len(exts) > 0 {
+		ext = exts[0]
+	}
+
+	// the hooks read the uploader and the group from an authorization like the one of a blossom upload
+	auth := &nostr.Event{
+		Kind:      KindBlobIndex,
+		PubKey:    pubkey,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"t", "upload"}, {"x", hash}},
+	}
+	if groupID != "" {
+		auth.Tags = append(auth.Tags, nostr.Tag{"h", groupID})
+	}
+
+	for _, reject := range s.blossom.RejectUpload {
+		rejected, reason, status := reject(ctx, auth, len(body), ext)
+		if rejected {
+			if status == 0 {
+				status = http.StatusForbidden
+			}
+			return blossom.BlobDescriptor{}, &RejectedError{Reason: reason, Status: status}
+		}
+	}
+
+	for _, store := range s.blossom.StoreBlob {
+		err := store(ctx, hash, body)
+		if err != nil {
+			return blossom.BlobDescriptor{}, err
+		}
+	}
+
+	bd := blossom.BlobDescriptor{
+		URL:      s.blossom.ServiceURL + "/" + hash + ext,
+		SHA256:   hash,
+		Size:     len(body),
+		Type:     mimeType,
+		Uploaded: nostr.Now(),
+	}
+
+	err := s.blossom.Store.Keep(ctx, bd, pubkey)
+	if err != nil {
+		return blossom.BlobDescriptor{}, err
+	}
+
+	return bd, nil
+}
+
+// Delete removes a blob a pubkey uploaded without a blossom request, its content is deleted once
+// no other pubkey owns it. The delete hooks run first, a refusal is a *RejectedError.
+func (s *BlossomService) Delete(ctx context.Context, pubkey, hash string) error {
+	auth := &nostr.Event{
+		Kind:      KindBlobIndex,
+		PubKey:    pubkey,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"t", "delete"}, {"x", hash}},
+	}
+
+	for _, reject := range s.blossom.RejectDelete {
+		rejected, reason, status := reject(ctx, auth, hash)
+		if rejected {
+			if status == 0 {
+				status = http.StatusForbidden
+			}
+			return &RejectedError{Reason: reason, Status: status}
+		}
+	}
+
+	ch, err := s.blobStore.QueryEvents(ctx, nostr.Filter{
+		Kinds:   []int{KindBlobIndex},
+		Authors: []string{pubkey},
+		Tags:    nostr.TagMap{"x": []string{hash}},
+		Limit:   1,
+	})
+	if err != nil {
+		return err
+	}
+
+	owned := false
+	for range ch {
+		owned = true
+	}
+
+	if !owned {
+		return ErrNotOwner
+	}
+
+	err = s.blossom.Store.Delete(ctx, hash, pubkey)
+	if err != nil {
+		return err
+	}
+
+	owner, err := s.blossom.Store.Get(ctx, hash)
+	if err != nil {
+		return err
+	}
+
+	if owner != nil {
+		return nil
+	}
+
+	return s.deleteBlob(ctx, hash)
+}
+
+// NIP96 serves the NIP-96 http file storage api next to blossom, for clients that don't speak it.
+// Uploads go through the same hooks and storage as blossom uploads, the group is read from the h
+// tag of the NIP-98 authorization. Other requests go to next.
+// https://github.com/nostr-protocol/nips/blob/master/96.md
+func (s *BlossomService) NIP96(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == nip96WellKnownPath && r.Method == http.MethodGet:
+			s.nip96Info(w, r)
+		case r.URL.Path == nip96Path && r.Method == http.MethodPost:
+			s.nip96Upload(w, r)
+		case r.URL.Path == nip96Path && r.Method == http.MethodGet:
+			s.nip96List(w, r)
+		case strings.HasPrefix(r.URL.Path, nip96Path+"/") && r.Method == http.MethodDelete:
+			s.nip96Delete(w, r)
+		case (r.URL.Path == nip96Path || strings.HasPrefix(r.URL.Path, nip96Path+"/")) && r.Method == http.MethodOptions:
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// nip96Info returns the discovery document of the api
+func (s *BlossomService) nip96Info(w http.ResponseWriter, r *http.Request) {
+	nip96JSON(w, http.StatusOK, map[string]any{
+		"api_url":        s.blossom.ServiceURL + nip96Path,
+		"download_url":   s.blossom.ServiceURL,
+		"supported_nips": []int{94, 96, 98},
+		"content_types":  []string{"image/*", "video/*", "audio/*"},
+		"plans": map[string]any{
+			"free": map[string]any{
+				"name":              "Members",
+				"is_nip98_required": true,
+				"max_byte_size":     MaxFileSize,
+			},
+		},
+	})
+}
+
+// nip96Upload stores the file of a multipart upload and returns its NIP-94 metadata
+func (s *BlossomService) nip96Upload(w http.ResponseWriter, r *http.Request) {
+	auth, reason := parseHTTPAuth(r)
+	if reason != "" {
+		nip96Error(w, http.StatusUnauthorized, reason)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxFileSize+multipartOverhead))
+	if err != nil {
+		nip96Error(w, http.StatusRequestEntityTooLarge, "request too large")
+		return
+	}
+
+	// the payload tag binds the authorization to this body
+	if payload := auth.Tags.Find("payload"); payload != nil && payload[1] != hashOf(body) {
+		nip96Error(w, http.StatusUnauthorized, "authorization is for another payload")
+		return
+	}
+
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		nip96Error(w, http.StatusBadRequest, "expected a multipart form")
+		return
+	}
+
+	form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(MaxFileSize + multipartOverhead)
+	if err != nil {
+		nip96Error(w, http.StatusBadRequest, "invalid multipart form")
+		return
+	}
+	defer form.RemoveAll()
+
+	files := form.File["file"]
+	if len(files) == 0 {
+		nip96Error(w, http.StatusBadRequest, "missing file")
+		return
+	}
+
+	f, err := files[0].Open()
+	if err != nil {
+		nip96Error(w, http.StatusBadRequest, "invalid file")
+		return
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		nip96Error(w, http.StatusBadRequest, "invalid file")
+		return
+	}
+
+	groupID := ""
+	if h := auth.Tags.Find("h"); h != nil {
+		groupID = h[1]
+	}
+
+	bd, err := s.Upload(r.Context(), auth.PubKey, groupID, content)
+	if err != nil {
+		var rejected *RejectedError
+		if errors.As(err, &rejected) {
+			nip96Error(w, rejected.Status, rejected.Reason)
+			return
+		}
+
+		nip96Error(w, http.StatusInternalServerError, "failed to store file")
+		return
+	}
+
+	ev := fileMetadata(bd)
+	ev.Content = formValue(form, "caption")
+	if alt := formValue(form, "alt"); alt != "" {
+		ev.Tags = append(ev.Tags, nostr.Tag{"alt", alt})
+	}
+
+	nip96JSON(w, http.StatusCreated, map[string]any{
+		"status":      "success",
+		"message":     "Upload successful.",
+		"nip94_event": ev,
+	})
+}
+
+// nip96Delete removes a file of the pubkey of the authorization
+func (s *BlossomService) nip96Delete(w http.ResponseWriter, r *http.Request) {
+	auth, reason := parseHTTPAuth(r)
+	if reason != "" {
+		nip96Error(w, http.StatusUnauthorized, reason)
+		return
+	}
+
+	// the file can be named with its extension, like in its url
+	hash := strings.TrimPrefix(r.URL.Path, nip96Path+"/")
+	hash, _, _ = strings.Cut(hash, ".")
+	if len(hash) != 64 {
+		nip96Error(w, http.StatusBadRequest, "invalid file hash")
+		return
+	}
+
+	err := s.Delete(r.Context(), auth.PubKey, hash)
+	if err != nil {
+		var rejected *RejectedError
+		switch {
+		case errors.As(err, &rejected):
+			nip96Error(w, rejected.Status, rejected.Reason)
+		case errors.Is(err, ErrNotOwner):
+			nip96Error(w, http.StatusNotFound, "file not found")
+		default:
+			nip96Error(w, http.StatusInternalServerError, "failed to delete file")
+		}
+		return
+	}
+
+	nip96JSON(w, http.StatusOK, map[string]any{
+		"status":  "success",
+		"message": "File deleted.",
+	})
+}
+
+// nip96List returns a page of the files of the pubkey of the authorization, latest first
+func (s *BlossomService) nip96List(w http.ResponseWriter, r *http.Request) {
+	auth, reason := parseHTTPAuth(r)
+	if reason != "" {
+		nip96Error(w, http.StatusUnauthorized, reason)
+		return
+	}
+
+	q := r.URL.Query()
+
+	page := 0
+	if p := q.Get("page"); p != "" {
+		var err error
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 0 {
+			nip96Error(w, http.StatusBadRequest, "invalid page")
+			return
+		}
+	}
+
+	count := defaultNIP96Count
+	if c := q.Get("count"); c != "" {
+		var err error
+		count, err = strconv.Atoi(c)
+		if err != nil || count <= 0 {
+			nip96Error(w, http.StatusBadRequest, "invalid count")
+			return
+		}
+
+		count = min(count, maxNIP96Count)
+	}
+
+	blobs, err := s.ListBlobs(r.Context(), auth.PubKey)
+	if err != nil {
+		nip96Error(w, http.StatusInternalServerError, "failed to list files")
+		return
+	}
+
+	start := min(page*count, len(blobs))
+	end := min(start+count, len(blobs))
+
+	files := make([]nip94Event, 0, end-start)
+	for _, bd := range blobs[start:end] {
+		ev := fileMetadata(bd)
+		ev.CreatedAt = bd.Uploaded
+		files = append(files, ev)
+	}
+
+	nip96JSON(w, http.StatusOK, map[string]any{
+		"count": len(files),
+		"total": len(blobs),
+		"page":  page,
+		"files": files,
+	})
+}
+
+// fileMetadata returns the NIP-94 tags of a blob, it is served under the hash of the upload even
+// when its metadata was stripped
+func fileMetadata(bd blossom.BlobDescriptor) nip94Event {
+	return nip94Event{
+		Tags: nostr.Tags{
+			{"url", bd.URL},
+			{"ox", bd.SHA256},
+			{"x", bd.SHA256},
+			{"m", bd.Type},
+			{"size", strconv.Itoa(bd.Size)},
+		},
+	}
+}
+
+// formValue returns the first value of a field of a multipart form
+func formValue(form *multipart.Form, key string) string {
+	if v := form.Value[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// parseHTTPAuth reads the NIP-98 authorization of a request from the Authorization header, the
+// reason is set when it is missing or invalid
+func parseHTTPAuth(r *http.Request) (*nostr.Event, string) {
+	encoded, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Nostr ")
+	if !ok {
+		return nil, "authentication required"
+	}
+
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "invalid Authorization header"
+	}
+
+	var auth nostr.Event
+	err = json.Unmarshal(b, &auth)
+	if err != nil {
+		return nil, "invalid Authorization header"
+	}
+
+	ok, err = auth.CheckSignature()
+	if err != nil || !ok {
+		return nil, "invalid authorization signature"
+	}
+
+	err = com.CheckRequestEvent(r, &auth)
+	if err != nil {
+		return nil, "authorization is for another request"
+	}
+
+	age := time.Since(auth.CreatedAt.Time())
+	if age > httpAuthMaxAge || age < -httpAuthMaxAge {
+		return nil, "authorization is expired"
+	}
+
+	return &auth, ""
+}
+
+// nip96Error answers a NIP-96 request with an error message
+func nip96Error(w http.ResponseWriter, status int, message string) {
+	nip96JSON(w, status, map[string]any{
+		"status":  "error",
+		"message": message,
+	})
+}
+
+func nip96JSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,174 @@
+package blossom
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fiatjaf/khatru/blossom"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type fakeBlobIndex struct {
+	blobs map[string][]blossom.BlobDescriptor
+}
+
+func (i *fakeBlobIndex) Keep(ctx context.Context, bd blossom.BlobDescriptor, pubkey string) error {
+	i.blobs[pubkey] = append(i.blobs[pubkey], bd)
+	return nil
+}
+
+func (i *fakeBlobIndex) List(ctx context.Context, pubkey string) (chan blossom.BlobDescriptor, error) {
+	ch := make(chan blossom.BlobDescriptor, len(i.blobs[pubkey]))
+	for _, bd := range i.blobs[pubkey] {
+		ch <- bd
+	}
+	close(ch)
+	return ch, nil
+}
+
+func (i *fakeBlobIndex) Get(ctx context.Context, sha256 string) (*blossom.BlobDescriptor, error) {
+	return nil, nil
+}
+
+func (i *fakeBlobIndex) Delete(ctx context.Context, sha256 string, pubkey string) error {
+	return nil
+}
+
+func httpAuth(t *testing.T, sk, method, url string) string {
+	t.Helper()
+
+	ev := nostr.Event{
+		Kind:      nostr.KindHTTPAuth,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"u", url}, {"method", method}},
+	}
+
+	err := ev.Sign(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "Nostr " + base64.StdEncoding.EncodeToString(b)
+}
+
+func TestNIP96(t *testing.T) {
+	index := &fakeBlobIndex{blobs: map[string][]blossom.BlobDescriptor{}}
+	stored := map[string][]byte{}
+
+	s := &BlossomService{blossom: &blossom.BlossomServer{ServiceURL: "https://relay.example", Store: index}}
+	s.blossom.RejectUpload = append(s.blossom.RejectUpload, s.rejectUpload)
+	s.blossom.StoreBlob = append(s.blossom.StoreBlob, func(ctx context.Context, sha256 string, body []byte) error {
+		stored[sha256] = body
+		return nil
+	})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := s.NIP96(next)
+
+	sk := nostr.GeneratePrivateKey()
+	pubkey, _ := nostr.GetPublicKey(sk)
+
+	// the discovery document points to the api
+	r := httptest.NewRequest(http.MethodGet, "/.well-known/nostr/nip96.json", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var info struct {
+		APIURL string `json:"api_url"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&info)
+	if err != nil || info.APIURL != "https://relay.example/api/v2/media" {
+		t.Fatalf("unexpected discovery document %+v %v", info, err)
+	}
+
+	upload := func(auth string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "hello.txt")
+		fw.Write([]byte("hello"))
+		mw.WriteField("caption", "a greeting")
+		mw.Close()
+
+		r := httptest.NewRequest(http.MethodPost, "/api/v2/media", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	w = upload("")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected authentication to be required, got %d", w.Code)
+	}
+
+	// an authorization signed for another endpoint is refused
+	w = upload(httpAuth(t, sk, "POST", "https://other.example/api/v2/media"))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an authorization for another host to be refused, got %d", w.Code)
+	}
+
+	w = upload(httpAuth(t, sk, "POST", "https://example.com/api/v2/media"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected the upload to succeed, got %d (%s)", w.Code, w.Body.String())
+	}
+
+	var res struct {
+		Status string     `json:"status"`
+		Event  nip94Event `json:"nip94_event"`
+	}
+	err = json.NewDecoder(w.Body).Decode(&res)
+	if err != nil || res.Status != "success" || res.Event.Content != "a greeting" {
+		t.Fatalf("unexpected response %+v %v", res, err)
+	}
+
+	hash := hashOf([]byte("hello"))
+	if res.Event.Tags.GetFirst([]string{"x", hash}) == nil || res.Event.Tags.GetFirst([]string{"m", "text/plain"}) == nil {
+		t.Fatalf("unexpected file metadata %+v", res.Event.Tags)
+	}
+
+	if string(stored[hash]) != "hello" || len(index.blobs[pubkey]) != 1 {
+		t.Fatalf("expected the blob to be stored and indexed, got %q %v", stored[hash], index.blobs)
+	}
+
+	// the uploader lists the file
+	r = httptest.NewRequest(http.MethodGet, "/api/v2/media?page=0&count=10", nil)
+	r.Header.Set("Authorization", httpAuth(t, sk, "GET", "https://example.com/api/v2/media"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var list struct {
+		Total int          `json:"total"`
+		Files []nip94Event `json:"files"`
+	}
+	err = json.NewDecoder(w.Body).Decode(&list)
+	if err != nil || list.Total != 1 || len(list.Files) != 1 {
+		t.Fatalf("unexpected list %+v %v", list, err)
+	}
+
+	// blossom requests go to khatru
+	r = httptest.NewRequest(http.MethodPut, "/upload", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("expected the request to be passed on, got %d", w.Code)
+	}
+}
@@ -0,0 +1,139 @@
+package blossom
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type precheckKey struct{}
+
+// isPrecheck tells whether the upload hooks run for a HEAD /upload, nothing is uploaded after it
+func isPrecheck(ctx context.Context) bool {
+	v, _ := ctx.Value(precheckKey{}).(bool)
+	return v
+}
+
+// UploadCheck answers HEAD /upload (BUD-06) so that clients can find out whether an upload would
+// be accepted before sending it. The upload hooks run with the hash, size and type announced in
+// the X-SHA-256, X-Content-Length and X-Content-Type headers, a rejection is answered with its
+// status and the reason in X-Reason. Other requests go to next.
+func (s *BlossomService) UploadCheck(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path != "/upload" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Reason")
+
+		reason, status := s.checkUpload(r)
+		if status != http.StatusOK {
+			w.Header().Set("X-Reason", reason)
+		}
+
+		w.WriteHeader(status)
+	})
+}
+
+// checkUpload runs the upload hooks for the upload a HEAD /upload announces
+func (s *BlossomService) checkUpload(r *http.Request) (string, int) {
+	hash := r.Header.Get("X-SHA-256")
+	if len(hash) != 64 {
+		return "missing or invalid X-SHA-256 header", http.StatusBadRequest
+	}
+
+	size, err := strconv.Atoi(r.Header.Get("X-Content-Length"))
+	if err != nil || size < 0 {
+		return "missing or invalid X-Content-Length header", http.StatusLengthRequired
+	}
+
+	ext := ""
+	if ct := r.Header.Get("X-Content-Type"); ct != "" {
+		exts, _ := mime.ExtensionsByType(ct)
+		if len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	auth, reason := parseUploadAuth(r, hash)
+	if reason != "" {
+		return reason, http.StatusUnauthorized
+	}
+
+	ctx := context.WithValue(r.Context(), precheckKey{}, true)
+
+	for _, reject := range s.blossom.RejectUpload {
+		rejected, reason, status := reject(ctx, auth, size, ext)
+		if rejected {
+			if status == 0 {
+				status = http.StatusForbidden
+			}
+			return reason, status
+		}
+	}
+
+	return "", http.StatusOK
+}
+
+// parseUploadAuth reads the authorization of an upload from the Authorization header, a missing
+// header gives a nil event so that the hooks decide whether uploads need one. The reason is set
+// when the authorization is invalid.
+func parseUploadAuth(r *http.Request, hash string) (*nostr.Event, string) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, ""
+	}
+
+	encoded, ok := strings.CutPrefix(header, "Nostr ")
+	if !ok {
+		return nil, "invalid Authorization header"
+	}
+
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "invalid Authorization header"
+	}
+
+	var auth nostr.Event
+	err = json.Unmarshal(b, &auth)
+	if err != nil {
+		return nil, "invalid Authorization header"
+	}
+
+	ok, err = auth.CheckSignature()
+	if err != nil || !ok {
+		return nil, "invalid authorization signature"
+	}
+
+	if auth.Kind != KindBlobIndex || auth.CreatedAt > nostr.Now() {
+		return nil, "invalid authorization event"
+	}
+
+	if t := auth.Tags.GetFirst([]string{"t", ""}); t == nil || (*t)[1] != "upload" {
+		return nil, "authorization is not for uploads"
+	}
+
+	exp := auth.Tags.GetFirst([]string{"expiration", ""})
+	if exp == nil {
+		return nil, "authorization has no expiration"
+	}
+
+	expiration, err := strconv.ParseInt((*exp)[1], 10, 64)
+	if err != nil || nostr.Timestamp(expiration) < nostr.Now() {
+		return nil, "authorization is expired"
+	}
+
+	if x := auth.Tags.GetFirst([]string{"x", ""}); x != nil && (*x)[1] != hash {
+		return nil, "authorization is for another blob"
+	}
+
+	return &auth, ""
+}
@@ -0,0 +1,101 @@
+package blossom
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fiatjaf/khatru/blossom"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func uploadAuth(t *testing.T, hash string) string {
+	t.Helper()
+
+	ev := nostr.Event{
+		Kind:      KindBlobIndex,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"t", "upload"},
+			{"x", hash},
+			{"expiration", strconv.FormatInt(int64(nostr.Now())+60, 10)},
+		},
+	}
+
+	err := ev.Sign(nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "Nostr " + base64.StdEncoding.EncodeToString(b)
+}
+
+func TestUploadCheck(t *testing.T) {
+	s := &BlossomService{blossom: &blossom.BlossomServer{}}
+	s.blossom.RejectUpload = append(s.blossom.RejectUpload, s.rejectUpload)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := s.UploadCheck(next)
+
+	hash := strings.Repeat("a", 64)
+
+	check := func(size int, auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodHead, "/upload", nil)
+		r.Header.Set("X-SHA-256", hash)
+		r.Header.Set("X-Content-Length", strconv.Itoa(size))
+		r.Header.Set("X-Content-Type", "image/png")
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	w := check(1024, uploadAuth(t, hash))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d (%s)", http.StatusOK, w.Code, w.Header().Get("X-Reason"))
+	}
+
+	// a check doesn't leave the upload pending
+	if _, ok := s.pendingUploads.Load(hash); ok {
+		t.Fatal("expected no pending upload after a check")
+	}
+
+	w = check(MaxFileSize+1, uploadAuth(t, hash))
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.HasPrefix(w.Header().Get("X-Reason"), "file too large") {
+		t.Fatalf("expected the upload to be too large, got %d (%s)", w.Code, w.Header().Get("X-Reason"))
+	}
+
+	w = check(1024, "")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("X-Reason") != "authentication required" {
+		t.Fatalf("expected authentication to be required, got %d (%s)", w.Code, w.Header().Get("X-Reason"))
+	}
+
+	w = check(1024, uploadAuth(t, strings.Repeat("b", 64)))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an authorization for another blob to be refused, got %d", w.Code)
+	}
+
+	// uploads themselves go to khatru
+	r := httptest.NewRequest(http.MethodPut, "/upload", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("expected the upload to be passed on, got %d", rec.Code)
+	}
+}
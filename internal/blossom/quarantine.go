@@ -0,0 +1,131 @@
+package blossom
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Quarantine decides which uploads are scanned before they are served and scans them
+type Quarantine interface {
+	ShouldScan(mime string) bool
+	Enqueue(ctx context.Context, sha256, pubkey, groupID, mime string) error
+	Blocked(ctx context.Context, sha256 string) (bool, error)
+}
+
+// SetQuarantine keeps risky uploads in quarantine until they are scanned, downloads of a blob
+// are refused until it is clean
+func (s *BlossomService) SetQuarantine(q Quarantine) {
+	s.quarantine = q
+	s.blossom.RejectGet = append(s.blossom.RejectGet, s.rejectGet)
+}
+
+// rejectGet refuses downloads of blobs that weren't scanned yet or were found infected
+func (s *BlossomService) rejectGet(ctx context.Context, auth *nostr.Event, sha256 string) (bool, string, int) {
+	blocked, err := s.quarantine.Blocked(ctx, sha256)
+	if err != nil {
+		return true, "error checking blob scan", 500
+	}
+
+	if blocked {
+		return true, "blob is being scanned", 403
+	}
+
+	return false, "", 0
+}
+
+// quarantineKey is where a blob is kept until it is scanned, outside of the blobs folder so that
+// it can't be found by downloads
+func quarantineKey(groupID, sha256 string) string {
+	if groupID != "" {
+		return "quarantine/" + groupID + "/" + sha256
+	}
+
+	return "quarantine/" + sha256
+}
+
+// ReadQuarantined reads a whole blob waiting for a scan
+func (s *BlossomService) ReadQuarantined(ctx context.Context, sha256, groupID string) ([]byte, error) {
+	st := s.storages.forGroup(groupID)
+
+	result, err := st.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(st.bucket),
+		Key:    aws.String(quarantineKey(groupID, sha256)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantined blob %s: %w", sha256, err)
+	}
+	defer result.Body.Close()
+
+	return io.ReadAll(result.Body)
+}
+
+// Release moves a clean blob out of quarantine to the folder of its group, it is then processed
+// like any other upload
+func (s *BlossomService) Release(ctx context.Context, sha256, pubkey, groupID, mime string) error {
+	st := s.storages.forGroup(groupID)
+	key := quarantineKey(groupID, sha256)
+
+	_, err := st.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(st.bucket),
+		Key:        aws.String(s.buildS3Key(groupID, sha256)),
+		CopySource: aws.String(url.PathEscape(st.bucket + "/" + key)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release blob %s: %w", sha256, err)
+	}
+
+	_, err = st.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(st.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete quarantined blob %s: %w", sha256, err)
+	}
+
+	log.Printf("Released blob %s from quarantine (group: %s, storage: %s)", sha256, groupID, st)
+
+	if s.transcoder != nil {
+		err = s.transcoder.Enqueue(ctx, sha256, pubkey, groupID, mime)
+		if err != nil {
+			log.Printf("Failed to queue transcode of blob %s: %v", sha256, err)
+		}
+	}
+
+	return nil
+}
+
+// Discard deletes an infected blob from quarantine together with its index entries
+func (s *BlossomService) Discard(ctx context.Context, sha256, groupID string) error {
+	err := s.removeIndexEntries(ctx, sha256)
+	if err != nil {
+		return err
+	}
+
+	st := s.storages.forGroup(groupID)
+
+	_, err = st.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(st.bucket),
+		Key:    aws.String(quarantineKey(groupID, sha256)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete quarantined blob %s: %w", sha256, err)
+	}
+
+	log.Printf("Discarded blob %s from quarantine", sha256)
+
+	if s.uploads != nil {
+		err = s.uploads.Removed(ctx, sha256)
+		if err != nil {
+			log.Printf("Failed to record removal of blob %s: %v", sha256, err)
+		}
+	}
+
+	return nil
+}
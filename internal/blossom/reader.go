@@ -0,0 +1,150 @@
+package blossom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// rangeReader reads an object of a bucket with ranged requests, so that a blob can be served
+// without holding it in memory and a Range header only fetches the bytes it asks for.
+//
+// A request is only made when the reader is read, from the current offset to the end of the
+// object. Sequential reads share the same response, a seek elsewhere closes it.
+type rangeReader struct {
+	ctx    context.Context
+	client objects
+	bucket string
+	key    string
+	size   int64
+
+	mu     sync.Mutex
+	offset int64
+	body   io.ReadCloser
+}
+
+// objects reads the objects of a bucket, it is implemented by *s3.Client
+type objects interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// OpenRange opens a blob for ranged reads, the response is closed once the context is done
+func (st *Storages) OpenRange(ctx context.Context, sha256 string) (io.ReadSeeker, error) {
+	s, key, err := st.find(ctx, sha256)
+	if err != nil {
+		return nil, err
+	}
+
+	return openRange(ctx, s.client, s.bucket, key)
+}
+
+func openRange(ctx context.Context, client objects, bucket, key string) (*rangeReader, error) {
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rangeReader{
+		ctx:    ctx,
+		client: client,
+		bucket: bucket,
+		key:    key,
+		size:   aws.ToInt64(head.ContentLength),
+	}
+
+	// the caller may stop reading before the end, the open response is released with the request
+	context.AfterFunc(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.close()
+	})
+
+	return r, nil
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.offset >= r.size {
+		r.close()
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		result, err := r.client.GetObject(r.ctx, &s3.GetObjectInput{
+			Bucket: aws.String(r.bucket),
+			Key:    aws.String(r.key),
+			Range:  aws.String(fmt.Sprintf("bytes=%d-", r.offset)),
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		r.body = result.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+
+	if err == io.EOF {
+		r.close()
+
+		// the object ended before its size, it changed while being read
+		if r.offset < r.size {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	// the open response only serves reads from the current offset
+	if abs != r.offset {
+		r.close()
+	}
+
+	r.offset = abs
+
+	return abs, nil
+}
+
+// close releases the open response, it is reopened at the offset by the next read
+func (r *rangeReader) close() {
+	if r.body == nil {
+		return
+	}
+
+	r.body.Close()
+	r.body = nil
+}
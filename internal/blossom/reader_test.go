@@ -0,0 +1,203 @@
+package blossom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeObjects serves a single object from memory, its head can announce more bytes than its body
+// has to act as an object truncated while being read
+type fakeObjects struct {
+	data []byte
+	size int64
+
+	mu     sync.Mutex
+	ranges []string
+	bodies []*fakeBody
+}
+
+// fakeBody returns a byte per read, so that a read of the rangeReader never drains it at once
+type fakeBody struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (b *fakeBody) Close() error {
+	b.closed.Store(true)
+	return nil
+}
+
+func (o *fakeObjects) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(o.size)}, nil
+}
+
+func (o *fakeObjects) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var start int
+	_, err := fmt.Sscanf(aws.ToString(params.Range), "bytes=%d-", &start)
+	if err != nil {
+		return nil, err
+	}
+	start = min(start, len(o.data))
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	body := &fakeBody{Reader: iotest.OneByteReader(bytes.NewReader(o.data[start:]))}
+	o.ranges = append(o.ranges, aws.ToString(params.Range))
+	o.bodies = append(o.bodies, body)
+
+	return &s3.GetObjectOutput{Body: body}, nil
+}
+
+func newFakeObjects(data string) *fakeObjects {
+	return &fakeObjects{data: []byte(data), size: int64(len(data))}
+}
+
+func TestRangeReaderSequentialReads(t *testing.T) {
+	o := newFakeObjects("hello world")
+
+	r, err := openRange(t.Context(), o, "bucket", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "hello world" {
+		t.Fatalf("expected hello world, got %q", b)
+	}
+
+	// every read is served by the first response
+	if !slices.Equal(o.ranges, []string{"bytes=0-"}) {
+		t.Fatalf("expected a single request, got %v", o.ranges)
+	}
+
+	if !o.bodies[0].closed.Load() {
+		t.Fatal("expected the response to be closed at the end of the object")
+	}
+}
+
+func TestRangeReaderSeek(t *testing.T) {
+	o := newFakeObjects("hello world")
+
+	r, err := openRange(t.Context(), o, "bucket", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head := make([]byte, 2)
+	_, err = io.ReadFull(r, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// seeking to the current offset keeps the response open
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil || pos != 2 {
+		t.Fatalf("expected position 2, got %d (%v)", pos, err)
+	}
+
+	if o.bodies[0].closed.Load() {
+		t.Fatal("expected the response to stay open")
+	}
+
+	pos, err = r.Seek(-5, io.SeekEnd)
+	if err != nil || pos != 6 {
+		t.Fatalf("expected position 6, got %d (%v)", pos, err)
+	}
+
+	if !o.bodies[0].closed.Load() {
+		t.Fatal("expected the response to be closed by the seek")
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(head)+string(b) != "heworld" {
+		t.Fatalf("expected he then world, got %q then %q", head, b)
+	}
+
+	if !slices.Equal(o.ranges, []string{"bytes=0-", "bytes=6-"}) {
+		t.Fatalf("expected the object to be reopened at the new offset, got %v", o.ranges)
+	}
+
+	_, err = r.Seek(-1, io.SeekStart)
+	if err == nil {
+		t.Fatal("expected a negative position to be rejected")
+	}
+}
+
+func TestRangeReaderTruncatedObject(t *testing.T) {
+	o := newFakeObjects("hello")
+	o.size = 11
+
+	r, err := openRange(t.Context(), o, "bucket", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(r)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	if string(b) != "hello" {
+		t.Fatalf("expected the bytes before the end, got %q", b)
+	}
+}
+
+func TestRangeReaderClosedWithContext(t *testing.T) {
+	o := newFakeObjects("hello world")
+
+	ctx, cancel := context.WithCancel(t.Context())
+
+	r, err := openRange(ctx, o, "bucket", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Read(make([]byte, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the caller stops reading, the response is released with the request
+	cancel()
+
+	for range 100 {
+		if o.bodies[0].closed.Load() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !o.bodies[0].closed.Load() {
+		t.Fatal("expected the response to be closed once the context is done")
+	}
+
+	_, err = r.Read(make([]byte, 1))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
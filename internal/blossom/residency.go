@@ -0,0 +1,341 @@
+package blossom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ResidencyConfig keeps the blobs of groups in buckets of their own, e.g. in an EU region, it is
+// read from a json file:
+//
+//	{
+//	  "storages": {
+//	    "eu": {
+//	      "region": "eu-central-1",
+//	      "bucket": "relay-blobs-eu"
+//	    }
+//	  },
+//	  "groups": {
+//	    "demo": "eu"
+//	  }
+//	}
+//
+// Storages without credentials or endpoint use the ones of the main bucket. Groups that are not
+// listed stay in the main bucket. Blobs are looked up in every bucket, so moving a group to another
+// storage doesn't break its existing blobs, relayctl migrate-blobs moves them afterwards.
+type ResidencyConfig struct {
+	Storages map[string]StorageConfig `json:"storages"`
+	Groups   map[string]string        `json:"groups"`
+}
+
+type StorageConfig struct {
+	Region      string `json:"region"`
+	Bucket      string `json:"bucket"`
+	EndpointURL string `json:"endpoint_url,omitempty"`
+	AccessKeyID string `json:"access_key_id,omitempty"`
+	SecretKey   string `json:"secret_key,omitempty"`
+}
+
+// LoadResidencyConfig reads the storages of groups from a json file
+func LoadResidencyConfig(path string) (*ResidencyConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rc ResidencyConfig
+	err = json.Unmarshal(b, &rc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob residency config %s: %w", path, err)
+	}
+
+	return &rc, nil
+}
+
+// storage is a bucket blobs are kept in
+type storage struct {
+	name     string // empty for the main bucket
+	client   *s3.Client
+	bucket   string
+	endpoint string
+}
+
+func (s *storage) String() string {
+	if s.name == "" {
+		return "main (" + s.bucket + ")"
+	}
+
+	return s.name + " (" + s.bucket + ")"
+}
+
+// sameBucket tells whether two storages are the same bucket under different names
+func (s *storage) sameBucket(o *storage) bool {
+	return s.bucket == o.bucket && s.endpoint == o.endpoint
+}
+
+// Storages routes the blobs of each group to its bucket
+type Storages struct {
+	main   *storage
+	named  map[string]*storage
+	groups map[string]string
+}
+
+// NewStorages creates the clients of the main bucket and of the storages of the residency config,
+// which can be nil when every blob is kept in the main bucket
+func NewStorages(ctx context.Context, cfg *BlossomConfig, rc *ResidencyConfig) (*Storages, error) {
+	client, err := createS3Client(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &Storages{
+		main:   &storage{client: client, bucket: cfg.AWSS3BucketName, endpoint: cfg.AWSEndpointURL},
+		named:  map[string]*storage{},
+		groups: map[string]string{},
+	}
+
+	if rc == nil {
+		return st, nil
+	}
+
+	for name, sc := range rc.Storages {
+		if sc.Bucket == "" {
+			return nil, fmt.Errorf("storage %s: bucket is required", name)
+		}
+
+		// credentials and endpoint default to the ones of the main bucket
+		scfg := *cfg
+		scfg.AWSS3BucketName = sc.Bucket
+		if sc.Region != "" {
+			scfg.AWSRegion = sc.Region
+		}
+		if sc.EndpointURL != "" {
+			scfg.AWSEndpointURL = sc.EndpointURL
+		}
+		if sc.AccessKeyID != "" {
+			scfg.AWSAccessKeyID = sc.AccessKeyID
+			scfg.AWSSecretKey = sc.SecretKey
+		}
+
+		client, err := createS3Client(ctx, &scfg)
+		if err != nil {
+			return nil, fmt.Errorf("storage %s: %w", name, err)
+		}
+
+		st.named[name] = &storage{name: name, client: client, bucket: sc.Bucket, endpoint: scfg.AWSEndpointURL}
+	}
+
+	for groupID, name := range rc.Groups {
+		if _, ok := st.named[name]; !ok {
+			return nil, fmt.Errorf("group %s: unknown storage %q", groupID, name)
+		}
+
+		st.groups[groupID] = name
+	}
+
+	return st, nil
+}
+
+// forGroup returns the storage new blobs of a group are kept in
+func (st *Storages) forGroup(groupID string) *storage {
+	if name, ok := st.groups[groupID]; ok {
+		return st.named[name]
+	}
+
+	return st.main
+}
+
+// all returns the main storage first, then the others by name
+func (st *Storages) all() []*storage {
+	names := make([]string, 0, len(st.named))
+	for name := range st.named {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	all := []*storage{st.main}
+	for _, name := range names {
+		all = append(all, st.named[name])
+	}
+
+	return all
+}
+
+// Ping checks that every bucket is reachable
+func (st *Storages) Ping(ctx context.Context) error {
+	for _, s := range st.all() {
+		_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+			Bucket: aws.String(s.bucket),
+		})
+		if err != nil {
+			return fmt.Errorf("storage %s: %w", s, err)
+		}
+	}
+
+	return nil
+}
+
+// find returns the storage and key of a blob, the blob may not have been moved to the storage of
+// its group yet so every storage is searched
+func (st *Storages) find(ctx context.Context, sha256 string) (*storage, string, error) {
+	for _, s := range st.all() {
+		key, err := s.findBlobKey(ctx, sha256)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if key != "" {
+			return s, key, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("%w: %s", ErrBlobNotFound, sha256)
+}
+
+// Open reads a blob from the storage it is kept in
+func (st *Storages) Open(ctx context.Context, sha256 string) (io.ReadCloser, error) {
+	s, key, err := st.find(ctx, sha256)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Body, nil
+}
+
+// findBlobKey searches for a blob in the bucket and returns its key, or an empty key when the
+// bucket doesn't have it
+func (s *storage) findBlobKey(ctx context.Context, sha256 string) (string, error) {
+	// Search for any object ending with the sha256 hash
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String("blobs/"),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			// Check if this key ends with our sha256
+			if strings.HasSuffix(key, "/"+sha256) || strings.HasSuffix(key, sha256) {
+				return key, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// Migration is the outcome of moving the blobs of a group to the storage of the group
+type Migration struct {
+	Group string   `json:"group"`
+	To    string   `json:"to"`
+	Moved []string `json:"moved"`
+	Bytes int64    `json:"bytes"`
+}
+
+// MigrateGroup moves the blobs of a group that are kept in other storages to the storage the group
+// is configured with, a blob is deleted from its old bucket once it was copied. With dryRun the
+// blobs to move are listed and left in place.
+func (st *Storages) MigrateGroup(ctx context.Context, groupID string, dryRun bool) (*Migration, error) {
+	if groupID == "" {
+		return nil, fmt.Errorf("group is required")
+	}
+
+	to := st.forGroup(groupID)
+	m := &Migration{Group: groupID, To: to.String(), Moved: []string{}}
+
+	prefix := "blobs/" + groupID + "/"
+
+	for _, from := range st.all() {
+		if from == to || from.sameBucket(to) {
+			continue
+		}
+
+		paginator := s3.NewListObjectsV2Paginator(from.client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(from.bucket),
+			Prefix: aws.String(prefix),
+		})
+
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return m, fmt.Errorf("storage %s: %w", from, err)
+			}
+
+			for _, obj := range page.Contents {
+				key := aws.ToString(obj.Key)
+
+				if !dryRun {
+					err = move(ctx, from, to, key)
+					if err != nil {
+						return m, err
+					}
+				}
+
+				m.Moved = append(m.Moved, strings.TrimPrefix(key, prefix))
+				m.Bytes += aws.ToInt64(obj.Size)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// move copies an object to another bucket and deletes the original
+func move(ctx context.Context, from, to *storage, key string) error {
+	result, err := from.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(from.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s from %s: %w", key, from, err)
+	}
+
+	data, err := io.ReadAll(result.Body)
+	result.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s from %s: %w", key, from, err)
+	}
+
+	_, err = to.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(to.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   result.ContentType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s to %s: %w", key, to, err)
+	}
+
+	_, err = from.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(from.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from %s: %w", key, from, err)
+	}
+
+	return nil
+}
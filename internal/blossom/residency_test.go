@@ -0,0 +1,84 @@
+package blossom
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testCfg = &BlossomConfig{
+	AWSAccessKeyID:  "key",
+	AWSSecretKey:    "secret",
+	AWSRegion:       "us-east-1",
+	AWSS3BucketName: "relay-blobs",
+}
+
+func TestLoadResidencyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "residency.json")
+
+	err := os.WriteFile(path, []byte(`{"storages": {"eu": {"region": "eu-central-1", "bucket": "relay-blobs-eu"}}, "groups": {"demo": "eu"}}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := LoadResidencyConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rc.Storages["eu"].Bucket != "relay-blobs-eu" || rc.Groups["demo"] != "eu" {
+		t.Fatalf("unexpected config %+v", rc)
+	}
+
+	err = os.WriteFile(path, []byte(`{"storages": [`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadResidencyConfig(path)
+	if err == nil {
+		t.Fatal("expected an invalid config to fail")
+	}
+}
+
+func TestStorages(t *testing.T) {
+	ctx := context.Background()
+
+	for name, rc := range map[string]*ResidencyConfig{
+		"unknown storage": {Groups: map[string]string{"demo": "eu"}},
+		"missing bucket":  {Storages: map[string]StorageConfig{"eu": {Region: "eu-central-1"}}},
+	} {
+		_, err := NewStorages(ctx, testCfg, rc)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	st, err := NewStorages(ctx, testCfg, &ResidencyConfig{
+		Storages: map[string]StorageConfig{
+			"eu": {Region: "eu-central-1", Bucket: "relay-blobs-eu"},
+			"ch": {Region: "eu-central-2", Bucket: "relay-blobs-ch"},
+		},
+		Groups: map[string]string{"demo": "eu"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := st.forGroup("demo"); s.bucket != "relay-blobs-eu" {
+		t.Fatalf("expected demo in relay-blobs-eu, got %s", s)
+	}
+
+	for _, groupID := range []string{"other", ""} {
+		if s := st.forGroup(groupID); s != st.main {
+			t.Fatalf("expected %q in the main bucket, got %s", groupID, s)
+		}
+	}
+
+	// the main bucket is searched first
+	all := st.all()
+	if len(all) != 3 || all[0] != st.main || all[1].name != "ch" || all[2].name != "eu" {
+		t.Fatalf("unexpected order %v", all)
+	}
+}
@@ -0,0 +1,274 @@
+// Package bridge mirrors selected group events, such as announcements and pinned messages, to
+// Discord and Telegram channels.
+//
+// Group admins select an event for bridging by tagging it with ["t", "announcement"] or
+// ["t", "pinned"]. Routes are read from a json file:
+//
+//	{
+//	  "routes": [
+//	    {
+//	      "group": "demo",
+//	      "labels": ["announcement", "pinned"],
+//	      "discord": {"url": "https://discord.com/api/webhooks/..."},
+//	      "template": "**{{.Label}}** {{.Content}}"
+//	    },
+//	    {
+//	      "group": "demo",
+//	      "telegram": {"token": "123:abc", "chat_id": "-100123"}
+//	    }
+//	  ]
+//	}
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"text/template"
+	"time"
+
+	"github.com/comunifi/relay/internal/webhook"
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+const (
+	LabelAnnouncement = "announcement"
+	LabelPinned       = "pinned"
+)
+
+// DefaultLabels are bridged when a route doesn't list any
+var DefaultLabels = []string{LabelAnnouncement, LabelPinned}
+
+// DefaultTemplate formats a bridged event when a route doesn't have a template
+const DefaultTemplate = `[{{.Group}}] {{.Label}}:
+{{.Content}}{{range .Media}}
+{{.}}{{end}}`
+
+// group content kinds that can be bridged
+var contentKinds = []int{9, 10, 11, 12}
+
+type DiscordConfig struct {
+	URL string `json:"url"`
+}
+
+type TelegramConfig struct {
+	Token  string `json:"token"`
+	ChatID string `json:"chat_id"`
+}
+
+// RouteConfig forwards the events of a group with one of the labels to a channel
+type RouteConfig struct {
+	Group    string          `json:"group"`
+	Labels   []string        `json:"labels,omitempty"`
+	Template string          `json:"template,omitempty"`
+	Discord  *DiscordConfig  `json:"discord,omitempty"`
+	Telegram *TelegramConfig `json:"telegram,omitempty"`
+}
+
+type Config struct {
+	Routes []RouteConfig `json:"routes"`
+}
+
+// LoadConfig reads the routes from a json file
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	err = json.Unmarshal(b, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bridge config %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// Admins decides who can select events for bridging
+type Admins interface {
+	IsAdmin(ctx context.Context, pubkey, groupID string) (bool, error)
+}
+
+// Message is what a template is executed with
+type Message struct {
+	Group     string
+	Label     string
+	Author    string // npub of the author
+	Content   string // media links point to the blossom server
+	Media     []string
+	CreatedAt time.Time
+}
+
+type route struct {
+	group   string
+	labels  []string
+	tmpl    *template.Template
+	channel webhook.Channel
+}
+
+type Bridge struct {
+	routes      []*route
+	admins      Admins
+	relayPubkey string
+	mediaURL    string
+}
+
+// New validates the routes and parses their templates, media links are rewritten to mediaURL
+func New(cfg *Config, admins Admins, relayPubkey, mediaURL string) (*Bridge, error) {
+	b := &Bridge{
+		admins:      admins,
+		relayPubkey: relayPubkey,
+		mediaURL:    mediaURL,
+	}
+
+	for i, rc := range cfg.Routes {
+		if rc.Group == "" {
+			return nil, fmt.Errorf("bridge route %d: missing group", i)
+		}
+
+		r := &route{
+			group:  rc.Group,
+			labels: rc.Labels,
+		}
+
+		if len(r.labels) == 0 {
+			r.labels = DefaultLabels
+		}
+
+		switch {
+		case rc.Discord != nil && rc.Telegram != nil:
+			return nil, fmt.Errorf("bridge route %d: only one of discord and telegram can be set", i)
+		case rc.Discord != nil && rc.Discord.URL != "":
+			r.channel = webhook.NewDiscord(rc.Discord.URL)
+		case rc.Telegram != nil && rc.Telegram.Token != "" && rc.Telegram.ChatID != "":
+			r.channel = webhook.NewTelegram(rc.Telegram.Token, rc.Telegram.ChatID)
+		default:
+			return nil, fmt.Errorf("bridge route %d: missing discord url or telegram token and chat id", i)
+		}
+
+		text := rc.Template
+		if text == "" {
+			text = DefaultTemplate
+		}
+
+		tmpl, err := template.New(fmt.Sprintf("route-%d", i)).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("bridge route %d: %w", i, err)
+		}
+
+		r.tmpl = tmpl
+		b.routes = append(b.routes, r)
+	}
+
+	return b, nil
+}
+
+// AddHooks forwards saved events to the matching routes
+func (b *Bridge) AddHooks(relay *khatru.Relay) {
+	relay.OnEventSaved = append(relay.OnEventSaved, b.OnEventSaved)
+}
+
+// OnEventSaved forwards a group event selected by an admin to the channels of its group
+func (b *Bridge) OnEventSaved(ctx context.Context, ev *nostr.Event) {
+	if !slices.Contains(contentKinds, ev.Kind) {
+		return
+	}
+
+	h := ev.Tags.GetFirst([]string{"h", ""})
+	if h == nil || len(*h) < 2 {
+		return
+	}
+
+	groupID := (*h)[1]
+
+	var checked, admin bool
+	for _, r := range b.routes {
+		if r.group != groupID {
+			continue
+		}
+
+		label := r.label(ev)
+		if label == "" {
+			continue
+		}
+
+		// only admins can select what is mirrored outside of the group
+		if !checked {
+			var err error
+			admin, err = b.isAdmin(ctx, ev.PubKey, groupID)
+			if err != nil {
+				log.Default().Println("bridge: failed to check admin:", err)
+				return
+			}
+			checked = true
+		}
+
+		if !admin {
+			return
+		}
+
+		err := b.forward(ctx, r, b.message(ev, groupID, label))
+		if err != nil {
+			log.Default().Printf("bridge: failed to forward event %s of group %s: %v", ev.ID, groupID, err)
+		}
+	}
+}
+
+func (b *Bridge) isAdmin(ctx context.Context, pubkey, groupID string) (bool, error) {
+	if pubkey == b.relayPubkey {
+		return true, nil
+	}
+
+	return b.admins.IsAdmin(ctx, pubkey, groupID)
+}
+
+// label returns the first label of the route the event is tagged with
+func (r *route) label(ev *nostr.Event) string {
+	for _, tag := range ev.Tags {
+		if len(tag) >= 2 && tag[0] == "t" && slices.Contains(r.labels, tag[1]) {
+			return tag[1]
+		}
+	}
+
+	return ""
+}
+
+func (b *Bridge) message(ev *nostr.Event, groupID, label string) *Message {
+	content, media := rewriteMedia(ev.Content, ev.Tags, b.mediaURL)
+
+	author := ev.PubKey
+	if npub, err := nip19.EncodePublicKey(ev.PubKey); err == nil {
+		author = npub
+	}
+
+	return &Message{
+		Group:     groupID,
+		Label:     label,
+		Author:    author,
+		Content:   content,
+		Media:     media,
+		CreatedAt: ev.CreatedAt.Time().UTC(),
+	}
+}
+
+func (b *Bridge) forward(ctx context.Context, r *route, m *Message) error {
+	var buf bytes.Buffer
+	err := r.tmpl.Execute(&buf, m)
+	if err != nil {
+		return err
+	}
+
+	if buf.Len() == 0 {
+		return errors.New("empty message")
+	}
+
+	return r.channel.Post(ctx, buf.String())
+}
@@ -0,0 +1,134 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const hash = "b1674191a88ec5cdd733e4240a81803105dc412d6c6708d53ab94fc248f4f553"
+
+func TestRewriteMedia(t *testing.T) {
+	content := "new logo https://cdn.example.com/" + hash + ".png and https://example.com/page"
+	tags := nostr.Tags{
+		{"imeta", "url https://cdn.example.com/" + hash + ".png", "x " + hash, "m image/png"},
+		{"imeta", "url https://other.example.com/video.mp4", "m video/mp4"},
+	}
+
+	got, media := rewriteMedia(content, tags, "https://relay.example.com/")
+
+	want := "new logo https://relay.example.com/" + hash + ".png and https://example.com/page"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// the image is already linked from the content
+	if len(media) != 1 || media[0] != "https://other.example.com/video.mp4" {
+		t.Errorf("unexpected media %v", media)
+	}
+
+	got, _ = rewriteMedia(content, tags, "")
+	if got != content {
+		t.Errorf("expected links to be kept without a media url, got %q", got)
+	}
+}
+
+type fakeAdmins []string
+
+func (a fakeAdmins) IsAdmin(ctx context.Context, pubkey, groupID string) (bool, error) {
+	for _, admin := range a {
+		if admin == pubkey {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func signed(t *testing.T, sk string, kind int, tags nostr.Tags, content string) *nostr.Event {
+	t.Helper()
+
+	ev := &nostr.Event{Kind: kind, CreatedAt: nostr.Now(), Tags: tags, Content: content}
+	err := ev.Sign(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ev
+}
+
+func TestOnEventSaved(t *testing.T) {
+	var mu sync.Mutex
+	var posted []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]string
+		json.NewDecoder(r.Body).Decode(&m)
+
+		mu.Lock()
+		posted = append(posted, m["content"])
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	adminSK := nostr.GeneratePrivateKey()
+	adminPK, _ := nostr.GetPublicKey(adminSK)
+	memberSK := nostr.GeneratePrivateKey()
+
+	b, err := New(&Config{Routes: []RouteConfig{
+		{Group: "demo", Discord: &DiscordConfig{URL: srv.URL}, Template: "{{.Label}}: {{.Content}}"},
+		{Group: "demo", Labels: []string{LabelPinned}, Discord: &DiscordConfig{URL: srv.URL}},
+	}}, fakeAdmins{adminPK}, "relay", "https://relay.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	// announcement by an admin goes to the first route only
+	b.OnEventSaved(ctx, signed(t, adminSK, 9, nostr.Tags{{"h", "demo"}, {"t", "announcement"}}, "meetup on friday"))
+	// members can't select events for bridging
+	b.OnEventSaved(ctx, signed(t, memberSK, 9, nostr.Tags{{"h", "demo"}, {"t", "announcement"}}, "spam"))
+	// untagged events and other groups are not bridged
+	b.OnEventSaved(ctx, signed(t, adminSK, 9, nostr.Tags{{"h", "demo"}}, "chatting"))
+	b.OnEventSaved(ctx, signed(t, adminSK, 9, nostr.Tags{{"h", "other"}, {"t", "announcement"}}, "elsewhere"))
+	// pinned messages go to both routes
+	b.OnEventSaved(ctx, signed(t, adminSK, 9, nostr.Tags{{"h", "demo"}, {"t", "pinned"}}, "rules"))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(posted) != 3 {
+		t.Fatalf("expected 3 messages, got %v", posted)
+	}
+
+	if posted[0] != "announcement: meetup on friday" || posted[1] != "pinned: rules" {
+		t.Errorf("unexpected messages %v", posted)
+	}
+
+	if !strings.HasPrefix(posted[2], "[demo] pinned:\nrules") {
+		t.Errorf("expected the default template, got %q", posted[2])
+	}
+}
+
+func TestNewRejectsInvalidRoutes(t *testing.T) {
+	for _, rc := range []RouteConfig{
+		{Discord: &DiscordConfig{URL: "https://discord.example.com"}},
+		{Group: "demo"},
+		{Group: "demo", Telegram: &TelegramConfig{Token: "token"}},
+		{Group: "demo", Discord: &DiscordConfig{URL: "https://discord.example.com"}, Template: "{{.Missing"},
+	} {
+		_, err := New(&Config{Routes: []RouteConfig{rc}}, fakeAdmins{}, "relay", "")
+		if err == nil {
+			t.Errorf("expected %+v to be rejected", rc)
+		}
+	}
+}
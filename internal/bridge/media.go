@@ -0,0 +1,57 @@
+package bridge
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// blobURL matches links to blobs addressed by their sha256, as served by blossom servers
+var blobURL = regexp.MustCompile(`https?://[^\s<>"]+/([0-9a-f]{64})(\.[a-z0-9]{1,8})?\b`)
+
+// rewriteMedia points the blob links of the content to the blossom server at mediaURL and
+// returns the media attached with imeta tags (NIP-92) that the content doesn't link to yet.
+// Links are left untouched when mediaURL is empty.
+func rewriteMedia(content string, tags nostr.Tags, mediaURL string) (string, []string) {
+	mediaURL = strings.TrimSuffix(mediaURL, "/")
+
+	if mediaURL != "" {
+		content = blobURL.ReplaceAllStringFunc(content, func(link string) string {
+			m := blobURL.FindStringSubmatch(link)
+			return mediaURL + "/" + m[1] + m[2]
+		})
+	}
+
+	media := []string{}
+	for _, tag := range tags {
+		if len(tag) < 2 || tag[0] != "imeta" {
+			continue
+		}
+
+		var link, hash string
+		for _, field := range tag[1:] {
+			key, value, _ := strings.Cut(field, " ")
+			switch key {
+			case "url":
+				link = value
+			case "x":
+				hash = value
+			}
+		}
+
+		if mediaURL != "" && hash != "" {
+			link = mediaURL + "/" + hash + path.Ext(link)
+		}
+
+		if link == "" || strings.Contains(content, link) || slices.Contains(media, link) {
+			continue
+		}
+
+		media = append(media, link)
+	}
+
+	return content, media
+}
@@ -1,135 +1,318 @@
 package bucket
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"mime/multipart"
+	"io"
+	"log"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
+var (
+	ErrNoProviders       = errors.New("no pinning providers configured")
+	ErrQuorumNotReached  = errors.New("pinning quorum not reached")
+	ErrProvidersMismatch = errors.New("pinning providers returned different hashes")
+	ErrNoGateway         = errors.New("no ipfs gateway configured")
+	ErrContentTooLarge   = errors.New("ipfs content is too large")
+)
+
+// every provider adds content as a single file with the same settings, so that they all
+// compute the same cid and pins can be compared across providers
 const (
-	PinFileURL = "/pinning/pinFileToIPFS"
-	PinJSONURL = "/pinning/pinJSONToIPFS"
-	UnpinURL   = "/pinning/unpin"
+	CIDVersion = 0
+	Chunker    = "size-262144"
 )
 
-type PinResponse struct {
-	IpfsHash  string `json:"IpfsHash"`
-	PinSize   int    `json:"PinSize"`
-	Timestamp string `json:"Timestamp"`
+// PinStore keeps track of the content pinned through the bucket
+type PinStore interface {
+	AddPin(cid string) error
+	RemovePin(cid string) error
+}
+
+// Provider is an IPFS pinning service
+type Provider interface {
+	Name() string
+	PinJSON(ctx context.Context, client *http.Client, data []byte) (string, error)
+	PinFile(ctx context.Context, client *http.Client, file []byte, name string) (string, error)
+	Unpin(ctx context.Context, client *http.Client, hash string) error
+}
+
+// StatusError is returned when a provider responds with an unexpected status code
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code from ipfs provider: %d", e.Code)
+}
+
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Code: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// Options configure how the bucket talks to its providers
+type Options struct {
+	Timeout time.Duration // timeout of a single request to a provider
+	Retries int           // number of retries after a failed request
+	Backoff time.Duration // initial wait before retrying, doubles every retry
+	Quorum  int           // number of providers that need to succeed
+
+	GatewayURL string // gateway used to fetch pinned content
+}
+
+// PinReport is the result of pinning content to all providers
+type PinReport struct {
+	Hash      string
+	Succeeded []string
+	Failed    map[string]error
+}
+
+func (r *PinReport) String() string {
+	failed := []string{}
+	for name, err := range r.Failed {
+		failed = append(failed, fmt.Sprintf("%s (%v)", name, err))
+	}
+
+	return fmt.Sprintf("hash: %s, succeeded: [%s], failed: [%s]", r.Hash, strings.Join(r.Succeeded, ", "), strings.Join(failed, ", "))
 }
 
 type Bucket struct {
-	BaseURL   string
-	APIKey    string
-	APISecret string
+	providers  []Provider
+	pins       PinStore
+	client     *http.Client
+	retries    int
+	backoff    time.Duration
+	quorum     int
+	gatewayURL string
 }
 
-func NewBucket(baseURL, apiKey, apiSecret string) *Bucket {
+// NewBucket creates a bucket that pins to all providers, the first provider is the primary one.
+// Pinned content is recorded in the pin store when one is provided.
+func NewBucket(opts Options, pins PinStore, providers ...Provider) *Bucket {
+	quorum := opts.Quorum
+	if quorum < 1 {
+		quorum = 1
+	}
+	if quorum > len(providers) {
+		quorum = len(providers)
+	}
+
 	return &Bucket{
-		BaseURL:   baseURL,
-		APIKey:    apiKey,
-		APISecret: apiSecret,
+		providers:  providers,
+		pins:       pins,
+		client:     &http.Client{Timeout: opts.Timeout},
+		retries:    opts.Retries,
+		backoff:    opts.Backoff,
+		quorum:     quorum,
+		gatewayURL: strings.TrimSuffix(opts.GatewayURL, "/"),
 	}
 }
 
 func (b *Bucket) PinJSONToIPFS(ctx context.Context, data []byte) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.BaseURL+PinJSONURL, bytes.NewReader(data))
+	report, err := b.pin(ctx, func(p Provider) (string, error) {
+		return p.PinJSON(ctx, b.client, data)
+	})
 	if err != nil {
 		return "", err
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("pinata_api_key", b.APIKey)
-	req.Header.Add("pinata_secret_api_key", b.APISecret)
+	b.addPin(report.Hash)
+
+	return report.Hash, nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
+func (b *Bucket) PinFileToIPFS(ctx context.Context, file []byte, name string) (string, error) {
+	report, err := b.pin(ctx, func(p Provider) (string, error) {
+		return p.PinFile(ctx, b.client, file, name)
+	})
 	if err != nil {
 		return "", err
 	}
 
-	defer resp.Body.Close()
+	b.addPin(report.Hash)
 
-	var pinResp PinResponse
-	if err := json.NewDecoder(resp.Body).Decode(&pinResp); err != nil {
-		return "", err
+	return fmt.Sprintf("ipfs://%s", report.Hash), nil
+}
+
+func (b *Bucket) Unpin(ctx context.Context, hash string) error {
+	report, err := b.pin(ctx, func(p Provider) (string, error) {
+		return hash, p.Unpin(ctx, b.client, hash)
+	})
+	if err != nil {
+		return err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", errors.New("error pinning to ipfs")
+	if len(report.Failed) > 0 {
+		log.Default().Println("unpinned with failures:", report)
+	}
+
+	if b.pins != nil {
+		err = b.pins.RemovePin(hash)
+		if err != nil {
+			log.Default().Println("error removing pin:", err)
+		}
 	}
 
-	return pinResp.IpfsHash, nil
+	return nil
 }
 
-func (b *Bucket) PinFileToIPFS(ctx context.Context, file []byte, name string) (string, error) {
-	payload := &bytes.Buffer{}
-	writer := multipart.NewWriter(payload)
+// Fetch retrieves pinned content from the gateway, content larger than maxSize is rejected
+func (b *Bucket) Fetch(ctx context.Context, cid string, maxSize int64) ([]byte, string, error) {
+	if b.gatewayURL == "" {
+		return nil, "", ErrNoGateway
+	}
+
+	var body []byte
+	var contentType string
+
+	err := b.withRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.gatewayURL+"/ipfs/"+cid, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := b.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		err = checkStatus(resp)
+		if err != nil {
+			return err
+		}
 
-	part1, err := writer.CreateFormFile("file", name)
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+		if err != nil {
+			return err
+		}
+
+		if int64(len(body)) > maxSize {
+			return ErrContentTooLarge
+		}
+
+		contentType = resp.Header.Get("Content-Type")
+
+		return nil
+	})
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
 
-	_, err = part1.Write(file)
-	if err != nil {
-		return "", err
+	return body, contentType, nil
+}
+
+func (b *Bucket) addPin(hash string) {
+	if b.pins == nil {
+		return
 	}
 
-	err = writer.Close()
+	err := b.pins.AddPin(hash)
 	if err != nil {
-		return "", err
+		log.Default().Println("error recording pin:", err)
 	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.BaseURL+PinFileURL, payload)
-	if err != nil {
-		return "", err
+// pin runs the call against all providers concurrently and checks that enough of them succeeded
+func (b *Bucket) pin(ctx context.Context, call func(p Provider) (string, error)) (*PinReport, error) {
+	if len(b.providers) == 0 {
+		return nil, ErrNoProviders
 	}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Add("pinata_api_key", b.APIKey)
-	req.Header.Add("pinata_secret_api_key", b.APISecret)
+	hashes := make([]string, len(b.providers))
+	errs := make([]error, len(b.providers))
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
+	var wg sync.WaitGroup
+	for i, p := range b.providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			errs[i] = b.withRetry(ctx, func() error {
+				h, err := call(p)
+				hashes[i] = h
+				return err
+			})
+		}()
 	}
-	defer resp.Body.Close()
+	wg.Wait()
 
-	var pinResp PinResponse
-	if err := json.NewDecoder(resp.Body).Decode(&pinResp); err != nil {
-		return "", err
+	report := &PinReport{
+		Succeeded: []string{},
+		Failed:    map[string]error{},
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", errors.New("error unpinning from ipfs")
+	for i, p := range b.providers {
+		if errs[i] != nil {
+			report.Failed[p.Name()] = errs[i]
+			continue
+		}
+
+		// the hash of the primary provider that succeeded is returned
+		if report.Hash == "" {
+			report.Hash = hashes[i]
+		} else if hashes[i] != report.Hash {
+			report.Failed[p.Name()] = fmt.Errorf("%w: %s", ErrProvidersMismatch, hashes[i])
+			continue
+		}
+
+		report.Succeeded = append(report.Succeeded, p.Name())
+	}
+
+	if len(report.Succeeded) < b.quorum {
+		return report, fmt.Errorf("%w (%d/%d): %s", ErrQuorumNotReached, len(report.Succeeded), b.quorum, report)
+	}
+
+	if len(report.Failed) > 0 {
+		log.Default().Println("pinned with failures:", report)
 	}
 
-	return fmt.Sprintf("ipfs://%s", pinResp.IpfsHash), nil
+	return report, nil
 }
 
-func (b *Bucket) Unpin(ctx context.Context, hash string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, b.BaseURL+UnpinURL+"/"+hash, nil)
-	if err != nil {
-		return err
+// withRetry retries the call with an exponential backoff when the error is retryable
+func (b *Bucket) withRetry(ctx context.Context, call func() error) error {
+	backoff := b.backoff
+
+	var err error
+	for attempt := 0; attempt <= b.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+		}
+
+		err = call()
+		if err == nil || !isRetryable(err) {
+			return err
+		}
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("pinata_api_key", b.APIKey)
-	req.Header.Add("pinata_secret_api_key", b.APISecret)
+	return err
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+// isRetryable returns true for network errors, rate limits and server errors
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrContentTooLarge) {
+		return false
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.New("error unpinning from ipfs")
+	var serr *StatusError
+	if errors.As(err, &serr) {
+		return serr.Code == http.StatusTooManyRequests || serr.Code >= http.StatusInternalServerError
 	}
 
-	return nil
+	return true
 }
@@ -0,0 +1,153 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type TestProvider struct {
+	name  string
+	hash  string
+	errs  []error // errors returned by consecutive calls
+	calls int
+}
+
+func (p *TestProvider) Name() string {
+	return p.name
+}
+
+func (p *TestProvider) next() (string, error) {
+	p.calls++
+	if p.calls <= len(p.errs) {
+		return "", p.errs[p.calls-1]
+	}
+
+	return p.hash, nil
+}
+
+func (p *TestProvider) PinJSON(ctx context.Context, client *http.Client, data []byte) (string, error) {
+	return p.next()
+}
+
+func (p *TestProvider) PinFile(ctx context.Context, client *http.Client, file []byte, name string) (string, error) {
+	return p.next()
+}
+
+func (p *TestProvider) Unpin(ctx context.Context, client *http.Client, hash string) error {
+	_, err := p.next()
+	return err
+}
+
+func TestBucket(t *testing.T) {
+	t.Run("retries server errors", func(t *testing.T) {
+		p := &TestProvider{name: "p1", hash: "Qm1", errs: []error{&StatusError{Code: http.StatusBadGateway}, &StatusError{Code: http.StatusTooManyRequests}}}
+
+		b := NewBucket(Options{Retries: 2}, nil, p)
+
+		hash, err := b.PinJSONToIPFS(context.Background(), []byte("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if hash != "Qm1" {
+			t.Errorf("expected hash Qm1, got %s", hash)
+		}
+
+		if p.calls != 3 {
+			t.Errorf("expected 3 calls, got %d", p.calls)
+		}
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		p := &TestProvider{name: "p1", hash: "Qm1", errs: []error{&StatusError{Code: http.StatusUnauthorized}}}
+
+		b := NewBucket(Options{Retries: 2}, nil, p)
+
+		_, err := b.PinJSONToIPFS(context.Background(), []byte("{}"))
+		if !errors.Is(err, ErrQuorumNotReached) {
+			t.Errorf("expected quorum error, got %v", err)
+		}
+
+		if p.calls != 1 {
+			t.Errorf("expected 1 call, got %d", p.calls)
+		}
+	})
+
+	t.Run("quorum", func(t *testing.T) {
+		p1 := &TestProvider{name: "p1", hash: "Qm1", errs: []error{&StatusError{Code: http.StatusUnauthorized}}}
+		p2 := &TestProvider{name: "p2", hash: "Qm1"}
+		p3 := &TestProvider{name: "p3", hash: "Qm1"}
+
+		b := NewBucket(Options{Quorum: 2}, nil, p1, p2, p3)
+
+		uri, err := b.PinFileToIPFS(context.Background(), []byte("file"), "file.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if uri != "ipfs://Qm1" {
+			t.Errorf("expected uri ipfs://Qm1, got %s", uri)
+		}
+
+		p1.calls, p2.calls, p3.calls = 0, 0, 0
+		p2.errs = []error{&StatusError{Code: http.StatusUnauthorized}}
+
+		_, err = b.PinFileToIPFS(context.Background(), []byte("file"), "file.jpg")
+		if !errors.Is(err, ErrQuorumNotReached) {
+			t.Errorf("expected quorum error, got %v", err)
+		}
+	})
+
+	t.Run("mismatching hashes do not count", func(t *testing.T) {
+		p1 := &TestProvider{name: "p1", hash: "Qm1"}
+		p2 := &TestProvider{name: "p2", hash: "Qm2"}
+
+		b := NewBucket(Options{Quorum: 2}, nil, p1, p2)
+
+		_, err := b.PinJSONToIPFS(context.Background(), []byte("{}"))
+		if !errors.Is(err, ErrQuorumNotReached) {
+			t.Errorf("expected quorum error, got %v", err)
+		}
+	})
+}
+
+func TestProvidersAddJSONAsFile(t *testing.T) {
+	data := []byte(`{"name":"test"}`)
+
+	pinata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != PinFileURL {
+			t.Errorf("expected json to be pinned as a file, got %s", r.URL.Path)
+		}
+
+		if opts := r.FormValue("pinataOptions"); opts != `{"cidVersion":0}` {
+			t.Errorf("unexpected pinata options %s", opts)
+		}
+
+		w.Write([]byte(`{"IpfsHash":"Qm1"}`))
+	}))
+	defer pinata.Close()
+
+	kubo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("cid-version") != "0" || q.Get("chunker") != Chunker || q.Get("raw-leaves") != "false" {
+			t.Errorf("unexpected add options %s", r.URL.RawQuery)
+		}
+
+		w.Write([]byte(`{"Hash":"Qm1"}`))
+	}))
+	defer kubo.Close()
+
+	b := NewBucket(Options{Quorum: 2}, nil, NewPinata(pinata.URL, "key", "secret"), NewKubo(kubo.URL))
+
+	hash, err := b.PinJSONToIPFS(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != "Qm1" {
+		t.Errorf("expected hash Qm1, got %s", hash)
+	}
+}
@@ -0,0 +1,114 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	KuboAddURL   = "/api/v0/add"
+	KuboUnpinURL = "/api/v0/pin/rm"
+)
+
+type KuboAddResponse struct {
+	Name string `json:"Name"`
+	Hash string `json:"Hash"`
+	Size string `json:"Size"`
+}
+
+// Kubo pins content using the RPC API of a self-hosted kubo node
+type Kubo struct {
+	BaseURL string
+}
+
+func NewKubo(baseURL string) *Kubo {
+	return &Kubo{
+		BaseURL: baseURL,
+	}
+}
+
+func (k *Kubo) Name() string {
+	return "kubo"
+}
+
+func (k *Kubo) PinJSON(ctx context.Context, client *http.Client, data []byte) (string, error) {
+	return k.add(ctx, client, data, "data.json")
+}
+
+func (k *Kubo) PinFile(ctx context.Context, client *http.Client, file []byte, name string) (string, error) {
+	return k.add(ctx, client, file, name)
+}
+
+func (k *Kubo) Unpin(ctx context.Context, client *http.Client, hash string) error {
+	q := url.Values{}
+	q.Set("arg", hash)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.BaseURL+KuboUnpinURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkStatus(resp)
+}
+
+func (k *Kubo) add(ctx context.Context, client *http.Client, data []byte, name string) (string, error) {
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+
+	part1, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = part1.Write(data)
+	if err != nil {
+		return "", err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("pin", "true")
+	q.Set("cid-version", strconv.Itoa(CIDVersion))
+	q.Set("chunker", Chunker)
+	q.Set("raw-leaves", "false")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.BaseURL+KuboAddURL+"?"+q.Encode(), payload)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	err = checkStatus(resp)
+	if err != nil {
+		return "", err
+	}
+
+	var addResp KuboAddResponse
+	if err := json.NewDecoder(resp.Body).Decode(&addResp); err != nil {
+		return "", err
+	}
+
+	return addResp.Hash, nil
+}
@@ -0,0 +1,123 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+)
+
+const (
+	PinFileURL = "/pinning/pinFileToIPFS"
+	UnpinURL   = "/pinning/unpin"
+)
+
+type PinResponse struct {
+	IpfsHash  string `json:"IpfsHash"`
+	PinSize   int    `json:"PinSize"`
+	Timestamp string `json:"Timestamp"`
+}
+
+// Pinata pins content using the Pinata API
+type Pinata struct {
+	BaseURL   string
+	APIKey    string
+	APISecret string
+}
+
+func NewPinata(baseURL, apiKey, apiSecret string) *Pinata {
+	return &Pinata{
+		BaseURL:   baseURL,
+		APIKey:    apiKey,
+		APISecret: apiSecret,
+	}
+}
+
+func (p *Pinata) Name() string {
+	return "pinata"
+}
+
+// PinJSON adds the json as a file, pinJSONToIPFS re-encodes it and the cid would not match other providers
+func (p *Pinata) PinJSON(ctx context.Context, client *http.Client, data []byte) (string, error) {
+	return p.PinFile(ctx, client, data, "data.json")
+}
+
+func (p *Pinata) PinFile(ctx context.Context, client *http.Client, file []byte, name string) (string, error) {
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+
+	part1, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = part1.Write(file)
+	if err != nil {
+		return "", err
+	}
+
+	err = writer.WriteField("pinataOptions", fmt.Sprintf(`{"cidVersion":%d}`, CIDVersion))
+	if err != nil {
+		return "", err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+PinFileURL, payload)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	p.authorize(req)
+
+	return p.pin(client, req)
+}
+
+func (p *Pinata) Unpin(ctx context.Context, client *http.Client, hash string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, p.BaseURL+UnpinURL+"/"+hash, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	p.authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkStatus(resp)
+}
+
+func (p *Pinata) authorize(req *http.Request) {
+	req.Header.Add("pinata_api_key", p.APIKey)
+	req.Header.Add("pinata_secret_api_key", p.APISecret)
+}
+
+func (p *Pinata) pin(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	err = checkStatus(resp)
+	if err != nil {
+		return "", err
+	}
+
+	var pinResp PinResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pinResp); err != nil {
+		return "", err
+	}
+
+	return pinResp.IpfsHash, nil
+}
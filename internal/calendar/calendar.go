@@ -0,0 +1,154 @@
+// Package calendar serves the NIP-52 calendar events of a group as an iCalendar feed (RFC 5545),
+// so that members can subscribe to their group from regular calendar apps.
+//
+// Calendar apps can't sign requests, the feed is public like the events it is made of.
+package calendar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/go-chi/chi/v5"
+)
+
+// how far back ended events are kept in the feed
+const history = 90 * 24 * time.Hour
+
+// Groups reads the calendar events of groups
+type Groups interface {
+	GroupExists(ctx context.Context, groupID string) (bool, error)
+	GetGroupMetadata(ctx context.Context, groupID string) (*groups.GroupMetadata, error)
+	CalendarEvents(ctx context.Context, groupID string, since time.Time) ([]*groups.CalendarEvent, error)
+}
+
+type Service struct {
+	groups Groups
+
+	now func() time.Time
+}
+
+func NewService(g Groups) *Service {
+	return &Service{
+		groups: g,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// ICS returns the calendar of a group as an iCalendar feed
+func (s *Service) ICS(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "group_id")
+
+	exists, err := s.groups.GroupExists(r.Context(), groupID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	name := groupID
+	meta, err := s.groups.GetGroupMetadata(r.Context(), groupID)
+	if err == nil && meta.Name != "" {
+		name = meta.Name
+	}
+
+	events, err := s.groups.CalendarEvents(r.Context(), groupID, s.now().Add(-history))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", groupID+".ics"))
+	w.Write([]byte(Render(name, events)))
+}
+
+// Render writes calendar events as an iCalendar document
+func Render(name string, events []*groups.CalendarEvent) string {
+	var b strings.Builder
+
+	line := func(l string) {
+		b.WriteString(fold(l))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//comunifi//relay//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escape(name))
+
+	for _, ev := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + escape(ev.Address()))
+		line("DTSTAMP:" + ev.Event.CreatedAt.Time().UTC().Format("20060102T150405Z"))
+
+		if ev.AllDay {
+			line("DTSTART;VALUE=DATE:" + ev.Start.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + ev.End.Format("20060102"))
+		} else {
+			line("DTSTART:" + ev.Start.Format("20060102T150405Z"))
+			line("DTEND:" + ev.End.Format("20060102T150405Z"))
+		}
+
+		line("SUMMARY:" + escape(ev.Title))
+
+		description := ev.Event.Content
+		if description == "" {
+			description = ev.Summary
+		}
+		if description != "" {
+			line("DESCRIPTION:" + escape(description))
+		}
+
+		if ev.Location != "" {
+			line("LOCATION:" + escape(ev.Location))
+		}
+
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+
+	return b.String()
+}
+
+// escape escapes a text value
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+// fold splits a content line into lines of at most 75 octets without breaking a character
+func fold(l string) string {
+	const max = 75
+
+	var b strings.Builder
+	n := 0
+	for _, r := range l {
+		size := len(string(r))
+		if n+size > max {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+
+		b.WriteRune(r)
+		n += size
+	}
+
+	return b.String()
+}
@@ -0,0 +1,157 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// fakeGroups lists calendar events of the groups of the shared fake
+type fakeGroups struct {
+	testutil.FakeGroups
+
+	events []*groups.CalendarEvent
+	since  time.Time
+}
+
+func (g *fakeGroups) GetGroupMetadata(ctx context.Context, groupID string) (*groups.GroupMetadata, error) {
+	return nil, errors.New("group not found")
+}
+
+func (g *fakeGroups) CalendarEvents(ctx context.Context, groupID string, since time.Time) ([]*groups.CalendarEvent, error) {
+	g.since = since
+	return g.events, nil
+}
+
+func calendarEvent(t *testing.T, kind int, tags nostr.Tags, content string) *groups.CalendarEvent {
+	t.Helper()
+
+	ev := &nostr.Event{
+		Kind:      kind,
+		PubKey:    "pubkey",
+		CreatedAt: nostr.Timestamp(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()),
+		Tags:      tags,
+		Content:   content,
+	}
+
+	c, err := groups.ParseCalendarEvent(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestRender(t *testing.T) {
+	start := time.Date(2025, 3, 1, 18, 30, 0, 0, time.UTC)
+
+	events := []*groups.CalendarEvent{
+		calendarEvent(t, groups.KindCalendarDate, nostr.Tags{{"d", "fair"}, {"title", "Fair"}, {"start", "2025-02-10"}, {"end", "2025-02-12"}}, ""),
+		calendarEvent(t, groups.KindCalendarTime, nostr.Tags{
+			{"d", "meetup"},
+			{"title", "Meetup; drinks, food"},
+			{"start", "1740853800"},
+			{"location", "Café du Marché"},
+		}, "bring\nfriends"),
+	}
+
+	if !events[1].Start.Equal(start) {
+		t.Fatalf("unexpected start %s", events[1].Start)
+	}
+
+	got := Render("Group", events)
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"X-WR-CALNAME:Group\r\n",
+		"UID:31922:pubkey:fair\r\n",
+		"DTSTART;VALUE=DATE:20250210\r\nDTEND;VALUE=DATE:20250212\r\n",
+		"DTSTART:20250301T183000Z\r\nDTEND:20250301T183000Z\r\n",
+		"SUMMARY:Meetup\\; drinks\\, food\r\n",
+		"DESCRIPTION:bring\\nfriends\r\n",
+		"LOCATION:Café du Marché\r\n",
+		"DTSTAMP:20250101T000000Z\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in\n%s", want, got)
+		}
+	}
+
+	if strings.Count(got, "BEGIN:VEVENT") != 2 {
+		t.Errorf("expected two events in\n%s", got)
+	}
+}
+
+func TestFold(t *testing.T) {
+	l := "DESCRIPTION:" + strings.Repeat("é", 70)
+
+	folded := fold(l)
+	for _, part := range strings.Split(folded, "\r\n") {
+		if len(part) > 75 {
+			t.Fatalf("line of %d octets", len(part))
+		}
+	}
+
+	if strings.ReplaceAll(folded, "\r\n ", "") != l {
+		t.Fatalf("unfolding changed the line: %q", folded)
+	}
+}
+
+func TestICS(t *testing.T) {
+	g := &fakeGroups{
+		FakeGroups: testutil.FakeGroups{Members: map[string][]string{"group": {}}},
+		events: []*groups.CalendarEvent{
+			calendarEvent(t, groups.KindCalendarDate, nostr.Tags{{"d", "fair"}, {"title", "Fair"}, {"start", "2025-02-10"}}, ""),
+		},
+	}
+
+	s := NewService(g)
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	get := func(groupID string) *httptest.ResponseRecorder {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("group_id", groupID)
+
+		r := httptest.NewRequest(http.MethodGet, "/v1/groups/"+groupID+"/calendar.ics", nil)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+		s.ICS(w, r)
+
+		return w
+	}
+
+	w := get("other")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected an unknown group to be not found, got %d", w.Code)
+	}
+
+	w = get("group")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the calendar, got %d", w.Code)
+	}
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("unexpected content type %s", w.Header().Get("Content-Type"))
+	}
+
+	// the name falls back to the id of the group without metadata
+	if !strings.Contains(w.Body.String(), "X-WR-CALNAME:group\r\n") || !strings.Contains(w.Body.String(), "SUMMARY:Fair\r\n") {
+		t.Fatalf("unexpected calendar\n%s", w.Body.String())
+	}
+
+	if !g.since.Equal(now.Add(-history)) {
+		t.Fatalf("expected events since %s, got %s", now.Add(-history), g.since)
+	}
+}
@@ -2,6 +2,7 @@ package chain
 
 import (
 	"encoding/json"
+	"io"
 	"math/big"
 	"net/http"
 
@@ -11,171 +12,157 @@ import (
 type Service struct {
 	evm     relay.EVMRequester
 	chainId *big.Int
+	limits  Limits
+	logs    *logsCache
 }
 
 // NewService
-func NewService(evm relay.EVMRequester, chid *big.Int) *Service {
+func NewService(evm relay.EVMRequester, chid *big.Int, limits Limits) *Service {
 	return &Service{
 		evm,
 		chid,
+		limits,
+		newLogsCache(logsCacheEntries),
 	}
 }
 
-func (s *Service) ChainId(r *http.Request) (any, error) {
-	// Return the message ID
-	return s.chainId.String(), nil
-}
-
-func (s *Service) EthCall(r *http.Request) (any, error) {
-
-	var params json.RawMessage
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		return nil, err
+// Methods returns the handlers of the methods that are allowed to be proxied
+func (s *Service) Methods() map[string]relay.RPCHandlerFunc {
+	all := map[string]relay.RPCHandlerFunc{
+		"eth_chainId":               s.ChainId,
+		"eth_call":                  s.EthCall,
+		"eth_blockNumber":           s.EthBlockNumber,
+		"eth_getBlockByNumber":      s.EthGetBlockByNumber,
+		"eth_maxPriorityFeePerGas":  s.EthMaxPriorityFeePerGas,
+		"eth_getTransactionReceipt": s.EthGetTransactionReceipt,
+		"eth_getTransactionCount":   s.EthGetTransactionCount,
+		"eth_estimateGas":           s.EthEstimateGas,
+		"eth_gasPrice":              s.EthGasPrice,
+		"eth_sendRawTransaction":    s.EthSendRawTransaction,
+		"eth_getLogs":               s.EthGetLogs,
 	}
 
-	var result any
-	err := s.evm.Call("eth_call", &result, params)
-	if err != nil {
-		println(err.Error())
-		return nil, err
+	if len(s.limits.Methods) == 0 {
+		return all
 	}
 
-	return result, nil
-}
-
-func (s *Service) EthBlockNumber(r *http.Request) (any, error) {
-
-	var params json.RawMessage
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		return nil, err
-	}
+	allowed := map[string]relay.RPCHandlerFunc{}
+	for _, m := range s.limits.Methods {
+		h, ok := all[m]
+		if !ok {
+			continue
+		}
 
-	var result any
-	err := s.evm.Call("eth_blockNumber", &result, params)
-	if err != nil {
-		println(err.Error())
-		return nil, err
+		allowed[m] = h
 	}
 
-	return result, nil
+	return allowed
 }
 
-func (s *Service) EthGetBlockByNumber(r *http.Request) (any, error) {
+func (s *Service) ChainId(r *http.Request) (any, error) {
+	// Return the message ID
+	return s.chainId.String(), nil
+}
 
-	var params json.RawMessage
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		return nil, err
-	}
+func (s *Service) EthCall(r *http.Request) (any, error) {
+	return s.proxy(r, "eth_call", callParams)
+}
 
-	var result any
-	err := s.evm.Call("eth_getBlockByNumber", &result, params)
-	if err != nil {
-		println(err.Error())
-		return nil, err
-	}
+func (s *Service) EthBlockNumber(r *http.Request) (any, error) {
+	return s.proxy(r, "eth_blockNumber", noParams)
+}
 
-	return result, nil
+func (s *Service) EthGetBlockByNumber(r *http.Request) (any, error) {
+	return s.proxy(r, "eth_getBlockByNumber", getBlockByNumberParams)
 }
 
 func (s *Service) EthMaxPriorityFeePerGas(r *http.Request) (any, error) {
+	return s.proxy(r, "eth_maxPriorityFeePerGas", noParams)
+}
 
-	var params json.RawMessage
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		return nil, err
-	}
+func (s *Service) EthGetTransactionReceipt(r *http.Request) (any, error) {
+	return s.proxy(r, "eth_getTransactionReceipt", getTransactionReceiptParams)
+}
 
-	var result any
-	err := s.evm.Call("eth_maxPriorityFeePerGas", &result, params)
-	if err != nil {
-		println(err.Error())
-		return nil, err
-	}
+func (s *Service) EthGetTransactionCount(r *http.Request) (any, error) {
+	return s.proxy(r, "eth_getTransactionCount", getTransactionCountParams)
+}
 
-	return result, nil
+func (s *Service) EthEstimateGas(r *http.Request) (any, error) {
+	return s.proxy(r, "eth_estimateGas", callParams)
+}
 
+func (s *Service) EthGasPrice(r *http.Request) (any, error) {
+	return s.proxy(r, "eth_gasPrice", noParams)
 }
 
-func (s *Service) EthGetTransactionReceipt(r *http.Request) (any, error) {
+func (s *Service) EthSendRawTransaction(r *http.Request) (any, error) {
+	return s.proxy(r, "eth_sendRawTransaction", sendRawTransactionParams)
+}
 
-	var params json.RawMessage
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		return nil, err
+// proxy validates the params of a method and forwards it to the upstream node
+func (s *Service) proxy(r *http.Request, method string, validate validator) (any, error) {
+	// params can be omitted for methods without arguments
+	var params []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && err != io.EOF {
+		return nil, invalidParams("expected an array of arguments")
 	}
 
-	var result any
-	err := s.evm.Call("eth_getTransactionReceipt", &result, params)
+	blocks, err := validate(s.limits, params)
 	if err != nil {
-		println(err.Error())
 		return nil, err
 	}
 
-	return result, nil
-}
-
-func (s *Service) EthGetTransactionCount(r *http.Request) (any, error) {
-
-	var params json.RawMessage
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		return nil, err
-	}
-
-	var result any
-	err := s.evm.Call("eth_getTransactionCount", &result, params)
+	err = s.checkBlockRange(blocks)
 	if err != nil {
-		println(err.Error())
 		return nil, err
 	}
 
-	return result, nil
-}
-
-func (s *Service) EthEstimateGas(r *http.Request) (any, error) {
-
-	var params json.RawMessage
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+	raw, err := json.Marshal(params)
+	if err != nil {
 		return nil, err
 	}
 
-	var result any
-	err := s.evm.Call("eth_estimateGas", &result, params)
+	var result json.RawMessage
+	err = s.evm.Call(method, &result, raw)
 	if err != nil {
 		println(err.Error())
 		return nil, err
 	}
 
+	if s.limits.MaxResponseSize > 0 && len(result) > s.limits.MaxResponseSize {
+		return nil, &rpcError{code: ErrCodeResponseTooLarge, msg: "response too large"}
+	}
+
 	return result, nil
 }
 
-func (s *Service) EthGasPrice(r *http.Request) (any, error) {
-
-	var params json.RawMessage
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		return nil, err
+// checkBlockRange checks that the queried blocks are not too far behind the latest block
+func (s *Service) checkBlockRange(blocks []*big.Int) error {
+	if s.limits.MaxBlockRange == 0 {
+		return nil
 	}
 
-	var result any
-	err := s.evm.Call("eth_gasPrice", &result, params)
-	if err != nil {
-		println(err.Error())
-		return nil, err
+	var oldest *big.Int
+	for _, n := range blocks {
+		if n != nil && (oldest == nil || n.Cmp(oldest) < 0) {
+			oldest = n
+		}
 	}
 
-	return result, nil
-}
-
-func (s *Service) EthSendRawTransaction(r *http.Request) (any, error) {
-
-	var params json.RawMessage
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		return nil, err
+	if oldest == nil {
+		return nil
 	}
 
-	var result any
-	err := s.evm.Call("eth_sendRawTransaction", &result, params)
+	latest, err := s.evm.LatestBlock()
 	if err != nil {
-		println(err.Error())
-		return nil, err
+		return err
 	}
 
-	return result, nil
+	min := new(big.Int).Sub(latest, new(big.Int).SetUint64(s.limits.MaxBlockRange))
+	if oldest.Cmp(min) < 0 {
+		return invalidParams("block is more than %d blocks behind the latest block", s.limits.MaxBlockRange)
+	}
+
+	return nil
 }
@@ -0,0 +1,252 @@
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type testEVM struct {
+	relay.EVMRequester
+
+	latest  int64
+	result  string
+	calls   []string
+	queries []ethereum.FilterQuery
+}
+
+func (e *testEVM) FilterLogs(q ethereum.FilterQuery) ([]types.Log, error) {
+	e.queries = append(e.queries, q)
+	return []types.Log{{Address: q.Addresses[0], Topics: []common.Hash{{0x01}}, Data: []byte{}}}, nil
+}
+
+func (e *testEVM) LatestBlock() (*big.Int, error) {
+	return big.NewInt(e.latest), nil
+}
+
+func (e *testEVM) Call(method string, result any, params json.RawMessage) error {
+	e.calls = append(e.calls, method)
+	return json.Unmarshal([]byte(e.result), result)
+}
+
+func request(params string) *http.Request {
+	return httptest.NewRequest(http.MethodPost, "/", strings.NewReader(params))
+}
+
+func errorCode(err error) int {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.ErrorCode()
+	}
+
+	return 0
+}
+
+func TestProxyValidation(t *testing.T) {
+	limits := Limits{MaxCallData: 8, MaxBlockRange: 100, MaxResponseSize: 64}
+
+	to := `"to":"0x5FbDB2315678afecb367f032d93F642f64180aa3"`
+
+	tests := []struct {
+		name    string
+		handler func(s *Service) relay.RPCHandlerFunc
+		params  string
+		valid   bool
+	}{
+		{"call", func(s *Service) relay.RPCHandlerFunc { return s.EthCall }, `[{` + to + `,"data":"0x01020304"},"latest"]`, true},
+		{"call without block", func(s *Service) relay.RPCHandlerFunc { return s.EthCall }, `[{` + to + `}]`, true},
+		{"call with recent block", func(s *Service) relay.RPCHandlerFunc { return s.EthCall }, `[{` + to + `},"0x3e8"]`, true},
+		{"call with block hash", func(s *Service) relay.RPCHandlerFunc { return s.EthCall }, `[{` + to + `},{"blockHash":"0x` + strings.Repeat("ab", 32) + `"}]`, true},
+		{"call data too large", func(s *Service) relay.RPCHandlerFunc { return s.EthCall }, `[{` + to + `,"data":"0x` + strings.Repeat("00", 9) + `"},"latest"]`, false},
+		{"call with invalid data", func(s *Service) relay.RPCHandlerFunc { return s.EthCall }, `[{` + to + `,"input":"0xzz"}]`, false},
+		{"call with invalid address", func(s *Service) relay.RPCHandlerFunc { return s.EthCall }, `[{"to":"0x1234"}]`, false},
+		{"call with state overrides", func(s *Service) relay.RPCHandlerFunc { return s.EthCall }, `[{` + to + `},"latest",{}]`, false},
+		{"call with old block", func(s *Service) relay.RPCHandlerFunc { return s.EthCall }, `[{` + to + `},"0x1"]`, false},
+		{"call with earliest block", func(s *Service) relay.RPCHandlerFunc { return s.EthCall }, `[{` + to + `},"earliest"]`, false},
+		{"block number", func(s *Service) relay.RPCHandlerFunc { return s.EthBlockNumber }, `[]`, true},
+		{"block number without params", func(s *Service) relay.RPCHandlerFunc { return s.EthBlockNumber }, ``, true},
+		{"block number with params", func(s *Service) relay.RPCHandlerFunc { return s.EthBlockNumber }, `["latest"]`, false},
+		{"block by number", func(s *Service) relay.RPCHandlerFunc { return s.EthGetBlockByNumber }, `["latest",false]`, true},
+		{"block by number missing flag", func(s *Service) relay.RPCHandlerFunc { return s.EthGetBlockByNumber }, `["latest"]`, false},
+		{"block by invalid number", func(s *Service) relay.RPCHandlerFunc { return s.EthGetBlockByNumber }, `["next",false]`, false},
+		{"receipt", func(s *Service) relay.RPCHandlerFunc { return s.EthGetTransactionReceipt }, `["0x` + strings.Repeat("ab", 32) + `"]`, true},
+		{"receipt with invalid hash", func(s *Service) relay.RPCHandlerFunc { return s.EthGetTransactionReceipt }, `["0xabcd"]`, false},
+		{"transaction count", func(s *Service) relay.RPCHandlerFunc { return s.EthGetTransactionCount }, `["0x5FbDB2315678afecb367f032d93F642f64180aa3","pending"]`, true},
+		{"transaction count invalid address", func(s *Service) relay.RPCHandlerFunc { return s.EthGetTransactionCount }, `["alice","pending"]`, false},
+		{"raw transaction", func(s *Service) relay.RPCHandlerFunc { return s.EthSendRawTransaction }, `["0x0102"]`, true},
+		{"raw transaction too large", func(s *Service) relay.RPCHandlerFunc { return s.EthSendRawTransaction }, `["0x` + strings.Repeat("00", 9) + `"]`, false},
+		{"params not an array", func(s *Service) relay.RPCHandlerFunc { return s.EthGasPrice }, `{}`, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			evm := &testEVM{latest: 1000, result: `"0x1"`}
+			s := NewService(evm, big.NewInt(1), limits)
+
+			_, err := tc.handler(s)(request(tc.params))
+			if tc.valid {
+				if err != nil {
+					t.Fatalf("expected valid params, got %v", err)
+				}
+
+				if len(evm.calls) != 1 {
+					t.Fatalf("expected the call to be proxied, got %v", evm.calls)
+				}
+
+				return
+			}
+
+			if errorCode(err) != ErrCodeInvalidParams {
+				t.Fatalf("expected invalid params error, got %v", err)
+			}
+
+			if len(evm.calls) != 0 {
+				t.Fatalf("expected the call not to be proxied, got %v", evm.calls)
+			}
+		})
+	}
+}
+
+func TestProxyResponseSize(t *testing.T) {
+	evm := &testEVM{latest: 1000, result: `"0x` + strings.Repeat("00", 64) + `"`}
+	s := NewService(evm, big.NewInt(1), Limits{MaxResponseSize: 64})
+
+	_, err := s.EthCall(request(`[{"data":"0x"}]`))
+	if errorCode(err) != ErrCodeResponseTooLarge {
+		t.Fatalf("expected response too large, got %v", err)
+	}
+}
+
+func TestMethodsAllowlist(t *testing.T) {
+	s := NewService(&testEVM{}, big.NewInt(1), DefaultLimits)
+
+	if len(s.Methods()) != 11 {
+		t.Fatalf("expected all methods to be allowed by default, got %d", len(s.Methods()))
+	}
+
+	s = NewService(&testEVM{}, big.NewInt(1), Limits{Methods: []string{"eth_chainId", "eth_call", "eth_unknown"}})
+
+	methods := s.Methods()
+	if len(methods) != 2 {
+		t.Fatalf("expected 2 methods, got %d", len(methods))
+	}
+
+	if _, ok := methods["eth_sendRawTransaction"]; ok {
+		t.Fatal("expected eth_sendRawTransaction not to be allowed")
+	}
+}
+
+func TestEthGetLogs(t *testing.T) {
+	limits := Limits{MaxBlockRange: 10_000, MaxLogsBlockRange: 100, MaxLogsAddresses: 2, LogsCacheTTL: time.Minute}
+
+	addr := `"0x5FbDB2315678afecb367f032d93F642f64180aa3"`
+	topic := `"0x` + strings.Repeat("ab", 32) + `"`
+
+	tests := []struct {
+		name   string
+		params string
+		valid  bool
+	}{
+		{"latest", `[{"address":` + addr + `}]`, true},
+		{"range", `[{"address":[` + addr + `],"fromBlock":"0x3b6","toBlock":"0x3e8"}]`, true},
+		{"topics", `[{"address":` + addr + `,"topics":[` + topic + `,null,[` + topic + `,` + topic + `]]}]`, true},
+		{"block hash", `[{"address":` + addr + `,"blockHash":` + topic + `}]`, true},
+		{"no address", `[{"fromBlock":"latest"}]`, false},
+		{"too many addresses", `[{"address":[` + addr + `,` + addr + `,` + addr + `]}]`, false},
+		{"invalid address", `[{"address":"0x1234"}]`, false},
+		{"range too large", `[{"address":` + addr + `,"fromBlock":"0x0","toBlock":"0x3e8"}]`, false},
+		{"range from earliest", `[{"address":` + addr + `,"fromBlock":"earliest"}]`, false},
+		{"reversed range", `[{"address":` + addr + `,"fromBlock":"0x3e8","toBlock":"0x3e7"}]`, false},
+		{"block hash and range", `[{"address":` + addr + `,"blockHash":` + topic + `,"fromBlock":"0x1"}]`, false},
+		{"too many topics", `[{"address":` + addr + `,"topics":[null,null,null,null,null]}]`, false},
+		{"invalid topic", `[{"address":` + addr + `,"topics":["0x01"]}]`, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			evm := &testEVM{latest: 1000}
+			s := NewService(evm, big.NewInt(1), limits)
+
+			_, err := s.EthGetLogs(request(tc.params))
+			if tc.valid {
+				if err != nil {
+					t.Fatalf("expected valid filter, got %v", err)
+				}
+
+				if len(evm.queries) != 1 {
+					t.Fatalf("expected 1 query, got %d", len(evm.queries))
+				}
+
+				return
+			}
+
+			if errorCode(err) != ErrCodeInvalidParams {
+				t.Fatalf("expected invalid params error, got %v", err)
+			}
+
+			if len(evm.queries) != 0 {
+				t.Fatal("expected the logs not to be queried")
+			}
+		})
+	}
+}
+
+func TestEthGetLogsCache(t *testing.T) {
+	evm := &testEVM{latest: 1000}
+	s := NewService(evm, big.NewInt(1), Limits{MaxLogsAddresses: 1, MaxLogsBlockRange: 100, LogsCacheTTL: time.Minute})
+
+	now := time.Unix(1700000000, 0)
+	s.logs.now = func() time.Time { return now }
+
+	params := `[{"address":"0x5FbDB2315678afecb367f032d93F642f64180aa3"}]`
+
+	for i := 0; i < 2; i++ {
+		_, err := s.EthGetLogs(request(params))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(evm.queries) != 1 {
+		t.Fatalf("expected the second query to be cached, got %d queries", len(evm.queries))
+	}
+
+	// latest is resolved before caching, a new block is a new query
+	evm.latest = 1001
+
+	_, err := s.EthGetLogs(request(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(evm.queries) != 2 {
+		t.Fatalf("expected a new block to miss the cache, got %d queries", len(evm.queries))
+	}
+
+	q := evm.queries[1]
+	if q.FromBlock.Int64() != 1001 || q.ToBlock.Int64() != 1001 {
+		t.Fatalf("expected latest to resolve to 1001, got %s-%s", q.FromBlock, q.ToBlock)
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	_, err = s.EthGetLogs(request(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(evm.queries) != 3 {
+		t.Fatalf("expected expired entries to be queried again, got %d queries", len(evm.queries))
+	}
+}
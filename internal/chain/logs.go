@@ -0,0 +1,322 @@
+package chain
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// max number of alternatives for a single topic position
+const maxTopicOptions = 16
+
+type logsFilter struct {
+	FromBlock *json.RawMessage  `json:"fromBlock"`
+	ToBlock   *json.RawMessage  `json:"toBlock"`
+	BlockHash *common.Hash      `json:"blockHash"`
+	Address   json.RawMessage   `json:"address"`
+	Topics    []json.RawMessage `json:"topics"`
+}
+
+// EthGetLogs serves eth_getLogs with FilterLogs instead of passing the filter through,
+// queries must target addresses and a bounded block range
+func (s *Service) EthGetLogs(r *http.Request) (any, error) {
+	var params []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && err != io.EOF {
+		return nil, invalidParams("expected an array of arguments")
+	}
+
+	err := argCount(params, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var f logsFilter
+	err = json.Unmarshal(params[0], &f)
+	if err != nil {
+		return nil, invalidParams("filter: %v", err)
+	}
+
+	q, err := s.filterQuery(f)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cacheKey(q)
+
+	if b, ok := s.logs.get(key); ok {
+		return b, nil
+	}
+
+	logs, err := s.evm.FilterLogs(q)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(logs)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.limits.MaxResponseSize > 0 && len(b) > s.limits.MaxResponseSize {
+		return nil, &rpcError{code: ErrCodeResponseTooLarge, msg: "response too large, query a smaller block range"}
+	}
+
+	s.logs.set(key, b, s.limits.LogsCacheTTL)
+
+	return json.RawMessage(b), nil
+}
+
+// filterQuery validates a filter and resolves it to a query on fixed block numbers
+func (s *Service) filterQuery(f logsFilter) (ethereum.FilterQuery, error) {
+	q := ethereum.FilterQuery{}
+
+	addresses, err := parseAddresses(f.Address)
+	if err != nil {
+		return q, err
+	}
+
+	if len(addresses) == 0 {
+		return q, invalidParams("at least one address is required")
+	}
+
+	if s.limits.MaxLogsAddresses > 0 && len(addresses) > s.limits.MaxLogsAddresses {
+		return q, invalidParams("at most %d addresses can be queried", s.limits.MaxLogsAddresses)
+	}
+
+	q.Addresses = addresses
+
+	q.Topics, err = parseTopics(f.Topics)
+	if err != nil {
+		return q, err
+	}
+
+	if f.BlockHash != nil {
+		if f.FromBlock != nil || f.ToBlock != nil {
+			return q, invalidParams("blockHash cannot be combined with fromBlock or toBlock")
+		}
+
+		q.BlockHash = f.BlockHash
+
+		return q, nil
+	}
+
+	var latest *big.Int
+
+	// resolve tags to block numbers so that the query (and its cache key) is fixed
+	resolve := func(raw *json.RawMessage) (*big.Int, error) {
+		var n *big.Int
+		if raw != nil {
+			var err error
+			n, err = blockParam(*raw)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if n != nil {
+			return n, nil
+		}
+
+		if latest == nil {
+			var err error
+			latest, err = s.evm.LatestBlock()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return latest, nil
+	}
+
+	q.FromBlock, err = resolve(f.FromBlock)
+	if err != nil {
+		return q, err
+	}
+
+	q.ToBlock, err = resolve(f.ToBlock)
+	if err != nil {
+		return q, err
+	}
+
+	if q.FromBlock.Cmp(q.ToBlock) > 0 {
+		return q, invalidParams("fromBlock is after toBlock")
+	}
+
+	span := new(big.Int).Sub(q.ToBlock, q.FromBlock)
+	if s.limits.MaxLogsBlockRange > 0 && span.Cmp(new(big.Int).SetUint64(s.limits.MaxLogsBlockRange)) > 0 {
+		return q, invalidParams("at most %d blocks can be queried", s.limits.MaxLogsBlockRange)
+	}
+
+	err = s.checkBlockRange([]*big.Int{q.FromBlock})
+	if err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+// parseAddresses parses a single address or an array of addresses
+func parseAddresses(raw json.RawMessage) ([]common.Address, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var list []string
+
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		list = []string{single}
+	} else if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, invalidParams("invalid address")
+	}
+
+	addresses := make([]common.Address, 0, len(list))
+	for _, a := range list {
+		if !common.IsHexAddress(a) {
+			return nil, invalidParams("invalid address %s", a)
+		}
+
+		addresses = append(addresses, common.HexToAddress(a))
+	}
+
+	return addresses, nil
+}
+
+// parseTopics parses topic positions, each a null wildcard, a hash or an array of hashes
+func parseTopics(raw []json.RawMessage) ([][]common.Hash, error) {
+	if len(raw) > 4 {
+		return nil, invalidParams("at most 4 topics can be filtered")
+	}
+
+	topics := make([][]common.Hash, len(raw))
+	for i, r := range raw {
+		if string(r) == "null" {
+			continue
+		}
+
+		var single common.Hash
+		if err := json.Unmarshal(r, &single); err == nil {
+			topics[i] = []common.Hash{single}
+			continue
+		}
+
+		var options []*common.Hash
+		if err := json.Unmarshal(r, &options); err != nil {
+			return nil, invalidParams("invalid topic at position %d", i)
+		}
+
+		if len(options) > maxTopicOptions {
+			return nil, invalidParams("at most %d options per topic", maxTopicOptions)
+		}
+
+		for _, o := range options {
+			// a null option matches anything
+			if o == nil {
+				topics[i] = nil
+				break
+			}
+
+			topics[i] = append(topics[i], *o)
+		}
+	}
+
+	return topics, nil
+}
+
+func cacheKey(q ethereum.FilterQuery) string {
+	var b strings.Builder
+
+	if q.BlockHash != nil {
+		b.WriteString(q.BlockHash.Hex())
+	} else {
+		b.WriteString(q.FromBlock.String())
+		b.WriteString("-")
+		b.WriteString(q.ToBlock.String())
+	}
+
+	for _, a := range q.Addresses {
+		b.WriteString("|")
+		b.WriteString(a.Hex())
+	}
+
+	for _, t := range q.Topics {
+		b.WriteString("/")
+		for _, h := range t {
+			b.WriteString(h.Hex())
+			b.WriteString(",")
+		}
+	}
+
+	return b.String()
+}
+
+type cachedLogs struct {
+	body      []byte
+	expiresAt time.Time
+}
+
+// logsCache keeps recent eth_getLogs responses for a short time
+type logsCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]cachedLogs
+
+	now func() time.Time
+}
+
+func newLogsCache(maxEntries int) *logsCache {
+	return &logsCache{
+		maxEntries: maxEntries,
+		entries:    map[string]cachedLogs{},
+		now:        time.Now,
+	}
+}
+
+func (c *logsCache) get(key string) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || c.now().After(e.expiresAt) {
+		return nil, false
+	}
+
+	return e.body, true
+}
+
+func (c *logsCache) set(key string, body []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	if len(c.entries) >= c.maxEntries {
+		for k, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	// still full, make room by dropping an arbitrary entry
+	for k := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			break
+		}
+
+		delete(c.entries, k)
+	}
+
+	c.entries[key] = cachedLogs{body: body, expiresAt: now.Add(ttl)}
+}
@@ -0,0 +1,271 @@
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	ErrCodeInvalidParams    = -32602
+	ErrCodeResponseTooLarge = -32003
+)
+
+// Limits restricts what can be proxied to the upstream node
+type Limits struct {
+	// methods that can be proxied, empty allows all supported methods
+	Methods []string
+
+	// max size in bytes of the data of a call and of a raw transaction
+	MaxCallData int
+
+	// max number of blocks behind the latest block that can be queried, 0 disables the check
+	MaxBlockRange uint64
+
+	// max size in bytes of a response from the upstream node
+	MaxResponseSize int
+
+	// max number of blocks and addresses of an eth_getLogs query
+	MaxLogsBlockRange uint64
+	MaxLogsAddresses  int
+
+	// how long eth_getLogs responses are cached, 0 disables the cache
+	LogsCacheTTL time.Duration
+}
+
+var DefaultLimits = Limits{
+	MaxCallData:       128 * 1024,
+	MaxBlockRange:     100_000,
+	MaxResponseSize:   5 * 1024 * 1024,
+	MaxLogsBlockRange: 2_000,
+	MaxLogsAddresses:  10,
+	LogsCacheTTL:      5 * time.Second,
+}
+
+// max number of eth_getLogs responses kept in the cache
+const logsCacheEntries = 1024
+
+type rpcError struct {
+	code int
+	msg  string
+}
+
+func (e *rpcError) Error() string {
+	return e.msg
+}
+
+func (e *rpcError) ErrorCode() int {
+	return e.code
+}
+
+func invalidParams(format string, args ...any) error {
+	return &rpcError{code: ErrCodeInvalidParams, msg: "invalid params: " + fmt.Sprintf(format, args...)}
+}
+
+// validator checks the params of a method and returns the block numbers it queries
+type validator func(l Limits, params []json.RawMessage) ([]*big.Int, error)
+
+func argCount(params []json.RawMessage, min, max int) error {
+	if len(params) < min || len(params) > max {
+		if min == max {
+			return invalidParams("expected %d arguments, got %d", min, len(params))
+		}
+
+		return invalidParams("expected %d to %d arguments, got %d", min, max, len(params))
+	}
+
+	return nil
+}
+
+func noParams(l Limits, params []json.RawMessage) ([]*big.Int, error) {
+	return nil, argCount(params, 0, 0)
+}
+
+// callParams validates the params of eth_call and eth_estimateGas, state overrides are not allowed
+func callParams(l Limits, params []json.RawMessage) ([]*big.Int, error) {
+	err := argCount(params, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	var call struct {
+		From  *string `json:"from"`
+		To    *string `json:"to"`
+		Data  *string `json:"data"`
+		Input *string `json:"input"`
+	}
+
+	err = json.Unmarshal(params[0], &call)
+	if err != nil {
+		return nil, invalidParams("call object: %v", err)
+	}
+
+	for name, addr := range map[string]*string{"from": call.From, "to": call.To} {
+		if addr != nil && !common.IsHexAddress(*addr) {
+			return nil, invalidParams("invalid %s address", name)
+		}
+	}
+
+	for _, data := range []*string{call.Data, call.Input} {
+		if data == nil {
+			continue
+		}
+
+		err = checkHexSize(*data, l.MaxCallData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(params) < 2 {
+		return nil, nil
+	}
+
+	n, err := blockParam(params[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return []*big.Int{n}, nil
+}
+
+func getBlockByNumberParams(l Limits, params []json.RawMessage) ([]*big.Int, error) {
+	err := argCount(params, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	var full bool
+	err = json.Unmarshal(params[1], &full)
+	if err != nil {
+		return nil, invalidParams("expected a boolean")
+	}
+
+	n, err := blockParam(params[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return []*big.Int{n}, nil
+}
+
+func getTransactionReceiptParams(l Limits, params []json.RawMessage) ([]*big.Int, error) {
+	err := argCount(params, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var hash string
+	err = json.Unmarshal(params[0], &hash)
+	if err != nil {
+		return nil, invalidParams("expected a transaction hash")
+	}
+
+	b, err := hexutil.Decode(hash)
+	if err != nil || len(b) != common.HashLength {
+		return nil, invalidParams("invalid transaction hash")
+	}
+
+	return nil, nil
+}
+
+func getTransactionCountParams(l Limits, params []json.RawMessage) ([]*big.Int, error) {
+	err := argCount(params, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	var addr string
+	err = json.Unmarshal(params[0], &addr)
+	if err != nil || !common.IsHexAddress(addr) {
+		return nil, invalidParams("invalid address")
+	}
+
+	if len(params) < 2 {
+		return nil, nil
+	}
+
+	n, err := blockParam(params[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return []*big.Int{n}, nil
+}
+
+func sendRawTransactionParams(l Limits, params []json.RawMessage) ([]*big.Int, error) {
+	err := argCount(params, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw string
+	err = json.Unmarshal(params[0], &raw)
+	if err != nil {
+		return nil, invalidParams("expected a raw transaction")
+	}
+
+	return nil, checkHexSize(raw, l.MaxCallData)
+}
+
+// checkHexSize checks that a hex string is valid and decodes to at most max bytes
+func checkHexSize(data string, max int) error {
+	if max > 0 && len(data) > 2+2*max {
+		return invalidParams("data exceeds %d bytes", max)
+	}
+
+	_, err := hexutil.Decode(data)
+	if err != nil {
+		return invalidParams("invalid hex data")
+	}
+
+	return nil
+}
+
+// blockParam parses a block tag, number or hash, only explicit numbers are returned
+func blockParam(raw json.RawMessage) (*big.Int, error) {
+	var tag string
+	err := json.Unmarshal(raw, &tag)
+	if err != nil {
+		// eip-1898 block object
+		var obj struct {
+			BlockNumber *string `json:"blockNumber"`
+			BlockHash   *string `json:"blockHash"`
+		}
+
+		err = json.Unmarshal(raw, &obj)
+		if err != nil || (obj.BlockNumber == nil) == (obj.BlockHash == nil) {
+			return nil, invalidParams("invalid block")
+		}
+
+		if obj.BlockHash != nil {
+			b, err := hexutil.Decode(*obj.BlockHash)
+			if err != nil || len(b) != common.HashLength {
+				return nil, invalidParams("invalid block hash")
+			}
+
+			return nil, nil
+		}
+
+		tag = *obj.BlockNumber
+	}
+
+	switch strings.ToLower(tag) {
+	case "latest", "pending", "safe", "finalized":
+		return nil, nil
+	case "earliest":
+		return big.NewInt(0), nil
+	}
+
+	n, err := hexutil.DecodeBig(tag)
+	if err != nil {
+		return nil, invalidParams("invalid block number")
+	}
+
+	return n, nil
+}
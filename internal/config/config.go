@@ -2,53 +2,343 @@ package config
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/sethvargo/go-envconfig"
 )
 
-type Config struct {
+// RPC configures the chain the relay runs on, the nodes it talks to and what can be proxied to them
+type RPC struct {
+	ChainName            string        `env:"CHAIN_NAME,required"`
+	RPCURL               string        `env:"RPC_URL,required" redact:"url"`
+	RPCWSURL             string        `env:"RPC_WS_URL,required" redact:"url"`
+	RPCBreakerThreshold  int           `env:"RPC_BREAKER_THRESHOLD,default=5"`
+	RPCBreakerCooldown   time.Duration `env:"RPC_BREAKER_COOLDOWN,default=30s"`
+	RPCProxyConcurrency  int           `env:"RPC_PROXY_CONCURRENCY,default=64"`
+	RPCProxyQueue        int           `env:"RPC_PROXY_QUEUE,default=128"`
+	RPCProxyWait         time.Duration `env:"RPC_PROXY_WAIT,default=5s"`
+	RPCUserOpConcurrency int           `env:"RPC_USEROP_CONCURRENCY,default=16"`
+	RPCUserOpQueue       int           `env:"RPC_USEROP_QUEUE,default=64"`
+	RPCUserOpWait        time.Duration `env:"RPC_USEROP_WAIT,default=10s"`
+	RPCVerifyURL         string        `env:"RPC_VERIFY_URL" redact:"url"`
+	RPCVerifyThreshold   string        `env:"RPC_VERIFY_THRESHOLD,default=0"`
+	PrivateRPCURLs       string        `env:"PRIVATE_RPC_URLS" redact:"true"`
+	PrivateRPCTimeout    time.Duration `env:"PRIVATE_RPC_TIMEOUT,default=2m"`
+	ChainProfile         string        `env:"CHAIN_PROFILE"`
+	ChainMethods         []string      `env:"CHAIN_METHODS"`
+	ChainMaxCallData     int           `env:"CHAIN_MAX_CALL_DATA,default=131072"`
+	ChainMaxBlockRange   uint64        `env:"CHAIN_MAX_BLOCK_RANGE,default=100000"`
+	ChainMaxResponseSize int           `env:"CHAIN_MAX_RESPONSE_SIZE,default=5242880"`
+	ChainMaxLogsRange    uint64        `env:"CHAIN_MAX_LOGS_RANGE,default=2000"`
+	ChainMaxLogsAddrs    int           `env:"CHAIN_MAX_LOGS_ADDRESSES,default=10"`
+	ChainLogsCacheTTL    time.Duration `env:"CHAIN_LOGS_CACHE_TTL,default=5s"`
+}
+
+// DB configures the postgres database, the secret encrypts the sponsor keys
+type DB struct {
+	DBUser       string `env:"DB_USER,required"`
+	DBPassword   string `env:"DB_PASSWORD,required" redact:"true"`
+	DBName       string `env:"DB_NAME,required"`
+	DBHost       string `env:"DB_HOST,required"`
+	DBPort       string `env:"DB_PORT,required"`
+	DBReaderHost string `env:"DB_READER_HOST,required"`
+	DBSecret     string `env:"DB_SECRET,required" redact:"true"`
+}
+
+// Nostr configures the identity of the relay
+type Nostr struct {
 	RelayUrl             string `env:"RELAY_URL,required"`
-	ChainName            string `env:"CHAIN_NAME,required"`
-	RPCURL               string `env:"RPC_URL,required"`
-	RPCWSURL             string `env:"RPC_WS_URL,required"`
-	DBUser               string `env:"DB_USER,required"`
-	DBPassword           string `env:"DB_PASSWORD,required"`
-	DBName               string `env:"DB_NAME,required"`
-	DBHost               string `env:"DB_HOST,required"`
-	DBPort               string `env:"DB_PORT,required"`
-	DBReaderHost         string `env:"DB_READER_HOST,required"`
-	DBSecret             string `env:"DB_SECRET,required"`
-	PinataBaseURL        string `env:"PINATA_BASE_URL"`
-	PinataAPIKey         string `env:"PINATA_API_KEY"`
-	PinataAPISecret      string `env:"PINATA_API_SECRET"`
-	DiscordURL           string `env:"DISCORD_URL"`
-	RelayPrivateKey      string `env:"RELAY_PRIVATE_KEY"`
+	RelayPrivateKey      string `env:"RELAY_PRIVATE_KEY" redact:"true"`
 	RelayInfoName        string `env:"RELAY_INFO_NAME"`
 	RelayInfoDescription string `env:"RELAY_INFO_DESCRIPTION"`
 	RelayInfoIcon        string `env:"RELAY_INFO_ICON"`
-	AWSAccessKeyID       string `env:"AWS_ACCESS_KEY_ID"`
-	AWSDefaultRegion     string `env:"AWS_DEFAULT_REGION"`
-	AWSEndpointUrl       string `env:"AWS_ENDPOINT_URL"`
-	AWSS3BucketName      string `env:"AWS_S3_BUCKET_NAME"`
-	AWSSecretAccessKey   string `env:"AWS_SECRET_ACCESS_KEY"`
 }
 
+// Blossom configures the storage of blobs, their uploads, transcoding and scanning
+type Blossom struct {
+	AWSAccessKeyID       string        `env:"AWS_ACCESS_KEY_ID" redact:"true"`
+	AWSDefaultRegion     string        `env:"AWS_DEFAULT_REGION"`
+	AWSEndpointUrl       string        `env:"AWS_ENDPOINT_URL"`
+	AWSS3BucketName      string        `env:"AWS_S3_BUCKET_NAME"`
+	AWSSecretAccessKey   string        `env:"AWS_SECRET_ACCESS_KEY" redact:"true"`
+	BlobResidencyConfig  string        `env:"BLOB_RESIDENCY_CONFIG"`
+	UploadIPKey          string        `env:"UPLOAD_IP_KEY" redact:"true"`
+	UploadFlagWindow     time.Duration `env:"UPLOAD_FLAG_WINDOW,default=1h"`
+	UploadFlagCount      int           `env:"UPLOAD_FLAG_COUNT,default=100"`
+	UploadFlagBytes      int64         `env:"UPLOAD_FLAG_BYTES,default=1073741824"`
+	BlobGC               bool          `env:"BLOB_GC,default=false"`
+	BlobGCInterval       time.Duration `env:"BLOB_GC_INTERVAL,default=24h"`
+	BlobGCGrace          time.Duration `env:"BLOB_GC_GRACE,default=72h"`
+	BlobGCDryRun         bool          `env:"BLOB_GC_DRY_RUN,default=false"`
+	BlobArchiveAfterDays int           `env:"BLOB_ARCHIVE_AFTER_DAYS,default=0"`
+	BlobArchiveClass     string        `env:"BLOB_ARCHIVE_CLASS,default=STANDARD_IA"`
+	BlobPriceStandard    float64       `env:"BLOB_PRICE_STANDARD,default=0.023"`
+	BlobPriceArchive     float64       `env:"BLOB_PRICE_ARCHIVE,default=0.0125"`
+	BlobCacheDir         string        `env:"BLOB_CACHE_DIR"`
+	BlobCacheSize        int64         `env:"BLOB_CACHE_SIZE,default=1073741824"`
+	BlobCacheMaxBlob     int64         `env:"BLOB_CACHE_MAX_BLOB,default=10485760"`
+	BlobStripMetadata    bool          `env:"BLOB_STRIP_METADATA,default=true"`
+	TranscodeFFmpeg      string        `env:"TRANSCODE_FFMPEG"`
+	TranscodeURL         string        `env:"TRANSCODE_URL"`
+	TranscodeWorkers     int           `env:"TRANSCODE_WORKERS,default=1"`
+	TranscodeTimeout     time.Duration `env:"TRANSCODE_TIMEOUT,default=10m"`
+	TranscodeQueue       int           `env:"TRANSCODE_QUEUE,default=100"`
+	ScanClamAVAddr       string        `env:"SCAN_CLAMAV_ADDR"`
+	ScanURL              string        `env:"SCAN_URL"`
+	ScanRiskThreshold    int           `env:"SCAN_RISK_THRESHOLD,default=2"`
+	ScanWorkers          int           `env:"SCAN_WORKERS,default=1"`
+	ScanTimeout          time.Duration `env:"SCAN_TIMEOUT,default=2m"`
+	ScanQueue            int           `env:"SCAN_QUEUE,default=100"`
+}
+
+// Push configures push notifications
+type Push struct {
+	PushDigestWindow time.Duration `env:"PUSH_DIGEST_WINDOW,default=15m"`
+	PushTransferDM   bool          `env:"PUSH_TRANSFER_DM,default=false"` // direct message the linked pubkeys of transfer recipients without push tokens
+}
+
+// Webhook configures the operator alerts
+type Webhook struct {
+	DiscordURL           string        `env:"DISCORD_URL" redact:"true"`
+	WebhookDedupeWindow  time.Duration `env:"WEBHOOK_DEDUPE_WINDOW,default=10m"`
+	WebhookFlushInterval time.Duration `env:"WEBHOOK_FLUSH_INTERVAL,default=5m"`
+	WebhookInfoRate      int           `env:"WEBHOOK_INFO_PER_MINUTE,default=30"`
+	WebhookWarningRate   int           `env:"WEBHOOK_WARNINGS_PER_MINUTE,default=10"`
+	WebhookErrorRate     int           `env:"WEBHOOK_ERRORS_PER_MINUTE,default=10"`
+}
+
+// Secrets configures the secret stores settings can reference, see package secrets
+type Secrets struct {
+	VaultAddr       string        `env:"VAULT_ADDR"`
+	VaultToken      string        `env:"VAULT_TOKEN" redact:"true"`
+	SecretsRegion   string        `env:"SECRETS_REGION"`                      // of AWS Secrets Manager, defaults to AWS_DEFAULT_REGION
+	SecretsEndpoint string        `env:"SECRETS_ENDPOINT"`                    // defaults to the regional endpoint
+	SecretsRefresh  time.Duration `env:"SECRETS_REFRESH_INTERVAL,default=5m"` // how often secrets are read again to detect rotations, 0 never
+}
+
+// Admin configures the signature login of operators, see package adminauth
+type Admin struct {
+	AdminAddresses  []string      `env:"ADMIN_ADDRESSES"`                 // ethereum accounts that can log in
+	AdminPubkeys    []string      `env:"ADMIN_PUBKEYS"`                   // nostr pubkeys that can log in
+	AdminSessionKey string        `env:"ADMIN_SESSION_KEY" redact:"true"` // signs the sessions, empty disables the login
+	AdminSessionTTL time.Duration `env:"ADMIN_SESSION_TTL,default=15m"`
+}
+
+// Ingest configures the logs pushed by trusted external indexers, see package ingest
+type Ingest struct {
+	IngestAPIKey string   `env:"INGEST_API_KEY" redact:"true"` // empty disables the push of logs by indexers
+	IngestChains []string `env:"INGEST_CHAINS"`                // chain ids that can be pushed, empty allows any
+}
+
+// DirectMessages configures the NIP-17 private direct messages, see package dms
+type DirectMessages struct {
+	DMTTL time.Duration `env:"DM_TTL,default=720h"` // direct messages are deleted once they are older
+}
+
+// Presence configures the online and typing indicators of group members, see package presence
+type Presence struct {
+	PresenceTTL       time.Duration `env:"PRESENCE_TTL,default=60s"`        // members are online until they stop refreshing it for this long
+	PresenceTypingTTL time.Duration `env:"PRESENCE_TYPING_TTL,default=10s"` // same for typing
+	PresenceInterval  time.Duration `env:"PRESENCE_INTERVAL,default=2s"`    // shortest time between two indicators of a member in a group
+}
+
+// Denylist configures the shared denylist banned content is synced from, see package denylist
+type Denylist struct {
+	DenylistURL          string        `env:"DENYLIST_URL" redact:"url"` // empty only uses the bans of operators
+	DenylistSyncInterval time.Duration `env:"DENYLIST_SYNC_INTERVAL,default=1h"`
+}
+
+// WordFilter configures the keyword filter of group messages, see package wordfilter
+type WordFilter struct {
+	WordFilterDefaults []string `env:"WORD_FILTER_DEFAULTS"`              // keywords filtered in every group unless its admins turn them off
+	WordFilterAction   string   `env:"WORD_FILTER_ACTION,default=reject"` // reject or flag, for groups that don't choose
+}
+
+// GroupConsistency configures the replay of moderation events that verifies group membership, see
+// package groupcheck
+type GroupConsistency struct {
+	GroupCheck         bool          `env:"GROUP_CHECK,default=false"`
+	GroupCheckInterval time.Duration `env:"GROUP_CHECK_INTERVAL,default=24h"`
+	GroupCheckRepair   bool          `env:"GROUP_CHECK_REPAIR,default=false"` // publish the replayed lists and correct the projection
+}
+
+// Config is the configuration of the relay, settings that belong together are grouped in sections
+type Config struct {
+	RPC
+	DB
+	Nostr
+	Blossom
+	Push
+	Webhook
+	Secrets
+	Admin
+	Ingest
+	DirectMessages
+	Presence
+	Denylist
+	WordFilter
+	GroupConsistency
+
+	secrets *loaded
+
+	SponsorMaxOps         int           `env:"SPONSOR_MAX_OPS,default=1000"`
+	SponsorMaxGas         uint64        `env:"SPONSOR_MAX_GAS,default=0"`
+	SponsorWindow         time.Duration `env:"SPONSOR_WINDOW,default=24h"`
+	SponsorKeyRotation    time.Duration `env:"SPONSOR_KEY_ROTATION,default=0"`      // age after which a sponsor key is reported for rotation, 0 never
+	SponsorSignerRotation time.Duration `env:"SPONSOR_SIGNER_ROTATION,default=0"`   // same for the keys that sign paymaster data
+	KMSRegion             string        `env:"KMS_REGION"`                          // of the KMS keys of remote signers, defaults to AWS_DEFAULT_REGION
+	KMSEndpoint           string        `env:"KMS_ENDPOINT" redact:"url"`           // defaults to the regional endpoint
+	SponsorDenialEvents   bool          `env:"SPONSOR_DENIAL_EVENTS,default=false"` // announce denied user ops as ephemeral nostr events
+	UserOpTTL             time.Duration `env:"USEROP_TTL,default=60s"`
+	GasSampleInterval     time.Duration `env:"GAS_SAMPLE_INTERVAL,default=15s"`
+	GasSmoothing          float64       `env:"GAS_SMOOTHING,default=0.1"`
+	GasSpikeMultiple      float64       `env:"GAS_SPIKE_MULTIPLE,default=0"`
+	Hooks                 []string      `env:"HOOKS"`
+	HooksDisabled         []string      `env:"HOOKS_DISABLED"`
+	HooksFailOpen         []string      `env:"HOOKS_FAIL_OPEN"`
+	HookTimeout           time.Duration `env:"HOOK_TIMEOUT,default=5s"`
+	HookWorkers           int           `env:"HOOK_WORKERS,default=8"`
+	HookQueue             int           `env:"HOOK_QUEUE,default=1024"`
+	OutboxInterval        time.Duration `env:"OUTBOX_INTERVAL,default=30s"` // first retry of relay-signed events that failed to be stored, later ones back off
+	PinataBaseURL         string        `env:"PINATA_BASE_URL"`
+	PinataAPIKey          string        `env:"PINATA_API_KEY" redact:"true"`
+	PinataAPISecret       string        `env:"PINATA_API_SECRET" redact:"true"`
+	KuboAPIURL            string        `env:"KUBO_API_URL"`
+	IPFSGatewayURL        string        `env:"IPFS_GATEWAY_URL,default=https://gateway.pinata.cloud"`
+	BucketTimeout         time.Duration `env:"BUCKET_TIMEOUT,default=30s"`
+	BucketRetries         int           `env:"BUCKET_RETRIES,default=3"`
+	BucketBackoff         time.Duration `env:"BUCKET_BACKOFF,default=500ms"`
+	BucketQuorum          int           `env:"BUCKET_QUORUM,default=1"`
+	APIKey                string        `env:"API_KEY" redact:"true"`
+	AccountingExport      bool          `env:"ACCOUNTING_EXPORT,default=false"`
+	AccountingS3Prefix    string        `env:"ACCOUNTING_S3_PREFIX,default=accounting"`
+	Backup                bool          `env:"BACKUP,default=false"`
+	BackupInterval        time.Duration `env:"BACKUP_INTERVAL,default=24h"`
+	BackupS3Prefix        string        `env:"BACKUP_S3_PREFIX,default=backups"`
+	BackupKey             string        `env:"BACKUP_KEY" redact:"true"`
+	LogLevel              string        `env:"LOG_LEVEL,default=info"`
+	DebugEndpoints        bool          `env:"DEBUG_ENDPOINTS,default=false"`
+	Maintenance           bool          `env:"MAINTENANCE,default=false"`
+	MaintenanceReason     string        `env:"MAINTENANCE_REASON"`
+	IntegrityCheck        bool          `env:"INTEGRITY_CHECK,default=false"`
+	IntegrityInterval     time.Duration `env:"INTEGRITY_INTERVAL,default=1h"`
+	IntegritySample       int           `env:"INTEGRITY_SAMPLE,default=100"`
+	StartupRetries        int           `env:"STARTUP_RETRIES,default=10"`
+	StartupBackoff        time.Duration `env:"STARTUP_BACKOFF,default=1s"`
+	StartupMaxBackoff     time.Duration `env:"STARTUP_MAX_BACKOFF,default=30s"`
+	StartupPartial        bool          `env:"STARTUP_PARTIAL,default=false"`
+	OracleProvider        string        `env:"ORACLE_PROVIDER,default=fixed"`
+	OracleCurrency        string        `env:"ORACLE_CURRENCY,default=USD"`
+	OracleCacheTTL        time.Duration `env:"ORACLE_CACHE_TTL,default=5m"`
+	OracleFixedPrice      float64       `env:"ORACLE_FIXED_PRICE,default=0"`
+	OracleChainlinkFeed   string        `env:"ORACLE_CHAINLINK_FEED"`
+	OracleChainlinkAge    time.Duration `env:"ORACLE_CHAINLINK_MAX_AGE,default=24h"`
+	OracleCoinGeckoURL    string        `env:"ORACLE_COINGECKO_URL,default=https://api.coingecko.com/api/v3"`
+	OracleCoinGeckoID     string        `env:"ORACLE_COINGECKO_ID"`
+	LegacyLogsSunset      time.Time     `env:"LEGACY_LOGS_SUNSET"`
+	SignatureDBURL        string        `env:"SIGNATURE_DB_URL" redact:"url"`
+	IndexerTxSender       bool          `env:"INDEXER_TX_SENDER,default=false"`
+	IndexerSenderCache    int           `env:"INDEXER_SENDER_CACHE,default=1024"`
+	IndexerLagInterval    time.Duration `env:"INDEXER_LAG_INTERVAL,default=1m"`
+	IndexerLagThreshold   uint64        `env:"INDEXER_LAG_THRESHOLD,default=100"`
+	IndexerFinality       time.Duration `env:"INDEXER_FINALITY_INTERVAL,default=30s"`
+	BridgeConfig          string        `env:"BRIDGE_CONFIG"`
+	BridgeMediaURL        string        `env:"BRIDGE_MEDIA_URL"`
+	LoadSampleInterval    time.Duration `env:"LOAD_SAMPLE_INTERVAL,default=5s"`
+	QueueSlowThreshold    time.Duration `env:"QUEUE_SLOW_THRESHOLD,default=5s"` // messages that wait and process for longer are logged, 0 disables
+	EmailDomain           string        `env:"EMAIL_DOMAIN"`
+	TokenGateConfig       string        `env:"TOKEN_GATE_CONFIG"`
+	TokenGateInterval     time.Duration `env:"TOKEN_GATE_INTERVAL,default=1h"`
+	TokenGateDryRun       bool          `env:"TOKEN_GATE_DRY_RUN,default=false"`
+	EmailSigningKey       string        `env:"EMAIL_SIGNING_KEY" redact:"true"`
+	Faults                string        `env:"FAULTS"`
+	FaultsStaging         bool          `env:"FAULTS_STAGING,default=false"`
+	DevPaymaster          string        `env:"DEV_PAYMASTER,default=0x5FbDB2315678afecb367f032d93F642f64180aa3"`
+	DevToken              string        `env:"DEV_TOKEN,default=0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512"`
+	DevGroupID            string        `env:"DEV_GROUP_ID,default=demo"`
+	DevGroupName          string        `env:"DEV_GROUP_NAME,default=Demo"`
+}
+
+// New loads the configuration from the environment, the env file is optional so the relay can
+// be configured with environment variables only. Secrets can be read from files and secret
+// stores instead, see package secrets. Every missing or invalid setting is reported
+// at once in a *ValidationError.
 func New(ctx context.Context, envpath string) (*Config, error) {
 	if envpath != "" {
-		log.Default().Println("loading env from file: ", envpath)
-		err := godotenv.Load(envpath)
-		if err != nil {
+		_, err := os.Stat(envpath)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			log.Default().Println("env file not found, using environment variables only: ", envpath)
+		case err != nil:
 			return nil, err
+		default:
+			log.Default().Println("loading env from file: ", envpath)
+			err = godotenv.Load(envpath)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	cfg := &Config{}
-	err := envconfig.Process(ctx, cfg)
+	sec, problems := loadSecrets(ctx, os.LookupEnv)
+
+	problems = append(problems, check(sec.overlay(os.LookupEnv))...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	cfg := &Config{secrets: sec}
+	err := envconfig.ProcessWith(ctx, &envconfig.Config{
+		Target:   cfg,
+		Lookuper: envconfig.MultiLookuper(sec, envconfig.OsLookuper()),
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	problems = cfg.validate()
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
 	return cfg, nil
 }
+
+// PrivateRPC returns the private submission endpoint configured for a chain, empty when its
+// bundles go to the public mempool
+func (c *Config) PrivateRPC(chainID string) string {
+	urls, _ := parseChainURLs(c.PrivateRPCURLs)
+	return urls[chainID]
+}
+
+// parseChainURLs parses a comma separated list of chain id=url pairs
+func parseChainURLs(s string) (map[string]string, error) {
+	urls := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, u, ok := strings.Cut(pair, "=")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid pair %q, expected chain id=url", pair)
+		}
+
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid url %q", u)
+		}
+
+		urls[id] = u
+	}
+
+	return urls, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// redacted replaces a secret in the representation of the configuration
+const redacted = "[redacted]"
+
+// String lists the settings as ENV=value lines with the secrets redacted, so the configuration
+// can be logged or printed without leaking keys
+func (c Config) String() string { return format(c) }
+
+// GoString makes %#v redact the secrets as well
+func (c Config) GoString() string { return format(c) }
+
+func (c RPC) String() string     { return format(c) }
+func (c DB) String() string      { return format(c) }
+func (c Nostr) String() string   { return format(c) }
+func (c Blossom) String() string { return format(c) }
+func (c Push) String() string    { return format(c) }
+func (c Webhook) String() string { return format(c) }
+func (c Secrets) String() string { return format(c) }
+
+func (c RPC) GoString() string     { return format(c) }
+func (c DB) GoString() string      { return format(c) }
+func (c Nostr) GoString() string   { return format(c) }
+func (c Blossom) GoString() string { return format(c) }
+func (c Push) GoString() string    { return format(c) }
+func (c Webhook) GoString() string { return format(c) }
+func (c Secrets) GoString() string { return format(c) }
+
+// format writes a line per setting of a config struct, the settings of embedded sections are
+// written in place
+func format(c any) string {
+	var b strings.Builder
+	writeFields(&b, reflect.ValueOf(c))
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func writeFields(b *strings.Builder, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			writeFields(b, v.Field(i))
+			continue
+		}
+
+		f, ok := parseTag(sf.Tag.Get("env"))
+		if !ok {
+			continue
+		}
+
+		fmt.Fprintf(b, "%s=%s\n", f.Env, redact(sf.Tag.Get("redact"), v.Field(i)))
+	}
+}
+
+// redact formats a value according to its redact tag, "true" hides it and "url" keeps only the
+// scheme and host of a url, which may carry credentials or api keys in its path and query
+func redact(mode string, v reflect.Value) string {
+	s := fmt.Sprint(v.Interface())
+	if s == "" || mode == "" {
+		return s
+	}
+
+	if mode == "url" {
+		u, err := url.Parse(s)
+		if err == nil && u.Scheme != "" && u.Host != "" {
+			if u.User == nil && u.Path == "" && u.RawQuery == "" {
+				return s
+			}
+			return fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, redacted)
+		}
+	}
+
+	return redacted
+}
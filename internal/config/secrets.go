@@ -0,0 +1,145 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/comunifi/relay/internal/secrets"
+)
+
+// loaded holds the secrets read from files and secret stores, their values take precedence over
+// the environment
+type loaded struct {
+	values map[string]string
+	refs   map[string]string
+	r      *secrets.Resolver
+}
+
+// overlay looks up the loaded secrets first, then env
+func (l *loaded) overlay(env func(string) (string, bool)) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		if v, ok := l.values[k]; ok {
+			return v, true
+		}
+		return env(k)
+	}
+}
+
+// Lookup implements envconfig.Lookuper
+func (l *loaded) Lookup(k string) (string, bool) {
+	v, ok := l.values[k]
+	return v, ok
+}
+
+// loadSecrets reads the secrets that are set with NAME_FILE or as a reference to a secret store,
+// files are read first so the token of a store can be mounted as well
+func loadSecrets(ctx context.Context, env func(string) (string, bool)) (*loaded, []Problem) {
+	l := &loaded{
+		values: map[string]string{},
+		refs:   map[string]string{},
+		r:      secrets.NewResolver(),
+	}
+
+	problems := []Problem{}
+
+	fields := []Field{}
+	for _, f := range Fields() {
+		if f.Secret {
+			fields = append(fields, f)
+		}
+	}
+
+	for _, f := range fields {
+		path, ok := env(f.Env + secrets.FileSuffix)
+		if !ok || path == "" {
+			continue
+		}
+
+		if v, ok := env(f.Env); ok && v != "" {
+			problems = append(problems, Problem{f.Env, fmt.Sprintf("can't be set together with %s%s", f.Env, secrets.FileSuffix)})
+			continue
+		}
+
+		v, err := secrets.ReadFile(path)
+		if err != nil {
+			problems = append(problems, Problem{f.Env + secrets.FileSuffix, err.Error()})
+			continue
+		}
+
+		l.values[f.Env] = v
+		l.refs[f.Env] = "file:" + path
+	}
+
+	get := l.overlay(env)
+
+	if addr, _ := get("VAULT_ADDR"); addr != "" {
+		token, _ := get("VAULT_TOKEN")
+		l.r.SetStore("vault", secrets.NewVault(addr, token))
+	}
+
+	for _, f := range fields {
+		ref, _ := env(f.Env)
+		if _, ok := l.values[f.Env]; ok || !secrets.IsRef(ref) {
+			continue
+		}
+
+		scheme, _, _ := strings.Cut(ref, ":")
+		switch scheme {
+		case "vault":
+			if addr, _ := get("VAULT_ADDR"); addr == "" {
+				problems = append(problems, Problem{f.Env, fmt.Sprintf("VAULT_ADDR is required to read %s", ref)})
+				continue
+			}
+		case "awssm":
+			err := l.awsStore(ctx, get)
+			if err != nil {
+				problems = append(problems, Problem{f.Env, err.Error()})
+				continue
+			}
+		}
+
+		v, err := l.r.Resolve(ctx, ref)
+		if err != nil {
+			problems = append(problems, Problem{f.Env, fmt.Sprintf("unable to read %s: %v", ref, err)})
+			continue
+		}
+
+		l.values[f.Env] = v
+		l.refs[f.Env] = ref
+	}
+
+	return l, problems
+}
+
+// awsStore sets up AWS Secrets Manager the first time a reference to it is found
+func (l *loaded) awsStore(ctx context.Context, get func(string) (string, bool)) error {
+	if l.r.HasStore("awssm") {
+		return nil
+	}
+
+	region, _ := get("SECRETS_REGION")
+	if region == "" {
+		region, _ = get("AWS_DEFAULT_REGION")
+	}
+
+	endpoint, _ := get("SECRETS_ENDPOINT")
+
+	sm, err := secrets.NewSecretsManager(ctx, region, endpoint)
+	if err != nil {
+		return err
+	}
+
+	l.r.SetStore("awssm", sm)
+	return nil
+}
+
+// SecretsWatcher watches the secrets read from files and secret stores for rotations, nil when
+// every secret is set inline
+func (c *Config) SecretsWatcher() *secrets.Watcher {
+	if c.secrets == nil || len(c.secrets.refs) == 0 {
+		return nil
+	}
+
+	return secrets.NewWatcher(c.secrets.r, c.secrets.refs, c.secrets.values)
+}
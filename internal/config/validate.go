@@ -0,0 +1,549 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/comunifi/relay/internal/blossom"
+	"github.com/comunifi/relay/internal/faults"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Field documents a setting of the relay
+type Field struct {
+	Name     string `json:"name"`
+	Section  string `json:"section,omitempty"`
+	Env      string `json:"env"`
+	Type     string `json:"type"`
+	Default  string `json:"default,omitempty"`
+	Required bool   `json:"required"`
+	Secret   bool   `json:"secret,omitempty"` // can be read from NAME_FILE or a secret store
+}
+
+// Fields lists every setting with its env variable, type and default
+func Fields() []Field {
+	return fields(reflect.TypeOf(Config{}), "")
+}
+
+// fields lists the settings of a struct, the settings of embedded sections are listed in place
+func fields(t reflect.Type, section string) []Field {
+	fs := make([]Field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			fs = append(fs, fields(sf.Type, sf.Name)...)
+			continue
+		}
+
+		f, ok := parseTag(sf.Tag.Get("env"))
+		if !ok {
+			continue
+		}
+
+		f.Name = sf.Name
+		f.Section = section
+		f.Secret = sf.Tag.Get("redact") != ""
+		f.Type = sf.Type.String()
+
+		fs = append(fs, f)
+	}
+
+	return fs
+}
+
+// parseTag reads an envconfig tag such as "NAME,required" or "NAME,default=1s", the default
+// is always the last option and may contain commas
+func parseTag(tag string) (Field, bool) {
+	if tag == "" || tag == "-" {
+		return Field{}, false
+	}
+
+	name, opts, _ := strings.Cut(tag, ",")
+	f := Field{Env: name}
+
+	for opts != "" {
+		if def, ok := strings.CutPrefix(opts, "default="); ok {
+			f.Default = def
+			break
+		}
+
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == "required" {
+			f.Required = true
+		}
+	}
+
+	return f, true
+}
+
+// Problem is a missing or invalid setting
+type Problem struct {
+	Env    string
+	Reason string
+}
+
+// ValidationError reports every problem found in the configuration at once
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration, %d problem(s):", len(e.Problems))
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  %s: %s", p.Env, p.Reason)
+	}
+
+	return b.String()
+}
+
+// check verifies that required settings are present and that every value parses as its type
+func check(lookup func(string) (string, bool)) []Problem {
+	t := reflect.TypeOf(Config{})
+
+	problems := []Problem{}
+	for _, f := range Fields() {
+		v, ok := lookup(f.Env)
+		if !ok || v == "" {
+			if f.Required {
+				problems = append(problems, Problem{f.Env, "required but not set"})
+			}
+			continue
+		}
+
+		sf, _ := t.FieldByName(f.Name)
+
+		err := parseValue(sf.Type, v)
+		if err != nil {
+			problems = append(problems, Problem{f.Env, fmt.Sprintf("invalid %s %q", f.Type, v)})
+		}
+	}
+
+	return problems
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+func parseValue(t reflect.Type, v string) error {
+	switch t {
+	case durationType:
+		_, err := time.ParseDuration(v)
+		return err
+	case timeType:
+		_, err := time.Parse(time.RFC3339, v)
+		return err
+	}
+
+	var err error
+	switch t.Kind() {
+	case reflect.Bool:
+		_, err = strconv.ParseBool(v)
+	case reflect.Int, reflect.Int64:
+		_, err = strconv.ParseInt(v, 10, 64)
+	case reflect.Uint64:
+		_, err = strconv.ParseUint(v, 10, 64)
+	case reflect.Float64:
+		_, err = strconv.ParseFloat(v, 64)
+	}
+
+	return err
+}
+
+// validate checks the values that parse but make no sense for the relay
+func (c *Config) validate() []Problem {
+	problems := []Problem{}
+	add := func(env, reason string) {
+		problems = append(problems, Problem{env, reason})
+	}
+
+	c.RPC.validate(add)
+	c.DB.validate(add)
+	c.Nostr.validate(add)
+	c.Blossom.validate(add)
+	c.Push.validate(add)
+	c.Webhook.validate(add)
+	c.Secrets.validate(add)
+	c.Admin.validate(add)
+	c.Ingest.validate(add)
+	c.DirectMessages.validate(add)
+	c.Presence.validate(add)
+	c.Denylist.validate(add)
+	c.WordFilter.validate(add)
+	c.GroupConsistency.validate(add)
+
+	if c.KMSEndpoint != "" {
+		checkURL(add, "KMS_ENDPOINT", c.KMSEndpoint)
+	}
+
+	if c.GasSampleInterval <= 0 {
+		add("GAS_SAMPLE_INTERVAL", "must be greater than 0")
+	}
+
+	if c.GasSmoothing <= 0 || c.GasSmoothing > 1 {
+		add("GAS_SMOOTHING", "must be between 0 and 1")
+	}
+
+	if c.GasSpikeMultiple != 0 && c.GasSpikeMultiple <= 1 {
+		add("GAS_SPIKE_MULTIPLE", "must be 0 or greater than 1")
+	}
+
+	if !slices.Contains([]string{"debug", "info", "warn", "error"}, strings.ToLower(c.LogLevel)) {
+		add("LOG_LEVEL", fmt.Sprintf("unknown level %q", c.LogLevel))
+	}
+
+	if !slices.Contains([]string{"fixed", "chainlink", "coingecko"}, c.OracleProvider) {
+		add("ORACLE_PROVIDER", fmt.Sprintf("unknown provider %q", c.OracleProvider))
+	}
+
+	for env, n := range map[string]int{
+		"INTEGRITY_SAMPLE": c.IntegritySample,
+		"STARTUP_RETRIES":  c.StartupRetries,
+	} {
+		if n <= 0 {
+			add(env, "must be greater than 0")
+		}
+	}
+
+	for env, d := range map[string]time.Duration{
+		"USEROP_TTL":                c.UserOpTTL,
+		"HOOK_TIMEOUT":              c.HookTimeout,
+		"STARTUP_BACKOFF":           c.StartupBackoff,
+		"LOAD_SAMPLE_INTERVAL":      c.LoadSampleInterval,
+		"QUEUE_SLOW_THRESHOLD":      c.QueueSlowThreshold,
+		"INDEXER_FINALITY_INTERVAL": c.IndexerFinality,
+		"SPONSOR_KEY_ROTATION":      c.SponsorKeyRotation,
+		"SPONSOR_SIGNER_ROTATION":   c.SponsorSignerRotation,
+	} {
+		if d < 0 {
+			add(env, "must not be negative")
+		}
+	}
+
+	if c.IndexerLagInterval <= 0 {
+		add("INDEXER_LAG_INTERVAL", "must be greater than 0")
+	}
+
+	if c.OutboxInterval <= 0 {
+		add("OUTBOX_INTERVAL", "must be greater than 0")
+	}
+
+	if c.Backup && c.BackupInterval <= 0 {
+		add("BACKUP_INTERVAL", "must be greater than 0 when BACKUP is enabled")
+	}
+
+	if c.Backup && c.BackupKey == "" {
+		add("BACKUP_KEY", "required when BACKUP is enabled")
+	}
+
+	if c.IntegrityCheck && c.IntegrityInterval <= 0 {
+		add("INTEGRITY_INTERVAL", "must be greater than 0 when INTEGRITY_CHECK is enabled")
+	}
+
+	if c.TokenGateConfig != "" && c.TokenGateInterval <= 0 {
+		add("TOKEN_GATE_INTERVAL", "must be greater than 0 when TOKEN_GATE_CONFIG is set")
+	}
+
+	if c.EmailDomain != "" && c.EmailSigningKey == "" {
+		add("EMAIL_SIGNING_KEY", "required when EMAIL_DOMAIN is set")
+	}
+
+	if c.Faults != "" {
+		_, err := faults.ParseRates(c.Faults)
+		if err != nil {
+			add("FAULTS", err.Error())
+		}
+
+		if !c.FaultsStaging {
+			add("FAULTS_STAGING", "must be true to inject faults, never enable this in production")
+		}
+	}
+
+	// maps are iterated in random order, keep the report stable
+	slices.SortStableFunc(problems, func(a, b Problem) int {
+		return strings.Compare(a.Env, b.Env)
+	})
+
+	return problems
+}
+
+// validate checks the nodes and the limits of the chain
+func (c *RPC) validate(add func(env, reason string)) {
+	for env, u := range map[string]string{"RPC_URL": c.RPCURL, "RPC_WS_URL": c.RPCWSURL} {
+		checkURL(add, env, u)
+	}
+
+	if c.RPCVerifyURL != "" {
+		checkURL(add, "RPC_VERIFY_URL", c.RPCVerifyURL)
+	}
+
+	if _, err := parseChainURLs(c.PrivateRPCURLs); err != nil {
+		add("PRIVATE_RPC_URLS", err.Error())
+	}
+
+	// a private bundle is waited for in whole seconds
+	if c.PrivateRPCURLs != "" && c.PrivateRPCTimeout < time.Second {
+		add("PRIVATE_RPC_TIMEOUT", "must be at least 1s")
+	}
+
+	for env, n := range map[string]int{
+		"RPC_PROXY_CONCURRENCY":  c.RPCProxyConcurrency,
+		"RPC_USEROP_CONCURRENCY": c.RPCUserOpConcurrency,
+	} {
+		if n <= 0 {
+			add(env, "must be greater than 0")
+		}
+	}
+
+	if c.RPCBreakerCooldown < 0 {
+		add("RPC_BREAKER_COOLDOWN", "must not be negative")
+	}
+
+	if v, ok := new(big.Int).SetString(c.RPCVerifyThreshold, 10); !ok || v.Sign() < 0 {
+		add("RPC_VERIFY_THRESHOLD", fmt.Sprintf("invalid amount %q", c.RPCVerifyThreshold))
+	}
+}
+
+// validate checks the connection settings and the secret that encrypts the sponsor keys
+func (c *DB) validate(add func(env, reason string)) {
+	if c.DBPort != "" {
+		if p, err := strconv.Atoi(c.DBPort); err != nil || p <= 0 || p > 65535 {
+			add("DB_PORT", fmt.Sprintf("invalid port %q", c.DBPort))
+		}
+	}
+
+	if c.DBSecret != "" && !isHexKey(c.DBSecret) {
+		add("DB_SECRET", "must be a 32 byte hex key")
+	}
+}
+
+// validate checks the identity of the relay
+func (c *Nostr) validate(add func(env, reason string)) {
+	if c.RelayUrl != "" {
+		checkURL(add, "RELAY_URL", c.RelayUrl)
+	}
+
+	if c.RelayPrivateKey != "" && !isHexKey(c.RelayPrivateKey) {
+		add("RELAY_PRIVATE_KEY", "must be a 32 byte hex key")
+	}
+}
+
+// validate checks the archiving, caching, transcoding and scanning of blobs
+func (c *Blossom) validate(add func(env, reason string)) {
+	if c.BlobArchiveAfterDays < 0 {
+		add("BLOB_ARCHIVE_AFTER_DAYS", "can't be negative")
+	}
+
+	if c.BlobArchiveAfterDays > 0 {
+		switch {
+		case !slices.Contains(blossom.ArchiveClasses, c.BlobArchiveClass):
+			add("BLOB_ARCHIVE_CLASS", fmt.Sprintf("must be one of %s", strings.Join(blossom.ArchiveClasses, ", ")))
+		case strings.HasSuffix(c.BlobArchiveClass, "_IA") && c.BlobArchiveAfterDays < 30:
+			// S3 refuses transitions to the infrequent access classes before 30 days
+			add("BLOB_ARCHIVE_AFTER_DAYS", fmt.Sprintf("must be at least 30 for %s", c.BlobArchiveClass))
+		}
+	}
+
+	if c.BlobPriceStandard < 0 || c.BlobPriceArchive < 0 {
+		add("BLOB_PRICE_STANDARD", "storage prices can't be negative")
+	}
+
+	if c.BlobCacheDir != "" {
+		if c.BlobCacheSize <= 0 {
+			add("BLOB_CACHE_SIZE", "must be greater than 0 when the blob cache is enabled")
+		}
+
+		if c.BlobCacheMaxBlob <= 0 {
+			add("BLOB_CACHE_MAX_BLOB", "must be greater than 0 when the blob cache is enabled")
+		}
+	}
+
+	if c.TranscodeFFmpeg != "" && c.TranscodeURL != "" {
+		add("TRANSCODE_URL", "can't be set together with TRANSCODE_FFMPEG")
+	}
+
+	if (c.TranscodeFFmpeg != "" || c.TranscodeURL != "") && c.TranscodeTimeout <= 0 {
+		add("TRANSCODE_TIMEOUT", "must be greater than 0 when transcoding is enabled")
+	}
+
+	if c.ScanClamAVAddr != "" && c.ScanURL != "" {
+		add("SCAN_URL", "can't be set together with SCAN_CLAMAV_ADDR")
+	}
+
+	if c.ScanClamAVAddr != "" || c.ScanURL != "" {
+		if c.ScanTimeout <= 0 {
+			add("SCAN_TIMEOUT", "must be greater than 0 when scanning is enabled")
+		}
+
+		if c.ScanRiskThreshold < 0 || c.ScanRiskThreshold > 3 {
+			add("SCAN_RISK_THRESHOLD", "must be between 0 (scan every upload) and 3 (only unknown types)")
+		}
+	}
+}
+
+// validate checks the push settings
+func (c *Push) validate(add func(env, reason string)) {
+	if c.PushDigestWindow < 0 {
+		add("PUSH_DIGEST_WINDOW", "must not be negative")
+	}
+}
+
+// validate checks the alert destination and rates
+func (c *Webhook) validate(add func(env, reason string)) {
+	if c.DiscordURL != "" {
+		// the url holds the webhook token, don't repeat it in the report
+		parsed, err := url.Parse(c.DiscordURL)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			add("DISCORD_URL", "invalid url")
+		}
+	}
+
+	for env, n := range map[string]int{
+		"WEBHOOK_INFO_PER_MINUTE":     c.WebhookInfoRate,
+		"WEBHOOK_WARNINGS_PER_MINUTE": c.WebhookWarningRate,
+		"WEBHOOK_ERRORS_PER_MINUTE":   c.WebhookErrorRate,
+	} {
+		if n < 0 {
+			add(env, "must not be negative")
+		}
+	}
+
+	for env, d := range map[string]time.Duration{
+		"WEBHOOK_DEDUPE_WINDOW":  c.WebhookDedupeWindow,
+		"WEBHOOK_FLUSH_INTERVAL": c.WebhookFlushInterval,
+	} {
+		if d < 0 {
+			add(env, "must not be negative")
+		}
+	}
+}
+
+// validate checks the secret stores
+func (c *Secrets) validate(add func(env, reason string)) {
+	if c.VaultAddr != "" {
+		checkURL(add, "VAULT_ADDR", c.VaultAddr)
+	}
+
+	if c.SecretsEndpoint != "" {
+		checkURL(add, "SECRETS_ENDPOINT", c.SecretsEndpoint)
+	}
+
+	if c.SecretsRefresh < 0 {
+		add("SECRETS_REFRESH_INTERVAL", "must not be negative")
+	}
+}
+
+// validate checks who can log in as an operator
+func (c *Admin) validate(add func(env, reason string)) {
+	for _, a := range c.AdminAddresses {
+		if !common.IsHexAddress(a) {
+			add("ADMIN_ADDRESSES", fmt.Sprintf("invalid address %q", a))
+		}
+	}
+
+	for _, pk := range c.AdminPubkeys {
+		if !nostr.IsValidPublicKey(pk) {
+			add("ADMIN_PUBKEYS", fmt.Sprintf("invalid pubkey %q", pk))
+		}
+	}
+
+	if c.AdminSessionKey == "" {
+		return
+	}
+
+	if !isHexKey(c.AdminSessionKey) {
+		add("ADMIN_SESSION_KEY", "must be a 32 byte hex key")
+	}
+
+	if len(c.AdminAddresses) == 0 && len(c.AdminPubkeys) == 0 {
+		add("ADMIN_SESSION_KEY", "set ADMIN_ADDRESSES or ADMIN_PUBKEYS, nobody can log in")
+	}
+
+	if c.AdminSessionTTL <= 0 {
+		add("ADMIN_SESSION_TTL", "must be greater than 0")
+	}
+}
+
+// validate checks the chains indexers can push logs of
+func (c *Ingest) validate(add func(env, reason string)) {
+	for _, id := range c.IngestChains {
+		if _, ok := new(big.Int).SetString(id, 10); !ok {
+			add("INGEST_CHAINS", fmt.Sprintf("invalid chain id %q", id))
+		}
+	}
+}
+
+// validate checks that direct messages outlive the date gift wraps are backdated to
+func (c *DirectMessages) validate(add func(env, reason string)) {
+	if c.DMTTL < 48*time.Hour {
+		add("DM_TTL", "must be at least 48h, gift wraps are dated up to 2 days in the past")
+	}
+}
+
+// validate checks that indicators expire and that typing can be refreshed before it does
+func (c *Presence) validate(add func(env, reason string)) {
+	if c.PresenceTTL <= 0 {
+		add("PRESENCE_TTL", "must be greater than 0")
+	}
+
+	if c.PresenceTypingTTL <= 0 || c.PresenceTypingTTL > c.PresenceTTL {
+		add("PRESENCE_TYPING_TTL", "must be greater than 0 and at most PRESENCE_TTL")
+	}
+
+	if c.PresenceInterval < 0 || c.PresenceInterval >= c.PresenceTypingTTL {
+		add("PRESENCE_INTERVAL", "must not be negative and shorter than PRESENCE_TYPING_TTL")
+	}
+}
+
+// validate checks the denylist is synced from a url
+func (c *Denylist) validate(add func(env, reason string)) {
+	if c.DenylistURL == "" {
+		return
+	}
+
+	checkURL(add, "DENYLIST_URL", c.DenylistURL)
+
+	if c.DenylistSyncInterval <= 0 {
+		add("DENYLIST_SYNC_INTERVAL", "must be greater than 0")
+	}
+}
+
+// validate checks the default action of the keyword filter
+func (c *WordFilter) validate(add func(env, reason string)) {
+	if c.WordFilterAction != "reject" && c.WordFilterAction != "flag" {
+		add("WORD_FILTER_ACTION", "must be reject or flag")
+	}
+}
+
+// validate checks the group check runs periodically
+func (c *GroupConsistency) validate(add func(env, reason string)) {
+	if c.GroupCheck && c.GroupCheckInterval <= 0 {
+		add("GROUP_CHECK_INTERVAL", "must be greater than 0 when GROUP_CHECK is enabled")
+	}
+}
+
+// isHexKey reports whether s is a 32 byte hex encoded private key
+func isHexKey(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 32
+}
+
+// checkURL reports a url without a scheme or a host
+func checkURL(add func(env, reason string), env, u string) {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		add(env, fmt.Sprintf("invalid url %q", u))
+	}
+}
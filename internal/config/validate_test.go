@@ -0,0 +1,324 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want Field
+		ok   bool
+	}{
+		{"RELAY_URL,required", Field{Env: "RELAY_URL", Required: true}, true},
+		{"HOOK_TIMEOUT,default=5s", Field{Env: "HOOK_TIMEOUT", Default: "5s"}, true},
+		{"HOOKS,default=userop,notify", Field{Env: "HOOKS", Default: "userop,notify"}, true},
+		{"API_KEY", Field{Env: "API_KEY"}, true},
+		{"", Field{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseTag(tt.tag)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%q: expected %+v %v, got %+v %v", tt.tag, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	fields := Fields()
+
+	i := slices.IndexFunc(fields, func(f Field) bool { return f.Env == "BACKUP_INTERVAL" })
+	if i < 0 {
+		t.Fatal("expected BACKUP_INTERVAL to be documented")
+	}
+
+	f := fields[i]
+	if f.Name != "BackupInterval" || f.Section != "" || f.Type != "time.Duration" || f.Default != "24h" || f.Required {
+		t.Errorf("unexpected field %+v", f)
+	}
+
+	// the settings of the sections are listed with the others
+	i = slices.IndexFunc(fields, func(f Field) bool { return f.Env == "DB_SECRET" })
+	if i < 0 || fields[i].Name != "DBSecret" || fields[i].Section != "DB" || !fields[i].Required {
+		t.Errorf("expected DB_SECRET in the DB section, got %+v", fields)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	env := map[string]string{}
+	for _, f := range Fields() {
+		if f.Required {
+			env[f.Env] = "x"
+		}
+	}
+
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	problems := check(lookup)
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+
+	delete(env, "DB_HOST")
+	env["HOOK_TIMEOUT"] = "5 seconds"
+	env["HOOK_WORKERS"] = "eight"
+	env["MAINTENANCE"] = "yes please"
+	env["SPONSOR_MAX_GAS"] = "-1"
+
+	problems = check(lookup)
+
+	got := []string{}
+	for _, p := range problems {
+		got = append(got, p.Env)
+	}
+	slices.Sort(got)
+
+	want := []string{"DB_HOST", "HOOK_TIMEOUT", "HOOK_WORKERS", "MAINTENANCE", "SPONSOR_MAX_GAS"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected problems for %v, got %v", want, got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		return &Config{
+			RPC: RPC{
+				RPCURL:               "https://rpc.example.com",
+				RPCWSURL:             "wss://rpc.example.com",
+				RPCProxyConcurrency:  1,
+				RPCUserOpConcurrency: 1,
+				RPCVerifyThreshold:   "0",
+			},
+			DirectMessages:     DirectMessages{DMTTL: 30 * 24 * time.Hour},
+			Presence:           Presence{PresenceTTL: time.Minute, PresenceTypingTTL: 10 * time.Second, PresenceInterval: 2 * time.Second},
+			WordFilter:         WordFilter{WordFilterAction: "reject"},
+			LogLevel:           "info",
+			OracleProvider:     "fixed",
+			IntegritySample:    1,
+			StartupRetries:     1,
+			IndexerLagInterval: time.Minute,
+			OutboxInterval:     time.Second,
+			GasSampleInterval:  time.Second,
+			GasSmoothing:       0.1,
+		}
+	}
+
+	problems := valid().validate()
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+
+	c := valid()
+	c.RPCWSURL = "localhost"
+	c.LogLevel = "verbose"
+	c.Backup = true
+	c.BackupInterval = 0
+	c.Faults = "disk=1"
+	c.EmailDomain = "mail.example.com"
+	c.IndexerLagInterval = 0
+	c.OutboxInterval = 0
+	c.RPCVerifyThreshold = "-1"
+	c.GasSpikeMultiple = 0.5
+	c.PrivateRPCURLs = "1=rpc.flashbots.net"
+	c.DBSecret = "secret"
+	c.WebhookErrorRate = -1
+
+	problems = c.validate()
+
+	got := []string{}
+	for _, p := range problems {
+		got = append(got, p.Env)
+	}
+
+	want := []string{"BACKUP_INTERVAL", "BACKUP_KEY", "DB_SECRET", "EMAIL_SIGNING_KEY", "FAULTS", "FAULTS_STAGING", "GAS_SPIKE_MULTIPLE", "INDEXER_LAG_INTERVAL", "LOG_LEVEL", "OUTBOX_INTERVAL", "PRIVATE_RPC_TIMEOUT", "PRIVATE_RPC_URLS", "RPC_VERIFY_THRESHOLD", "RPC_WS_URL", "WEBHOOK_ERRORS_PER_MINUTE"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected problems for %v, got %v", want, got)
+	}
+
+	c = valid()
+	c.Faults = "rpc_send=0.1,db_commit=0.05"
+	c.FaultsStaging = true
+
+	problems = c.validate()
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+	// the login needs someone who can log in
+	c = valid()
+	c.AdminSessionKey = strings.Repeat("ab", 32)
+	c.AdminSessionTTL = time.Minute
+	c.AdminPubkeys = []string{"npub1admin"}
+
+	problems = c.validate()
+	if len(problems) != 1 || problems[0].Env != "ADMIN_PUBKEYS" {
+		t.Errorf("expected a problem for ADMIN_PUBKEYS, got %v", problems)
+	}
+
+	c.AdminPubkeys = nil
+	problems = c.validate()
+	if len(problems) != 1 || problems[0].Env != "ADMIN_SESSION_KEY" {
+		t.Errorf("expected a problem for ADMIN_SESSION_KEY, got %v", problems)
+	}
+
+	// indexers push logs of chains by id
+	c = valid()
+	c.IngestChains = []string{"42220", "celo"}
+
+	problems = c.validate()
+	if len(problems) != 1 || problems[0].Env != "INGEST_CHAINS" {
+		t.Errorf("expected a problem for INGEST_CHAINS, got %v", problems)
+	}
+
+	// gift wraps are backdated, they would expire as soon as they are sent
+	c = valid()
+	c.DMTTL = 24 * time.Hour
+
+	problems = c.validate()
+	if len(problems) != 1 || problems[0].Env != "DM_TTL" {
+		t.Errorf("expected a problem for DM_TTL, got %v", problems)
+	}
+
+	// typing would expire before a member can refresh it
+	c = valid()
+	c.PresenceInterval = c.PresenceTypingTTL
+
+	problems = c.validate()
+	if len(problems) != 1 || problems[0].Env != "PRESENCE_INTERVAL" {
+		t.Errorf("expected a problem for PRESENCE_INTERVAL, got %v", problems)
+	}
+
+	// the denylist is fetched
+	c = valid()
+	c.DenylistURL = "denylist.json"
+
+	problems = c.validate()
+	if len(problems) != 2 || problems[0].Env != "DENYLIST_SYNC_INTERVAL" || problems[1].Env != "DENYLIST_URL" {
+		t.Errorf("expected problems for DENYLIST_SYNC_INTERVAL and DENYLIST_URL, got %v", problems)
+	}
+
+	// matching group messages are either rejected or flagged
+	c = valid()
+	c.WordFilterAction = "hide"
+
+	problems = c.validate()
+	if len(problems) != 1 || problems[0].Env != "WORD_FILTER_ACTION" {
+		t.Errorf("expected a problem for WORD_FILTER_ACTION, got %v", problems)
+	}
+
+	// the group check runs periodically
+	c = valid()
+	c.GroupCheck = true
+
+	problems = c.validate()
+	if len(problems) != 1 || problems[0].Env != "GROUP_CHECK_INTERVAL" {
+		t.Errorf("expected a problem for GROUP_CHECK_INTERVAL, got %v", problems)
+	}
+
+	// private bundles are waited for in whole seconds
+	c = valid()
+	c.PrivateRPCURLs = "1=https://rpc.flashbots.net"
+	c.PrivateRPCTimeout = 500 * time.Millisecond
+
+	problems = c.validate()
+	if len(problems) != 1 || problems[0].Env != "PRIVATE_RPC_TIMEOUT" {
+		t.Errorf("expected a problem for PRIVATE_RPC_TIMEOUT, got %v", problems)
+	}
+
+	// blobs are only archived to classes that are served without a restore
+	for class, want := range map[string]string{"STANDARD_IA": "BLOB_ARCHIVE_AFTER_DAYS", "GLACIER": "BLOB_ARCHIVE_CLASS", "GLACIER_IR": ""} {
+		c = valid()
+		c.BlobArchiveAfterDays = 7
+		c.BlobArchiveClass = class
+
+		problems = c.validate()
+		if (want == "" && len(problems) != 0) || (want != "" && (len(problems) != 1 || problems[0].Env != want)) {
+			t.Errorf("unexpected problems for %s: %v", class, problems)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	c := &Config{
+		RPC: RPC{
+			RPCURL:         "https://rpc.example.com/v2/apikey",
+			RPCWSURL:       "wss://rpc.example.com",
+			PrivateRPCURLs: "1=https://rpc.flashbots.net",
+		},
+		DB:      DB{DBUser: "relay", DBSecret: "c82fc59c202be1250b611d42bfdb2a9f02d8abf469e7655146c3edb8c64fc81a"},
+		Blossom: Blossom{AWSAccessKeyID: "AKIAEXAMPLE", AWSSecretAccessKey: "wJalrXUtnFEMI"},
+		APIKey:  "hunter2",
+	}
+
+	for _, out := range []string{c.String(), fmt.Sprintf("%v", c), fmt.Sprintf("%+v", *c), fmt.Sprintf("%#v", c), c.DB.String()} {
+		for _, secret := range []string{"apikey", "flashbots", "c82fc59c", "AKIAEXAMPLE", "wJalrXUtnFEMI", "hunter2"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("expected %q to be redacted in\n%s", secret, out)
+			}
+		}
+	}
+
+	out := c.String()
+	for _, want := range []string{"DB_USER=relay", "DB_SECRET=[redacted]", "RPC_URL=https://rpc.example.com/[redacted]", "RPC_WS_URL=wss://rpc.example.com\n", "API_KEY=[redacted]", "PINATA_API_KEY=\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_password")
+	err := os.WriteFile(path, []byte("from-file\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"DB_PASSWORD_FILE":  path,
+		"DB_SECRET":         "inline",
+		"RELAY_PRIVATE_KEY": "vault:secret/data/relay#key",
+		"API_KEY":           "inline",
+		"API_KEY_FILE":      path,
+	}
+
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	l, problems := loadSecrets(context.Background(), lookup)
+
+	if v, _ := l.overlay(lookup)("DB_PASSWORD"); v != "from-file" {
+		t.Errorf("expected DB_PASSWORD to be read from its file, got %q", v)
+	}
+
+	if v, _ := l.overlay(lookup)("DB_SECRET"); v != "inline" {
+		t.Errorf("expected DB_SECRET to stay inline, got %q", v)
+	}
+
+	if l.refs["DB_PASSWORD"] != "file:"+path || len(l.refs) != 1 {
+		t.Errorf("expected only DB_PASSWORD to be watched, got %v", l.refs)
+	}
+
+	got := []string{}
+	for _, p := range problems {
+		got = append(got, p.Env)
+	}
+	slices.Sort(got)
+
+	// a vault reference needs VAULT_ADDR and a setting can't be both inline and in a file
+	want := []string{"API_KEY", "RELAY_PRIVATE_KEY"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected problems for %v, got %v", want, got)
+	}
+}
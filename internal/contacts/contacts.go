@@ -0,0 +1,305 @@
+// Package contacts keeps the address books members use to name the accounts of their groups.
+//
+// An address book is a kind 31402 event with the group as d and h tag and an alias per address:
+//
+//	["alias", "<address>", "<name>"]
+//
+// A member has one address book per group, publishing it again replaces it. Address books are
+// only returned and broadcast to their author, they name the accounts of a group for its author
+// when logs are rendered: POST /v1/groups/{group_id}/contacts/resolve?addresses=0x..,0x..
+// with a request signed by a member.
+package contacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/fiatjaf/eventstore"
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const KindAddressBook = 31402
+
+const (
+	// most aliases in an address book
+	maxAliases = 1000
+
+	// longest name of an alias, in characters
+	maxNameLength = 64
+)
+
+// Groups checks the membership of groups
+type Groups interface {
+	IsMember(ctx context.Context, pubkey, groupID string) (bool, error)
+}
+
+// Links returns the pubkeys linked to an account
+type Links interface {
+	GetPubkeys(account string) ([]string, error)
+}
+
+// AddressBook is the address book of a member within a group
+type AddressBook struct {
+	Event   *nostr.Event
+	GroupID string
+	Aliases map[common.Address]string
+}
+
+// ParseAddressBook reads an address book, an error means it is invalid
+func ParseAddressBook(ev *nostr.Event) (*AddressBook, error) {
+	if ev.Kind != KindAddressBook {
+		return nil, errors.New("not an address book")
+	}
+
+	groupID := tagValue(ev, "h")
+	if groupID == "" {
+		return nil, errors.New("address book must have an h tag")
+	}
+
+	if ev.Tags.GetD() != groupID {
+		return nil, errors.New("the d tag of an address book must be its group")
+	}
+
+	b := &AddressBook{
+		Event:   ev,
+		GroupID: groupID,
+		Aliases: map[common.Address]string{},
+	}
+
+	for _, tag := range ev.Tags {
+		if len(tag) < 1 || tag[0] != "alias" {
+			continue
+		}
+
+		if len(tag) < 3 || !common.IsHexAddress(tag[1]) {
+			return nil, errors.New("alias must have an address and a name")
+		}
+
+		name := strings.TrimSpace(tag[2])
+		if name == "" || len([]rune(name)) > maxNameLength {
+			return nil, fmt.Errorf("alias name must be 1 to %d characters", maxNameLength)
+		}
+
+		b.Aliases[common.HexToAddress(tag[1])] = name
+	}
+
+	if len(b.Aliases) > maxAliases {
+		return nil, fmt.Errorf("address book can't have more than %d aliases", maxAliases)
+	}
+
+	return b, nil
+}
+
+type Service struct {
+	store  eventstore.Store
+	links  Links
+	groups Groups
+	now    func() time.Time
+}
+
+func NewService(store eventstore.Store, links Links, g Groups) *Service {
+	return &Service{
+		store:  store,
+		links:  links,
+		groups: g,
+		now:    time.Now,
+	}
+}
+
+// AddHooks validates address books and keeps them private to their author, membership is
+// enforced by the groups hook since address books are group events
+func (s *Service) AddHooks(relay *khatru.Relay) {
+	relay.RejectEvent = append(relay.RejectEvent, s.RejectEvent)
+	relay.PreventBroadcast = append(relay.PreventBroadcast, s.PreventBroadcast)
+	for i, query := range relay.QueryEvents {
+		relay.QueryEvents[i] = s.HideAddressBooks(query)
+	}
+}
+
+// RejectEvent rejects address books that don't parse
+func (s *Service) RejectEvent(ctx context.Context, ev *nostr.Event) (bool, string) {
+	if ev.Kind != KindAddressBook {
+		return false, ""
+	}
+
+	_, err := ParseAddressBook(ev)
+	if err != nil {
+		return true, "invalid: " + err.Error()
+	}
+
+	return false, ""
+}
+
+// HideAddressBooks wraps a query of the relay so that it only returns the address books of the
+// authenticated client
+func (s *Service) HideAddressBooks(query func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error)) func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+	return func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+		ch, err := query(ctx, filter)
+		if err != nil || !matchesKind(filter) || khatru.IsInternalCall(ctx) {
+			return ch, err
+		}
+
+		pubkey := khatru.GetAuthed(ctx)
+
+		out := make(chan *nostr.Event)
+		go func() {
+			defer close(out)
+
+			for ev := range ch {
+				if ev.Kind == KindAddressBook && ev.PubKey != pubkey {
+					continue
+				}
+
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		return out, nil
+	}
+}
+
+// PreventBroadcast only sends address books to their author
+func (s *Service) PreventBroadcast(ws *khatru.WebSocket, ev *nostr.Event) bool {
+	return ev.Kind == KindAddressBook && ws.AuthedPublicKey != ev.PubKey
+}
+
+// Lookup names the addresses for a member of a group: by the address book of the member first,
+// then by the profile name of a group member linked to the address. Addresses without a name are
+// left out.
+func (s *Service) Lookup(ctx context.Context, pubkey, groupID string, addresses []common.Address) ([]*relay.Contact, error) {
+	book, err := s.addressBook(ctx, pubkey, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := []*relay.Contact{}
+	for _, addr := range addresses {
+		if name, ok := book[addr]; ok {
+			contacts = append(contacts, &relay.Contact{Address: addr.Hex(), Name: name, Source: relay.ContactSourceAlias})
+			continue
+		}
+
+		name, err := s.profileName(ctx, addr, groupID)
+		if err != nil {
+			return nil, err
+		}
+
+		if name != "" {
+			contacts = append(contacts, &relay.Contact{Address: addr.Hex(), Name: name, Source: relay.ContactSourceProfile})
+		}
+	}
+
+	return contacts, nil
+}
+
+// addressBook returns the aliases of a member within a group
+func (s *Service) addressBook(ctx context.Context, pubkey, groupID string) (map[common.Address]string, error) {
+	events, err := s.store.QueryEvents(ctx, nostr.Filter{
+		Kinds:   []int{KindAddressBook},
+		Authors: []string{pubkey},
+		Tags:    nostr.TagMap{"d": []string{groupID}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the newest address book wins if an older one was not replaced yet
+	var latest *nostr.Event
+	for ev := range events {
+		if latest == nil || ev.CreatedAt > latest.CreatedAt {
+			latest = ev
+		}
+	}
+
+	if latest == nil {
+		return nil, nil
+	}
+
+	b, err := ParseAddressBook(latest)
+	if err != nil {
+		log.Printf("Error parsing stored address book %s: %v", latest.ID, err)
+		return nil, nil
+	}
+
+	return b.Aliases, nil
+}
+
+// profileName returns the profile name of a member of the group linked to an address, the
+// profiles of pubkeys outside of the group are not used
+func (s *Service) profileName(ctx context.Context, addr common.Address, groupID string) (string, error) {
+	pubkeys, err := s.links.GetPubkeys(addr.Hex())
+	if err != nil {
+		return "", err
+	}
+
+	members := []string{}
+	for _, pk := range pubkeys {
+		ok, err := s.groups.IsMember(ctx, pk, groupID)
+		if err != nil {
+			return "", err
+		}
+
+		if ok {
+			members = append(members, pk)
+		}
+	}
+
+	if len(members) == 0 {
+		return "", nil
+	}
+
+	events, err := s.store.QueryEvents(ctx, nostr.Filter{
+		Kinds:   []int{nostr.KindProfileMetadata},
+		Authors: members,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var latest *nostr.Event
+	for ev := range events {
+		if latest == nil || ev.CreatedAt > latest.CreatedAt {
+			latest = ev
+		}
+	}
+
+	if latest == nil {
+		return "", nil
+	}
+
+	return profileDisplayName(latest.Content), nil
+}
+
+// matchesKind checks if a filter can return address books
+func matchesKind(filter nostr.Filter) bool {
+	if len(filter.Kinds) == 0 {
+		return true
+	}
+
+	for _, kind := range filter.Kinds {
+		if kind == KindAddressBook {
+			return true
+		}
+	}
+
+	return false
+}
+
+func tagValue(ev *nostr.Event, name string) string {
+	tag := ev.Tags.GetFirst([]string{name, ""})
+	if tag != nil && len(*tag) >= 2 {
+		return (*tag)[1]
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+package contacts
+
+import (
+	"context"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/fiatjaf/eventstore/slicestore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	alice = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+	bob   = "0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512"
+	carol = "0x9fE46736679d2D9a65F0992F2272dE9f3c7fa6e0"
+)
+
+type fakeLinks map[string][]string
+
+func (l fakeLinks) GetPubkeys(account string) ([]string, error) {
+	return l[account], nil
+}
+
+func TestParseAddressBook(t *testing.T) {
+	cases := []struct {
+		name  string
+		tags  nostr.Tags
+		valid bool
+	}{
+		{"valid", nostr.Tags{{"d", "demo"}, {"h", "demo"}, {"alias", alice, " Alice "}}, true},
+		{"no group", nostr.Tags{{"d", "demo"}, {"alias", alice, "Alice"}}, false},
+		{"other d tag", nostr.Tags{{"d", "other"}, {"h", "demo"}}, false},
+		{"invalid address", nostr.Tags{{"d", "demo"}, {"h", "demo"}, {"alias", "0x1", "Alice"}}, false},
+		{"no name", nostr.Tags{{"d", "demo"}, {"h", "demo"}, {"alias", alice}}, false},
+		{"empty name", nostr.Tags{{"d", "demo"}, {"h", "demo"}, {"alias", alice, "  "}}, false},
+	}
+
+	for _, c := range cases {
+		b, err := ParseAddressBook(&nostr.Event{Kind: KindAddressBook, Tags: c.tags})
+		if c.valid != (err == nil) {
+			t.Fatalf("%s: expected valid %v, got %v", c.name, c.valid, err)
+		}
+
+		if c.valid && b.Aliases[common.HexToAddress(alice)] != "Alice" {
+			t.Fatalf("%s: expected the alias to be trimmed, got %v", c.name, b.Aliases)
+		}
+	}
+}
+
+func TestParseAddresses(t *testing.T) {
+	addresses, ok := parseAddresses(alice + ", " + bob + "," + alice)
+	if !ok || len(addresses) != 2 {
+		t.Fatalf("expected 2 addresses, got %v %v", addresses, ok)
+	}
+
+	_, ok = parseAddresses(alice + ",nope")
+	if ok {
+		t.Fatal("expected an invalid address to be rejected")
+	}
+
+	_, ok = parseAddresses("")
+	if ok {
+		t.Fatal("expected no addresses to be rejected")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	ctx := context.Background()
+
+	store := &slicestore.SliceStore{}
+	err := store.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	member := nostr.GeneratePrivateKey()
+	memberPK, _ := nostr.GetPublicKey(member)
+	bobSK := nostr.GeneratePrivateKey()
+	bobPK, _ := nostr.GetPublicKey(bobSK)
+	outsider := nostr.GeneratePrivateKey()
+	outsiderPK, _ := nostr.GetPublicKey(outsider)
+
+	save := func(sk string, ev *nostr.Event) {
+		ev.CreatedAt = nostr.Now()
+		err := ev.Sign(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.SaveEvent(ctx, ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	save(member, &nostr.Event{Kind: KindAddressBook, Tags: nostr.Tags{{"d", "demo"}, {"h", "demo"}, {"alias", alice, "Mom"}}})
+	save(bobSK, &nostr.Event{Kind: nostr.KindProfileMetadata, Content: `{"name":"bob","display_name":"Bob"}`})
+	save(outsider, &nostr.Event{Kind: nostr.KindProfileMetadata, Content: `{"name":"carol"}`})
+
+	s := NewService(store, fakeLinks{
+		common.HexToAddress(bob).Hex():   {bobPK},
+		common.HexToAddress(carol).Hex(): {outsiderPK},
+	}, &testutil.FakeGroups{Members: map[string][]string{"demo": {memberPK, bobPK}}})
+
+	contacts, err := s.Lookup(ctx, memberPK, "demo", []common.Address{
+		common.HexToAddress(alice),
+		common.HexToAddress(bob),
+		common.HexToAddress(carol),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// carol is linked to a pubkey outside of the group, her profile isn't used
+	want := []relay.Contact{
+		{Address: common.HexToAddress(alice).Hex(), Name: "Mom", Source: relay.ContactSourceAlias},
+		{Address: common.HexToAddress(bob).Hex(), Name: "Bob", Source: relay.ContactSourceProfile},
+	}
+	if len(contacts) != len(want) {
+		t.Fatalf("expected %v, got %d contacts", want, len(contacts))
+	}
+	for i := range want {
+		if *contacts[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want[i], *contacts[i])
+		}
+	}
+
+	// the address book of a member isn't used for anyone else
+	contacts, err = s.Lookup(ctx, bobPK, "demo", []common.Address{common.HexToAddress(alice)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contacts) != 0 {
+		t.Fatalf("expected no contacts, got %v", contacts)
+	}
+}
@@ -0,0 +1,98 @@
+package contacts
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+)
+
+// most addresses resolved in a request
+const maxAddresses = 100
+
+// Resolve godoc
+//
+//	@Summary		Resolve addresses to display names
+//	@Description	name the addresses of a group for a member, by the address book of the member then by the profiles of the group members linked to them
+//	@Tags			groups
+//	@Accept			json
+//	@Produce		json
+//	@Param			group_id	path		string	true	"Group ID"
+//	@Param			addresses	query		string	true	"Comma separated addresses, at most 100"
+//	@Param			event		body		object	true	"NIP-98 event signed by a member for this request"
+//	@Success		200	{object}	common.Response
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/v1/groups/{group_id}/contacts/resolve [post]
+func (s *Service) Resolve(w http.ResponseWriter, r *http.Request) {
+	addresses, ok := parseAddresses(r.URL.Query().Get("addresses"))
+	if !ok {
+		http.Error(w, "addresses must be a comma separated list of at most 100 addresses", http.StatusBadRequest)
+		return
+	}
+
+	groupID := chi.URLParam(r, "group_id")
+
+	ev, err := com.ParseMemberRequest(r, s.groups, groupID, s.now(), nil)
+	if err != nil {
+		com.WriteMemberRequestError(w, err)
+		return
+	}
+
+	contacts, err := s.Lookup(r.Context(), ev.PubKey, groupID, addresses)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.BodyMultiple(w, contacts, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// parseAddresses reads a comma separated list of addresses, duplicates are resolved once
+func parseAddresses(s string) ([]common.Address, bool) {
+	addresses := []common.Address{}
+	seen := map[common.Address]bool{}
+	for _, a := range strings.Split(s, ",") {
+		a = strings.TrimSpace(a)
+		if !common.IsHexAddress(a) {
+			return nil, false
+		}
+
+		addr := common.HexToAddress(a)
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		addresses = append(addresses, addr)
+	}
+
+	return addresses, len(addresses) <= maxAddresses
+}
+
+// profileDisplayName reads the name a profile is shown with, the display name when it is set
+func profileDisplayName(content string) string {
+	var p struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"display_name"`
+	}
+
+	err := json.Unmarshal([]byte(content), &p)
+	if err != nil {
+		return ""
+	}
+
+	if name := strings.TrimSpace(p.DisplayName); name != "" {
+		return name
+	}
+
+	return strings.TrimSpace(p.Name)
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AccountLinkDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewAccountLinkDB creates a new DB
+func NewAccountLinkDB(ctx context.Context, db, rdb *pgxpool.Pool) (*AccountLinkDB, error) {
+	return &AccountLinkDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateAccountLinksTable creates a table to store the account each nostr pubkey is linked to
+func (db *AccountLinkDB) CreateAccountLinksTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_account_links(
+		pubkey text NOT NULL PRIMARY KEY,
+		account text NOT NULL,
+		owner text NOT NULL,
+		signature text NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`)
+
+	return err
+}
+
+// CreateAccountLinksTableIndexes creates the indexes for the account links table
+func (db *AccountLinkDB) CreateAccountLinksTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_account_links_account ON t_account_links (account);
+	`)
+
+	return err
+}
+
+// SetLink links a pubkey to an account, linking it again replaces the previous account
+func (db *AccountLinkDB) SetLink(l *relay.AccountLink) error {
+	_, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_account_links (pubkey, account, owner, signature, created_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (pubkey) DO UPDATE SET
+		account = EXCLUDED.account,
+		owner = EXCLUDED.owner,
+		signature = EXCLUDED.signature,
+		created_at = EXCLUDED.created_at
+	`, l.Pubkey, l.Account, l.Owner, l.Signature, l.CreatedAt)
+
+	return err
+}
+
+// GetLink returns the account a pubkey is linked to, nil if it isn't linked
+func (db *AccountLinkDB) GetLink(pubkey string) (*relay.AccountLink, error) {
+	var l relay.AccountLink
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT pubkey, account, owner, signature, created_at
+	FROM t_account_links
+	WHERE pubkey = $1
+	`, pubkey).Scan(&l.Pubkey, &l.Account, &l.Owner, &l.Signature, &l.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// RemoveLink removes the link of a pubkey to its account
+func (db *AccountLinkDB) RemoveLink(pubkey string) error {
+	_, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_account_links
+	WHERE pubkey = $1
+	`, pubkey)
+
+	return err
+}
+
+// GetPubkeys returns the pubkeys linked to an account
+func (db *AccountLinkDB) GetPubkeys(account string) ([]string, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT pubkey
+	FROM t_account_links
+	WHERE account = $1
+	ORDER BY created_at
+	`, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pubkeys := []string{}
+	for rows.Next() {
+		var pk string
+		err := rows.Scan(&pk)
+		if err != nil {
+			return nil, err
+		}
+
+		pubkeys = append(pubkeys, pk)
+	}
+
+	return pubkeys, rows.Err()
+}
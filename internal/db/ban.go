@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type BanDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewBanDB creates a new DB
+func NewBanDB(ctx context.Context, db, rdb *pgxpool.Pool) (*BanDB, error) {
+	return &BanDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateBansTable creates a table to store the blobs and events banned from the relay
+func (db *BanDB) CreateBansTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_bans(
+		kind text NOT NULL,
+		value text NOT NULL,
+		reason text NOT NULL DEFAULT '',
+		source text NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp,
+		PRIMARY KEY (kind, value)
+	);
+	`)
+
+	return err
+}
+
+// CreateBansTableIndexes creates the indexes for the bans table
+func (db *BanDB) CreateBansTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_bans_source ON t_bans (source);
+	`)
+
+	return err
+}
+
+// AddBan stores a ban, banning something again replaces its reason and source
+func (db *BanDB) AddBan(b *relay.Ban) error {
+	_, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_bans (kind, value, reason, source, created_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (kind, value) DO UPDATE SET reason = EXCLUDED.reason, source = EXCLUDED.source
+	`, b.Kind, b.Value, b.Reason, b.Source, b.CreatedAt)
+
+	return err
+}
+
+// RemoveBan removes a ban, false is returned if it doesn't exist
+func (db *BanDB) RemoveBan(kind, value string) (bool, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_bans
+	WHERE kind = $1 AND value = $2
+	`, kind, value)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// GetBans returns every ban, latest first
+func (db *BanDB) GetBans() ([]*relay.Ban, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT kind, value, reason, source, created_at
+	FROM t_bans
+	ORDER BY created_at DESC, kind, value
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []*relay.Ban{}
+	for rows.Next() {
+		var b relay.Ban
+		err := rows.Scan(&b.Kind, &b.Value, &b.Reason, &b.Source, &b.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		bans = append(bans, &b)
+	}
+
+	return bans, rows.Err()
+}
+
+// ReplaceSyncedBans replaces the bans synced from the shared denylist, the bans of operators are
+// kept whether the denylist has them or not
+func (db *BanDB) ReplaceSyncedBans(bans []*relay.Ban) error {
+	tx, err := db.db.Begin(db.ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(db.ctx)
+
+	_, err = tx.Exec(db.ctx, `
+	DELETE FROM t_bans WHERE source = $1
+	`, relay.BanSourceSync)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bans {
+		_, err = tx.Exec(db.ctx, `
+		INSERT INTO t_bans (kind, value, reason, source, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (kind, value) DO NOTHING
+		`, b.Kind, b.Value, b.Reason, relay.BanSourceSync, b.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(db.ctx)
+}
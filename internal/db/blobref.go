@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type BlobRefDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewBlobRefDB creates a new DB
+func NewBlobRefDB(ctx context.Context, db, rdb *pgxpool.Pool) (*BlobRefDB, error) {
+	return &BlobRefDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateBlobRefsTable creates the table of blobs referenced by events, and records since when
+// references are tracked
+func (db *BlobRefDB) CreateBlobRefsTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_blob_refs(
+		sha256 text NOT NULL,
+		event_id text NOT NULL,
+		group_id text NOT NULL DEFAULT '',
+		created_at timestamp NOT NULL DEFAULT current_timestamp,
+		PRIMARY KEY (sha256, event_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS t_blob_ref_tracking(
+		since timestamp NOT NULL
+	);
+
+	INSERT INTO t_blob_ref_tracking (since)
+	SELECT now() AT TIME ZONE 'utc'
+	WHERE NOT EXISTS (SELECT 1 FROM t_blob_ref_tracking);
+	`)
+
+	return err
+}
+
+// CreateBlobRefsTableIndexes creates the indexes for the blob references table
+func (db *BlobRefDB) CreateBlobRefsTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_blob_refs_event_id ON t_blob_refs (event_id);
+	CREATE INDEX IF NOT EXISTS idx_blob_refs_group_id ON t_blob_refs (group_id);
+	`)
+
+	return err
+}
+
+// TrackingSince returns since when references are tracked, blobs uploaded before may be referenced
+// by events that were never tracked
+func (db *BlobRefDB) TrackingSince() (time.Time, error) {
+	var since time.Time
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT since
+	FROM t_blob_ref_tracking
+	LIMIT 1
+	`).Scan(&since)
+
+	return since, err
+}
+
+// AddRefs records the blobs an event references
+func (db *BlobRefDB) AddRefs(eventID, groupID string, shas []string, t time.Time) error {
+	_, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_blob_refs (sha256, event_id, group_id, created_at)
+	SELECT unnest($1::text[]), $2, $3, $4
+	ON CONFLICT (sha256, event_id) DO NOTHING
+	`, shas, eventID, groupID, t)
+
+	return err
+}
+
+// RemoveEventRefs removes the references of deleted events and returns how many were removed
+func (db *BlobRefDB) RemoveEventRefs(eventIDs []string) (int64, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_blob_refs
+	WHERE event_id = ANY($1)
+	`, eventIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// RemoveGroupRefs removes the references of the events of a deleted group, events added to a new
+// group with the same id after the deletion keep theirs
+func (db *BlobRefDB) RemoveGroupRefs(groupID string, before time.Time) (int64, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_blob_refs
+	WHERE group_id = $1 AND created_at <= $2
+	`, groupID, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// GetUnreferenced returns the blobs no event references
+func (db *BlobRefDB) GetUnreferenced(shas []string) ([]string, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT DISTINCT u.sha256
+	FROM unnest($1::text[]) AS u(sha256)
+	WHERE NOT EXISTS (SELECT 1 FROM t_blob_refs r WHERE r.sha256 = u.sha256)
+	ORDER BY u.sha256
+	`, shas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unreferenced := []string{}
+	for rows.Next() {
+		var sha string
+		err := rows.Scan(&sha)
+		if err != nil {
+			return nil, err
+		}
+
+		unreferenced = append(unreferenced, sha)
+	}
+
+	return unreferenced, rows.Err()
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type BlobRewriteDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewBlobRewriteDB creates a new DB
+func NewBlobRewriteDB(ctx context.Context, db, rdb *pgxpool.Pool) (*BlobRewriteDB, error) {
+	return &BlobRewriteDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateBlobRewritesTable creates the table of the blobs stored with another content than the
+// one that was uploaded, such as images stripped of their metadata
+func (db *BlobRewriteDB) CreateBlobRewritesTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_blob_rewrites(
+		sha256 text PRIMARY KEY,
+		content_sha256 text NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`)
+
+	return err
+}
+
+// AddRewrite records the hash of the content stored for an uploaded blob
+func (db *BlobRewriteDB) AddRewrite(sha256, contentSha256 string) error {
+	_, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_blob_rewrites (sha256, content_sha256)
+	VALUES ($1, $2)
+	ON CONFLICT (sha256) DO UPDATE SET content_sha256 = EXCLUDED.content_sha256
+	`, sha256, contentSha256)
+
+	return err
+}
+
+// ContentHash returns the hash of the content stored for a blob, which is its own hash unless
+// the blob was rewritten
+func (db *BlobRewriteDB) ContentHash(sha256 string) (string, error) {
+	var content string
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT content_sha256
+	FROM t_blob_rewrites
+	WHERE sha256 = $1
+	`, sha256).Scan(&content)
+	if err == pgx.ErrNoRows {
+		return sha256, nil
+	}
+
+	return content, err
+}
@@ -14,6 +14,9 @@ import (
 	_ "github.com/jackc/pgx/v5/pgxpool"
 )
 
+// push tokens registered by nostr pubkey instead of by account
+const nostrPushTokenSuffix = "nostr"
+
 type DB struct {
 	ctx context.Context
 
@@ -26,6 +29,73 @@ type DB struct {
 	SponsorDB   *SponsorDB
 	PushTokenDB map[string]*PushTokenDB
 	DataDB      *DataDB
+	PinDB       *PinDB
+	SpendDB     *SpendDB
+	FactoryDB   *FactoryDB
+
+	// user ops signed by sponsors, used to limit what an account can be sponsored
+	SponsorshipDB *SponsorshipDB
+
+	// user ops that paymasters refused to sponsor, and why
+	SponsorshipDenialDB *SponsorshipDenialDB
+
+	// push tokens and preferences keyed by nostr pubkey
+	NostrPushTokenDB *PushTokenDB
+	PushPreferenceDB *PushPreferenceDB
+
+	// tokens minted by group admins for bots and integrations
+	GroupTokenDB *GroupTokenDB
+
+	// email addresses allowed to post into groups
+	EmailSenderDB *EmailSenderDB
+
+	// votes counted on group polls
+	PollVoteDB *PollVoteDB
+
+	// members of token gated groups who don't hold enough tokens anymore
+	TokenGateDB *TokenGateDB
+
+	// smart accounts linked to nostr pubkeys
+	AccountLinkDB *AccountLinkDB
+
+	// erasure requests of pubkeys and their outcome
+	ErasureDB *ErasureDB
+
+	// purges approved by admins and their audit trail
+	PurgeDB *PurgeDB
+
+	// uploaded blobs and the uploaders flagged for their volume
+	UploadDB *UploadDB
+
+	// blobs referenced by events, unreferenced blobs are garbage collected
+	BlobRefDB *BlobRefDB
+
+	// video blobs transcoded to a mobile friendly format
+	TranscodeDB *TranscodeDB
+
+	// antivirus scans of quarantined blobs
+	ScanDB *ScanDB
+
+	// blobs stored with another content than the uploaded one
+	BlobRewriteDB *BlobRewriteDB
+
+	// webhooks receiving the transitions of the user ops of senders and paymasters
+	UserOpWebhookDB *UserOpWebhookDB
+
+	// blobs and events banned from the relay, across all groups
+	BanDB *BanDB
+
+	// group messages that matched a keyword filter
+	FilteredContentDB *FilteredContentDB
+
+	// groups and their members projected from moderation events
+	GroupStateDB *GroupStateDB
+
+	// events the relay signed but failed to store, retried until they are
+	OutboxDB *OutboxDB
+
+	// duration of the recent queries, reported to autoscalers
+	Latency *Latency
 }
 
 // NewDB instantiates a new DB
@@ -33,7 +103,15 @@ func NewDB(chainID *big.Int, secret, username, password, dbname, port, host, rho
 	ctx := context.Background()
 
 	connStr := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable", username, password, dbname, host, port)
-	db, err := pgxpool.New(ctx, connStr)
+	poolConfig, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+
+	latency := NewLatency()
+	poolConfig.ConnConfig.Tracer = latency
+
+	db, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -60,6 +138,26 @@ func NewDB(chainID *big.Int, secret, username, password, dbname, port, host, rho
 		return nil, err
 	}
 
+	pindb, err := NewPinDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	spenddb, err := NewSpendDB(ctx, db, db, evname)
+	if err != nil {
+		return nil, err
+	}
+
+	factorydb, err := NewFactoryDB(ctx, db, db, evname)
+	if err != nil {
+		return nil, err
+	}
+
+	sponsorshipdb, err := NewSponsorshipDB(ctx, db, db, evname)
+	if err != nil {
+		return nil, err
+	}
+
 	d := &DB{
 		ctx:       ctx,
 		chainID:   chainID,
@@ -68,6 +166,13 @@ func NewDB(chainID *big.Int, secret, username, password, dbname, port, host, rho
 		EventDB:   eventDB,
 		SponsorDB: sponsorDB,
 		DataDB:    datadb,
+		PinDB:     pindb,
+		SpendDB:   spenddb,
+		FactoryDB: factorydb,
+
+		SponsorshipDB: sponsorshipdb,
+
+		Latency: latency,
 	}
 
 	// check if db exists before opening, since we use rwc mode
@@ -90,6 +195,12 @@ func NewDB(chainID *big.Int, secret, username, password, dbname, port, host, rho
 		}
 	}
 
+	// make sure older tables have the latest columns
+	err = eventDB.MigrateEventsTable()
+	if err != nil {
+		return nil, err
+	}
+
 	// check if db exists before opening, since we use rwc mode
 	exists, err = d.SponsorTableExists(evname)
 	if err != nil {
@@ -110,6 +221,24 @@ func NewDB(chainID *big.Int, secret, username, password, dbname, port, host, rho
 		}
 	}
 
+	// make sure older tables have the latest columns
+	err = sponsorDB.MigrateSponsorsTable(evname)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err = d.FactoryTableExists(evname)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		err = factorydb.CreateFactoriesTable()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	log.Default().Println("creating data db")
 
 	// check if db exists before opening, since we use rwc mode
@@ -132,6 +261,79 @@ func NewDB(chainID *big.Int, secret, username, password, dbname, port, host, rho
 		}
 	}
 
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.PinTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = pindb.CreatePinsTable()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.SpendTableExists(evname)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = spenddb.CreateSpendTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = spenddb.CreateSpendTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	exists, err = d.SponsorshipTableExists(evname)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		err = sponsorshipdb.CreateSponsorshipsTable()
+		if err != nil {
+			return nil, err
+		}
+
+		err = sponsorshipdb.CreateSponsorshipsTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.SponsorshipDenialDB, err = NewSponsorshipDenialDB(ctx, db, db, evname)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err = d.SponsorshipDenialTableExists(evname)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		err = d.SponsorshipDenialDB.CreateSponsorshipDenialsTable()
+		if err != nil {
+			return nil, err
+		}
+
+		err = d.SponsorshipDenialDB.CreateSponsorshipDenialsTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	ptdb := map[string]*PushTokenDB{}
 
 	evs, err := eventDB.GetEvents(chainID.String())
@@ -175,96 +377,882 @@ func NewDB(chainID *big.Int, secret, username, password, dbname, port, host, rho
 
 	d.PushTokenDB = ptdb
 
-	return d, nil
-}
+	log.Default().Println("creating nostr push db")
 
-// EventTableExists checks if a table exists in the database
-func (db *DB) EventTableExists() (bool, error) {
-	tableName := "t_events"
-	var exists bool
-	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	d.NostrPushTokenDB, err = NewPushTokenDB(ctx, db, db, nostrPushTokenSuffix)
 	if err != nil {
-		// A database error occurred
-		return false, err
+		return nil, err
 	}
-	return exists, nil
-}
 
-// SponsorTableExists checks if a table exists in the database
-func (db *DB) SponsorTableExists(suffix string) (bool, error) {
-	tableName := fmt.Sprintf("t_sponsors_%s", suffix)
-	var exists bool
-	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.PushTokenTableExists(nostrPushTokenSuffix)
 	if err != nil {
-		// A database error occurred
-		return false, err
+		return nil, err
 	}
-	return exists, nil
-}
 
-// LogTableExists checks if a table exists in the database
-func (db *DB) LogTableExists(suffix string) (bool, error) {
-	tableName := fmt.Sprintf("t_transfers_%s", suffix)
-	var exists bool
-	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if !exists {
+		// create table
+		err = d.NostrPushTokenDB.CreatePushTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.NostrPushTokenDB.CreatePushTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.PushPreferenceDB, err = NewPushPreferenceDB(ctx, db, db)
 	if err != nil {
-		// A database error occurred
-		return false, err
+		return nil, err
 	}
-	return exists, nil
-}
 
-// PushTokenTableExists checks if a table exists in the database
-func (db *DB) PushTokenTableExists(suffix string) (bool, error) {
-	tableName := fmt.Sprintf("t_push_token_%s", suffix)
-	var exists bool
-	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.PushPreferenceTableExists()
 	if err != nil {
-		// A database error occurred
-		return false, err
+		return nil, err
 	}
-	return exists, nil
-}
 
-// DataTableExists checks if a table exists in the database
-func (db *DB) DataTableExists() (bool, error) {
-	tableName := "t_logs_data"
-	var exists bool
-	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if !exists {
+		// create table
+		err = d.PushPreferenceDB.CreatePushPreferencesTable()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// make sure older tables have the latest columns
+	err = d.PushPreferenceDB.MigratePushPreferencesTable()
 	if err != nil {
-		// A database error occurred
-		return false, err
+		return nil, err
 	}
-	return exists, nil
-}
 
-// TableNameSuffix returns the name of the transfer db for the given contract
-func (d *DB) TableNameSuffix(contract string) (string, error) {
-	re := regexp.MustCompile("^0x[0-9a-fA-F]{40}$")
+	d.GroupTokenDB, err = NewGroupTokenDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
 
-	suffix := fmt.Sprintf("%v_%s", d.chainID, strings.ToLower(contract))
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.GroupTokenTableExists()
+	if err != nil {
+		return nil, err
+	}
 
-	if !re.MatchString(contract) {
-		return suffix, errors.New("bad contract address")
+	if !exists {
+		// create table
+		err = d.GroupTokenDB.CreateGroupTokensTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.GroupTokenDB.CreateGroupTokensTableIndexes()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return suffix, nil
-}
+	d.EmailSenderDB, err = NewEmailSenderDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
 
-// GetPushTokenDB returns true if the push token db for the given contract exists, returns the db if it exists
-func (d *DB) GetPushTokenDB(contract string) (*PushTokenDB, bool) {
-	name, err := d.TableNameSuffix(contract)
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.EmailSenderTableExists()
 	if err != nil {
-		return nil, false
+		return nil, err
 	}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	ptdb, ok := d.PushTokenDB[name]
-	if !ok {
-		return nil, false
+	if !exists {
+		// create table
+		err = d.EmailSenderDB.CreateEmailSendersTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.EmailSenderDB.CreateEmailSendersTableIndexes()
+		if err != nil {
+			return nil, err
+		}
 	}
-	return ptdb, true
+
+	d.PollVoteDB, err = NewPollVoteDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.PollVoteTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.PollVoteDB.CreatePollVotesTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.PollVoteDB.CreatePollVotesTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.TokenGateDB, err = NewTokenGateDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.TokenGateTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.TokenGateDB.CreateTokenGateLapsesTable()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.AccountLinkDB, err = NewAccountLinkDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.AccountLinkTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.AccountLinkDB.CreateAccountLinksTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.AccountLinkDB.CreateAccountLinksTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.ErasureDB, err = NewErasureDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.ErasureTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.ErasureDB.CreateErasureRequestsTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.ErasureDB.CreateErasureRequestsTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.PurgeDB, err = NewPurgeDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.PurgeTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.PurgeDB.CreatePurgesTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.PurgeDB.CreatePurgesTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.UploadDB, err = NewUploadDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.UploadTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.UploadDB.CreateUploadsTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.UploadDB.CreateUploadsTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// make sure older tables have the latest columns
+	err = d.UploadDB.MigrateUploadsTable()
+	if err != nil {
+		return nil, err
+	}
+
+	d.BlobRefDB, err = NewBlobRefDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.BlobRefTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.BlobRefDB.CreateBlobRefsTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.BlobRefDB.CreateBlobRefsTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.TranscodeDB, err = NewTranscodeDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.TranscodeTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.TranscodeDB.CreateTranscodesTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.TranscodeDB.CreateTranscodesTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.ScanDB, err = NewScanDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.ScanTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.ScanDB.CreateScansTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.ScanDB.CreateScansTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.BlobRewriteDB, err = NewBlobRewriteDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.BlobRewriteTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.BlobRewriteDB.CreateBlobRewritesTable()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.UserOpWebhookDB, err = NewUserOpWebhookDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.UserOpWebhookTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.UserOpWebhookDB.CreateUserOpWebhooksTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.UserOpWebhookDB.CreateUserOpWebhooksTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.BanDB, err = NewBanDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.BanTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.BanDB.CreateBansTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.BanDB.CreateBansTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.FilteredContentDB, err = NewFilteredContentDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.FilteredContentTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.FilteredContentDB.CreateFilteredContentTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.FilteredContentDB.CreateFilteredContentTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.GroupStateDB, err = NewGroupStateDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.GroupsTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.GroupStateDB.CreateGroupsTable()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.GroupMembersTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.GroupStateDB.CreateGroupMembersTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.GroupStateDB.CreateGroupMembersTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.OutboxDB, err = NewOutboxDB(ctx, db, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if db exists before opening, since we use rwc mode
+	exists, err = d.OutboxTableExists()
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		// create table
+		err = d.OutboxDB.CreateOutboxTable()
+		if err != nil {
+			return nil, err
+		}
+
+		// create indexes
+		err = d.OutboxDB.CreateOutboxTableIndexes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// EventTableExists checks if a table exists in the database
+func (db *DB) EventTableExists() (bool, error) {
+	tableName := "t_events"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// SponsorTableExists checks if a table exists in the database
+func (db *DB) SponsorTableExists(suffix string) (bool, error) {
+	tableName := fmt.Sprintf("t_sponsors_%s", suffix)
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// LogTableExists checks if a table exists in the database
+func (db *DB) LogTableExists(suffix string) (bool, error) {
+	tableName := fmt.Sprintf("t_transfers_%s", suffix)
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// PushTokenTableExists checks if a table exists in the database
+func (db *DB) PushTokenTableExists(suffix string) (bool, error) {
+	tableName := fmt.Sprintf("t_push_token_%s", suffix)
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// EmailSenderTableExists checks if a table exists in the database
+func (db *DB) EmailSenderTableExists() (bool, error) {
+	tableName := "t_email_senders"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// PollVoteTableExists checks if a table exists in the database
+func (db *DB) PollVoteTableExists() (bool, error) {
+	tableName := "t_poll_votes"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// TokenGateTableExists checks if a table exists in the database
+func (db *DB) TokenGateTableExists() (bool, error) {
+	tableName := "t_token_gate_lapses"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// AccountLinkTableExists checks if a table exists in the database
+func (db *DB) AccountLinkTableExists() (bool, error) {
+	tableName := "t_account_links"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// ErasureTableExists checks if a table exists in the database
+func (db *DB) ErasureTableExists() (bool, error) {
+	tableName := "t_erasure_requests"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// PurgeTableExists checks if a table exists in the database
+func (db *DB) PurgeTableExists() (bool, error) {
+	tableName := "t_purges"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// UploadTableExists checks if a table exists in the database
+func (db *DB) UploadTableExists() (bool, error) {
+	tableName := "t_uploads"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// BlobRefTableExists checks if a table exists in the database
+func (db *DB) BlobRefTableExists() (bool, error) {
+	tableName := "t_blob_refs"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// TranscodeTableExists checks if a table exists in the database
+func (db *DB) TranscodeTableExists() (bool, error) {
+	tableName := "t_transcodes"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// ScanTableExists checks if a table exists in the database
+func (db *DB) ScanTableExists() (bool, error) {
+	tableName := "t_scans"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// BlobRewriteTableExists checks if a table exists in the database
+func (db *DB) BlobRewriteTableExists() (bool, error) {
+	tableName := "t_blob_rewrites"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// UserOpWebhookTableExists checks if a table exists in the database
+func (db *DB) UserOpWebhookTableExists() (bool, error) {
+	tableName := "t_userop_webhooks"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// BanTableExists checks if a table exists in the database
+func (db *DB) BanTableExists() (bool, error) {
+	tableName := "t_bans"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// FilteredContentTableExists checks if a table exists in the database
+func (db *DB) FilteredContentTableExists() (bool, error) {
+	tableName := "t_filtered_content"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// GroupsTableExists checks if a table exists in the database
+func (db *DB) GroupsTableExists() (bool, error) {
+	tableName := "t_groups"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// GroupMembersTableExists checks if a table exists in the database
+func (db *DB) GroupMembersTableExists() (bool, error) {
+	tableName := "t_group_members"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// OutboxTableExists checks if a table exists in the database
+func (db *DB) OutboxTableExists() (bool, error) {
+	tableName := "t_outbox"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// GroupTokenTableExists checks if a table exists in the database
+func (db *DB) GroupTokenTableExists() (bool, error) {
+	tableName := "t_group_tokens"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// PushPreferenceTableExists checks if a table exists in the database
+func (db *DB) PushPreferenceTableExists() (bool, error) {
+	tableName := "t_push_preferences"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// DataTableExists checks if a table exists in the database
+func (db *DB) DataTableExists() (bool, error) {
+	tableName := "t_logs_data"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// PinTableExists checks if a table exists in the database
+func (db *DB) PinTableExists() (bool, error) {
+	tableName := "t_ipfs_pins"
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// FactoryTableExists checks if a table exists in the database
+func (db *DB) FactoryTableExists(suffix string) (bool, error) {
+	tableName := fmt.Sprintf("t_account_factories_%s", suffix)
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// SponsorshipTableExists checks if a table exists in the database
+func (db *DB) SponsorshipTableExists(suffix string) (bool, error) {
+	tableName := fmt.Sprintf("t_sponsorships_%s", suffix)
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// SponsorshipDenialTableExists checks if a table exists in the database
+func (db *DB) SponsorshipDenialTableExists(suffix string) (bool, error) {
+	tableName := fmt.Sprintf("t_sponsorship_denials_%s", suffix)
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// SpendTableExists checks if a table exists in the database
+func (db *DB) SpendTableExists(suffix string) (bool, error) {
+	tableName := fmt.Sprintf("t_sponsor_spend_%s", suffix)
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&exists)
+	if err != nil {
+		// A database error occurred
+		return false, err
+	}
+	return exists, nil
+}
+
+// TableNameSuffix returns the name of the transfer db for the given contract
+func (d *DB) TableNameSuffix(contract string) (string, error) {
+	re := regexp.MustCompile("^0x[0-9a-fA-F]{40}$")
+
+	suffix := fmt.Sprintf("%v_%s", d.chainID, strings.ToLower(contract))
+
+	if !re.MatchString(contract) {
+		return suffix, errors.New("bad contract address")
+	}
+
+	return suffix, nil
+}
+
+// GetPushTokenDB returns true if the push token db for the given contract exists, returns the db if it exists
+func (d *DB) GetPushTokenDB(contract string) (*PushTokenDB, bool) {
+	name, err := d.TableNameSuffix(contract)
+	if err != nil {
+		return nil, false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ptdb, ok := d.PushTokenDB[name]
+	if !ok {
+		return nil, false
+	}
+	return ptdb, true
+}
+
+// PushTokenDBs returns the push token dbs of every contract
+func (d *DB) PushTokenDBs() []*PushTokenDB {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ptdbs := make([]*PushTokenDB, 0, len(d.PushTokenDB))
+	for _, ptdb := range d.PushTokenDB {
+		ptdbs = append(ptdbs, ptdb)
+	}
+
+	return ptdbs
 }
 
 // AddPushTokenDB adds a new push token db for the given contract
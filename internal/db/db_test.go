@@ -0,0 +1,955 @@
+package db
+
+import (
+	"encoding/hex"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jackc/pgx/v5"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	tdb := testdb.New(t)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := hex.EncodeToString(crypto.FromECDSA(key))
+
+	d, err := NewDB(big.NewInt(100), secret, tdb.User, tdb.Password, tdb.Name, tdb.Port, tdb.Host, tdb.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(d.Close)
+
+	return d
+}
+
+func TestEventDB(t *testing.T) {
+	d := newTestDB(t)
+
+	contract := "0x5815E61eF72c9E6107b5c5A05FD121F334f7a7f1"
+	topic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+	_, err := d.EventDB.GetEvent("100", contract, topic)
+	if err != pgx.ErrNoRows {
+		t.Fatalf("expected no rows, got %v", err)
+	}
+
+	err = d.EventDB.AddEvent("100", contract, topic, "demo", "", "Transfer", "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err := d.EventDB.EventExists("100", contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected event to exist")
+	}
+
+	sig := "Transfer(address indexed from, address indexed to, uint256 value)"
+	err = d.EventDB.SetEventSignature("100", contract, topic, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.EventDB.SetEventABI("100", contract, topic, `{"type":"event","name":"Transfer","inputs":[]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev, err := d.EventDB.GetEvent("100", contract, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ev.EventSignature != sig || ev.GroupID != "group" || !ev.HasABI() {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	evs, err := d.EventDB.GetEvents("100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(evs))
+	}
+
+	// other chains are not returned
+	evs, err = d.EventDB.GetEvents("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 0 {
+		t.Fatalf("expected 0 events, got %d", len(evs))
+	}
+}
+
+func TestSponsorDB(t *testing.T) {
+	d := newTestDB(t)
+
+	pk, _, err := relay.GenerateHexPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	sponsor := &relay.Sponsor{
+		Contract:   "0x5815E61eF72c9E6107b5c5A05FD121F334f7a7f1",
+		PrivateKey: pk,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	err = d.SponsorDB.AddSponsor(sponsor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.SponsorDB.GetSponsor(sponsor.Contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keys are stored encrypted and decrypted when read
+	if got.PrivateKey != pk {
+		t.Fatal("expected sponsor key to be decrypted")
+	}
+
+	// without a signer key the paymaster data is signed with the private key
+	if got.SigningKey() != pk {
+		t.Fatal("expected the private key to sign")
+	}
+
+	signer, _, err := relay.GenerateHexPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.SponsorDB.RotateSignerKey(sponsor.Contract, signer, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = d.SponsorDB.GetSponsor(sponsor.Contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.PrivateKey != pk || got.SigningKey() != signer {
+		t.Fatal("expected only the signer key to be rotated")
+	}
+
+	if got.SignerRotatedAt == nil || !got.SignerRotatedAt.After(got.KeyRotatedAt) {
+		t.Fatalf("expected separate rotation times, got %v and %v", got.KeyRotatedAt, got.SignerRotatedAt)
+	}
+}
+
+func TestPushPreferenceDB(t *testing.T) {
+	d := newTestDB(t)
+
+	pref, err := d.PushPreferenceDB.GetPreference("pubkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pref.Mode != relay.PushModeAll || pref.Locale != relay.PushLocaleDefault {
+		t.Fatalf("expected default mode all in the default locale, got %+v", pref)
+	}
+
+	err = d.PushPreferenceDB.SetPreference(&relay.PushPreference{Pubkey: "pubkey", Mode: relay.PushModeMentions, Locale: "fr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pref, err = d.PushPreferenceDB.GetPreference("pubkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pref.Mode != relay.PushModeMentions || pref.Locale != "fr" {
+		t.Fatalf("expected mode mentions in fr, got %+v", pref)
+	}
+
+	prefs, err := d.PushPreferenceDB.GetPreferences([]string{"pubkey", "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefs["pubkey"].Mode != relay.PushModeMentions || prefs["other"].Mode != relay.PushModeAll || prefs["other"].Locale != relay.PushLocaleDefault {
+		t.Fatalf("expected the preference of pubkey and the default for other, got %+v %+v", prefs["pubkey"], prefs["other"])
+	}
+
+	// without a preference the default applies again
+	err = d.PushPreferenceDB.RemovePreference("pubkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pref, err = d.PushPreferenceDB.GetPreference("pubkey")
+	if err != nil || pref.Mode != relay.PushModeAll {
+		t.Fatalf("expected default mode all, got %+v %v", pref, err)
+	}
+
+	for _, token := range []string{"first", "second"} {
+		err = d.NostrPushTokenDB.AddToken(&relay.PushToken{Token: token, Account: "pubkey"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	accountsTokens, err := d.NostrPushTokenDB.GetAccountsTokens([]string{"pubkey", "other"})
+	if err != nil || len(accountsTokens["pubkey"]) != 2 || len(accountsTokens["other"]) != 0 {
+		t.Fatalf("expected the two tokens of pubkey, got %v %v", accountsTokens, err)
+	}
+
+	err = d.NostrPushTokenDB.RemoveAccountTokens("pubkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := d.NostrPushTokenDB.GetAccountTokens("pubkey")
+	if err != nil || len(tokens) != 0 {
+		t.Fatalf("expected no tokens, got %v %v", tokens, err)
+	}
+}
+
+func TestFactoryDB(t *testing.T) {
+	d := newTestDB(t)
+
+	contract := "0x7cC54D54bBFc65d1f0af7ACee5e4042654AF8185"
+
+	_, err := d.FactoryDB.GetFactory(contract)
+	if err != pgx.ErrNoRows {
+		t.Fatalf("expected no rows, got %v", err)
+	}
+
+	err = d.FactoryDB.SetFactory(&relay.AccountFactory{
+		Contract:   contract,
+		Paymaster:  "0x5FbDB2315678afecb367f032d93F642f64180aa3",
+		EntryPoint: "0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// registering again updates the paymaster
+	err = d.FactoryDB.SetFactory(&relay.AccountFactory{
+		Contract:   contract,
+		Paymaster:  "0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512",
+		EntryPoint: "0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := d.FactoryDB.GetFactory(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Paymaster != "0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512" {
+		t.Fatalf("expected updated paymaster, got %s", f.Paymaster)
+	}
+
+	factories, err := d.FactoryDB.GetFactories()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(factories) != 1 || factories[0].Contract != contract {
+		t.Fatalf("expected 1 factory, got %+v", factories)
+	}
+
+	err = d.FactoryDB.RemoveFactory(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err := d.FactoryDB.FactoryExists(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists {
+		t.Fatal("expected factory to be removed")
+	}
+}
+
+func TestSponsorshipDB(t *testing.T) {
+	d := newTestDB(t)
+
+	pm := "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+	sender := "0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512"
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := d.SponsorshipDB.Reserve(pm, sender, 1, 100, start.Add(time.Duration(i)*time.Hour), 24*time.Hour, 2, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			t.Fatalf("expected reservation %d to be allowed", i)
+		}
+	}
+
+	ok, usage, err := d.SponsorshipDB.Reserve(pm, sender, 1, 100, start.Add(2*time.Hour), 24*time.Hour, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok {
+		t.Fatal("expected the op limit to be enforced")
+	}
+
+	if usage.Ops != 2 || usage.Gas != 200 || usage.Oldest == nil || !usage.Oldest.Equal(start) {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	// other accounts are not affected
+	ok, _, err = d.SponsorshipDB.Reserve(pm, pm, 1, 100, start.Add(2*time.Hour), 24*time.Hour, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Fatal("expected another account to be sponsored")
+	}
+
+	// the oldest sponsorship leaves the window
+	ok, _, err = d.SponsorshipDB.Reserve(pm, sender, 1, 100, start.Add(24*time.Hour+time.Minute), 24*time.Hour, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Fatal("expected the window to slide")
+	}
+
+	// gas is limited as well
+	ok, _, err = d.SponsorshipDB.Reserve(pm, pm, 1, 1000, start.Add(3*time.Hour), 24*time.Hour, 0, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok {
+		t.Fatal("expected the gas limit to be enforced")
+	}
+}
+
+func TestGroupTokenDB(t *testing.T) {
+	d := newTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	tok := &relay.GroupToken{
+		ID:        "request-event-id",
+		GroupID:   "group",
+		Scope:     relay.GroupTokenScopePost,
+		Pubkey:    "bot",
+		Name:      "welcome bot",
+		CreatedBy: "admin",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+
+	ok, err := d.GroupTokenDB.AddToken(tok, "hash")
+	if err != nil || !ok {
+		t.Fatalf("expected the token to be added, got %v %v", ok, err)
+	}
+
+	// a replayed mint request doesn't create a second token
+	ok, err = d.GroupTokenDB.AddToken(tok, "other-hash")
+	if err != nil || ok {
+		t.Fatalf("expected the duplicate to be ignored, got %v %v", ok, err)
+	}
+
+	got, err := d.GroupTokenDB.GetTokenBySecretHash("hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ID != tok.ID || got.Scope != relay.GroupTokenScopePost || !got.Active(now) {
+		t.Fatalf("unexpected token %+v", got)
+	}
+
+	active, err := d.GroupTokenDB.HasActiveToken("bot", "group", relay.GroupTokenScopePost, now)
+	if err != nil || !active {
+		t.Fatalf("expected an active token, got %v %v", active, err)
+	}
+
+	active, err = d.GroupTokenDB.HasActiveToken("bot", "other-group", relay.GroupTokenScopePost, now)
+	if err != nil || active {
+		t.Fatalf("expected no token for another group, got %v %v", active, err)
+	}
+
+	active, err = d.GroupTokenDB.HasActiveToken("bot", "group", relay.GroupTokenScopePost, now.Add(2*time.Hour))
+	if err != nil || active {
+		t.Fatalf("expected the token to expire, got %v %v", active, err)
+	}
+
+	ok, err = d.GroupTokenDB.RevokeToken("group", tok.ID, now)
+	if err != nil || !ok {
+		t.Fatalf("expected the token to be revoked, got %v %v", ok, err)
+	}
+
+	active, err = d.GroupTokenDB.HasActiveToken("bot", "group", relay.GroupTokenScopePost, now)
+	if err != nil || active {
+		t.Fatalf("expected a revoked token to be inactive, got %v %v", active, err)
+	}
+
+	bot, err := d.GroupTokenDB.IsBot("bot")
+	if err != nil || !bot {
+		t.Fatalf("expected the pubkey to remain a bot, got %v %v", bot, err)
+	}
+
+	tokens, err := d.GroupTokenDB.GetTokens("group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].RevokedAt == nil {
+		t.Fatalf("expected one revoked token, got %+v", tokens)
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	l := NewLatency()
+	if l.Percentile(0.95) != 0 {
+		t.Fatal("expected no latency before any query")
+	}
+
+	for i := 1; i <= 100; i++ {
+		l.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	if got := l.Percentile(0.95); got != 95*time.Millisecond {
+		t.Fatalf("expected p95 of 95ms, got %s", got)
+	}
+
+	// older samples are overwritten once the buffer is full
+	for i := 0; i < latencySamples; i++ {
+		l.Observe(time.Second)
+	}
+
+	if got := l.Percentile(0.5); got != time.Second {
+		t.Fatalf("expected only recent samples, got %s", got)
+	}
+}
+
+func TestEmailSenderDB(t *testing.T) {
+	d := newTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	s := &relay.EmailSender{GroupID: "group", Email: "member@example.com", Pubkey: "member", CreatedBy: "admin", CreatedAt: now}
+
+	err := d.EmailSenderDB.AddSender(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// adding the address again maps it to another member
+	s.Pubkey = "other-member"
+	err = d.EmailSenderDB.AddSender(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.EmailSenderDB.GetSender("group", "member@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Pubkey != "other-member" {
+		t.Fatalf("unexpected sender %+v", got)
+	}
+
+	got, err = d.EmailSenderDB.GetSender("other-group", "member@example.com")
+	if err != nil || got != nil {
+		t.Fatalf("expected no sender for another group, got %+v %v", got, err)
+	}
+
+	senders, err := d.EmailSenderDB.GetSenders("group")
+	if err != nil || len(senders) != 1 {
+		t.Fatalf("expected 1 sender, got %v %v", senders, err)
+	}
+
+	ok, err := d.EmailSenderDB.RemoveSender("group", "member@example.com")
+	if err != nil || !ok {
+		t.Fatalf("expected the sender to be removed, got %v %v", ok, err)
+	}
+
+	ok, err = d.EmailSenderDB.RemoveSender("group", "member@example.com")
+	if err != nil || ok {
+		t.Fatalf("expected nothing to remove, got %v %v", ok, err)
+	}
+
+	for _, groupID := range []string{"group", "other-group"} {
+		err = d.EmailSenderDB.AddSender(&relay.EmailSender{GroupID: groupID, Email: "member@example.com", Pubkey: "member", CreatedBy: "admin", CreatedAt: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	senders, err = d.EmailSenderDB.GetSendersByPubkey("member")
+	if err != nil || len(senders) != 2 {
+		t.Fatalf("expected the senders of both groups, got %v %v", senders, err)
+	}
+
+	err = d.EmailSenderDB.RemoveSendersByPubkey("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	senders, err = d.EmailSenderDB.GetSendersByPubkey("member")
+	if err != nil || len(senders) != 0 {
+		t.Fatalf("expected no senders, got %v %v", senders, err)
+	}
+}
+
+func TestPollVoteDB(t *testing.T) {
+	d := newTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, v := range []*relay.PollVote{
+		{PollID: "poll", Pubkey: "alice", Account: "0xa", Options: []string{"yes"}, EventID: "1", CreatedAt: now},
+		{PollID: "poll", Pubkey: "bob", Options: []string{"yes", "no"}, EventID: "2", CreatedAt: now},
+		{PollID: "other", Pubkey: "alice", Options: []string{"no"}, EventID: "3", CreatedAt: now},
+	} {
+		ok, err := d.PollVoteDB.AddVote(v)
+		if err != nil || !ok {
+			t.Fatalf("expected the vote to be counted, got %v %v", ok, err)
+		}
+	}
+
+	// a member votes once, an account once whoever uses it
+	for _, v := range []*relay.PollVote{
+		{PollID: "poll", Pubkey: "alice", Options: []string{"no"}, EventID: "4", CreatedAt: now},
+		{PollID: "poll", Pubkey: "carol", Account: "0xa", Options: []string{"no"}, EventID: "5", CreatedAt: now},
+	} {
+		ok, err := d.PollVoteDB.AddVote(v)
+		if err != nil || ok {
+			t.Fatalf("expected the vote of %s to be ignored, got %v %v", v.Pubkey, ok, err)
+		}
+	}
+
+	voted, err := d.PollVoteDB.HasVoted("poll", "carol", "0xa")
+	if err != nil || !voted {
+		t.Fatalf("expected the account to have voted, got %v %v", voted, err)
+	}
+
+	voted, err = d.PollVoteDB.HasVoted("poll", "carol", "")
+	if err != nil || voted {
+		t.Fatalf("expected carol not to have voted, got %v %v", voted, err)
+	}
+
+	tally, voters, err := d.PollVoteDB.GetTally("poll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voters != 2 || tally["yes"] != 2 || tally["no"] != 1 {
+		t.Fatalf("unexpected tally %v with %d voters", tally, voters)
+	}
+
+	votes, err := d.PollVoteDB.GetVotesByPubkey("alice")
+	if err != nil || len(votes) != 2 {
+		t.Fatalf("expected the votes of alice on both polls, got %v %v", votes, err)
+	}
+}
+
+func TestTokenGateDB(t *testing.T) {
+	d := newTestDB(t)
+
+	first := time.Now().UTC().Truncate(time.Second)
+
+	since, err := d.TokenGateDB.MarkLapsed("group", "member", first)
+	if err != nil || !since.Equal(first) {
+		t.Fatalf("expected the lapse to start at %s, got %s %v", first, since, err)
+	}
+
+	// the start of the lapse is kept while the member stays below the threshold
+	since, err = d.TokenGateDB.MarkLapsed("group", "member", first.Add(time.Hour))
+	if err != nil || !since.Equal(first) {
+		t.Fatalf("expected the lapse to start at %s, got %s %v", first, since, err)
+	}
+
+	err = d.TokenGateDB.ClearLapse("group", "member")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	since, err = d.TokenGateDB.MarkLapsed("group", "member", first.Add(time.Hour))
+	if err != nil || !since.Equal(first.Add(time.Hour)) {
+		t.Fatalf("expected a new lapse, got %s %v", since, err)
+	}
+}
+
+func TestAccountLinkDB(t *testing.T) {
+	d := newTestDB(t)
+
+	l, err := d.AccountLinkDB.GetLink("pubkey")
+	if err != nil || l != nil {
+		t.Fatalf("expected no link, got %+v %v", l, err)
+	}
+
+	for _, account := range []string{"0xfirst", "0xsecond"} {
+		err = d.AccountLinkDB.SetLink(&relay.AccountLink{Pubkey: "pubkey", Account: account, Owner: "0xowner", Signature: "0xsig", CreatedAt: time.Now().UTC()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// linking again replaces the account
+	l, err = d.AccountLinkDB.GetLink("pubkey")
+	if err != nil || l == nil || l.Account != "0xsecond" {
+		t.Fatalf("expected the second account, got %+v %v", l, err)
+	}
+
+	err = d.AccountLinkDB.RemoveLink("pubkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = d.AccountLinkDB.GetLink("pubkey")
+	if err != nil || l != nil {
+		t.Fatalf("expected the link to be removed, got %+v %v", l, err)
+	}
+}
+
+func TestErasureDB(t *testing.T) {
+	d := newTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for i, r := range []*relay.ErasureRequest{
+		{Pubkey: "alice", Status: relay.ErasureStatusBlocked, Reason: "only admin of demo", Groups: []string{}, RequestedAt: now},
+		{Pubkey: "alice", Status: relay.ErasureStatusCompleted, Events: 3, Groups: []string{"demo"}, RequestedAt: now.Add(time.Minute)},
+	} {
+		err := d.ErasureDB.AddRequest(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.ID == 0 {
+			t.Fatalf("expected request %d to have an id", i)
+		}
+	}
+
+	requests, err := d.ErasureDB.GetRequests(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 || requests[0].Status != relay.ErasureStatusCompleted || len(requests[0].Groups) != 1 || requests[1].Reason != "only admin of demo" {
+		t.Fatalf("unexpected requests %+v", requests)
+	}
+}
+
+func TestPurgeDB(t *testing.T) {
+	d := newTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	p := &relay.Purge{Pubkey: "alice", Status: relay.PurgeStatusPending, Reason: "leaving", RequestedAt: now}
+
+	err := d.PurgeDB.AddPurge(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := d.PurgeDB.GetPendingPurge("alice")
+	if err != nil || pending == nil || pending.ID != p.ID {
+		t.Fatalf("expected the pending purge, got %+v %v", pending, err)
+	}
+
+	for _, action := range []string{"requested", "approved"} {
+		err = d.PurgeDB.AddAuditEntry(p.ID, &relay.PurgeAuditEntry{Action: action, CreatedAt: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	claimed, err := d.PurgeDB.ClaimStatus(p.ID, relay.PurgeStatusPending, relay.PurgeStatusRunning, now)
+	if err != nil || !claimed {
+		t.Fatalf("expected the pending purge to be claimed, got %v %v", claimed, err)
+	}
+
+	claimed, err = d.PurgeDB.ClaimStatus(p.ID, relay.PurgeStatusPending, relay.PurgeStatusRunning, now)
+	if err != nil || claimed {
+		t.Fatalf("expected a running purge not to be claimed again, got %v %v", claimed, err)
+	}
+
+	err = d.PurgeDB.SetStatus(p.ID, relay.PurgeStatusCompleted, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.PurgeDB.GetPurge(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != relay.PurgeStatusCompleted || len(got.Audit) != 2 || got.Audit[0].Action != "requested" {
+		t.Fatalf("unexpected purge %+v", got)
+	}
+
+	pending, err = d.PurgeDB.GetPendingPurge("alice")
+	if err != nil || pending != nil {
+		t.Fatalf("expected no pending purge, got %+v %v", pending, err)
+	}
+
+	purges, err := d.PurgeDB.GetPurges(relay.PurgeStatusPending, 10)
+	if err != nil || len(purges) != 0 {
+		t.Fatalf("expected no pending purges, got %v %v", purges, err)
+	}
+
+	purges, err = d.PurgeDB.GetPurges("", 10)
+	if err != nil || len(purges) != 1 {
+		t.Fatalf("expected a purge, got %v %v", purges, err)
+	}
+
+	got, err = d.PurgeDB.GetPurge(p.ID + 1)
+	if err != nil || got != nil {
+		t.Fatalf("expected no purge, got %+v %v", got, err)
+	}
+}
+
+func TestUploadDB(t *testing.T) {
+	d := newTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for i, u := range []*relay.Upload{
+		{SHA256: "a", Pubkey: "alice", GroupID: "demo", Size: 10, Mime: "image/png", IPHash: "ip1", CreatedAt: now.Add(-2 * time.Hour)},
+		{SHA256: "b", Pubkey: "alice", GroupID: "demo", Size: 20, Mime: "image/png", IPHash: "ip1", CreatedAt: now},
+		{SHA256: "c", Pubkey: "bob", GroupID: "other", Size: 30, Mime: "video/mp4", IPHash: "ip2", CreatedAt: now},
+	} {
+		err := d.UploadDB.AddUpload(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.ID == 0 {
+			t.Fatalf("expected upload %d to get an id", i)
+		}
+	}
+
+	uploads, err := d.UploadDB.GetUploads("alice", "", "", 10)
+	if err != nil || len(uploads) != 2 || uploads[0].SHA256 != "b" {
+		t.Fatalf("unexpected uploads of alice %v %v", uploads, err)
+	}
+
+	uploads, err = d.UploadDB.GetUploads("", "other", "ip2", 10)
+	if err != nil || len(uploads) != 1 || uploads[0].Pubkey != "bob" {
+		t.Fatalf("unexpected uploads of other %v %v", uploads, err)
+	}
+
+	count, bytes, err := d.UploadDB.GetVolume("alice", now.Add(-time.Hour))
+	if err != nil || count != 1 || bytes != 20 {
+		t.Fatalf("unexpected volume %d %d %v", count, bytes, err)
+	}
+
+	added, err := d.UploadDB.AddFlag(&relay.UploadFlag{Pubkey: "alice", Uploads: 1, Bytes: 20, Reason: "volume", FlaggedAt: now})
+	if err != nil || !added {
+		t.Fatalf("expected alice to be flagged, got %v %v", added, err)
+	}
+
+	added, err = d.UploadDB.AddFlag(&relay.UploadFlag{Pubkey: "alice", Uploads: 2, Bytes: 30, Reason: "volume", FlaggedAt: now})
+	if err != nil || added {
+		t.Fatalf("expected alice to keep the first flag, got %v %v", added, err)
+	}
+
+	flags, err := d.UploadDB.GetFlags(10)
+	if err != nil || len(flags) != 1 || flags[0].Uploads != 1 {
+		t.Fatalf("unexpected flags %v %v", flags, err)
+	}
+
+	removed, err := d.UploadDB.RemoveFlag("alice")
+	if err != nil || !removed {
+		t.Fatalf("expected the flag to be removed, got %v %v", removed, err)
+	}
+
+	f, err := d.UploadDB.GetFlag("alice")
+	if err != nil || f != nil {
+		t.Fatalf("expected no flag, got %+v %v", f, err)
+	}
+}
+
+func TestBlobRefDB(t *testing.T) {
+	d := newTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	since, err := d.BlobRefDB.TrackingSince()
+	if err != nil || since.IsZero() {
+		t.Fatalf("expected references to be tracked, got %v %v", since, err)
+	}
+
+	err = d.BlobRefDB.AddRefs("ev1", "demo", []string{"a", "b"}, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.BlobRefDB.AddRefs("ev2", "", []string{"b"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a group created again after its deletion keeps its new references
+	err = d.BlobRefDB.AddRefs("ev3", "demo", []string{"c"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unreferenced, err := d.BlobRefDB.GetUnreferenced([]string{"a", "b", "c", "d"})
+	if err != nil || !slices.Equal(unreferenced, []string{"d"}) {
+		t.Fatalf("unexpected unreferenced blobs %v %v", unreferenced, err)
+	}
+
+	removed, err := d.BlobRefDB.RemoveGroupRefs("demo", now.Add(-time.Minute))
+	if err != nil || removed != 2 {
+		t.Fatalf("expected the references of the deleted group to be removed, got %d %v", removed, err)
+	}
+
+	removed, err = d.BlobRefDB.RemoveEventRefs([]string{"ev2"})
+	if err != nil || removed != 1 {
+		t.Fatalf("expected the references of the deleted event to be removed, got %d %v", removed, err)
+	}
+
+	unreferenced, err = d.BlobRefDB.GetUnreferenced([]string{"a", "b", "c", "d"})
+	if err != nil || !slices.Equal(unreferenced, []string{"a", "b", "d"}) {
+		t.Fatalf("unexpected unreferenced blobs %v %v", unreferenced, err)
+	}
+}
+
+func TestGroupStateDB(t *testing.T) {
+	d := newTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	err := d.GroupStateDB.ApplyGroupChange(&relay.GroupChange{
+		GroupID:  "demo",
+		Created:  true,
+		Metadata: &relay.Group{Name: "Demo", CreatedBy: "alice"},
+		Put:      []*relay.GroupMember{{Pubkey: "alice", Role: "admin"}},
+		At:       now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.GroupStateDB.ApplyGroupChange(&relay.GroupChange{
+		GroupID: "demo",
+		Put:     []*relay.GroupMember{{Pubkey: "alice", Role: "member"}, {Pubkey: "bob", Role: "member"}},
+		At:      now.Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// putting an admin back as a member keeps them admin
+	m, err := d.GroupStateDB.GetGroupMember("demo", "alice")
+	if err != nil || m == nil || m.Role != "admin" {
+		t.Fatalf("expected alice to stay admin, got %+v %v", m, err)
+	}
+
+	err = d.GroupStateDB.ApplyGroupChange(&relay.GroupChange{GroupID: "demo", Removed: []string{"bob"}, At: now.Add(2 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an older put doesn't add a removed member back
+	err = d.GroupStateDB.ApplyGroupChange(&relay.GroupChange{GroupID: "demo", Put: []*relay.GroupMember{{Pubkey: "bob", Role: "member"}}, At: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = d.GroupStateDB.GetGroupMember("demo", "bob")
+	if err != nil || m != nil {
+		t.Fatalf("expected bob to be removed, got %+v %v", m, err)
+	}
+
+	err = d.GroupStateDB.RebuildGroupState([]*relay.GroupChange{
+		{GroupID: "other", Created: true, Metadata: &relay.Group{CreatedBy: "carol"}, Put: []*relay.GroupMember{{Pubkey: "carol", Role: "admin"}}, At: now},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := d.GroupStateDB.GetGroup("demo")
+	if err != nil || g != nil {
+		t.Fatalf("expected the rebuild to replace the state, got %+v %v", g, err)
+	}
+
+	exists, err := d.GroupStateDB.HasGroups()
+	if err != nil || !exists {
+		t.Fatalf("expected the rebuilt group, got %v %v", exists, err)
+	}
+}
+
+func TestOutboxDB(t *testing.T) {
+	d := newTestDB(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for i, id := range []string{"first", "second"} {
+		err := d.OutboxDB.AddOutboxEvent(&relay.OutboxEvent{
+			Event:         &nostr.Event{ID: id, Kind: 39002},
+			Attempts:      1,
+			LastError:     "database is down",
+			NextAttemptAt: now,
+			CreatedAt:     now.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// queueing an event again keeps the first one
+	err := d.OutboxDB.AddOutboxEvent(&relay.OutboxEvent{Event: &nostr.Event{ID: "first"}, Attempts: 5, NextAttemptAt: now, CreatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := d.OutboxDB.GetDueOutboxEvents(now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(due) != 2 || due[0].Event.ID != "first" || due[0].Attempts != 1 || due[1].Event.ID != "second" {
+		t.Fatalf("expected both events oldest first, got %+v", due)
+	}
+
+	due[0].Attempts = 2
+	due[0].NextAttemptAt = now.Add(time.Minute)
+	err = d.OutboxDB.UpdateOutboxAttempt(due[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.OutboxDB.RemoveOutboxEvent("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, err = d.OutboxDB.GetDueOutboxEvents(now, 10)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("expected nothing due, got %d %v", len(due), err)
+	}
+
+	count, err := d.OutboxDB.CountOutboxEvents()
+	if err != nil || count != 1 {
+		t.Fatalf("expected a single event, got %d %v", count, err)
+	}
+}
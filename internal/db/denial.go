@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SponsorshipDenialDB struct {
+	ctx    context.Context
+	suffix string
+	db     *pgxpool.Pool
+	rdb    *pgxpool.Pool
+}
+
+// NewSponsorshipDenialDB creates a new DB
+func NewSponsorshipDenialDB(ctx context.Context, db, rdb *pgxpool.Pool, name string) (*SponsorshipDenialDB, error) {
+	return &SponsorshipDenialDB{
+		ctx:    ctx,
+		suffix: name,
+		db:     db,
+		rdb:    rdb,
+	}, nil
+}
+
+// CreateSponsorshipDenialsTable creates a table to store the user ops that paymasters refused to sponsor
+func (db *SponsorshipDenialDB) CreateSponsorshipDenialsTable() error {
+	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS t_sponsorship_denials_%s(
+		id bigserial PRIMARY KEY,
+		paymaster text NOT NULL,
+		sender text NOT NULL,
+		selector text NOT NULL,
+		method text NOT NULL,
+		reason text NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`, db.suffix))
+
+	return err
+}
+
+// CreateSponsorshipDenialsTableIndexes creates the indexes for the sponsorship denials table
+func (db *SponsorshipDenialDB) CreateSponsorshipDenialsTableIndexes() error {
+	suffix := common.ShortenName(db.suffix, 6)
+
+	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	CREATE INDEX IF NOT EXISTS idx_sponsorship_denials_%s_paymaster_sender_created_at ON t_sponsorship_denials_%s (paymaster, sender, created_at);
+	CREATE INDEX IF NOT EXISTS idx_sponsorship_denials_%s_sender_created_at ON t_sponsorship_denials_%s (sender, created_at);
+	`, suffix, db.suffix, suffix, db.suffix))
+
+	return err
+}
+
+// AddDenial records a user op that a paymaster refused to sponsor
+func (db *SponsorshipDenialDB) AddDenial(d *relay.SponsorshipDenial) error {
+	return db.db.QueryRow(db.ctx, fmt.Sprintf(`
+	INSERT INTO t_sponsorship_denials_%s (paymaster, sender, selector, method, reason, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+	`, db.suffix), d.Paymaster, d.Sender, d.Selector, d.Method, d.Reason, d.CreatedAt).Scan(&d.ID)
+}
+
+// GetDenials returns the latest denials, optionally filtered by paymaster and sender
+func (db *SponsorshipDenialDB) GetDenials(paymaster, sender string, limit int) ([]*relay.SponsorshipDenial, error) {
+	rows, err := db.rdb.Query(db.ctx, fmt.Sprintf(`
+	SELECT id, paymaster, sender, selector, method, reason, created_at
+	FROM t_sponsorship_denials_%s
+	WHERE ($1 = '' OR paymaster = $1)
+	AND ($2 = '' OR sender = $2)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $3
+	`, db.suffix), paymaster, sender, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	denials := []*relay.SponsorshipDenial{}
+	for rows.Next() {
+		var d relay.SponsorshipDenial
+		err := rows.Scan(&d.ID, &d.Paymaster, &d.Sender, &d.Selector, &d.Method, &d.Reason, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		denials = append(denials, &d)
+	}
+
+	return denials, rows.Err()
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type EmailSenderDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewEmailSenderDB creates a new DB
+func NewEmailSenderDB(ctx context.Context, db, rdb *pgxpool.Pool) (*EmailSenderDB, error) {
+	return &EmailSenderDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateEmailSendersTable creates a table to store the email addresses allowed to post into a group
+func (db *EmailSenderDB) CreateEmailSendersTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_email_senders(
+		group_id text NOT NULL,
+		email text NOT NULL,
+		pubkey text NOT NULL,
+		created_by text NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp,
+		PRIMARY KEY (group_id, email)
+	);
+	`)
+
+	return err
+}
+
+// CreateEmailSendersTableIndexes creates the indexes for the email senders table
+func (db *EmailSenderDB) CreateEmailSendersTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_email_senders_pubkey ON t_email_senders (pubkey);
+	`)
+
+	return err
+}
+
+const emailSenderColumns = `group_id, email, pubkey, created_by, created_at`
+
+func scanEmailSender(row pgx.Row) (*relay.EmailSender, error) {
+	var s relay.EmailSender
+	err := row.Scan(&s.GroupID, &s.Email, &s.Pubkey, &s.CreatedBy, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// AddSender allows an email address to post into a group for a member, adding it again changes the member
+func (db *EmailSenderDB) AddSender(s *relay.EmailSender) error {
+	_, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_email_senders (group_id, email, pubkey, created_by, created_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (group_id, email) DO UPDATE SET
+		pubkey = EXCLUDED.pubkey,
+		created_by = EXCLUDED.created_by,
+		created_at = EXCLUDED.created_at
+	`, s.GroupID, s.Email, s.Pubkey, s.CreatedBy, s.CreatedAt)
+
+	return err
+}
+
+// GetSender returns the sender of a group with the given email address, nil if it is not allowed
+func (db *EmailSenderDB) GetSender(groupID, email string) (*relay.EmailSender, error) {
+	s, err := scanEmailSender(db.rdb.QueryRow(db.ctx, `
+	SELECT `+emailSenderColumns+`
+	FROM t_email_senders
+	WHERE group_id = $1 AND email = $2
+	`, groupID, email))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	return s, err
+}
+
+// GetSenders returns the senders of a group ordered by email
+func (db *EmailSenderDB) GetSenders(groupID string) ([]*relay.EmailSender, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT `+emailSenderColumns+`
+	FROM t_email_senders
+	WHERE group_id = $1
+	ORDER BY email
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	senders := []*relay.EmailSender{}
+	for rows.Next() {
+		s, err := scanEmailSender(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		senders = append(senders, s)
+	}
+
+	return senders, rows.Err()
+}
+
+// RemoveSender removes an email address from a group, false is returned if it wasn't allowed
+func (db *EmailSenderDB) RemoveSender(groupID, email string) (bool, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_email_senders
+	WHERE group_id = $1 AND email = $2
+	`, groupID, email)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// GetSendersByPubkey returns the email addresses that post for a member in any group
+func (db *EmailSenderDB) GetSendersByPubkey(pubkey string) ([]*relay.EmailSender, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT `+emailSenderColumns+`
+	FROM t_email_senders
+	WHERE pubkey = $1
+	ORDER BY group_id, email
+	`, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	senders := []*relay.EmailSender{}
+	for rows.Next() {
+		s, err := scanEmailSender(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		senders = append(senders, s)
+	}
+
+	return senders, rows.Err()
+}
+
+// RemoveSendersByPubkey removes the email addresses that post for a member in every group
+func (db *EmailSenderDB) RemoveSendersByPubkey(pubkey string) error {
+	_, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_email_senders
+	WHERE pubkey = $1
+	`, pubkey)
+
+	return err
+}
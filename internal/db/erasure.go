@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ErasureDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewErasureDB creates a new DB
+func NewErasureDB(ctx context.Context, db, rdb *pgxpool.Pool) (*ErasureDB, error) {
+	return &ErasureDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateErasureRequestsTable creates a table to record the erasure requests of pubkeys
+func (db *ErasureDB) CreateErasureRequestsTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_erasure_requests(
+		id bigserial PRIMARY KEY,
+		pubkey text NOT NULL,
+		status text NOT NULL,
+		reason text NOT NULL DEFAULT '',
+		events integer NOT NULL DEFAULT 0,
+		groups text[] NOT NULL DEFAULT '{}',
+		requested_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`)
+
+	return err
+}
+
+// CreateErasureRequestsTableIndexes creates the indexes for the erasure requests table
+func (db *ErasureDB) CreateErasureRequestsTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_erasure_requests_requested_at ON t_erasure_requests (requested_at);
+	`)
+
+	return err
+}
+
+// AddRequest records an erasure request and sets its id
+func (db *ErasureDB) AddRequest(r *relay.ErasureRequest) error {
+	return db.db.QueryRow(db.ctx, `
+	INSERT INTO t_erasure_requests (pubkey, status, reason, events, groups, requested_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+	`, r.Pubkey, r.Status, r.Reason, r.Events, r.Groups, r.RequestedAt).Scan(&r.ID)
+}
+
+// GetRequests returns the latest erasure requests, newest first
+func (db *ErasureDB) GetRequests(limit int) ([]*relay.ErasureRequest, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT id, pubkey, status, reason, events, groups, requested_at
+	FROM t_erasure_requests
+	ORDER BY requested_at DESC, id DESC
+	LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []*relay.ErasureRequest{}
+	for rows.Next() {
+		var r relay.ErasureRequest
+		err := rows.Scan(&r.ID, &r.Pubkey, &r.Status, &r.Reason, &r.Events, &r.Groups, &r.RequestedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, &r)
+	}
+
+	return requests, rows.Err()
+}
@@ -35,6 +35,8 @@ func (db *EventDB) CreateEventsTable() error {
 		alias text NOT NULL,
 		event_signature text NOT NULL,
 		name text NOT NULL,
+		group_id text NOT NULL DEFAULT '',
+		abi text NOT NULL DEFAULT '',
 		created_at timestamp NOT NULL DEFAULT current_timestamp,
 		updated_at timestamp NOT NULL DEFAULT current_timestamp,
 		PRIMARY KEY (chain_id, contract, topic)
@@ -44,6 +46,16 @@ func (db *EventDB) CreateEventsTable() error {
 	return err
 }
 
+// MigrateEventsTable adds columns introduced after the events table was first created
+func (db *EventDB) MigrateEventsTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	ALTER TABLE t_events ADD COLUMN IF NOT EXISTS group_id text NOT NULL DEFAULT '';
+	ALTER TABLE t_events ADD COLUMN IF NOT EXISTS abi text NOT NULL DEFAULT '';
+	`)
+
+	return err
+}
+
 // createEventsTableIndexes creates the indexes for events in the given db
 func (db *EventDB) CreateEventsTableIndexes() error {
 	_, err := db.db.Exec(db.ctx, `
@@ -79,10 +91,10 @@ func (db *EventDB) EventExists(chainID string, contract string) (bool, error) {
 func (db *EventDB) GetEvent(chainID string, contract string, topic string) (*relay.Event, error) {
 	var event relay.Event
 	err := db.rdb.QueryRow(db.ctx, `
-	SELECT chain_id, contract, topic, alias, event_signature, name, created_at, updated_at
+	SELECT chain_id, contract, topic, alias, event_signature, name, group_id, abi, created_at, updated_at
 	FROM t_events
 	WHERE chain_id = $1 AND contract = $2 AND topic = $3
-	`, chainID, contract, topic).Scan(&event.ChainID, &event.Contract, &event.Topic, &event.Alias, &event.EventSignature, &event.Name, &event.CreatedAt, &event.UpdatedAt)
+	`, chainID, contract, topic).Scan(&event.ChainID, &event.Contract, &event.Topic, &event.Alias, &event.EventSignature, &event.Name, &event.GroupID, &event.ABI, &event.CreatedAt, &event.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -93,7 +105,7 @@ func (db *EventDB) GetEvent(chainID string, contract string, topic string) (*rel
 // GetEvents gets all events from the db
 func (db *EventDB) GetEvents(chainID string) ([]*relay.Event, error) {
 	rows, err := db.rdb.Query(db.ctx, `
-    SELECT chain_id, contract, topic, alias, event_signature, name, created_at, updated_at
+    SELECT chain_id, contract, topic, alias, event_signature, name, group_id, abi, created_at, updated_at
     FROM t_events
 	WHERE chain_id = $1
     ORDER BY created_at ASC
@@ -106,7 +118,7 @@ func (db *EventDB) GetEvents(chainID string) ([]*relay.Event, error) {
 	events := []*relay.Event{}
 	for rows.Next() {
 		var event relay.Event
-		err = rows.Scan(&event.ChainID, &event.Contract, &event.Topic, &event.Alias, &event.EventSignature, &event.Name, &event.CreatedAt, &event.UpdatedAt)
+		err = rows.Scan(&event.ChainID, &event.Contract, &event.Topic, &event.Alias, &event.EventSignature, &event.Name, &event.GroupID, &event.ABI, &event.CreatedAt, &event.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -120,7 +132,7 @@ func (db *EventDB) GetEvents(chainID string) ([]*relay.Event, error) {
 // GetOutdatedEvents gets all queued events from the db sorted by created_at
 func (db *EventDB) GetOutdatedEvents(chainID string, currentBlk int64) ([]*relay.Event, error) {
 	rows, err := db.rdb.Query(db.ctx, `
-    SELECT chain_id, contract, topic, alias, event_signature, name, created_at, updated_at
+    SELECT chain_id, contract, topic, alias, event_signature, name, group_id, abi, created_at, updated_at
     FROM t_events
     WHERE chain_id = $1 AND last_block < $2
     ORDER BY created_at ASC
@@ -133,7 +145,7 @@ func (db *EventDB) GetOutdatedEvents(chainID string, currentBlk int64) ([]*relay
 	events := []*relay.Event{}
 	for rows.Next() {
 		var event relay.Event
-		err = rows.Scan(&event.ChainID, &event.Contract, &event.Topic, &event.Alias, &event.EventSignature, &event.Name, &event.CreatedAt, &event.UpdatedAt)
+		err = rows.Scan(&event.ChainID, &event.Contract, &event.Topic, &event.Alias, &event.EventSignature, &event.Name, &event.GroupID, &event.ABI, &event.CreatedAt, &event.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -155,18 +167,41 @@ func (db *EventDB) SetEventLastBlock(chainID string, contract string, topic stri
 	return err
 }
 
-// AddEvent adds an event to the db
-func (db *EventDB) AddEvent(chainID string, contract string, topic string, alias string, signature string, name string) error {
+// SetEventSignature sets the human readable signature of an event
+func (db *EventDB) SetEventSignature(chainID string, contract string, topic string, signature string) error {
+	_, err := db.db.Exec(db.ctx, `
+    UPDATE t_events
+    SET event_signature = $1, updated_at = $2
+    WHERE chain_id = $3 AND contract = $4 AND topic = $5
+    `, signature, time.Now().UTC(), chainID, contract, topic)
+
+	return err
+}
+
+// SetEventABI sets the ABI fragment used to decode the logs of an event
+func (db *EventDB) SetEventABI(chainID string, contract string, topic string, abi string) error {
+	_, err := db.db.Exec(db.ctx, `
+    UPDATE t_events
+    SET abi = $1, updated_at = $2
+    WHERE chain_id = $3 AND contract = $4 AND topic = $5
+    `, abi, time.Now().UTC(), chainID, contract, topic)
+
+	return err
+}
+
+// AddEvent adds an event to the db, groupID optionally scopes the generated tx events to a NIP-29 group
+func (db *EventDB) AddEvent(chainID string, contract string, topic string, alias string, signature string, name string, groupID string) error {
 	t := time.Now().UTC()
 
 	_, err := db.db.Exec(db.ctx, `
-    INSERT INTO t_events (chain_id, contract, topic, alias, event_signature, name, created_at, updated_at)
-    VALUES ($1, $2, $3, $4, $5, $6, $7)
+    INSERT INTO t_events (chain_id, contract, topic, alias, event_signature, name, group_id, created_at, updated_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
     ON CONFLICT (chain_id, contract, topic)
     DO UPDATE SET
         name = EXCLUDED.name,
+        group_id = EXCLUDED.group_id,
         updated_at = EXCLUDED.updated_at
-    `, chainID, contract, topic, alias, signature, name, t, t)
+    `, chainID, contract, topic, alias, signature, name, groupID, t, t)
 	if err != nil {
 		return err
 	}
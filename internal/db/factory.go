@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type FactoryDB struct {
+	ctx    context.Context
+	suffix string
+	db     *pgxpool.Pool
+	rdb    *pgxpool.Pool
+}
+
+// NewFactoryDB creates a new DB
+func NewFactoryDB(ctx context.Context, db, rdb *pgxpool.Pool, name string) (*FactoryDB, error) {
+	return &FactoryDB{
+		ctx:    ctx,
+		suffix: name,
+		db:     db,
+		rdb:    rdb,
+	}, nil
+}
+
+// CreateFactoriesTable creates a table to store the account factories accounts can be deployed from
+func (db *FactoryDB) CreateFactoriesTable() error {
+	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	CREATE TABLE t_account_factories_%s(
+		contract TEXT NOT NULL PRIMARY KEY,
+		paymaster TEXT NOT NULL,
+		entrypoint TEXT NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp,
+		updated_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`, db.suffix))
+
+	return err
+}
+
+// GetFactory gets an account factory by contract
+func (db *FactoryDB) GetFactory(contract string) (*relay.AccountFactory, error) {
+	var f relay.AccountFactory
+	err := db.rdb.QueryRow(db.ctx, fmt.Sprintf(`
+	SELECT contract, paymaster, entrypoint, created_at, updated_at
+	FROM t_account_factories_%s
+	WHERE contract = $1
+	`, db.suffix), contract).Scan(&f.Contract, &f.Paymaster, &f.EntryPoint, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// SetFactory registers an account factory or updates its paymaster and entrypoint
+func (db *FactoryDB) SetFactory(f *relay.AccountFactory) error {
+	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	INSERT INTO t_account_factories_%s(contract, paymaster, entrypoint)
+	VALUES($1, $2, $3)
+	ON CONFLICT (contract) DO UPDATE SET
+		paymaster = EXCLUDED.paymaster,
+		entrypoint = EXCLUDED.entrypoint,
+		updated_at = current_timestamp
+	`, db.suffix), f.Contract, f.Paymaster, f.EntryPoint)
+
+	return err
+}
+
+// GetFactories returns all registered account factories
+func (db *FactoryDB) GetFactories() ([]*relay.AccountFactory, error) {
+	rows, err := db.rdb.Query(db.ctx, fmt.Sprintf(`
+	SELECT contract, paymaster, entrypoint, created_at, updated_at
+	FROM t_account_factories_%s
+	ORDER BY created_at ASC
+	`, db.suffix))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	factories := []*relay.AccountFactory{}
+	for rows.Next() {
+		var f relay.AccountFactory
+		err := rows.Scan(&f.Contract, &f.Paymaster, &f.EntryPoint, &f.CreatedAt, &f.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		factories = append(factories, &f)
+	}
+
+	return factories, rows.Err()
+}
+
+// FactoryExists checks if an account factory is registered
+func (db *FactoryDB) FactoryExists(contract string) (bool, error) {
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, fmt.Sprintf(`
+	SELECT EXISTS (SELECT 1 FROM t_account_factories_%s WHERE contract = $1)
+	`, db.suffix), contract).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// RemoveFactory removes an account factory from the registry
+func (db *FactoryDB) RemoveFactory(contract string) error {
+	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	DELETE FROM t_account_factories_%s WHERE contract = $1
+	`, db.suffix), contract)
+
+	return err
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type FilteredContentDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewFilteredContentDB creates a new DB
+func NewFilteredContentDB(ctx context.Context, db, rdb *pgxpool.Pool) (*FilteredContentDB, error) {
+	return &FilteredContentDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateFilteredContentTable creates a table to store the group messages that matched a keyword
+// filter, for the admins of the group
+func (db *FilteredContentDB) CreateFilteredContentTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_filtered_content(
+		id bigserial PRIMARY KEY,
+		group_id text NOT NULL,
+		event_id text NOT NULL,
+		pubkey text NOT NULL,
+		kind integer NOT NULL,
+		keyword text NOT NULL,
+		action text NOT NULL,
+		content text NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`)
+
+	return err
+}
+
+// CreateFilteredContentTableIndexes creates the indexes for the filtered content table
+func (db *FilteredContentDB) CreateFilteredContentTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_filtered_content_group_id_created_at ON t_filtered_content (group_id, created_at);
+	`)
+
+	return err
+}
+
+// AddFiltered records a message that matched a filter
+func (db *FilteredContentDB) AddFiltered(f *relay.FilteredContent) error {
+	return db.db.QueryRow(db.ctx, `
+	INSERT INTO t_filtered_content (group_id, event_id, pubkey, kind, keyword, action, content, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id
+	`, f.GroupID, f.EventID, f.Pubkey, f.Kind, f.Keyword, f.Action, f.Content, f.CreatedAt).Scan(&f.ID)
+}
+
+// GetFiltered returns the messages of a group that matched a filter since a given time, latest
+// first
+func (db *FilteredContentDB) GetFiltered(groupID string, since time.Time, limit int) ([]*relay.FilteredContent, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT id, group_id, event_id, pubkey, kind, keyword, action, content, created_at
+	FROM t_filtered_content
+	WHERE group_id = $1 AND created_at >= $2
+	ORDER BY created_at DESC, id DESC
+	LIMIT $3
+	`, groupID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filtered := []*relay.FilteredContent{}
+	for rows.Next() {
+		var f relay.FilteredContent
+		err := rows.Scan(&f.ID, &f.GroupID, &f.EventID, &f.Pubkey, &f.Kind, &f.Keyword, &f.Action, &f.Content, &f.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		filtered = append(filtered, &f)
+	}
+
+	return filtered, rows.Err()
+}
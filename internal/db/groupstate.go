@@ -0,0 +1,250 @@
+package db
+
+import (
+	"context"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GroupStateDB keeps the groups and their members projected from moderation events, so that
+// membership checks don't replay events
+type GroupStateDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewGroupStateDB creates a new DB
+func NewGroupStateDB(ctx context.Context, db, rdb *pgxpool.Pool) (*GroupStateDB, error) {
+	return &GroupStateDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateGroupsTable creates a table to store the metadata of groups
+func (db *GroupStateDB) CreateGroupsTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_groups(
+		id text PRIMARY KEY,
+		name text NOT NULL DEFAULT '',
+		about text NOT NULL DEFAULT '',
+		picture text NOT NULL DEFAULT '',
+		created_by text NOT NULL,
+		created_at timestamp NOT NULL,
+		updated_at timestamp NOT NULL
+	);
+	`)
+
+	return err
+}
+
+// CreateGroupMembersTable creates a table to store the members of groups, a removed member is
+// kept so that an older put can't add them back
+func (db *GroupStateDB) CreateGroupMembersTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_group_members(
+		group_id text NOT NULL,
+		pubkey text NOT NULL,
+		role text NOT NULL,
+		removed boolean NOT NULL DEFAULT false,
+		updated_at timestamp NOT NULL,
+		PRIMARY KEY (group_id, pubkey)
+	);
+	`)
+
+	return err
+}
+
+// CreateGroupMembersTableIndexes creates the indexes for the group members table
+func (db *GroupStateDB) CreateGroupMembersTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_group_members_pubkey ON t_group_members (pubkey) WHERE NOT removed;
+	`)
+
+	return err
+}
+
+// ApplyGroupChange applies the change of a moderation event in a single transaction
+func (db *GroupStateDB) ApplyGroupChange(c *relay.GroupChange) error {
+	tx, err := db.db.Begin(db.ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(db.ctx)
+
+	err = db.apply(tx, c)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(db.ctx)
+}
+
+// RebuildGroupState replaces the projected state with the changes of every moderation event,
+// oldest first
+func (db *GroupStateDB) RebuildGroupState(changes []*relay.GroupChange) error {
+	tx, err := db.db.Begin(db.ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(db.ctx)
+
+	_, err = tx.Exec(db.ctx, `
+	TRUNCATE t_groups, t_group_members
+	`)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		err = db.apply(tx, c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(db.ctx)
+}
+
+func (db *GroupStateDB) apply(tx pgx.Tx, c *relay.GroupChange) error {
+	if c.Deleted {
+		_, err := tx.Exec(db.ctx, `
+		DELETE FROM t_group_members WHERE group_id = $1
+		`, c.GroupID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(db.ctx, `
+		DELETE FROM t_groups WHERE id = $1
+		`, c.GroupID)
+		return err
+	}
+
+	if m := c.Metadata; m != nil && c.Created {
+		_, err := tx.Exec(db.ctx, `
+		INSERT INTO t_groups (id, name, about, picture, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (id) DO NOTHING
+		`, c.GroupID, m.Name, m.About, m.Picture, m.CreatedBy, c.At)
+		if err != nil {
+			return err
+		}
+	} else if m != nil {
+		_, err := tx.Exec(db.ctx, `
+		UPDATE t_groups SET name = $2, about = $3, picture = $4, updated_at = $5
+		WHERE id = $1 AND updated_at <= $5
+		`, c.GroupID, m.Name, m.About, m.Picture, c.At)
+		if err != nil {
+			return err
+		}
+	}
+
+	// as with the relay-generated admins list, putting an admin back as a member keeps them admin
+	for _, p := range c.Put {
+		_, err := tx.Exec(db.ctx, `
+		INSERT INTO t_group_members AS m (group_id, pubkey, role, removed, updated_at)
+		VALUES ($1, $2, $3, false, $4)
+		ON CONFLICT (group_id, pubkey) DO UPDATE
+		SET role = CASE WHEN m.removed OR EXCLUDED.role = 'admin' THEN EXCLUDED.role ELSE m.role END,
+			removed = false,
+			updated_at = EXCLUDED.updated_at
+		WHERE m.updated_at <= EXCLUDED.updated_at
+		`, c.GroupID, p.Pubkey, p.Role, c.At)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, pubkey := range c.Removed {
+		_, err := tx.Exec(db.ctx, `
+		INSERT INTO t_group_members AS m (group_id, pubkey, role, removed, updated_at)
+		VALUES ($1, $2, '', true, $3)
+		ON CONFLICT (group_id, pubkey) DO UPDATE
+		SET removed = true, updated_at = EXCLUDED.updated_at
+		WHERE m.updated_at <= EXCLUDED.updated_at
+		`, c.GroupID, pubkey, c.At)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetGroupMember returns the role of a pubkey in a group, nil if it isn't a member
+func (db *GroupStateDB) GetGroupMember(groupID, pubkey string) (*relay.GroupMember, error) {
+	var m relay.GroupMember
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT group_id, pubkey, role, updated_at
+	FROM t_group_members
+	WHERE group_id = $1 AND pubkey = $2 AND NOT removed
+	`, groupID, pubkey).Scan(&m.GroupID, &m.Pubkey, &m.Role, &m.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// GetGroup returns the projected metadata of a group, nil if it doesn't exist
+func (db *GroupStateDB) GetGroup(groupID string) (*relay.Group, error) {
+	var g relay.Group
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT id, name, about, picture, created_by, created_at, updated_at
+	FROM t_groups
+	WHERE id = $1
+	`, groupID).Scan(&g.ID, &g.Name, &g.About, &g.Picture, &g.CreatedBy, &g.CreatedAt, &g.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &g, nil
+}
+
+// HasGroups tells whether any group was projected, an empty projection is rebuilt on startup
+func (db *GroupStateDB) HasGroups() (bool, error) {
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT EXISTS (SELECT 1 FROM t_groups)
+	`).Scan(&exists)
+
+	return exists, err
+}
+
+// GetGroupMembers returns the members of a group with their role
+func (db *GroupStateDB) GetGroupMembers(groupID string) ([]*relay.GroupMember, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT group_id, pubkey, role, updated_at
+	FROM t_group_members
+	WHERE group_id = $1 AND NOT removed
+	ORDER BY pubkey
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*relay.GroupMember{}
+	for rows.Next() {
+		var m relay.GroupMember
+		err := rows.Scan(&m.GroupID, &m.Pubkey, &m.Role, &m.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, &m)
+	}
+
+	return members, rows.Err()
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type GroupTokenDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewGroupTokenDB creates a new DB
+func NewGroupTokenDB(ctx context.Context, db, rdb *pgxpool.Pool) (*GroupTokenDB, error) {
+	return &GroupTokenDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateGroupTokensTable creates a table to store the tokens minted by group admins, only a hash of the secret is kept
+func (db *GroupTokenDB) CreateGroupTokensTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_group_tokens(
+		id text NOT NULL PRIMARY KEY,
+		group_id text NOT NULL,
+		scope text NOT NULL,
+		pubkey text NOT NULL DEFAULT '',
+		name text NOT NULL DEFAULT '',
+		secret_hash text NOT NULL UNIQUE,
+		created_by text NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp,
+		expires_at timestamp NOT NULL,
+		revoked_at timestamp
+	);
+	`)
+
+	return err
+}
+
+// CreateGroupTokensTableIndexes creates the indexes for the group tokens table
+func (db *GroupTokenDB) CreateGroupTokensTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_group_tokens_group_id ON t_group_tokens (group_id);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_group_tokens_pubkey ON t_group_tokens (pubkey);
+	`)
+
+	return err
+}
+
+const groupTokenColumns = `id, group_id, scope, pubkey, name, created_by, created_at, expires_at, revoked_at`
+
+func scanGroupToken(row pgx.Row) (*relay.GroupToken, error) {
+	var t relay.GroupToken
+	err := row.Scan(&t.ID, &t.GroupID, &t.Scope, &t.Pubkey, &t.Name, &t.CreatedBy, &t.CreatedAt, &t.ExpiresAt, &t.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// AddToken stores a token with the hash of its secret, false is returned if a token with the same id exists
+func (db *GroupTokenDB) AddToken(t *relay.GroupToken, secretHash string) (bool, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_group_tokens (id, group_id, scope, pubkey, name, secret_hash, created_by, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (id) DO NOTHING
+	`, t.ID, t.GroupID, t.Scope, t.Pubkey, t.Name, secretHash, t.CreatedBy, t.CreatedAt, t.ExpiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// GetTokenBySecretHash returns the token with the given secret hash, nil if there is none
+func (db *GroupTokenDB) GetTokenBySecretHash(secretHash string) (*relay.GroupToken, error) {
+	t, err := scanGroupToken(db.rdb.QueryRow(db.ctx, `
+	SELECT `+groupTokenColumns+`
+	FROM t_group_tokens
+	WHERE secret_hash = $1
+	`, secretHash))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	return t, err
+}
+
+// GetTokens returns the tokens of a group, newest first
+func (db *GroupTokenDB) GetTokens(groupID string) ([]*relay.GroupToken, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT `+groupTokenColumns+`
+	FROM t_group_tokens
+	WHERE group_id = $1
+	ORDER BY created_at DESC, id
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*relay.GroupToken{}
+	for rows.Next() {
+		t, err := scanGroupToken(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeToken revokes a token of a group, false is returned if it doesn't exist or was already revoked
+func (db *GroupTokenDB) RevokeToken(groupID, id string, at time.Time) (bool, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	UPDATE t_group_tokens SET revoked_at = $3
+	WHERE group_id = $1 AND id = $2 AND revoked_at IS NULL
+	`, groupID, id, at)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// IsBot returns true if any token was ever minted for the pubkey, even if it is no longer active
+func (db *GroupTokenDB) IsBot(pubkey string) (bool, error) {
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT EXISTS (SELECT 1 FROM t_group_tokens WHERE pubkey = $1)
+	`, pubkey).Scan(&exists)
+
+	return exists, err
+}
+
+// HasActiveToken returns true if the pubkey holds a token for the group and scope that is active at the given time
+func (db *GroupTokenDB) HasActiveToken(pubkey, groupID string, scope relay.GroupTokenScope, at time.Time) (bool, error) {
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT EXISTS (
+		SELECT 1 FROM t_group_tokens
+		WHERE pubkey = $1 AND group_id = $2 AND scope = $3 AND revoked_at IS NULL AND expires_at > $4
+	)
+	`, pubkey, groupID, scope, at).Scan(&exists)
+
+	return exists, err
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// latencySamples is how many of the most recent queries the latency is computed over
+const latencySamples = 1024
+
+type queryStartKey struct{}
+
+// Latency records how long the most recent queries took, it is installed as the tracer of the pool
+type Latency struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func NewLatency() *Latency {
+	return &Latency{
+		samples: make([]time.Duration, 0, latencySamples),
+	}
+}
+
+func (l *Latency) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, time.Now())
+}
+
+func (l *Latency) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+
+	l.Observe(time.Since(start))
+}
+
+// Observe records the duration of a query
+func (l *Latency) Observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencySamples
+}
+
+// Percentile returns the duration that p (between 0 and 1) of the recent queries stayed under,
+// 0 if no query ran yet
+func (l *Latency) Percentile(p float64) time.Duration {
+	l.mu.Lock()
+	sorted := slices.Clone(l.samples)
+	l.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	slices.Sort(sorted)
+
+	i := int(float64(len(sorted))*p+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type OutboxDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewOutboxDB creates a new DB
+func NewOutboxDB(ctx context.Context, db, rdb *pgxpool.Pool) (*OutboxDB, error) {
+	return &OutboxDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateOutboxTable creates a table to store the events the relay signed but failed to store
+func (db *OutboxDB) CreateOutboxTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_outbox(
+		event_id text NOT NULL PRIMARY KEY,
+		event jsonb NOT NULL,
+		replace boolean NOT NULL,
+		attempts integer NOT NULL DEFAULT 0,
+		last_error text NOT NULL DEFAULT '',
+		next_attempt_at timestamp NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`)
+
+	return err
+}
+
+// CreateOutboxTableIndexes creates the indexes for the outbox table
+func (db *OutboxDB) CreateOutboxTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_outbox_next_attempt_at ON t_outbox (next_attempt_at);
+	`)
+
+	return err
+}
+
+// AddOutboxEvent queues an event, queueing it again keeps the first one
+func (db *OutboxDB) AddOutboxEvent(e *relay.OutboxEvent) error {
+	b, err := json.Marshal(e.Event)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.db.Exec(db.ctx, `
+	INSERT INTO t_outbox (event_id, event, replace, attempts, last_error, next_attempt_at, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (event_id) DO NOTHING
+	`, e.Event.ID, b, e.Replace, e.Attempts, e.LastError, e.NextAttemptAt, e.CreatedAt)
+
+	return err
+}
+
+// GetDueOutboxEvents returns the events to retry at a given time, oldest first so that versions
+// of a replaceable event are stored in order
+func (db *OutboxDB) GetDueOutboxEvents(now time.Time, limit int) ([]*relay.OutboxEvent, error) {
+	rows, err := db.db.Query(db.ctx, `
+	SELECT event, replace, attempts, last_error, next_attempt_at, created_at
+	FROM t_outbox
+	WHERE next_attempt_at <= $1
+	ORDER BY created_at, event_id
+	LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*relay.OutboxEvent{}
+	for rows.Next() {
+		var b []byte
+		e := relay.OutboxEvent{Event: &nostr.Event{}}
+		err := rows.Scan(&b, &e.Replace, &e.Attempts, &e.LastError, &e.NextAttemptAt, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(b, e.Event)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &e)
+	}
+
+	return events, rows.Err()
+}
+
+// UpdateOutboxAttempt records a failed attempt and when to try again
+func (db *OutboxDB) UpdateOutboxAttempt(e *relay.OutboxEvent) error {
+	_, err := db.db.Exec(db.ctx, `
+	UPDATE t_outbox
+	SET attempts = $2, last_error = $3, next_attempt_at = $4
+	WHERE event_id = $1
+	`, e.Event.ID, e.Attempts, e.LastError, e.NextAttemptAt)
+
+	return err
+}
+
+// RemoveOutboxEvent removes an event once it is stored
+func (db *OutboxDB) RemoveOutboxEvent(eventID string) error {
+	_, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_outbox WHERE event_id = $1
+	`, eventID)
+
+	return err
+}
+
+// CountOutboxEvents returns the number of events waiting to be stored
+func (db *OutboxDB) CountOutboxEvents() (int, error) {
+	var count int
+	err := db.rdb.QueryRow(db.ctx, `SELECT count(*) FROM t_outbox`).Scan(&count)
+
+	return count, err
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PinDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewPinDB creates a new DB
+func NewPinDB(ctx context.Context, db, rdb *pgxpool.Pool) (*PinDB, error) {
+	pindb := &PinDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}
+
+	return pindb, nil
+}
+
+// CreatePinsTable creates a table to store the cids pinned by the relay
+func (db *PinDB) CreatePinsTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_ipfs_pins(
+		cid TEXT NOT NULL PRIMARY KEY,
+		created_at timestamp NOT NULL DEFAULT current_timestamp
+	);`)
+
+	return err
+}
+
+// AddPin records a cid pinned by the relay
+func (db *PinDB) AddPin(cid string) error {
+	_, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_ipfs_pins (cid)
+		VALUES ($1)
+		ON CONFLICT (cid) DO NOTHING
+	`, cid)
+
+	return err
+}
+
+// RemovePin removes a cid that was unpinned by the relay
+func (db *PinDB) RemovePin(cid string) error {
+	_, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_ipfs_pins WHERE cid = $1
+	`, cid)
+
+	return err
+}
+
+// PinExists checks if a cid was pinned by the relay
+func (db *PinDB) PinExists(cid string) (bool, error) {
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT EXISTS (SELECT 1 FROM t_ipfs_pins WHERE cid = $1)
+	`, cid).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PollVoteDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewPollVoteDB creates a new DB
+func NewPollVoteDB(ctx context.Context, db, rdb *pgxpool.Pool) (*PollVoteDB, error) {
+	return &PollVoteDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreatePollVotesTable creates a table to store the votes counted on group polls
+func (db *PollVoteDB) CreatePollVotesTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_poll_votes(
+		poll_id text NOT NULL,
+		pubkey text NOT NULL,
+		account text NOT NULL DEFAULT '',
+		options text[] NOT NULL,
+		event_id text NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp,
+		PRIMARY KEY (poll_id, pubkey)
+	);
+	`)
+
+	return err
+}
+
+// CreatePollVotesTableIndexes creates the indexes for the poll votes table
+func (db *PollVoteDB) CreatePollVotesTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_poll_votes_account ON t_poll_votes (poll_id, account) WHERE account <> '';
+	`)
+
+	return err
+}
+
+// AddVote counts a vote, false is returned if the member or the account already voted on the poll
+func (db *PollVoteDB) AddVote(v *relay.PollVote) (bool, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_poll_votes (poll_id, pubkey, account, options, event_id, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT DO NOTHING
+	`, v.PollID, v.Pubkey, v.Account, v.Options, v.EventID, v.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// HasVoted checks if a member, or the account when it is not empty, already voted on a poll
+func (db *PollVoteDB) HasVoted(pollID, pubkey, account string) (bool, error) {
+	var exists bool
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT EXISTS (
+		SELECT 1 FROM t_poll_votes
+		WHERE poll_id = $1 AND (pubkey = $2 OR ($3 <> '' AND account = $3))
+	)
+	`, pollID, pubkey, account).Scan(&exists)
+
+	return exists, err
+}
+
+// GetTally returns the number of votes of each option of a poll and the number of voters
+func (db *PollVoteDB) GetTally(pollID string) (map[string]int, int, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT option, COUNT(*)
+	FROM t_poll_votes, unnest(options) AS option
+	WHERE poll_id = $1
+	GROUP BY option
+	`, pollID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	tally := map[string]int{}
+	for rows.Next() {
+		var option string
+		var votes int
+		err := rows.Scan(&option, &votes)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		tally[option] = votes
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var voters int
+	err = db.rdb.QueryRow(db.ctx, `
+	SELECT COUNT(*) FROM t_poll_votes WHERE poll_id = $1
+	`, pollID).Scan(&voters)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return tally, voters, nil
+}
+
+// GetVotesByPubkey returns the votes of a member on every poll, newest first
+func (db *PollVoteDB) GetVotesByPubkey(pubkey string) ([]*relay.PollVote, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT poll_id, pubkey, account, options, event_id, created_at
+	FROM t_poll_votes
+	WHERE pubkey = $1
+	ORDER BY created_at DESC
+	`, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	votes := []*relay.PollVote{}
+	for rows.Next() {
+		var v relay.PollVote
+		err := rows.Scan(&v.PollID, &v.Pubkey, &v.Account, &v.Options, &v.EventID, &v.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		votes = append(votes, &v)
+	}
+
+	return votes, rows.Err()
+}
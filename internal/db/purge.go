@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PurgeDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewPurgeDB creates a new DB
+func NewPurgeDB(ctx context.Context, db, rdb *pgxpool.Pool) (*PurgeDB, error) {
+	return &PurgeDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreatePurgesTable creates the tables of purge requests and of their audit trail
+func (db *PurgeDB) CreatePurgesTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_purges(
+		id bigserial PRIMARY KEY,
+		pubkey text NOT NULL,
+		status text NOT NULL,
+		reason text NOT NULL DEFAULT '',
+		requested_at timestamp NOT NULL DEFAULT current_timestamp,
+		updated_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+
+	CREATE TABLE IF NOT EXISTS t_purge_audit(
+		id bigserial PRIMARY KEY,
+		purge_id bigint NOT NULL REFERENCES t_purges(id),
+		action text NOT NULL,
+		count integer NOT NULL DEFAULT 0,
+		detail text NOT NULL DEFAULT '',
+		created_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`)
+
+	return err
+}
+
+// CreatePurgesTableIndexes creates the indexes for the purge tables
+func (db *PurgeDB) CreatePurgesTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_purges_status ON t_purges (status);
+	CREATE INDEX IF NOT EXISTS idx_purges_pubkey ON t_purges (pubkey);
+	CREATE INDEX IF NOT EXISTS idx_purge_audit_purge_id ON t_purge_audit (purge_id);
+	`)
+
+	return err
+}
+
+const purgeColumns = `id, pubkey, status, reason, requested_at, updated_at`
+
+func scanPurge(row pgx.Row) (*relay.Purge, error) {
+	var p relay.Purge
+	err := row.Scan(&p.ID, &p.Pubkey, &p.Status, &p.Reason, &p.RequestedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// AddPurge records a pending purge of a pubkey and sets its id
+func (db *PurgeDB) AddPurge(p *relay.Purge) error {
+	return db.db.QueryRow(db.ctx, `
+	INSERT INTO t_purges (pubkey, status, reason, requested_at, updated_at)
+	VALUES ($1, $2, $3, $4, $4)
+	RETURNING id
+	`, p.Pubkey, p.Status, p.Reason, p.RequestedAt).Scan(&p.ID)
+}
+
+// GetPurge returns a purge with its audit trail, or nil if it doesn't exist
+func (db *PurgeDB) GetPurge(id int64) (*relay.Purge, error) {
+	p, err := scanPurge(db.rdb.QueryRow(db.ctx, `
+	SELECT `+purgeColumns+`
+	FROM t_purges
+	WHERE id = $1
+	`, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.Audit, err = db.getAudit(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// GetPendingPurge returns the pending purge of a pubkey, or nil if there is none
+func (db *PurgeDB) GetPendingPurge(pubkey string) (*relay.Purge, error) {
+	p, err := scanPurge(db.rdb.QueryRow(db.ctx, `
+	SELECT `+purgeColumns+`
+	FROM t_purges
+	WHERE pubkey = $1 AND status = $2
+	ORDER BY requested_at DESC
+	LIMIT 1
+	`, pubkey, relay.PurgeStatusPending))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	return p, err
+}
+
+// GetPurges returns the latest purges, newest first, of a status or of any status when empty
+func (db *PurgeDB) GetPurges(status relay.PurgeStatus, limit int) ([]*relay.Purge, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT `+purgeColumns+`
+	FROM t_purges
+	WHERE $1 = '' OR status = $1
+	ORDER BY requested_at DESC, id DESC
+	LIMIT $2
+	`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	purges := []*relay.Purge{}
+	for rows.Next() {
+		p, err := scanPurge(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		purges = append(purges, p)
+	}
+
+	return purges, rows.Err()
+}
+
+// SetStatus updates the status of a purge
+func (db *PurgeDB) SetStatus(id int64, status relay.PurgeStatus, t time.Time) error {
+	_, err := db.db.Exec(db.ctx, `
+	UPDATE t_purges
+	SET status = $2, updated_at = $3
+	WHERE id = $1
+	`, id, status, t)
+
+	return err
+}
+
+// ClaimStatus moves a purge from a status to another, it returns false when the purge is no longer
+// in the status it was read in
+func (db *PurgeDB) ClaimStatus(id int64, from, to relay.PurgeStatus, t time.Time) (bool, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	UPDATE t_purges
+	SET status = $3, updated_at = $4
+	WHERE id = $1 AND status = $2
+	`, id, from, to, t)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// AddAuditEntry appends an entry to the audit trail of a purge
+func (db *PurgeDB) AddAuditEntry(id int64, e *relay.PurgeAuditEntry) error {
+	_, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_purge_audit (purge_id, action, count, detail, created_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`, id, e.Action, e.Count, e.Detail, e.CreatedAt)
+
+	return err
+}
+
+func (db *PurgeDB) getAudit(id int64) ([]*relay.PurgeAuditEntry, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT action, count, detail, created_at
+	FROM t_purge_audit
+	WHERE purge_id = $1
+	ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	audit := []*relay.PurgeAuditEntry{}
+	for rows.Next() {
+		var e relay.PurgeAuditEntry
+		err := rows.Scan(&e.Action, &e.Count, &e.Detail, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		audit = append(audit, &e)
+	}
+
+	return audit, rows.Err()
+}
@@ -116,6 +116,34 @@ func (db *PushTokenDB) GetAccountTokens(account string) ([]*relay.PushToken, err
 	return pt, nil
 }
 
+// GetAccountsTokens returns the push tokens of several accounts by account
+func (db *PushTokenDB) GetAccountsTokens(accounts []string) (map[string][]*relay.PushToken, error) {
+	pt := map[string][]*relay.PushToken{}
+
+	rows, err := db.rdb.Query(db.ctx, fmt.Sprintf(`
+		SELECT token, account
+		FROM t_push_token_%s
+		WHERE account = ANY($1)
+		`, db.suffix), accounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p relay.PushToken
+
+		err := rows.Scan(&p.Token, &p.Account)
+		if err != nil {
+			return nil, err
+		}
+
+		pt[p.Account] = append(pt[p.Account], &p)
+	}
+
+	return pt, rows.Err()
+}
+
 // RemoveAccountPushToken removes a push token for a given account from the db
 func (db *PushTokenDB) RemoveAccountPushToken(token, account string) error {
 	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
@@ -125,6 +153,15 @@ func (db *PushTokenDB) RemoveAccountPushToken(token, account string) error {
 	return err
 }
 
+// RemoveAccountTokens removes every push token of an account from the db
+func (db *PushTokenDB) RemoveAccountTokens(account string) error {
+	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	DELETE FROM t_push_token_%s WHERE account = $1
+	`, db.suffix), account)
+
+	return err
+}
+
 // RemovePushToken removes a push token from the db
 func (db *PushTokenDB) RemovePushToken(token string) error {
 	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PushPreferenceDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewPushPreferenceDB creates a new DB
+func NewPushPreferenceDB(ctx context.Context, db, rdb *pgxpool.Pool) (*PushPreferenceDB, error) {
+	ppdb := &PushPreferenceDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}
+
+	return ppdb, nil
+}
+
+// CreatePushPreferencesTable creates a table to store push preferences in the given db
+func (db *PushPreferenceDB) CreatePushPreferencesTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_push_preferences(
+		pubkey text NOT NULL PRIMARY KEY,
+		mode text NOT NULL,
+		locale text NOT NULL DEFAULT '',
+		created_at timestamp NOT NULL DEFAULT current_timestamp,
+		updated_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`)
+
+	return err
+}
+
+// MigratePushPreferencesTable adds columns introduced after the push preferences table was first created
+func (db *PushPreferenceDB) MigratePushPreferencesTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	ALTER TABLE t_push_preferences ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT '';
+	`)
+
+	return err
+}
+
+// GetPreference returns the push preference of a pubkey, defaults to all notifications in the
+// default locale
+func (db *PushPreferenceDB) GetPreference(pubkey string) (*relay.PushPreference, error) {
+	p := relay.PushPreference{
+		Pubkey: pubkey,
+		Mode:   relay.PushModeAll,
+	}
+
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT pubkey, mode, locale
+	FROM t_push_preferences
+	WHERE pubkey = $1
+	`, pubkey).Scan(&p.Pubkey, &p.Mode, &p.Locale)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+
+	if p.Locale == "" {
+		p.Locale = relay.PushLocaleDefault
+	}
+
+	return &p, nil
+}
+
+// GetPreferences returns the push preferences of pubkeys by pubkey, pubkeys without one get the
+// default of GetPreference
+func (db *PushPreferenceDB) GetPreferences(pubkeys []string) (map[string]*relay.PushPreference, error) {
+	prefs := make(map[string]*relay.PushPreference, len(pubkeys))
+	for _, pubkey := range pubkeys {
+		prefs[pubkey] = &relay.PushPreference{
+			Pubkey: pubkey,
+			Mode:   relay.PushModeAll,
+			Locale: relay.PushLocaleDefault,
+		}
+	}
+
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT pubkey, mode, locale
+	FROM t_push_preferences
+	WHERE pubkey = ANY($1)
+	`, pubkeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p relay.PushPreference
+
+		err := rows.Scan(&p.Pubkey, &p.Mode, &p.Locale)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.Locale == "" {
+			p.Locale = relay.PushLocaleDefault
+		}
+
+		prefs[p.Pubkey] = &p
+	}
+
+	return prefs, rows.Err()
+}
+
+// SetPreference sets the push preference of a pubkey
+func (db *PushPreferenceDB) SetPreference(p *relay.PushPreference) error {
+	now := time.Now().UTC()
+
+	_, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_push_preferences (pubkey, mode, locale, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (pubkey)
+	DO UPDATE SET mode = EXCLUDED.mode, locale = EXCLUDED.locale, updated_at = EXCLUDED.updated_at
+	`, p.Pubkey, p.Mode, p.Locale, now, now)
+
+	return err
+}
+
+// RemovePreference removes the push preference of a pubkey, it falls back to the default
+func (db *PushPreferenceDB) RemovePreference(pubkey string) error {
+	_, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_push_preferences WHERE pubkey = $1
+	`, pubkey)
+
+	return err
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ScanDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewScanDB creates a new DB
+func NewScanDB(ctx context.Context, db, rdb *pgxpool.Pool) (*ScanDB, error) {
+	return &ScanDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateScansTable creates the table of antivirus scans
+func (db *ScanDB) CreateScansTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_scans(
+		sha256 text PRIMARY KEY,
+		pubkey text NOT NULL,
+		group_id text NOT NULL DEFAULT '',
+		mime text NOT NULL DEFAULT '',
+		status text NOT NULL,
+		signature text NOT NULL DEFAULT '',
+		created_at timestamp NOT NULL DEFAULT current_timestamp,
+		updated_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`)
+
+	return err
+}
+
+// CreateScansTableIndexes creates the indexes for the scans table
+func (db *ScanDB) CreateScansTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_scans_status ON t_scans (status);
+	`)
+
+	return err
+}
+
+const scanColumns = `sha256, pubkey, group_id, mime, status, signature, created_at, updated_at`
+
+func scanScan(row pgx.Row) (*relay.Scan, error) {
+	var s relay.Scan
+	err := row.Scan(&s.SHA256, &s.Pubkey, &s.GroupID, &s.Mime, &s.Status, &s.Signature, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// AddScan records a pending scan, a blob that was scanned before is scanned again when it is
+// uploaded again. False is returned if the blob is already waiting for a scan.
+func (db *ScanDB) AddScan(s *relay.Scan) (bool, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_scans (sha256, pubkey, group_id, mime, status, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $6)
+	ON CONFLICT (sha256) DO UPDATE
+	SET pubkey = EXCLUDED.pubkey, group_id = EXCLUDED.group_id, mime = EXCLUDED.mime, status = EXCLUDED.status, signature = '', updated_at = EXCLUDED.updated_at
+	WHERE t_scans.status <> $5
+	`, s.SHA256, s.Pubkey, s.GroupID, s.Mime, s.Status, s.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetScan returns the scan of a blob, nil if it has none
+func (db *ScanDB) GetScan(sha256 string) (*relay.Scan, error) {
+	s, err := scanScan(db.rdb.QueryRow(db.ctx, `
+	SELECT `+scanColumns+`
+	FROM t_scans
+	WHERE sha256 = $1
+	`, sha256))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	return s, err
+}
+
+// GetPendingScans returns the blobs waiting for a scan, oldest first
+func (db *ScanDB) GetPendingScans() ([]*relay.Scan, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT `+scanColumns+`
+	FROM t_scans
+	WHERE status = $1
+	ORDER BY created_at
+	`, relay.ScanStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scans := []*relay.Scan{}
+	for rows.Next() {
+		s, err := scanScan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		scans = append(scans, s)
+	}
+
+	return scans, rows.Err()
+}
+
+// SetClean records that a blob was scanned and found clean
+func (db *ScanDB) SetClean(sha256 string, at time.Time) error {
+	_, err := db.db.Exec(db.ctx, `
+	UPDATE t_scans
+	SET status = $2, signature = '', updated_at = $3
+	WHERE sha256 = $1
+	`, sha256, relay.ScanStatusClean, at)
+
+	return err
+}
+
+// SetInfected records the signature a blob was found infected with
+func (db *ScanDB) SetInfected(sha256, signature string, at time.Time) error {
+	_, err := db.db.Exec(db.ctx, `
+	UPDATE t_scans
+	SET status = $2, signature = $3, updated_at = $4
+	WHERE sha256 = $1
+	`, sha256, relay.ScanStatusInfected, signature, at)
+
+	return err
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Tables lists the tables NewDB creates for a chain, the push token tables of registered events
+// are left out since they depend on the events
+func Tables(chainID string) []string {
+	return []string{
+		"t_events",
+		fmt.Sprintf("t_sponsors_%s", chainID),
+		fmt.Sprintf("t_account_factories_%s", chainID),
+		"t_logs_data",
+		"t_ipfs_pins",
+		fmt.Sprintf("t_sponsor_spend_%s", chainID),
+		fmt.Sprintf("t_sponsorships_%s", chainID),
+		fmt.Sprintf("t_sponsorship_denials_%s", chainID),
+		fmt.Sprintf("t_push_token_%s", nostrPushTokenSuffix),
+		"t_push_preferences",
+		"t_group_tokens",
+		"t_email_senders",
+		"t_poll_votes",
+		"t_token_gate_lapses",
+		"t_account_links",
+		"t_erasure_requests",
+		"t_purges",
+		"t_uploads",
+		"t_blob_refs",
+		"t_transcodes",
+		"t_scans",
+		"t_blob_rewrites",
+		"t_userop_webhooks",
+		"t_bans",
+		"t_filtered_content",
+		"t_groups",
+		"t_group_members",
+		"t_outbox",
+	}
+}
+
+// migratedColumns are the columns added to existing tables by the latest migrations, a database
+// that has them is on the latest schema
+func migratedColumns(chainID string) [][2]string {
+	sponsors := fmt.Sprintf("t_sponsors_%s", chainID)
+
+	return [][2]string{
+		{"t_events", "group_id"},
+		{"t_events", "abi"},
+		{sponsors, "signer_pk"},
+		{sponsors, "pk_rotated_at"},
+		{sponsors, "signer_rotated_at"},
+		{sponsors, "remote_signer"},
+		{sponsors, "remote_address"},
+		{"t_uploads", "removed_at"},
+		{"t_push_preferences", "locale"},
+	}
+}
+
+// CheckSchema returns the tables and columns of the latest schema that are missing from the
+// database, without creating them
+func CheckSchema(ctx context.Context, pool *pgxpool.Pool, chainID string) ([]string, error) {
+	rows, err := pool.Query(ctx, `
+	SELECT table_name, column_name
+	FROM information_schema.columns
+	WHERE table_schema = current_schema()
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]map[string]bool{}
+	for rows.Next() {
+		var table, column string
+		err := rows.Scan(&table, &column)
+		if err != nil {
+			return nil, err
+		}
+
+		if columns[table] == nil {
+			columns[table] = map[string]bool{}
+		}
+		columns[table][column] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	missing := []string{}
+	for _, t := range Tables(chainID) {
+		if columns[t] == nil {
+			missing = append(missing, t)
+		}
+	}
+
+	for _, tc := range migratedColumns(chainID) {
+		if columns[tc[0]] != nil && !columns[tc[0]][tc[1]] {
+			missing = append(missing, tc[0]+"."+tc[1])
+		}
+	}
+
+	return missing, nil
+}
+
+// EventChainIDs returns the chains events were registered for
+func EventChainIDs(ctx context.Context, pool *pgxpool.Pool) ([]string, error) {
+	rows, err := pool.Query(ctx, `SELECT DISTINCT chain_id FROM t_events ORDER BY chain_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SpendDB struct {
+	ctx    context.Context
+	suffix string
+	db     *pgxpool.Pool
+	rdb    *pgxpool.Pool
+}
+
+// NewSpendDB creates a new DB
+func NewSpendDB(ctx context.Context, db, rdb *pgxpool.Pool, name string) (*SpendDB, error) {
+	sdb := &SpendDB{
+		ctx:    ctx,
+		suffix: name,
+		db:     db,
+		rdb:    rdb,
+	}
+
+	return sdb, nil
+}
+
+// CreateSpendTable creates a table to store the gas spent by sponsors
+func (db *SpendDB) CreateSpendTable() error {
+	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS t_sponsor_spend_%s(
+		tx_hash text NOT NULL,
+		userop_hash text NOT NULL,
+		paymaster text NOT NULL,
+		sponsor text NOT NULL,
+		sender text NOT NULL,
+		destination text NOT NULL,
+		gas_used bigint NOT NULL,
+		fee_wei numeric(78, 0) NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp,
+		PRIMARY KEY (tx_hash, userop_hash)
+	);
+	`, db.suffix))
+
+	return err
+}
+
+// CreateSpendTableIndexes creates the indexes for the spend table
+func (db *SpendDB) CreateSpendTableIndexes() error {
+	suffix := common.ShortenName(db.suffix, 6)
+
+	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	CREATE INDEX IF NOT EXISTS idx_spend_%s_paymaster_created_at ON t_sponsor_spend_%s (paymaster, created_at);
+	`, suffix, db.suffix))
+
+	return err
+}
+
+// AddSpend records the gas spent for user operations
+func (db *SpendDB) AddSpend(spends []*relay.SponsorSpend) error {
+	for _, sp := range spends {
+		_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+		INSERT INTO t_sponsor_spend_%s (tx_hash, userop_hash, paymaster, sponsor, sender, destination, gas_used, fee_wei, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (tx_hash, userop_hash) DO NOTHING
+		`, db.suffix), sp.TxHash, sp.UserOpHash, sp.Paymaster, sp.Sponsor, sp.Sender, sp.Destination, int64(sp.GasUsed), sp.FeeWei.String(), sp.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetSpendLines returns the spend of a paymaster between two dates grouped by destination and sender
+func (db *SpendDB) GetSpendLines(paymaster string, from, to time.Time) ([]*relay.AccountingLine, error) {
+	rows, err := db.rdb.Query(db.ctx, fmt.Sprintf(`
+	SELECT destination, sender, COUNT(*), SUM(gas_used)::text, SUM(fee_wei)::text
+	FROM t_sponsor_spend_%s
+	WHERE paymaster = $1 AND created_at >= $2 AND created_at < $3
+	GROUP BY destination, sender
+	ORDER BY SUM(fee_wei) DESC
+	`, db.suffix), paymaster, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []*relay.AccountingLine{}
+	for rows.Next() {
+		var l relay.AccountingLine
+		var gasUsed, feeWei string
+
+		err := rows.Scan(&l.Destination, &l.Sender, &l.Ops, &gasUsed, &feeWei)
+		if err != nil {
+			return nil, err
+		}
+
+		l.GasUsed, _ = new(big.Int).SetString(gasUsed, 10)
+		l.FeeWei, _ = new(big.Int).SetString(feeWei, 10)
+
+		lines = append(lines, &l)
+	}
+
+	return lines, nil
+}
+
+// GetPaymasters returns the paymasters that spent gas between two dates
+func (db *SpendDB) GetPaymasters(from, to time.Time) ([]string, error) {
+	rows, err := db.rdb.Query(db.ctx, fmt.Sprintf(`
+	SELECT DISTINCT paymaster
+	FROM t_sponsor_spend_%s
+	WHERE created_at >= $1 AND created_at < $2
+	`, db.suffix), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paymasters := []string{}
+	for rows.Next() {
+		var pm string
+
+		err := rows.Scan(&pm)
+		if err != nil {
+			return nil, err
+		}
+
+		paymasters = append(paymasters, pm)
+	}
+
+	return paymasters, nil
+}
@@ -3,9 +3,11 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/comunifi/relay/pkg/common"
 	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -45,44 +47,95 @@ func (db *SponsorDB) CreateSponsorsTable(suffix string) error {
 	return err
 }
 
+// MigrateSponsorsTable adds the columns that were introduced after the table was created, the
+// private key of existing sponsors counts as rotated when they were created
+func (db *SponsorDB) MigrateSponsorsTable(suffix string) error {
+	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	ALTER TABLE t_sponsors_%s ADD COLUMN IF NOT EXISTS signer_pk text NOT NULL DEFAULT '';
+	ALTER TABLE t_sponsors_%s ADD COLUMN IF NOT EXISTS pk_rotated_at timestamp;
+	ALTER TABLE t_sponsors_%s ADD COLUMN IF NOT EXISTS signer_rotated_at timestamp;
+	ALTER TABLE t_sponsors_%s ADD COLUMN IF NOT EXISTS remote_signer text NOT NULL DEFAULT '';
+	ALTER TABLE t_sponsors_%s ADD COLUMN IF NOT EXISTS remote_address text NOT NULL DEFAULT '';
+	`, suffix, suffix, suffix, suffix, suffix))
+
+	return err
+}
+
 // createSponsorsTableIndexes creates the indexes for sponsors in the given db
 func (db *SponsorDB) CreateSponsorsTableIndexes(suffix string) error {
 	return nil
 }
 
-// GetSponsor gets a sponsor from the db by contract
-func (db *SponsorDB) GetSponsor(contract string) (*relay.Sponsor, error) {
+const sponsorColumns = `contract, pk, signer_pk, remote_signer, remote_address, COALESCE(pk_rotated_at, created_at), signer_rotated_at, created_at, updated_at`
+
+// scanSponsor reads a sponsor and decrypts its keys
+func (db *SponsorDB) scanSponsor(row pgx.Row) (*relay.Sponsor, error) {
 	var sponsor relay.Sponsor
-	err := db.rdb.QueryRow(db.ctx, fmt.Sprintf(`
-	SELECT contract, pk, created_at, updated_at
-	FROM t_sponsors_%s
-	WHERE contract = $1
-	`, db.suffix), contract).Scan(&sponsor.Contract, &sponsor.PrivateKey, &sponsor.CreatedAt, &sponsor.UpdatedAt)
+	err := row.Scan(&sponsor.Contract, &sponsor.PrivateKey, &sponsor.SignerKey, &sponsor.RemoteSigner, &sponsor.RemoteAddress, &sponsor.KeyRotatedAt, &sponsor.SignerRotatedAt, &sponsor.CreatedAt, &sponsor.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 
-	decrypted, err := common.Decrypt(sponsor.PrivateKey, db.secret)
+	sponsor.PrivateKey, err = common.Decrypt(sponsor.PrivateKey, db.secret)
 	if err != nil {
 		return nil, err
 	}
 
-	sponsor.PrivateKey = decrypted
+	if sponsor.SignerKey != "" {
+		sponsor.SignerKey, err = common.Decrypt(sponsor.SignerKey, db.secret)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &sponsor, nil
 }
 
+// encryptKeys encrypts the private key and the signer key of a sponsor, a missing signer key stays empty
+func (db *SponsorDB) encryptKeys(sponsor *relay.Sponsor) (string, string, error) {
+	pk, err := common.Encrypt(sponsor.PrivateKey, db.secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	if sponsor.SignerKey == "" {
+		return pk, "", nil
+	}
+
+	signer, err := common.Encrypt(sponsor.SignerKey, db.secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	return pk, signer, nil
+}
+
+// GetSponsor gets a sponsor from the db by contract
+func (db *SponsorDB) GetSponsor(contract string) (*relay.Sponsor, error) {
+	return db.scanSponsor(db.rdb.QueryRow(db.ctx, fmt.Sprintf(`
+	SELECT `+sponsorColumns+`
+	FROM t_sponsors_%s
+	WHERE contract = $1
+	`, db.suffix), contract))
+}
+
 // AddSponsor adds a sponsor to the db
 func (db *SponsorDB) AddSponsor(sponsor *relay.Sponsor) error {
-	encrypted, err := common.Encrypt(sponsor.PrivateKey, db.secret)
+	pk, signer, err := db.encryptKeys(sponsor)
 	if err != nil {
 		return err
 	}
 
+	// sponsors from older backups don't know when their key was rotated
+	rotatedAt := sponsor.KeyRotatedAt
+	if rotatedAt.IsZero() {
+		rotatedAt = sponsor.CreatedAt
+	}
+
 	_, err = db.db.Exec(db.ctx, fmt.Sprintf(`
-	INSERT INTO t_sponsors_%s(contract, pk, created_at, updated_at)
-	VALUES($1, $2, $3, $4)
-	`, db.suffix), sponsor.Contract, encrypted, sponsor.CreatedAt, sponsor.UpdatedAt)
+	INSERT INTO t_sponsors_%s(contract, pk, signer_pk, remote_signer, remote_address, pk_rotated_at, signer_rotated_at, created_at, updated_at)
+	VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, db.suffix), sponsor.Contract, pk, signer, sponsor.RemoteSigner, sponsor.RemoteAddress, rotatedAt, sponsor.SignerRotatedAt, sponsor.CreatedAt, sponsor.UpdatedAt)
 	if err != nil {
 		return err
 	}
@@ -92,19 +145,105 @@ func (db *SponsorDB) AddSponsor(sponsor *relay.Sponsor) error {
 
 // UpdateSponsor updates a sponsor in the db
 func (db *SponsorDB) UpdateSponsor(sponsor *relay.Sponsor) error {
-	encrypted, err := common.Encrypt(sponsor.PrivateKey, db.secret)
+	pk, signer, err := db.encryptKeys(sponsor)
 	if err != nil {
 		return err
 	}
 
+	rotatedAt := sponsor.KeyRotatedAt
+	if rotatedAt.IsZero() {
+		rotatedAt = sponsor.CreatedAt
+	}
+
 	_, err = db.db.Exec(db.ctx, fmt.Sprintf(`
 	UPDATE t_sponsors_%s
-	SET pk = $1, updated_at = $2
+	SET pk = $1, signer_pk = $2, remote_signer = $3, remote_address = $4, pk_rotated_at = $5, signer_rotated_at = $6, updated_at = $7
+	WHERE contract = $8
+	`, db.suffix), pk, signer, sponsor.RemoteSigner, sponsor.RemoteAddress, rotatedAt, sponsor.SignerRotatedAt, sponsor.UpdatedAt, sponsor.Contract)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RotateSponsorKey replaces the key that submits the bundles of a paymaster, a remote signer is no longer used
+func (db *SponsorDB) RotateSponsorKey(contract, privateKey string, at time.Time) error {
+	return db.setSponsorKey(contract, privateKey, "", "", at)
+}
+
+// SetRemoteSigner makes a remote signer submit the bundles of a paymaster, the private key is removed
+// from the database
+func (db *SponsorDB) SetRemoteSigner(contract, remote, address string, at time.Time) error {
+	return db.setSponsorKey(contract, "", remote, address, at)
+}
+
+func (db *SponsorDB) setSponsorKey(contract, privateKey, remote, address string, at time.Time) error {
+	encrypted, err := common.Encrypt(privateKey, db.secret)
+	if err != nil {
+		return err
+	}
+
+	tag, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	UPDATE t_sponsors_%s
+	SET pk = $1, remote_signer = $2, remote_address = $3, pk_rotated_at = $4, updated_at = $4
+	WHERE contract = $5
+	`, db.suffix), encrypted, remote, address, at, contract)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// RotateSignerKey replaces the key that signs the paymaster data of a paymaster
+func (db *SponsorDB) RotateSignerKey(contract, signerKey string, at time.Time) error {
+	encrypted, err := common.Encrypt(signerKey, db.secret)
+	if err != nil {
+		return err
+	}
+
+	tag, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	UPDATE t_sponsors_%s
+	SET signer_pk = $1, signer_rotated_at = $2, updated_at = $2
 	WHERE contract = $3
-	`, db.suffix), encrypted, sponsor.UpdatedAt, sponsor.Contract)
+	`, db.suffix), encrypted, at, contract)
 	if err != nil {
 		return err
 	}
 
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
 	return nil
 }
+
+// GetSponsors gets all sponsors from the db
+func (db *SponsorDB) GetSponsors() ([]*relay.Sponsor, error) {
+	rows, err := db.rdb.Query(db.ctx, fmt.Sprintf(`
+	SELECT `+sponsorColumns+`
+	FROM t_sponsors_%s
+	ORDER BY created_at ASC
+	`, db.suffix))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sponsors := []*relay.Sponsor{}
+	for rows.Next() {
+		sponsor, err := db.scanSponsor(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		sponsors = append(sponsors, sponsor)
+	}
+
+	return sponsors, nil
+}
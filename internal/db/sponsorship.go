@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/comunifi/relay/internal/faults"
+	"github.com/comunifi/relay/pkg/common"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SponsorshipDB struct {
+	ctx    context.Context
+	suffix string
+	db     *pgxpool.Pool
+	rdb    *pgxpool.Pool
+	faults *faults.Injector
+}
+
+// SponsorshipUsage is what an account was sponsored by a paymaster within a window
+type SponsorshipUsage struct {
+	Ops    int
+	Gas    uint64
+	Oldest *time.Time
+}
+
+// NewSponsorshipDB creates a new DB
+func NewSponsorshipDB(ctx context.Context, db, rdb *pgxpool.Pool, name string) (*SponsorshipDB, error) {
+	return &SponsorshipDB{
+		ctx:    ctx,
+		suffix: name,
+		db:     db,
+		rdb:    rdb,
+	}, nil
+}
+
+// SetFaults sets the injector that randomly fails reservation commits, for testing only
+func (db *SponsorshipDB) SetFaults(f *faults.Injector) {
+	db.faults = f
+}
+
+// CreateSponsorshipsTable creates a table to store the user ops signed by sponsors
+func (db *SponsorshipDB) CreateSponsorshipsTable() error {
+	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS t_sponsorships_%s(
+		id bigserial PRIMARY KEY,
+		paymaster text NOT NULL,
+		sender text NOT NULL,
+		ops integer NOT NULL,
+		gas bigint NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`, db.suffix))
+
+	return err
+}
+
+// CreateSponsorshipsTableIndexes creates the indexes for the sponsorships table
+func (db *SponsorshipDB) CreateSponsorshipsTableIndexes() error {
+	suffix := common.ShortenName(db.suffix, 6)
+
+	_, err := db.db.Exec(db.ctx, fmt.Sprintf(`
+	CREATE INDEX IF NOT EXISTS idx_sponsorships_%s_paymaster_sender_created_at ON t_sponsorships_%s (paymaster, sender, created_at);
+	`, suffix, db.suffix))
+
+	return err
+}
+
+// GetUsage returns what an account was sponsored by a paymaster since a given time
+func (db *SponsorshipDB) GetUsage(paymaster, sender string, since time.Time) (*SponsorshipUsage, error) {
+	return db.usage(db.rdb.QueryRow, paymaster, sender, since)
+}
+
+// Reserve records a sponsorship at a given time if the usage of the account within the window stays within
+// the limits, a limit of 0 is not enforced. The usage before the reservation is returned in any case.
+func (db *SponsorshipDB) Reserve(paymaster, sender string, ops int, gas uint64, at time.Time, window time.Duration, maxOps int, maxGas uint64) (bool, *SponsorshipUsage, error) {
+	tx, err := db.db.Begin(db.ctx)
+	if err != nil {
+		return false, nil, err
+	}
+	defer tx.Rollback(db.ctx)
+
+	// serialize reservations of the same account so that concurrent requests can't exceed the limits
+	_, err = tx.Exec(db.ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", paymaster+":"+sender)
+	if err != nil {
+		return false, nil, err
+	}
+
+	since := at.Add(-window)
+
+	// sponsorships that left the window are no longer needed
+	_, err = tx.Exec(db.ctx, fmt.Sprintf(`
+	DELETE FROM t_sponsorships_%s WHERE paymaster = $1 AND sender = $2 AND created_at <= $3
+	`, db.suffix), paymaster, sender, since)
+	if err != nil {
+		return false, nil, err
+	}
+
+	u, err := db.usage(tx.QueryRow, paymaster, sender, since)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if (maxOps > 0 && u.Ops+ops > maxOps) || (maxGas > 0 && u.Gas+gas > maxGas) {
+		return false, u, nil
+	}
+
+	_, err = tx.Exec(db.ctx, fmt.Sprintf(`
+	INSERT INTO t_sponsorships_%s (paymaster, sender, ops, gas, created_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`, db.suffix), paymaster, sender, ops, int64(gas), at)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if err := db.faults.Fail(faults.DBCommit); err != nil {
+		return false, nil, err
+	}
+
+	return true, u, tx.Commit(db.ctx)
+}
+
+func (db *SponsorshipDB) usage(queryRow func(ctx context.Context, sql string, args ...any) pgx.Row, paymaster, sender string, since time.Time) (*SponsorshipUsage, error) {
+	var u SponsorshipUsage
+	err := queryRow(db.ctx, fmt.Sprintf(`
+	SELECT COALESCE(SUM(ops), 0), COALESCE(SUM(gas), 0), MIN(created_at)
+	FROM t_sponsorships_%s
+	WHERE paymaster = $1 AND sender = $2 AND created_at > $3
+	`, db.suffix), paymaster, sender, since).Scan(&u.Ops, &u.Gas, &u.Oldest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TokenGateDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewTokenGateDB creates a new DB
+func NewTokenGateDB(ctx context.Context, db, rdb *pgxpool.Pool) (*TokenGateDB, error) {
+	return &TokenGateDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateTokenGateLapsesTable creates a table to store since when members of token gated groups
+// don't hold enough tokens
+func (db *TokenGateDB) CreateTokenGateLapsesTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_token_gate_lapses(
+		group_id text NOT NULL,
+		pubkey text NOT NULL,
+		since timestamp NOT NULL DEFAULT current_timestamp,
+		PRIMARY KEY (group_id, pubkey)
+	);
+	`)
+
+	return err
+}
+
+// MarkLapsed records that a member doesn't hold enough tokens anymore and returns since when,
+// the first time it was recorded is kept
+func (db *TokenGateDB) MarkLapsed(groupID, pubkey string, now time.Time) (time.Time, error) {
+	var since time.Time
+	err := db.db.QueryRow(db.ctx, `
+	INSERT INTO t_token_gate_lapses (group_id, pubkey, since)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (group_id, pubkey) DO UPDATE SET since = t_token_gate_lapses.since
+	RETURNING since
+	`, groupID, pubkey, now).Scan(&since)
+
+	return since, err
+}
+
+// ClearLapse forgets a lapse once the member holds enough tokens again or is removed
+func (db *TokenGateDB) ClearLapse(groupID, pubkey string) error {
+	_, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_token_gate_lapses
+	WHERE group_id = $1 AND pubkey = $2
+	`, groupID, pubkey)
+
+	return err
+}
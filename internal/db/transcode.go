@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TranscodeDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewTranscodeDB creates a new DB
+func NewTranscodeDB(ctx context.Context, db, rdb *pgxpool.Pool) (*TranscodeDB, error) {
+	return &TranscodeDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateTranscodesTable creates the table of video transcodes
+func (db *TranscodeDB) CreateTranscodesTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_transcodes(
+		sha256 text PRIMARY KEY,
+		pubkey text NOT NULL,
+		group_id text NOT NULL DEFAULT '',
+		mime text NOT NULL DEFAULT '',
+		status text NOT NULL,
+		output text NOT NULL DEFAULT '',
+		size bigint NOT NULL DEFAULT 0,
+		error text NOT NULL DEFAULT '',
+		created_at timestamp NOT NULL DEFAULT current_timestamp,
+		updated_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`)
+
+	return err
+}
+
+// CreateTranscodesTableIndexes creates the indexes for the transcodes table
+func (db *TranscodeDB) CreateTranscodesTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_transcodes_status ON t_transcodes (status);
+	`)
+
+	return err
+}
+
+const transcodeColumns = `sha256, pubkey, group_id, mime, status, output, size, error, created_at, updated_at`
+
+func scanTranscode(row pgx.Row) (*relay.Transcode, error) {
+	var t relay.Transcode
+	err := row.Scan(&t.SHA256, &t.Pubkey, &t.GroupID, &t.Mime, &t.Status, &t.Output, &t.Size, &t.Error, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// AddTranscode records a pending transcode, false is returned if the blob was already transcoded
+func (db *TranscodeDB) AddTranscode(t *relay.Transcode) (bool, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_transcodes (sha256, pubkey, group_id, mime, status, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $6)
+	ON CONFLICT (sha256) DO NOTHING
+	`, t.SHA256, t.Pubkey, t.GroupID, t.Mime, t.Status, t.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetTranscode returns the transcode of a blob, nil if it has none
+func (db *TranscodeDB) GetTranscode(sha256 string) (*relay.Transcode, error) {
+	t, err := scanTranscode(db.rdb.QueryRow(db.ctx, `
+	SELECT `+transcodeColumns+`
+	FROM t_transcodes
+	WHERE sha256 = $1
+	`, sha256))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	return t, err
+}
+
+// GetPendingTranscodes returns the transcodes that didn't finish, oldest first
+func (db *TranscodeDB) GetPendingTranscodes() ([]*relay.Transcode, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT `+transcodeColumns+`
+	FROM t_transcodes
+	WHERE status = $1
+	ORDER BY created_at
+	`, relay.TranscodeStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transcodes := []*relay.Transcode{}
+	for rows.Next() {
+		t, err := scanTranscode(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		transcodes = append(transcodes, t)
+	}
+
+	return transcodes, rows.Err()
+}
+
+// GetOutputs returns the outputs of the ready transcodes of blobs, by blob
+func (db *TranscodeDB) GetOutputs(shas []string) (map[string]string, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT sha256, output
+	FROM t_transcodes
+	WHERE sha256 = ANY($1) AND status = $2
+	`, shas, relay.TranscodeStatusReady)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	outputs := map[string]string{}
+	for rows.Next() {
+		var sha, output string
+		err := rows.Scan(&sha, &output)
+		if err != nil {
+			return nil, err
+		}
+
+		outputs[sha] = output
+	}
+
+	return outputs, rows.Err()
+}
+
+// SetReady records the output of a transcode
+func (db *TranscodeDB) SetReady(sha256, output string, size int64, at time.Time) error {
+	_, err := db.db.Exec(db.ctx, `
+	UPDATE t_transcodes
+	SET status = $2, output = $3, size = $4, error = '', updated_at = $5
+	WHERE sha256 = $1
+	`, sha256, relay.TranscodeStatusReady, output, size, at)
+
+	return err
+}
+
+// SetFailed records why a transcode failed
+func (db *TranscodeDB) SetFailed(sha256, reason string, at time.Time) error {
+	_, err := db.db.Exec(db.ctx, `
+	UPDATE t_transcodes
+	SET status = $2, error = $3, updated_at = $4
+	WHERE sha256 = $1
+	`, sha256, relay.TranscodeStatusFailed, reason, at)
+
+	return err
+}
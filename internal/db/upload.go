@@ -0,0 +1,307 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type UploadDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewUploadDB creates a new DB
+func NewUploadDB(ctx context.Context, db, rdb *pgxpool.Pool) (*UploadDB, error) {
+	return &UploadDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateUploadsTable creates the tables of uploaded blobs and of flagged uploaders
+func (db *UploadDB) CreateUploadsTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_uploads(
+		id bigserial PRIMARY KEY,
+		sha256 text NOT NULL,
+		pubkey text NOT NULL,
+		group_id text NOT NULL DEFAULT '',
+		size bigint NOT NULL,
+		mime text NOT NULL DEFAULT '',
+		ip_hash text NOT NULL DEFAULT '',
+		created_at timestamp NOT NULL DEFAULT current_timestamp,
+		removed_at timestamp
+	);
+
+	CREATE TABLE IF NOT EXISTS t_upload_flags(
+		pubkey text PRIMARY KEY,
+		uploads integer NOT NULL,
+		bytes bigint NOT NULL,
+		reason text NOT NULL,
+		flagged_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`)
+
+	return err
+}
+
+// MigrateUploadsTable adds columns and indexes introduced after the uploads table was first created
+func (db *UploadDB) MigrateUploadsTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	ALTER TABLE t_uploads ADD COLUMN IF NOT EXISTS removed_at timestamp;
+	CREATE INDEX IF NOT EXISTS idx_uploads_sha256 ON t_uploads (sha256);
+	`)
+
+	return err
+}
+
+// CreateUploadsTableIndexes creates the indexes for the upload tables
+func (db *UploadDB) CreateUploadsTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_uploads_pubkey_created_at ON t_uploads (pubkey, created_at);
+	CREATE INDEX IF NOT EXISTS idx_uploads_group_id ON t_uploads (group_id);
+	CREATE INDEX IF NOT EXISTS idx_uploads_ip_hash ON t_uploads (ip_hash);
+	CREATE INDEX IF NOT EXISTS idx_uploads_created_at ON t_uploads (created_at);
+	`)
+
+	return err
+}
+
+const uploadColumns = `id, sha256, pubkey, group_id, size, mime, ip_hash, created_at`
+
+func scanUpload(row pgx.Row) (*relay.Upload, error) {
+	var u relay.Upload
+	err := row.Scan(&u.ID, &u.SHA256, &u.Pubkey, &u.GroupID, &u.Size, &u.Mime, &u.IPHash, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+// AddUpload records an uploaded blob and sets its id
+func (db *UploadDB) AddUpload(u *relay.Upload) error {
+	return db.db.QueryRow(db.ctx, `
+	INSERT INTO t_uploads (sha256, pubkey, group_id, size, mime, ip_hash, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id
+	`, u.SHA256, u.Pubkey, u.GroupID, u.Size, u.Mime, u.IPHash, u.CreatedAt).Scan(&u.ID)
+}
+
+// GetUploads returns the latest uploads, empty filters match every upload
+func (db *UploadDB) GetUploads(pubkey, groupID, ipHash string, limit int) ([]*relay.Upload, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT `+uploadColumns+`
+	FROM t_uploads
+	WHERE ($1 = '' OR pubkey = $1)
+	AND ($2 = '' OR group_id = $2)
+	AND ($3 = '' OR ip_hash = $3)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $4
+	`, pubkey, groupID, ipHash, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []*relay.Upload{}
+	for rows.Next() {
+		u, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		uploads = append(uploads, u)
+	}
+
+	return uploads, rows.Err()
+}
+
+// GetGroupMedia returns the blobs of a group that are still stored, latest first. A blob uploaded
+// several times is listed once, with its first upload. Only blobs uploaded before the upload with
+// the given id are returned, 0 starts from the latest.
+func (db *UploadDB) GetGroupMedia(groupID string, before int64, limit int) ([]*relay.Upload, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT `+uploadColumns+`
+	FROM t_uploads u
+	WHERE group_id = $1
+	AND removed_at IS NULL
+	AND ($2 = 0 OR id < $2)
+	AND NOT EXISTS (
+		SELECT 1 FROM t_uploads o
+		WHERE o.group_id = u.group_id AND o.sha256 = u.sha256 AND o.removed_at IS NULL AND o.id < u.id
+	)
+	ORDER BY id DESC
+	LIMIT $3
+	`, groupID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []*relay.Upload{}
+	for rows.Next() {
+		u, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		uploads = append(uploads, u)
+	}
+
+	return uploads, rows.Err()
+}
+
+// CountGroupMedia returns how many distinct blobs of a group are still stored
+func (db *UploadDB) CountGroupMedia(groupID string) (int, error) {
+	var count int
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT count(DISTINCT sha256)
+	FROM t_uploads
+	WHERE group_id = $1 AND removed_at IS NULL
+	`, groupID).Scan(&count)
+
+	return count, err
+}
+
+// SetRemoved marks the uploads of a blob as removed from the storage, they stay in the log
+func (db *UploadDB) SetRemoved(sha256 string, at time.Time) error {
+	_, err := db.db.Exec(db.ctx, `
+	UPDATE t_uploads
+	SET removed_at = $2
+	WHERE sha256 = $1 AND removed_at IS NULL
+	`, sha256, at)
+
+	return err
+}
+
+// GetGroupStorage returns how many distinct blobs each group still stores and their size, split
+// between the ones uploaded since a time and the older ones
+func (db *UploadDB) GetGroupStorage(since time.Time) ([]*relay.GroupStorage, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT group_id, count(*), COALESCE(sum(size) FILTER (WHERE created_at >= $1), 0), COALESCE(sum(size) FILTER (WHERE created_at < $1), 0)
+	FROM (
+		SELECT DISTINCT ON (group_id, sha256) group_id, size, created_at
+		FROM t_uploads
+		WHERE removed_at IS NULL
+		ORDER BY group_id, sha256, id
+	) AS blobs
+	GROUP BY group_id
+	ORDER BY group_id
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	storage := []*relay.GroupStorage{}
+	for rows.Next() {
+		var gs relay.GroupStorage
+		err := rows.Scan(&gs.GroupID, &gs.Blobs, &gs.StandardBytes, &gs.ArchivedBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		storage = append(storage, &gs)
+	}
+
+	return storage, rows.Err()
+}
+
+// GetVolume returns how many blobs a pubkey uploaded since a time and their total size
+func (db *UploadDB) GetVolume(pubkey string, since time.Time) (int, int64, error) {
+	var count int
+	var bytes int64
+	err := db.rdb.QueryRow(db.ctx, `
+	SELECT count(*), COALESCE(sum(size), 0)
+	FROM t_uploads
+	WHERE pubkey = $1 AND created_at >= $2
+	`, pubkey, since).Scan(&count, &bytes)
+
+	return count, bytes, err
+}
+
+const uploadFlagColumns = `pubkey, uploads, bytes, reason, flagged_at`
+
+func scanUploadFlag(row pgx.Row) (*relay.UploadFlag, error) {
+	var f relay.UploadFlag
+	err := row.Scan(&f.Pubkey, &f.Uploads, &f.Bytes, &f.Reason, &f.FlaggedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// AddFlag flags a pubkey, a pubkey that is already flagged keeps its flag
+func (db *UploadDB) AddFlag(f *relay.UploadFlag) (bool, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_upload_flags (pubkey, uploads, bytes, reason, flagged_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (pubkey) DO NOTHING
+	`, f.Pubkey, f.Uploads, f.Bytes, f.Reason, f.FlaggedAt)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetFlag returns the flag of a pubkey, nil if it isn't flagged
+func (db *UploadDB) GetFlag(pubkey string) (*relay.UploadFlag, error) {
+	f, err := scanUploadFlag(db.rdb.QueryRow(db.ctx, `
+	SELECT `+uploadFlagColumns+`
+	FROM t_upload_flags
+	WHERE pubkey = $1
+	`, pubkey))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	return f, err
+}
+
+// GetFlags returns the flagged pubkeys, latest first
+func (db *UploadDB) GetFlags(limit int) ([]*relay.UploadFlag, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT `+uploadFlagColumns+`
+	FROM t_upload_flags
+	ORDER BY flagged_at DESC, pubkey
+	LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []*relay.UploadFlag{}
+	for rows.Next() {
+		f, err := scanUploadFlag(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		flags = append(flags, f)
+	}
+
+	return flags, rows.Err()
+}
+
+// RemoveFlag clears the flag of a pubkey, false is returned if it wasn't flagged
+func (db *UploadDB) RemoveFlag(pubkey string) (bool, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_upload_flags
+	WHERE pubkey = $1
+	`, pubkey)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
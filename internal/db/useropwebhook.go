@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type UserOpWebhookDB struct {
+	ctx context.Context
+	db  *pgxpool.Pool
+	rdb *pgxpool.Pool
+}
+
+// NewUserOpWebhookDB creates a new DB
+func NewUserOpWebhookDB(ctx context.Context, db, rdb *pgxpool.Pool) (*UserOpWebhookDB, error) {
+	return &UserOpWebhookDB{
+		ctx: ctx,
+		db:  db,
+		rdb: rdb,
+	}, nil
+}
+
+// CreateUserOpWebhooksTable creates a table to store the webhooks of senders and paymasters, the
+// secret is kept since deliveries are signed with it
+func (db *UserOpWebhookDB) CreateUserOpWebhooksTable() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE TABLE IF NOT EXISTS t_userop_webhooks(
+		id text NOT NULL PRIMARY KEY,
+		address text NOT NULL,
+		url text NOT NULL,
+		secret text NOT NULL,
+		created_at timestamp NOT NULL DEFAULT current_timestamp
+	);
+	`)
+
+	return err
+}
+
+// CreateUserOpWebhooksTableIndexes creates the indexes for the user op webhooks table
+func (db *UserOpWebhookDB) CreateUserOpWebhooksTableIndexes() error {
+	_, err := db.db.Exec(db.ctx, `
+	CREATE INDEX IF NOT EXISTS idx_userop_webhooks_address ON t_userop_webhooks (address);
+	`)
+
+	return err
+}
+
+func scanUserOpWebhook(row pgx.Row) (*relay.UserOpWebhook, error) {
+	var w relay.UserOpWebhook
+	err := row.Scan(&w.ID, &w.Address, &w.URL, &w.Secret, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// AddWebhook stores a webhook with its secret
+func (db *UserOpWebhookDB) AddWebhook(w *relay.UserOpWebhook) error {
+	_, err := db.db.Exec(db.ctx, `
+	INSERT INTO t_userop_webhooks (id, address, url, secret, created_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`, w.ID, w.Address, w.URL, w.Secret, w.CreatedAt)
+
+	return err
+}
+
+// GetWebhooks returns the webhooks of any of the addresses, oldest first
+func (db *UserOpWebhookDB) GetWebhooks(addresses ...string) ([]*relay.UserOpWebhook, error) {
+	rows, err := db.rdb.Query(db.ctx, `
+	SELECT id, address, url, secret, created_at
+	FROM t_userop_webhooks
+	WHERE address = ANY($1)
+	ORDER BY created_at, id
+	`, addresses)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*relay.UserOpWebhook{}
+	for rows.Next() {
+		w, err := scanUserOpWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, w)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// RemoveWebhook removes a webhook of an address, false is returned if it doesn't exist
+func (db *UserOpWebhookDB) RemoveWebhook(address, id string) (bool, error) {
+	tag, err := db.db.Exec(db.ctx, `
+	DELETE FROM t_userop_webhooks
+	WHERE address = $1 AND id = $2
+	`, address, id)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
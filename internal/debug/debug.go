@@ -0,0 +1,148 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	com "github.com/comunifi/relay/pkg/common"
+)
+
+// Stater reports the internal state of a long running service, such as the size of its queue
+type Stater interface {
+	DebugState() any
+}
+
+// Handlers exposes the runtime state of the relay to operators
+type Handlers struct {
+	mu     sync.Mutex
+	states map[string]Stater
+
+	started time.Time
+}
+
+func NewHandlers() *Handlers {
+	return &Handlers{
+		states:  map[string]Stater{},
+		started: time.Now(),
+	}
+}
+
+// Register adds a service to the runtime dump
+func (h *Handlers) Register(name string, s Stater) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.states[name] = s
+}
+
+type memory struct {
+	Alloc      uint64 `json:"alloc"`
+	Sys        uint64 `json:"sys"`
+	HeapInuse  uint64 `json:"heap_inuse"`
+	NumGC      uint32 `json:"num_gc"`
+	PauseTotal uint64 `json:"pause_total_ns"`
+}
+
+type runtimeState struct {
+	Uptime     float64        `json:"uptime"` // seconds
+	Goroutines int            `json:"goroutines"`
+	Memory     memory         `json:"memory"`
+	LogLevel   string         `json:"log_level"`
+	Services   map[string]any `json:"services"`
+	Stacks     string         `json:"stacks,omitempty"`
+}
+
+// Runtime dumps goroutine, memory and service state, ?stacks=true includes the stacks of all goroutines
+func (h *Handlers) Runtime(w http.ResponseWriter, r *http.Request) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	state := runtimeState{
+		Uptime:     time.Since(h.started).Seconds(),
+		Goroutines: runtime.NumGoroutine(),
+		Memory: memory{
+			Alloc:      ms.Alloc,
+			Sys:        ms.Sys,
+			HeapInuse:  ms.HeapInuse,
+			NumGC:      ms.NumGC,
+			PauseTotal: ms.PauseTotalNs,
+		},
+		LogLevel: GetLevel().String(),
+		Services: h.services(),
+	}
+
+	if r.URL.Query().Get("stacks") == "true" {
+		state.Stacks = stacks()
+	}
+
+	err := com.Body(w, state, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (h *Handlers) services() map[string]any {
+	h.mu.Lock()
+	states := make(map[string]Stater, len(h.states))
+	for name, s := range h.states {
+		states[name] = s
+	}
+	h.mu.Unlock()
+
+	services := map[string]any{}
+	for name, s := range states {
+		services[name] = s.DebugState()
+	}
+
+	return services
+}
+
+func stacks() string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return string(buf[:n])
+		}
+
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+type levelRequest struct {
+	Level string `json:"level"`
+}
+
+// GetLevel returns the current log level
+func (h *Handlers) GetLevel(w http.ResponseWriter, r *http.Request) {
+	err := com.Body(w, levelRequest{Level: GetLevel().String()}, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// SetLevel changes the log level without restarting the relay
+func (h *Handlers) SetLevel(w http.ResponseWriter, r *http.Request) {
+	var req levelRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	l, err := ParseLevel(req.Level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	SetLevel(l)
+
+	err = com.Body(w, levelRequest{Level: l.String()}, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
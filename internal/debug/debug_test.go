@@ -0,0 +1,87 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testStater struct{ queued int }
+
+func (s testStater) DebugState() any {
+	return map[string]int{"queued": s.queued}
+}
+
+func TestParseLevel(t *testing.T) {
+	l, err := ParseLevel("DEBUG")
+	if err != nil || l != LevelDebug {
+		t.Fatalf("expected debug, got %s %v", l, err)
+	}
+
+	_, err = ParseLevel("verbose")
+	if err == nil {
+		t.Fatal("expected an unknown level to fail")
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	defer SetLevel(LevelInfo)
+
+	h := NewHandlers()
+
+	rec := httptest.NewRecorder()
+	h.SetLevel(rec, httptest.NewRequest(http.MethodPut, "/debug/log-level", strings.NewReader(`{"level":"debug"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if !Enabled(LevelDebug) {
+		t.Error("expected debug logs to be enabled")
+	}
+
+	rec = httptest.NewRecorder()
+	h.SetLevel(rec, httptest.NewRequest(http.MethodPut, "/debug/log-level", strings.NewReader(`{"level":"loud"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+
+	if GetLevel() != LevelDebug {
+		t.Error("an invalid level should not change the current one")
+	}
+}
+
+func TestRuntime(t *testing.T) {
+	h := NewHandlers()
+	h.Register("userop_queue", testStater{queued: 3})
+
+	rec := httptest.NewRecorder()
+	h.Runtime(rec, httptest.NewRequest(http.MethodGet, "/debug/runtime?stacks=true", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var resp struct {
+		Object struct {
+			Goroutines int                       `json:"goroutines"`
+			Services   map[string]map[string]int `json:"services"`
+			Stacks     string                    `json:"stacks"`
+		} `json:"object"`
+	}
+
+	err := json.Unmarshal(rec.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := resp.Object
+
+	if state.Goroutines == 0 || state.Services["userop_queue"]["queued"] != 3 {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	if !strings.Contains(state.Stacks, "goroutine") {
+		t.Error("expected goroutine stacks")
+	}
+}
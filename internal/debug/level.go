@@ -0,0 +1,67 @@
+package debug
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return l, nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+var level atomic.Int32
+
+func init() {
+	level.Store(int32(LevelInfo))
+}
+
+// SetLevel changes the log level at runtime
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+func GetLevel() Level {
+	return Level(level.Load())
+}
+
+// Enabled returns true if messages of the level are logged
+func Enabled(l Level) bool {
+	return l >= GetLevel()
+}
+
+// Debugf logs verbose output that is only useful while diagnosing a problem
+func Debugf(format string, v ...any) {
+	if !Enabled(LevelDebug) {
+		return
+	}
+
+	log.Default().Printf("[debug] "+format, v...)
+}
@@ -0,0 +1,340 @@
+// Package denylist keeps banned blobs and events off the relay, across all groups, for takedowns
+// of illegal content that can't wait for the admins of every group.
+//
+// A ban is the sha256 of a blob or the id of an event. Banned blobs are rejected when they are
+// uploaded and banned events when they are published, content that was already stored is taken
+// down when it is banned. Operators manage bans under /v1/admin/bans, and with DENYLIST_URL the
+// relay also syncs the bans of a shared denylist, a JSON document:
+//
+//	{"blobs": ["<sha256>", ...], "events": ["<event id>", ...]}
+//
+// Synced bans are replaced on every sync, the bans of operators are kept.
+package denylist
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/internal/blossom"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/eventstore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// largest denylist that is synced
+const maxDenylistSize = 32 << 20
+
+var (
+	ErrInvalidBan = errors.New("a ban must be the sha256 of a blob or the id of an event")
+	ErrNotFound   = errors.New("ban not found")
+)
+
+// Store keeps the bans
+type Store interface {
+	AddBan(b *relay.Ban) error
+	RemoveBan(kind, value string) (bool, error)
+	GetBans() ([]*relay.Ban, error)
+	ReplaceSyncedBans(bans []*relay.Ban) error
+}
+
+// Blobs removes the blobs that are taken down
+type Blobs interface {
+	RemoveBlob(ctx context.Context, sha256 string) error
+}
+
+type Service struct {
+	store  Store
+	events eventstore.Store
+	blobs  Blobs
+	client *http.Client
+	url    string // of the shared denylist, empty doesn't sync
+
+	mu     sync.RWMutex
+	banned map[string]map[string]bool // kind -> value
+
+	now func() time.Time
+}
+
+func NewService(store Store, events eventstore.Store, url string) *Service {
+	return &Service{
+		store:  store,
+		events: events,
+		client: &http.Client{Timeout: 30 * time.Second},
+		url:    url,
+		banned: map[string]map[string]bool{relay.BanKindBlob: {}, relay.BanKindEvent: {}},
+		now:    time.Now,
+	}
+}
+
+// SetBlobs takes banned blobs down once media is enabled
+func (s *Service) SetBlobs(b Blobs) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blobs = b
+}
+
+// Load reads the bans into memory, they are checked on every upload and event
+func (s *Service) Load() error {
+	bans, err := s.store.GetBans()
+	if err != nil {
+		return err
+	}
+
+	banned := map[string]map[string]bool{
+		relay.BanKindBlob:  {},
+		relay.BanKindEvent: {},
+	}
+	for _, b := range bans {
+		if banned[b.Kind] != nil {
+			banned[b.Kind][b.Value] = true
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.banned = banned
+	return nil
+}
+
+// IsBlobBanned tells whether a blob is banned
+func (s *Service) IsBlobBanned(sha256 string) bool {
+	return s.isBanned(relay.BanKindBlob, sha256)
+}
+
+// IsEventBanned tells whether an event is banned
+func (s *Service) IsEventBanned(id string) bool {
+	return s.isBanned(relay.BanKindEvent, id)
+}
+
+func (s *Service) isBanned(kind, value string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.banned[kind][strings.ToLower(value)]
+}
+
+// RejectEvent rejects banned events, it is meant for khatru.Relay.RejectEvent
+func (s *Service) RejectEvent(ctx context.Context, ev *nostr.Event) (bool, string) {
+	if s.IsEventBanned(ev.ID) {
+		return true, "blocked: this event is banned from the relay"
+	}
+
+	return false, ""
+}
+
+// RejectUpload rejects the uploads of banned blobs by the hash their authorization announces, the
+// blob service checks the hash of the content once it is received
+func (s *Service) RejectUpload(ctx context.Context, auth *nostr.Event, size int, ext string) (bool, string, int) {
+	if auth == nil {
+		return false, "", 0
+	}
+
+	for _, tag := range auth.Tags {
+		if len(tag) >= 2 && tag[0] == "x" && s.IsBlobBanned(tag[1]) {
+			return true, "this blob is banned from the relay", http.StatusUnavailableForLegalReasons
+		}
+	}
+
+	return false, "", 0
+}
+
+// add bans a blob or an event for an operator and takes it down
+func (s *Service) add(ctx context.Context, req *relay.BanRequest) (*relay.Ban, error) {
+	value, ok := normalize(req.Kind, req.Value)
+	if !ok {
+		return nil, ErrInvalidBan
+	}
+
+	b := &relay.Ban{
+		Kind:      req.Kind,
+		Value:     value,
+		Reason:    strings.TrimSpace(req.Reason),
+		Source:    relay.BanSourceOperator,
+		CreatedAt: s.now().UTC(),
+	}
+
+	err := s.store.AddBan(b)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.banned[b.Kind][b.Value] = true
+	s.mu.Unlock()
+
+	err = s.takeDown(ctx, b.Kind, b.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// remove lifts a ban, content that was taken down stays removed
+func (s *Service) remove(kind, value string) error {
+	value, ok := normalize(kind, value)
+	if !ok {
+		return ErrInvalidBan
+	}
+
+	removed, err := s.store.RemoveBan(kind, value)
+	if err != nil {
+		return err
+	}
+
+	if !removed {
+		return ErrNotFound
+	}
+
+	return s.Load()
+}
+
+// Sync replaces the synced bans with the shared denylist and takes down the content it newly
+// bans. A denylist that can't be fetched leaves the bans as they are.
+func (s *Service) Sync(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("denylist answered with %d", resp.StatusCode)
+	}
+
+	var list relay.Denylist
+	err = json.NewDecoder(http.MaxBytesReader(nil, resp.Body, maxDenylistSize)).Decode(&list)
+	if err != nil {
+		return fmt.Errorf("invalid denylist: %w", err)
+	}
+
+	now := s.now().UTC()
+	bans := []*relay.Ban{}
+	for kind, values := range map[string][]string{relay.BanKindBlob: list.Blobs, relay.BanKindEvent: list.Events} {
+		for _, v := range values {
+			value, ok := normalize(kind, v)
+			if !ok {
+				log.Default().Printf("skipping invalid %s %q of the denylist", kind, v)
+				continue
+			}
+
+			bans = append(bans, &relay.Ban{Kind: kind, Value: value, Source: relay.BanSourceSync, CreatedAt: now})
+		}
+	}
+
+	err = s.store.ReplaceSyncedBans(bans)
+	if err != nil {
+		return err
+	}
+
+	added := []*relay.Ban{}
+	for _, b := range bans {
+		if !s.isBanned(b.Kind, b.Value) {
+			added = append(added, b)
+		}
+	}
+
+	err = s.Load()
+	if err != nil {
+		return err
+	}
+
+	// the bans are in place, content that can't be taken down now is still refused
+	for _, b := range added {
+		err = s.takeDown(ctx, b.Kind, b.Value)
+		if err != nil {
+			log.Default().Printf("failed to take down %s %s: %v", b.Kind, b.Value, err)
+		}
+	}
+
+	return nil
+}
+
+// Start syncs the shared denylist every interval until the context is done
+func (s *Service) Start(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := s.Sync(ctx)
+		if err != nil {
+			log.Default().Printf("failed to sync the denylist: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// takeDown removes banned content that was stored before it was banned
+func (s *Service) takeDown(ctx context.Context, kind, value string) error {
+	switch kind {
+	case relay.BanKindBlob:
+		s.mu.RLock()
+		blobs := s.blobs
+		s.mu.RUnlock()
+
+		if blobs == nil {
+			return nil
+		}
+
+		// a blob can be banned before anyone uploads it
+		err := blobs.RemoveBlob(ctx, value)
+		if err != nil && !errors.Is(err, blossom.ErrBlobNotFound) {
+			return err
+		}
+	case relay.BanKindEvent:
+		ch, err := s.events.QueryEvents(ctx, nostr.Filter{IDs: []string{value}})
+		if err != nil {
+			return err
+		}
+
+		stored := []*nostr.Event{}
+		for ev := range ch {
+			stored = append(stored, ev)
+		}
+
+		for _, ev := range stored {
+			err = s.events.DeleteEvent(ctx, ev)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// normalize checks that a ban is a 32 byte hex hash and lowercases it
+func normalize(kind, value string) (string, bool) {
+	if kind != relay.BanKindBlob && kind != relay.BanKindEvent {
+		return "", false
+	}
+
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	b, err := hex.DecodeString(value)
+	if err != nil || len(b) != 32 {
+		return "", false
+	}
+
+	return value, true
+}
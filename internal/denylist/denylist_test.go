@@ -0,0 +1,163 @@
+package denylist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/comunifi/relay/internal/blossom"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/eventstore/slicestore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type fakeStore struct {
+	bans []*relay.Ban
+}
+
+func (f *fakeStore) AddBan(b *relay.Ban) error {
+	f.bans = append(f.bans, b)
+	return nil
+}
+
+func (f *fakeStore) RemoveBan(kind, value string) (bool, error) {
+	for i, b := range f.bans {
+		if b.Kind == kind && b.Value == value {
+			f.bans = append(f.bans[:i], f.bans[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *fakeStore) GetBans() ([]*relay.Ban, error) {
+	return f.bans, nil
+}
+
+func (f *fakeStore) ReplaceSyncedBans(bans []*relay.Ban) error {
+	kept := []*relay.Ban{}
+	for _, b := range f.bans {
+		if b.Source != relay.BanSourceSync {
+			kept = append(kept, b)
+		}
+	}
+
+	f.bans = append(kept, bans...)
+	return nil
+}
+
+type fakeBlobs struct {
+	removed []string
+}
+
+func (f *fakeBlobs) RemoveBlob(ctx context.Context, sha256 string) error {
+	if sha256 != strings.Repeat("a", 64) {
+		return fmt.Errorf("%w: %s", blossom.ErrBlobNotFound, sha256)
+	}
+
+	f.removed = append(f.removed, sha256)
+	return nil
+}
+
+func TestAdd(t *testing.T) {
+	events := &slicestore.SliceStore{}
+	events.Init()
+
+	ctx := context.Background()
+	banned := &nostr.Event{ID: strings.Repeat("e", 64), Kind: nostr.KindTextNote, CreatedAt: nostr.Now()}
+	events.SaveEvent(ctx, banned)
+
+	blobs := &fakeBlobs{}
+	s := NewService(&fakeStore{}, events, "")
+	s.SetBlobs(blobs)
+
+	_, err := s.add(ctx, &relay.BanRequest{Kind: relay.BanKindBlob, Value: "0x1234"})
+	if !errors.Is(err, ErrInvalidBan) {
+		t.Fatalf("expected an invalid ban, got %v", err)
+	}
+
+	// stored content is taken down, a blob nobody uploaded is only banned
+	for _, req := range []*relay.BanRequest{
+		{Kind: relay.BanKindEvent, Value: strings.ToUpper(banned.ID)},
+		{Kind: relay.BanKindBlob, Value: strings.Repeat("a", 64)},
+		{Kind: relay.BanKindBlob, Value: strings.Repeat("b", 64)},
+	} {
+		_, err = s.add(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, _ := events.CountEvents(ctx, nostr.Filter{})
+	if n != 0 {
+		t.Fatal("expected the banned event to be deleted")
+	}
+
+	if len(blobs.removed) != 1 {
+		t.Fatalf("expected the stored blob to be removed, got %v", blobs.removed)
+	}
+
+	reject, _ := s.RejectEvent(ctx, banned)
+	if !reject {
+		t.Fatal("expected the banned event to be rejected")
+	}
+
+	auth := &nostr.Event{Tags: nostr.Tags{{"t", "upload"}, {"x", strings.Repeat("b", 64)}}}
+	reject, _, status := s.RejectUpload(ctx, auth, 10, "png")
+	if !reject || status != http.StatusUnavailableForLegalReasons {
+		t.Fatalf("expected the banned blob to be rejected, got %v %d", reject, status)
+	}
+
+	err = s.remove(relay.BanKindBlob, strings.Repeat("b", 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.IsBlobBanned(strings.Repeat("b", 64)) {
+		t.Fatal("expected the ban to be lifted")
+	}
+}
+
+func TestSync(t *testing.T) {
+	list := fmt.Sprintf(`{"blobs": ["%s", "invalid"], "events": ["%s"]}`, strings.Repeat("a", 64), strings.Repeat("c", 64))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(list))
+	}))
+	defer srv.Close()
+
+	events := &slicestore.SliceStore{}
+	events.Init()
+
+	store := &fakeStore{bans: []*relay.Ban{
+		{Kind: relay.BanKindEvent, Value: strings.Repeat("d", 64), Source: relay.BanSourceOperator},
+		{Kind: relay.BanKindEvent, Value: strings.Repeat("e", 64), Source: relay.BanSourceSync},
+	}}
+
+	blobs := &fakeBlobs{}
+	s := NewService(store, events, srv.URL)
+	s.SetBlobs(blobs)
+
+	err := s.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.IsBlobBanned(strings.Repeat("a", 64)) || !s.IsEventBanned(strings.Repeat("c", 64)) {
+		t.Fatal("expected the bans of the denylist")
+	}
+
+	// the bans of operators are kept, synced bans no longer listed are lifted
+	if !s.IsEventBanned(strings.Repeat("d", 64)) || s.IsEventBanned(strings.Repeat("e", 64)) {
+		t.Fatal("expected only the synced bans to be replaced")
+	}
+
+	if len(blobs.removed) != 1 {
+		t.Fatalf("expected the newly banned blob to be taken down, got %v", blobs.removed)
+	}
+}
@@ -0,0 +1,103 @@
+package denylist
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/go-chi/chi/v5"
+)
+
+// Get godoc
+//
+//	@Summary		List the bans
+//	@Description	blobs and events banned from the relay, by operators and synced from the shared denylist
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	common.Response
+//	@Failure		401
+//	@Failure		500
+//	@Router			/v1/admin/bans [get]
+func (s *Service) Get(w http.ResponseWriter, r *http.Request) {
+	bans, err := s.store.GetBans()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.BodyMultiple(w, bans, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Add godoc
+//
+//	@Summary		Ban a blob or an event
+//	@Description	the blob or event is rejected from now on and taken down if it was stored
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			ban	body		relay.BanRequest	true	"Ban"
+//	@Success		200	{object}	common.Response
+//	@Failure		400
+//	@Failure		401
+//	@Failure		500
+//	@Router			/v1/admin/bans [post]
+func (s *Service) Add(w http.ResponseWriter, r *http.Request) {
+	var req relay.BanRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	b, err := s.add(r.Context(), &req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidBan) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, b, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Remove godoc
+//
+//	@Summary		Lift a ban
+//	@Description	content that was taken down stays removed, a synced ban comes back on the next sync
+//	@Tags			admin
+//	@Param			kind	path	string	true	"blob or event"
+//	@Param			value	path	string	true	"Blob sha256 or event id"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		404
+//	@Failure		500
+//	@Router			/v1/admin/bans/{kind}/{value} [delete]
+func (s *Service) Remove(w http.ResponseWriter, r *http.Request) {
+	err := s.remove(chi.URLParam(r, "kind"), chi.URLParam(r, "value"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidBan):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,213 @@
+package dev
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/fiatjaf/eventstore"
+	"github.com/jackc/pgx/v5"
+	gonostr "github.com/nbd-wtf/go-nostr"
+)
+
+// chain id used by anvil and hardhat
+const LocalChainID = 31337
+
+const demoTransferSignature = "Transfer(address indexed from, address indexed to, uint256 value)"
+
+var (
+	ErrNotLocalChain = errors.New("dev mode requires a local chain (chain id 31337)")
+
+	// 1000 native tokens
+	sponsorBalance = new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18))
+)
+
+type Config struct {
+	Paymaster string // paymaster contract the sponsor is created for
+	Token     string // erc20 contract whose transfers are indexed
+	GroupID   string
+	GroupName string
+}
+
+type Service struct {
+	ctx     context.Context
+	chainID *big.Int
+
+	secretKey string
+
+	evm relay.EVMRequester
+	db  *db.DB
+	ndb eventstore.Store
+	g   *groups.GroupsService
+}
+
+func NewService(ctx context.Context, chainID *big.Int, secretKey string, evm relay.EVMRequester, db *db.DB, ndb eventstore.Store, g *groups.GroupsService) *Service {
+	return &Service{
+		ctx:       ctx,
+		chainID:   chainID,
+		secretKey: secretKey,
+		evm:       evm,
+		db:        db,
+		ndb:       ndb,
+		g:         g,
+	}
+}
+
+// IsLocalChain returns true if the chain id is the one of a local anvil/hardhat node
+func IsLocalChain(chainID *big.Int) bool {
+	return chainID != nil && chainID.Int64() == LocalChainID
+}
+
+// Seed prepares a local chain for development, every step is skipped when already done
+func (s *Service) Seed(conf Config) error {
+	if !IsLocalChain(s.chainID) {
+		return ErrNotLocalChain
+	}
+
+	err := s.seedSponsor(common.ChecksumAddress(conf.Paymaster))
+	if err != nil {
+		return fmt.Errorf("failed to seed sponsor: %w", err)
+	}
+
+	err = s.seedEvent(common.ChecksumAddress(conf.Token), conf.GroupID)
+	if err != nil {
+		return fmt.Errorf("failed to seed event: %w", err)
+	}
+
+	err = s.seedGroup(conf.GroupID, conf.GroupName)
+	if err != nil {
+		return fmt.Errorf("failed to seed group: %w", err)
+	}
+
+	return nil
+}
+
+// seedSponsor creates a sponsor key for the paymaster and funds it
+func (s *Service) seedSponsor(paymaster string) error {
+	sponsor, err := s.db.SponsorDB.GetSponsor(paymaster)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	if sponsor == nil {
+		pk, _, err := relay.GenerateHexPrivateKey()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		sponsor = &relay.Sponsor{
+			Contract:   paymaster,
+			PrivateKey: pk,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+
+		err = s.db.SponsorDB.AddSponsor(sponsor)
+		if err != nil {
+			return err
+		}
+	}
+
+	key, err := common.HexToPrivateKey(sponsor.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	addr := crypto.PubkeyToAddress(key.PublicKey).Hex()
+
+	err = s.fund(addr)
+	if err != nil {
+		return err
+	}
+
+	log.Default().Printf("dev: sponsor %s funded for paymaster %s\n", addr, paymaster)
+
+	return nil
+}
+
+// fund sets the balance of an address using the anvil or hardhat cheat codes
+func (s *Service) fund(addr string) error {
+	params, err := json.Marshal([]string{addr, hexutil.EncodeBig(sponsorBalance)})
+	if err != nil {
+		return err
+	}
+
+	err = s.evm.Call("anvil_setBalance", nil, params)
+	if err == nil {
+		return nil
+	}
+
+	return s.evm.Call("hardhat_setBalance", nil, params)
+}
+
+// seedEvent registers the erc20 transfer event of the demo token
+func (s *Service) seedEvent(token, groupID string) error {
+	_, err := s.db.EventDB.GetEvent(s.chainID.String(), token, nostreth.TopicERC20Transfer)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	err = s.db.EventDB.AddEvent(s.chainID.String(), token, nostreth.TopicERC20Transfer, "demo", demoTransferSignature, "Transfer", groupID)
+	if err != nil {
+		return err
+	}
+
+	log.Default().Printf("dev: indexing transfers of %s\n", token)
+
+	return nil
+}
+
+// seedGroup creates the demo group on behalf of the relay
+func (s *Service) seedGroup(groupID, name string) error {
+	exists, err := s.g.GroupExists(s.ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	ev := &gonostr.Event{
+		Kind:      groups.KindCreateGroup,
+		CreatedAt: gonostr.Now(),
+		Tags: gonostr.Tags{
+			{"h", groupID},
+			{"name", name},
+		},
+	}
+
+	// stored directly since the relay hooks are not registered yet
+	err = ev.Sign(s.secretKey)
+	if err != nil {
+		return err
+	}
+
+	err = s.ndb.SaveEvent(s.ctx, ev)
+	if err != nil {
+		return err
+	}
+
+	// generate the metadata, admins and members lists
+	s.g.OnEventSaved(s.ctx, ev)
+
+	log.Default().Printf("dev: created group %s\n", groupID)
+
+	return nil
+}
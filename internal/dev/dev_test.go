@@ -0,0 +1,31 @@
+package dev
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestIsLocalChain(t *testing.T) {
+	if !IsLocalChain(big.NewInt(LocalChainID)) {
+		t.Fatal("expected anvil/hardhat chain id to be local")
+	}
+
+	if IsLocalChain(big.NewInt(100)) {
+		t.Fatal("expected gnosis chain id not to be local")
+	}
+
+	if IsLocalChain(nil) {
+		t.Fatal("expected nil chain id not to be local")
+	}
+}
+
+func TestSeedRequiresLocalChain(t *testing.T) {
+	s := NewService(context.Background(), big.NewInt(1), "", nil, nil, nil, nil)
+
+	err := s.Seed(Config{})
+	if !errors.Is(err, ErrNotLocalChain) {
+		t.Fatalf("expected ErrNotLocalChain, got %v", err)
+	}
+}
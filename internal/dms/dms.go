@@ -0,0 +1,270 @@
+// Package dms holds NIP-17 private direct messages to the policy of the relay.
+//
+// A direct message is a kind 14 chat message sealed in a kind 1059 gift wrap, a chat message sent
+// as is would be stored in plaintext for anyone to read so it is rejected. Gift wraps are only
+// accepted between accounts of the relay: the sender and every recipient (p tag) must be pubkeys
+// linked to an account. A gift wrap is signed by a throwaway key, so its sender is the client
+// that authenticated the connection (NIP-42).
+//
+// Direct messages are deleted once they are older than DM_TTL, they are never counted nor
+// returned by searches, and they are exempt from moderation scanning by design: whatever scans
+// the content of events skips them with IsDirectMessage.
+package dms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/eventstore"
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	KindChatMessage = 14
+	KindGiftWrap    = 1059
+)
+
+// Kinds are the kinds of direct messages
+var Kinds = []int{KindChatMessage, KindGiftWrap}
+
+const (
+	// how often expired direct messages are deleted
+	sweepInterval = time.Hour
+
+	// most direct messages deleted by a query
+	sweepBatch = 500
+)
+
+// Links returns the account a pubkey is linked to
+type Links interface {
+	GetLink(pubkey string) (*relay.AccountLink, error)
+}
+
+// IsDirectMessage tells whether an event is a direct message, which moderation never scans
+func IsDirectMessage(ev *nostr.Event) bool {
+	return slices.Contains(Kinds, ev.Kind)
+}
+
+type Service struct {
+	store  eventstore.Store
+	links  Links
+	ttl    time.Duration
+	now    func() time.Time
+	authed func(ctx context.Context) string
+}
+
+func NewService(store eventstore.Store, links Links, ttl time.Duration) *Service {
+	return &Service{
+		store:  store,
+		links:  links,
+		ttl:    ttl,
+		now:    time.Now,
+		authed: khatru.GetAuthed,
+	}
+}
+
+// AddHooks holds direct messages to the policy, it is meant to be added whichever hooks are
+// enabled so that direct messages can't be stored or counted by disabling one
+func (s *Service) AddHooks(relay *khatru.Relay) {
+	relay.RejectEvent = append(relay.RejectEvent, s.RejectEvent)
+	relay.RejectFilter = append(relay.RejectFilter, s.RejectFilter)
+	for i, query := range relay.QueryEvents {
+		relay.QueryEvents[i] = s.HideFromSearch(query)
+	}
+	for i, count := range relay.CountEvents {
+		relay.CountEvents[i] = s.HideFromCount(count)
+	}
+}
+
+// RejectEvent only accepts direct messages between linked accounts
+func (s *Service) RejectEvent(ctx context.Context, ev *nostr.Event) (bool, string) {
+	if !IsDirectMessage(ev) || khatru.IsInternalCall(ctx) {
+		return false, ""
+	}
+
+	if ev.Kind == KindChatMessage {
+		return true, "invalid: direct messages must be gift wrapped"
+	}
+
+	if ev.CreatedAt.Time().Before(s.now().Add(-s.ttl)) {
+		return true, "invalid: direct message is already expired"
+	}
+
+	// h tags would make it a group event, moderated by the groups hook
+	if ev.Tags.Find("h") != nil {
+		return true, "invalid: direct messages can't be sent to a group"
+	}
+
+	recipients := []string{}
+	for _, tag := range ev.Tags {
+		if len(tag) >= 2 && tag[0] == "p" {
+			recipients = append(recipients, tag[1])
+		}
+	}
+
+	if len(recipients) == 0 {
+		return true, "invalid: direct message must have a recipient"
+	}
+
+	sender := s.authed(ctx)
+	if sender == "" {
+		return true, "auth-required: direct messages can only be sent by linked accounts"
+	}
+
+	for _, pubkey := range append([]string{sender}, recipients...) {
+		link, err := s.links.GetLink(pubkey)
+		if err != nil {
+			log.Default().Printf("failed to get the link of %s: %v", pubkey, err)
+			return true, "error: failed to check the accounts of the direct message"
+		}
+
+		if link == nil {
+			return true, fmt.Sprintf("restricted: %s is not linked to an account of this relay", pubkey)
+		}
+	}
+
+	return false, ""
+}
+
+// RejectFilter rejects searches for direct messages
+func (s *Service) RejectFilter(ctx context.Context, filter nostr.Filter) (bool, string) {
+	if filter.Search == "" || !matchesKind(filter) || len(filter.Kinds) == 0 {
+		return false, ""
+	}
+
+	return true, "restricted: direct messages can't be searched"
+}
+
+// HideFromSearch wraps a query of the relay so that searches never return direct messages
+func (s *Service) HideFromSearch(query func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error)) func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+	return func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+		ch, err := query(ctx, filter)
+		if err != nil || filter.Search == "" || !matchesKind(filter) {
+			return ch, err
+		}
+
+		out := make(chan *nostr.Event)
+		go func() {
+			defer close(out)
+
+			for ev := range ch {
+				if IsDirectMessage(ev) {
+					continue
+				}
+
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		return out, nil
+	}
+}
+
+// HideFromCount wraps a count of the relay so that direct messages are never counted
+func (s *Service) HideFromCount(count func(ctx context.Context, filter nostr.Filter) (int64, error)) func(ctx context.Context, filter nostr.Filter) (int64, error) {
+	return func(ctx context.Context, filter nostr.Filter) (int64, error) {
+		if !matchesKind(filter) {
+			return count(ctx, filter)
+		}
+
+		// the other kinds of the filter are counted as asked
+		if len(filter.Kinds) > 0 {
+			filter.Kinds = slices.DeleteFunc(slices.Clone(filter.Kinds), func(kind int) bool {
+				return slices.Contains(Kinds, kind)
+			})
+			if len(filter.Kinds) == 0 {
+				return 0, nil
+			}
+
+			return count(ctx, filter)
+		}
+
+		// a filter of any kind counts direct messages too, they are taken out
+		n, err := count(ctx, filter)
+		if err != nil {
+			return 0, err
+		}
+
+		filter.Kinds = Kinds
+		dms, err := count(ctx, filter)
+		if err != nil {
+			return 0, err
+		}
+
+		return max(n-dms, 0), nil
+	}
+}
+
+// Start deletes the expired direct messages every sweepInterval until the context is done
+func (s *Service) Start(ctx context.Context) error {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		err := s.Expire(ctx)
+		if err != nil {
+			log.Default().Printf("failed to expire direct messages: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Expire deletes the direct messages that are older than the ttl
+func (s *Service) Expire(ctx context.Context) error {
+	until := nostr.Timestamp(s.now().Add(-s.ttl).Unix())
+
+	for {
+		ch, err := s.store.QueryEvents(ctx, nostr.Filter{
+			Kinds: Kinds,
+			Until: &until,
+			Limit: sweepBatch,
+		})
+		if err != nil {
+			return err
+		}
+
+		expired := []*nostr.Event{}
+		for ev := range ch {
+			expired = append(expired, ev)
+		}
+
+		for _, ev := range expired {
+			err := s.store.DeleteEvent(ctx, ev)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(expired) < sweepBatch {
+			return nil
+		}
+	}
+}
+
+func matchesKind(filter nostr.Filter) bool {
+	if len(filter.Kinds) == 0 {
+		return true
+	}
+
+	for _, kind := range filter.Kinds {
+		if slices.Contains(Kinds, kind) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package dms
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/eventstore/slicestore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type fakeLinks map[string]string
+
+func (l fakeLinks) GetLink(pubkey string) (*relay.AccountLink, error) {
+	account, ok := l[pubkey]
+	if !ok {
+		return nil, nil
+	}
+
+	return &relay.AccountLink{Pubkey: pubkey, Account: account}, nil
+}
+
+func TestRejectEvent(t *testing.T) {
+	alice := strings.Repeat("a", 64)
+	bob := strings.Repeat("b", 64)
+	carol := strings.Repeat("c", 64)
+
+	s := NewService(&slicestore.SliceStore{}, fakeLinks{alice: "0x1", bob: "0x2"}, 48*time.Hour)
+	now := nostr.Now()
+
+	// the sender of a gift wrap is the authenticated client, not the throwaway key
+	throwaway := strings.Repeat("f", 64)
+
+	cases := []struct {
+		name   string
+		authed string
+		ev     *nostr.Event
+		reject bool
+	}{
+		{"linked", alice, &nostr.Event{Kind: KindGiftWrap, PubKey: throwaway, CreatedAt: now, Tags: nostr.Tags{{"p", bob}}}, false},
+		{"unlinked recipient", alice, &nostr.Event{Kind: KindGiftWrap, PubKey: throwaway, CreatedAt: now, Tags: nostr.Tags{{"p", bob}, {"p", carol}}}, true},
+		{"unlinked sender", carol, &nostr.Event{Kind: KindGiftWrap, PubKey: throwaway, CreatedAt: now, Tags: nostr.Tags{{"p", bob}}}, true},
+		{"no recipient", alice, &nostr.Event{Kind: KindGiftWrap, PubKey: throwaway, CreatedAt: now}, true},
+		{"group", alice, &nostr.Event{Kind: KindGiftWrap, PubKey: throwaway, CreatedAt: now, Tags: nostr.Tags{{"p", bob}, {"h", "demo"}}}, true},
+		{"expired", alice, &nostr.Event{Kind: KindGiftWrap, PubKey: throwaway, CreatedAt: now - 3*24*60*60, Tags: nostr.Tags{{"p", bob}}}, true},
+		{"without auth", "", &nostr.Event{Kind: KindGiftWrap, PubKey: throwaway, CreatedAt: now, Tags: nostr.Tags{{"p", bob}}}, true},
+		// a chat message that isn't wrapped would be readable by anyone
+		{"unwrapped", alice, &nostr.Event{Kind: KindChatMessage, PubKey: alice, CreatedAt: now, Tags: nostr.Tags{{"p", bob}}}, true},
+		{"other kind", "", &nostr.Event{Kind: nostr.KindTextNote, PubKey: carol, CreatedAt: now}, false},
+	}
+
+	for _, c := range cases {
+		s.authed = func(context.Context) string { return c.authed }
+
+		reject, msg := s.RejectEvent(context.Background(), c.ev)
+		if reject != c.reject {
+			t.Errorf("%s: expected reject %v, got %v %q", c.name, c.reject, reject, msg)
+		}
+	}
+}
+
+func TestHideFromCount(t *testing.T) {
+	store := &slicestore.SliceStore{}
+	store.Init()
+
+	ctx := context.Background()
+	for i, kind := range []int{nostr.KindTextNote, KindChatMessage, KindGiftWrap} {
+		store.SaveEvent(ctx, &nostr.Event{ID: strings.Repeat(string(rune('a'+i)), 64), Kind: kind, CreatedAt: nostr.Now()})
+	}
+
+	s := NewService(store, fakeLinks{}, 48*time.Hour)
+	count := s.HideFromCount(store.CountEvents)
+
+	cases := []struct {
+		kinds []int
+		want  int64
+	}{
+		{nil, 1},
+		{[]int{KindGiftWrap}, 0},
+		{[]int{nostr.KindTextNote, KindChatMessage}, 1},
+	}
+
+	for _, c := range cases {
+		n, err := count(ctx, nostr.Filter{Kinds: c.kinds})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n != c.want {
+			t.Errorf("%v: expected %d, got %d", c.kinds, c.want, n)
+		}
+	}
+}
+
+func TestExpire(t *testing.T) {
+	store := &slicestore.SliceStore{}
+	store.Init()
+
+	ctx := context.Background()
+	now := time.Now()
+	old := nostr.Timestamp(now.Add(-72 * time.Hour).Unix())
+
+	store.SaveEvent(ctx, &nostr.Event{ID: strings.Repeat("a", 64), Kind: KindGiftWrap, CreatedAt: old})
+	store.SaveEvent(ctx, &nostr.Event{ID: strings.Repeat("b", 64), Kind: KindGiftWrap, CreatedAt: nostr.Now()})
+	store.SaveEvent(ctx, &nostr.Event{ID: strings.Repeat("c", 64), Kind: nostr.KindTextNote, CreatedAt: old})
+
+	s := NewService(store, fakeLinks{}, 48*time.Hour)
+	err := s.Expire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := store.CountEvents(ctx, nostr.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the old direct message is deleted
+	if n != 2 {
+		t.Fatalf("expected 2 events left, got %d", n)
+	}
+
+	n, _ = store.CountEvents(ctx, nostr.Filter{Kinds: Kinds})
+	if n != 1 {
+		t.Fatalf("expected the recent direct message to be kept, got %d", n)
+	}
+}
@@ -0,0 +1,78 @@
+// Package doctor runs the checks of the relay's self-test and prints a pass/fail report.
+//
+// Checks run in order, a check that depends on an earlier one that failed skips itself with the
+// reason instead of failing again.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// how long a single check can take
+const checkTimeout = 15 * time.Second
+
+// Check is a single step of the self-test
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return e.reason
+}
+
+// Skip is returned by a check that can't run, usually because a check it depends on failed
+func Skip(reason string) error {
+	return &skipError{reason}
+}
+
+// Report counts the outcomes of the checks
+type Report struct {
+	Passed  int
+	Failed  int
+	Skipped int
+}
+
+// OK reports whether every check that ran passed
+func (r Report) OK() bool {
+	return r.Failed == 0
+}
+
+// Run runs the checks in order and writes a line per check, then a summary
+func Run(ctx context.Context, checks []Check, w io.Writer) Report {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	var r Report
+	for _, c := range checks {
+		cctx, cancel := context.WithTimeout(ctx, checkTimeout)
+		err := c.Run(cctx)
+		cancel()
+
+		var skip *skipError
+		switch {
+		case err == nil:
+			r.Passed++
+			fmt.Fprintf(tw, "PASS\t%s\t\n", c.Name)
+		case errors.As(err, &skip):
+			r.Skipped++
+			fmt.Fprintf(tw, "SKIP\t%s\t%s\n", c.Name, skip.reason)
+		default:
+			r.Failed++
+			fmt.Fprintf(tw, "FAIL\t%s\t%s\n", c.Name, err)
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\n%d passed, %d failed, %d skipped\n", r.Passed, r.Failed, r.Skipped)
+
+	return r
+}
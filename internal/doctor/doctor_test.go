@@ -0,0 +1,37 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	var db error = errors.New("connection refused")
+
+	checks := []Check{
+		{"config", func(ctx context.Context) error { return nil }},
+		{"postgres", func(ctx context.Context) error { return db }},
+		{"schema", func(ctx context.Context) error {
+			if db != nil {
+				return Skip("postgres is unreachable")
+			}
+			return nil
+		}},
+	}
+
+	var b strings.Builder
+	r := Run(context.Background(), checks, &b)
+
+	if r.OK() || r.Passed != 1 || r.Failed != 1 || r.Skipped != 1 {
+		t.Fatalf("unexpected report %+v", r)
+	}
+
+	out := b.String()
+	for _, want := range []string{"PASS  config", "FAIL  postgres  connection refused", "SKIP  schema    postgres is unreachable", "1 passed, 1 failed, 1 skipped"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in\n%s", want, out)
+		}
+	}
+}
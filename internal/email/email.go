@@ -0,0 +1,196 @@
+// Package email lets members who don't use a nostr client post into a group by email.
+//
+// Mail sent to <group id>@<EMAIL_DOMAIN> is received by an inbound email provider and forwarded
+// to POST /v1/email/inbound as a form, using the fields of the Mailgun routes format:
+//
+//	recipient      the address the mail was sent to
+//	sender         the envelope sender
+//	subject        the subject of the mail
+//	body-plain     the text body
+//	stripped-text  the text body without quoted replies and signatures, preferred when present
+//	timestamp      unix time at which the provider signed the request
+//	token          random string signed by the provider
+//	signature      hex hmac-sha256 of timestamp+token with EMAIL_SIGNING_KEY
+//
+// Only senders added to the allowlist of the group by an admin can post, each of them is mapped to
+// a member pubkey. The post is signed by the relay and tags the member it was sent for.
+package email
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// how far the timestamp of a forwarded mail can be from now
+	inboundMaxAge = 5 * time.Minute
+
+	// largest form the provider can forward, attachments are dropped
+	maxInboundSize = 1 << 20
+
+	// longest post created from a mail, longer bodies are cut
+	maxContentLength = 16 * 1024
+
+	// kind of the posts created from mails, a threaded discussion with the subject as title
+	kindPost = 11
+)
+
+var (
+	ErrInvalidInboundSignature = errors.New("invalid inbound signature")
+	ErrUnknownRecipient        = errors.New("recipient is not a group address")
+	ErrSenderNotAllowed        = errors.New("sender is not allowed to post into the group")
+	ErrEmptyMessage            = errors.New("message is empty")
+)
+
+// Groups decides who administers a group and who is a member of it
+type Groups interface {
+	IsAdmin(ctx context.Context, pubkey, groupID string) (bool, error)
+	IsMember(ctx context.Context, pubkey, groupID string) (bool, error)
+}
+
+// Publisher signs and stores events authored by the relay
+type Publisher interface {
+	SignAndSaveEvent(ctx context.Context, ev *nostr.Event) (*nostr.Event, error)
+}
+
+type Service struct {
+	db         *db.DB
+	groups     Groups
+	n          Publisher
+	domain     string
+	signingKey string
+
+	now func() time.Time
+}
+
+func NewService(d *db.DB, g Groups, n Publisher, domain, signingKey string) *Service {
+	return &Service{
+		db:         d,
+		groups:     g,
+		n:          n,
+		domain:     strings.ToLower(domain),
+		signingKey: signingKey,
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Message is a mail forwarded by the inbound email provider
+type Message struct {
+	Recipient string
+	Sender    string
+	Subject   string
+	Body      string
+}
+
+// verify checks that the form was signed by the provider with the signing key and is recent
+func (s *Service) verify(timestamp, token, signature string) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidInboundSignature
+	}
+
+	age := s.now().Sub(time.Unix(ts, 0))
+	if age > inboundMaxAge || age < -inboundMaxAge {
+		return ErrInvalidInboundSignature
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidInboundSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.signingKey))
+	mac.Write([]byte(timestamp + token))
+
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ErrInvalidInboundSignature
+	}
+
+	return nil
+}
+
+// groupID returns the group of the first recipient at the email domain of the relay
+func (s *Service) groupID(recipients string) (string, error) {
+	addrs, err := mail.ParseAddressList(recipients)
+	if err != nil {
+		return "", ErrUnknownRecipient
+	}
+
+	for _, addr := range addrs {
+		local, domain, ok := strings.Cut(addr.Address, "@")
+		if !ok || strings.ToLower(domain) != s.domain || local == "" {
+			continue
+		}
+
+		return local, nil
+	}
+
+	return "", ErrUnknownRecipient
+}
+
+// Post creates a group post signed by the relay for the member the sender of the mail is mapped to
+func (s *Service) Post(ctx context.Context, m *Message) (*nostr.Event, error) {
+	groupID, err := s.groupID(m.Recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := mail.ParseAddress(m.Sender)
+	if err != nil {
+		return nil, ErrSenderNotAllowed
+	}
+
+	sender, err := s.db.EmailSenderDB.GetSender(groupID, strings.ToLower(from.Address))
+	if err != nil {
+		return nil, err
+	}
+
+	if sender == nil {
+		return nil, ErrSenderNotAllowed
+	}
+
+	// the mapping outlives the membership, a removed member can't keep posting by email
+	isMember, err := s.groups.IsMember(ctx, sender.Pubkey, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isMember {
+		return nil, ErrSenderNotAllowed
+	}
+
+	content := strings.TrimSpace(m.Body)
+	if content == "" {
+		return nil, ErrEmptyMessage
+	}
+
+	if len(content) > maxContentLength {
+		content = strings.ToValidUTF8(content[:maxContentLength], "")
+	}
+
+	ev := &nostr.Event{
+		Kind:      kindPost,
+		CreatedAt: nostr.Timestamp(s.now().Unix()),
+		Tags: nostr.Tags{
+			{"h", groupID},
+			{"p", sender.Pubkey},
+		},
+		Content: content,
+	}
+
+	if subject := strings.TrimSpace(m.Subject); subject != "" {
+		ev.Tags = append(ev.Tags, nostr.Tag{"title", subject})
+	}
+
+	return s.n.SignAndSaveEvent(ctx, ev)
+}
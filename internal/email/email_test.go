@@ -0,0 +1,257 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const testSigningKey = "signing-key"
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+type testKey struct {
+	sk string
+	pk string
+}
+
+func newTestKey(t *testing.T) testKey {
+	t.Helper()
+
+	sk := nostr.GeneratePrivateKey()
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testKey{sk: sk, pk: pk}
+}
+
+func newTestService(t *testing.T, g *testutil.FakeGroups, p *testutil.FakeStore) *Service {
+	t.Helper()
+
+	return NewService(testutil.NewDB(t), g, p, "Mail.Example.com", testSigningKey)
+}
+
+func sign(timestamp, token string) string {
+	mac := hmac.New(sha256.New, []byte(testSigningKey))
+	mac.Write([]byte(timestamp + token))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// inbound forwards a mail to the handler the way the provider does
+func inbound(s *Service, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/v1/email/inbound", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	s.Receive(w, r)
+
+	return w
+}
+
+func signedForm(recipient, sender, subject, body string) url.Values {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	return url.Values{
+		"recipient":  {recipient},
+		"sender":     {sender},
+		"subject":    {subject},
+		"body-plain": {body},
+		"timestamp":  {ts},
+		"token":      {"token"},
+		"signature":  {sign(ts, "token")},
+	}
+}
+
+// signedRequest signs an admin request the way a client would and sends it to the handler
+func signedRequest(t *testing.T, h http.HandlerFunc, key testKey, path string, content any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	b, err := json.Marshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := nostr.Event{
+		Kind:      nostr.KindHTTPAuth,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"u", "http://example.com" + path}, {"method", http.MethodPost}},
+		Content:   string(b),
+	}
+	err = ev.Sign(key.sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("group_id", "group")
+
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	h(w, r)
+
+	return w
+}
+
+func TestVerify(t *testing.T) {
+	s := NewService(nil, nil, nil, "mail.example.com", testSigningKey)
+
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+	old := strconv.FormatInt(now.Add(-2*inboundMaxAge).Unix(), 10)
+
+	if err := s.verify(ts, "token", sign(ts, "token")); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+
+	for name, args := range map[string][3]string{
+		"wrong token":     {ts, "other", sign(ts, "token")},
+		"wrong key":       {ts, "token", hex.EncodeToString(make([]byte, sha256.Size))},
+		"expired":         {old, "token", sign(old, "token")},
+		"not a timestamp": {"now", "token", sign("now", "token")},
+		"not hex":         {ts, "token", "signature"},
+	} {
+		if err := s.verify(args[0], args[1], args[2]); err != ErrInvalidInboundSignature {
+			t.Errorf("%s: expected an invalid signature, got %v", name, err)
+		}
+	}
+}
+
+func TestGroupID(t *testing.T) {
+	s := NewService(nil, nil, nil, "Mail.Example.com", testSigningKey)
+
+	for recipients, want := range map[string]string{
+		"group@mail.example.com":                              "group",
+		"Group <group@MAIL.example.com>":                      "group",
+		"other@example.com, group@mail.example.com":           "group",
+		"group@mail.example.com, second@mail.example.com":     "group",
+		"\"Some Group\" <some-group@mail.example.com>, a@b.c": "some-group",
+	} {
+		got, err := s.groupID(recipients)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s %v", recipients, want, got, err)
+		}
+	}
+
+	for _, recipients := range []string{"", "group@example.com", "group@sub.mail.example.com", "not an address"} {
+		_, err := s.groupID(recipients)
+		if err != ErrUnknownRecipient {
+			t.Errorf("%s: expected an unknown recipient, got %v", recipients, err)
+		}
+	}
+}
+
+func TestReceiveRejects(t *testing.T) {
+	s := NewService(nil, nil, nil, "mail.example.com", testSigningKey)
+
+	form := signedForm("group@mail.example.com", "alice@example.com", "hi", "hello")
+	form.Set("signature", sign(form.Get("timestamp"), "other"))
+
+	w := inbound(s, form)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an unsigned mail to be unauthorized, got %d", w.Code)
+	}
+
+	// mails that will never be accepted must not be retried by the provider
+	w = inbound(s, signedForm("group@example.com", "alice@example.com", "hi", "hello"))
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected an unknown recipient to be not acceptable, got %d", w.Code)
+	}
+}
+
+func TestReceive(t *testing.T) {
+	admin := newTestKey(t)
+	member := newTestKey(t)
+	outsider := newTestKey(t)
+
+	g := &testutil.FakeGroups{Admins: map[string][]string{"group": {admin.pk}}, Members: map[string][]string{"group": {member.pk}}}
+	p := &testutil.FakeStore{}
+	s := newTestService(t, g, p)
+
+	path := "/v1/groups/group/email/senders"
+
+	w := signedRequest(t, s.AddSender, member, path, relay.EmailSenderRequest{Email: "alice@example.com", Pubkey: member.pk})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected members to be forbidden, got %d", w.Code)
+	}
+
+	w = signedRequest(t, s.AddSender, admin, path, relay.EmailSenderRequest{Email: "eve@example.com", Pubkey: outsider.pk})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected only members to be mapped, got %d", w.Code)
+	}
+
+	w = signedRequest(t, s.AddSender, admin, path, relay.EmailSenderRequest{Email: "Alice <Alice@Example.com>", Pubkey: member.pk})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the sender to be added, got %d", w.Code)
+	}
+
+	w = inbound(s, signedForm("group@mail.example.com", "bob@example.com", "hi", "hello"))
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected an unknown sender to be not acceptable, got %d", w.Code)
+	}
+
+	w = inbound(s, signedForm("group@mail.example.com", "alice@example.com", "hi", "  "))
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected an empty mail to be not acceptable, got %d", w.Code)
+	}
+
+	w = inbound(s, signedForm("group@mail.example.com", "ALICE@example.com", "Meeting", "see you tomorrow\n"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the mail to be posted, got %d", w.Code)
+	}
+
+	if len(p.Events) != 1 {
+		t.Fatalf("expected one post, got %d", len(p.Events))
+	}
+
+	ev := p.Events[0]
+	if ev.Kind != kindPost || ev.Content != "see you tomorrow" || ev.Tags.GetFirst([]string{"h", "group"}) == nil ||
+		ev.Tags.GetFirst([]string{"p", member.pk}) == nil || ev.Tags.GetFirst([]string{"title", "Meeting"}) == nil {
+		t.Fatalf("unexpected post %+v", ev)
+	}
+
+	// removed members can't keep posting by email
+	g.Members["group"] = []string{}
+
+	w = inbound(s, signedForm("group@mail.example.com", "alice@example.com", "hi", "hello"))
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected a former member to be not acceptable, got %d", w.Code)
+	}
+
+	w = signedRequest(t, s.RemoveSender, admin, path+"/remove", relay.EmailSenderRequest{Email: "alice@example.com"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the sender to be removed, got %d", w.Code)
+	}
+
+	w = signedRequest(t, s.RemoveSender, admin, path+"/remove", relay.EmailSenderRequest{Email: "alice@example.com"})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected a removed sender to be not found, got %d", w.Code)
+	}
+}
@@ -0,0 +1,171 @@
+package email
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Receive creates a group post from a mail forwarded by the inbound email provider. Mails that will
+// never be accepted are answered with 406 so that the provider doesn't retry them.
+func (s *Service) Receive(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxInboundSize)
+
+	err := r.ParseMultipartForm(maxInboundSize)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = s.verify(r.FormValue("timestamp"), r.FormValue("token"), r.FormValue("signature"))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body := r.FormValue("stripped-text")
+	if strings.TrimSpace(body) == "" {
+		body = r.FormValue("body-plain")
+	}
+
+	_, err = s.Post(r.Context(), &Message{
+		Recipient: r.FormValue("recipient"),
+		Sender:    r.FormValue("sender"),
+		Subject:   r.FormValue("subject"),
+		Body:      body,
+	})
+	if err != nil {
+		if errors.Is(err, ErrUnknownRecipient) || errors.Is(err, ErrSenderNotAllowed) || errors.Is(err, ErrEmptyMessage) {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, []byte("{}"), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// normalizeEmail returns the lowercase address of an email, false if it isn't one
+func normalizeEmail(email string) (string, bool) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return "", false
+	}
+
+	return strings.ToLower(addr.Address), true
+}
+
+// AddSender allows an email address to post into the group for a member
+func (s *Service) AddSender(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "group_id")
+
+	var req relay.EmailSenderRequest
+	ev, err := com.ParseAdminRequest(r, s.groups, groupID, s.now(), &req)
+	if err != nil {
+		com.WriteAdminRequestError(w, err)
+		return
+	}
+
+	email, ok := normalizeEmail(req.Email)
+	if !ok || !nostr.IsValidPublicKey(req.Pubkey) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	isMember, err := s.groups.IsMember(r.Context(), req.Pubkey, groupID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !isMember {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	sender := &relay.EmailSender{
+		GroupID:   groupID,
+		Email:     email,
+		Pubkey:    req.Pubkey,
+		CreatedBy: ev.PubKey,
+		CreatedAt: s.now(),
+	}
+
+	err = s.db.EmailSenderDB.AddSender(sender)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, sender, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ListSenders returns the email addresses allowed to post into the group
+func (s *Service) ListSenders(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "group_id")
+
+	_, err := com.ParseAdminRequest(r, s.groups, groupID, s.now(), nil)
+	if err != nil {
+		com.WriteAdminRequestError(w, err)
+		return
+	}
+
+	senders, err := s.db.EmailSenderDB.GetSenders(groupID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.BodyMultiple(w, senders, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// RemoveSender stops an email address from posting into the group
+func (s *Service) RemoveSender(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "group_id")
+
+	var req relay.EmailSenderRequest
+	_, err := com.ParseAdminRequest(r, s.groups, groupID, s.now(), &req)
+	if err != nil {
+		com.WriteAdminRequestError(w, err)
+		return
+	}
+
+	email, ok := normalizeEmail(req.Email)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ok, err = s.db.EmailSenderDB.RemoveSender(groupID, email)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = com.Body(w, []byte("{}"), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
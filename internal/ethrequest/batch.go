@@ -0,0 +1,42 @@
+package ethrequest
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// feeInputs reads the base fee of the latest block and the suggested priority fee in a single batch,
+// the base fee is nil on chains without EIP-1559 and the tip is then left out
+func (e *EthService) feeInputs() (*big.Int, *big.Int, error) {
+	var header *types.Header
+	var tip hexutil.Big
+
+	batch := []rpc.BatchElem{
+		{Method: "eth_getBlockByNumber", Args: []any{"latest", false}, Result: &header},
+		{Method: "eth_maxPriorityFeePerGas", Result: &tip},
+	}
+
+	err := e.breaker.Do(func() error {
+		return e.rpc.BatchCallContext(e.ctx, batch)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if batch[0].Error != nil {
+		return nil, nil, batch[0].Error
+	}
+
+	if header == nil || header.BaseFee == nil {
+		return nil, nil, nil
+	}
+
+	if batch[1].Error != nil {
+		return nil, nil, batch[1].Error
+	}
+
+	return header.BaseFee, (*big.Int)(&tip), nil
+}
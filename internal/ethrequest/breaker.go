@@ -0,0 +1,278 @@
+package ethrequest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/internal/metrics"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+
+	// json-rpc error code returned while the breaker is open
+	ErrCodeCircuitOpen = -32098
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// CircuitOpenError is returned without calling the rpc while the breaker is open
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("rpc provider unavailable, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// ErrorCode makes the error a json-rpc error so clients get a distinct code
+func (e *CircuitOpenError) ErrorCode() int {
+	return ErrCodeCircuitOpen
+}
+
+// IsCircuitOpen returns true if the error was caused by an open breaker
+func IsCircuitOpen(err error) bool {
+	var cerr *CircuitOpenError
+	return errors.As(err, &cerr)
+}
+
+type BreakerStats struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	Trips               uint64       `json:"trips"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+}
+
+// Breaker trips after consecutive rpc failures and fails fast until a probe succeeds
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	trips    uint64
+	openedAt time.Time
+	probing  bool
+
+	now func() time.Time
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+		now:       time.Now,
+	}
+}
+
+// Allow returns an error if the call should not be attempted, once the cooldown is
+// over a single probe call is allowed through
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		elapsed := b.now().Sub(b.openedAt)
+		if elapsed < b.cooldown {
+			return &CircuitOpenError{RetryAfter: b.cooldown - elapsed}
+		}
+
+		b.state = BreakerHalfOpen
+		b.probing = true
+
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return &CircuitOpenError{RetryAfter: b.cooldown}
+		}
+
+		b.probing = true
+
+		return nil
+	}
+
+	return nil
+}
+
+// Record records the outcome of a call that was allowed
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	if !isProviderFailure(err) {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			b.trips++
+		}
+
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Do runs fn if the breaker allows it and records its outcome
+func (b *Breaker) Do(fn func() error) error {
+	err := b.Allow()
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+
+	b.Record(err)
+
+	return err
+}
+
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerStats{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Trips:               b.trips,
+	}
+
+	if b.state != BreakerClosed {
+		t := b.openedAt
+		s.OpenedAt = &t
+	}
+
+	return s
+}
+
+// Name of the readiness check
+func (b *Breaker) Name() string {
+	return "rpc"
+}
+
+// Ready returns an error while the breaker is open
+func (b *Breaker) Ready() error {
+	s := b.Stats()
+	if s.State == BreakerOpen {
+		return fmt.Errorf("rpc circuit breaker open after %d consecutive failures", s.ConsecutiveFailures)
+	}
+
+	return nil
+}
+
+// WriteMetrics writes the breaker state in the prometheus text format
+func (b *Breaker) WriteMetrics(w io.Writer) {
+	s := b.Stats()
+
+	metrics.Help(w, "relay_rpc_breaker_state", "gauge", "state of the rpc circuit breaker (1 for the current state)")
+	for _, state := range []BreakerState{BreakerClosed, BreakerOpen, BreakerHalfOpen} {
+		v := 0.0
+		if s.State == state {
+			v = 1
+		}
+		metrics.Sample(w, "relay_rpc_breaker_state", v, "state", string(state))
+	}
+
+	metrics.Help(w, "relay_rpc_breaker_consecutive_failures", "gauge", "consecutive rpc failures")
+	metrics.Sample(w, "relay_rpc_breaker_consecutive_failures", float64(s.ConsecutiveFailures))
+
+	metrics.Help(w, "relay_rpc_breaker_trips_total", "counter", "number of times the rpc circuit breaker opened")
+	metrics.Sample(w, "relay_rpc_breaker_trips_total", float64(s.Trips))
+}
+
+// isProviderFailure returns true for errors that indicate the provider is unhealthy,
+// json-rpc errors (reverts, bad params, ...) mean the node answered and are not counted
+func isProviderFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// the caller gave up, this says nothing about the provider
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == 429 || httpErr.StatusCode >= 500
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return false
+	}
+
+	return true
+}
+
+// guard runs an rpc call returning a value through the breaker
+func guard[T any](b *Breaker, fn func() (T, error)) (T, error) {
+	var v T
+
+	err := b.Do(func() error {
+		var err error
+		v, err = fn()
+		return err
+	})
+
+	return v, err
+}
+
+// guardedBackend routes the calls of contract bindings through the breaker
+type guardedBackend struct {
+	*ethclient.Client
+
+	breaker *Breaker
+}
+
+func (g *guardedBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return guard(g.breaker, func() ([]byte, error) {
+		return g.Client.CallContract(ctx, call, blockNumber)
+	})
+}
+
+func (g *guardedBackend) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return guard(g.breaker, func() ([]byte, error) {
+		return g.Client.CodeAt(ctx, account, blockNumber)
+	})
+}
+
+func (g *guardedBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return g.breaker.Do(func() error {
+		return g.Client.SendTransaction(ctx, tx)
+	})
+}
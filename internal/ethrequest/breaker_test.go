@@ -0,0 +1,161 @@
+package ethrequest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type jsonRPCError struct{}
+
+func (e jsonRPCError) Error() string  { return "execution reverted" }
+func (e jsonRPCError) ErrorCode() int { return 3 }
+
+func newTestBreaker(threshold int, cooldown time.Duration) (*Breaker, *time.Time) {
+	now := time.Unix(1700000000, 0)
+
+	b := NewBreaker(threshold, cooldown)
+	b.now = func() time.Time { return now }
+
+	return b, &now
+}
+
+func TestBreakerTrips(t *testing.T) {
+	b, _ := newTestBreaker(3, time.Minute)
+
+	calls := 0
+	failing := func() error {
+		calls++
+		return errors.New("connection refused")
+	}
+
+	for i := 0; i < 3; i++ {
+		b.Do(failing)
+	}
+
+	if s := b.Stats(); s.State != BreakerOpen || s.Trips != 1 {
+		t.Fatalf("expected open breaker with 1 trip, got %+v", s)
+	}
+
+	err := b.Do(failing)
+	if !IsCircuitOpen(err) {
+		t.Fatalf("expected circuit open error, got %v", err)
+	}
+
+	if calls != 3 {
+		t.Fatalf("expected the rpc not to be called while open, got %d calls", calls)
+	}
+
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != ErrCodeCircuitOpen {
+		t.Fatalf("expected json-rpc error code %d, got %v", ErrCodeCircuitOpen, err)
+	}
+
+	if b.Ready() == nil {
+		t.Fatal("expected breaker not to be ready while open")
+	}
+}
+
+func TestBreakerRecovers(t *testing.T) {
+	b, now := newTestBreaker(1, time.Minute)
+
+	b.Do(func() error { return errors.New("timeout") })
+
+	*now = now.Add(time.Minute)
+
+	// a single probe is let through once the cooldown is over
+	err := b.Allow()
+	if err != nil {
+		t.Fatalf("expected probe to be allowed, got %v", err)
+	}
+
+	if !IsCircuitOpen(b.Allow()) {
+		t.Fatal("expected concurrent calls to fail while probing")
+	}
+
+	b.Record(nil)
+
+	if s := b.Stats(); s.State != BreakerClosed || s.ConsecutiveFailures != 0 {
+		t.Fatalf("expected closed breaker after a successful probe, got %+v", s)
+	}
+
+	if b.Ready() != nil {
+		t.Fatal("expected breaker to be ready once closed")
+	}
+}
+
+func TestBreakerReopens(t *testing.T) {
+	b, now := newTestBreaker(2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		b.Do(func() error { return errors.New("timeout") })
+	}
+
+	*now = now.Add(time.Minute)
+
+	err := b.Do(func() error { return rpc.HTTPError{StatusCode: 502} })
+	if err == nil || IsCircuitOpen(err) {
+		t.Fatalf("expected the probe to reach the rpc, got %v", err)
+	}
+
+	if s := b.Stats(); s.State != BreakerOpen || s.Trips != 2 {
+		t.Fatalf("expected breaker to reopen after a failed probe, got %+v", s)
+	}
+
+	if !IsCircuitOpen(b.Allow()) {
+		t.Fatal("expected calls to fail fast after reopening")
+	}
+}
+
+func TestBreakerIgnoresNodeErrors(t *testing.T) {
+	b, _ := newTestBreaker(2, time.Minute)
+
+	errs := []error{
+		jsonRPCError{},
+		rpc.HTTPError{StatusCode: 400},
+		context.Canceled,
+		jsonRPCError{},
+	}
+
+	for _, e := range errs {
+		b.Do(func() error { return e })
+	}
+
+	if s := b.Stats(); s.State != BreakerClosed || s.ConsecutiveFailures != 0 {
+		t.Fatalf("expected errors answered by the node not to count, got %+v", s)
+	}
+
+	// a 429 means the provider is rate limiting us
+	b.Do(func() error { return rpc.HTTPError{StatusCode: 429} })
+	b.Do(func() error { return rpc.HTTPError{StatusCode: 429} })
+
+	if s := b.Stats(); s.State != BreakerOpen {
+		t.Fatalf("expected rate limits to trip the breaker, got %+v", s)
+	}
+}
+
+func TestBreakerMetrics(t *testing.T) {
+	b, _ := newTestBreaker(1, time.Minute)
+
+	b.Do(func() error { return errors.New("timeout") })
+
+	var buf bytes.Buffer
+	b.WriteMetrics(&buf)
+
+	out := buf.String()
+	for _, line := range []string{
+		`relay_rpc_breaker_state{state="open"} 1`,
+		`relay_rpc_breaker_state{state="closed"} 0`,
+		`relay_rpc_breaker_consecutive_failures 1`,
+		`relay_rpc_breaker_trips_total 1`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", line, out)
+		}
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"math/big"
 	"time"
 
+	"github.com/comunifi/relay/internal/faults"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
@@ -31,9 +31,12 @@ type EthBlock struct {
 }
 
 type EthService struct {
-	rpc    *rpc.Client
-	client *ethclient.Client
-	ctx    context.Context
+	rpc     *rpc.Client
+	client  *ethclient.Client
+	ctx     context.Context
+	breaker *Breaker
+	faults  *faults.Injector
+	profile *Profile
 }
 
 func (e *EthService) Context() context.Context {
@@ -48,7 +51,36 @@ func NewEthService(ctx context.Context, endpoint string) (*EthService, error) {
 
 	client := ethclient.NewClient(rpc)
 
-	return &EthService{rpc, client, ctx}, nil
+	return &EthService{rpc: rpc, client: client, ctx: ctx, breaker: NewBreaker(DefaultBreakerThreshold, DefaultBreakerCooldown)}, nil
+}
+
+// SetProfile sets how transactions are priced on the chain
+func (e *EthService) SetProfile(p *Profile) {
+	e.profile = p
+}
+
+// Profile returns the chain profile, the default one unless it was set
+func (e *EthService) Profile() *Profile {
+	if e.profile == nil {
+		return DefaultProfile()
+	}
+
+	return e.profile
+}
+
+// SetBreaker replaces the circuit breaker guarding rpc calls
+func (e *EthService) SetBreaker(b *Breaker) {
+	e.breaker = b
+}
+
+// SetFaults sets the injector that randomly fails sent transactions, for testing only
+func (e *EthService) SetFaults(f *faults.Injector) {
+	e.faults = f
+}
+
+// Breaker returns the circuit breaker guarding rpc calls
+func (e *EthService) Breaker() *Breaker {
+	return e.breaker
 }
 
 func (e *EthService) Close() {
@@ -58,7 +90,9 @@ func (e *EthService) Close() {
 func (e *EthService) BlockTime(number *big.Int) (uint64, error) {
 	// Some blockchains have a slightly different format than Ethereum Blocks, so we need to use a custom Block struct
 	var blk *EthBlock
-	err := e.rpc.Call(&blk, "eth_getBlockByNumber", fmt.Sprintf("0x%s", number.Text(16)), true)
+	err := e.breaker.Do(func() error {
+		return e.rpc.Call(&blk, "eth_getBlockByNumber", fmt.Sprintf("0x%s", number.Text(16)), true)
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -76,53 +110,32 @@ func (e *EthService) BlockTime(number *big.Int) (uint64, error) {
 }
 
 func (e *EthService) Backend() bind.ContractBackend {
-	return e.client
+	return &guardedBackend{e.client, e.breaker}
 }
 
 func (e *EthService) CallContract(call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
-	return e.client.CallContract(e.ctx, call, blockNumber)
-}
-
-func (e *EthService) ListenForLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) error {
-	for {
-		sub, err := e.client.SubscribeFilterLogs(ctx, q, ch)
-		if err != nil {
-			log.Default().Println("error subscribing to logs", err.Error())
-
-			<-time.After(1 * time.Second)
-
-			continue
-		}
-
-		select {
-		case <-ctx.Done():
-			log.Default().Println("context done, unsubscribing")
-			sub.Unsubscribe()
-
-			return ctx.Err()
-		case err := <-sub.Err():
-			// subscription error, try and re-subscribe
-			log.Default().Println("subscription error", err.Error())
-			sub.Unsubscribe()
-
-			<-time.After(1 * time.Second)
-
-			continue
-		}
-	}
+	return guard(e.breaker, func() ([]byte, error) {
+		return e.client.CallContract(e.ctx, call, blockNumber)
+	})
 }
 
 func (e *EthService) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
-	return e.client.CodeAt(e.ctx, account, blockNumber)
+	return guard(e.breaker, func() ([]byte, error) {
+		return e.client.CodeAt(e.ctx, account, blockNumber)
+	})
 }
 
 func (e *EthService) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
-	return e.client.NonceAt(e.ctx, account, blockNumber)
+	return guard(e.breaker, func() (uint64, error) {
+		return e.client.NonceAt(e.ctx, account, blockNumber)
+	})
 }
 
 func (e *EthService) BaseFee() (*big.Int, error) {
 	// Get the latest block header
-	header, err := e.client.HeaderByNumber(context.Background(), nil)
+	header, err := guard(e.breaker, func() (*types.Header, error) {
+		return e.client.HeaderByNumber(context.Background(), nil)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -130,11 +143,15 @@ func (e *EthService) BaseFee() (*big.Int, error) {
 }
 
 func (e *EthService) EstimateGasPrice() (*big.Int, error) {
-	return e.client.SuggestGasPrice(e.ctx)
+	return guard(e.breaker, func() (*big.Int, error) {
+		return e.client.SuggestGasPrice(e.ctx)
+	})
 }
 
 func (e *EthService) EstimateGasLimit(msg ethereum.CallMsg) (uint64, error) {
-	gasLimit, err := e.client.EstimateGas(e.ctx, msg)
+	gasLimit, err := guard(e.breaker, func() (uint64, error) {
+		return e.client.EstimateGas(e.ctx, msg)
+	})
 	if err != nil {
 		// Log more details about the error
 		fmt.Printf("EstimateGasLimit error type: %T\n", err)
@@ -150,56 +167,42 @@ func (e *EthService) EstimateGasLimit(msg ethereum.CallMsg) (uint64, error) {
 }
 
 func (e *EthService) NewTx(nonce uint64, from, to common.Address, data []byte, extraGas int) (*types.Transaction, error) {
-	baseFee, err := e.BaseFee()
-	if err != nil {
-		return nil, fmt.Errorf("error getting base fee: %w", err)
+	p := e.Profile()
+
+	if p.GasStrategy == GasStrategyLegacy {
+		return e.newLegacyTx(nonce, from, to, data, extraGas)
 	}
 
-	// Set the priority fee per gas (miner tip)
-	tip, err := e.MaxPriorityFeePerGas()
+	// the base fee and the priority fee per gas (miner tip) are read in one round trip
+	baseFee, tip, err := e.feeInputs()
 	if err != nil {
-		return nil, fmt.Errorf("error getting max priority fee: %w", err)
+		return nil, fmt.Errorf("error getting fees: %w", err)
 	}
 
-	// Adaptive gas pricing based on network conditions
-	// If base fee is very low (< 0.01 Gwei), this is likely a low-cost network like Base
-	// If base fee is higher, use more conservative pricing
-	lowCostNetworkThreshold := big.NewInt(10000000) // 0.01 Gwei in wei
-
-	var minPriorityFee *big.Int
-	var baseFeeMultiplier *big.Int
-	var gasBufferPercent uint64
-
-	if baseFee.Cmp(lowCostNetworkThreshold) < 0 {
-		// Low-cost network (like Base): Use minimal fees
-		minPriorityFee = big.NewInt(1000000) // 0.001 Gwei
-		baseFeeMultiplier = big.NewInt(1)    // No multiplier
-		gasBufferPercent = 10                // 10% buffer
-	} else {
-		// Higher-cost network: Use more conservative pricing
-		minPriorityFee = big.NewInt(1000000000) // 1 Gwei
-		baseFeeMultiplier = big.NewInt(2)       // 2x multiplier for safety
-		gasBufferPercent = 50                   // 50% buffer for safety
+	// chains without EIP-1559 have no base fee and only accept gas priced transactions
+	if baseFee == nil {
+		if p.GasStrategy == GasStrategyEIP1559 {
+			return nil, errors.New("the chain profile requires EIP-1559 but the block has no base fee")
+		}
+
+		return e.newLegacyTx(nonce, from, to, data, extraGas)
 	}
 
+	// the tier depends on network conditions, low-cost networks like Base only need minimal fees
+	tier := p.tier(baseFee)
+
 	// Apply minimum priority fee
+	minPriorityFee := big.NewInt(tier.MinPriorityFee)
 	if tip.Cmp(minPriorityFee) < 0 {
 		tip = minPriorityFee
 	}
 
-	// Calculate max priority fee per gas with adaptive buffer
-	var maxPriorityFeePerGas *big.Int
-	if baseFee.Cmp(lowCostNetworkThreshold) < 0 {
-		// Low-cost network: Use tip directly (no additional buffer)
-		maxPriorityFeePerGas = tip
-	} else {
-		// Higher-cost network: Add 10% buffer for safety
-		buffer := new(big.Int).Div(tip, big.NewInt(10))
-		maxPriorityFeePerGas = new(big.Int).Add(tip, buffer)
-	}
+	// Calculate max priority fee per gas with the buffer of the tier
+	buffer := new(big.Int).Div(new(big.Int).Mul(tip, big.NewInt(tier.TipBufferPercent)), big.NewInt(100))
+	maxPriorityFeePerGas := new(big.Int).Add(tip, buffer)
 
 	// Calculate max fee per gas
-	maxFeePerGas := new(big.Int).Add(maxPriorityFeePerGas, new(big.Int).Mul(baseFee, baseFeeMultiplier))
+	maxFeePerGas := new(big.Int).Add(maxPriorityFeePerGas, new(big.Int).Mul(baseFee, big.NewInt(tier.BaseFeeMultiplier)))
 
 	// Prepare the call message
 	msg := ethereum.CallMsg{
@@ -216,23 +219,6 @@ func (e *EthService) NewTx(nonce uint64, from, to common.Address, data []byte, e
 		return nil, fmt.Errorf("gas estimation failed: %w", err)
 	}
 
-	// Calculate gas buffer based on network conditions
-	var gasBuffer uint64
-	if baseFee.Cmp(lowCostNetworkThreshold) < 0 {
-		// Low-cost network: Use more conservative buffer to prevent failures
-		// Use 20% buffer or minimum 20k gas, whichever is higher
-		gasBuffer = gasLimit / 2 // 50% buffer
-		if gasBuffer < 20000 {
-			gasBuffer = 20000 // minimum 20k gas buffer
-			if gasBuffer < gasLimit/20 {
-				gasBuffer = gasLimit / 20 // At least 5% buffer
-			}
-		}
-	} else {
-		// Higher-cost network: Use percentage-based buffer
-		gasBuffer = gasLimit * gasBufferPercent / 100
-	}
-
 	// Add small buffers to fee caps
 	gasFeeCap := new(big.Int).Add(maxFeePerGas, new(big.Int).Div(maxFeePerGas, big.NewInt(10)))
 	gasTipCap := new(big.Int).Add(maxPriorityFeePerGas, new(big.Int).Div(maxPriorityFeePerGas, big.NewInt(10)))
@@ -247,7 +233,7 @@ func (e *EthService) NewTx(nonce uint64, from, to common.Address, data []byte, e
 		Nonce:     nonce,
 		GasFeeCap: gasFeeCap,
 		GasTipCap: gasTipCap,
-		Gas:       gasLimit + gasBuffer,
+		Gas:       gasLimit + tier.gasBuffer(gasLimit),
 		To:        &to,
 		Value:     common.Big0,
 		Data:      data,
@@ -269,16 +255,26 @@ func (e *EthService) EstimateFullGas(from common.Address, tx *types.Transaction)
 		AccessList: tx.AccessList(),
 	}
 
-	return e.client.EstimateGas(e.ctx, msg)
+	return guard(e.breaker, func() (uint64, error) {
+		return e.client.EstimateGas(e.ctx, msg)
+	})
 }
 
 func (e *EthService) SendTransaction(tx *types.Transaction) error {
-	return e.client.SendTransaction(e.ctx, tx)
+	return e.breaker.Do(func() error {
+		if err := e.faults.Fail(faults.RPCSend); err != nil {
+			return err
+		}
+
+		return e.client.SendTransaction(e.ctx, tx)
+	})
 }
 
 func (e *EthService) MaxPriorityFeePerGas() (*big.Int, error) {
 	var hexFee string
-	err := e.rpc.Call(&hexFee, "eth_maxPriorityFeePerGas")
+	err := e.breaker.Do(func() error {
+		return e.rpc.Call(&hexFee, "eth_maxPriorityFeePerGas")
+	})
 	if err != nil {
 		return common.Big0, err
 	}
@@ -293,11 +289,15 @@ func (e *EthService) MaxPriorityFeePerGas() (*big.Int, error) {
 }
 
 func (e *EthService) StorageAt(addr common.Address, slot common.Hash) ([]byte, error) {
-	return e.client.StorageAt(e.ctx, addr, slot, nil)
+	return guard(e.breaker, func() ([]byte, error) {
+		return e.client.StorageAt(e.ctx, addr, slot, nil)
+	})
 }
 
 func (e *EthService) ChainID() (*big.Int, error) {
-	chid, err := e.client.ChainID(e.ctx)
+	chid, err := guard(e.breaker, func() (*big.Int, error) {
+		return e.client.ChainID(e.ctx)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -312,12 +312,16 @@ func (e *EthService) Call(method string, result any, params json.RawMessage) err
 		return fmt.Errorf("failed to unmarshal request body: %w", err)
 	}
 
-	return e.client.Client().Call(result, method, args...)
+	return e.breaker.Do(func() error {
+		return e.client.Client().Call(result, method, args...)
+	})
 }
 
 func (e *EthService) LatestBlock() (*big.Int, error) {
 	var blk *EthBlock
-	err := e.rpc.Call(&blk, "eth_getBlockByNumber", "latest", true)
+	err := e.breaker.Do(func() error {
+		return e.rpc.Call(&blk, "eth_getBlockByNumber", "latest", true)
+	})
 	if err != nil {
 		return common.Big0, err
 	}
@@ -330,22 +334,43 @@ func (e *EthService) LatestBlock() (*big.Int, error) {
 }
 
 func (e *EthService) FilterLogs(q ethereum.FilterQuery) ([]types.Log, error) {
-	return e.client.FilterLogs(e.ctx, q)
+	return guard(e.breaker, func() ([]types.Log, error) {
+		return e.client.FilterLogs(e.ctx, q)
+	})
+}
+
+func (e *EthService) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return guard(e.breaker, func() (*types.Receipt, error) {
+		return e.client.TransactionReceipt(ctx, txHash)
+	})
 }
 
-func (e *EthService) WaitForTx(tx *types.Transaction, timeout int) error {
+// TransactionSender returns the account that sent a transaction, the node reports it so it also
+// works for transaction types that can't be recovered locally
+func (e *EthService) TransactionSender(ctx context.Context, txHash, blockHash common.Hash, index uint) (common.Address, error) {
+	return guard(e.breaker, func() (common.Address, error) {
+		tx, _, err := e.client.TransactionByHash(ctx, txHash)
+		if err != nil {
+			return common.Address{}, err
+		}
+
+		return e.client.TransactionSender(ctx, tx, blockHash, index)
+	})
+}
+
+func (e *EthService) WaitForTx(tx *types.Transaction, timeout int) (*types.Receipt, error) {
 	// Create a context that will be canceled after 4 seconds
 	ctx, cancel := context.WithTimeout(e.ctx, time.Duration(timeout)*time.Second)
 	defer cancel() // Cancel the context when the function returns
 
 	rcpt, err := bind.WaitMined(ctx, e.client, tx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if rcpt.Status != types.ReceiptStatusSuccessful {
-		return errors.New("tx failed")
+		return rcpt, errors.New("tx failed")
 	}
 
-	return nil
+	return rcpt, nil
 }
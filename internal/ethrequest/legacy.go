@@ -0,0 +1,46 @@
+package ethrequest
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// newLegacyTx builds a gas priced transaction for chains without EIP-1559, their blocks have no base fee
+func (e *EthService) newLegacyTx(nonce uint64, from, to common.Address, data []byte, extraGas int) (*types.Transaction, error) {
+	price, err := e.EstimateGasPrice()
+	if err != nil {
+		return nil, fmt.Errorf("error getting gas price: %w", err)
+	}
+
+	gasLimit, err := e.EstimateGasLimit(ethereum.CallMsg{
+		From: from,
+		To:   &to,
+		Data: data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gas estimation failed: %w", err)
+	}
+
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: legacyGasPrice(price, extraGas),
+		Gas:      gasLimit + e.Profile().Standard.gasBuffer(gasLimit),
+		To:       &to,
+		Value:    common.Big0,
+		Data:     data,
+	}), nil
+}
+
+// legacyGasPrice adds a 10% buffer to the suggested gas price, retries pay extraGas times more so
+// that they replace the transaction that is stuck
+func legacyGasPrice(price *big.Int, extraGas int) *big.Int {
+	if extraGas > 0 {
+		return new(big.Int).Add(price, new(big.Int).Mul(price, big.NewInt(int64(extraGas))))
+	}
+
+	return new(big.Int).Add(price, new(big.Int).Div(price, big.NewInt(10)))
+}
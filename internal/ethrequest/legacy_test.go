@@ -0,0 +1,22 @@
+package ethrequest
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestLegacyGasPrice(t *testing.T) {
+	price := big.NewInt(1000)
+
+	if got := legacyGasPrice(price, 0); got.Int64() != 1100 {
+		t.Fatalf("expected a 10%% buffer, got %s", got)
+	}
+
+	if got := legacyGasPrice(price, 2); got.Int64() != 3000 {
+		t.Fatalf("expected a retry to pay 3 times the price, got %s", got)
+	}
+
+	if price.Int64() != 1000 {
+		t.Fatalf("expected the suggested price to be left as is, got %s", price)
+	}
+}
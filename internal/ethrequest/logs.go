@@ -0,0 +1,158 @@
+package ethrequest
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blocks fetched at a time when logs missed while the subscription was down are backfilled
+const backfillRange = 2000
+
+// logs of the subscription buffered while a backfill runs
+const subscriptionBuffer = 256
+
+// how long to wait before subscribing again after an error
+const resubscribeDelay = time.Second
+
+// logCursor is how far the logs of a subscription were delivered
+type logCursor struct {
+	from *big.Int   // first block that may have logs that weren't delivered, nil when unknown
+	last *types.Log // last delivered log, nil before the first one
+}
+
+// after tells whether a log comes after the last delivered one, logs of the same block are
+// ordered by their index
+func (c *logCursor) after(l types.Log) bool {
+	if c.last == nil {
+		return true
+	}
+
+	if l.BlockNumber != c.last.BlockNumber {
+		return l.BlockNumber > c.last.BlockNumber
+	}
+
+	return l.Index > c.last.Index
+}
+
+// deliver sends a log unless it was already delivered, logs removed by a reorg are always sent
+func (c *logCursor) deliver(ctx context.Context, l types.Log, ch chan<- types.Log) error {
+	if !l.Removed && !c.after(l) {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case ch <- l:
+	}
+
+	if l.Removed {
+		return nil
+	}
+
+	c.last = &l
+
+	// the rest of the block may still be missing, it is looked up again and deduplicated
+	c.from = new(big.Int).SetUint64(l.BlockNumber)
+
+	return nil
+}
+
+// backfill delivers the logs from the cursor up to head, a range at a time
+func (c *logCursor) backfill(ctx context.Context, q ethereum.FilterQuery, head uint64, filter func(ethereum.FilterQuery) ([]types.Log, error), ch chan<- types.Log) error {
+	if c.from == nil {
+		return nil
+	}
+
+	for from := c.from.Uint64(); from <= head; from += backfillRange {
+		to := min(head, from+backfillRange-1)
+
+		q.FromBlock = new(big.Int).SetUint64(from)
+		q.ToBlock = new(big.Int).SetUint64(to)
+
+		logs, err := filter(q)
+		if err != nil {
+			return err
+		}
+
+		for _, l := range logs {
+			err = c.deliver(ctx, l, ch)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	c.from = new(big.Int).SetUint64(head + 1)
+
+	return nil
+}
+
+// ListenForLogs streams the logs of a query to ch until the context is done. The subscription is
+// renewed after an error, the logs emitted while it was down are fetched from the block of the
+// last delivered log, or from the start of the query, before streaming resumes, so that none is
+// missed or delivered twice.
+func (e *EthService) ListenForLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) error {
+	c := &logCursor{from: q.FromBlock}
+
+	for {
+		err := e.streamLogs(ctx, q, c, ch)
+		if ctx.Err() != nil {
+			log.Default().Println("context done, unsubscribing")
+			return ctx.Err()
+		}
+
+		log.Default().Println("subscription error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// streamLogs subscribes to the logs of a query, backfills the ones since the cursor and streams
+// the new ones until the subscription fails
+func (e *EthService) streamLogs(ctx context.Context, q ethereum.FilterQuery, c *logCursor, ch chan<- types.Log) error {
+	// the subscription starts before the backfill so that no block falls between them, the logs
+	// both return are deduplicated
+	logs := make(chan types.Log, subscriptionBuffer)
+
+	sub, err := e.client.SubscribeFilterLogs(ctx, q, logs)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	if c.from != nil {
+		head, err := e.LatestBlock()
+		if err != nil {
+			return err
+		}
+
+		err = c.backfill(ctx, q, head.Uint64(), e.FilterLogs, ch)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return err
+		case l := <-logs:
+			err := c.deliver(ctx, l, ch)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package ethrequest
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestLogCursor(t *testing.T) {
+	ctx := context.Background()
+
+	chain := []types.Log{
+		{BlockNumber: 10, Index: 0},
+		{BlockNumber: 10, Index: 1},
+		{BlockNumber: 12, Index: 0},
+		{BlockNumber: 2500, Index: 3},
+	}
+
+	ranges := [][2]uint64{}
+	filter := func(q ethereum.FilterQuery) ([]types.Log, error) {
+		ranges = append(ranges, [2]uint64{q.FromBlock.Uint64(), q.ToBlock.Uint64()})
+
+		logs := []types.Log{}
+		for _, l := range chain {
+			if l.BlockNumber >= q.FromBlock.Uint64() && l.BlockNumber <= q.ToBlock.Uint64() {
+				logs = append(logs, l)
+			}
+		}
+		return logs, nil
+	}
+
+	ch := make(chan types.Log, 10)
+	c := &logCursor{from: big.NewInt(10)}
+
+	// the subscription delivered the first log of block 10 before it failed
+	err := c.deliver(ctx, chain[0], ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rest of block 10 and the blocks after it are backfilled, a range at a time
+	err = c.backfill(ctx, ethereum.FilterQuery{}, 3000, filter, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ranges) != 2 || ranges[0] != [2]uint64{10, 2009} || ranges[1] != [2]uint64{2010, 3000} {
+		t.Fatalf("unexpected backfill ranges %v", ranges)
+	}
+
+	// the new subscription returns a log that was backfilled and a new one
+	c.deliver(ctx, chain[3], ch)
+	c.deliver(ctx, types.Log{BlockNumber: 3001}, ch)
+	close(ch)
+
+	got := []uint64{}
+	for l := range ch {
+		got = append(got, l.BlockNumber*10+uint64(l.Index))
+	}
+
+	want := []uint64{100, 101, 120, 25003, 30010}
+	if len(got) != len(want) {
+		t.Fatalf("expected logs %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected logs %v, got %v", want, got)
+		}
+	}
+
+	if c.from.Uint64() != 3001 {
+		t.Fatalf("expected the cursor at block 3001, got %d", c.from.Uint64())
+	}
+}
@@ -0,0 +1,168 @@
+package ethrequest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// gas strategies of a chain profile
+const (
+	GasStrategyAuto    = "auto"    // EIP-1559 when blocks have a base fee, legacy otherwise
+	GasStrategyEIP1559 = "eip1559" // always dynamic fee transactions
+	GasStrategyLegacy  = "legacy"  // always gas priced transactions
+)
+
+// FeeTier prices the transactions of a chain, fees are in wei
+type FeeTier struct {
+	MinPriorityFee    int64  `json:"min_priority_fee"`
+	BaseFeeMultiplier int64  `json:"base_fee_multiplier"`
+	TipBufferPercent  int64  `json:"tip_buffer_percent"`
+	GasBufferPercent  uint64 `json:"gas_buffer_percent"`
+	MinGasBuffer      uint64 `json:"min_gas_buffer"`
+}
+
+// Profile describes how transactions are priced and confirmed on a chain. The low cost tier is
+// used while the base fee is under LowCostThreshold, networks like Base need only minimal fees.
+type Profile struct {
+	Name             string   `json:"name"`
+	BlockTime        string   `json:"block_time"`         // e.g. 2s
+	Confirmations    uint64   `json:"confirmations"`      // blocks after which a log is final when the node has no finalized tag
+	GasStrategy      string   `json:"gas_strategy"`       // auto, eip1559 or legacy
+	LowCostThreshold int64    `json:"low_cost_threshold"` // base fee in wei
+	LowCost          FeeTier  `json:"low_cost"`
+	Standard         FeeTier  `json:"standard"`
+	EntryPoints      []string `json:"entry_points,omitempty"` // entry points user operations can target, empty allows any
+}
+
+// DefaultProfile is used on chains without a preset
+func DefaultProfile() *Profile {
+	return &Profile{
+		Name:             "default",
+		BlockTime:        "12s",
+		Confirmations:    12,
+		GasStrategy:      GasStrategyAuto,
+		LowCostThreshold: 10_000_000, // 0.01 Gwei
+		LowCost: FeeTier{
+			MinPriorityFee:    1_000_000, // 0.001 Gwei
+			BaseFeeMultiplier: 1,
+			GasBufferPercent:  50,
+			MinGasBuffer:      20_000,
+		},
+		Standard: FeeTier{
+			MinPriorityFee:    1_000_000_000, // 1 Gwei
+			BaseFeeMultiplier: 2,
+			TipBufferPercent:  10,
+			GasBufferPercent:  50,
+		},
+	}
+}
+
+// presets returns the profiles shipped for common chains by chain id
+func presets() map[string]*Profile {
+	base := DefaultProfile()
+	base.Name = "base"
+	base.BlockTime = "2s"
+	base.Confirmations = 10
+
+	gnosis := DefaultProfile()
+	gnosis.Name = "gnosis"
+	gnosis.BlockTime = "5s"
+	gnosis.Confirmations = 20
+
+	polygon := DefaultProfile()
+	polygon.Name = "polygon"
+	polygon.BlockTime = "2s"
+	polygon.Confirmations = 32
+	polygon.Standard.MinPriorityFee = 30_000_000_000 // validators reject tips under 25 Gwei
+
+	celo := DefaultProfile()
+	celo.Name = "celo"
+	celo.BlockTime = "1s"
+	celo.Confirmations = 10
+
+	return map[string]*Profile{
+		"8453":  base,
+		"100":   gnosis,
+		"137":   polygon,
+		"42220": celo,
+	}
+}
+
+// LoadProfile returns the preset of a chain, or the default profile, with the overrides of the json
+// file at path applied, fields left out of the file keep their preset value
+func LoadProfile(chainID, path string) (*Profile, error) {
+	p, ok := presets()[chainID]
+	if !ok {
+		p = DefaultProfile()
+	}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(b, p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chain profile %s: %w", path, err)
+		}
+	}
+
+	err := p.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid chain profile %s: %w", p.Name, err)
+	}
+
+	return p, nil
+}
+
+func (p *Profile) validate() error {
+	d, err := time.ParseDuration(p.BlockTime)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid block time %q", p.BlockTime)
+	}
+
+	if !slices.Contains([]string{GasStrategyAuto, GasStrategyEIP1559, GasStrategyLegacy}, p.GasStrategy) {
+		return fmt.Errorf("unknown gas strategy %q", p.GasStrategy)
+	}
+
+	for _, t := range []FeeTier{p.LowCost, p.Standard} {
+		if t.MinPriorityFee < 0 || t.BaseFeeMultiplier < 1 || t.TipBufferPercent < 0 {
+			return fmt.Errorf("invalid fee tier %+v", t)
+		}
+	}
+
+	for _, ep := range p.EntryPoints {
+		if !common.IsHexAddress(ep) {
+			return fmt.Errorf("invalid entry point %q", ep)
+		}
+	}
+
+	return nil
+}
+
+// BlockDuration returns the block time of the chain
+func (p *Profile) BlockDuration() time.Duration {
+	d, _ := time.ParseDuration(p.BlockTime)
+	return d
+}
+
+// tier returns the fee tier for a base fee
+func (p *Profile) tier(baseFee *big.Int) FeeTier {
+	if baseFee.Cmp(big.NewInt(p.LowCostThreshold)) < 0 {
+		return p.LowCost
+	}
+
+	return p.Standard
+}
+
+// gasBuffer returns the gas added on top of an estimate
+func (t FeeTier) gasBuffer(gasLimit uint64) uint64 {
+	return max(gasLimit*t.GasBufferPercent/100, t.MinGasBuffer)
+}
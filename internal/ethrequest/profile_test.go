@@ -0,0 +1,59 @@
+package ethrequest
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProfile(t *testing.T) {
+	p, err := LoadProfile("137", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Name != "polygon" || p.Standard.MinPriorityFee != 30_000_000_000 {
+		t.Fatalf("expected the polygon preset, got %+v", p)
+	}
+
+	// overrides keep the fields they leave out
+	path := filepath.Join(t.TempDir(), "profile.json")
+	err = os.WriteFile(path, []byte(`{"confirmations": 5, "standard": {"base_fee_multiplier": 3}}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = LoadProfile("100", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Name != "gnosis" || p.Confirmations != 5 || p.Standard.BaseFeeMultiplier != 3 || p.Standard.MinPriorityFee != 1_000_000_000 {
+		t.Fatalf("expected the overridden gnosis preset, got %+v", p)
+	}
+
+	// unknown chains use the default profile
+	p, err = LoadProfile("999999", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Name != "default" {
+		t.Fatalf("expected the default profile, got %s", p.Name)
+	}
+
+	if tier := p.tier(big.NewInt(1_000_000)); tier.GasBufferPercent != 50 || tier.gasBuffer(10_000) != 20_000 {
+		t.Fatalf("expected the low cost tier with a minimum gas buffer, got %+v", tier)
+	}
+
+	err = os.WriteFile(path, []byte(`{"gas_strategy": "cheap"}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadProfile("100", path)
+	if err == nil {
+		t.Fatal("expected an unknown gas strategy to be rejected")
+	}
+}
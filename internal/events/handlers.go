@@ -1,27 +1,141 @@
 package events
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
 
 	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/signatures"
 	"github.com/comunifi/relay/internal/ws"
 	"github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	gethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/go-chi/chi/v5"
 )
 
+var topicRegex = regexp.MustCompile("^0x[0-9a-fA-F]{64}$")
+
 type Handlers struct {
-	chainID string
-	db      *db.DB
-	pools   *ws.ConnectionPools
+	chainID    string
+	db         *db.DB
+	pools      *ws.ConnectionPools
+	evm        relay.EVMRequester
+	signatures *signatures.Registry
 }
 
-func NewHandlers(chainID string, db *db.DB, pools *ws.ConnectionPools) *Handlers {
+func NewHandlers(chainID string, db *db.DB, pools *ws.ConnectionPools, evm relay.EVMRequester, sigs *signatures.Registry) *Handlers {
 	return &Handlers{
-		chainID: chainID,
-		db:      db,
-		pools:   pools,
+		chainID:    chainID,
+		db:         db,
+		pools:      pools,
+		evm:        evm,
+		signatures: sigs,
+	}
+}
+
+// Register adds an event to index, the signature is resolved from the topic when omitted
+func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
+	var ev relay.Event
+	err := json.NewDecoder(r.Body).Decode(&ev)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !gethcommon.IsHexAddress(ev.Contract) || !topicRegex.MatchString(ev.Topic) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ev.ChainID = h.chainID
+	ev.Contract = common.ChecksumAddress(ev.Contract)
+	ev.Topic = strings.ToLower(ev.Topic)
+
+	if ev.EventSignature == "" {
+		ev.EventSignature, err = h.signatures.ResolveContract(r.Context(), h.evm, ev.Contract, ev.Topic)
+		if err != nil {
+			if errors.Is(err, signatures.ErrSignatureNotFound) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+	}
+
+	// the signature must produce the topic it is registered under
+	if ev.GetTopic0FromEventSignature().Hex() != ev.Topic {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if ev.Name == "" {
+		ev.Name, _, _ = ev.ParseEventSignature()
+	}
+
+	err = h.db.EventDB.AddEvent(ev.ChainID, ev.Contract, ev.Topic, ev.Alias, ev.EventSignature, ev.Name, ev.GroupID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = common.Body(w, ev, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+type abiRequest struct {
+	Contract string          `json:"contract"`
+	Alias    string          `json:"alias"`
+	GroupID  string          `json:"group_id,omitempty"`
+	ABI      json.RawMessage `json:"abi"`
+}
+
+// RegisterABI registers every event of a contract ABI, logs are then decoded with the ABI
+func (h *Handlers) RegisterABI(w http.ResponseWriter, r *http.Request) {
+	var req abiRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !gethcommon.IsHexAddress(req.Contract) || len(req.ABI) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	evs, err := relay.EventsFromABI(h.chainID, common.ChecksumAddress(req.Contract), string(req.ABI))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, ev := range evs {
+		ev.Alias = req.Alias
+		ev.GroupID = req.GroupID
+
+		err = h.db.EventDB.AddEvent(ev.ChainID, ev.Contract, ev.Topic, ev.Alias, ev.EventSignature, ev.Name, ev.GroupID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		err = h.db.EventDB.SetEventABI(ev.ChainID, ev.Contract, ev.Topic, ev.ABI)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = common.BodyMultiple(w, evs, common.Pagination{Limit: len(evs), Offset: 0, Total: len(evs)})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
@@ -0,0 +1,164 @@
+// Package faults randomly fails external calls so that retries, dead letters and alerts can be exercised
+// end to end on staging. It must never be enabled in production.
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/comunifi/relay/internal/metrics"
+)
+
+// Point is a place where a fault can be injected
+type Point string
+
+const (
+	RPCSend  Point = "rpc_send"
+	S3Put    Point = "s3_put"
+	DBCommit Point = "db_commit"
+)
+
+// Points are all the places where faults can be injected
+var Points = []Point{RPCSend, S3Put, DBCommit}
+
+// ErrInjected is wrapped by every injected fault
+var ErrInjected = errors.New("injected fault")
+
+// Injector fails a fraction of the calls at each point, a nil injector never fails
+type Injector struct {
+	rates    map[Point]float64
+	injected map[Point]*atomic.Uint64
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// New creates an injector that fails calls at the given rates, between 0 and 1
+func New(rates map[Point]float64, seed int64) *Injector {
+	injected := make(map[Point]*atomic.Uint64, len(Points))
+	for _, p := range Points {
+		injected[p] = &atomic.Uint64{}
+	}
+
+	return &Injector{
+		rates:    rates,
+		injected: injected,
+		rnd:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// ParseRates parses a list of point=rate pairs such as "rpc_send=0.1,s3_put=0.05"
+func ParseRates(s string) (map[Point]float64, error) {
+	rates := map[Point]float64{}
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid fault %q, expected point=rate", pair)
+		}
+
+		p := Point(strings.TrimSpace(name))
+		if !known(p) {
+			return nil, fmt.Errorf("unknown fault point %q", p)
+		}
+
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid rate %q for fault point %s, expected a value between 0 and 1", value, p)
+		}
+
+		rates[p] = rate
+	}
+
+	return rates, nil
+}
+
+func known(p Point) bool {
+	for _, k := range Points {
+		if k == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Enabled returns true if any point can fail
+func (i *Injector) Enabled() bool {
+	if i == nil {
+		return false
+	}
+
+	for _, rate := range i.rates {
+		if rate > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String describes the configured rates, for logging
+func (i *Injector) String() string {
+	if i == nil {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(i.rates))
+	for p, rate := range i.rates {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", p, strconv.FormatFloat(rate, 'g', -1, 64)))
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+// Fail returns an error wrapping ErrInjected if the call at the given point should fail
+func (i *Injector) Fail(p Point) error {
+	if i == nil {
+		return nil
+	}
+
+	rate := i.rates[p]
+	if rate <= 0 {
+		return nil
+	}
+
+	i.mu.Lock()
+	roll := i.rnd.Float64()
+	i.mu.Unlock()
+
+	if roll >= rate {
+		return nil
+	}
+
+	if c, ok := i.injected[p]; ok {
+		c.Add(1)
+	}
+
+	return fmt.Errorf("%s: %w", p, ErrInjected)
+}
+
+// WriteMetrics writes the number of injected faults per point in the prometheus text format
+func (i *Injector) WriteMetrics(w io.Writer) {
+	if i == nil {
+		return
+	}
+
+	metrics.Help(w, "relay_injected_faults_total", "counter", "faults injected for testing")
+	for _, p := range Points {
+		metrics.Sample(w, "relay_injected_faults_total", float64(i.injected[p].Load()), "point", string(p))
+	}
+}
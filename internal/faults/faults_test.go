@@ -0,0 +1,74 @@
+package faults
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseRates(t *testing.T) {
+	rates, err := ParseRates(" rpc_send=0.1, s3_put=1,,db_commit=0 ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if rates[RPCSend] != 0.1 || rates[S3Put] != 1 || rates[DBCommit] != 0 {
+		t.Fatalf("unexpected rates: %v", rates)
+	}
+
+	for _, s := range []string{"rpc_send", "disk=0.1", "rpc_send=2", "s3_put=-0.1", "db_commit=x"} {
+		if _, err := ParseRates(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestFail(t *testing.T) {
+	var nilInjector *Injector
+	if err := nilInjector.Fail(RPCSend); err != nil {
+		t.Fatalf("nil injector should never fail, got %v", err)
+	}
+
+	if nilInjector.Enabled() {
+		t.Fatal("nil injector should not be enabled")
+	}
+
+	i := New(map[Point]float64{RPCSend: 1, S3Put: 0.5}, 1)
+	if !i.Enabled() {
+		t.Fatal("expected the injector to be enabled")
+	}
+
+	for n := 0; n < 10; n++ {
+		err := i.Fail(RPCSend)
+		if !errors.Is(err, ErrInjected) {
+			t.Fatalf("expected an injected fault, got %v", err)
+		}
+
+		if err := i.Fail(DBCommit); err != nil {
+			t.Fatalf("expected no fault at an unconfigured point, got %v", err)
+		}
+	}
+
+	failed := 0
+	for n := 0; n < 1000; n++ {
+		if i.Fail(S3Put) != nil {
+			failed++
+		}
+	}
+
+	if failed < 400 || failed > 600 {
+		t.Fatalf("expected about half of the calls to fail, got %d of 1000", failed)
+	}
+
+	var buf bytes.Buffer
+	i.WriteMetrics(&buf)
+
+	if !strings.Contains(buf.String(), `relay_injected_faults_total{point="rpc_send"} 10`) {
+		t.Fatalf("unexpected metrics:\n%s", buf.String())
+	}
+
+	if i.String() != "rpc_send=1,s3_put=0.5" {
+		t.Fatalf("unexpected description %q", i.String())
+	}
+}
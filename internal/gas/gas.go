@@ -0,0 +1,148 @@
+// Package gas tracks the gas price of the chain so that bundles can be held back while fees spike.
+package gas
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/internal/metrics"
+)
+
+// Source returns the current gas price
+type Source interface {
+	EstimateGasPrice() (*big.Int, error)
+}
+
+// State is the gas price at the last sample
+type State struct {
+	Price     string    `json:"price"`   // wei
+	Average   string    `json:"average"` // wei, exponential moving average of the samples
+	Multiple  float64   `json:"multiple"`
+	Spiking   bool      `json:"spiking"` // the price is above multiple times the average
+	SampledAt time.Time `json:"sampled_at"`
+}
+
+// Tracker samples the gas price and smooths it with an exponential moving average
+type Tracker struct {
+	src      Source
+	interval time.Duration
+	alpha    float64 // weight of a new sample in the average
+	multiple float64
+
+	mu        sync.Mutex
+	price     float64
+	average   float64
+	spiking   bool
+	sampledAt time.Time
+}
+
+func NewTracker(src Source, interval time.Duration, alpha, multiple float64) *Tracker {
+	return &Tracker{
+		src:      src,
+		interval: interval,
+		alpha:    alpha,
+		multiple: multiple,
+	}
+}
+
+// Spiking returns whether the price was above multiple times the average at the last sample
+func (t *Tracker) Spiking() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.spiking
+}
+
+// State returns the last sample
+func (t *Tracker) State() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return State{
+		Price:     big.NewFloat(t.price).Text('f', 0),
+		Average:   big.NewFloat(t.average).Text('f', 0),
+		Multiple:  t.multiple,
+		Spiking:   t.spiking,
+		SampledAt: t.sampledAt,
+	}
+}
+
+// Start samples the gas price every interval until the context is done
+func (t *Tracker) Start(ctx context.Context) error {
+	log.Default().Println("starting gas price tracker")
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		err := t.sample()
+		if err != nil {
+			log.Default().Println("gas: failed to sample the gas price:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Tracker) sample() error {
+	price, err := t.src.EstimateGasPrice()
+	if err != nil {
+		return err
+	}
+
+	t.observe(price, time.Now().UTC())
+
+	return nil
+}
+
+// observe adds a sample, the price is compared to the average of the previous samples so that a
+// spike doesn't hide itself
+func (t *Tracker) observe(price *big.Int, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, _ := new(big.Float).SetInt(price).Float64()
+
+	if t.sampledAt.IsZero() {
+		t.average = p
+	}
+
+	spiking := t.multiple > 0 && p > t.average*t.multiple
+	if spiking != t.spiking {
+		log.Default().Printf("gas: price %.0f wei, average %.0f wei, spiking: %t", p, t.average, spiking)
+	}
+
+	t.price = p
+	t.spiking = spiking
+	t.average = t.alpha*p + (1-t.alpha)*t.average
+	t.sampledAt = at
+}
+
+// WriteMetrics writes the sampled and average gas price
+func (t *Tracker) WriteMetrics(w io.Writer) {
+	t.mu.Lock()
+	price, average, spiking := t.price, t.average, t.spiking
+	t.mu.Unlock()
+
+	metrics.Help(w, "relay_gas_price_wei", "gauge", "gas price at the last sample")
+	metrics.Sample(w, "relay_gas_price_wei", price)
+
+	metrics.Help(w, "relay_gas_price_average_wei", "gauge", "exponential moving average of the gas price")
+	metrics.Sample(w, "relay_gas_price_average_wei", average)
+
+	s := 0.0
+	if spiking {
+		s = 1
+	}
+
+	metrics.Help(w, "relay_gas_spiking", "gauge", "1 while bundles are held back because the gas price spikes")
+	metrics.Sample(w, "relay_gas_spiking", s)
+}
@@ -0,0 +1,39 @@
+package gas
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(nil, time.Second, 0.5, 2)
+
+	at := time.Now()
+	for _, p := range []int64{100, 110, 90, 100} {
+		tr.observe(big.NewInt(p), at)
+		if tr.Spiking() {
+			t.Fatalf("expected no spike at %d, got %+v", p, tr.State())
+		}
+	}
+
+	// the spike is compared to the average before it
+	tr.observe(big.NewInt(250), at)
+	if !tr.Spiking() {
+		t.Fatalf("expected a spike, got %+v", tr.State())
+	}
+
+	// calm again once the price goes back down
+	tr.observe(big.NewInt(120), at)
+	if tr.Spiking() {
+		t.Fatalf("expected the spike to be over, got %+v", tr.State())
+	}
+
+	// a multiple of 0 never holds bundles back
+	off := NewTracker(nil, time.Second, 0.5, 0)
+	off.observe(big.NewInt(100), at)
+	off.observe(big.NewInt(10000), at)
+	if off.Spiking() {
+		t.Fatal("expected spike protection to be disabled")
+	}
+}
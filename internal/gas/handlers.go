@@ -0,0 +1,25 @@
+package gas
+
+import (
+	"net/http"
+
+	com "github.com/comunifi/relay/pkg/common"
+)
+
+type Handlers struct {
+	t *Tracker
+}
+
+func NewHandlers(t *Tracker) *Handlers {
+	return &Handlers{
+		t: t,
+	}
+}
+
+// Get returns the current gas price and whether it spikes
+func (h *Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	err := com.Body(w, h.t.State(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,292 @@
+// Package groupcheck verifies the membership of groups against their moderation events.
+//
+// The relay-generated admins and members lists (kinds 39001 and 39002) and the projected group
+// state are both derived from moderation events as they arrive. A check replays the full
+// moderation history of every group and reports where either one diverges from it, and with
+// repair enabled publishes the replayed lists and corrects the projection.
+package groupcheck
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+// what a replayed group is compared against
+type Source string
+
+const (
+	SourceLists      Source = "lists"
+	SourceProjection Source = "projection"
+)
+
+// Divergence is a pubkey whose membership differs from the replayed one
+type Divergence struct {
+	GroupID string `json:"group_id"`
+	Source  Source `json:"source"`
+	Pubkey  string `json:"pubkey"`
+	Reason  string `json:"reason"`
+}
+
+type Report struct {
+	CheckedAt   time.Time     `json:"checked_at"`
+	Duration    float64       `json:"duration"` // seconds
+	Repair      bool          `json:"repair"`
+	Groups      int           `json:"groups"`
+	Repaired    int           `json:"repaired"`         // groups whose lists or projection were corrected
+	Errors      []string      `json:"errors,omitempty"` // groups that could not be checked
+	Divergences []*Divergence `json:"divergences"`
+}
+
+func (r *Report) add(groupID string, source Source, pubkey, reason string) {
+	r.Divergences = append(r.Divergences, &Divergence{GroupID: groupID, Source: source, Pubkey: pubkey, Reason: reason})
+}
+
+// Groups replays moderation events and manages the relay-generated lists
+type Groups interface {
+	ReplayGroups(ctx context.Context) (map[string]*groups.GroupState, error)
+	GetAdmins(ctx context.Context, groupID string) ([]string, error)
+	GetMembers(ctx context.Context, groupID string) ([]string, error)
+	PublishLists(ctx context.Context, groupID string, s *groups.GroupState)
+}
+
+// Projection is the projected group state
+type Projection interface {
+	GetGroupMembers(groupID string) ([]*relay.GroupMember, error)
+	ApplyGroupChange(c *relay.GroupChange) error
+}
+
+type Config struct {
+	Interval time.Duration
+	Repair   bool // publish the replayed lists and correct the projection of divergent groups
+}
+
+type Checker struct {
+	ctx        context.Context
+	groups     Groups
+	projection Projection
+	w          relay.WebhookMessager
+
+	config *Config
+
+	now func() time.Time
+
+	mu   sync.Mutex
+	last *Report
+}
+
+func NewChecker(ctx context.Context, g Groups, cfg *Config, w relay.WebhookMessager) *Checker {
+	return &Checker{
+		ctx:    ctx,
+		groups: g,
+		w:      w,
+		config: cfg,
+		now:    time.Now,
+	}
+}
+
+// SetProjection checks the projected group state too
+func (c *Checker) SetProjection(p Projection) {
+	c.projection = p
+}
+
+// Start runs a check every interval
+func (c *Checker) Start() error {
+	log.Default().Println("starting group consistency checker")
+
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			log.Default().Println("stopping group consistency checker")
+			return nil
+		case <-ticker.C:
+			report := c.Run()
+
+			if len(report.Divergences) > 0 {
+				c.w.NotifyWarning(c.ctx, fmt.Errorf("group check found %d divergences in %d groups, %d repaired", len(report.Divergences), divergentGroups(report), report.Repaired))
+			}
+
+			for _, e := range report.Errors {
+				c.w.NotifyError(c.ctx, fmt.Errorf("group check: %s", e))
+			}
+		}
+	}
+}
+
+// Run replays every group once and compares it, the report is kept as the latest one
+func (c *Checker) Run() *Report {
+	start := c.now()
+
+	report := &Report{
+		CheckedAt:   start.UTC(),
+		Repair:      c.config.Repair,
+		Divergences: []*Divergence{},
+	}
+
+	states, err := c.groups.ReplayGroups(c.ctx)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("replay: %s", err))
+	}
+
+	ids := make([]string, 0, len(states))
+	for groupID := range states {
+		ids = append(ids, groupID)
+	}
+	slices.Sort(ids)
+
+	for _, groupID := range ids {
+		report.Groups++
+
+		repaired, err := c.check(report, groupID, states[groupID])
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", groupID, err))
+		}
+
+		if repaired {
+			report.Repaired++
+		}
+	}
+
+	report.Duration = c.now().Sub(start).Seconds()
+
+	c.mu.Lock()
+	c.last = report
+	c.mu.Unlock()
+
+	return report
+}
+
+// Last returns the latest report or nil if no check ran yet
+func (c *Checker) Last() *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.last
+}
+
+// check compares a replayed group to its lists and projection, it tells whether it was repaired
+func (c *Checker) check(report *Report, groupID string, s *groups.GroupState) (bool, error) {
+	divergent := len(report.Divergences)
+
+	admins, err := c.groups.GetAdmins(c.ctx, groupID)
+	if err != nil {
+		return false, err
+	}
+
+	members, err := c.groups.GetMembers(c.ctx, groupID)
+	if err != nil {
+		return false, err
+	}
+
+	compare(report, groupID, "admins list", s.Admins, admins)
+	compare(report, groupID, "members list", s.Members, members)
+
+	listsDiverge := len(report.Divergences) > divergent
+	if listsDiverge && c.config.Repair {
+		c.groups.PublishLists(c.ctx, groupID, s)
+	}
+
+	if c.projection == nil {
+		return listsDiverge && c.config.Repair, nil
+	}
+
+	divergent = len(report.Divergences)
+
+	projected, err := c.projection.GetGroupMembers(groupID)
+	if err != nil {
+		return false, err
+	}
+
+	expected := map[string]string{}
+	for _, pubkey := range s.Members {
+		expected[pubkey] = groups.RoleMember
+	}
+	for _, pubkey := range s.Admins {
+		expected[pubkey] = groups.RoleAdmin
+	}
+
+	found := map[string]string{}
+	for _, m := range projected {
+		found[m.Pubkey] = m.Role
+	}
+
+	// removals come before puts so that a wrong role is replaced rather than kept
+	fix := &relay.GroupChange{GroupID: groupID, At: c.now().UTC()}
+	put := &relay.GroupChange{GroupID: groupID, At: fix.At}
+
+	for _, pubkey := range sortedKeys(expected) {
+		role := expected[pubkey]
+		switch got, ok := found[pubkey]; {
+		case !ok:
+			report.add(groupID, SourceProjection, pubkey, fmt.Sprintf("missing, expected %s", role))
+			put.Put = append(put.Put, &relay.GroupMember{GroupID: groupID, Pubkey: pubkey, Role: role})
+		case got != role:
+			report.add(groupID, SourceProjection, pubkey, fmt.Sprintf("projected as %s, expected %s", got, role))
+			fix.Removed = append(fix.Removed, pubkey)
+			put.Put = append(put.Put, &relay.GroupMember{GroupID: groupID, Pubkey: pubkey, Role: role})
+		}
+	}
+
+	for _, pubkey := range sortedKeys(found) {
+		if _, ok := expected[pubkey]; !ok {
+			report.add(groupID, SourceProjection, pubkey, fmt.Sprintf("projected as %s, expected no membership", found[pubkey]))
+			fix.Removed = append(fix.Removed, pubkey)
+		}
+	}
+
+	projectionDiverges := len(report.Divergences) > divergent
+	if projectionDiverges && c.config.Repair {
+		for _, change := range []*relay.GroupChange{fix, put} {
+			err = c.projection.ApplyGroupChange(change)
+			if err != nil {
+				return listsDiverge, err
+			}
+		}
+	}
+
+	return (listsDiverge || projectionDiverges) && c.config.Repair, nil
+}
+
+// compare reports the pubkeys a list misses or has in excess
+func compare(report *Report, groupID, list string, expected, found []string) {
+	for _, pubkey := range expected {
+		if !slices.Contains(found, pubkey) {
+			report.add(groupID, SourceLists, pubkey, "missing from the "+list)
+		}
+	}
+
+	for _, pubkey := range found {
+		if !slices.Contains(expected, pubkey) {
+			report.add(groupID, SourceLists, pubkey, "not expected in the "+list)
+		}
+	}
+}
+
+func divergentGroups(report *Report) int {
+	seen := map[string]bool{}
+	for _, d := range report.Divergences {
+		seen[d.GroupID] = true
+	}
+
+	return len(seen)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
@@ -0,0 +1,124 @@
+package groupcheck
+
+import (
+	"context"
+	"testing"
+
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+)
+
+// fakeGroups lists the admins and members of the shared fake and replays its own states
+type fakeGroups struct {
+	testutil.FakeGroups
+
+	replayed  map[string]*groups.GroupState
+	published []string
+}
+
+func (f *fakeGroups) ReplayGroups(ctx context.Context) (map[string]*groups.GroupState, error) {
+	return f.replayed, nil
+}
+
+func (f *fakeGroups) PublishLists(ctx context.Context, groupID string, s *groups.GroupState) {
+	f.published = append(f.published, groupID)
+	f.Admins[groupID] = s.Admins
+	f.Members[groupID] = s.Members
+}
+
+type fakeProjection struct {
+	members map[string]string // pubkey -> role, of a single group
+}
+
+func (f *fakeProjection) GetGroupMembers(groupID string) ([]*relay.GroupMember, error) {
+	members := []*relay.GroupMember{}
+	for pubkey, role := range f.members {
+		members = append(members, &relay.GroupMember{GroupID: groupID, Pubkey: pubkey, Role: role})
+	}
+
+	return members, nil
+}
+
+func (f *fakeProjection) ApplyGroupChange(c *relay.GroupChange) error {
+	for _, pubkey := range c.Removed {
+		delete(f.members, pubkey)
+	}
+
+	for _, m := range c.Put {
+		f.members[m.Pubkey] = m.Role
+	}
+
+	return nil
+}
+
+func newChecker(repair bool) (*Checker, *fakeGroups, *fakeProjection) {
+	g := &fakeGroups{
+		replayed: map[string]*groups.GroupState{
+			"demo": {Admins: []string{"alice"}, Members: []string{"bob", "carol"}},
+		},
+		FakeGroups: testutil.FakeGroups{
+			Admins:  map[string][]string{"demo": {"alice"}},
+			Members: map[string][]string{"demo": {"bob", "dave"}},
+		},
+	}
+
+	p := &fakeProjection{members: map[string]string{"alice": groups.RoleMember, "bob": groups.RoleMember, "carol": groups.RoleMember, "erin": groups.RoleMember}}
+
+	c := NewChecker(context.Background(), g, &Config{Repair: repair}, nil)
+	c.SetProjection(p)
+
+	return c, g, p
+}
+
+func TestRun(t *testing.T) {
+	c, g, _ := newChecker(false)
+
+	report := c.Run()
+	if report.Groups != 1 || report.Repaired != 0 || len(report.Errors) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// carol is missing from the members list and dave listed, alice is projected as a member and
+	// erin still projected
+	want := map[Source]map[string]bool{
+		SourceLists:      {"carol": true, "dave": true},
+		SourceProjection: {"alice": true, "erin": true},
+	}
+
+	if len(report.Divergences) != 4 {
+		t.Fatalf("expected 4 divergences, got %d", len(report.Divergences))
+	}
+
+	for _, d := range report.Divergences {
+		if !want[d.Source][d.Pubkey] {
+			t.Errorf("unexpected divergence %+v", d)
+		}
+	}
+
+	if len(g.published) != 0 {
+		t.Fatal("expected nothing to be repaired")
+	}
+
+	if c.Last() != report {
+		t.Fatal("expected the report to be kept")
+	}
+}
+
+func TestRepair(t *testing.T) {
+	c, g, p := newChecker(true)
+
+	report := c.Run()
+	if report.Repaired != 1 || len(g.published) != 1 {
+		t.Fatalf("expected the group to be repaired, got %+v", report)
+	}
+
+	if p.members["alice"] != groups.RoleAdmin || p.members["erin"] != "" || len(p.members) != 3 {
+		t.Fatalf("expected the projection to be corrected, got %v", p.members)
+	}
+
+	report = c.Run()
+	if len(report.Divergences) != 0 || report.Repaired != 0 {
+		t.Fatalf("expected no divergence after the repair, got %+v", report.Divergences)
+	}
+}
@@ -0,0 +1,31 @@
+package groupcheck
+
+import (
+	"net/http"
+
+	com "github.com/comunifi/relay/pkg/common"
+)
+
+type Handlers struct {
+	c *Checker
+}
+
+func NewHandlers(c *Checker) *Handlers {
+	return &Handlers{
+		c: c,
+	}
+}
+
+// Get returns the report of the latest group consistency check
+func (h *Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	report := h.c.Last()
+	if report == nil {
+		http.Error(w, "no group check ran yet", http.StatusNotFound)
+		return
+	}
+
+	err := com.Body(w, report, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
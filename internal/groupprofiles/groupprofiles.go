@@ -0,0 +1,229 @@
+// Package groupprofiles gives every group its own public-facing identity, so that a relay hosting
+// several communities doesn't present the same generic identity everywhere.
+//
+// The relay derives a key for each group from its own key, the profile of a group is published
+// as the kind 0 of that key. Keys are derived again whenever they are needed and never stored,
+// the same relay key always gives a group the same pubkey. Group admins set the profile with a
+// signed request and operators under /v1/admin.
+package groupprofiles
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/eventstore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	maxNameLength        = 100
+	maxDescriptionLength = 1000
+	maxContactLength     = 200
+)
+
+var (
+	ErrInvalidProfile = errors.New("invalid profile")
+	ErrNotFound       = errors.New("group has no profile")
+)
+
+// Groups decides who administers a group
+type Groups interface {
+	IsAdmin(ctx context.Context, pubkey, groupID string) (bool, error)
+}
+
+// Publisher stores and broadcasts the profiles signed with the keys of groups
+type Publisher interface {
+	ReplaceSignedEvent(ctx context.Context, ev *nostr.Event) error
+}
+
+// content is the kind 0 content of a group profile
+type content struct {
+	Name    string `json:"name"`
+	About   string `json:"about,omitempty"`
+	Picture string `json:"picture,omitempty"`
+	Contact string `json:"contact,omitempty"`
+}
+
+type Service struct {
+	store     eventstore.Store
+	n         Publisher
+	groups    Groups
+	secretKey []byte // of the relay, the keys of groups are derived from it
+
+	now func() time.Time
+}
+
+func NewService(store eventstore.Store, n Publisher, groups Groups, relaySecretKey string) (*Service, error) {
+	sk, err := hex.DecodeString(relaySecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay key: %w", err)
+	}
+
+	return &Service{
+		store:     store,
+		n:         n,
+		groups:    groups,
+		secretKey: sk,
+		now:       time.Now,
+	}, nil
+}
+
+// Key returns the key the relay derives for a group
+func (s *Service) Key(groupID string) (string, string, error) {
+	mac := hmac.New(sha256.New, s.secretKey)
+	mac.Write([]byte("group-profile:" + groupID))
+
+	sk := hex.EncodeToString(mac.Sum(nil))
+
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		return "", "", err
+	}
+
+	return sk, pk, nil
+}
+
+// Get returns the published profile of a group
+func (s *Service) Get(ctx context.Context, groupID string) (*relay.GroupProfile, error) {
+	_, pk, err := s.Key(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := s.latest(ctx, pk)
+	if err != nil {
+		return nil, err
+	}
+
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+
+	var c content
+	err = json.Unmarshal([]byte(latest.Content), &c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &relay.GroupProfile{
+		Pubkey:      pk,
+		Name:        c.Name,
+		Description: c.About,
+		Icon:        c.Picture,
+		Contact:     c.Contact,
+	}, nil
+}
+
+// Publish signs the profile of a group with its key and replaces the published one
+func (s *Service) Publish(ctx context.Context, groupID string, p *relay.GroupProfile) (*relay.GroupProfile, error) {
+	p, err := normalize(p)
+	if err != nil {
+		return nil, err
+	}
+
+	sk, pk, err := s.Key(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(&content{
+		Name:    p.Name,
+		About:   p.Description,
+		Picture: p.Icon,
+		Contact: p.Contact,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ev := &nostr.Event{
+		Kind:      nostr.KindProfileMetadata,
+		CreatedAt: nostr.Timestamp(s.now().Unix()),
+		Tags:      nostr.Tags{},
+		Content:   string(b),
+	}
+
+	// an update within the same second as the published profile must still replace it
+	previous, err := s.latest(ctx, pk)
+	if err != nil {
+		return nil, err
+	}
+
+	if previous != nil && previous.CreatedAt >= ev.CreatedAt {
+		ev.CreatedAt = previous.CreatedAt + 1
+	}
+
+	err = ev.Sign(sk)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.n.ReplaceSignedEvent(ctx, ev)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Pubkey = pk
+	return p, nil
+}
+
+// latest returns the published profile event of a group key, nil if there is none
+func (s *Service) latest(ctx context.Context, pk string) (*nostr.Event, error) {
+	ch, err := s.store.QueryEvents(ctx, nostr.Filter{
+		Kinds:   []int{nostr.KindProfileMetadata},
+		Authors: []string{pk},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *nostr.Event
+	for ev := range ch {
+		if latest == nil || ev.CreatedAt > latest.CreatedAt {
+			latest = ev
+		}
+	}
+
+	return latest, nil
+}
+
+// normalize trims a profile and checks its fields
+func normalize(p *relay.GroupProfile) (*relay.GroupProfile, error) {
+	n := &relay.GroupProfile{
+		Name:        strings.TrimSpace(p.Name),
+		Description: strings.TrimSpace(p.Description),
+		Icon:        strings.TrimSpace(p.Icon),
+		Contact:     strings.TrimSpace(p.Contact),
+	}
+
+	if n.Name == "" || utf8.RuneCountInString(n.Name) > maxNameLength {
+		return nil, fmt.Errorf("%w: the name must have between 1 and %d characters", ErrInvalidProfile, maxNameLength)
+	}
+
+	if utf8.RuneCountInString(n.Description) > maxDescriptionLength {
+		return nil, fmt.Errorf("%w: the description must have at most %d characters", ErrInvalidProfile, maxDescriptionLength)
+	}
+
+	if utf8.RuneCountInString(n.Contact) > maxContactLength {
+		return nil, fmt.Errorf("%w: the contact must have at most %d characters", ErrInvalidProfile, maxContactLength)
+	}
+
+	if n.Icon != "" {
+		u, err := url.Parse(n.Icon)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("%w: the icon must be an https url", ErrInvalidProfile)
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,87 @@
+package groupprofiles
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/eventstore/slicestore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type testPublisher struct {
+	store *slicestore.SliceStore
+}
+
+func (p *testPublisher) ReplaceSignedEvent(ctx context.Context, ev *nostr.Event) error {
+	return p.store.ReplaceEvent(ctx, ev)
+}
+
+func newService(t *testing.T) *Service {
+	store := &slicestore.SliceStore{}
+	store.Init()
+
+	s, err := NewService(store, &testPublisher{store}, nil, nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.now = func() time.Time { return time.Unix(1000, 0) }
+
+	return s
+}
+
+func TestKey(t *testing.T) {
+	s := newService(t)
+
+	_, pk, err := s.Key("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, again, _ := s.Key("demo")
+	_, other, _ := s.Key("other")
+	if pk != again || pk == other {
+		t.Fatalf("expected a stable key per group, got %s %s %s", pk, again, other)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	s := newService(t)
+	ctx := context.Background()
+
+	_, err := s.Get(ctx, "demo")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected no profile yet, got %v", err)
+	}
+
+	for _, name := range []string{" First ", "Second"} {
+		_, err = s.Publish(ctx, "demo", &relay.GroupProfile{Name: name, Icon: "https://example.com/icon.png"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// both were published within the same second, the second still replaces the first
+	p, err := s.Get(ctx, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, pk, _ := s.Key("demo")
+	if p.Name != "Second" || p.Icon != "https://example.com/icon.png" || p.Pubkey != pk {
+		t.Fatalf("unexpected profile %+v", p)
+	}
+
+	for _, invalid := range []*relay.GroupProfile{
+		{Name: "  "},
+		{Name: "demo", Icon: "http://example.com/icon.png"},
+	} {
+		_, err = s.Publish(ctx, "demo", invalid)
+		if !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("expected %+v to be invalid, got %v", invalid, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package groupprofiles
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/go-chi/chi/v5"
+)
+
+// GetProfile godoc
+//
+//	@Summary		Get the profile of a group
+//	@Description	the public-facing identity of a group and the pubkey its kind 0 is published with
+//	@Tags			groups
+//	@Produce		json
+//	@Param			group_id	path		string	true	"Group ID"
+//	@Success		200			{object}	common.Response
+//	@Failure		404
+//	@Failure		500
+//	@Router			/v1/groups/{group_id}/profile [get]
+func (s *Service) GetProfile(w http.ResponseWriter, r *http.Request) {
+	p, err := s.Get(r.Context(), chi.URLParam(r, "group_id"))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, p, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// SetProfile godoc
+//
+//	@Summary		Set the profile of a group
+//	@Description	publishes the profile as the kind 0 of the key of the group, for its admins
+//	@Tags			groups
+//	@Accept			json
+//	@Produce		json
+//	@Param			group_id	path		string		true	"Group ID"
+//	@Param			request		body		nostr.Event	true	"Request event signed by an admin, its content a relay.GroupProfile"
+//	@Success		200			{object}	common.Response
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/v1/groups/{group_id}/profile [post]
+func (s *Service) SetProfile(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "group_id")
+
+	var req relay.GroupProfile
+	_, err := com.ParseAdminRequest(r, s.groups, groupID, s.now(), &req)
+	if err != nil {
+		com.WriteAdminRequestError(w, err)
+		return
+	}
+
+	s.publish(w, r, groupID, &req)
+}
+
+// PutProfile godoc
+//
+//	@Summary		Set the profile of a group
+//	@Description	publishes the profile as the kind 0 of the key of the group, for operators hosting the community
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			group_id	path		string				true	"Group ID"
+//	@Param			profile		body		relay.GroupProfile	true	"Profile"
+//	@Success		200			{object}	common.Response
+//	@Failure		400
+//	@Failure		401
+//	@Failure		500
+//	@Router			/v1/admin/groups/{group_id}/profile [put]
+func (s *Service) PutProfile(w http.ResponseWriter, r *http.Request) {
+	var req relay.GroupProfile
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	s.publish(w, r, chi.URLParam(r, "group_id"), &req)
+}
+
+func (s *Service) publish(w http.ResponseWriter, r *http.Request, groupID string, req *relay.GroupProfile) {
+	p, err := s.Publish(r.Context(), groupID, req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidProfile) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, p, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,282 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// NIP-52 calendar event kinds, posted into a group with an h tag
+// https://github.com/nostr-protocol/nips/blob/master/52.md
+const (
+	KindCalendarDate = 31922 // All-day or multi-day event
+	KindCalendarTime = 31923 // Event at a point in time
+	KindCalendarRSVP = 31925 // Response to a calendar event
+
+	// Relay-generated list of the upcoming calendar events of a group, not part of NIP-29
+	KindGroupUpcoming = 39031
+)
+
+const (
+	// most calendar events read for a group at once, the default query limit of the event store
+	maxCalendarEvents = 100
+
+	// most events listed in the upcoming events of a group
+	maxUpcomingEvents = 50
+
+	calendarDateLayout = "2006-01-02"
+)
+
+var rsvpStatuses = []string{"accepted", "declined", "tentative"}
+
+// CalendarEvent is a date or time based NIP-52 calendar event
+type CalendarEvent struct {
+	Event    *nostr.Event
+	Title    string
+	Summary  string
+	Location string
+
+	// Start and End are in UTC, End is exclusive and always set: all-day events without an end
+	// last one day and events at a point in time without an end last no time
+	Start  time.Time
+	End    time.Time
+	AllDay bool
+}
+
+// Address returns the coordinate other events use to refer to the calendar event
+func (c *CalendarEvent) Address() string {
+	return fmt.Sprintf("%d:%s:%s", c.Event.Kind, c.Event.PubKey, c.Event.Tags.GetD())
+}
+
+// ParseCalendarEvent reads a date or time based calendar event, an error means the event is invalid
+func ParseCalendarEvent(event *nostr.Event) (*CalendarEvent, error) {
+	if event.Kind != KindCalendarDate && event.Kind != KindCalendarTime {
+		return nil, errors.New("not a calendar event")
+	}
+
+	if event.Tags.GetD() == "" {
+		return nil, errors.New("calendar event must have a d tag")
+	}
+
+	c := &CalendarEvent{
+		Event:    event,
+		Title:    tagValue(event, "title"),
+		Summary:  tagValue(event, "summary"),
+		Location: tagValue(event, "location"),
+		AllDay:   event.Kind == KindCalendarDate,
+	}
+
+	// older clients still use the name tag for the title
+	if c.Title == "" {
+		c.Title = tagValue(event, "name")
+	}
+
+	if c.Title == "" {
+		return nil, errors.New("calendar event must have a title")
+	}
+
+	start, end := tagValue(event, "start"), tagValue(event, "end")
+	if start == "" {
+		return nil, errors.New("calendar event must have a start")
+	}
+
+	var err error
+	if c.AllDay {
+		c.Start, err = time.Parse(calendarDateLayout, start)
+		if err != nil {
+			return nil, errors.New("start of a date based calendar event must be a YYYY-MM-DD date")
+		}
+
+		c.End = c.Start.AddDate(0, 0, 1)
+		if end != "" {
+			c.End, err = time.Parse(calendarDateLayout, end)
+			if err != nil {
+				return nil, errors.New("end of a date based calendar event must be a YYYY-MM-DD date")
+			}
+		}
+	} else {
+		c.Start, err = parseUnix(start)
+		if err != nil {
+			return nil, errors.New("start of a time based calendar event must be a unix timestamp")
+		}
+
+		c.End = c.Start
+		if end != "" {
+			c.End, err = parseUnix(end)
+			if err != nil {
+				return nil, errors.New("end of a time based calendar event must be a unix timestamp")
+			}
+		}
+
+		for _, tz := range []string{"start_tzid", "end_tzid"} {
+			tzid := tagValue(event, tz)
+			if tzid == "" {
+				continue
+			}
+
+			_, err = time.LoadLocation(tzid)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an IANA time zone", tz)
+			}
+		}
+	}
+
+	if c.End.Before(c.Start) || (c.AllDay && !c.End.After(c.Start)) {
+		return nil, errors.New("calendar event must end after it starts")
+	}
+
+	return c, nil
+}
+
+// validateCalendarEvent validates calendar events and rsvps posted into a group
+func (g *GroupsService) validateCalendarEvent(ctx context.Context, event *nostr.Event) (bool, string) {
+	if !hasHTag(event) {
+		// Calendar events outside of groups are not checked
+		return false, ""
+	}
+
+	if event.Kind == KindCalendarRSVP {
+		err := validateRSVP(event)
+		if err != nil {
+			return true, "invalid: " + err.Error()
+		}
+	} else {
+		_, err := ParseCalendarEvent(event)
+		if err != nil {
+			return true, "invalid: " + err.Error()
+		}
+	}
+
+	return g.validateGroupContent(ctx, event)
+}
+
+// validateRSVP checks that an rsvp refers to a calendar event and has a known status
+func validateRSVP(event *nostr.Event) error {
+	if event.Tags.GetD() == "" {
+		return errors.New("rsvp must have a d tag")
+	}
+
+	a := tagValue(event, "a")
+	kind, _, ok := strings.Cut(a, ":")
+	if !ok || (kind != strconv.Itoa(KindCalendarDate) && kind != strconv.Itoa(KindCalendarTime)) {
+		return errors.New("rsvp must refer to a calendar event with an a tag")
+	}
+
+	if !slices.Contains(rsvpStatuses, tagValue(event, "status")) {
+		return errors.New("rsvp status must be accepted, declined or tentative")
+	}
+
+	return nil
+}
+
+// CalendarEvents returns the calendar events of a group that end after since, sorted by start.
+// Only the latest version of each event is kept.
+func (g *GroupsService) CalendarEvents(ctx context.Context, groupID string, since time.Time) ([]*CalendarEvent, error) {
+	filter := nostr.Filter{
+		Kinds: []int{KindCalendarDate, KindCalendarTime},
+		Tags:  nostr.TagMap{"h": []string{groupID}},
+		Limit: maxCalendarEvents,
+	}
+
+	events, err := g.eventStore.QueryEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := map[string]*CalendarEvent{}
+	for evt := range events {
+		c, err := ParseCalendarEvent(evt)
+		if err != nil {
+			continue
+		}
+
+		prev, ok := latest[c.Address()]
+		if ok && prev.Event.CreatedAt >= evt.CreatedAt {
+			continue
+		}
+
+		latest[c.Address()] = c
+	}
+
+	calendar := []*CalendarEvent{}
+	for _, c := range latest {
+		if c.End.Before(since) {
+			continue
+		}
+
+		calendar = append(calendar, c)
+	}
+
+	slices.SortFunc(calendar, func(a, b *CalendarEvent) int {
+		if c := a.Start.Compare(b.Start); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Address(), b.Address())
+	})
+
+	return calendar, nil
+}
+
+// generateUpcomingList replaces the kind 39031 list of the upcoming calendar events of a group,
+// it is refreshed whenever a calendar event of the group is saved
+func (g *GroupsService) generateUpcomingList(ctx context.Context, groupID string) {
+	calendar, err := g.CalendarEvents(ctx, groupID, time.Now())
+	if err != nil {
+		log.Printf("Error getting calendar events: %v", err)
+		return
+	}
+
+	if len(calendar) > maxUpcomingEvents {
+		calendar = calendar[:maxUpcomingEvents]
+	}
+
+	tags := nostr.Tags{
+		{"d", groupID},
+	}
+
+	for _, c := range calendar {
+		tags = append(tags, nostr.Tag{"a", c.Address()})
+	}
+
+	event := &nostr.Event{
+		Kind:      KindGroupUpcoming,
+		PubKey:    g.relayPubkey,
+		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		Tags:      tags,
+		Content:   "",
+	}
+
+	if err := event.Sign(g.relaySecretKey); err != nil {
+		log.Printf("Error signing upcoming events list: %v", err)
+		return
+	}
+
+	// the list is addressable, older versions would otherwise be served alongside it
+	if err := g.eventStore.ReplaceEvent(ctx, event); err != nil {
+		log.Printf("Error saving upcoming events list: %v", err)
+	}
+}
+
+func tagValue(event *nostr.Event, name string) string {
+	tag := event.Tags.GetFirst([]string{name, ""})
+	if tag != nil && len(*tag) >= 2 {
+		return (*tag)[1]
+	}
+	return ""
+}
+
+func parseUnix(s string) (time.Time, error) {
+	ts, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(ts, 0).UTC(), nil
+}
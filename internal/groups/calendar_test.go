@@ -0,0 +1,140 @@
+package groups
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestParseCalendarEvent(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		kind  int
+		tags  nostr.Tags
+		valid bool
+	}{
+		{"date", KindCalendarDate, nostr.Tags{{"d", "a"}, {"title", "Fair"}, {"start", "2025-02-10"}}, true},
+		{"date range", KindCalendarDate, nostr.Tags{{"d", "a"}, {"title", "Fair"}, {"start", "2025-02-10"}, {"end", "2025-02-12"}}, true},
+		{"name as title", KindCalendarDate, nostr.Tags{{"d", "a"}, {"name", "Fair"}, {"start", "2025-02-10"}}, true},
+		{"date ends on start", KindCalendarDate, nostr.Tags{{"d", "a"}, {"title", "Fair"}, {"start", "2025-02-10"}, {"end", "2025-02-10"}}, false},
+		{"date with time", KindCalendarDate, nostr.Tags{{"d", "a"}, {"title", "Fair"}, {"start", "1740853800"}}, false},
+		{"time", KindCalendarTime, nostr.Tags{{"d", "a"}, {"title", "Meetup"}, {"start", "1740853800"}, {"start_tzid", "Europe/Brussels"}}, true},
+		{"time ends before start", KindCalendarTime, nostr.Tags{{"d", "a"}, {"title", "Meetup"}, {"start", "1740853800"}, {"end", "1740850000"}}, false},
+		{"unknown time zone", KindCalendarTime, nostr.Tags{{"d", "a"}, {"title", "Meetup"}, {"start", "1740853800"}, {"end_tzid", "Mars/Olympus"}}, false},
+		{"time with date", KindCalendarTime, nostr.Tags{{"d", "a"}, {"title", "Meetup"}, {"start", "2025-02-10"}}, false},
+		{"no title", KindCalendarTime, nostr.Tags{{"d", "a"}, {"start", "1740853800"}}, false},
+		{"no start", KindCalendarTime, nostr.Tags{{"d", "a"}, {"title", "Meetup"}}, false},
+		{"no d tag", KindCalendarTime, nostr.Tags{{"title", "Meetup"}, {"start", "1740853800"}}, false},
+	} {
+		_, err := ParseCalendarEvent(&nostr.Event{Kind: tc.kind, Tags: tc.tags})
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: expected valid=%t, got %v", tc.name, tc.valid, err)
+		}
+	}
+}
+
+func TestValidateRSVP(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		tags  nostr.Tags
+		valid bool
+	}{
+		{"accepted", nostr.Tags{{"d", "r"}, {"a", "31923:pk:a"}, {"status", "accepted"}}, true},
+		{"unknown status", nostr.Tags{{"d", "r"}, {"a", "31923:pk:a"}, {"status", "maybe"}}, false},
+		{"not a calendar event", nostr.Tags{{"d", "r"}, {"a", "30023:pk:a"}, {"status", "declined"}}, false},
+		{"no a tag", nostr.Tags{{"d", "r"}, {"status", "tentative"}}, false},
+	} {
+		err := validateRSVP(&nostr.Event{Kind: KindCalendarRSVP, Tags: tc.tags})
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: expected valid=%t, got %v", tc.name, tc.valid, err)
+		}
+	}
+}
+
+func TestUpcomingList(t *testing.T) {
+	g, ndb := newTestGroupsService(t)
+	ctx := context.Background()
+
+	admin := newTestKey(t)
+	stranger := newTestKey(t)
+
+	publish(t, g, ndb, admin, &nostr.Event{
+		Kind: KindCreateGroup,
+		Tags: nostr.Tags{{"h", "test"}, {"name", "Test"}},
+	})
+
+	at := func(d time.Duration) string {
+		return strconv.FormatInt(time.Now().Add(d).Unix(), 10)
+	}
+
+	ev := &nostr.Event{
+		Kind:      KindCalendarTime,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"h", "test"}, {"d", "meetup"}, {"title", "Meetup"}, {"start", at(time.Hour)}},
+	}
+	err := ev.Sign(stranger.sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reject, _ := g.ValidateEvent(ctx, ev)
+	if !reject {
+		t.Fatal("expected strangers to be rejected")
+	}
+
+	invalid := &nostr.Event{Kind: KindCalendarTime, Tags: nostr.Tags{{"h", "test"}, {"d", "x"}, {"start", at(time.Hour)}}}
+	err = invalid.Sign(admin.sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reject, _ = g.ValidateEvent(ctx, invalid)
+	if !reject {
+		t.Fatal("expected an event without a title to be rejected")
+	}
+
+	publish(t, g, ndb, admin, &nostr.Event{
+		Kind: KindCalendarTime,
+		Tags: nostr.Tags{{"h", "test"}, {"d", "past"}, {"title", "Past"}, {"start", at(-2 * time.Hour)}, {"end", at(-time.Hour)}},
+	})
+	publish(t, g, ndb, admin, &nostr.Event{
+		Kind: KindCalendarTime,
+		Tags: nostr.Tags{{"h", "test"}, {"d", "later"}, {"title", "Later"}, {"start", at(2 * time.Hour)}},
+	})
+	publish(t, g, ndb, admin, &nostr.Event{
+		Kind: KindCalendarTime,
+		Tags: nostr.Tags{{"h", "test"}, {"d", "sooner"}, {"title", "Sooner"}, {"start", at(time.Hour)}},
+	})
+
+	events, err := ndb.QueryEvents(ctx, nostr.Filter{Kinds: []int{KindGroupUpcoming}, Tags: nostr.TagMap{"d": []string{"test"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lists := []*nostr.Event{}
+	for ev := range events {
+		lists = append(lists, ev)
+	}
+
+	if len(lists) != 1 {
+		t.Fatalf("expected a single upcoming list, got %d", len(lists))
+	}
+
+	got := []string{}
+	for _, tag := range lists[0].Tags {
+		if tag[0] == "a" {
+			got = append(got, tag[1])
+		}
+	}
+
+	want := []string{
+		strconv.Itoa(KindCalendarTime) + ":" + admin.pk + ":sooner",
+		strconv.Itoa(KindCalendarTime) + ":" + admin.pk + ":later",
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("expected upcoming events %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,117 @@
+package groups
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// validateCreateInvite validates an invite code created by an admin (kind 9009)
+// A code can be used by several people until the group has no invite with that code anymore
+func (g *GroupsService) validateCreateInvite(ctx context.Context, event *nostr.Event) (bool, string) {
+	groupID := getHTag(event)
+	if groupID == "" {
+		return true, "missing h tag (group ID)"
+	}
+
+	if tagValue(event, "code") == "" {
+		return true, "missing code tag"
+	}
+
+	isAdmin, err := g.IsAdmin(ctx, event.PubKey, groupID)
+	if err != nil {
+		log.Printf("Error checking admin status: %v", err)
+		return true, "internal error checking permissions"
+	}
+	if !isAdmin {
+		return true, "only admins can create invites"
+	}
+
+	return false, ""
+}
+
+// IsValidInvite checks that an admin of a group created an invite with a code
+func (g *GroupsService) IsValidInvite(ctx context.Context, groupID, code string) (bool, error) {
+	if code == "" {
+		return false, nil
+	}
+
+	// the code is not a single letter tag, invites are matched here rather than in the filter
+	filter := nostr.Filter{
+		Kinds: []int{KindCreateInvite},
+		Tags:  nostr.TagMap{"h": []string{groupID}},
+	}
+
+	events, err := g.eventStore.QueryEvents(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+
+	for evt := range events {
+		if tagValue(evt, "code") != code {
+			continue
+		}
+
+		// the invite no longer counts once its author stopped being an admin
+		isAdmin, err := g.IsAdmin(ctx, evt.PubKey, groupID)
+		if err != nil {
+			return false, err
+		}
+		if isAdmin {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// handleJoinRequest adds the author of a join request with a valid invite code to the group,
+// with a put-user event signed by the relay
+func (g *GroupsService) handleJoinRequest(ctx context.Context, event *nostr.Event) {
+	groupID := getHTag(event)
+	code := tagValue(event, "code")
+	if groupID == "" || code == "" {
+		return
+	}
+
+	isMember, err := g.IsMember(ctx, event.PubKey, groupID)
+	if err != nil {
+		log.Printf("Error checking member status: %v", err)
+		return
+	}
+	if isMember {
+		return
+	}
+
+	valid, err := g.IsValidInvite(ctx, groupID, code)
+	if err != nil {
+		log.Printf("Error checking invite: %v", err)
+		return
+	}
+	if !valid {
+		return
+	}
+
+	putUser := &nostr.Event{
+		Kind:      KindPutUser,
+		PubKey:    g.relayPubkey,
+		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		Tags:      nostr.Tags{{"h", groupID}, {"p", event.PubKey, RoleMember}},
+		Content:   "invite",
+	}
+
+	if err := putUser.Sign(g.relaySecretKey); err != nil {
+		log.Printf("Error signing put-user event: %v", err)
+		return
+	}
+
+	if err := g.save(ctx, putUser); err != nil {
+		log.Printf("Error saving put-user event: %v", err)
+		return
+	}
+
+	g.project(putUser)
+	g.handleUserAdded(ctx, putUser)
+}
@@ -0,0 +1,86 @@
+package groups
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestInvites(t *testing.T) {
+	g, ndb := newTestGroupsService(t)
+	ctx := context.Background()
+
+	admin := newTestKey(t)
+	member := newTestKey(t)
+	invited := newTestKey(t)
+	stranger := newTestKey(t)
+
+	publish(t, g, ndb, admin, &nostr.Event{
+		Kind: KindCreateGroup,
+		Tags: nostr.Tags{{"h", "test"}, {"name", "Test"}},
+	})
+
+	publish(t, g, ndb, admin, &nostr.Event{
+		Kind: KindPutUser,
+		Tags: nostr.Tags{{"h", "test"}, {"p", member.pk, RoleMember}},
+	})
+
+	// only admins create invites
+	memberInvite := &nostr.Event{Kind: KindCreateInvite, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"h", "test"}, {"code", "member-code"}}}
+	if err := memberInvite.Sign(member.sk); err != nil {
+		t.Fatal(err)
+	}
+	if reject, _ := g.ValidateEvent(ctx, memberInvite); !reject {
+		t.Fatal("expected an invite of a member to be rejected")
+	}
+
+	publish(t, g, ndb, admin, &nostr.Event{
+		Kind: KindCreateInvite,
+		Tags: nostr.Tags{{"h", "test"}, {"code", "welcome"}},
+	})
+
+	// a request with a wrong code is rejected rather than left pending
+	wrongCode := &nostr.Event{Kind: KindJoinRequest, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"h", "test"}, {"code", "guess"}}}
+	if err := wrongCode.Sign(stranger.sk); err != nil {
+		t.Fatal(err)
+	}
+	if reject, _ := g.ValidateEvent(ctx, wrongCode); !reject {
+		t.Fatal("expected a join request with an unknown code to be rejected")
+	}
+
+	publish(t, g, ndb, invited, &nostr.Event{
+		Kind: KindJoinRequest,
+		Tags: nostr.Tags{{"h", "test"}, {"code", "welcome"}},
+	})
+
+	publish(t, g, ndb, stranger, &nostr.Event{
+		Kind: KindJoinRequest,
+		Tags: nostr.Tags{{"h", "test"}},
+	})
+
+	for _, tc := range []struct {
+		name   string
+		pubkey string
+		member bool
+	}{
+		{"invited", invited.pk, true},
+		{"stranger", stranger.pk, false},
+	} {
+		isMember, err := g.IsMember(ctx, tc.pubkey, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isMember != tc.member {
+			t.Errorf("%s: expected member=%t, got %t", tc.name, tc.member, isMember)
+		}
+	}
+
+	pending, err := g.PendingJoinRequests(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0] != stranger.pk {
+		t.Fatalf("unexpected pending requests: %v", pending)
+	}
+}
@@ -0,0 +1,51 @@
+package groups
+
+import (
+	"context"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// GetAdmins returns the admins of a group from the relay-generated admins list
+func (g *GroupsService) GetAdmins(ctx context.Context, groupID string) ([]string, error) {
+	return g.getAdmins(ctx, groupID)
+}
+
+// GroupsOf returns the groups a pubkey is a member or an admin of, sorted by id
+func (g *GroupsService) GroupsOf(ctx context.Context, pubkey string) ([]string, error) {
+	filter := nostr.Filter{
+		Kinds:   []int{KindGroupAdmins, KindGroupMembers},
+		Authors: []string{g.relayPubkey},
+		Tags:    nostr.TagMap{"p": []string{pubkey}},
+	}
+
+	events, err := g.eventStore.QueryEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// older lists are kept, every group that listed the pubkey once is checked again
+	candidates := map[string]bool{}
+	for evt := range events {
+		if groupID := evt.Tags.GetD(); groupID != "" {
+			candidates[groupID] = true
+		}
+	}
+
+	groups := []string{}
+	for groupID := range candidates {
+		isMember, err := g.IsMember(ctx, pubkey, groupID)
+		if err != nil {
+			return nil, err
+		}
+
+		if isMember {
+			groups = append(groups, groupID)
+		}
+	}
+
+	slices.Sort(groups)
+
+	return groups, nil
+}
@@ -54,11 +54,32 @@ const (
 	RoleMember = "member"
 )
 
+// Bots decides whether a pubkey that is not a member may post into a group on behalf of an admin,
+// and rejects what bots are never allowed to do whatever their token
+type Bots interface {
+	CanPost(ctx context.Context, pubkey, groupID string) (bool, error)
+	RejectEvent(ctx context.Context, event *nostr.Event) (bool, string)
+}
+
+// Filters rejects or flags the messages of a group that match its keyword filters
+type Filters interface {
+	RejectEvent(ctx context.Context, event *nostr.Event) (bool, string)
+}
+
+// Outbox retries the events the relay generates that fail to be stored
+type Outbox interface {
+	Add(ev *nostr.Event, replace bool, cause error)
+}
+
 // GroupsService handles NIP-29 group enforcement
 type GroupsService struct {
 	eventStore     eventstore.Store
 	relayPubkey    string
 	relaySecretKey string
+	bots           Bots
+	filters        Filters
+	projection     Projection
+	outbox         Outbox
 }
 
 // NewGroupsService creates a new groups service
@@ -70,6 +91,35 @@ func NewGroupsService(eventStore eventstore.Store, relayPubkey, relaySecretKey s
 	}
 }
 
+// SetBots allows bots holding a token minted by a group admin to post into that group
+func (g *GroupsService) SetBots(b Bots) {
+	g.bots = b
+}
+
+// SetFilters filters the content posted to groups by keyword
+func (g *GroupsService) SetFilters(f Filters) {
+	g.filters = f
+}
+
+// SetOutbox retries the metadata, lists and membership events the relay generates when they fail
+// to be stored
+func (g *GroupsService) SetOutbox(o Outbox) {
+	g.outbox = o
+}
+
+// save stores an event the relay generated, it is handed to the outbox if it fails
+func (g *GroupsService) save(ctx context.Context, ev *nostr.Event) error {
+	err := g.eventStore.SaveEvent(ctx, ev)
+	if err == nil || g.outbox == nil {
+		return err
+	}
+
+	log.Printf("Retrying event %s from the outbox: %v", ev.ID, err)
+	g.outbox.Add(ev, false, err)
+
+	return nil
+}
+
 // AddHooks registers NIP-29 enforcement hooks on the relay
 func (g *GroupsService) AddHooks(relay *khatru.Relay) {
 	// Validate events before storing
@@ -78,11 +128,26 @@ func (g *GroupsService) AddHooks(relay *khatru.Relay) {
 	// After storing, generate relay metadata events for group changes
 	relay.OnEventSaved = append(relay.OnEventSaved, g.OnEventSaved)
 
+	// Group tx events are only visible to members
+	relay.RejectFilter = append(relay.RejectFilter, g.RejectTxFilter)
+	relay.PreventBroadcast = append(relay.PreventBroadcast, g.PreventTxBroadcast)
+	for i, query := range relay.QueryEvents {
+		relay.QueryEvents[i] = g.HideTxEvents(query)
+	}
+
 	log.Println("NIP-29 groups enforcement hooks registered")
 }
 
 // ValidateEvent validates incoming events according to NIP-29 rules for closed groups
 func (g *GroupsService) ValidateEvent(ctx context.Context, event *nostr.Event) (reject bool, msg string) {
+	// bots are checked here rather than in a hook of their own so that their tokens can't be skipped
+	if g.bots != nil {
+		reject, msg = g.bots.RejectEvent(ctx, event)
+		if reject {
+			return reject, msg
+		}
+	}
+
 	switch event.Kind {
 	case KindCreateGroup:
 		return g.validateCreateGroup(ctx, event)
@@ -96,12 +161,16 @@ func (g *GroupsService) ValidateEvent(ctx context.Context, event *nostr.Event) (
 		return g.validateDeleteEvent(ctx, event)
 	case KindDeleteGroup:
 		return g.validateDeleteGroup(ctx, event)
+	case KindCreateInvite:
+		return g.validateCreateInvite(ctx, event)
 	case KindJoinRequest:
 		return g.validateJoinRequest(ctx, event)
 	case KindLeaveRequest:
 		return g.validateLeaveRequest(ctx, event)
 	case KindGroupChat, KindGroupReply, KindGroupThreaded, KindGroupChatReply:
 		return g.validateGroupContent(ctx, event)
+	case KindCalendarDate, KindCalendarTime, KindCalendarRSVP:
+		return g.validateCalendarEvent(ctx, event)
 	default:
 		// Check if event has an h tag (group-targeted event)
 		if hasHTag(event) {
@@ -274,7 +343,7 @@ func (g *GroupsService) validateDeleteGroup(ctx context.Context, event *nostr.Ev
 
 // validateJoinRequest validates a request to join a group
 // For closed groups, join requests are stored but don't grant access
-// Admins must explicitly add users via put-user (kind 9000)
+// Admins must explicitly add users via put-user (kind 9000), unless the request has an invite code
 func (g *GroupsService) validateJoinRequest(ctx context.Context, event *nostr.Event) (bool, string) {
 	groupID := getHTag(event)
 	if groupID == "" {
@@ -291,6 +360,18 @@ func (g *GroupsService) validateJoinRequest(ctx context.Context, event *nostr.Ev
 		return true, "group does not exist"
 	}
 
+	// A request with an invite code is accepted by the relay, the code must be valid
+	if code := tagValue(event, "code"); code != "" {
+		valid, err := g.IsValidInvite(ctx, groupID, code)
+		if err != nil {
+			log.Printf("Error checking invite: %v", err)
+			return true, "internal error checking invite"
+		}
+		if !valid {
+			return true, "invalid invite code"
+		}
+	}
+
 	// Allow the join request to be stored (admins can see it and act on it)
 	return false, ""
 }
@@ -331,16 +412,29 @@ func (g *GroupsService) validateGroupContent(ctx context.Context, event *nostr.E
 		log.Printf("Error checking member status: %v", err)
 		return true, "internal error checking membership"
 	}
+	if !isMember && g.bots != nil {
+		isMember, err = g.bots.CanPost(ctx, event.PubKey, groupID)
+		if err != nil {
+			log.Printf("Error checking bot tokens: %v", err)
+			return true, "internal error checking membership"
+		}
+	}
 	if !isMember {
 		return true, "only group members can post content"
 	}
 
+	if g.filters != nil {
+		return g.filters.RejectEvent(ctx, event)
+	}
+
 	return false, ""
 }
 
 // OnEventSaved is called after an event is successfully stored
 // It generates relay metadata events for group changes
 func (g *GroupsService) OnEventSaved(ctx context.Context, event *nostr.Event) {
+	g.project(event)
+
 	switch event.Kind {
 	case KindCreateGroup:
 		g.handleGroupCreated(ctx, event)
@@ -352,6 +446,12 @@ func (g *GroupsService) OnEventSaved(ctx context.Context, event *nostr.Event) {
 		g.handleMetadataEdited(ctx, event)
 	case KindLeaveRequest:
 		g.handleUserLeft(ctx, event)
+	case KindJoinRequest:
+		g.handleJoinRequest(ctx, event)
+	case KindCalendarDate, KindCalendarTime:
+		if groupID := getHTag(event); groupID != "" {
+			g.generateUpcomingList(ctx, groupID)
+		}
 	}
 }
 
@@ -515,7 +615,7 @@ func (g *GroupsService) generateGroupMetadata(ctx context.Context, groupID strin
 		return
 	}
 
-	if err := g.eventStore.SaveEvent(ctx, metadata); err != nil {
+	if err := g.save(ctx, metadata); err != nil {
 		log.Printf("Error saving group metadata event: %v", err)
 	}
 }
@@ -543,7 +643,7 @@ func (g *GroupsService) generateAdminsList(ctx context.Context, groupID string,
 		return
 	}
 
-	if err := g.eventStore.SaveEvent(ctx, event); err != nil {
+	if err := g.save(ctx, event); err != nil {
 		log.Printf("Error saving admins list event: %v", err)
 	}
 }
@@ -571,13 +671,22 @@ func (g *GroupsService) generateMembersList(ctx context.Context, groupID string,
 		return
 	}
 
-	if err := g.eventStore.SaveEvent(ctx, event); err != nil {
+	if err := g.save(ctx, event); err != nil {
 		log.Printf("Error saving members list event: %v", err)
 	}
 }
 
 // IsAdmin checks if a pubkey is an admin of a group
 func (g *GroupsService) IsAdmin(ctx context.Context, pubkey, groupID string) (bool, error) {
+	if g.projection != nil {
+		m, err := g.projection.GetGroupMember(groupID, pubkey)
+		if err != nil {
+			return false, fmt.Errorf("failed to query group members: %w", err)
+		}
+
+		return m != nil && m.Role == RoleAdmin, nil
+	}
+
 	// First check relay-generated admins list (kind 39001)
 	adminsFilter := nostr.Filter{
 		Kinds:   []int{KindGroupAdmins},
@@ -661,6 +770,15 @@ func (g *GroupsService) isAdminFromModEvents(ctx context.Context, pubkey, groupI
 
 // IsMember checks if a pubkey is a member of a group (includes admins)
 func (g *GroupsService) IsMember(ctx context.Context, pubkey, groupID string) (bool, error) {
+	if g.projection != nil {
+		m, err := g.projection.GetGroupMember(groupID, pubkey)
+		if err != nil {
+			return false, fmt.Errorf("failed to query group members: %w", err)
+		}
+
+		return m != nil, nil
+	}
+
 	// Admins are also members
 	isAdmin, err := g.IsAdmin(ctx, pubkey, groupID)
 	if err != nil {
@@ -789,6 +907,11 @@ func (g *GroupsService) groupExists(ctx context.Context, groupID string) (bool,
 	return false, nil
 }
 
+// GroupExists returns true if a group was created or has metadata
+func (g *GroupsService) GroupExists(ctx context.Context, groupID string) (bool, error) {
+	return g.groupExists(ctx, groupID)
+}
+
 // getAdmins returns the list of admin pubkeys for a group
 func (g *GroupsService) getAdmins(ctx context.Context, groupID string) ([]string, error) {
 	adminsFilter := nostr.Filter{
@@ -841,6 +964,11 @@ func (g *GroupsService) getMembers(ctx context.Context, groupID string) ([]strin
 	return members, nil
 }
 
+// GetMembers returns the members of a group from the relay-generated members list
+func (g *GroupsService) GetMembers(ctx context.Context, groupID string) ([]string, error) {
+	return g.getMembers(ctx, groupID)
+}
+
 // Helper functions
 
 func hasHTag(event *nostr.Event) bool {
@@ -0,0 +1,259 @@
+package groups
+
+import (
+	"context"
+	"testing"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/fiatjaf/eventstore/postgresql"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+type testKey struct {
+	sk string
+	pk string
+}
+
+func newTestKey(t *testing.T) testKey {
+	t.Helper()
+
+	sk := nostr.GeneratePrivateKey()
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testKey{sk: sk, pk: pk}
+}
+
+func newTestGroupsService(t *testing.T) (*GroupsService, *postgresql.PostgresBackend) {
+	t.Helper()
+
+	tdb := testdb.New(t)
+
+	ndb := &postgresql.PostgresBackend{DatabaseURL: tdb.URL()}
+	err := ndb.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ndb.Close)
+
+	relayKey := newTestKey(t)
+
+	return NewGroupsService(ndb, relayKey.pk, relayKey.sk), ndb
+}
+
+// publish signs and stores an event, then runs the hooks the relay would run
+func publish(t *testing.T, g *GroupsService, ndb *postgresql.PostgresBackend, key testKey, ev *nostr.Event) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	ev.CreatedAt = nostr.Now()
+	err := ev.Sign(key.sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reject, msg := g.ValidateEvent(ctx, ev)
+	if reject {
+		t.Fatalf("event of kind %d rejected: %s", ev.Kind, msg)
+	}
+
+	err = ndb.SaveEvent(ctx, ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.OnEventSaved(ctx, ev)
+}
+
+func TestGroupMembership(t *testing.T) {
+	g, ndb := newTestGroupsService(t)
+	ctx := context.Background()
+
+	admin := newTestKey(t)
+	member := newTestKey(t)
+	stranger := newTestKey(t)
+
+	publish(t, g, ndb, admin, &nostr.Event{
+		Kind: KindCreateGroup,
+		Tags: nostr.Tags{{"h", "test"}, {"name", "Test"}},
+	})
+
+	exists, err := g.GroupExists(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected group to exist")
+	}
+
+	isAdmin, err := g.IsAdmin(ctx, admin.pk, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isAdmin {
+		t.Fatal("expected creator to be admin")
+	}
+
+	publish(t, g, ndb, admin, &nostr.Event{
+		Kind: KindPutUser,
+		Tags: nostr.Tags{{"h", "test"}, {"p", member.pk, RoleMember}},
+	})
+
+	members, err := g.GetMembers(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0] != member.pk {
+		t.Fatalf("unexpected members: %v", members)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		pubkey string
+		member bool
+	}{
+		{"admin", admin.pk, true},
+		{"member", member.pk, true},
+		{"stranger", stranger.pk, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			isMember, err := g.IsMember(ctx, tc.pubkey, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isMember != tc.member {
+				t.Fatalf("expected member=%t, got %t", tc.member, isMember)
+			}
+		})
+	}
+}
+
+func TestValidateModerationSequence(t *testing.T) {
+	g, ndb := newTestGroupsService(t)
+	ctx := context.Background()
+
+	f := testutil.New()
+	admin := testutil.NewKey("admin")
+	member := testutil.NewKey("member")
+	stranger := testutil.NewKey("stranger")
+
+	create := f.CreateGroup(admin, "test", "Test")
+
+	steps := []struct {
+		name   string
+		ev     *nostr.Event
+		reject bool
+	}{
+		{"join request to missing group", f.JoinRequest(stranger, "test"), true},
+		{"create group", create, false},
+		{"create existing group", f.CreateGroup(stranger, "test", "Other"), true},
+		{"stranger posts", f.Message(stranger, "test", "hi"), true},
+		{"stranger adds user", f.PutUser(stranger, "test", member, RoleMember), true},
+		{"promote non member", f.PutUser(admin, "test", member, RoleAdmin), true},
+		{"admin adds member", f.PutUser(admin, "test", member, RoleMember), false},
+		{"member posts", f.Message(member, "test", "hello", admin), false},
+		{"member edits metadata", f.EditMetadata(member, "test", "Renamed"), true},
+		{"admin edits metadata", f.EditMetadata(admin, "test", "Renamed"), false},
+		{"member deletes group", f.DeleteGroup(member, "test"), true},
+		{"stranger leaves", f.LeaveRequest(stranger, "test"), true},
+		{"stranger asks to join", f.JoinRequest(stranger, "test"), false},
+	}
+
+	// steps run in order, accepted events are stored like the relay would
+	for _, step := range steps {
+		reject, msg := g.ValidateEvent(ctx, step.ev)
+		if reject != step.reject {
+			t.Fatalf("%s: expected reject=%t, got %t (%s)", step.name, step.reject, reject, msg)
+		}
+
+		if reject {
+			continue
+		}
+
+		err := ndb.SaveEvent(ctx, step.ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		g.OnEventSaved(ctx, step.ev)
+	}
+}
+
+func TestHideTxEvents(t *testing.T) {
+	g, ndb := newTestGroupsService(t)
+	ctx := context.Background()
+
+	admin := newTestKey(t)
+	indexer := newTestKey(t)
+
+	publish(t, g, ndb, admin, &nostr.Event{
+		Kind: KindCreateGroup,
+		Tags: nostr.Tags{{"h", "test"}, {"name", "Test"}},
+	})
+
+	grouped := &nostr.Event{Kind: nostreth.KindTxLog, Tags: nostr.Tags{{"h", "test"}}, Content: "grouped"}
+	public := &nostr.Event{Kind: nostreth.KindTxLog, Content: "public"}
+	for _, ev := range []*nostr.Event{grouped, public} {
+		ev.CreatedAt = nostr.Now()
+		err := ev.Sign(indexer.sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ndb.SaveEvent(ctx, ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := g.HideTxEvents(ndb.QueryEvents)
+
+	// without an h tag the tx events of groups are removed for clients that are not members
+	ch, err := query(ctx, nostr.Filter{Kinds: []int{nostreth.KindTxLog}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for ev := range ch {
+		got = append(got, ev.ID)
+	}
+
+	if len(got) != 1 || got[0] != public.ID {
+		t.Fatalf("expected only the public tx event, got %v", got)
+	}
+}
+
+type testBots struct {
+	rejected string
+}
+
+func (b *testBots) CanPost(ctx context.Context, pubkey, groupID string) (bool, error) {
+	return false, nil
+}
+
+func (b *testBots) RejectEvent(ctx context.Context, event *nostr.Event) (bool, string) {
+	return event.PubKey == b.rejected, "restricted: the bot token for this group is expired or revoked"
+}
+
+func TestValidateEventBots(t *testing.T) {
+	bot := newTestKey(t)
+
+	// bots are rejected before any group rule, whatever hooks are configured
+	g := NewGroupsService(nil, "", "")
+	g.SetBots(&testBots{rejected: bot.pk})
+
+	reject, msg := g.ValidateEvent(context.Background(), &nostr.Event{PubKey: bot.pk, Kind: KindGroupChat, Tags: nostr.Tags{{"h", "test"}}})
+	if !reject || msg != "restricted: the bot token for this group is expired or revoked" {
+		t.Fatalf("expected the bot to be rejected, got %t %q", reject, msg)
+	}
+}
@@ -0,0 +1,192 @@
+package groups
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// moderation events are replayed a page at a time when the projection is rebuilt
+const rebuildPage = 500
+
+// kinds of the events that change the state of a group
+var moderationKinds = []int{KindCreateGroup, KindPutUser, KindRemoveUser, KindEditMetadata, KindDeleteGroup, KindLeaveRequest}
+
+// Projection keeps groups and their members in tables maintained from moderation events, so that
+// membership checks are a single lookup
+type Projection interface {
+	ApplyGroupChange(c *relay.GroupChange) error
+	RebuildGroupState(changes []*relay.GroupChange) error
+	GetGroupMember(groupID, pubkey string) (*relay.GroupMember, error)
+}
+
+// SetProjection checks membership against the projected state of groups instead of their events
+func (g *GroupsService) SetProjection(p Projection) {
+	g.projection = p
+}
+
+// ChangeOf returns what a moderation event changes in the state of its group, nil for other events
+func ChangeOf(event *nostr.Event) *relay.GroupChange {
+	groupID := getHTag(event)
+	if groupID == "" {
+		return nil
+	}
+
+	c := &relay.GroupChange{
+		GroupID: groupID,
+		At:      event.CreatedAt.Time().UTC(),
+	}
+
+	switch event.Kind {
+	case KindCreateGroup:
+		c.Created = true
+		c.Metadata = metadataOf(event)
+		c.Metadata.CreatedBy = event.PubKey
+		c.Put = []*relay.GroupMember{{GroupID: groupID, Pubkey: event.PubKey, Role: RoleAdmin}}
+	case KindEditMetadata:
+		c.Metadata = metadataOf(event)
+	case KindPutUser:
+		for _, pTag := range getPTags(event) {
+			role := RoleMember
+			if len(pTag) > 1 {
+				role = pTag[1]
+			}
+
+			c.Put = append(c.Put, &relay.GroupMember{GroupID: groupID, Pubkey: pTag[0], Role: role})
+		}
+	case KindRemoveUser:
+		for _, pTag := range getPTags(event) {
+			c.Removed = append(c.Removed, pTag[0])
+		}
+	case KindLeaveRequest:
+		c.Removed = []string{event.PubKey}
+	case KindDeleteGroup:
+		c.Deleted = true
+	default:
+		return nil
+	}
+
+	return c
+}
+
+// metadataOf reads the metadata of a group the way its relay-generated metadata is
+func metadataOf(event *nostr.Event) *relay.Group {
+	m := &relay.Group{ID: getHTag(event)}
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+
+		switch tag[0] {
+		case "name":
+			m.Name = tag[1]
+		case "about":
+			m.About = tag[1]
+		case "picture":
+			m.Picture = tag[1]
+		}
+	}
+
+	return m
+}
+
+// project applies a stored moderation event to the projection
+func (g *GroupsService) project(event *nostr.Event) {
+	if g.projection == nil {
+		return
+	}
+
+	c := ChangeOf(event)
+	if c == nil {
+		return
+	}
+
+	if err := g.projection.ApplyGroupChange(c); err != nil {
+		log.Printf("Error projecting event %s of group %s: %v", event.ID, c.GroupID, err)
+	}
+}
+
+// RebuildProjection replaces the projected state of groups by replaying their moderation events,
+// it returns how many events were replayed
+func (g *GroupsService) RebuildProjection(ctx context.Context) (int, error) {
+	if g.projection == nil {
+		return 0, fmt.Errorf("no projection to rebuild")
+	}
+
+	events, err := g.moderationEvents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	changes := []*relay.GroupChange{}
+	for _, evt := range events {
+		if c := ChangeOf(evt); c != nil {
+			changes = append(changes, c)
+		}
+	}
+
+	err = g.projection.RebuildGroupState(changes)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(changes), nil
+}
+
+// moderationEvents returns the moderation events of every group, oldest first
+func (g *GroupsService) moderationEvents(ctx context.Context) ([]*nostr.Event, error) {
+	events := []*nostr.Event{}
+	seen := map[string]bool{}
+
+	until := nostr.Timestamp(time.Now().Unix())
+
+	// the store returns a page of events at a time, newest first, and may return fewer than asked.
+	// Pages go on from the oldest second of the previous one until the store has nothing older.
+	for {
+		// the store reads the filter while the page is listed, so every page gets its own cursor
+		pageUntil := until
+		ch, err := g.eventStore.QueryEvents(ctx, nostr.Filter{
+			Kinds: moderationKinds,
+			Until: &pageUntil,
+			Limit: rebuildPage,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		listed, found := 0, false
+		oldest := until
+		for evt := range ch {
+			listed++
+			oldest = min(oldest, evt.CreatedAt)
+
+			if seen[evt.ID] {
+				continue
+			}
+			seen[evt.ID] = true
+			found = true
+
+			events = append(events, evt)
+		}
+
+		if listed == 0 {
+			break
+		}
+
+		// a page of events already seen is stuck on a second, the next page starts before it
+		if !found || oldest == until {
+			oldest--
+		}
+		until = oldest
+	}
+
+	// pages come newest first
+	slices.Reverse(events)
+
+	return events, nil
+}
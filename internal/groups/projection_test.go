@@ -0,0 +1,160 @@
+package groups
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/eventstore/slicestore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// testProjection keeps the latest role of each member, it doesn't order changes
+type testProjection struct {
+	members map[string]string // group/pubkey -> role
+}
+
+func (p *testProjection) ApplyGroupChange(c *relay.GroupChange) error {
+	if c.Deleted {
+		p.members = map[string]string{}
+		return nil
+	}
+
+	for _, m := range c.Put {
+		p.members[c.GroupID+"/"+m.Pubkey] = m.Role
+	}
+
+	for _, pubkey := range c.Removed {
+		delete(p.members, c.GroupID+"/"+pubkey)
+	}
+
+	return nil
+}
+
+func (p *testProjection) RebuildGroupState(changes []*relay.GroupChange) error {
+	p.members = map[string]string{}
+	for _, c := range changes {
+		p.ApplyGroupChange(c)
+	}
+
+	return nil
+}
+
+func (p *testProjection) GetGroupMember(groupID, pubkey string) (*relay.GroupMember, error) {
+	role, ok := p.members[groupID+"/"+pubkey]
+	if !ok {
+		return nil, nil
+	}
+
+	return &relay.GroupMember{GroupID: groupID, Pubkey: pubkey, Role: role}, nil
+}
+
+func TestRebuildProjection(t *testing.T) {
+	store := &slicestore.SliceStore{}
+	store.Init()
+
+	ctx := context.Background()
+	for _, ev := range []*nostr.Event{
+		{ID: "1", PubKey: "alice", Kind: KindCreateGroup, CreatedAt: 100, Tags: nostr.Tags{{"h", "demo"}}},
+		{ID: "2", PubKey: "alice", Kind: KindPutUser, CreatedAt: 101, Tags: nostr.Tags{{"h", "demo"}, {"p", "bob"}, {"p", "carol", RoleMember}}},
+		{ID: "3", PubKey: "alice", Kind: KindRemoveUser, CreatedAt: 102, Tags: nostr.Tags{{"h", "demo"}, {"p", "bob"}}},
+		{ID: "4", PubKey: "carol", Kind: KindLeaveRequest, CreatedAt: 103, Tags: nostr.Tags{{"h", "demo"}}},
+		{ID: "5", PubKey: "dave", Kind: KindGroupChat, CreatedAt: 104, Tags: nostr.Tags{{"h", "demo"}}},
+	} {
+		store.SaveEvent(ctx, ev)
+	}
+
+	p := &testProjection{members: map[string]string{"stale/erin": RoleAdmin}}
+	g := NewGroupsService(store, "", "")
+	g.SetProjection(p)
+
+	replayed, err := g.RebuildProjection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replayed != 4 {
+		t.Fatalf("expected the 4 moderation events to be replayed, got %d", replayed)
+	}
+
+	for pubkey, want := range map[string]bool{"alice": true, "bob": false, "carol": false, "erin": false} {
+		for _, groupID := range []string{"demo", "stale"} {
+			isMember, err := g.IsMember(ctx, pubkey, groupID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if isMember != (want && groupID == "demo") {
+				t.Errorf("expected %s to be a member of %s: %v", pubkey, groupID, want && groupID == "demo")
+			}
+		}
+	}
+
+	isAdmin, err := g.IsAdmin(ctx, "alice", "demo")
+	if err != nil || !isAdmin {
+		t.Fatalf("expected the creator to be admin, got %v %v", isAdmin, err)
+	}
+
+	// events saved afterwards are projected as they come
+	g.project(&nostr.Event{ID: "6", PubKey: "alice", Kind: KindPutUser, CreatedAt: 105, Tags: nostr.Tags{{"h", "demo"}, {"p", "bob", RoleAdmin}}})
+
+	isAdmin, err = g.IsAdmin(ctx, "bob", "demo")
+	if err != nil || !isAdmin {
+		t.Fatalf("expected bob to be admin, got %v %v", isAdmin, err)
+	}
+}
+
+func TestModerationEventsPastAFullSecond(t *testing.T) {
+	store := &slicestore.SliceStore{}
+	store.Init()
+
+	ctx := context.Background()
+	store.SaveEvent(ctx, &nostr.Event{ID: "old", PubKey: "alice", Kind: KindCreateGroup, CreatedAt: 100, Tags: nostr.Tags{{"h", "demo"}}})
+
+	// a full page of events in the same second doesn't end the scan
+	for i := range rebuildPage {
+		store.SaveEvent(ctx, &nostr.Event{ID: fmt.Sprintf("put-%d", i), PubKey: "alice", Kind: KindPutUser, CreatedAt: 200, Tags: nostr.Tags{{"h", "demo"}, {"p", "bob"}}})
+	}
+
+	events, err := NewGroupsService(store, "", "").moderationEvents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != rebuildPage+1 || events[0].ID != "old" {
+		t.Fatalf("expected the %d events, oldest first, got %d", rebuildPage+1, len(events))
+	}
+}
+
+func TestReplayGroups(t *testing.T) {
+	store := &slicestore.SliceStore{}
+	store.Init()
+
+	ctx := context.Background()
+	for _, ev := range []*nostr.Event{
+		{ID: "1", PubKey: "alice", Kind: KindCreateGroup, CreatedAt: 100, Tags: nostr.Tags{{"h", "demo"}}},
+		{ID: "2", PubKey: "alice", Kind: KindPutUser, CreatedAt: 101, Tags: nostr.Tags{{"h", "demo"}, {"p", "bob", RoleAdmin}, {"p", "carol"}}},
+		{ID: "3", PubKey: "bob", Kind: KindRemoveUser, CreatedAt: 102, Tags: nostr.Tags{{"h", "demo"}, {"p", "carol"}}},
+		{ID: "4", PubKey: "dave", Kind: KindCreateGroup, CreatedAt: 100, Tags: nostr.Tags{{"h", "gone"}}},
+		{ID: "5", PubKey: "dave", Kind: KindDeleteGroup, CreatedAt: 101, Tags: nostr.Tags{{"h", "gone"}}},
+	} {
+		store.SaveEvent(ctx, ev)
+	}
+
+	states, err := NewGroupsService(store, "", "").ReplayGroups(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(states) != 1 || states["demo"] == nil {
+		t.Fatalf("expected only the group that wasn't deleted, got %v", states)
+	}
+
+	// the creator is only in the admins list, like the lists the relay generates
+	s := states["demo"]
+	if !slices.Equal(s.Admins, []string{"alice", "bob"}) || !slices.Equal(s.Members, []string{"bob"}) {
+		t.Fatalf("unexpected replayed state %+v", s)
+	}
+}
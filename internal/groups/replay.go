@@ -0,0 +1,91 @@
+package groups
+
+import (
+	"context"
+	"slices"
+)
+
+// GroupState is the membership of a group as the relay-generated lists should show it, admins are
+// in the members list once they were put into the group, the creator only in the admins list
+type GroupState struct {
+	Admins  []string
+	Members []string
+}
+
+// ReplayGroups recomputes the membership of every group from its full moderation history,
+// deleted groups are left out
+func (g *GroupsService) ReplayGroups(ctx context.Context) (map[string]*GroupState, error) {
+	events, err := g.moderationEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type replayed struct {
+		admins, members map[string]bool
+		deleted         bool
+	}
+
+	groups := map[string]*replayed{}
+	for _, evt := range events {
+		c := ChangeOf(evt)
+		if c == nil {
+			continue
+		}
+
+		r := groups[c.GroupID]
+		if r == nil {
+			r = &replayed{admins: map[string]bool{}, members: map[string]bool{}}
+			groups[c.GroupID] = r
+		}
+
+		switch {
+		case c.Deleted:
+			r.deleted = true
+		case c.Created:
+			// the lists of a created group are generated anew
+			r.admins = map[string]bool{evt.PubKey: true}
+			r.members = map[string]bool{}
+			r.deleted = false
+		default:
+			for _, m := range c.Put {
+				if m.Role == RoleAdmin {
+					r.admins[m.Pubkey] = true
+				}
+				r.members[m.Pubkey] = true
+			}
+
+			for _, pubkey := range c.Removed {
+				delete(r.admins, pubkey)
+				delete(r.members, pubkey)
+			}
+		}
+	}
+
+	states := map[string]*GroupState{}
+	for groupID, r := range groups {
+		if r.deleted {
+			continue
+		}
+
+		states[groupID] = &GroupState{Admins: sortedKeys(r.admins), Members: sortedKeys(r.members)}
+	}
+
+	return states, nil
+}
+
+// PublishLists replaces the relay-generated admins and members lists of a group
+func (g *GroupsService) PublishLists(ctx context.Context, groupID string, s *GroupState) {
+	g.generateAdminsList(ctx, groupID, s.Admins)
+	g.generateMembersList(ctx, groupID, s.Members)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
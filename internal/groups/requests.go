@@ -0,0 +1,59 @@
+package groups
+
+import (
+	"context"
+	"log"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// PendingJoinRequests returns the pubkeys that asked to join a group and were neither added nor
+// removed since, the latest requests come first
+func (g *GroupsService) PendingJoinRequests(ctx context.Context, groupID string) ([]string, error) {
+	filter := nostr.Filter{
+		Kinds: []int{KindJoinRequest},
+		Tags:  nostr.TagMap{"h": []string{groupID}},
+	}
+
+	events, err := g.eventStore.QueryEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the latest request of each pubkey is kept, events come newest first
+	requests := []*nostr.Event{}
+	seen := map[string]bool{}
+	for evt := range events {
+		if seen[evt.PubKey] {
+			continue
+		}
+		seen[evt.PubKey] = true
+
+		requests = append(requests, evt)
+	}
+
+	pending := []string{}
+	for _, req := range requests {
+		isMember, err := g.IsMember(ctx, req.PubKey, groupID)
+		if err != nil {
+			return nil, err
+		}
+		if isMember {
+			continue
+		}
+
+		// a request made before being removed was answered by the removal
+		notRemoved, err := g.checkNotRemoved(ctx, req.PubKey, groupID, req.CreatedAt)
+		if err != nil {
+			log.Printf("Error checking removals: %v", err)
+			return nil, err
+		}
+		if !notRemoved {
+			continue
+		}
+
+		pending = append(pending, req.PubKey)
+	}
+
+	return pending, nil
+}
@@ -0,0 +1,146 @@
+package groups
+
+import (
+	"context"
+	"log"
+	"slices"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// group scoped tx events generated by the indexer
+var txKinds = []int{nostreth.KindTxTransfer, nostreth.KindTxLog}
+
+// RejectTxFilter only allows members to query the tx events of a group, filters without an h tag
+// are let through and have the tx events of other groups removed by HideTxEvents
+func (g *GroupsService) RejectTxFilter(ctx context.Context, filter nostr.Filter) (reject bool, msg string) {
+	groupIDs := filter.Tags["h"]
+	if len(groupIDs) == 0 || !matchesTxKinds(filter) {
+		return false, ""
+	}
+
+	pubkey := khatru.GetAuthed(ctx)
+	if pubkey == "" {
+		khatru.RequestAuth(ctx)
+		return true, "auth-required: group tx events are only visible to members"
+	}
+
+	for _, groupID := range groupIDs {
+		isMember, err := g.IsMember(ctx, pubkey, groupID)
+		if err != nil {
+			log.Printf("Error checking member status: %v", err)
+			return true, "internal error checking membership"
+		}
+		if !isMember {
+			return true, "restricted: only group members can see group tx events"
+		}
+	}
+
+	return false, ""
+}
+
+// HideTxEvents wraps a query of the relay so that filters without an h tag never return the tx events
+// of a group the client is not a member of
+func (g *GroupsService) HideTxEvents(query func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error)) func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+	return func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+		ch, err := query(ctx, filter)
+		if err != nil || len(filter.Tags["h"]) > 0 || !matchesTxKinds(filter) || khatru.IsInternalCall(ctx) {
+			return ch, err
+		}
+
+		pubkey := khatru.GetAuthed(ctx)
+
+		out := make(chan *nostr.Event)
+		go func() {
+			defer close(out)
+
+			// membership is checked once per group and query
+			visible := map[string]bool{}
+
+			for event := range ch {
+				if !g.txEventVisible(ctx, pubkey, event, visible) {
+					continue
+				}
+
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		return out, nil
+	}
+}
+
+// txEventVisible checks if a pubkey can see an event, only group tx events are restricted
+func (g *GroupsService) txEventVisible(ctx context.Context, pubkey string, event *nostr.Event, visible map[string]bool) bool {
+	if !slices.Contains(txKinds, event.Kind) {
+		return true
+	}
+
+	groupID := getHTag(event)
+	if groupID == "" {
+		return true
+	}
+
+	if pubkey == "" {
+		return false
+	}
+
+	isMember, ok := visible[groupID]
+	if !ok {
+		var err error
+		isMember, err = g.IsMember(ctx, pubkey, groupID)
+		if err != nil {
+			log.Printf("Error checking member status: %v", err)
+			return false
+		}
+
+		visible[groupID] = isMember
+	}
+
+	return isMember
+}
+
+// PreventTxBroadcast prevents group tx events from being sent to non-members
+func (g *GroupsService) PreventTxBroadcast(ws *khatru.WebSocket, event *nostr.Event) bool {
+	if !slices.Contains(txKinds, event.Kind) {
+		return false
+	}
+
+	groupID := getHTag(event)
+	if groupID == "" {
+		return false
+	}
+
+	if ws.AuthedPublicKey == "" {
+		return true
+	}
+
+	isMember, err := g.IsMember(ws.Context, ws.AuthedPublicKey, groupID)
+	if err != nil {
+		log.Printf("Error checking member status: %v", err)
+		return true
+	}
+
+	return !isMember
+}
+
+// matchesTxKinds checks if a filter can return tx events
+func matchesTxKinds(filter nostr.Filter) bool {
+	if len(filter.Kinds) == 0 {
+		return true
+	}
+
+	for _, kind := range filter.Kinds {
+		if slices.Contains(txKinds, kind) {
+			return true
+		}
+	}
+
+	return false
+}
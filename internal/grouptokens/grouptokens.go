@@ -0,0 +1,152 @@
+// Package grouptokens lets group admins mint scoped tokens for bots and integrations, so that
+// they can post, upload media or read analytics for a single group without sharing admin keys.
+package grouptokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/eventstore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// DefaultTTL is how long a token is valid when the admin doesn't choose
+	DefaultTTL = 30 * 24 * time.Hour
+	// MaxTTL is the longest a token can be valid, tokens have to be minted again after that
+	MaxTTL = 365 * 24 * time.Hour
+
+	secretPrefix = "gt_"
+)
+
+var ErrInvalidToken = errors.New("invalid group token")
+
+// Groups decides who administers a group and who is a member of it
+type Groups interface {
+	IsAdmin(ctx context.Context, pubkey, groupID string) (bool, error)
+	IsMember(ctx context.Context, pubkey, groupID string) (bool, error)
+	GetMembers(ctx context.Context, groupID string) ([]string, error)
+}
+
+type Service struct {
+	db      *db.DB
+	groups  Groups
+	counter eventstore.Counter
+
+	now func() time.Time
+}
+
+func NewService(d *db.DB, g Groups, c eventstore.Counter) *Service {
+	return &Service{
+		db:      d,
+		groups:  g,
+		counter: c,
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// newSecret returns a random secret and the hash it is stored under
+func newSecret() (string, string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret := secretPrefix + hex.EncodeToString(b)
+
+	return secret, hashSecret(secret), nil
+}
+
+func hashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// Authenticate returns the active token with the given secret
+func (s *Service) Authenticate(secret string) (*relay.GroupToken, error) {
+	if secret == "" {
+		return nil, ErrInvalidToken
+	}
+
+	t, err := s.db.GroupTokenDB.GetTokenBySecretHash(hashSecret(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	if t == nil || !t.Active(s.now()) {
+		return nil, ErrInvalidToken
+	}
+
+	return t, nil
+}
+
+// CanPost returns true if the pubkey holds an active token to post into the group
+func (s *Service) CanPost(ctx context.Context, pubkey, groupID string) (bool, error) {
+	return s.db.GroupTokenDB.HasActiveToken(pubkey, groupID, relay.GroupTokenScopePost, s.now())
+}
+
+// CanUpload returns true if the pubkey holds an active token to upload media to the group
+func (s *Service) CanUpload(ctx context.Context, pubkey, groupID string) (bool, error) {
+	return s.db.GroupTokenDB.HasActiveToken(pubkey, groupID, relay.GroupTokenScopeMedia, s.now())
+}
+
+// isModeration returns true for the NIP-29 moderation and membership kinds, bots never send those
+func isModeration(kind int) bool {
+	return kind >= 9000 && kind <= 9022
+}
+
+// RejectEvent rejects group events of bot pubkeys that are not covered by an active post token,
+// pubkeys that never had a token and group members are left to the group rules. It is called by
+// the groups service before any group rule so that bots are told why they are rejected.
+func (s *Service) RejectEvent(ctx context.Context, ev *nostr.Event) (reject bool, msg string) {
+	h := ev.Tags.GetFirst([]string{"h", ""})
+	if h == nil || len(*h) < 2 {
+		return false, ""
+	}
+
+	groupID := (*h)[1]
+
+	bot, err := s.db.GroupTokenDB.IsBot(ev.PubKey)
+	if err != nil {
+		log.Printf("Error checking bot tokens: %v", err)
+		return true, "internal error checking bot tokens"
+	}
+
+	if !bot {
+		return false, ""
+	}
+
+	member, err := s.groups.IsMember(ctx, ev.PubKey, groupID)
+	if err != nil {
+		log.Printf("Error checking member status: %v", err)
+		return true, "internal error checking membership"
+	}
+
+	if member {
+		return false, ""
+	}
+
+	if isModeration(ev.Kind) {
+		return true, "restricted: bots can't moderate groups"
+	}
+
+	ok, err := s.CanPost(ctx, ev.PubKey, groupID)
+	if err != nil {
+		log.Printf("Error checking bot tokens: %v", err)
+		return true, "internal error checking bot tokens"
+	}
+
+	if !ok {
+		return true, "restricted: the bot token for this group is expired or revoked"
+	}
+
+	return false, ""
+}
@@ -0,0 +1,242 @@
+package grouptokens
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+type fakeCounter int64
+
+func (c fakeCounter) CountEvents(ctx context.Context, filter nostr.Filter) (int64, error) {
+	return int64(c), nil
+}
+
+type testKey struct {
+	sk string
+	pk string
+}
+
+func newTestKey(t *testing.T) testKey {
+	t.Helper()
+
+	sk := nostr.GeneratePrivateKey()
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testKey{sk: sk, pk: pk}
+}
+
+func newTestService(t *testing.T, g *testutil.FakeGroups) *Service {
+	t.Helper()
+
+	return NewService(testutil.NewDB(t), g, fakeCounter(3))
+}
+
+// signedRequest signs an admin request the way a client would and sends it to the handler
+func signedRequest(t *testing.T, h http.HandlerFunc, key testKey, path string, params map[string]string, content any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	b, err := json.Marshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := nostr.Event{
+		Kind:      nostr.KindHTTPAuth,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"u", "http://example.com" + path}, {"method", http.MethodPost}},
+		Content:   string(b),
+	}
+	err = ev.Sign(key.sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rctx := chi.NewRouteContext()
+	for k, v := range params {
+		rctx.URLParams.Add(k, v)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	h(w, r)
+
+	return w
+}
+
+func mint(t *testing.T, s *Service, key testKey, req relay.GroupTokenRequest) *relay.GroupToken {
+	t.Helper()
+
+	w := signedRequest(t, s.Mint, key, "/v1/groups/group/tokens", map[string]string{"group_id": "group"}, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the token to be minted, got %d", w.Code)
+	}
+
+	var body struct {
+		Object relay.GroupToken `json:"object"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &body.Object
+}
+
+func groupEvent(t *testing.T, key testKey, kind int, groupID string) *nostr.Event {
+	t.Helper()
+
+	ev := &nostr.Event{Kind: kind, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"h", groupID}}, Content: "hello"}
+	err := ev.Sign(key.sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ev
+}
+
+func TestMint(t *testing.T) {
+	admin := newTestKey(t)
+	member := newTestKey(t)
+	bot := newTestKey(t)
+
+	s := newTestService(t, &testutil.FakeGroups{Admins: map[string][]string{"group": {admin.pk}}, Members: map[string][]string{"group": {admin.pk, member.pk}}})
+
+	req := relay.GroupTokenRequest{Scope: relay.GroupTokenScopePost, Pubkey: bot.pk, Name: "welcome bot"}
+
+	w := signedRequest(t, s.Mint, member, "/v1/groups/group/tokens", map[string]string{"group_id": "group"}, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected members to be forbidden, got %d", w.Code)
+	}
+
+	for _, bad := range []relay.GroupTokenRequest{
+		{Scope: "admin"},
+		{Scope: relay.GroupTokenScopePost},
+		{Scope: relay.GroupTokenScopeAnalytics, ExpiresAt: time.Now().Add(-time.Hour).Unix()},
+		{Scope: relay.GroupTokenScopeAnalytics, ExpiresAt: time.Now().Add(2 * MaxTTL).Unix()},
+	} {
+		w := signedRequest(t, s.Mint, admin, "/v1/groups/group/tokens", map[string]string{"group_id": "group"}, bad)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected %+v to be rejected, got %d", bad, w.Code)
+		}
+	}
+
+	tok := mint(t, s, admin, req)
+	if tok.Secret == "" || tok.CreatedBy != admin.pk || tok.GroupID != "group" {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+
+	if tok.ExpiresAt.Sub(tok.CreatedAt) != DefaultTTL {
+		t.Fatalf("expected the default expiry, got %s", tok.ExpiresAt.Sub(tok.CreatedAt))
+	}
+
+	got, err := s.Authenticate(tok.Secret)
+	if err != nil || got.ID != tok.ID {
+		t.Fatalf("expected the secret to authenticate, got %v %v", got, err)
+	}
+
+	_, err = s.Authenticate("gt_wrong")
+	if err != ErrInvalidToken {
+		t.Fatalf("expected an invalid token, got %v", err)
+	}
+}
+
+func TestRejectEvent(t *testing.T) {
+	admin := newTestKey(t)
+	member := newTestKey(t)
+	bot := newTestKey(t)
+
+	s := newTestService(t, &testutil.FakeGroups{Admins: map[string][]string{"group": {admin.pk}}, Members: map[string][]string{"group": {admin.pk, member.pk}}})
+	ctx := context.Background()
+
+	tok := mint(t, s, admin, relay.GroupTokenRequest{Scope: relay.GroupTokenScopePost, Pubkey: bot.pk})
+
+	if reject, msg := s.RejectEvent(ctx, groupEvent(t, bot, 9, "group")); reject {
+		t.Fatalf("expected the bot to post into its group, got %s", msg)
+	}
+
+	if reject, _ := s.RejectEvent(ctx, groupEvent(t, bot, 9, "other")); !reject {
+		t.Fatal("expected the bot to be rejected in another group")
+	}
+
+	if reject, _ := s.RejectEvent(ctx, groupEvent(t, bot, 9000, "group")); !reject {
+		t.Fatal("expected the bot to be rejected when moderating")
+	}
+
+	if reject, msg := s.RejectEvent(ctx, groupEvent(t, member, 9, "group")); reject {
+		t.Fatalf("expected members to be left to the group rules, got %s", msg)
+	}
+
+	ok, err := s.CanUpload(ctx, bot.pk, "group")
+	if err != nil || ok {
+		t.Fatalf("expected a post token not to allow uploads, got %v %v", ok, err)
+	}
+
+	w := signedRequest(t, s.Revoke, admin, "/v1/groups/group/tokens/"+tok.ID+"/revoke", map[string]string{"group_id": "group", "token_id": tok.ID}, struct{}{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the token to be revoked, got %d", w.Code)
+	}
+
+	if reject, _ := s.RejectEvent(ctx, groupEvent(t, bot, 9, "group")); !reject {
+		t.Fatal("expected the bot to be rejected once its token is revoked")
+	}
+
+	_, err = s.Authenticate(tok.Secret)
+	if err != ErrInvalidToken {
+		t.Fatalf("expected a revoked token to be invalid, got %v", err)
+	}
+}
+
+func TestAnalytics(t *testing.T) {
+	admin := newTestKey(t)
+
+	s := newTestService(t, &testutil.FakeGroups{Admins: map[string][]string{"group": {admin.pk}}, Members: map[string][]string{"group": {admin.pk, "a", "b"}}})
+
+	tok := mint(t, s, admin, relay.GroupTokenRequest{Scope: relay.GroupTokenScopeAnalytics, Name: "dashboard"})
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/groups/group/analytics", nil)
+	r = r.WithContext(context.WithValue(r.Context(), relay.ContextKeyGroupToken, tok))
+
+	w := httptest.NewRecorder()
+	s.Analytics(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected analytics, got %d", w.Code)
+	}
+
+	var body struct {
+		Object analytics `json:"object"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Object.Members != 3 || body.Object.Posts24h != 3 || body.Object.Posts7d != 3 {
+		t.Fatalf("unexpected analytics %+v", body.Object)
+	}
+}
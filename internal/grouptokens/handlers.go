@@ -0,0 +1,198 @@
+package grouptokens
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/comunifi/relay/internal/groups"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// group content kinds counted by the analytics
+var contentKinds = []int{groups.KindGroupChat, groups.KindGroupReply, groups.KindGroupThreaded, groups.KindGroupChatReply}
+
+// Mint creates a token for the group, the secret is only returned in this response.
+// The id of the signed request is the id of the token so that a replayed request can't mint a second one.
+func (s *Service) Mint(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "group_id")
+
+	var req relay.GroupTokenRequest
+	ev, err := com.ParseAdminRequest(r, s.groups, groupID, s.now(), &req)
+	if err != nil {
+		com.WriteAdminRequestError(w, err)
+		return
+	}
+
+	if !req.Scope.IsValid() {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if req.Scope.NeedsPubkey() && !nostr.IsValidPublicKey(req.Pubkey) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !req.Scope.NeedsPubkey() {
+		req.Pubkey = ""
+	}
+
+	now := s.now()
+
+	expiresAt := now.Add(DefaultTTL)
+	if req.ExpiresAt != 0 {
+		expiresAt = time.Unix(req.ExpiresAt, 0).UTC()
+	}
+
+	if !expiresAt.After(now) || expiresAt.Sub(now) > MaxTTL {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	secret, hash, err := newSecret()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	t := &relay.GroupToken{
+		ID:        ev.ID,
+		GroupID:   groupID,
+		Scope:     req.Scope,
+		Pubkey:    req.Pubkey,
+		Name:      req.Name,
+		CreatedBy: ev.PubKey,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	ok, err := s.db.GroupTokenDB.AddToken(t, hash)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	t.Secret = secret
+
+	err = com.Body(w, t, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// List returns the tokens of the group, without their secrets
+func (s *Service) List(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "group_id")
+
+	_, err := com.ParseAdminRequest(r, s.groups, groupID, s.now(), nil)
+	if err != nil {
+		com.WriteAdminRequestError(w, err)
+		return
+	}
+
+	tokens, err := s.db.GroupTokenDB.GetTokens(groupID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.BodyMultiple(w, tokens, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Revoke revokes a token of the group, it stops working immediately
+func (s *Service) Revoke(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "group_id")
+
+	_, err := com.ParseAdminRequest(r, s.groups, groupID, s.now(), nil)
+	if err != nil {
+		com.WriteAdminRequestError(w, err)
+		return
+	}
+
+	ok, err := s.db.GroupTokenDB.RevokeToken(groupID, chi.URLParam(r, "token_id"), s.now())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = com.Body(w, []byte("{}"), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+type analytics struct {
+	GroupID  string `json:"group_id"`
+	Members  int    `json:"members"`
+	Posts24h int64  `json:"posts_24h"`
+	Posts7d  int64  `json:"posts_7d"`
+}
+
+// Analytics returns read-only activity figures of the group the token was minted for
+func (s *Service) Analytics(w http.ResponseWriter, r *http.Request) {
+	t, ok := r.Context().Value(relay.ContextKeyGroupToken).(*relay.GroupToken)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	members, err := s.groups.GetMembers(r.Context(), t.GroupID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	now := s.now()
+
+	posts24h, err := s.countPosts(r.Context(), t.GroupID, now.Add(-24*time.Hour))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	posts7d, err := s.countPosts(r.Context(), t.GroupID, now.Add(-7*24*time.Hour))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a := analytics{
+		GroupID:  t.GroupID,
+		Members:  len(members),
+		Posts24h: posts24h,
+		Posts7d:  posts7d,
+	}
+
+	err = com.Body(w, a, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// countPosts counts the content posted into a group since the given time
+func (s *Service) countPosts(ctx context.Context, groupID string, since time.Time) (int64, error) {
+	ts := nostr.Timestamp(since.Unix())
+
+	return s.counter.CountEvents(ctx, nostr.Filter{
+		Kinds: contentKinds,
+		Tags:  nostr.TagMap{"h": []string{groupID}},
+		Since: &ts,
+	})
+}
@@ -0,0 +1,112 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"slices"
+	"time"
+)
+
+// DefaultHookTimeout is how long a hook can take to handle an event before it is given up on
+const DefaultHookTimeout = 5 * time.Second
+
+var errHookTimeout = errors.New("hook timed out")
+
+// hookPanic is returned when a hook panicked while handling an event
+type hookPanic struct {
+	value any
+}
+
+func (e *hookPanic) Error() string {
+	return fmt.Sprintf("hook panicked: %v", e.value)
+}
+
+// SetTimeout configures how long a hook can take to handle an event, 0 disables the timeout
+func (p *Pipeline) SetTimeout(timeout time.Duration) {
+	p.timeout = timeout
+}
+
+// SetFailOpen configures the hooks whose events are accepted when they time out or panic,
+// events are rejected for the other hooks
+func (p *Pipeline) SetFailOpen(names ...string) {
+	p.failOpen = names
+}
+
+func (p *Pipeline) failsOpen(name string) bool {
+	return slices.Contains(p.failOpen, name)
+}
+
+// guarded is what a guarded hook returned, or why it didn't
+type guarded[T any] struct {
+	value T
+	err   error
+}
+
+// guard runs fn within the timeout of the pipeline and recovers if it panics. When the timeout
+// is reached fn keeps running in the background, it is up to fn to respect the context. The
+// result of fn is only returned through the channel, so a late fn can't race with the caller.
+func guard[T any](p *Pipeline, ctx context.Context, name string, st stage, fn func(ctx context.Context) T) (T, error) {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	done := make(chan guarded[T], 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Default().Printf("hook '%s' panicked during %s: %v\n%s", name, st, r, debug.Stack())
+				done <- guarded[T]{err: &hookPanic{value: r}}
+			}
+		}()
+
+		done <- guarded[T]{value: fn(ctx)}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			p.recordFault(name, st, res.err)
+		}
+		return res.value, res.err
+	case <-ctx.Done():
+		log.Default().Printf("hook '%s' did not finish %s within %s", name, st, p.timeout)
+		p.recordFault(name, st, errHookTimeout)
+
+		var zero T
+		return zero, errHookTimeout
+	}
+}
+
+// recoverPanic turns a panic of a hook into an error, for handlers that must run to completion
+func (p *Pipeline) recoverPanic(name string, st stage, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	log.Default().Printf("hook '%s' panicked during %s: %v\n%s", name, st, r, debug.Stack())
+
+	*err = &hookPanic{value: r}
+	p.recordFault(name, st, *err)
+}
+
+func (p *Pipeline) recordFault(name string, st stage, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.statsFor(name, st)
+
+	var perr *hookPanic
+	if errors.As(err, &perr) {
+		s.panics++
+		return
+	}
+
+	s.timeouts++
+}
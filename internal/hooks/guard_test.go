@@ -0,0 +1,98 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestPipelineGuard(t *testing.T) {
+	slow := HookFunc(func(relay *khatru.Relay) {
+		relay.RejectEvent = append(relay.RejectEvent, func(ctx context.Context, ev *nostr.Event) (bool, string) {
+			<-ctx.Done()
+			return false, ""
+		})
+	})
+
+	panicking := HookFunc(func(relay *khatru.Relay) {
+		relay.RejectEvent = append(relay.RejectEvent, func(ctx context.Context, ev *nostr.Event) (bool, string) {
+			panic("boom")
+		})
+		relay.StoreEvent = append(relay.StoreEvent, func(ctx context.Context, ev *nostr.Event) error {
+			panic("boom")
+		})
+		relay.OnEventSaved = append(relay.OnEventSaved, func(ctx context.Context, ev *nostr.Event) {
+			panic("boom")
+		})
+	})
+
+	p := NewPipeline()
+	p.SetTimeout(10 * time.Millisecond)
+	p.SetFailOpen("lenient")
+	p.Register("slow", slow)
+	p.Register("lenient", slow)
+	p.Register("panicking", panicking)
+
+	ctx := context.Background()
+	ev := &nostr.Event{Kind: nostr.KindTextNote}
+
+	t.Run("Timeout", func(t *testing.T) {
+		relay := &khatru.Relay{}
+		if err := p.Apply(relay, []string{"slow", "lenient"}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		reject, msg := relay.RejectEvent[0](ctx, ev)
+		if !reject || !strings.HasPrefix(msg, "error: ") {
+			t.Fatalf("expected slow hook to fail closed, got %v %q", reject, msg)
+		}
+
+		reject, _ = relay.RejectEvent[1](ctx, ev)
+		if reject {
+			t.Fatal("expected lenient hook to fail open")
+		}
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		relay := &khatru.Relay{}
+		if err := p.Apply(relay, []string{"panicking"}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		reject, _ := relay.RejectEvent[0](ctx, ev)
+		if !reject {
+			t.Fatal("expected panicking hook to fail closed")
+		}
+
+		err := relay.StoreEvent[0](ctx, ev)
+		if err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Fatalf("expected panic to be returned as an error, got %v", err)
+		}
+
+		relay.OnEventSaved[0](ctx, ev)
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		var b bytes.Buffer
+		p.WriteMetrics(&b)
+
+		out := b.String()
+		for _, want := range []string{
+			`relay_hook_timeouts_total{hook="slow",stage="reject"} 1`,
+			`relay_hook_timeouts_total{hook="lenient",stage="reject"} 1`,
+			`relay_hook_failures_total{hook="lenient",stage="reject"} 0`,
+			`relay_hook_panics_total{hook="panicking",stage="reject"} 1`,
+			`relay_hook_panics_total{hook="panicking",stage="store"} 1`,
+			`relay_hook_panics_total{hook="panicking",stage="saved"} 1`,
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("expected %q in metrics:\n%s", want, out)
+			}
+		}
+	})
+}
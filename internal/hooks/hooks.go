@@ -5,9 +5,11 @@ import (
 
 	"github.com/comunifi/relay/internal/db"
 	"github.com/comunifi/relay/internal/nostr"
+	"github.com/comunifi/relay/internal/paymaster"
 	"github.com/comunifi/relay/internal/queue"
 	"github.com/comunifi/relay/internal/userop"
 	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/fiatjaf/eventstore/postgresql"
 	"github.com/fiatjaf/khatru"
 )
@@ -16,22 +18,28 @@ type Router struct {
 	evm     relay.EVMRequester
 	db      *db.DB
 	n       *nostr.Nostr
+	pm      *paymaster.Service
 	useropq *queue.Service
+	mempool *queue.Mempool
 	chainID *big.Int
 	ndb     *postgresql.PostgresBackend
+
+	entryPoints []common.Address
 }
 
-func NewRouter(evm relay.EVMRequester, db *db.DB, n *nostr.Nostr, useropq *queue.Service, chainID *big.Int, ndb *postgresql.PostgresBackend) *Router {
-	return &Router{evm: evm, db: db, n: n, useropq: useropq, chainID: chainID, ndb: ndb}
+func NewRouter(evm relay.EVMRequester, db *db.DB, n *nostr.Nostr, pm *paymaster.Service, useropq *queue.Service, mempool *queue.Mempool, chainID *big.Int, ndb *postgresql.PostgresBackend) *Router {
+	return &Router{evm: evm, db: db, n: n, pm: pm, useropq: useropq, mempool: mempool, chainID: chainID, ndb: ndb}
 }
 
-func (r *Router) AddHooks(relay *khatru.Relay) *khatru.Relay {
-	// instantiate handlers
-	uop := userop.NewService(r.evm, r.db, r.n, r.useropq, r.chainID)
+// SetEntryPoints restricts the entry points of the user ops published by clients
+func (r *Router) SetEntryPoints(eps []common.Address) {
+	r.entryPoints = eps
+}
 
+// AddHooks registers the event store on the relay, it always comes before the hooks of the pipeline
+func (r *Router) AddHooks(relay *khatru.Relay) *khatru.Relay {
 	// saving events
 	relay.StoreEvent = append(relay.StoreEvent, r.ndb.SaveEvent)
-	relay.StoreEvent = append(relay.StoreEvent, uop.Process)
 
 	// querying events
 	relay.QueryEvents = append(relay.QueryEvents, r.ndb.QueryEvents)
@@ -47,3 +55,18 @@ func (r *Router) AddHooks(relay *khatru.Relay) *khatru.Relay {
 
 	return relay
 }
+
+// UserOps validates user ops published by clients and queues them once they are stored
+func (r *Router) UserOps() Hook {
+	return HookFunc(func(relay *khatru.Relay) {
+		// instantiate handlers
+		uop := userop.NewService(r.evm, r.db, r.n, r.pm, r.useropq, r.mempool, r.chainID)
+		uop.SetEntryPoints(r.entryPoints)
+
+		// user ops published by clients are validated before they are stored
+		relay.RejectEvent = append(relay.RejectEvent, uop.Reject)
+
+		// queue stored user ops
+		relay.StoreEvent = append(relay.StoreEvent, uop.Process)
+	})
+}
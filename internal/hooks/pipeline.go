@@ -0,0 +1,290 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/comunifi/relay/internal/metrics"
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DefaultHooks is the order in which hooks are registered when none is configured,
+// defaults that were not registered, like a bridge without routes, are skipped
+var DefaultHooks = []string{"groups", "polls", "userop", "notify", "bridge"}
+
+// Hook registers its handlers on the relay
+type Hook interface {
+	AddHooks(relay *khatru.Relay)
+}
+
+// HookFunc adapts a function to a Hook
+type HookFunc func(relay *khatru.Relay)
+
+func (f HookFunc) AddHooks(relay *khatru.Relay) {
+	f(relay)
+}
+
+type stage string
+
+const (
+	stageReject stage = "reject"
+	stageStore  stage = "store"
+	stageSaved  stage = "saved"
+)
+
+type hookStats struct {
+	calls    uint64
+	duration time.Duration
+	failures uint64 // rejected or failed events
+	timeouts uint64
+	panics   uint64
+}
+
+type statsKey struct {
+	hook  string
+	stage stage
+}
+
+// Pipeline registers named hooks on the relay in a configured order and times
+// how long each of them spends handling events
+type Pipeline struct {
+	hooks map[string]Hook
+
+	timeout  time.Duration
+	failOpen []string
+
+	workers []chan sideEffect
+	inline  atomic.Uint64 // side effects run inline because the queue was full
+
+	mu      sync.Mutex
+	enabled []string
+	stats   map[statsKey]*hookStats
+}
+
+func NewPipeline() *Pipeline {
+	return &Pipeline{
+		hooks:   map[string]Hook{},
+		timeout: DefaultHookTimeout,
+		stats:   map[statsKey]*hookStats{},
+	}
+}
+
+// Register makes a hook available under a name, registering a name twice replaces the hook
+func (p *Pipeline) Register(name string, h Hook) {
+	p.hooks[name] = h
+}
+
+// Apply adds the hooks to the relay in the given order, skipping disabled ones.
+// An unknown name is an error so that a typo doesn't silently disable a hook.
+func (p *Pipeline) Apply(relay *khatru.Relay, order, disabled []string) error {
+	if len(order) == 0 {
+		for _, name := range DefaultHooks {
+			if _, ok := p.hooks[name]; ok {
+				order = append(order, name)
+			}
+		}
+	}
+
+	for _, name := range slices.Concat(order, disabled) {
+		if _, ok := p.hooks[name]; !ok {
+			return fmt.Errorf("unknown hook '%s'", name)
+		}
+	}
+
+	for i, name := range order {
+		if slices.Contains(order[:i], name) {
+			return fmt.Errorf("hook '%s' is listed twice", name)
+		}
+	}
+
+	for _, name := range order {
+		if slices.Contains(disabled, name) {
+			continue
+		}
+
+		p.apply(relay, name)
+	}
+
+	return nil
+}
+
+// Enabled returns the hooks that were applied, in order
+func (p *Pipeline) Enabled() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.enabled)
+}
+
+// rejection is the answer of a RejectEvent hook
+type rejection struct {
+	reject bool
+	msg    string
+}
+
+// apply registers the hook on a scratch relay and moves its handlers to the relay,
+// event handlers are timed and guarded on the way so a slow or panicking hook can't
+// take down the connection handling the event
+func (p *Pipeline) apply(relay *khatru.Relay, name string) {
+	scratch := &khatru.Relay{}
+	p.hooks[name].AddHooks(scratch)
+
+	for _, fn := range scratch.RejectEvent {
+		relay.RejectEvent = append(relay.RejectEvent, func(ctx context.Context, ev *nostr.Event) (bool, string) {
+			start := time.Now()
+
+			// the hook answers through guard, a hook that times out can't overwrite the answer
+			res, err := guard(p, ctx, name, stageReject, func(ctx context.Context) rejection {
+				reject, msg := fn(ctx, ev)
+				return rejection{reject: reject, msg: msg}
+			})
+
+			reject, msg := res.reject, res.msg
+			if err != nil {
+				reject, msg = !p.failsOpen(name), ""
+				if reject {
+					msg = "error: could not process event, try again later"
+				}
+			}
+
+			p.record(name, stageReject, time.Since(start), reject)
+			return reject, msg
+		})
+	}
+
+	// storing has to run to completion, only panics are recovered
+	for _, fn := range scratch.StoreEvent {
+		relay.StoreEvent = append(relay.StoreEvent, func(ctx context.Context, ev *nostr.Event) (err error) {
+			start := time.Now()
+			defer func() {
+				p.record(name, stageStore, time.Since(start), err != nil)
+			}()
+			defer p.recoverPanic(name, stageStore, &err)
+
+			return fn(ctx, ev)
+		})
+	}
+
+	// side effects don't change the outcome for the client, they run on the workers
+	for _, fn := range scratch.OnEventSaved {
+		relay.OnEventSaved = append(relay.OnEventSaved, func(ctx context.Context, ev *nostr.Event) {
+			p.dispatch(ctx, ev, func(ctx context.Context) {
+				start := time.Now()
+				_, err := guard(p, ctx, name, stageSaved, func(ctx context.Context) struct{} {
+					fn(ctx, ev)
+					return struct{}{}
+				})
+				p.record(name, stageSaved, time.Since(start), err != nil)
+			})
+		})
+	}
+
+	// the other handlers are not part of event processing and are moved as they are
+	relay.OverwriteDeletionOutcome = append(relay.OverwriteDeletionOutcome, scratch.OverwriteDeletionOutcome...)
+	relay.ReplaceEvent = append(relay.ReplaceEvent, scratch.ReplaceEvent...)
+	relay.DeleteEvent = append(relay.DeleteEvent, scratch.DeleteEvent...)
+	relay.OnEphemeralEvent = append(relay.OnEphemeralEvent, scratch.OnEphemeralEvent...)
+	relay.RejectFilter = append(relay.RejectFilter, scratch.RejectFilter...)
+	relay.RejectCountFilter = append(relay.RejectCountFilter, scratch.RejectCountFilter...)
+	relay.OverwriteFilter = append(relay.OverwriteFilter, scratch.OverwriteFilter...)
+	relay.QueryEvents = append(relay.QueryEvents, scratch.QueryEvents...)
+	relay.CountEvents = append(relay.CountEvents, scratch.CountEvents...)
+	relay.CountEventsHLL = append(relay.CountEventsHLL, scratch.CountEventsHLL...)
+	relay.RejectConnection = append(relay.RejectConnection, scratch.RejectConnection...)
+	relay.OnConnect = append(relay.OnConnect, scratch.OnConnect...)
+	relay.OnDisconnect = append(relay.OnDisconnect, scratch.OnDisconnect...)
+	relay.OverwriteRelayInformation = append(relay.OverwriteRelayInformation, scratch.OverwriteRelayInformation...)
+	relay.OverwriteResponseEvent = append(relay.OverwriteResponseEvent, scratch.OverwriteResponseEvent...)
+	relay.PreventBroadcast = append(relay.PreventBroadcast, scratch.PreventBroadcast...)
+
+	p.mu.Lock()
+	p.enabled = append(p.enabled, name)
+	p.mu.Unlock()
+}
+
+func (p *Pipeline) record(name string, st stage, d time.Duration, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := p.statsFor(name, st)
+
+	s.calls++
+	s.duration += d
+	if failed {
+		s.failures++
+	}
+}
+
+// statsFor returns the stats of a hook stage, the lock must be held
+func (p *Pipeline) statsFor(name string, st stage) *hookStats {
+	key := statsKey{hook: name, stage: st}
+
+	s, ok := p.stats[key]
+	if !ok {
+		s = &hookStats{}
+		p.stats[key] = s
+	}
+
+	return s
+}
+
+// WriteMetrics writes the time spent in each hook in the prometheus text format
+func (p *Pipeline) WriteMetrics(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := make([]statsKey, 0, len(p.stats))
+	for key := range p.stats {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].hook == keys[j].hook {
+			return keys[i].stage < keys[j].stage
+		}
+		return keys[i].hook < keys[j].hook
+	})
+
+	metrics.Help(w, "relay_hook_side_effects_queued", "gauge", "side effects waiting for a hook worker")
+	metrics.Sample(w, "relay_hook_side_effects_queued", float64(p.queued()))
+
+	metrics.Help(w, "relay_hook_side_effects_inline_total", "counter", "side effects run inline because the hook workers were saturated")
+	metrics.Sample(w, "relay_hook_side_effects_inline_total", float64(p.inline.Load()))
+
+	metrics.Help(w, "relay_hook_enabled", "gauge", "hooks registered on the relay, by position")
+	for i, name := range p.enabled {
+		metrics.Sample(w, "relay_hook_enabled", float64(i), "hook", name)
+	}
+
+	metrics.Help(w, "relay_hook_duration_seconds_sum", "counter", "time spent handling events per hook and stage")
+	for _, key := range keys {
+		metrics.Sample(w, "relay_hook_duration_seconds_sum", p.stats[key].duration.Seconds(), "hook", key.hook, "stage", string(key.stage))
+	}
+
+	metrics.Help(w, "relay_hook_duration_seconds_count", "counter", "events handled per hook and stage")
+	for _, key := range keys {
+		metrics.Sample(w, "relay_hook_duration_seconds_count", float64(p.stats[key].calls), "hook", key.hook, "stage", string(key.stage))
+	}
+
+	metrics.Help(w, "relay_hook_failures_total", "counter", "events rejected or failed per hook and stage")
+	for _, key := range keys {
+		metrics.Sample(w, "relay_hook_failures_total", float64(p.stats[key].failures), "hook", key.hook, "stage", string(key.stage))
+	}
+
+	metrics.Help(w, "relay_hook_timeouts_total", "counter", "events a hook did not handle within the timeout")
+	for _, key := range keys {
+		metrics.Sample(w, "relay_hook_timeouts_total", float64(p.stats[key].timeouts), "hook", key.hook, "stage", string(key.stage))
+	}
+
+	metrics.Help(w, "relay_hook_panics_total", "counter", "events during which a hook panicked")
+	for _, key := range keys {
+		metrics.Sample(w, "relay_hook_panics_total", float64(p.stats[key].panics), "hook", key.hook, "stage", string(key.stage))
+	}
+}
@@ -0,0 +1,124 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestPipeline(t *testing.T) {
+	calls := []string{}
+
+	p := NewPipeline()
+	p.Register("first", HookFunc(func(relay *khatru.Relay) {
+		relay.StoreEvent = append(relay.StoreEvent, func(ctx context.Context, ev *nostr.Event) error {
+			calls = append(calls, "first")
+			return nil
+		})
+	}))
+	p.Register("second", HookFunc(func(relay *khatru.Relay) {
+		relay.RejectEvent = append(relay.RejectEvent, func(ctx context.Context, ev *nostr.Event) (bool, string) {
+			return ev.Kind == nostr.KindTextNote, "blocked"
+		})
+		relay.StoreEvent = append(relay.StoreEvent, func(ctx context.Context, ev *nostr.Event) error {
+			calls = append(calls, "second")
+			return errors.New("failed")
+		})
+	}))
+	p.Register("third", HookFunc(func(relay *khatru.Relay) {
+		relay.StoreEvent = append(relay.StoreEvent, func(ctx context.Context, ev *nostr.Event) error {
+			calls = append(calls, "third")
+			return nil
+		})
+	}))
+
+	t.Run("Unknown", func(t *testing.T) {
+		err := p.Apply(&khatru.Relay{}, []string{"first", "spam"}, nil)
+		if err == nil || !strings.Contains(err.Error(), "spam") {
+			t.Fatalf("expected unknown hook error, got %v", err)
+		}
+
+		err = p.Apply(&khatru.Relay{}, []string{"first"}, []string{"retention"})
+		if err == nil {
+			t.Fatal("expected unknown disabled hook to be an error")
+		}
+
+		err = p.Apply(&khatru.Relay{}, []string{"first", "first"}, nil)
+		if err == nil {
+			t.Fatal("expected duplicate hook to be an error")
+		}
+	})
+
+	relay := &khatru.Relay{}
+
+	err := p.Apply(relay, []string{"third", "second", "first"}, []string{"first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if enabled := p.Enabled(); len(enabled) != 2 || enabled[0] != "third" || enabled[1] != "second" {
+		t.Fatalf("expected third and second to be enabled, got %v", enabled)
+	}
+
+	t.Run("Order", func(t *testing.T) {
+		if len(relay.StoreEvent) != 2 || len(relay.RejectEvent) != 1 {
+			t.Fatalf("expected 2 store and 1 reject handlers, got %d and %d", len(relay.StoreEvent), len(relay.RejectEvent))
+		}
+
+		ev := &nostr.Event{Kind: nostr.KindTextNote}
+		for _, store := range relay.StoreEvent {
+			store(context.Background(), ev)
+		}
+
+		if strings.Join(calls, ",") != "third,second" {
+			t.Fatalf("expected hooks to run in order, got %v", calls)
+		}
+
+		reject, msg := relay.RejectEvent[0](context.Background(), ev)
+		if !reject || msg != "blocked" {
+			t.Fatalf("expected rejection to be passed through, got %v %q", reject, msg)
+		}
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		var b bytes.Buffer
+		p.WriteMetrics(&b)
+
+		out := b.String()
+		for _, want := range []string{
+			`relay_hook_enabled{hook="third"} 0`,
+			`relay_hook_enabled{hook="second"} 1`,
+			`relay_hook_duration_seconds_count{hook="second",stage="store"} 1`,
+			`relay_hook_duration_seconds_count{hook="third",stage="store"} 1`,
+			`relay_hook_failures_total{hook="second",stage="reject"} 1`,
+			`relay_hook_failures_total{hook="second",stage="store"} 1`,
+			`relay_hook_failures_total{hook="third",stage="store"} 0`,
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("expected %q in metrics:\n%s", want, out)
+			}
+		}
+	})
+}
+
+func TestPipelineDefaults(t *testing.T) {
+	p := NewPipeline()
+	for _, name := range []string{"notify", "groups", "polls", "userop"} {
+		p.Register(name, HookFunc(func(relay *khatru.Relay) {}))
+	}
+
+	// the bridge is a default too but it is not registered without routes
+	err := p.Apply(&khatru.Relay{}, nil, []string{"notify"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if enabled := strings.Join(p.Enabled(), ","); enabled != "groups,polls,userop" {
+		t.Fatalf("expected groups,polls,userop to be enabled, got %s", enabled)
+	}
+}
@@ -0,0 +1,143 @@
+package hooks
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	DefaultSideEffectWorkers = 8
+	DefaultSideEffectQueue   = 1024
+)
+
+// sideEffect is an OnEventSaved handler waiting to run for an event
+type sideEffect struct {
+	ctx context.Context
+	run func(ctx context.Context)
+}
+
+// SetWorkers offloads OnEventSaved handlers to a pool of workers with a bounded queue so that
+// they don't delay the OK sent to the client, it must be called before Apply. Events of the
+// same group always go to the same worker so that their side effects run in order.
+func (p *Pipeline) SetWorkers(workers, queue int) {
+	if workers <= 0 {
+		p.workers = nil
+		return
+	}
+
+	size := max(queue/workers, 1)
+
+	p.workers = make([]chan sideEffect, workers)
+	for i := range p.workers {
+		p.workers[i] = make(chan sideEffect, size)
+	}
+}
+
+// Start runs the workers until the context is done, queued side effects are run before returning
+func (p *Pipeline) Start(ctx context.Context) error {
+	if len(p.workers) == 0 {
+		return nil
+	}
+
+	log.Default().Printf("starting %d hook workers", len(p.workers))
+
+	var wg sync.WaitGroup
+	for _, w := range p.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					for {
+						select {
+						case se := <-w:
+							se.run(se.ctx)
+						default:
+							return
+						}
+					}
+				case se := <-w:
+					se.run(se.ctx)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	log.Default().Println("stopping hook workers")
+
+	return nil
+}
+
+// dispatch queues a side effect on the worker of the event, when there are no workers or the
+// queue is full it runs inline instead of being dropped
+func (p *Pipeline) dispatch(ctx context.Context, ev *nostr.Event, run func(ctx context.Context)) {
+	if len(p.workers) == 0 {
+		run(ctx)
+		return
+	}
+
+	// the request is over once the client has its OK, values are kept but not the cancellation
+	se := sideEffect{ctx: context.WithoutCancel(ctx), run: run}
+
+	select {
+	case p.workers[p.shard(ev)] <- se:
+	default:
+		p.inline.Add(1)
+		run(ctx)
+	}
+}
+
+// shard picks the worker of an event by group, events outside of groups are spread by author
+func (p *Pipeline) shard(ev *nostr.Event) int {
+	key := ev.PubKey
+	if h := ev.Tags.Find("h"); h != nil {
+		key = h[1]
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+
+	return int(hash.Sum32() % uint32(len(p.workers)))
+}
+
+// queued returns the number of side effects waiting for a worker
+func (p *Pipeline) queued() int {
+	n := 0
+	for _, w := range p.workers {
+		n += len(w)
+	}
+
+	return n
+}
+
+// Depth returns the number of side effects waiting for a worker
+func (p *Pipeline) Depth() int {
+	return p.queued()
+}
+
+// DebugState reports how many side effects are waiting on each worker
+func (p *Pipeline) DebugState() any {
+	queues := make([]int, len(p.workers))
+	for i, w := range p.workers {
+		queues[i] = len(w)
+	}
+
+	p.mu.Lock()
+	enabled := append([]string{}, p.enabled...)
+	p.mu.Unlock()
+
+	return map[string]any{
+		"enabled": enabled,
+		"queued":  p.queued(),
+		"workers": queues,
+		"inline":  p.inline.Load(),
+	}
+}
@@ -0,0 +1,99 @@
+package hooks
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestPipelineWorkers(t *testing.T) {
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	handled := []string{}
+
+	p := NewPipeline()
+	p.SetTimeout(0)
+	p.SetWorkers(2, 8)
+	p.Register("side", HookFunc(func(relay *khatru.Relay) {
+		relay.OnEventSaved = append(relay.OnEventSaved, func(ctx context.Context, ev *nostr.Event) {
+			<-release
+
+			mu.Lock()
+			handled = append(handled, ev.Content)
+			mu.Unlock()
+		})
+	}))
+
+	relay := &khatru.Relay{}
+	if err := p.Apply(relay, []string{"side"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- p.Start(ctx)
+	}()
+
+	group := func(content string) *nostr.Event {
+		return &nostr.Event{Content: content, Tags: nostr.Tags{{"h", "group"}}}
+	}
+
+	// the handler blocks, saving must not
+	done := make(chan struct{})
+	go func() {
+		for _, c := range []string{"1", "2", "3"} {
+			relay.OnEventSaved[0](ctx, group(c))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected side effects to be queued without waiting for them")
+	}
+
+	close(release)
+	cancel()
+
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// side effects of a group run in order on the same worker
+	if len(handled) != 3 || handled[0] != "1" || handled[1] != "2" || handled[2] != "3" {
+		t.Fatalf("expected side effects to run in order, got %v", handled)
+	}
+}
+
+func TestPipelineWorkersFull(t *testing.T) {
+	p := NewPipeline()
+	p.SetWorkers(1, 1)
+
+	ran := 0
+	run := func(ctx context.Context) { ran++ }
+
+	ev := &nostr.Event{PubKey: "author"}
+
+	// no worker is running, the first side effect fills the queue
+	p.dispatch(context.Background(), ev, run)
+	if ran != 0 || p.queued() != 1 {
+		t.Fatalf("expected side effect to be queued, ran %d queued %d", ran, p.queued())
+	}
+
+	// the next one runs inline instead of being dropped
+	p.dispatch(context.Background(), ev, run)
+	if ran != 1 || p.inline.Load() != 1 {
+		t.Fatalf("expected side effect to run inline, ran %d inline %d", ran, p.inline.Load())
+	}
+}
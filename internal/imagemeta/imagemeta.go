@@ -0,0 +1,304 @@
+// Package imagemeta removes the metadata of uploaded images that can identify or locate members,
+// such as the EXIF block with the GPS position and the camera, XMP and text comments.
+//
+// Metadata is cut out of the file without touching the pixels. A JPEG that relies on its EXIF
+// orientation is re-encoded upright instead, since it would otherwise be shown rotated once the
+// EXIF block is gone.
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+)
+
+// jpegQuality is used when a JPEG has to be re-encoded
+const jpegQuality = 90
+
+var ErrMalformed = errors.New("malformed image")
+
+// Strip returns the image without its metadata and whether anything was removed, images of
+// other types are returned as they are
+func Strip(body []byte, mime string) ([]byte, bool, error) {
+	switch mime {
+	case "image/jpeg":
+		return stripJPEG(body)
+	case "image/png":
+		return stripPNG(body)
+	case "image/webp":
+		return stripWebP(body)
+	}
+
+	return body, false, nil
+}
+
+// jpeg markers that carry metadata: APP1 (EXIF and XMP), APP13 (IPTC) and comments
+var jpegMetadata = map[byte]bool{0xE1: true, 0xED: true, 0xFE: true}
+
+func stripJPEG(body []byte) ([]byte, bool, error) {
+	if len(body) < 4 || body[0] != 0xFF || body[1] != 0xD8 {
+		return body, false, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(body)))
+	out.Write(body[:2])
+
+	changed := false
+	orientation := 1
+
+	i := 2
+	for i < len(body) {
+		if body[i] != 0xFF || i+1 >= len(body) {
+			return body, false, ErrMalformed
+		}
+
+		marker := body[i+1]
+
+		// fill bytes before a marker
+		if marker == 0xFF {
+			i++
+			continue
+		}
+
+		// markers without a length
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out.Write(body[i : i+2])
+			i += 2
+			continue
+		}
+
+		// the start of scan is followed by the image data, it is kept as it is
+		if marker == 0xDA || marker == 0xD9 {
+			out.Write(body[i:])
+			break
+		}
+
+		if i+4 > len(body) {
+			return body, false, ErrMalformed
+		}
+
+		end := i + 2 + int(binary.BigEndian.Uint16(body[i+2:i+4]))
+		if end > len(body) {
+			return body, false, ErrMalformed
+		}
+
+		if jpegMetadata[marker] {
+			if marker == 0xE1 && orientation == 1 {
+				orientation = exifOrientation(body[i+4 : end])
+			}
+
+			changed = true
+		} else {
+			out.Write(body[i:end])
+		}
+
+		i = end
+	}
+
+	if !changed {
+		return body, false, nil
+	}
+
+	if orientation > 1 && orientation <= 8 {
+		return reencodeJPEG(out.Bytes(), orientation)
+	}
+
+	return out.Bytes(), true, nil
+}
+
+// exifOrientation reads the orientation tag of the first image of an EXIF block, 1 when it is missing
+func exifOrientation(app1 []byte) int {
+	tiff, ok := bytes.CutPrefix(app1, []byte("Exif\x00\x00"))
+	if !ok || len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for e := 0; e < entries; e++ {
+		at := ifd + 2 + e*12
+		if at+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[at:at+2]) == 0x0112 {
+			return int(order.Uint16(tiff[at+8 : at+10]))
+		}
+	}
+
+	return 1
+}
+
+// reencodeJPEG draws a JPEG upright and encodes it again
+func reencodeJPEG(body []byte, orientation int) ([]byte, bool, error) {
+	img, err := jpeg.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+
+	var out bytes.Buffer
+	err = jpeg.Encode(&out, orient(img, orientation), &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return out.Bytes(), true, nil
+}
+
+// orient applies an EXIF orientation to an image
+func orient(src image.Image, orientation int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// orientations 5 to 8 swap the width and the height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flipped horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // flipped vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90° counter clockwise
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+
+			dst.Set(x, y, src.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+
+// png chunks that carry metadata, the time of the last change included
+var pngMetadata = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+func stripPNG(body []byte) ([]byte, bool, error) {
+	if !bytes.HasPrefix(body, pngSignature) {
+		return body, false, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(body)))
+	out.Write(pngSignature)
+
+	changed := false
+
+	i := len(pngSignature)
+	for i < len(body) {
+		if i+8 > len(body) {
+			return body, false, ErrMalformed
+		}
+
+		// length, type, data and crc
+		end := i + 12 + int(binary.BigEndian.Uint32(body[i:i+4]))
+		if end > len(body) || end < i {
+			return body, false, ErrMalformed
+		}
+
+		if pngMetadata[string(body[i+4:i+8])] {
+			changed = true
+		} else {
+			out.Write(body[i:end])
+		}
+
+		i = end
+	}
+
+	if !changed {
+		return body, false, nil
+	}
+
+	return out.Bytes(), true, nil
+}
+
+// flags of the VP8X chunk that announce metadata chunks
+const (
+	webpFlagXMP  = 0x04
+	webpFlagEXIF = 0x08
+)
+
+func stripWebP(body []byte) ([]byte, bool, error) {
+	if len(body) < 12 || string(body[:4]) != "RIFF" || string(body[8:12]) != "WEBP" {
+		return body, false, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(body)))
+	out.Write(body[:12])
+
+	changed := false
+
+	i := 12
+	for i < len(body) {
+		if i+8 > len(body) {
+			return body, false, ErrMalformed
+		}
+
+		fourcc := string(body[i : i+4])
+
+		// chunks are padded to an even size
+		size := int(binary.LittleEndian.Uint32(body[i+4 : i+8]))
+		end := i + 8 + size + size%2
+		if end > len(body) || end < i {
+			return body, false, ErrMalformed
+		}
+
+		switch fourcc {
+		case "EXIF", "XMP ":
+			changed = true
+		case "VP8X":
+			chunk := bytes.Clone(body[i:end])
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out.Write(chunk)
+		default:
+			out.Write(body[i:end])
+		}
+
+		i = end
+	}
+
+	if !changed {
+		return body, false, nil
+	}
+
+	b := out.Bytes()
+	binary.LittleEndian.PutUint32(b[4:8], uint32(len(b)-8))
+
+	return b, true, nil
+}
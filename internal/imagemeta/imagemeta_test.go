@@ -0,0 +1,136 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// exifBlock is an APP1 segment with an orientation and a fake GPS value
+func exifBlock(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = append(tiff, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0x00, 0x00)
+	tiff = append(tiff, []byte("GPS 52.3676N 4.9041E")...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+
+	seg := []byte{0xFF, 0xE1}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(len(payload)+2))
+
+	return append(seg, payload...)
+}
+
+func testJPEG(t *testing.T, orientation uint16) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+
+	// the exif block goes right after the start of image
+	return append(append([]byte{0xFF, 0xD8}, exifBlock(orientation)...), b[2:]...)
+}
+
+func TestStripJPEG(t *testing.T) {
+	out, changed, err := Strip(testJPEG(t, 1), "image/jpeg")
+	if err != nil || !changed {
+		t.Fatalf("expected the exif block to be stripped, got %v %v", changed, err)
+	}
+
+	if bytes.Contains(out, []byte("GPS")) || bytes.Contains(out, []byte("Exif")) {
+		t.Fatal("expected no metadata left")
+	}
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+	if err != nil || cfg.Width != 4 || cfg.Height != 2 {
+		t.Fatalf("unexpected image %+v %v", cfg, err)
+	}
+
+	// a rotated image is re-encoded upright
+	out, changed, err = Strip(testJPEG(t, 6), "image/jpeg")
+	if err != nil || !changed {
+		t.Fatalf("expected the exif block to be stripped, got %v %v", changed, err)
+	}
+
+	cfg, err = jpeg.DecodeConfig(bytes.NewReader(out))
+	if err != nil || cfg.Width != 2 || cfg.Height != 4 {
+		t.Fatalf("expected a rotated image, got %+v %v", cfg, err)
+	}
+
+	// an image without metadata is left alone
+	stripped := out
+	out, changed, err = Strip(stripped, "image/jpeg")
+	if err != nil || changed || !bytes.Equal(out, stripped) {
+		t.Fatalf("expected the image to be unchanged, got %v %v", changed, err)
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+
+	// a text chunk is added before the end chunk
+	text := []byte("tEXtComment\x00taken at home")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)-4))
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(text))
+
+	iend := len(b) - 12
+	withText := append(append(bytes.Clone(b[:iend]), chunk...), b[iend:]...)
+
+	out, changed, err := Strip(withText, "image/png")
+	if err != nil || !changed || !bytes.Equal(out, b) {
+		t.Fatalf("expected the text chunk to be stripped, got %v %v", changed, err)
+	}
+
+	_, err = png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStripWebP(t *testing.T) {
+	chunk := func(fourcc string, data []byte) []byte {
+		c := append([]byte(fourcc), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+		c = append(c, data...)
+		if len(data)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+
+	body := []byte("RIFF\x00\x00\x00\x00WEBP")
+	body = append(body, chunk("VP8X", []byte{webpFlagEXIF, 0, 0, 0, 1, 0, 0, 1, 0, 0})...)
+	body = append(body, chunk("VP8L", []byte("pixels"))...)
+	body = append(body, chunk("EXIF", []byte("GPS"))...)
+	binary.LittleEndian.PutUint32(body[4:8], uint32(len(body)-8))
+
+	out, changed, err := Strip(body, "image/webp")
+	if err != nil || !changed {
+		t.Fatalf("expected the exif chunk to be stripped, got %v %v", changed, err)
+	}
+
+	if bytes.Contains(out, []byte("EXIF")) || out[20]&webpFlagEXIF != 0 {
+		t.Fatal("expected no exif chunk nor flag")
+	}
+
+	if int(binary.LittleEndian.Uint32(out[4:8])) != len(out)-8 {
+		t.Fatal("expected the riff size to match")
+	}
+}
@@ -1,10 +1,11 @@
 package indexer
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"math/big"
+	"strconv"
 	"time"
 
 	nostreth "github.com/comunifi/nostr-eth"
@@ -29,7 +30,7 @@ type cleanup struct {
 	b uint64
 }
 
-func (i *Indexer) ListenToLogs(ev *relay.Event, quitAck chan error) error {
+func (i *Indexer) ListenToLogs(ctx context.Context, ev *relay.Event, quitAck chan error) error {
 	logch := make(chan types.Log)
 
 	q, err := i.FilterQueryFromEvent(ev)
@@ -38,16 +39,25 @@ func (i *Indexer) ListenToLogs(ev *relay.Event, quitAck chan error) error {
 	}
 
 	go func() {
-		err := i.evm.ListenForLogs(i.ctx, *q, logch)
-		if err != nil {
+		err := i.evm.ListenForLogs(ctx, *q, logch)
+		if err != nil && ctx.Err() == nil {
 			quitAck <- err
 		}
 	}()
 
+	i.listen(ev, *q)
+
 	blks := map[uint64]*block{}
 	var toDelete []cleanup
 
-	for log := range logch {
+	for {
+		var log types.Log
+		select {
+		case <-ctx.Done():
+			return nil
+		case log = <-logch:
+		}
+
 		blk, ok := blks[log.BlockNumber]
 		if !ok {
 			t, err := i.evm.BlockTime(big.NewInt(int64(log.BlockNumber)))
@@ -75,6 +85,7 @@ func (i *Indexer) ListenToLogs(ev *relay.Event, quitAck chan error) error {
 			// Log the error but don't crash the indexer
 			// This can happen when event signatures are malformed or empty
 			fmt.Printf("[%s] warning: failed to parse topics from log: %v\n", ev.Contract, err)
+			i.processed(ev, log.BlockNumber)
 			continue
 		}
 
@@ -83,13 +94,14 @@ func (i *Indexer) ListenToLogs(ev *relay.Event, quitAck chan error) error {
 			return err
 		}
 
-		l := &nostreth.Log{
+		l := &relay.Log{
 			TxHash:    log.TxHash.Hex(),
 			ChainID:   i.chainID.String(),
 			Topic:     ev.Topic,
 			CreatedAt: time.Unix(int64(blk.Time), 0).UTC(),
 			UpdatedAt: time.Now().UTC(),
 			Nonce:     int64(0),
+			Sender:    i.sender(ev, log, topics),
 			To:        log.Address.Hex(),
 			Value:     big.NewInt(0), // Set to 0 as we don't have this information from the log
 			Data:      (*json.RawMessage)(&b),
@@ -97,25 +109,20 @@ func (i *Indexer) ListenToLogs(ev *relay.Event, quitAck chan error) error {
 
 		l.Hash = l.GenerateUniqueHash()
 
-		var txEv *nostr.Event
-		switch ev.Topic {
-		case nostreth.TopicERC20Transfer:
-			txEv, err = nostreth.CreateTxTransferEvent(*l)
-			if err != nil {
-				fmt.Println("Error creating tx log event:", err)
-				return err
-			}
-
-		default:
-			txEv, err = nostreth.CreateTxLogEvent(*l)
-			if err != nil {
-				fmt.Println("Error creating tx log event:", err)
-				return err
-			}
+		txEv, err := relay.NewLogEvent(l)
+		if err != nil {
+			return err
 		}
 
-		if txEv == nil {
-			return errors.New("something went wrong parsing an event from a log")
+		// the block lets the finality of the tx event be updated as the chain finalizes
+		txEv.Tags = append(txEv.Tags,
+			nostr.Tag{"block", strconv.FormatUint(log.BlockNumber, 10)},
+			nostr.Tag{"finality", i.blockFinality(log.BlockNumber)},
+		)
+
+		// scope the tx event to the group the event registration belongs to
+		if ev.GroupID != "" {
+			txEv.Tags = append(txEv.Tags, nostr.Tag{"h", ev.GroupID})
 		}
 
 		txEv, err = i.n.SignAndSaveEvent(i.ctx, txEv)
@@ -123,6 +130,10 @@ func (i *Indexer) ListenToLogs(ev *relay.Event, quitAck chan error) error {
 			return err
 		}
 
+		for _, h := range i.logHooks {
+			h(ev, l, topics)
+		}
+
 		txData, err := i.db.DataDB.GetData(l.Hash)
 		if err != nil && err != pgx.ErrNoRows {
 			return err
@@ -154,30 +165,18 @@ func (i *Indexer) ListenToLogs(ev *relay.Event, quitAck chan error) error {
 			}
 		}
 
-		llog := &relay.LegacyLog{
-			Hash:      l.Hash,
-			TxHash:    l.TxHash,
-			CreatedAt: l.CreatedAt,
-			UpdatedAt: l.UpdatedAt,
-			Nonce:     l.Nonce,
-			Sender:    l.Sender,
-			To:        l.To,
-			Value:     l.Value,
-			Data:      l.Data,
-			Status:    relay.LegacyLogStatusSuccess,
-			ExtraData: txData,
-		}
+		llog := relay.NewLegacyLog(l, txData)
 
 		llog.GenerateUniqueHash(i.chainID.String())
 
 		i.pools.BroadcastMessage(relay.WSMessageTypeUpdate, llog)
-	}
 
-	return nil
+		i.processed(ev, log.BlockNumber)
+	}
 }
 
 func (i *Indexer) FilterQueryFromEvent(ev *relay.Event) (*ethereum.FilterQuery, error) {
-	topic0 := ev.GetTopic0FromEventSignature()
+	topic0 := ev.GetTopic0()
 
 	topics := [][]common.Hash{
 		{topic0},
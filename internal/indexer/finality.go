@@ -0,0 +1,220 @@
+package indexer
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// finality of the block of a tx log event, clients treat transfers as reorg safe once finalized
+const (
+	FinalityPending   = "pending"
+	FinalitySafe      = "safe"
+	FinalityFinalized = "finalized"
+)
+
+// how far back events that aren't finalized are looked up, chains finalize well within it
+const finalityWindow = 24 * time.Hour
+
+// events updated at most per check, the rest follow on the next one
+const finalityBatch = 500
+
+var errFinalityUnsupported = errors.New("the node doesn't support the safe and finalized block tags")
+
+type finalityState struct {
+	safe          uint64
+	finalized     uint64
+	confirmations uint64 // depth after which a block is final on nodes without the block tags, 0 when unknown
+}
+
+// SetConfirmations treats blocks deeper than n as finalized when the node doesn't support the
+// safe and finalized block tags
+func (i *Indexer) SetConfirmations(n uint64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.finality.confirmations = n
+}
+
+// finalityOf returns the finality of a block given the safe and finalized heads
+func finalityOf(blk, safe, finalized uint64) string {
+	switch {
+	case blk <= finalized:
+		return FinalityFinalized
+	case blk <= safe:
+		return FinalitySafe
+	default:
+		return FinalityPending
+	}
+}
+
+// blockFinality returns the finality of a block as of the last check
+func (i *Indexer) blockFinality(blk uint64) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return finalityOf(blk, i.finality.safe, i.finality.finalized)
+}
+
+// MonitorFinality updates the finality of the tx log events as blocks become safe and finalized
+// every interval, it stops when the node doesn't support the block tags and no confirmation
+// depth is set
+func (i *Indexer) MonitorFinality(interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-i.ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := i.checkFinality()
+			if errors.Is(err, errFinalityUnsupported) {
+				log.Default().Println("indexer: tx log events stay pending,", err)
+				return nil
+			}
+			if err != nil {
+				log.Default().Println("indexer: failed to update finality:", err)
+			}
+		}
+	}
+}
+
+// checkFinality fetches the safe and finalized heads and replaces the events whose block reached them
+func (i *Indexer) checkFinality() error {
+	safe, finalized, err := i.finalityHeads()
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	i.finality.safe = max(safe, finalized)
+	i.finality.finalized = finalized
+	i.mu.Unlock()
+
+	events, err := i.n.GetUnfinalizedLogs(time.Now().Add(-finalityWindow), finalityBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, ev := range events {
+		next, ok := withFinality(ev, max(safe, finalized), finalized)
+		if !ok {
+			continue
+		}
+
+		_, err := i.n.SignAndReplaceEvent(i.ctx, next)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withFinality returns a copy of the event to sign with its updated finality, false when the
+// finality of its block didn't change. The copy references the first version of the event so that
+// what was linked to it can still be found.
+func withFinality(ev *nostr.Event, safe, finalized uint64) (*nostr.Event, bool) {
+	tag := ev.Tags.GetFirst([]string{"block", ""})
+	if tag == nil {
+		return nil, false
+	}
+
+	blk, err := strconv.ParseUint(tag.Value(), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	level := finalityOf(blk, safe, finalized)
+
+	current := ev.Tags.GetFirst([]string{"finality", ""})
+	if current != nil && current.Value() == level {
+		return nil, false
+	}
+
+	tags := make(nostr.Tags, 0, len(ev.Tags)+1)
+	replaces := false
+	for _, t := range ev.Tags {
+		switch t.Key() {
+		case "finality":
+			t = nostr.Tag{"finality", level}
+		case "replaces":
+			replaces = true
+		}
+		tags = append(tags, t)
+	}
+
+	if !replaces {
+		tags = append(tags, nostr.Tag{"replaces", ev.ID})
+	}
+
+	return &nostr.Event{
+		PubKey:    ev.PubKey,
+		CreatedAt: ev.CreatedAt,
+		Kind:      ev.Kind,
+		Tags:      tags,
+		Content:   ev.Content,
+	}, true
+}
+
+// finalityHeads returns the safe and finalized blocks, by confirmation depth when the node doesn't
+// support the block tags
+func (i *Indexer) finalityHeads() (uint64, uint64, error) {
+	safe, err := i.blockByTag(FinalitySafe)
+	if err == nil {
+		var finalized uint64
+		finalized, err = i.blockByTag(FinalityFinalized)
+		if err == nil {
+			return safe, finalized, nil
+		}
+	}
+
+	i.mu.Lock()
+	confirmations := i.finality.confirmations
+	i.mu.Unlock()
+
+	if !errors.Is(err, errFinalityUnsupported) || confirmations == 0 {
+		return 0, 0, err
+	}
+
+	latest, err := i.evm.LatestBlock()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	head := latest.Uint64()
+	if head < confirmations {
+		return 0, 0, nil
+	}
+
+	return head - confirmations, head - confirmations, nil
+}
+
+// blockByTag returns the number of the block the node reports for a tag
+func (i *Indexer) blockByTag(tag string) (uint64, error) {
+	params, err := json.Marshal([]any{tag, false})
+	if err != nil {
+		return 0, err
+	}
+
+	var blk *struct {
+		Number hexutil.Uint64 `json:"number"`
+	}
+
+	err = i.evm.Call("eth_getBlockByNumber", &blk, params)
+	if err != nil {
+		return 0, err
+	}
+
+	if blk == nil {
+		return 0, errFinalityUnsupported
+	}
+
+	return uint64(blk.Number), nil
+}
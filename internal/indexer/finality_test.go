@@ -0,0 +1,58 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestWithFinality(t *testing.T) {
+	ev := &nostr.Event{
+		ID:   "first",
+		Kind: 9735,
+		Tags: nostr.Tags{{"d", "0xhash"}, {"block", "100"}, {"finality", FinalityPending}},
+	}
+
+	// the block isn't safe yet
+	_, ok := withFinality(ev, 99, 90)
+	if ok {
+		t.Fatal("expected the event to stay pending")
+	}
+
+	next, ok := withFinality(ev, 100, 90)
+	if !ok {
+		t.Fatal("expected the event to become safe")
+	}
+
+	if v := next.Tags.GetFirst([]string{"finality", ""}).Value(); v != FinalitySafe {
+		t.Fatalf("expected finality %s, got %s", FinalitySafe, v)
+	}
+
+	if v := next.Tags.GetFirst([]string{"replaces", ""}).Value(); v != "first" {
+		t.Fatalf("expected the first version to be referenced, got %s", v)
+	}
+
+	// the second update keeps referencing the first version
+	next.ID = "second"
+	last, ok := withFinality(next, 120, 110)
+	if !ok {
+		t.Fatal("expected the event to become finalized")
+	}
+
+	if v := last.Tags.GetFirst([]string{"finality", ""}).Value(); v != FinalityFinalized {
+		t.Fatalf("expected finality %s, got %s", FinalityFinalized, v)
+	}
+
+	replaces := 0
+	for _, tag := range last.Tags {
+		if tag.Key() == "replaces" {
+			replaces++
+			if tag.Value() != "first" {
+				t.Fatalf("expected the first version to be referenced, got %s", tag.Value())
+			}
+		}
+	}
+	if replaces != 1 {
+		t.Fatalf("expected a single replaces tag, got %d", replaces)
+	}
+}
@@ -0,0 +1,26 @@
+package indexer
+
+import (
+	"net/http"
+
+	com "github.com/comunifi/relay/pkg/common"
+)
+
+type Handlers struct {
+	i *Indexer
+}
+
+func NewHandlers(i *Indexer) *Handlers {
+	return &Handlers{
+		i: i,
+	}
+}
+
+// Get returns how far the logs of each registered event were indexed and how far behind the
+// head of the chain they are
+func (h *Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	err := com.BodyMultiple(w, h.i.Progress(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -3,12 +3,18 @@ package indexer
 import (
 	"context"
 	"errors"
+	"log"
 	"math/big"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/comunifi/relay/internal/db"
 	"github.com/comunifi/relay/internal/nostr"
+	"github.com/comunifi/relay/internal/signatures"
 	"github.com/comunifi/relay/internal/ws"
 	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum"
 )
 
 type ErrIndexing error
@@ -27,10 +33,139 @@ type Indexer struct {
 	evm relay.EVMRequester
 
 	pools *ws.ConnectionPools
+
+	signatures *signatures.Registry
+
+	senders *senderCache // nil unless the transaction sender lookup is enabled
+
+	logHooks []LogHook
+
+	mu        sync.Mutex
+	listeners map[string]*listener
+
+	lag      lagState
+	finality finalityState
+}
+
+// listener is the state of the subscription to the logs of a registered event
+type listener struct {
+	Contract  string     `json:"contract"`
+	Topic     string     `json:"topic"`
+	StartedAt time.Time  `json:"started_at"`
+	Logs      uint64     `json:"logs"`
+	LastBlock uint64     `json:"last_block"`
+	LastLogAt *time.Time `json:"last_log_at,omitempty"`
+
+	// every log up to Processed was indexed, it is advanced by the lag monitor
+	Processed uint64 `json:"processed"`
+	Head      uint64 `json:"head"`
+	Lag       uint64 `json:"lag"`
+
+	query   ethereum.FilterQuery
+	alerted bool
+}
+
+// LogHook is called with every log the indexer stored, it must not block
+type LogHook func(ev *relay.Event, l *relay.Log, topics relay.Topics)
+
+func NewIndexer(ctx context.Context, secretKey string, chainID *big.Int, db *db.DB, n *nostr.Nostr, evm relay.EVMRequester, pools *ws.ConnectionPools, sigs *signatures.Registry) *Indexer {
+	return &Indexer{ctx: ctx, secretKey: secretKey, chainID: chainID, db: db, n: n, evm: evm, pools: pools, signatures: sigs, listeners: map[string]*listener{}}
+}
+
+// AddLogHook calls a hook with every log stored from now on
+func (i *Indexer) AddLogHook(h LogHook) {
+	i.logHooks = append(i.logHooks, h)
 }
 
-func NewIndexer(ctx context.Context, secretKey string, chainID *big.Int, db *db.DB, n *nostr.Nostr, evm relay.EVMRequester, pools *ws.ConnectionPools) *Indexer {
-	return &Indexer{ctx: ctx, secretKey: secretKey, chainID: chainID, db: db, n: n, evm: evm, pools: pools}
+// listen starts tracking the logs of an event, the subscription streams the logs after the query starts
+func (i *Indexer) listen(ev *relay.Event, q ethereum.FilterQuery) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	l := &listener{Contract: ev.Contract, Topic: ev.Topic, StartedAt: time.Now().UTC(), query: q}
+	if q.FromBlock != nil && q.FromBlock.Sign() > 0 {
+		l.Processed = q.FromBlock.Uint64() - 1
+	}
+
+	i.listeners[ev.Contract+"/"+ev.Topic] = l
+}
+
+// processed records that a log of an event was indexed
+func (i *Indexer) processed(ev *relay.Event, blk uint64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	l, ok := i.listeners[ev.Contract+"/"+ev.Topic]
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+
+	l.Logs++
+	l.LastBlock = blk
+	l.LastLogAt = &now
+
+	// logs are streamed in order, the earlier blocks are done
+	if blk > 0 {
+		l.Processed = max(l.Processed, blk-1)
+	}
+}
+
+// DebugState reports the events being listened to and when they last received a log
+func (i *Indexer) DebugState() any {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	listeners := make([]listener, 0, len(i.listeners))
+	for _, l := range i.listeners {
+		listeners = append(listeners, *l)
+	}
+
+	sort.Slice(listeners, func(a, b int) bool {
+		return listeners[a].Contract+listeners[a].Topic < listeners[b].Contract+listeners[b].Topic
+	})
+
+	return map[string]any{
+		"listeners": listeners,
+	}
+}
+
+// Progress is how far the logs of a registered event were indexed, compared to the head of the chain
+// when the lag monitor last checked
+type Progress struct {
+	Contract  string     `json:"contract"`
+	Topic     string     `json:"topic"`
+	LastBlock uint64     `json:"last_block"` // block of the last indexed log
+	Processed uint64     `json:"processed"`  // every log up to this block was indexed
+	Head      uint64     `json:"head"`
+	Lag       uint64     `json:"lag"` // blocks between processed and head
+	LastLogAt *time.Time `json:"last_log_at,omitempty"`
+}
+
+// Progress reports how far the logs of each event being listened to were indexed
+func (i *Indexer) Progress() []Progress {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	progress := make([]Progress, 0, len(i.listeners))
+	for _, l := range i.listeners {
+		progress = append(progress, Progress{
+			Contract:  l.Contract,
+			Topic:     l.Topic,
+			LastBlock: l.LastBlock,
+			Processed: l.Processed,
+			Head:      l.Head,
+			Lag:       l.Lag,
+			LastLogAt: l.LastLogAt,
+		})
+	}
+
+	sort.Slice(progress, func(a, b int) bool {
+		return progress[a].Contract+progress[a].Topic < progress[b].Contract+progress[b].Topic
+	})
+
+	return progress
 }
 
 func (i *Indexer) Start() error {
@@ -39,16 +174,44 @@ func (i *Indexer) Start() error {
 		return err
 	}
 
-	quitAck := make(chan error)
+	// listeners are stopped when Start returns so that it can be restarted, every listener can
+	// report up to two errors and must never block once nobody is reading them
+	ctx, cancel := context.WithCancel(i.ctx)
+	defer cancel()
+
+	quitAck := make(chan error, 2*len(evs))
 
 	for _, ev := range evs {
+		// events registered by topic0 only need a signature to parse their logs
+		if ev.EventSignature == "" {
+			sig, err := i.signatures.ResolveContract(i.ctx, i.evm, ev.Contract, ev.Topic)
+			if err != nil {
+				log.Default().Printf("[%s] could not resolve signature of topic %s: %v\n", ev.Contract, ev.Topic, err)
+				continue
+			}
+
+			err = i.db.EventDB.SetEventSignature(ev.ChainID, ev.Contract, ev.Topic, sig)
+			if err != nil {
+				return err
+			}
+
+			log.Default().Printf("[%s] resolved topic %s to %s\n", ev.Contract, ev.Topic, sig)
+
+			ev.EventSignature = sig
+		}
+
 		go func() {
-			err := i.ListenToLogs(ev, quitAck)
+			err := i.ListenToLogs(ctx, ev, quitAck)
 			if err != nil {
 				quitAck <- err
 			}
 		}()
 	}
 
-	return <-quitAck
+	select {
+	case <-i.ctx.Done():
+		return nil
+	case err := <-quitAck:
+		return err
+	}
 }
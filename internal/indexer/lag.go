@@ -0,0 +1,176 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/comunifi/relay/internal/metrics"
+)
+
+// blocks looked up for logs that weren't indexed, at most per event and check, so that a long
+// stall doesn't ask the node for more logs than it serves at once
+const maxLagRange = 2000
+
+// Notifier alerts operators when an event falls behind
+type Notifier interface {
+	Notify(ctx context.Context, message string) error
+	NotifyWarning(ctx context.Context, err error) error
+}
+
+type lagState struct {
+	head      uint64
+	threshold uint64
+	notifier  Notifier // nil unless lag alerts are enabled
+}
+
+// alert is a lag alert to send once the state is unlocked
+type alert struct {
+	recovered bool
+	message   string
+}
+
+// SetLagAlerts warns operators when an event falls more than threshold blocks behind the head of
+// the chain, and again once it caught up
+func (i *Indexer) SetLagAlerts(n Notifier, threshold uint64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.lag.notifier = n
+	i.lag.threshold = threshold
+}
+
+// MonitorLag checks how far the logs of each event were indexed every interval
+func (i *Indexer) MonitorLag(interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-i.ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := i.checkLag()
+			if err != nil {
+				log.Default().Println("indexer: failed to check lag:", err)
+			}
+		}
+	}
+}
+
+// checkLag advances how far the logs of each event are known to be indexed. The logs between the
+// last processed block and the head of the chain are looked up, an event is done up to the block
+// before the first log it didn't index yet, or up to the head when there is none.
+func (i *Indexer) checkLag() error {
+	latest, err := i.evm.LatestBlock()
+	if err != nil {
+		return err
+	}
+	head := latest.Uint64()
+
+	i.mu.Lock()
+	listeners := make(map[string]*listener, len(i.listeners))
+	processed := make(map[string]uint64, len(i.listeners))
+	lastBlocks := make(map[string]uint64, len(i.listeners))
+	for key, l := range i.listeners {
+		listeners[key] = l
+		processed[key] = l.Processed
+		lastBlocks[key] = l.LastBlock
+	}
+	i.lag.head = head
+	n, threshold := i.lag.notifier, i.lag.threshold
+	i.mu.Unlock()
+
+	alerts := []alert{}
+
+	for key, l := range listeners {
+		done := processed[key]
+
+		from := processed[key] + 1
+		to := min(head, from+maxLagRange-1)
+		if from <= to {
+			q := l.query
+			q.FromBlock = new(big.Int).SetUint64(from)
+			q.ToBlock = new(big.Int).SetUint64(to)
+
+			logs, err := i.evm.FilterLogs(q)
+			if err != nil {
+				log.Default().Printf("[%s] indexer: failed to look up logs of topic %s: %v\n", l.Contract, l.Topic, err)
+				continue
+			}
+
+			done = to
+			for _, lg := range logs {
+				if lg.BlockNumber > lastBlocks[key] && lg.BlockNumber-1 < done {
+					done = lg.BlockNumber - 1
+				}
+			}
+		}
+
+		i.mu.Lock()
+		// the listener was replaced when the indexer restarted
+		if i.listeners[key] != l {
+			i.mu.Unlock()
+			continue
+		}
+
+		l.Processed = max(l.Processed, done)
+		l.Head = head
+		l.Lag = 0
+		if head > l.Processed {
+			l.Lag = head - l.Processed
+		}
+
+		if n != nil && threshold > 0 {
+			switch {
+			case l.Lag > threshold && !l.alerted:
+				l.alerted = true
+				alerts = append(alerts, alert{message: fmt.Sprintf("indexer: logs of topic %s of %s are %d blocks behind, last indexed block %d", l.Topic, l.Contract, l.Lag, l.Processed)})
+			case l.Lag <= threshold && l.alerted:
+				l.alerted = false
+				alerts = append(alerts, alert{recovered: true, message: fmt.Sprintf("indexer: logs of topic %s of %s caught up, %d blocks behind", l.Topic, l.Contract, l.Lag)})
+			}
+		}
+		i.mu.Unlock()
+	}
+
+	for _, a := range alerts {
+		if a.recovered {
+			n.Notify(i.ctx, a.message)
+			continue
+		}
+
+		n.NotifyWarning(i.ctx, errors.New(a.message))
+	}
+
+	return nil
+}
+
+// WriteMetrics writes how far the logs of each event were indexed
+func (i *Indexer) WriteMetrics(w io.Writer) {
+	head := func() uint64 {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+
+		return i.lag.head
+	}()
+
+	metrics.Help(w, "relay_indexer_head_block", "gauge", "head of the chain when the indexer lag was last checked")
+	metrics.Sample(w, "relay_indexer_head_block", float64(head))
+
+	progress := i.Progress()
+
+	metrics.Help(w, "relay_indexer_processed_block", "gauge", "block up to which every log of the event was indexed")
+	for _, p := range progress {
+		metrics.Sample(w, "relay_indexer_processed_block", float64(p.Processed), "contract", p.Contract, "topic", p.Topic)
+	}
+
+	metrics.Help(w, "relay_indexer_lag_blocks", "gauge", "blocks between the last indexed block of the event and the head of the chain")
+	for _, p := range progress {
+		metrics.Sample(w, "relay_indexer_lag_blocks", float64(p.Lag), "contract", p.Contract, "topic", p.Topic)
+	}
+}
@@ -0,0 +1,113 @@
+package indexer
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type fakeEVM struct {
+	relay.EVMRequester
+
+	head uint64
+	logs []types.Log
+}
+
+func (e *fakeEVM) LatestBlock() (*big.Int, error) {
+	return new(big.Int).SetUint64(e.head), nil
+}
+
+func (e *fakeEVM) FilterLogs(q ethereum.FilterQuery) ([]types.Log, error) {
+	logs := []types.Log{}
+	for _, l := range e.logs {
+		if l.BlockNumber >= q.FromBlock.Uint64() && l.BlockNumber <= q.ToBlock.Uint64() {
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+type fakeNotifier struct {
+	messages []string
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, message string) error {
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func (n *fakeNotifier) NotifyWarning(ctx context.Context, err error) error {
+	n.messages = append(n.messages, "warning: "+err.Error())
+	return nil
+}
+
+func TestLag(t *testing.T) {
+	evm := &fakeEVM{head: 100}
+	i := &Indexer{ctx: context.Background(), evm: evm, listeners: map[string]*listener{}}
+
+	n := &fakeNotifier{}
+	i.SetLagAlerts(n, 10)
+
+	ev := &relay.Event{Contract: "0xtoken", Topic: "0xtransfer"}
+	i.listen(ev, ethereum.FilterQuery{FromBlock: big.NewInt(101)})
+
+	// a quiet event is caught up with the head of the chain
+	evm.head = 150
+	err := i.checkLag()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := i.Progress()
+	if len(p) != 1 || p[0].Processed != 150 || p[0].Lag != 0 {
+		t.Fatalf("expected the event to be caught up, got %+v", p)
+	}
+
+	// a log that wasn't indexed holds the event back
+	evm.logs = []types.Log{{BlockNumber: 160}}
+	evm.head = 200
+
+	err = i.checkLag()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p = i.Progress()
+	if p[0].Processed != 159 || p[0].Lag != 41 {
+		t.Fatalf("expected the event to be behind, got %+v", p)
+	}
+
+	if len(n.messages) != 1 || !strings.HasPrefix(n.messages[0], "warning: indexer: logs of topic 0xtransfer") {
+		t.Fatalf("expected a lag alert, got %v", n.messages)
+	}
+
+	// the alert is sent once while the event stays behind
+	evm.head = 210
+	i.checkLag()
+
+	if len(n.messages) != 1 {
+		t.Fatalf("expected a single alert, got %v", n.messages)
+	}
+
+	// the log is indexed and the event catches up
+	i.processed(ev, 160)
+
+	err = i.checkLag()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p = i.Progress()
+	if p[0].Processed != 210 || p[0].Lag != 0 {
+		t.Fatalf("expected the event to catch up, got %+v", p)
+	}
+
+	if len(n.messages) != 2 || !strings.Contains(n.messages[1], "caught up") {
+		t.Fatalf("expected a recovery message, got %v", n.messages)
+	}
+}
@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"sync"
+
+	"github.com/comunifi/relay/internal/debug"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const DefaultSenderCacheSize = 1024
+
+// senderCache keeps the senders of recent transactions, a transaction often emits several
+// logs that are indexed one after the other
+type senderCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[common.Hash]common.Address
+}
+
+func newSenderCache(maxEntries int) *senderCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultSenderCacheSize
+	}
+
+	return &senderCache{
+		maxEntries: maxEntries,
+		entries:    map[common.Hash]common.Address{},
+	}
+}
+
+func (c *senderCache) get(tx common.Hash) (common.Address, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	addr, ok := c.entries[tx]
+	return addr, ok
+}
+
+func (c *senderCache) set(tx common.Hash, addr common.Address) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// make room by dropping an arbitrary entry
+	for k := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			break
+		}
+
+		delete(c.entries, k)
+	}
+
+	c.entries[tx] = addr
+}
+
+// SetTxSenderLookup makes the indexer fetch the sender of the transaction for logs of events
+// that don't carry it, size bounds the number of cached senders
+func (i *Indexer) SetTxSenderLookup(size int) {
+	i.senders = newSenderCache(size)
+}
+
+// sender returns the account that initiated a log: the decoded argument of well known events,
+// otherwise the sender of the transaction when the lookup is enabled. A failed lookup leaves
+// the sender empty rather than holding up indexing.
+func (i *Indexer) sender(ev *relay.Event, log types.Log, topics relay.Topics) string {
+	if s := relay.SenderFromTopics(ev.Topic, topics); s != "" {
+		return s
+	}
+
+	if i.senders == nil {
+		return ""
+	}
+
+	if addr, ok := i.senders.get(log.TxHash); ok {
+		return addr.Hex()
+	}
+
+	addr, err := i.evm.TransactionSender(i.ctx, log.TxHash, log.BlockHash, log.TxIndex)
+	if err != nil {
+		debug.Debugf("[%s] failed to fetch the sender of %s: %v", ev.Contract, log.TxHash.Hex(), err)
+		return ""
+	}
+
+	i.senders.set(log.TxHash, addr)
+
+	return addr.Hex()
+}
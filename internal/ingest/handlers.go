@@ -0,0 +1,49 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+// Push godoc
+//
+//	@Summary		Push decoded logs
+//	@Description	store logs decoded by a trusted external indexer as tx log events, logs that are already stored are skipped
+//	@Tags			logs
+//	@Accept			json
+//	@Produce		json
+//	@Param			batch	body		relay.LogIngestRequest	true	"At most 500 logs"
+//	@Success		200	{object}	common.Response
+//	@Failure		400
+//	@Failure		401
+//	@Failure		500
+//	@Router			/v1/logs/ingest [post]
+func (s *Service) Push(w http.ResponseWriter, r *http.Request) {
+	var req relay.LogIngestRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	result, err := s.Ingest(r.Context(), &req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidBatch) || errors.Is(err, ErrInvalidLog) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, result, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,181 @@
+// Package ingest stores logs pushed by trusted external indexers, e.g. a subgraph consumer, so
+// that chains the relay can't stream from can still feed communities.
+//
+// An indexer pushes batches of decoded logs with INGEST_API_KEY to POST /v1/logs/ingest. Every
+// log is stored as the same tx transfer or tx log event the indexer would have made, under the
+// hash the relay computes for it, so a log pushed twice or also indexed by the relay is only
+// stored once.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// most logs in a batch
+const maxLogs = 500
+
+var (
+	ErrInvalidBatch = errors.New("invalid batch")
+	ErrInvalidLog   = errors.New("invalid log")
+)
+
+// Store keeps the events of the logs
+type Store interface {
+	LogHashes(hashes []string, chainID string) (map[string]bool, error)
+	SignAndSaveEvent(ctx context.Context, ev *nostr.Event) (*nostr.Event, error)
+}
+
+type Service struct {
+	store  Store
+	chains []string // chain ids that can be pushed, empty allows any
+
+	// batches are stored one at a time so that concurrent pushes of a log can't both store it
+	mu sync.Mutex
+
+	now func() time.Time
+}
+
+func NewService(store Store, chains []string) *Service {
+	return &Service{
+		store:  store,
+		chains: chains,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Ingest stores the logs of a batch that weren't stored yet. The batch is checked as a whole
+// first, an invalid log rejects it.
+func (s *Service) Ingest(ctx context.Context, req *relay.LogIngestRequest) (*relay.LogIngestResult, error) {
+	if len(req.Logs) == 0 || len(req.Logs) > maxLogs {
+		return nil, fmt.Errorf("%w: expected 1 to %d logs", ErrInvalidBatch, maxLogs)
+	}
+
+	events := make([]*nostr.Event, len(req.Logs))
+	byChain := map[string][]string{}
+	for i, l := range req.Logs {
+		err := s.normalize(l)
+		if err != nil {
+			return nil, fmt.Errorf("%w %d: %v", ErrInvalidLog, i, err)
+		}
+
+		// transfers need their data to name the sender, recipient and amount
+		ev, err := relay.NewLogEvent(l)
+		if err != nil {
+			return nil, fmt.Errorf("%w %d: %v", ErrInvalidLog, i, err)
+		}
+
+		ev.Tags = append(ev.Tags, nostr.Tag{"source", "ingest"})
+
+		if req.GroupID != "" {
+			ev.Tags = append(ev.Tags, nostr.Tag{"h", req.GroupID})
+		}
+
+		events[i] = ev
+		byChain[l.ChainID] = append(byChain[l.ChainID], l.Hash)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := map[string]bool{}
+	for chainID, hashes := range byChain {
+		found, err := s.store.LogHashes(hashes, chainID)
+		if err != nil {
+			return nil, err
+		}
+
+		for hash := range found {
+			stored[chainID+":"+hash] = true
+		}
+	}
+
+	result := &relay.LogIngestResult{
+		Created:    []string{},
+		Duplicates: []string{},
+	}
+
+	for i, l := range req.Logs {
+		key := l.ChainID + ":" + l.Hash
+		if stored[key] {
+			result.Duplicates = append(result.Duplicates, l.Hash)
+			continue
+		}
+
+		_, err := s.store.SignAndSaveEvent(ctx, events[i])
+		if err != nil {
+			return nil, err
+		}
+
+		// a log can be in a batch twice
+		stored[key] = true
+
+		result.Created = append(result.Created, l.Hash)
+	}
+
+	return result, nil
+}
+
+// normalize checks a pushed log and fills in what the relay computes itself
+func (s *Service) normalize(l *relay.Log) error {
+	if l == nil {
+		return errors.New("missing log")
+	}
+
+	if _, ok := new(big.Int).SetString(l.ChainID, 10); !ok {
+		return errors.New("chain_id must be a decimal chain id")
+	}
+
+	if len(s.chains) > 0 && !slices.Contains(s.chains, l.ChainID) {
+		return fmt.Errorf("chain %s can't be pushed", l.ChainID)
+	}
+
+	b, err := hexutil.Decode(l.TxHash)
+	if err != nil || len(b) != common.HashLength {
+		return errors.New("tx_hash must be a transaction hash")
+	}
+
+	if !common.IsHexAddress(l.To) {
+		return errors.New("to must be the address of the contract")
+	}
+
+	if l.Sender != "" && !common.IsHexAddress(l.Sender) {
+		return errors.New("sender must be an address")
+	}
+
+	if strings.TrimSpace(l.Topic) == "" {
+		return errors.New("missing topic")
+	}
+
+	if l.CreatedAt.IsZero() {
+		return errors.New("missing created_at")
+	}
+
+	if l.Value == nil {
+		l.Value = big.NewInt(0)
+	}
+
+	l.TxHash = common.BytesToHash(b).Hex()
+	l.To = common.HexToAddress(l.To).Hex()
+	if l.Sender != "" {
+		l.Sender = common.HexToAddress(l.Sender).Hex()
+	}
+	l.CreatedAt = l.CreatedAt.UTC()
+	l.UpdatedAt = s.now()
+
+	// the hash pushed is not trusted, it is what logs are deduplicated by
+	l.Hash = l.GenerateUniqueHash()
+
+	return nil
+}
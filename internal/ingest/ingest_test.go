@@ -0,0 +1,113 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+)
+
+// fakeStore finds the logs among the events of the shared fake
+type fakeStore struct {
+	testutil.FakeStore
+}
+
+func (s *fakeStore) LogHashes(hashes []string, chainID string) (map[string]bool, error) {
+	found := map[string]bool{}
+	for _, ev := range s.Events {
+		layer := ev.Tags.Find("layer")
+		if layer != nil && layer[1] == chainID {
+			found[ev.Tags.GetD()] = true
+		}
+	}
+
+	return found, nil
+}
+
+func transfer(txHash string) *relay.Log {
+	data := json.RawMessage(`{"from":"0x5FbDB2315678afecb367f032d93F642f64180aa3","to":"0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512","value":"100"}`)
+
+	return &relay.Log{
+		Hash:      "0xspoofed",
+		TxHash:    txHash,
+		ChainID:   "100",
+		Topic:     nostreth.TopicERC20Transfer,
+		CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Sender:    "0x5FbDB2315678afecb367f032d93F642f64180aa3",
+		To:        "0x9fe46736679d2d9a65f0992f2272de9f3c7fa6e0",
+		Value:     big.NewInt(100),
+		Data:      &data,
+	}
+}
+
+func TestIngest(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeStore{}
+	s := NewService(store, []string{"100"})
+
+	first := "0x1111111111111111111111111111111111111111111111111111111111111111"
+	second := "0x2222222222222222222222222222222222222222222222222222222222222222"
+
+	result, err := s.Ingest(ctx, &relay.LogIngestRequest{GroupID: "demo", Logs: []*relay.Log{transfer(first), transfer(first)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a log in a batch twice is stored once, under the hash the relay computes
+	if len(result.Created) != 1 || len(result.Duplicates) != 1 || result.Created[0] == "0xspoofed" {
+		t.Fatalf("expected 1 created and 1 duplicate, got %v", result)
+	}
+
+	if len(store.Events) != 1 || store.Events[0].Tags.GetD() != result.Created[0] {
+		t.Fatalf("expected the event of the log, got %v", store.Events)
+	}
+
+	h := store.Events[0].Tags.Find("h")
+	if h == nil || h[1] != "demo" {
+		t.Fatalf("expected the log to be scoped to the group, got %v", store.Events[0].Tags)
+	}
+
+	// pushing again only stores the new log
+	result, err = s.Ingest(ctx, &relay.LogIngestRequest{Logs: []*relay.Log{transfer(first), transfer(second)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Created) != 1 || len(result.Duplicates) != 1 || len(store.Events) != 2 {
+		t.Fatalf("expected only the second log to be stored, got %v", result)
+	}
+}
+
+func TestIngestInvalid(t *testing.T) {
+	s := NewService(&fakeStore{}, []string{"100"})
+
+	cases := map[string]func(l *relay.Log){
+		"other chain":      func(l *relay.Log) { l.ChainID = "1" },
+		"invalid tx hash":  func(l *relay.Log) { l.TxHash = "0x1234" },
+		"invalid contract": func(l *relay.Log) { l.To = "nope" },
+		"no topic":         func(l *relay.Log) { l.Topic = "" },
+		"no time":          func(l *relay.Log) { l.CreatedAt = time.Time{} },
+		"transfer no from": func(l *relay.Log) { d := json.RawMessage(`{"to":"0x1","value":"1"}`); l.Data = &d },
+	}
+
+	for name, change := range cases {
+		l := transfer("0x1111111111111111111111111111111111111111111111111111111111111111")
+		change(l)
+
+		_, err := s.Ingest(context.Background(), &relay.LogIngestRequest{Logs: []*relay.Log{l}})
+		if !errors.Is(err, ErrInvalidLog) {
+			t.Errorf("%s: expected an invalid log, got %v", name, err)
+		}
+	}
+
+	_, err := s.Ingest(context.Background(), &relay.LogIngestRequest{})
+	if !errors.Is(err, ErrInvalidBatch) {
+		t.Errorf("expected an empty batch to be invalid, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package integrity
+
+import (
+	"net/http"
+
+	com "github.com/comunifi/relay/pkg/common"
+)
+
+type Handlers struct {
+	c *Checker
+}
+
+func NewHandlers(c *Checker) *Handlers {
+	return &Handlers{
+		c: c,
+	}
+}
+
+// Get returns the report of the latest integrity check
+func (h *Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	report := h.c.Last()
+	if report == nil {
+		http.Error(w, "no integrity check ran yet", http.StatusNotFound)
+		return
+	}
+
+	err := com.Body(w, report, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
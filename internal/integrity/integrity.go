@@ -0,0 +1,332 @@
+package integrity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/comunifi/relay/internal/backup"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/fiatjaf/eventstore/postgresql"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// kind of the unsigned events khatru uses to index blossom blobs
+const blobIndexKind = 24242
+
+type CheckType string
+
+const (
+	CheckEvent CheckType = "event"
+	CheckBlob  CheckType = "blob"
+	CheckTxLog CheckType = "tx_log"
+)
+
+// Discrepancy is a stored record that doesn't match what it claims to be
+type Discrepancy struct {
+	Check   CheckType `json:"check"`
+	EventID string    `json:"event_id"`
+	Reason  string    `json:"reason"`
+}
+
+type Report struct {
+	CheckedAt     time.Time      `json:"checked_at"`
+	Duration      float64        `json:"duration"` // seconds
+	Events        int            `json:"events"`
+	Blobs         int            `json:"blobs"`
+	TxLogs        int            `json:"tx_logs"`
+	Errors        []string       `json:"errors,omitempty"` // checks that could not run
+	Discrepancies []*Discrepancy `json:"discrepancies"`
+}
+
+func (r *Report) add(check CheckType, id string, err error) {
+	r.Discrepancies = append(r.Discrepancies, &Discrepancy{Check: check, EventID: id, Reason: err.Error()})
+}
+
+type Config struct {
+	Interval time.Duration
+	Sample   int // number of records sampled per check and run
+}
+
+// Checker periodically samples stored records and verifies them against their signatures,
+// the blob storage and the chain
+type Checker struct {
+	ctx   context.Context
+	ndb   *postgresql.PostgresBackend
+	evm   relay.EVMRequester
+	blobs func() backup.BlobStore // nil when blob storage is not configured
+	rw    backup.Rewrites
+	w     relay.WebhookMessager
+
+	config *Config
+
+	mu   sync.Mutex
+	last *Report
+}
+
+// NewChecker creates a checker, blobs returns the blob store to use for a run and may be nil
+func NewChecker(ctx context.Context, ndb *postgresql.PostgresBackend, evm relay.EVMRequester, blobs func() backup.BlobStore, cfg *Config, w relay.WebhookMessager) *Checker {
+	return &Checker{
+		ctx:    ctx,
+		ndb:    ndb,
+		evm:    evm,
+		blobs:  blobs,
+		w:      w,
+		config: cfg,
+	}
+}
+
+// SetRewrites checks the blobs the relay rewrote against the hash of their stored content
+func (c *Checker) SetRewrites(rw backup.Rewrites) {
+	c.rw = rw
+}
+
+// Start runs a check every interval
+func (c *Checker) Start() error {
+	log.Default().Println("starting integrity checker")
+
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			log.Default().Println("stopping integrity checker")
+			return nil
+		case <-ticker.C:
+			report := c.Run()
+
+			if len(report.Discrepancies) > 0 {
+				c.w.NotifyWarning(c.ctx, fmt.Errorf("integrity check found %d discrepancies: %s", len(report.Discrepancies), summary(report)))
+			}
+
+			for _, e := range report.Errors {
+				c.w.NotifyError(c.ctx, fmt.Errorf("integrity check: %s", e))
+			}
+		}
+	}
+}
+
+// Run samples and verifies events, blobs and tx logs, the report is kept as the latest one
+func (c *Checker) Run() *Report {
+	start := time.Now()
+
+	report := &Report{
+		CheckedAt:     start.UTC(),
+		Discrepancies: []*Discrepancy{},
+	}
+
+	err := c.checkEvents(report)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("events: %s", err))
+	}
+
+	if c.blobs != nil {
+		err = c.checkBlobs(report, c.blobs())
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("blobs: %s", err))
+		}
+	}
+
+	err = c.checkTxLogs(report)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("tx logs: %s", err))
+	}
+
+	report.Duration = time.Since(start).Seconds()
+
+	c.mu.Lock()
+	c.last = report
+	c.mu.Unlock()
+
+	return report
+}
+
+// Last returns the latest report or nil if no check ran yet
+func (c *Checker) Last() *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.last
+}
+
+func (c *Checker) checkEvents(report *Report) error {
+	events, err := c.sample(`kind <> $1`, blobIndexKind)
+	if err != nil {
+		return err
+	}
+
+	for _, evt := range events {
+		report.Events++
+
+		err = VerifyEvent(evt)
+		if err != nil {
+			report.add(CheckEvent, evt.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Checker) checkBlobs(report *Report, blobs backup.BlobStore) error {
+	events, err := c.sample(`kind = $1`, blobIndexKind)
+	if err != nil {
+		return err
+	}
+
+	for _, evt := range events {
+		report.Blobs++
+
+		x := evt.Tags.Find("x")
+		if x == nil {
+			report.add(CheckBlob, evt.ID, errors.New("blob index without hash"))
+			continue
+		}
+
+		err = backup.VerifyBlob(c.ctx, blobs, c.rw, x[1])
+		if err != nil {
+			report.add(CheckBlob, evt.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Checker) checkTxLogs(report *Report) error {
+	events, err := c.sample(`kind IN ($1, $2)`, nostreth.KindTxTransfer, nostreth.KindTxLog)
+	if err != nil {
+		return err
+	}
+
+	for _, evt := range events {
+		report.TxLogs++
+
+		l, err := parseLog(evt)
+		if err != nil {
+			report.add(CheckTxLog, evt.ID, err)
+			continue
+		}
+
+		rcpt, err := c.evm.TransactionReceipt(c.ctx, common.HexToHash(l.TxHash))
+		if err != nil {
+			// the rpc being down is not a discrepancy in our data
+			if !errors.Is(err, ethereum.NotFound) {
+				return err
+			}
+
+			report.add(CheckTxLog, evt.ID, fmt.Errorf("transaction %s not found on chain", l.TxHash))
+			continue
+		}
+
+		err = VerifyLog(l, rcpt)
+		if err != nil {
+			report.add(CheckTxLog, evt.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// sample returns random events matching the condition
+func (c *Checker) sample(cond string, args ...any) ([]*nostr.Event, error) {
+	rows, err := c.ndb.DB.QueryContext(c.ctx, fmt.Sprintf(`
+	SELECT id, pubkey, created_at, kind, tags, content, sig
+	FROM event
+	WHERE %s
+	ORDER BY random()
+	LIMIT %d
+	`, cond, c.config.Sample), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*nostr.Event{}
+	for rows.Next() {
+		var evt nostr.Event
+		var timestamp int64
+		err = rows.Scan(&evt.ID, &evt.PubKey, &timestamp, &evt.Kind, &evt.Tags, &evt.Content, &evt.Sig)
+		if err != nil {
+			return nil, err
+		}
+		evt.CreatedAt = nostr.Timestamp(timestamp)
+
+		events = append(events, &evt)
+	}
+
+	return events, rows.Err()
+}
+
+// VerifyEvent checks that the id of an event matches its content and that it is signed by its author
+func VerifyEvent(evt *nostr.Event) error {
+	if evt.ID != evt.GetID() {
+		return errors.New("id does not match the event")
+	}
+
+	ok, err := evt.CheckSignature()
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+// VerifyLog checks that a successful transaction emitted the log a tx event describes
+func VerifyLog(l *relay.Log, rcpt *types.Receipt) error {
+	if rcpt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("transaction %s failed on chain", l.TxHash)
+	}
+
+	for _, rl := range rcpt.Logs {
+		if len(rl.Topics) == 0 {
+			continue
+		}
+
+		if rl.Address == common.HexToAddress(l.To) && rl.Topics[0] == common.HexToHash(l.Topic) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("transaction %s has no %s log from %s", l.TxHash, l.Topic, l.To)
+}
+
+func parseLog(evt *nostr.Event) (*relay.Log, error) {
+	l, err := relay.ParseLog(evt.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.TxHash == "" {
+		return nil, errors.New("tx event without transaction hash")
+	}
+
+	return l, nil
+}
+
+func summary(report *Report) string {
+	counts := map[CheckType]int{}
+	for _, d := range report.Discrepancies {
+		counts[d.Check]++
+	}
+
+	parts := []string{}
+	for _, check := range []CheckType{CheckEvent, CheckBlob, CheckTxLog} {
+		if counts[check] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[check], check))
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,99 @@
+package integrity
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestVerifyEvent(t *testing.T) {
+	evt := &nostr.Event{Kind: 1, Content: "hi", CreatedAt: nostr.Now()}
+	err := evt.Sign(nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyEvent(evt); err != nil {
+		t.Fatalf("expected a valid event, got %v", err)
+	}
+
+	tampered := *evt
+	tampered.Content = "bye"
+	if err := VerifyEvent(&tampered); err == nil {
+		t.Fatal("expected an edited event to fail")
+	}
+
+	resigned := tampered
+	resigned.ID = resigned.GetID()
+	if err := VerifyEvent(&resigned); err == nil {
+		t.Fatal("expected an event with a new id and the old signature to fail")
+	}
+}
+
+func TestVerifyLog(t *testing.T) {
+	contract := "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+	l := &nostreth.Log{TxHash: "0x01", To: contract, Topic: nostreth.TopicERC20Transfer}
+
+	ok := &types.Receipt{
+		Status: types.ReceiptStatusSuccessful,
+		Logs: []*types.Log{
+			{Address: common.HexToAddress("0x01"), Topics: []common.Hash{common.HexToHash(nostreth.TopicERC20Transfer)}},
+			{Address: common.HexToAddress(contract), Topics: []common.Hash{common.HexToHash(nostreth.TopicERC20Transfer)}},
+		},
+	}
+
+	tests := []struct {
+		name string
+		rcpt *types.Receipt
+		ok   bool
+	}{
+		{"matching log", ok, true},
+		{"failed tx", &types.Receipt{Status: types.ReceiptStatusFailed, Logs: ok.Logs}, false},
+		{"other contract", &types.Receipt{Status: types.ReceiptStatusSuccessful, Logs: ok.Logs[:1]}, false},
+		{"no logs", &types.Receipt{Status: types.ReceiptStatusSuccessful}, false},
+	}
+
+	for _, tt := range tests {
+		err := VerifyLog(l, tt.rcpt)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: expected ok %v, got %v", tt.name, tt.ok, err)
+		}
+	}
+}
+
+func TestParseLog(t *testing.T) {
+	evt, err := nostreth.CreateTxLogEvent(nostreth.Log{Hash: "0xh", TxHash: "0xtx", ChainID: "100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := parseLog(evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l.TxHash != "0xtx" {
+		t.Errorf("expected tx hash 0xtx, got %s", l.TxHash)
+	}
+
+	_, err = parseLog(&nostr.Event{Content: "{}"})
+	if err == nil {
+		t.Error("expected an event without a tx hash to fail")
+	}
+}
+
+func TestSummary(t *testing.T) {
+	r := &Report{}
+	r.add(CheckTxLog, "a", errors.New("x"))
+	r.add(CheckEvent, "b", errors.New("x"))
+	r.add(CheckTxLog, "c", errors.New("x"))
+
+	if s := summary(r); !strings.HasPrefix(s, "1 event, 2 tx_log") {
+		t.Errorf("unexpected summary %q", s)
+	}
+}
@@ -0,0 +1,86 @@
+package ipfs
+
+import (
+	"container/list"
+	"sync"
+)
+
+type cacheEntry struct {
+	cid         string
+	contentType string
+	body        []byte
+}
+
+// Cache is an in-memory LRU cache of ipfs content bounded by total size in bytes.
+// Content is addressed by cid so entries never need to be invalidated.
+type Cache struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+// NewCache creates a new cache that holds up to maxSize bytes
+func NewCache(maxSize int64) *Cache {
+	return &Cache{
+		maxSize: maxSize,
+		ll:      list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Get returns the cached content and content type of a cid
+func (c *Cache) Get(cid string) ([]byte, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[cid]
+	if !ok {
+		return nil, "", false
+	}
+
+	c.ll.MoveToFront(el)
+
+	e := el.Value.(*cacheEntry)
+	return e.body, e.contentType, true
+}
+
+// Add adds content to the cache, evicting the least recently used content when full
+func (c *Cache) Add(cid, contentType string, body []byte) {
+	size := int64(len(body))
+	if size > c.maxSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[cid]; ok {
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.entries[cid] = c.ll.PushFront(&cacheEntry{cid: cid, contentType: contentType, body: body})
+	c.size += size
+
+	for c.size > c.maxSize {
+		el := c.ll.Back()
+		if el == nil {
+			break
+		}
+
+		e := el.Value.(*cacheEntry)
+		c.ll.Remove(el)
+		delete(c.entries, e.cid)
+		c.size -= int64(len(e.body))
+	}
+}
+
+// Size returns the total size of the cached content
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
+}
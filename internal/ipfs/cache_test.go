@@ -0,0 +1,36 @@
+package ipfs
+
+import "testing"
+
+func TestCache(t *testing.T) {
+	c := NewCache(10)
+
+	c.Add("a", "text/plain", []byte("aaaa"))
+	c.Add("b", "text/plain", []byte("bbbb"))
+
+	// touch a so that b is the least recently used
+	if _, _, ok := c.Get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+
+	c.Add("c", "text/plain", []byte("cccc"))
+
+	if _, _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+
+	body, contentType, ok := c.Get("a")
+	if !ok || string(body) != "aaaa" || contentType != "text/plain" {
+		t.Errorf("expected a to be cached, got %s %s %v", body, contentType, ok)
+	}
+
+	if c.Size() != 8 {
+		t.Errorf("expected size 8, got %d", c.Size())
+	}
+
+	// content larger than the cache is ignored
+	c.Add("d", "text/plain", []byte("ddddddddddd"))
+	if _, _, ok := c.Get("d"); ok {
+		t.Error("expected d not to be cached")
+	}
+}
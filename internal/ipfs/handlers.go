@@ -0,0 +1,109 @@
+package ipfs
+
+import (
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/comunifi/relay/internal/bucket"
+	"github.com/comunifi/relay/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxContentSize = 10 * 1024 * 1024  // largest file that will be proxied
+	cacheSize      = 100 * 1024 * 1024 // total size of the in-memory cache
+)
+
+var cidRegex = regexp.MustCompile(`^[a-zA-Z0-9]{46,100}$`)
+
+type Service struct {
+	b     *bucket.Bucket
+	db    *db.DB
+	cache *Cache
+}
+
+func NewService(b *bucket.Bucket, db *db.DB) *Service {
+	return &Service{
+		b:     b,
+		db:    db,
+		cache: NewCache(cacheSize),
+	}
+}
+
+// Get proxies content pinned by the relay from the ipfs gateway
+func (s *Service) Get(w http.ResponseWriter, r *http.Request) {
+	cid := chi.URLParam(r, "cid")
+
+	if !cidRegex.MatchString(cid) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// content is addressed by cid and never changes, a client that has it doesn't need a fetch
+	if r.Header.Get("If-None-Match") == `"`+cid+`"` {
+		w.Header().Set("ETag", `"`+cid+`"`)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, contentType, ok := s.cache.Get(cid)
+	if !ok {
+		// only content pinned by the relay can be proxied
+		exists, err := s.db.PinDB.PinExists(cid)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		body, contentType, err = s.b.Fetch(r.Context(), cid, maxContentSize)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		s.cache.Add(cid, contentType, body)
+	}
+
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+
+	// uploads are served from the relay origin, anything a browser could run is downloaded instead
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if !inline(contentType) {
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+cid+`"`)
+
+	w.Write(body)
+}
+
+// inline checks if content can be displayed by the browser without running scripts
+func inline(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		return true
+	case mediaType == "application/json", mediaType == "text/plain":
+		return true
+	}
+
+	return false
+}
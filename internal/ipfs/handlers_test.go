@@ -0,0 +1,52 @@
+package ipfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestGet(t *testing.T) {
+	cid := "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+	html := "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"
+
+	s := &Service{cache: NewCache(cacheSize)}
+	s.cache.Add(cid, "image/png", []byte("png"))
+	s.cache.Add(html, "text/html; charset=utf-8", []byte("<script>alert(1)</script>"))
+
+	cr := chi.NewRouter()
+	cr.Get("/ipfs/{cid}", s.Get)
+
+	get := func(cid string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ipfs/"+cid, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		rec := httptest.NewRecorder()
+		cr.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := get(cid, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("expected 200 with nosniff, got %d %v", rec.Code, rec.Header())
+	}
+	if rec.Header().Get("Content-Disposition") != "" {
+		t.Fatal("expected images to be displayed inline")
+	}
+
+	rec = get(html, nil)
+	if rec.Header().Get("Content-Disposition") != "attachment" {
+		t.Fatalf("expected html to be downloaded, got %v", rec.Header())
+	}
+
+	// the cid is checked before the cache or the gateway, the content never changes
+	rec = get("QmNotPinnedNotCachedButTheClientHasItAlready123456", http.Header{"If-None-Match": {`"QmNotPinnedNotCachedButTheClientHasItAlready123456"`}})
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rec.Code)
+	}
+}
@@ -1,6 +1,8 @@
 package legacylogs
 
 import (
+	"encoding/json"
+	"fmt"
 	"math/big"
 	"net/http"
 	"net/url"
@@ -13,6 +15,9 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+// most hashes fetched in a batch
+const maxBatchHashes = 100
+
 type Service struct {
 	chainID *big.Int
 	n       *nostr.Nostr
@@ -49,6 +54,47 @@ func (s *Service) GetSingle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetBatch godoc
+//
+//	@Summary		Fetch transfer logs by hash
+//	@Description	get the transfer logs of several hashes in one request, in the order of the hashes. Hashes without a log are left out.
+//	@Tags			logs
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		object	true	"hashes: the log hashes, at most 100"
+//	@Success		200	{object}	common.Response
+//	@Failure		400
+//	@Failure		500
+//	@Router			/v1/logs/batch [post]
+func (s *Service) GetBatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Hashes []string `json:"hashes"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if len(req.Hashes) == 0 || len(req.Hashes) > maxBatchHashes {
+		http.Error(w, fmt.Sprintf("hashes must have 1 to %d hashes", maxBatchHashes), http.StatusBadRequest)
+		return
+	}
+
+	logs, err := s.n.GetLogs(req.Hashes, s.chainID.String())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.BodyMultiple(w, logs, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
 func (s *Service) GetAll(w http.ResponseWriter, r *http.Request) {
 	// parse contract address from url params
 	contractAddr := chi.URLParam(r, "contract_address")
@@ -78,7 +124,7 @@ func (s *Service) GetAll(w http.ResponseWriter, r *http.Request) {
 	offsetq := r.URL.Query().Get("offset")
 
 	limit, err := strconv.Atoi(limitq)
-	if err != nil {
+	if err != nil || limit < 0 {
 		limit = 20
 	}
 
@@ -87,17 +133,26 @@ func (s *Service) GetAll(w http.ResponseWriter, r *http.Request) {
 		offset = 0
 	}
 
-	// get logs from db
-	logs, err := s.n.GetAllPaginatedLogs(com.ChecksumAddress(contractAddr), topic, maxDate, limit, offset)
+	count, err := nostr.ParseCountMode(r.URL.Query().Get("total"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// get logs from db, one more than requested tells whether there is a next page
+	logs, err := s.n.GetAllPaginatedLogs(com.ChecksumAddress(contractAddr), topic, maxDate, limit+1, offset)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// TODO: remove legacy support
-	total := offset + limit
+	meta, err := s.pagination(&nostr.LogQuery{Contract: com.ChecksumAddress(contractAddr), Topic: topic, Until: maxDate, Count: count}, limit, offset, len(logs))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	err = com.BodyMultiple(w, logs, com.Pagination{Limit: limit, Offset: offset, Total: total})
+	err = com.BodyMultiple(w, logs[:min(len(logs), limit)], meta)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -132,7 +187,7 @@ func (s *Service) GetAllNew(w http.ResponseWriter, r *http.Request) {
 	offsetq := r.URL.Query().Get("offset")
 
 	limit, err := strconv.Atoi(limitq)
-	if err != nil {
+	if err != nil || limit < 0 {
 		limit = 20
 	}
 
@@ -141,17 +196,26 @@ func (s *Service) GetAllNew(w http.ResponseWriter, r *http.Request) {
 		offset = 0
 	}
 
-	// get logs from db
-	logs, err := s.n.GetAllNewLogs(com.ChecksumAddress(contractAddr), topic, fromDate, limit, offset)
+	count, err := nostr.ParseCountMode(r.URL.Query().Get("total"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// get logs from db, one more than requested tells whether there is a next page
+	logs, err := s.n.GetAllNewLogs(com.ChecksumAddress(contractAddr), topic, fromDate, limit+1, offset)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// TODO: remove legacy support
-	total := offset + limit
+	meta, err := s.pagination(&nostr.LogQuery{Contract: com.ChecksumAddress(contractAddr), Topic: topic, Since: fromDate, Count: count}, limit, offset, len(logs))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	err = com.BodyMultiple(w, logs, com.Pagination{Limit: limit, Offset: offset, Total: total})
+	err = com.BodyMultiple(w, logs[:min(len(logs), limit)], meta)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -200,7 +264,7 @@ func (s *Service) Get(w http.ResponseWriter, r *http.Request) {
 	offsetq := r.URL.Query().Get("offset")
 
 	limit, err := strconv.Atoi(limitq)
-	if err != nil {
+	if err != nil || limit < 0 {
 		limit = 20
 	}
 
@@ -213,17 +277,26 @@ func (s *Service) Get(w http.ResponseWriter, r *http.Request) {
 
 	dataFilters2 := relay.ParseJSONBFilters(r.URL.Query(), "data2")
 
-	// get logs from db
-	logs, err := s.n.GetPaginatedLogs(com.ChecksumAddress(contractAddr), topic, maxDate, dataFilters, dataFilters2, limit, offset) // TODO: add topics
+	count, err := nostr.ParseCountMode(r.URL.Query().Get("total"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// get logs from db, one more than requested tells whether there is a next page
+	logs, err := s.n.GetPaginatedLogs(com.ChecksumAddress(contractAddr), topic, maxDate, dataFilters, dataFilters2, limit+1, offset) // TODO: add topics
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// TODO: remove legacy support
-	total := offset + limit
+	meta, err := s.pagination(&nostr.LogQuery{Contract: com.ChecksumAddress(contractAddr), Topic: topic, Until: maxDate, Filters: []map[string]any{dataFilters, dataFilters2}, Count: count}, limit, offset, len(logs))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	err = com.BodyMultiple(w, logs, com.Pagination{Limit: limit, Offset: offset, Total: total})
+	err = com.BodyMultiple(w, logs[:min(len(logs), limit)], meta)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -258,7 +331,7 @@ func (s *Service) GetNew(w http.ResponseWriter, r *http.Request) {
 	offsetq := r.URL.Query().Get("offset")
 
 	limit, err := strconv.Atoi(limitq)
-	if err != nil {
+	if err != nil || limit < 0 {
 		limit = 20
 	}
 
@@ -271,18 +344,46 @@ func (s *Service) GetNew(w http.ResponseWriter, r *http.Request) {
 
 	dataFilters2 := relay.ParseJSONBFilters(r.URL.Query(), "data2")
 
-	// get logs from db
-	logs, err := s.n.GetNewLogs(com.ChecksumAddress(contractAddr), topic, fromDate, dataFilters, dataFilters2, limit, offset)
+	count, err := nostr.ParseCountMode(r.URL.Query().Get("total"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// get logs from db, one more than requested tells whether there is a next page
+	logs, err := s.n.GetNewLogs(com.ChecksumAddress(contractAddr), topic, fromDate, dataFilters, dataFilters2, limit+1, offset)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// TODO: remove legacy support
-	total := offset + limit
+	meta, err := s.pagination(&nostr.LogQuery{Contract: com.ChecksumAddress(contractAddr), Topic: topic, Since: fromDate, Filters: []map[string]any{dataFilters, dataFilters2}, Count: count}, limit, offset, len(logs))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	err = com.BodyMultiple(w, logs, com.Pagination{Limit: limit, Offset: offset, Total: total})
+	err = com.BodyMultiple(w, logs[:min(len(logs), limit)], meta)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+// pagination describes a page of v1 logs, fetched with one more log than the limit. The total
+// is only counted when the client asks for it, v1 clients get offset+limit otherwise.
+func (s *Service) pagination(q *nostr.LogQuery, limit, offset, fetched int) (com.Pagination, error) {
+	p := com.Pagination{Limit: limit, Offset: offset, Total: offset + limit, HasMore: fetched > limit}
+
+	// TODO: remove legacy support
+	if q.Count == "" {
+		return p, nil
+	}
+
+	total, err := s.n.CountLogs(q)
+	if err != nil {
+		return p, err
+	}
+	p.Total = total
+
+	return p, nil
+}
@@ -0,0 +1,25 @@
+package load
+
+import (
+	"net/http"
+
+	com "github.com/comunifi/relay/pkg/common"
+)
+
+type Handlers struct {
+	s *Sampler
+}
+
+func NewHandlers(s *Sampler) *Handlers {
+	return &Handlers{
+		s: s,
+	}
+}
+
+// Get returns the last sampled load signals
+func (h *Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	err := com.Body(w, h.s.Signals(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
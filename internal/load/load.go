@@ -0,0 +1,185 @@
+// Package load samples how busy the relay is, for autoscalers that scale on custom metrics.
+package load
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultInterval is how often the signals are sampled
+const DefaultInterval = 5 * time.Second
+
+// Queue reports how many items are waiting to be processed
+type Queue interface {
+	Depth() int
+}
+
+// Connections reports how many clients are connected
+type Connections interface {
+	Connections() int
+}
+
+// Latency reports the duration that a fraction of the recent operations stayed under
+type Latency interface {
+	Percentile(p float64) time.Duration
+}
+
+// Gauge counts clients that connect and disconnect through hooks
+type Gauge struct {
+	n atomic.Int64
+}
+
+// Add adds delta to the gauge
+func (g *Gauge) Add(delta int64) {
+	g.n.Add(delta)
+}
+
+func (g *Gauge) Connections() int {
+	return int(g.n.Load())
+}
+
+// Signals is the load of the relay at the last sample
+type Signals struct {
+	Queues       map[string]int `json:"queues"`
+	IngestRate   float64        `json:"ingest_rate"`    // events per second since the previous sample
+	Connections  int            `json:"connections"`    // websocket clients
+	DBLatencyP95 float64        `json:"db_latency_p95"` // milliseconds
+	SampledAt    time.Time      `json:"sampled_at"`
+}
+
+type namedQueue struct {
+	name string
+	q    Queue
+}
+
+// Sampler periodically reads the internal counters of the relay into Signals
+type Sampler struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	queues  []namedQueue
+	conns   []Connections
+	latency Latency
+	current Signals
+
+	ingested atomic.Uint64
+	last     uint64
+	lastAt   time.Time
+
+	now func() time.Time
+}
+
+func NewSampler(interval time.Duration) *Sampler {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	return &Sampler{
+		interval: interval,
+		current:  Signals{Queues: map[string]int{}},
+		now:      time.Now,
+	}
+}
+
+// AddQueue adds a queue whose depth is reported under name
+func (s *Sampler) AddQueue(name string, q Queue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queues = append(s.queues, namedQueue{name, q})
+	sort.Slice(s.queues, func(i, j int) bool { return s.queues[i].name < s.queues[j].name })
+}
+
+// AddConnections adds clients to the reported connection count
+func (s *Sampler) AddConnections(c Connections) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conns = append(s.conns, c)
+}
+
+// SetLatency sets where the database latency is read from
+func (s *Sampler) SetLatency(l Latency) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = l
+}
+
+// Ingest counts n events that were stored
+func (s *Sampler) Ingest(n int) {
+	s.ingested.Add(uint64(n))
+}
+
+// Signals returns the last sample
+func (s *Sampler) Signals() Signals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.current
+}
+
+// Start samples the signals every interval until the context is done
+func (s *Sampler) Start(ctx context.Context) error {
+	log.Default().Println("starting load sampler")
+
+	s.sample()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.sample()
+		}
+	}
+}
+
+func (s *Sampler) sample() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	queues := make(map[string]int, len(s.queues))
+	for _, q := range s.queues {
+		queues[q.name] = q.q.Depth()
+	}
+
+	conns := 0
+	for _, c := range s.conns {
+		conns += c.Connections()
+	}
+
+	p95 := 0.0
+	if s.latency != nil {
+		p95 = float64(s.latency.Percentile(0.95)) / float64(time.Millisecond)
+	}
+
+	ingested := s.ingested.Load()
+
+	rate := 0.0
+	if !s.lastAt.IsZero() {
+		if elapsed := now.Sub(s.lastAt).Seconds(); elapsed > 0 {
+			rate = float64(ingested-s.last) / elapsed
+		}
+	}
+
+	s.last = ingested
+	s.lastAt = now
+
+	s.current = Signals{
+		Queues:       queues,
+		IngestRate:   rate,
+		Connections:  conns,
+		DBLatencyP95: p95,
+		SampledAt:    now,
+	}
+}
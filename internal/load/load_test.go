@@ -0,0 +1,68 @@
+package load
+
+import (
+	"testing"
+	"time"
+)
+
+type testQueue int
+
+func (q testQueue) Depth() int {
+	return int(q)
+}
+
+type testLatency time.Duration
+
+func (l testLatency) Percentile(p float64) time.Duration {
+	return time.Duration(l)
+}
+
+func TestSample(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	s := NewSampler(time.Second)
+	s.now = func() time.Time { return now }
+
+	g := &Gauge{}
+	g.Add(3)
+	g.Add(-1)
+
+	s.AddQueue("userop", testQueue(4))
+	s.AddQueue("push", testQueue(2))
+	s.AddConnections(g)
+	s.AddConnections(g)
+	s.SetLatency(testLatency(12500 * time.Microsecond))
+
+	s.Ingest(10)
+	s.sample()
+
+	got := s.Signals()
+	if got.IngestRate != 0 {
+		t.Errorf("expected no rate on the first sample, got %v", got.IngestRate)
+	}
+
+	if got.Queues["userop"] != 4 || got.Queues["push"] != 2 {
+		t.Errorf("unexpected queue depths %v", got.Queues)
+	}
+
+	if got.Connections != 4 {
+		t.Errorf("expected 4 connections, got %d", got.Connections)
+	}
+
+	if got.DBLatencyP95 != 12.5 {
+		t.Errorf("expected a p95 of 12.5ms, got %v", got.DBLatencyP95)
+	}
+
+	now = now.Add(5 * time.Second)
+	s.Ingest(25)
+	s.sample()
+
+	got = s.Signals()
+	if got.IngestRate != 5 {
+		t.Errorf("expected 5 events per second, got %v", got.IngestRate)
+	}
+
+	if !got.SampledAt.Equal(now) {
+		t.Errorf("expected the sample time to be %s, got %s", now, got.SampledAt)
+	}
+}
@@ -0,0 +1,222 @@
+package logs
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/comunifi/relay/internal/nostr"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// how many exported logs are written between flushes of the response
+const exportFlushInterval = 100
+
+// Service serves the v2 log routes from the nostr store with cursor pagination
+type Service struct {
+	chainID *big.Int
+	n       *nostr.Nostr
+}
+
+func NewService(chainID *big.Int, n *nostr.Nostr) *Service {
+	return &Service{
+		chainID: chainID,
+		n:       n,
+	}
+}
+
+// Get godoc
+//
+//	@Summary		Fetch transfer logs
+//	@Description	get the transfer logs of a contract and topic, newest first
+//	@Tags			logs
+//	@Produce		json
+//	@Param			contract_address	path		string	true	"Token Contract Address"
+//	@Param			topic				path		string	true	"Topic of the logs"
+//	@Param			cursor				query		string	false	"Cursor of the page, from the next field of the previous page"
+//	@Param			limit				query		int		false	"Page size, at most 100"
+//	@Param			since				query		string	false	"Only logs created at or after this RFC3339 date"
+//	@Param			total				query		string	false	"How the total is counted: exact (default) or estimate"
+//	@Success		200	{object}	common.Response
+//	@Failure		400
+//	@Failure		500
+//	@Router			/v2/logs/{contract_address}/{topic} [get]
+func (s *Service) Get(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logs, next, err := s.n.GetLogsPage(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	total, err := s.n.CountLogs(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	meta := com.CursorPagination{Limit: q.Limit, Total: total}
+	if next != nil {
+		meta.Next = next.String()
+		meta.HasMore = true
+	}
+
+	err = com.BodyMultiple(w, logs, meta)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Export godoc
+//
+//	@Summary		Export transfer logs
+//	@Description	stream every transfer log of a contract and topic as newline delimited json, newest first. Logs are written as they are read so exports of big communities don't have to fit in memory.
+//	@Tags			logs
+//	@Produce		json
+//	@Param			contract_address	path		string	true	"Token Contract Address"
+//	@Param			topic				path		string	true	"Topic of the logs"
+//	@Param			cursor				query		string	false	"Only logs after this cursor"
+//	@Param			since				query		string	false	"Only logs created at or after this RFC3339 date"
+//	@Success		200
+//	@Failure		400
+//	@Failure		500
+//	@Router			/v2/logs/{contract_address}/{topic}/export [get]
+func (s *Service) Export(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	written := 0
+	err = s.n.StreamLogs(r.Context(), q, func(l *relay.LegacyLog) error {
+		err := enc.Encode(l)
+		if err != nil {
+			return err
+		}
+
+		written++
+		if flusher != nil && written%exportFlushInterval == 0 {
+			flusher.Flush()
+		}
+
+		return nil
+	})
+	if err != nil {
+		if written == 0 && r.Context().Err() == nil {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// the status is already sent, the truncated export is all the client gets
+		log.Printf("Error exporting logs of %s after %d logs: %v", q.Contract, written, err)
+	}
+}
+
+// GetSingle returns the transfer log of a hash
+func (s *Service) GetSingle(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+	if hash == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	log, err := s.n.GetLog(hash, s.chainID.String())
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = com.Body(w, log, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ParseQuery reads a log query from a request. Clients that still page with the v1 parameters
+// can start from maxDate and filter with fromDate, after that they follow the cursor.
+func ParseQuery(r *http.Request) (*nostr.LogQuery, error) {
+	contract := chi.URLParam(r, "contract_address")
+	topic := chi.URLParam(r, "topic")
+	if contract == "" || topic == "" {
+		return nil, errors.New("contract address and topic are required")
+	}
+
+	params := r.URL.Query()
+
+	q := &nostr.LogQuery{
+		Contract: com.ChecksumAddress(contract),
+		Topic:    topic,
+		Filters:  []map[string]any{relay.ParseJSONBFilters(params, "data"), relay.ParseJSONBFilters(params, "data2")},
+		Limit:    DefaultLimit,
+	}
+
+	count, err := nostr.ParseCountMode(params.Get("total"))
+	if err != nil {
+		return nil, err
+	}
+	q.Count = count
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return nil, errors.New("invalid limit")
+		}
+
+		q.Limit = min(limit, MaxLimit)
+	}
+
+	since := params.Get("since")
+	if since == "" {
+		since = params.Get("fromDate")
+	}
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, errors.New("invalid since date")
+		}
+
+		q.Since = t.UTC()
+	}
+
+	switch {
+	case params.Get("cursor") != "":
+		c, err := nostr.ParseLogCursor(params.Get("cursor"))
+		if err != nil {
+			return nil, err
+		}
+
+		q.After = c
+	case params.Get("maxDate") != "":
+		t, err := time.Parse(time.RFC3339, params.Get("maxDate"))
+		if err != nil {
+			return nil, errors.New("invalid maxDate")
+		}
+
+		q.After = nostr.CursorAt(t)
+	}
+
+	return q, nil
+}
@@ -0,0 +1,71 @@
+package logs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/nostr"
+	"github.com/go-chi/chi/v5"
+)
+
+func request(query string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/v2/logs/0xabc/0xtopic?"+query, nil)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("contract_address", "0x5fbdb2315678afecb367f032d93f642f64180aa3")
+	rctx.URLParams.Add("topic", "0xtopic")
+
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery(request(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.Contract != "0x5FbDB2315678afecb367f032d93F642f64180aa3" || q.Limit != DefaultLimit || q.After != nil || !q.Since.IsZero() {
+		t.Fatalf("unexpected default query %+v", q)
+	}
+
+	cursor := &nostr.LogCursor{CreatedAt: 1700000000, ID: "abc"}
+
+	q, err = ParseQuery(request("cursor=" + cursor.String() + "&limit=1000&data.from=0x1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *q.After != *cursor || q.Limit != MaxLimit || q.Filters[0]["from"] != "0x1" {
+		t.Fatalf("unexpected query %+v", q)
+	}
+
+	// v1 parameters are translated
+	q, err = ParseQuery(request("maxDate=2025-01-01T00:00:00Z&fromDate=2024-01-01T00:00:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maxDate := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if *q.After != *nostr.CursorAt(maxDate) || !q.Since.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected legacy query %+v", q)
+	}
+
+	q, err = ParseQuery(request("total=estimate"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.Count != nostr.CountEstimate {
+		t.Fatalf("expected an estimated total, got %q", q.Count)
+	}
+
+	for _, bad := range []string{"limit=0", "limit=x", "cursor=!!", "since=yesterday", "maxDate=never", "total=all"} {
+		_, err := ParseQuery(request(bad))
+		if err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
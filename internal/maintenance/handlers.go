@@ -0,0 +1,51 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	com "github.com/comunifi/relay/pkg/common"
+)
+
+type Handlers struct {
+	m *Mode
+}
+
+func NewHandlers(m *Mode) *Handlers {
+	return &Handlers{
+		m: m,
+	}
+}
+
+type setRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// Get returns whether the relay is in maintenance mode
+func (h *Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	err := com.Body(w, h.m.Status(), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Set turns maintenance mode on or off
+func (h *Handlers) Set(w http.ResponseWriter, r *http.Request) {
+	var req setRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status := h.m.Set(req.Enabled, req.Reason)
+
+	log.Default().Printf("maintenance mode enabled: %v (%s)", status.Enabled, status.Reason)
+
+	err = com.Body(w, status, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
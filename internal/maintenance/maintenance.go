@@ -0,0 +1,141 @@
+package maintenance
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/internal/metrics"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// json-rpc error code returned for writes while the relay is read-only
+	ErrCodeReadOnly = -32097
+
+	DefaultReason = "relay is in read-only maintenance mode, try again later"
+)
+
+// ReadOnlyError is returned for writes while the relay is in maintenance mode
+type ReadOnlyError struct {
+	Reason string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return e.Reason
+}
+
+// ErrorCode makes the error a json-rpc error so clients get a distinct code
+func (e *ReadOnlyError) ErrorCode() int {
+	return ErrCodeReadOnly
+}
+
+type Status struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// Mode puts the relay in read-only mode: queries and downloads keep working while
+// events, uploads and user operations are rejected
+type Mode struct {
+	mu     sync.RWMutex
+	status Status
+
+	now func() time.Time
+}
+
+func New(enabled bool, reason string) *Mode {
+	m := &Mode{now: time.Now}
+	m.Set(enabled, reason)
+
+	return m
+}
+
+// Set turns maintenance mode on or off, the reason is shown to clients
+func (m *Mode) Set(enabled bool, reason string) Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !enabled {
+		m.status = Status{}
+		return m.status
+	}
+
+	if reason == "" {
+		reason = DefaultReason
+	}
+
+	since := m.now().UTC()
+	if m.status.Enabled {
+		since = *m.status.Since
+	}
+
+	m.status = Status{Enabled: true, Reason: reason, Since: &since}
+
+	return m.status
+}
+
+func (m *Mode) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.status
+}
+
+func (m *Mode) Enabled() bool {
+	return m.Status().Enabled
+}
+
+// Check returns a ReadOnlyError while maintenance mode is on
+func (m *Mode) Check() error {
+	s := m.Status()
+	if !s.Enabled {
+		return nil
+	}
+
+	return &ReadOnlyError{Reason: s.Reason}
+}
+
+// RejectEvent rejects every event published to the relay while maintenance mode is on
+func (m *Mode) RejectEvent(ctx context.Context, evt *nostr.Event) (bool, string) {
+	err := m.Check()
+	if err != nil {
+		return true, "blocked: " + err.Error()
+	}
+
+	return false, ""
+}
+
+// RejectUpload rejects blob uploads while maintenance mode is on
+func (m *Mode) RejectUpload(ctx context.Context, auth *nostr.Event, size int, ext string) (bool, string, int) {
+	err := m.Check()
+	if err != nil {
+		return true, err.Error(), http.StatusServiceUnavailable
+	}
+
+	return false, "", 0
+}
+
+// RejectDelete rejects blob deletions while maintenance mode is on
+func (m *Mode) RejectDelete(ctx context.Context, auth *nostr.Event, sha256 string) (bool, string, int) {
+	err := m.Check()
+	if err != nil {
+		return true, err.Error(), http.StatusServiceUnavailable
+	}
+
+	return false, "", 0
+}
+
+// WriteMetrics writes whether maintenance mode is on in the prometheus text format
+func (m *Mode) WriteMetrics(w io.Writer) {
+	v := 0.0
+	if m.Enabled() {
+		v = 1
+	}
+
+	metrics.Help(w, "relay_maintenance", "gauge", "1 while the relay is in read-only maintenance mode")
+	metrics.Sample(w, "relay_maintenance", v)
+}
@@ -0,0 +1,53 @@
+package maintenance
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMode(t *testing.T) {
+	now := time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC)
+
+	m := New(false, "")
+	m.now = func() time.Time { return now }
+
+	if err := m.Check(); err != nil {
+		t.Fatalf("expected writes to be allowed, got %v", err)
+	}
+
+	s := m.Set(true, "")
+	if s.Reason != DefaultReason || !s.Since.Equal(now) {
+		t.Fatalf("unexpected status %+v", s)
+	}
+
+	// changing the reason keeps the time maintenance started
+	now = now.Add(time.Hour)
+	s = m.Set(true, "migrating the database")
+	if !s.Since.Equal(now.Add(-time.Hour)) {
+		t.Errorf("expected since to be kept, got %s", s.Since)
+	}
+
+	reject, msg := m.RejectEvent(context.Background(), &nostr.Event{})
+	if !reject || !strings.HasPrefix(msg, "blocked: migrating the database") {
+		t.Errorf("expected the event to be rejected, got %v %q", reject, msg)
+	}
+
+	reject, _, status := m.RejectUpload(context.Background(), nil, 10, "png")
+	if !reject || status != 503 {
+		t.Errorf("expected the upload to be rejected, got %v %d", reject, status)
+	}
+
+	m.Set(false, "")
+
+	if reject, _ := m.RejectEvent(context.Background(), &nostr.Event{}); reject {
+		t.Error("expected events to be accepted once maintenance is off")
+	}
+
+	if s := m.Status(); s.Enabled || s.Since != nil {
+		t.Errorf("unexpected status %+v", s)
+	}
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// LatencyBuckets are the upper bounds in seconds of latency histograms, from 5ms to a minute
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Histogram counts observations in buckets, it is safe for concurrent use
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // per bucket, the last one counts the observations above every bound
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram creates a histogram with buckets of increasing upper bounds
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe counts a value
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// Count returns the number of observed values
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.count
+}
+
+// Quantile estimates the value below which a fraction q of the observations fall, interpolating
+// within the bucket it falls in. Values above the last bound are reported as the last bound.
+func (h *Histogram) Quantile(q float64) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := q * float64(h.count)
+
+	var seen uint64
+	for i, c := range h.counts {
+		if c == 0 || float64(seen+c) < rank {
+			seen += c
+			continue
+		}
+
+		if i == len(h.bounds) {
+			break
+		}
+
+		lower := 0.0
+		if i > 0 {
+			lower = h.bounds[i-1]
+		}
+
+		return lower + (h.bounds[i]-lower)*(rank-float64(seen))/float64(c)
+	}
+
+	if len(h.bounds) == 0 {
+		return math.Inf(1)
+	}
+
+	return h.bounds[len(h.bounds)-1]
+}
+
+// Write writes the buckets, sum and count of the histogram, the help line is written by the
+// caller so that histograms sharing a name can be written under a single one
+func (h *Histogram) Write(w io.Writer, name string, labels ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		Sample(w, name+"_bucket", float64(cumulative), append(labels, "le", strconv.FormatFloat(bound, 'g', -1, 64))...)
+	}
+
+	Sample(w, name+"_bucket", float64(h.count), append(labels, "le", "+Inf")...)
+	Sample(w, name+"_sum", h.sum, labels...)
+	Sample(w, name+"_count", float64(h.count), labels...)
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestQuantile(t *testing.T) {
+	h := NewHistogram([]float64{1, 2, 4})
+
+	if h.Quantile(0.5) != 0 {
+		t.Fatal("expected 0 without observations")
+	}
+
+	for _, v := range []float64{0.5, 0.5, 1.5, 3, 3, 3, 3, 10} {
+		h.Observe(v)
+	}
+
+	for q, want := range map[float64]float64{
+		0.25: 1,   // the second of 2 observations below 1
+		0.5:  2.5, // the first of 4 observations between 2 and 4
+		0.99: 4,   // above every bound
+	} {
+		if got := h.Quantile(q); math.Abs(got-want) > 1e-9 {
+			t.Errorf("expected p%v to be %v, got %v", q*100, want, got)
+		}
+	}
+}
+
+func TestHistogramWrite(t *testing.T) {
+	h := NewHistogram([]float64{1, 2})
+	h.Observe(0.5)
+	h.Observe(1.5)
+	h.Observe(3)
+
+	var b bytes.Buffer
+	h.Write(&b, "relay_test_seconds", "queue", "push")
+
+	want := strings.Join([]string{
+		`relay_test_seconds_bucket{queue="push",le="1"} 1`,
+		`relay_test_seconds_bucket{queue="push",le="2"} 2`,
+		`relay_test_seconds_bucket{queue="push",le="+Inf"} 3`,
+		`relay_test_seconds_sum{queue="push"} 5`,
+		`relay_test_seconds_count{queue="push"} 3`,
+	}, "\n") + "\n"
+
+	if b.String() != want {
+		t.Fatalf("unexpected output\n%s", b.String())
+	}
+}
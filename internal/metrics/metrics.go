@@ -0,0 +1,45 @@
+// Package metrics exposes internal state in the prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Collector writes its metrics when they are scraped
+type Collector interface {
+	WriteMetrics(w io.Writer)
+}
+
+// Handler serves the metrics of all collectors
+func Handler(cs ...Collector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		for _, c := range cs {
+			c.WriteMetrics(w)
+		}
+	}
+}
+
+// Help writes the help and type lines of a metric
+func Help(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Sample writes a sample, labels are given as name/value pairs
+func Sample(w io.Writer, name string, value float64, labels ...string) {
+	l := ""
+	if len(labels) > 1 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+		}
+		l = "{" + strings.Join(pairs, ",") + "}"
+	}
+
+	fmt.Fprintf(w, "%s%s %s\n", name, l, strconv.FormatFloat(value, 'g', -1, 64))
+}
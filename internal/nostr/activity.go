@@ -0,0 +1,155 @@
+package nostr
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/lib/pq"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ActivityQuery selects the activity of an account, the pubkeys linked to it add its group joins
+// and profile updates
+type ActivityQuery struct {
+	Account string
+	Pubkeys []string
+	Types   []string   // empty for every type
+	After   *LogCursor // nil for the first page
+	Limit   int
+	Count   string // how the total is counted, exactly unless CountEstimate
+}
+
+func (q *ActivityQuery) wants(t string) bool {
+	return len(q.Types) == 0 || slices.Contains(q.Types, t)
+}
+
+// where selects the events of every type the query wants, the lifecycle of user ops is only
+// taken from the states the relay signed so that every op shows up once
+func (q *ActivityQuery) where(pubkey string) (string, []any) {
+	// addresses are tagged as they were logged, both spellings are matched
+	addresses := []string{com.ChecksumAddress(q.Account), strings.ToLower(q.Account)}
+
+	conds := []string{}
+	args := []any{}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.wants(relay.ActivityTransfer) {
+		conds = append(conds, fmt.Sprintf("(kind = %s AND tagvalues && %s)", arg(nostreth.KindTxTransfer), arg(pq.Array(addresses))))
+	}
+
+	if q.wants(relay.ActivityUserOp) {
+		conds = append(conds, fmt.Sprintf("(kind = %s AND pubkey = %s AND tagvalues && %s)", arg(nostreth.EventUserOpKind), arg(pubkey), arg(pq.Array(addresses))))
+	}
+
+	if len(q.Pubkeys) > 0 {
+		if q.wants(relay.ActivityGroupJoin) {
+			conds = append(conds, fmt.Sprintf("(kind = %s AND tagvalues && %s)", arg(nostr.KindSimpleGroupPutUser), arg(pq.Array(q.Pubkeys))))
+		}
+
+		if q.wants(relay.ActivityProfile) {
+			conds = append(conds, fmt.Sprintf("(kind = %s AND pubkey = ANY(%s))", arg(nostr.KindProfileMetadata), arg(pq.Array(q.Pubkeys))))
+		}
+	}
+
+	if len(conds) == 0 {
+		return "false", args
+	}
+
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+// GetActivityPage returns a page of the activity of an account, newest first, and the cursor of
+// the next page or nil when there is no more activity
+func (n *Nostr) GetActivityPage(q *ActivityQuery) ([]*relay.Activity, *LogCursor, error) {
+	cond, args := q.where(n.pubkey)
+
+	if q.After != nil {
+		args = append(args, q.After.CreatedAt, q.After.ID)
+		cond += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	// one more than requested tells whether there is a next page
+	args = append(args, q.Limit+1)
+
+	page, err := n.queryEvents(fmt.Sprintf(`
+		SELECT id, pubkey, created_at, kind, content, sig, tags
+		FROM event
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d
+	`, cond, len(args)), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *LogCursor
+	if len(page) > q.Limit {
+		page = page[:q.Limit]
+
+		last := page[len(page)-1]
+		next = &LogCursor{CreatedAt: int64(last.CreatedAt), ID: last.ID}
+	}
+
+	feed := make([]*relay.Activity, 0, len(page))
+	for _, ev := range page {
+		a, err := n.activity(ev)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		feed = append(feed, a)
+	}
+
+	return feed, next, nil
+}
+
+// CountActivity returns the number of entries in the activity of an account, regardless of the page
+func (n *Nostr) CountActivity(q *ActivityQuery) (int, error) {
+	cond, args := q.where(n.pubkey)
+
+	return n.count(q.Count, cond, args)
+}
+
+// activity turns an event of the feed into its entry
+func (n *Nostr) activity(ev *nostr.Event) (*relay.Activity, error) {
+	a := &relay.Activity{
+		ID:        ev.ID,
+		CreatedAt: time.Unix(int64(ev.CreatedAt), 0).UTC(),
+	}
+
+	var err error
+	switch ev.Kind {
+	case nostreth.KindTxTransfer:
+		a.Type = relay.ActivityTransfer
+		a.Transfer, err = n.legacyLog(ev.ID, ev.Content)
+	case nostreth.EventUserOpKind:
+		a.Type = relay.ActivityUserOp
+		a.UserOp, err = ParseUserOpState(ev)
+	case nostr.KindSimpleGroupPutUser:
+		a.Type = relay.ActivityGroupJoin
+		if h := ev.Tags.Find("h"); h != nil {
+			a.Group = h[1]
+		}
+	case nostr.KindProfileMetadata:
+		a.Type = relay.ActivityProfile
+		if json.Valid([]byte(ev.Content)) {
+			a.Profile = json.RawMessage(ev.Content)
+		}
+	default:
+		err = fmt.Errorf("unexpected kind %d in the activity feed", ev.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
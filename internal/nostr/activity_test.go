@@ -0,0 +1,99 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestGetActivityPage(t *testing.T) {
+	n, ndb := newTestNostr(t)
+	ctx := context.Background()
+
+	account := "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+	other := "0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512"
+
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	save := func(i int, ev *nostr.Event) {
+		ev.CreatedAt = nostr.Timestamp(base.Add(time.Duration(i) * time.Second).Unix())
+		err := ev.Sign(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ndb.SaveEvent(ctx, ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	transfer := func(hash, to string) string {
+		content, err := json.Marshal(&nostreth.TxTransferEvent{
+			LogData: nostreth.Log{Hash: hash, To: to},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	save(0, &nostr.Event{Kind: nostreth.KindTxTransfer, Tags: nostr.Tags{{"p", account}}, Content: transfer("0x1", account)})
+	save(1, &nostr.Event{Kind: nostr.KindSimpleGroupPutUser, Tags: nostr.Tags{{"h", "demo"}, {"p", pk}}})
+	save(2, &nostr.Event{Kind: nostr.KindProfileMetadata, Content: `{"name":"alice"}`})
+	save(3, &nostr.Event{Kind: nostreth.KindTxTransfer, Tags: nostr.Tags{{"p", other}}, Content: transfer("0x2", other)})
+	save(4, &nostr.Event{Kind: nostreth.KindTxTransfer, Tags: nostr.Tags{{"p", account}}, Content: transfer("0x3", account)})
+
+	q := &ActivityQuery{Account: account, Pubkeys: []string{pk}, Limit: 2}
+
+	total, err := n.CountActivity(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4 {
+		t.Fatalf("expected a total of 4, got %d", total)
+	}
+
+	types := []string{}
+	for {
+		feed, next, err := n.GetActivityPage(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, a := range feed {
+			types = append(types, a.Type)
+		}
+
+		if next == nil {
+			break
+		}
+		q.After = next
+	}
+
+	want := []string{relay.ActivityTransfer, relay.ActivityProfile, relay.ActivityGroupJoin, relay.ActivityTransfer}
+	if len(types) != len(want) {
+		t.Fatalf("expected %v, got %v", want, types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, types)
+		}
+	}
+
+	// without linked pubkeys only the transfers are found
+	feed, _, err := n.GetActivityPage(&ActivityQuery{Account: account, Types: []string{relay.ActivityTransfer, relay.ActivityProfile}, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 2 || feed[0].Transfer == nil || feed[0].Transfer.Hash != "0x3" {
+		t.Fatalf("expected the 2 transfers of the account, got %+v", feed)
+	}
+}
@@ -0,0 +1,100 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// how the total of a paginated list is counted
+const (
+	CountExact    = "exact"    // every matching event is counted
+	CountEstimate = "estimate" // the planner estimates the matching events, cheap on large tables
+)
+
+var ErrInvalidCountMode = errors.New("invalid total, expected exact or estimate")
+
+// an exact count that takes longer is estimated instead
+const countTimeout = 2 * time.Second
+
+// ParseCountMode reads how a list wants its total counted, empty when it doesn't ask
+func ParseCountMode(s string) (string, error) {
+	switch s {
+	case "", CountExact, CountEstimate:
+		return s, nil
+	}
+
+	return "", ErrInvalidCountMode
+}
+
+// count returns the number of events matching a condition. Exact counts are the default and
+// fall back to the estimate when they are too slow.
+func (n *Nostr) count(mode, cond string, args []any) (int, error) {
+	if mode != CountEstimate {
+		total, err := n.exactCount(cond, args)
+		if !isCanceled(err) {
+			return total, err
+		}
+	}
+
+	return n.estimateCount(cond, args)
+}
+
+func (n *Nostr) exactCount(cond string, args []any) (int, error) {
+	tx, err := n.ndb.BeginTx(context.Background(), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(fmt.Sprintf(`SET LOCAL statement_timeout = %d`, countTimeout.Milliseconds()))
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	err = tx.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM event WHERE %s`, cond), args...).Scan(&total)
+	if err != nil {
+		return 0, err
+	}
+
+	return total, tx.Commit()
+}
+
+// estimateCount returns the rows the planner expects for a condition, or the estimated size of
+// the event table when the plan can't be read
+func (n *Nostr) estimateCount(cond string, args []any) (int, error) {
+	var plan []byte
+	err := n.ndb.QueryRow(fmt.Sprintf(`EXPLAIN (FORMAT JSON) SELECT 1 FROM event WHERE %s`, cond), args...).Scan(&plan)
+	if err == nil {
+		var p []struct {
+			Plan struct {
+				Rows float64 `json:"Plan Rows"`
+			} `json:"Plan"`
+		}
+
+		err = json.Unmarshal(plan, &p)
+		if err == nil && len(p) > 0 {
+			return int(p[0].Plan.Rows), nil
+		}
+	}
+
+	var total float64
+	err = n.ndb.QueryRow(`SELECT reltuples FROM pg_class WHERE relname = 'event'`).Scan(&total)
+	if err != nil {
+		return 0, err
+	}
+
+	// tables that were never analyzed have no estimate
+	return max(int(total), 0), nil
+}
+
+// isCanceled checks if a query was canceled by the statement timeout
+func isCanceled(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
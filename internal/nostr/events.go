@@ -30,16 +30,22 @@ func (n *Nostr) GetEvent(id string) (*nostr.Event, error) {
 // GetMentionEvent returns the mention event for a given id
 func (n *Nostr) GetMentionEvent(id string) (*nostr.Event, error) {
 	// Collect unique values for tagvalues query
-	tagValues := []string{id, strconv.Itoa(nostreth.KindTxTransfer)}
+	tagValues := []string{strconv.Itoa(nostreth.KindTxTransfer)}
 
-	// Query the event table for mention events that reference the given event ID
+	// Query the event table for mention events that reference the given event ID, or one of the
+	// versions it replaced when its finality was updated
 	row := n.ndb.QueryRow(`
 		SELECT id, pubkey, created_at, kind, content, sig, tags
 		FROM event
 		WHERE kind = 1
 		AND tagvalues @> $1
+		AND tagvalues && (
+			SELECT ARRAY[$2::text] || COALESCE(array_agg(tag->>1), '{}')
+			FROM event AS replaced, jsonb_array_elements(replaced.tags) AS tag
+			WHERE replaced.id = $2 AND tag->>0 = 'replaces'
+		)
 		LIMIT 1
-	`, pq.Array(tagValues))
+	`, pq.Array(tagValues), id)
 
 	var event nostr.Event
 
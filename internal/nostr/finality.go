@@ -0,0 +1,46 @@
+package nostr
+
+import (
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/lib/pq"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// GetUnfinalizedLogs returns the tx log events of the relay created since a date whose finality
+// tag is still pending or safe, oldest first
+func (n *Nostr) GetUnfinalizedLogs(since time.Time, limit int) ([]*nostr.Event, error) {
+	rows, err := n.ndb.Query(`
+		SELECT id, pubkey, created_at, kind, content, sig, tags
+		FROM event
+		WHERE kind = ANY($1)
+		AND pubkey = $2
+		AND created_at >= $3
+		AND EXISTS (
+			SELECT 1
+			FROM jsonb_array_elements(tags) AS tag
+			WHERE tag->>0 = 'finality' AND tag->>1 IN ('pending', 'safe')
+		)
+		ORDER BY created_at ASC
+		LIMIT $4
+	`, pq.Array([]int{nostreth.KindTxTransfer, nostreth.KindTxLog}), n.pubkey, since.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*nostr.Event{}
+	for rows.Next() {
+		var event nostr.Event
+
+		err := rows.Scan(&event.ID, &event.PubKey, &event.CreatedAt, &event.Kind, &event.Content, &event.Sig, &event.Tags)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+
+	return events, rows.Err()
+}
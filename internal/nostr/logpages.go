@@ -0,0 +1,185 @@
+package nostr
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/lib/pq"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// LogCursor points at the last log of a page, logs are sorted newest first and the id breaks
+// ties between logs created in the same second so pages never skip or repeat a log
+type LogCursor struct {
+	CreatedAt int64
+	ID        string
+}
+
+// String encodes the cursor as an opaque token for clients
+func (c *LogCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", c.CreatedAt, c.ID)))
+}
+
+func ParseLogCursor(s string) (*LogCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	ts, id, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &LogCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// CursorAt returns a cursor that starts a page with the logs created at or before t
+func CursorAt(t time.Time) *LogCursor {
+	// every id sorts after "" so logs created at t are included
+	return &LogCursor{CreatedAt: t.Unix() + 1}
+}
+
+// LogQuery selects the transfer logs of a contract and topic
+type LogQuery struct {
+	Contract string
+	Topic    string
+	Filters  []map[string]any // values that must be tagged on the log
+	Since    time.Time        // zero for no lower bound
+	Until    time.Time        // zero for no upper bound
+	After    *LogCursor       // nil for the first page
+	Limit    int
+	Count    string // how the total is counted, exactly unless CountEstimate
+}
+
+func (q *LogQuery) where() (string, []any) {
+	values := map[string]bool{strings.Trim(q.Contract, " "): true}
+	for _, f := range q.Filters {
+		for _, v := range f {
+			if s, ok := v.(string); ok {
+				values[strings.Trim(s, " ")] = true
+			}
+		}
+	}
+
+	tagValues := make([]string, 0, len(values))
+	for v := range values {
+		tagValues = append(tagValues, v)
+	}
+
+	cond := `
+		kind = $1
+		AND tagvalues @> $2
+		AND EXISTS (
+			SELECT 1
+			FROM jsonb_array_elements(tags) AS tag
+			WHERE tag->>0 = 't' AND tag->>1 = $3
+		)
+	`
+	args := []any{nostreth.KindTxTransfer, pq.Array(tagValues), q.Topic}
+
+	if !q.Since.IsZero() {
+		args = append(args, q.Since.Unix())
+		cond += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+
+	if !q.Until.IsZero() {
+		args = append(args, q.Until.Unix())
+		cond += fmt.Sprintf(" AND created_at <= $%d", len(args))
+	}
+
+	return cond, args
+}
+
+// GetLogsPage returns a page of logs, newest first, and the cursor of the next page or nil
+// when there are no more logs
+func (n *Nostr) GetLogsPage(q *LogQuery) ([]*relay.LegacyLog, *LogCursor, error) {
+	return n.logsPage(context.Background(), q)
+}
+
+func (n *Nostr) logsPage(ctx context.Context, q *LogQuery) ([]*relay.LegacyLog, *LogCursor, error) {
+	cond, args := q.where()
+
+	if q.After != nil {
+		args = append(args, q.After.CreatedAt, q.After.ID)
+		cond += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	// one more than requested tells whether there is a next page
+	args = append(args, q.Limit+1)
+
+	rows, err := n.ndb.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, created_at, content
+		FROM event
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d
+	`, cond, len(args)), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	type row struct {
+		id        string
+		createdAt int64
+		content   string
+	}
+
+	page := []row{}
+	for rows.Next() {
+		var r row
+		err := rows.Scan(&r.id, &r.createdAt, &r.content)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		page = append(page, r)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, err
+	}
+	rows.Close()
+
+	var next *LogCursor
+	if len(page) > q.Limit {
+		page = page[:q.Limit]
+
+		last := page[len(page)-1]
+		next = &LogCursor{CreatedAt: last.createdAt, ID: last.id}
+	}
+
+	logs := make([]*relay.LegacyLog, 0, len(page))
+	for _, r := range page {
+		log, err := n.legacyLog(r.id, r.content)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		logs = append(logs, log)
+	}
+
+	return logs, next, nil
+}
+
+// CountLogs returns the number of logs matching a query, regardless of the page
+func (n *Nostr) CountLogs(q *LogQuery) (int, error) {
+	cond, args := q.where()
+
+	return n.count(q.Count, cond, args)
+}
@@ -0,0 +1,197 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestLogCursor(t *testing.T) {
+	c := &LogCursor{CreatedAt: 1700000000, ID: "abc"}
+
+	parsed, err := ParseLogCursor(c.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *parsed != *c {
+		t.Fatalf("expected %+v, got %+v", c, parsed)
+	}
+
+	for _, s := range []string{"", "!!", "bm9jb2xvbg", "eDph"} {
+		_, err := ParseLogCursor(s)
+		if err != ErrInvalidCursor {
+			t.Errorf("%q: expected ErrInvalidCursor, got %v", s, err)
+		}
+	}
+}
+
+func TestGetLogsPage(t *testing.T) {
+	n, ndb := newTestNostr(t)
+	ctx := context.Background()
+
+	contract := "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+	topic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+	// several logs share a second so pages have to break ties on the id
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		content, err := json.Marshal(&nostreth.TxTransferEvent{
+			LogData: nostreth.Log{Hash: fmt.Sprintf("0x%d", i), To: contract, Topic: topic},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ev := &nostr.Event{
+			Kind:      nostreth.KindTxTransfer,
+			CreatedAt: nostr.Timestamp(base.Add(time.Duration(i/2) * time.Second).Unix()),
+			Tags:      nostr.Tags{{"t", topic}, {"x", contract}},
+			Content:   string(content),
+		}
+		err = ev.Sign(nostr.GeneratePrivateKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ndb.SaveEvent(ctx, ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := &LogQuery{Contract: contract, Topic: topic, Limit: 3}
+
+	total, err := n.CountLogs(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 7 {
+		t.Fatalf("expected a total of 7, got %d", total)
+	}
+
+	seen := map[string]bool{}
+	pages := 0
+	for {
+		logs, next, err := n.GetLogsPage(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+
+		for _, l := range logs {
+			if seen[l.Hash] {
+				t.Fatalf("log %s returned twice", l.Hash)
+			}
+			seen[l.Hash] = true
+		}
+
+		if next == nil {
+			break
+		}
+		q.After = next
+	}
+
+	if len(seen) != 7 || pages != 3 {
+		t.Fatalf("expected 7 logs over 3 pages, got %d over %d", len(seen), pages)
+	}
+
+	// logs created at or before the second log's second, as a v1 maxDate would select
+	logs, _, err := n.GetLogsPage(&LogQuery{Contract: contract, Topic: topic, Limit: 10, After: CursorAt(base.Add(time.Second))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 4 {
+		t.Fatalf("expected 4 logs up to the cursor, got %d", len(logs))
+	}
+
+	since := &LogQuery{Contract: contract, Topic: topic, Limit: 10, Since: base.Add(3 * time.Second)}
+	total, err = n.CountLogs(since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Fatalf("expected 1 log since the last second, got %d", total)
+	}
+
+	// v1 logs up to a date are counted the same way
+	total, err = n.CountLogs(&LogQuery{Contract: contract, Topic: topic, Until: base.Add(time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4 {
+		t.Fatalf("expected 4 logs up to the second second, got %d", total)
+	}
+
+	// the planner only estimates, it has to come up with a count without failing
+	_, err = n.CountLogs(&LogQuery{Contract: contract, Topic: topic, Count: CountEstimate})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamLogs(t *testing.T) {
+	n, ndb := newTestNostr(t)
+	ctx := context.Background()
+
+	contract := "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+	topic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+	for i := 0; i < 3; i++ {
+		content, err := json.Marshal(&nostreth.TxTransferEvent{
+			LogData: nostreth.Log{Hash: fmt.Sprintf("0x%d", i), To: contract, Topic: topic},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ev := &nostr.Event{
+			Kind:      nostreth.KindTxTransfer,
+			CreatedAt: nostr.Timestamp(1700000000 + i),
+			Tags:      nostr.Tags{{"t", topic}, {"x", contract}},
+			Content:   string(content),
+		}
+		err = ev.Sign(nostr.GeneratePrivateKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ndb.SaveEvent(ctx, ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := &LogQuery{Contract: contract, Topic: topic}
+
+	hashes := []string{}
+	err := n.StreamLogs(ctx, q, func(l *relay.LegacyLog) error {
+		hashes = append(hashes, l.Hash)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 || hashes[0] != "0x2" || hashes[2] != "0x0" {
+		t.Fatalf("expected the 3 logs newest first, got %v", hashes)
+	}
+
+	// a client that went away stops the scan
+	cctx, cancel := context.WithCancel(ctx)
+	streamed := 0
+	err = n.StreamLogs(cctx, q, func(l *relay.LegacyLog) error {
+		streamed++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || streamed != 1 {
+		t.Fatalf("expected the scan to stop after 1 log, got %d %v", streamed, err)
+	}
+}
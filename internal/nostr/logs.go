@@ -7,14 +7,11 @@ import (
 
 	nostreth "github.com/comunifi/nostr-eth"
 	"github.com/comunifi/relay/pkg/relay"
-	"github.com/jackc/pgx/v5"
 	"github.com/lib/pq"
 )
 
 // GetLog returns the log for a given hash by querying the "d" tag
 func (n *Nostr) GetLog(hash, chainID string) (*relay.LegacyLog, error) {
-	var log relay.LegacyLog
-
 	// Collect unique values for tagvalues query
 	tagValues := []string{chainID, hash}
 
@@ -37,51 +34,110 @@ func (n *Nostr) GetLog(hash, chainID string) (*relay.LegacyLog, error) {
 		return nil, err
 	}
 
-	var nlog nostreth.TxTransferEvent
+	return n.legacyLog(id, content)
+}
+
+// GetLogs returns the logs of several hashes in a single query, in the order of the hashes.
+// Hashes without a log are left out.
+func (n *Nostr) GetLogs(hashes []string, chainID string) ([]*relay.LegacyLog, error) {
+	logs := []*relay.LegacyLog{}
+	if len(hashes) == 0 {
+		return logs, nil
+	}
 
-	err = json.Unmarshal([]byte(content), &nlog)
+	// the chain id is in the layer tag, which isn't part of the tagvalues
+	layer, err := json.Marshal([][]string{{"layer", chainID}})
 	if err != nil {
 		return nil, err
 	}
 
-	// standard properties
-	log.Hash = nlog.LogData.Hash
-	log.TxHash = nlog.LogData.TxHash
-	log.CreatedAt = nlog.LogData.CreatedAt
-	log.UpdatedAt = nlog.LogData.UpdatedAt
-	log.Nonce = nlog.LogData.Nonce
-	log.Sender = nlog.LogData.Sender
-	log.To = nlog.LogData.To
-	log.Value = nlog.LogData.Value
-	log.Data = nlog.LogData.Data
-
-	// hard coded because we stopped doing optimistic indexing
-	log.Status = relay.LegacyLogStatusSuccess
-
-	// v1 requires the message as extra data, attempt to find a message
-	mentionEvent, err := n.GetMentionEvent(id)
+	rows, err := n.ndb.Query(`
+		SELECT id, content
+		FROM event
+		WHERE kind = $1
+		AND tagvalues && $2
+		AND tags @> $3::jsonb
+	`, nostreth.KindTxTransfer, pq.Array(hashes), string(layer))
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return &log, nil
+		return nil, err
+	}
+	defer rows.Close()
+
+	byHash := map[string]*relay.LegacyLog{}
+	for rows.Next() {
+		var id, content string
+
+		err := rows.Scan(&id, &content)
+		if err != nil {
+			return nil, err
+		}
+
+		log, err := n.legacyLog(id, content)
+		if err != nil {
+			return nil, err
 		}
 
+		byHash[log.Hash] = log
+	}
+
+	err = rows.Err()
+	if err != nil {
 		return nil, err
 	}
 
-	extraData := &relay.ExtraData{
-		Description: mentionEvent.Content,
+	for _, hash := range hashes {
+		log, ok := byHash[hash]
+		if !ok {
+			continue
+		}
+
+		// a hash requested twice is returned once
+		delete(byHash, hash)
+
+		logs = append(logs, log)
+	}
+
+	return logs, nil
+}
+
+// LogHashes returns which of the hashes already have a log on a chain, transfers and other logs
+func (n *Nostr) LogHashes(hashes []string, chainID string) (map[string]bool, error) {
+	found := map[string]bool{}
+	if len(hashes) == 0 {
+		return found, nil
 	}
 
-	var extraDataJSON json.RawMessage
+	// the chain id is in the layer tag, which isn't part of the tagvalues
+	layer, err := json.Marshal([][]string{{"layer", chainID}})
+	if err != nil {
+		return nil, err
+	}
 
-	extraDataJSON, err = json.Marshal(extraData)
+	rows, err := n.ndb.Query(`
+		SELECT DISTINCT t->>1
+		FROM event, jsonb_array_elements(tags) t
+		WHERE kind = ANY($1)
+		AND tagvalues && $2
+		AND tags @> $3::jsonb
+		AND t->>0 = 'd'
+	`, pq.Array([]int{nostreth.KindTxTransfer, nostreth.KindTxLog}), pq.Array(hashes), string(layer))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	log.ExtraData = &extraDataJSON
+	for rows.Next() {
+		var hash string
 
-	return &log, nil
+		err := rows.Scan(&hash)
+		if err != nil {
+			return nil, err
+		}
+
+		found[hash] = true
+	}
+
+	return found, rows.Err()
 }
 
 // GetAllPaginatedLogs returns the logs paginated
@@ -126,48 +182,12 @@ func (n *Nostr) GetAllPaginatedLogs(contract string, topic string, maxDate time.
 			return nil, err
 		}
 
-		var nlog nostreth.TxTransferEvent
-		err = json.Unmarshal([]byte(content), &nlog)
+		log, err := n.legacyLog(id, content)
 		if err != nil {
 			return nil, err
 		}
 
-		var log relay.LegacyLog
-
-		// standard properties
-		log.Hash = nlog.LogData.Hash
-		log.TxHash = nlog.LogData.TxHash
-		log.CreatedAt = nlog.LogData.CreatedAt
-		log.UpdatedAt = nlog.LogData.UpdatedAt
-		log.Nonce = nlog.LogData.Nonce
-		log.Sender = nlog.LogData.Sender
-		log.To = nlog.LogData.To
-		log.Value = nlog.LogData.Value
-		log.Data = nlog.LogData.Data
-
-		// hard coded because we stopped doing optimistic indexing
-		log.Status = relay.LegacyLogStatusSuccess
-
-		// v1 requires the message as extra data, attempt to find a message
-		mentionEvent, err := n.GetMentionEvent(id)
-		if err != nil {
-			// If no mention event found, continue without extra data
-			log.ExtraData = nil
-		} else {
-			extraData := &relay.ExtraData{
-				Description: mentionEvent.Content,
-			}
-
-			var extraDataJSON json.RawMessage
-			extraDataJSON, err = json.Marshal(extraData)
-			if err != nil {
-				return nil, err
-			}
-
-			log.ExtraData = &extraDataJSON
-		}
-
-		logs = append(logs, &log)
+		logs = append(logs, log)
 	}
 
 	return logs, nil
@@ -215,48 +235,12 @@ func (n *Nostr) GetAllNewLogs(contract string, topic string, fromDate time.Time,
 			return nil, err
 		}
 
-		var nlog nostreth.TxTransferEvent
-		err = json.Unmarshal([]byte(content), &nlog)
+		log, err := n.legacyLog(id, content)
 		if err != nil {
 			return nil, err
 		}
 
-		var log relay.LegacyLog
-
-		// standard properties
-		log.Hash = nlog.LogData.Hash
-		log.TxHash = nlog.LogData.TxHash
-		log.CreatedAt = nlog.LogData.CreatedAt
-		log.UpdatedAt = nlog.LogData.UpdatedAt
-		log.Nonce = nlog.LogData.Nonce
-		log.Sender = nlog.LogData.Sender
-		log.To = nlog.LogData.To
-		log.Value = nlog.LogData.Value
-		log.Data = nlog.LogData.Data
-
-		// hard coded because we stopped doing optimistic indexing
-		log.Status = relay.LegacyLogStatusSuccess
-
-		// v1 requires the message as extra data, attempt to find a message
-		mentionEvent, err := n.GetMentionEvent(id)
-		if err != nil {
-			// If no mention event found, continue without extra data
-			log.ExtraData = nil
-		} else {
-			extraData := &relay.ExtraData{
-				Description: mentionEvent.Content,
-			}
-
-			var extraDataJSON json.RawMessage
-			extraDataJSON, err = json.Marshal(extraData)
-			if err != nil {
-				return nil, err
-			}
-
-			log.ExtraData = &extraDataJSON
-		}
-
-		logs = append(logs, &log)
+		logs = append(logs, log)
 	}
 
 	return logs, nil
@@ -327,48 +311,12 @@ func (n *Nostr) GetPaginatedLogs(contract string, topic string, maxDate time.Tim
 			return nil, err
 		}
 
-		var nlog nostreth.TxTransferEvent
-		err = json.Unmarshal([]byte(content), &nlog)
+		log, err := n.legacyLog(id, content)
 		if err != nil {
 			return nil, err
 		}
 
-		var log relay.LegacyLog
-
-		// standard properties
-		log.Hash = nlog.LogData.Hash
-		log.TxHash = nlog.LogData.TxHash
-		log.CreatedAt = nlog.LogData.CreatedAt
-		log.UpdatedAt = nlog.LogData.UpdatedAt
-		log.Nonce = nlog.LogData.Nonce
-		log.Sender = nlog.LogData.Sender
-		log.To = nlog.LogData.To
-		log.Value = nlog.LogData.Value
-		log.Data = nlog.LogData.Data
-
-		// hard coded because we stopped doing optimistic indexing
-		log.Status = relay.LegacyLogStatusSuccess
-
-		// v1 requires the message as extra data, attempt to find a message
-		mentionEvent, err := n.GetMentionEvent(id)
-		if err != nil {
-			// If no mention event found, continue without extra data
-			log.ExtraData = nil
-		} else {
-			extraData := &relay.ExtraData{
-				Description: mentionEvent.Content,
-			}
-
-			var extraDataJSON json.RawMessage
-			extraDataJSON, err = json.Marshal(extraData)
-			if err != nil {
-				return nil, err
-			}
-
-			log.ExtraData = &extraDataJSON
-		}
-
-		logs = append(logs, &log)
+		logs = append(logs, log)
 	}
 
 	return logs, nil
@@ -441,49 +389,35 @@ func (n *Nostr) GetNewLogs(contract string, topic string, fromDate time.Time, da
 			return nil, err
 		}
 
-		var nlog nostreth.TxTransferEvent
-		err = json.Unmarshal([]byte(content), &nlog)
+		log, err := n.legacyLog(id, content)
 		if err != nil {
 			return nil, err
 		}
 
-		var log relay.LegacyLog
+		logs = append(logs, log)
+	}
 
-		// standard properties
-		log.Hash = nlog.LogData.Hash
-		log.TxHash = nlog.LogData.TxHash
-		log.CreatedAt = nlog.LogData.CreatedAt
-		log.UpdatedAt = nlog.LogData.UpdatedAt
-		log.Nonce = nlog.LogData.Nonce
-		log.Sender = nlog.LogData.Sender
-		log.To = nlog.LogData.To
-		log.Value = nlog.LogData.Value
-		log.Data = nlog.LogData.Data
+	return logs, nil
+}
 
-		// hard coded because we stopped doing optimistic indexing
-		log.Status = relay.LegacyLogStatusSuccess
+// legacyLog converts the content of a transfer event to a v1 log, v1 requires the message as
+// extra data so it is looked up as well
+func (n *Nostr) legacyLog(id, content string) (*relay.LegacyLog, error) {
+	l, err := relay.ParseLog(content)
+	if err != nil {
+		return nil, err
+	}
 
-		// v1 requires the message as extra data, attempt to find a message
-		mentionEvent, err := n.GetMentionEvent(id)
-		if err != nil {
-			// If no mention event found, continue without extra data
-			log.ExtraData = nil
-		} else {
-			extraData := &relay.ExtraData{
-				Description: mentionEvent.Content,
-			}
-
-			var extraDataJSON json.RawMessage
-			extraDataJSON, err = json.Marshal(extraData)
-			if err != nil {
-				return nil, err
-			}
-
-			log.ExtraData = &extraDataJSON
-		}
+	// logs without a message are returned without extra data
+	mentionEvent, err := n.GetMentionEvent(id)
+	if err != nil {
+		return relay.NewLegacyLog(l, nil), nil
+	}
 
-		logs = append(logs, &log)
+	extraData, err := relay.NewExtraData(mentionEvent.Content)
+	if err != nil {
+		return nil, err
 	}
 
-	return logs, nil
+	return relay.NewLegacyLog(l, extraData), nil
 }
@@ -0,0 +1,52 @@
+package nostr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestGetLogs(t *testing.T) {
+	n, ndb := newTestNostr(t)
+	ctx := context.Background()
+
+	save := func(hash, chainID string) {
+		ev, err := nostreth.CreateTxTransferEvent(nostreth.Log{Hash: hash, ChainID: chainID, TxHash: "0xtx" + hash, Topic: nostreth.TopicERC20Transfer})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ev.Sign(nostr.GeneratePrivateKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ndb.SaveEvent(ctx, ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		save(fmt.Sprintf("0x%d", i), "1")
+	}
+	save("0xother", "2")
+
+	logs, err := n.GetLogs([]string{"0x2", "0xmissing", "0x0", "0x2", "0xother"}, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in the requested order, once each, without the unknown hash and the log of another chain
+	if len(logs) != 2 || logs[0].Hash != "0x2" || logs[1].Hash != "0x0" {
+		t.Fatalf("unexpected logs %+v", logs)
+	}
+
+	logs, err = n.GetLogs(nil, "1")
+	if err != nil || len(logs) != 0 {
+		t.Fatalf("expected no logs, got %v %v", logs, err)
+	}
+}
@@ -3,6 +3,7 @@ package nostr
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/fiatjaf/eventstore"
 	"github.com/fiatjaf/eventstore/postgresql"
@@ -12,74 +13,220 @@ import (
 
 type Nostr struct {
 	secretKey string
+	pubkey    string
 	ndb       *postgresql.PostgresBackend
 	kh        *khatru.Relay
 
 	RelayUrl string
+
+	// OnSaved is called with every event the relay signs and stores, after it was stored
+	OnSaved []func(ctx context.Context, ev *nostr.Event)
+
+	outbox Outbox // nil unless failed saves are retried
+}
+
+// Outbox retries the events that failed to be stored until they are
+type Outbox interface {
+	Add(ev *nostr.Event, replace bool, cause error)
 }
 
 func NewNostr(secretKey string,
 	ndb *postgresql.PostgresBackend,
 	kh *khatru.Relay,
 	relayUrl string) *Nostr {
+	pubkey, _ := nostr.GetPublicKey(secretKey)
+
 	return &Nostr{
 		secretKey: secretKey,
+		pubkey:    pubkey,
 		ndb:       ndb,
 		kh:        kh,
 		RelayUrl:  relayUrl,
 	}
 }
 
+// SetOutbox retries the events the relay signs but fails to store instead of dropping them
+func (n *Nostr) SetOutbox(o Outbox) {
+	n.outbox = o
+}
+
+// PubKey returns the public key the relay signs its events with
+func (n *Nostr) PubKey() string {
+	return n.pubkey
+}
+
+// SignAndSaveEvent signs and stores an event authored by the relay, it is broadcast to the
+// live subscriptions since it doesn't go through khatru's publishing path
 func (n *Nostr) SignAndSaveEvent(ctx context.Context, ev *nostr.Event) (*nostr.Event, error) {
 	err := ev.Sign(n.secretKey)
 	if err != nil {
 		return nil, err
 	}
 
+	err = n.SaveSignedEvent(ctx, ev)
+	if err != nil {
+		return n.retry(ev, false, err)
+	}
+
+	return ev, nil
+}
+
+// SaveSignedEvent stores an event the relay signed with another key, such as a gift wrap signed
+// by a throwaway key, without going through the hooks that hold clients to the relay policies
+func (n *Nostr) SaveSignedEvent(ctx context.Context, ev *nostr.Event) error {
 	for _, store := range n.kh.StoreEvent {
 		err := store(ctx, ev)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	return ev, nil
+	n.saved(ctx, ev)
+	n.kh.BroadcastEvent(ev)
+
+	return nil
 }
 
-func (n *Nostr) SignAndReplaceEvent(ctx context.Context, ev *nostr.Event) (*nostr.Event, error) {
+// SignAndBroadcastEvent signs an event authored by the relay and only broadcasts it to the live
+// subscriptions, for ephemeral events that aren't stored
+func (n *Nostr) SignAndBroadcastEvent(ev *nostr.Event) (*nostr.Event, error) {
 	err := ev.Sign(n.secretKey)
 	if err != nil {
 		return nil, err
 	}
 
-	filter := nostr.Filter{Limit: 1, Kinds: []int{ev.Kind}, Authors: []string{ev.PubKey}}
+	n.kh.BroadcastEvent(ev)
+
+	return ev, nil
+}
+
+// PublishEvent stores an event signed by a client as if it was sent over a websocket, it goes
+// through the relay hooks and is broadcast to the live subscriptions
+func (n *Nostr) PublishEvent(ctx context.Context, ev *nostr.Event) error {
+	skipBroadcast, err := n.kh.AddEvent(ctx, ev)
+	if err != nil {
+		return err
+	}
+
+	if !skipBroadcast {
+		n.kh.BroadcastEvent(ev)
+	}
+
+	return nil
+}
+
+// SignAndReplaceEvent signs and stores an event authored by the relay, removing
+// every previous version that shares its kind and d tag.
+//
+// The relay is the only author of lifecycle updates, and it always emits them in
+// causal order. Two updates can land within the same second though, in which case
+// NIP-01 tie-breaking on the id could keep the stale one. To guarantee the latest
+// call always wins, the created_at is moved past the newest stored version before
+// signing.
+func (n *Nostr) SignAndReplaceEvent(ctx context.Context, ev *nostr.Event) (*nostr.Event, error) {
+	filter := nostr.Filter{Kinds: []int{ev.Kind}, Authors: []string{n.pubkey}}
 	filter.Tags = nostr.TagMap{"d": []string{ev.Tags.GetD()}}
 
 	ch, err := n.ndb.QueryEvents(ctx, filter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query before replacing: %w", err)
+		return n.retry(ev, true, fmt.Errorf("failed to query before replacing: %w", err))
+	}
+
+	previous := []*nostr.Event{}
+	for p := range ch {
+		previous = append(previous, p)
+
+		if p.CreatedAt >= ev.CreatedAt {
+			ev.CreatedAt = p.CreatedAt + 1
+		}
+	}
+
+	err = ev.Sign(n.secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range previous {
+		if err := n.ndb.DeleteEvent(ctx, p); err != nil {
+			return n.retry(ev, true, fmt.Errorf("failed to delete event for replacing: %w", err))
+		}
+	}
+
+	if err := n.ndb.SaveEvent(ctx, ev); err != nil && err != eventstore.ErrDupEvent {
+		return n.retry(ev, true, fmt.Errorf("failed to save: %w", err))
+	}
+
+	n.saved(ctx, ev)
+	n.kh.BroadcastEvent(ev)
+
+	return ev, nil
+}
+
+// ReplaceSignedEvent stores an event that is already signed in place of the older versions that
+// share its kind, author and d tag, and broadcasts it. Nothing is stored when a newer version
+// is, so that a retried version never overrides a later update.
+func (n *Nostr) ReplaceSignedEvent(ctx context.Context, ev *nostr.Event) error {
+	filter := nostr.Filter{Kinds: []int{ev.Kind}, Authors: []string{ev.PubKey}}
+	if d := ev.Tags.GetD(); d != "" {
+		filter.Tags = nostr.TagMap{"d": []string{d}}
+	}
+
+	ch, err := n.ndb.QueryEvents(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to query before replacing: %w", err)
 	}
 
-	shouldStore := true
-	for previous := range ch {
-		if IsOlder(previous, ev) {
-			if err := n.ndb.DeleteEvent(ctx, previous); err != nil {
-				return nil, fmt.Errorf("failed to delete event for replacing: %w", err)
-			}
-		} else {
-			shouldStore = false
+	previous := []*nostr.Event{}
+	for p := range ch {
+		if !IsOlder(p, ev) {
+			return nil
 		}
+
+		previous = append(previous, p)
 	}
 
-	if shouldStore {
-		if err := n.ndb.SaveEvent(ctx, ev); err != nil && err != eventstore.ErrDupEvent {
-			return nil, fmt.Errorf("failed to save: %w", err)
+	for _, p := range previous {
+		if err := n.ndb.DeleteEvent(ctx, p); err != nil {
+			return fmt.Errorf("failed to delete event for replacing: %w", err)
 		}
 	}
 
+	if err := n.ndb.SaveEvent(ctx, ev); err != nil && err != eventstore.ErrDupEvent {
+		return fmt.Errorf("failed to save: %w", err)
+	}
+
+	n.saved(ctx, ev)
+	n.kh.BroadcastEvent(ev)
+
+	return nil
+}
+
+// retry hands an event that failed to be stored to the outbox and returns it as if it was
+// stored, since it will be. Without an outbox the error is returned.
+func (n *Nostr) retry(ev *nostr.Event, replace bool, cause error) (*nostr.Event, error) {
+	if n.outbox == nil {
+		return nil, cause
+	}
+
+	// the event may have failed before it was signed
+	err := ev.Sign(n.secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Default().Printf("retrying event %s from the outbox: %v", ev.ID, cause)
+	n.outbox.Add(ev, replace, cause)
+
 	return ev, nil
 }
 
+// saved runs the OnSaved hooks
+func (n *Nostr) saved(ctx context.Context, ev *nostr.Event) {
+	for _, fn := range n.OnSaved {
+		fn(ctx, ev)
+	}
+}
+
 func IsOlder(previous, next *nostr.Event) bool {
 	return previous.CreatedAt < next.CreatedAt ||
 		(previous.CreatedAt == next.CreatedAt && previous.ID > next.ID)
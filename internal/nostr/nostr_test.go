@@ -0,0 +1,186 @@
+package nostr
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/fiatjaf/eventstore/postgresql"
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+func newTestNostr(t *testing.T) (*Nostr, *postgresql.PostgresBackend) {
+	t.Helper()
+
+	tdb := testdb.New(t)
+
+	ndb := &postgresql.PostgresBackend{DatabaseURL: tdb.URL()}
+	err := ndb.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ndb.Close)
+
+	kh := khatru.NewRelay()
+	kh.StoreEvent = append(kh.StoreEvent, ndb.SaveEvent)
+
+	return NewNostr(nostr.GeneratePrivateKey(), ndb, kh, "ws://localhost:3334"), ndb
+}
+
+func TestSignAndSaveEvent(t *testing.T) {
+	n, ndb := newTestNostr(t)
+	ctx := context.Background()
+
+	ev, err := n.SignAndSaveEvent(ctx, &nostr.Event{
+		Kind:      nostr.KindTextNote,
+		CreatedAt: nostr.Now(),
+		Content:   "hello",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ev.PubKey != n.pubkey {
+		t.Fatalf("expected event to be signed by the relay, got %s", ev.PubKey)
+	}
+
+	ch, err := ndb.QueryEvents(ctx, nostr.Filter{IDs: []string{ev.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for range ch {
+		count++
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 stored event, got %d", count)
+	}
+}
+
+func TestSignAndReplaceEvent(t *testing.T) {
+	n, ndb := newTestNostr(t)
+	ctx := context.Background()
+
+	now := nostr.Now()
+
+	var last *nostr.Event
+	for _, content := range []string{"first", "second", "third"} {
+		// all versions share the same second, the latest call must still win
+		ev, err := n.SignAndReplaceEvent(ctx, &nostr.Event{
+			Kind:      30078,
+			CreatedAt: now,
+			Tags:      nostr.Tags{{"d", "state"}},
+			Content:   content,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		last = ev
+	}
+
+	ch, err := ndb.QueryEvents(ctx, nostr.Filter{Kinds: []int{30078}, Authors: []string{n.pubkey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := []*nostr.Event{}
+	for ev := range ch {
+		stored = append(stored, ev)
+	}
+
+	if len(stored) != 1 {
+		t.Fatalf("expected 1 stored version, got %d", len(stored))
+	}
+
+	if stored[0].ID != last.ID || stored[0].Content != "third" {
+		t.Fatalf("expected latest version to be stored, got %q", stored[0].Content)
+	}
+}
+
+// subscribe opens a REQ subscription on the relay, as a nostr client would
+func subscribe(t *testing.T, n *Nostr, filter nostr.Filter) *nostr.Subscription {
+	t.Helper()
+
+	srv := httptest.NewServer(n.kh)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	r, err := nostr.RelayConnect(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	sub, err := r.Subscribe(ctx, nostr.Filters{filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-sub.EndOfStoredEvents:
+	case <-ctx.Done():
+		t.Fatal("subscription did not reach the end of stored events")
+	}
+
+	return sub
+}
+
+func expectEvent(t *testing.T, sub *nostr.Subscription, id string) {
+	t.Helper()
+
+	select {
+	case ev := <-sub.Events:
+		if ev.ID != id {
+			t.Fatalf("expected event %s, got %s", id, ev.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("event %s was not broadcast to the subscription", id)
+	}
+}
+
+func TestSignAndSaveEventBroadcasts(t *testing.T) {
+	n, _ := newTestNostr(t)
+
+	sub := subscribe(t, n, nostr.Filter{Kinds: []int{nostr.KindTextNote}, Authors: []string{n.pubkey}})
+
+	ev, err := n.SignAndSaveEvent(context.Background(), &nostr.Event{
+		Kind:      nostr.KindTextNote,
+		CreatedAt: nostr.Now(),
+		Content:   "live",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectEvent(t, sub, ev.ID)
+}
+
+func TestSignAndReplaceEventBroadcasts(t *testing.T) {
+	n, _ := newTestNostr(t)
+
+	sub := subscribe(t, n, nostr.Filter{Kinds: []int{30078}, Authors: []string{n.pubkey}})
+
+	ev, err := n.SignAndReplaceEvent(context.Background(), &nostr.Event{
+		Kind:      30078,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"d", "state"}},
+		Content:   "live",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectEvent(t, sub, ev.ID)
+}
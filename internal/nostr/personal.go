@@ -0,0 +1,112 @@
+package nostr
+
+import (
+	"context"
+	"strings"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/lib/pq"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// GetAuthoredEvents returns every event signed by a pubkey, oldest first
+func (n *Nostr) GetAuthoredEvents(pubkey string) ([]*nostr.Event, error) {
+	return n.queryEvents(`
+		SELECT id, pubkey, created_at, kind, content, sig, tags
+		FROM event
+		WHERE pubkey = $1
+		ORDER BY created_at, id
+	`, pubkey)
+}
+
+// GetTaggedEvents returns the events of the given kinds that tag a pubkey, oldest first
+func (n *Nostr) GetTaggedEvents(pubkey string, kinds []int) ([]*nostr.Event, error) {
+	return n.queryEvents(`
+		SELECT id, pubkey, created_at, kind, content, sig, tags
+		FROM event
+		WHERE kind = ANY($1)
+		AND tagvalues @> $2
+		ORDER BY created_at, id
+	`, pq.Array(kinds), pq.Array([]string{pubkey}))
+}
+
+// GetAccountLogs returns the transfers an account sent or received, newest first
+func (n *Nostr) GetAccountLogs(account string) ([]*relay.LegacyLog, error) {
+	// addresses are tagged as they were logged, both spellings are matched
+	addresses := []string{com.ChecksumAddress(account), strings.ToLower(account)}
+
+	rows, err := n.ndb.Query(`
+		SELECT id, content
+		FROM event
+		WHERE kind = $1
+		AND tagvalues && $2
+		ORDER BY created_at DESC, id DESC
+	`, nostreth.KindTxTransfer, pq.Array(addresses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type row struct {
+		id      string
+		content string
+	}
+
+	found := []row{}
+	for rows.Next() {
+		var r row
+		err := rows.Scan(&r.id, &r.content)
+		if err != nil {
+			return nil, err
+		}
+
+		found = append(found, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the mention of each log is looked up once the rows are closed
+	rows.Close()
+
+	logs := []*relay.LegacyLog{}
+	for _, r := range found {
+		l, err := n.legacyLog(r.id, r.content)
+		if err != nil {
+			return nil, err
+		}
+
+		logs = append(logs, l)
+	}
+
+	return logs, nil
+}
+
+// DeleteEvent removes an event from the store, it is not announced to subscriptions
+func (n *Nostr) DeleteEvent(ctx context.Context, ev *nostr.Event) error {
+	return n.ndb.DeleteEvent(ctx, ev)
+}
+
+func (n *Nostr) queryEvents(query string, args ...any) ([]*nostr.Event, error) {
+	rows, err := n.ndb.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*nostr.Event{}
+	for rows.Next() {
+		var event nostr.Event
+		err := rows.Scan(&event.ID, &event.PubKey, &event.CreatedAt, &event.Kind, &event.Content, &event.Sig, &event.Tags)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,42 @@
+package nostr
+
+import (
+	"context"
+
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+// how many logs are read from the store at once when logs are streamed
+const streamBatch = 500
+
+// StreamLogs calls fn with every log matching a query, newest first, starting after the cursor of
+// the query. Logs are read in batches so that memory doesn't grow with the number of logs, the scan
+// stops as soon as the context is done or fn fails.
+func (n *Nostr) StreamLogs(ctx context.Context, q *LogQuery, fn func(*relay.LegacyLog) error) error {
+	page := *q
+	page.Limit = streamBatch
+
+	for {
+		logs, next, err := n.logsPage(ctx, &page)
+		if err != nil {
+			return err
+		}
+
+		for _, l := range logs {
+			err := ctx.Err()
+			if err != nil {
+				return err
+			}
+
+			err = fn(l)
+			if err != nil {
+				return err
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+		page.After = next
+	}
+}
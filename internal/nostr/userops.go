@@ -0,0 +1,151 @@
+package nostr
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/lib/pq"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// UserOpIdentifier returns the deterministic d tag shared by every lifecycle event of a user operation
+func UserOpIdentifier(chainID *big.Int, userOpHash string) string {
+	return fmt.Sprintf("%s:%s", chainID.String(), strings.ToLower(userOpHash))
+}
+
+// SetUserOpIdentifier replaces the d tag of a user operation event with its deterministic identifier
+func SetUserOpIdentifier(chainID *big.Int, userOpHash string, ev *nostr.Event) *nostr.Event {
+	ev.Tags = ev.Tags.FilterOut([]string{"d"})
+	ev.Tags = append(nostr.Tags{{"d", UserOpIdentifier(chainID, userOpHash)}}, ev.Tags...)
+
+	return ev
+}
+
+// SetUserOpReason tags a user operation event with the reason of its current state
+func SetUserOpReason(reason string, ev *nostr.Event) *nostr.Event {
+	ev.Tags = ev.Tags.FilterOut([]string{"reason"})
+	ev.Tags = append(ev.Tags, nostr.Tag{"reason", reason})
+
+	return ev
+}
+
+// GetLatestUserOp returns the latest lifecycle state of a single user operation
+func (n *Nostr) GetLatestUserOp(chainID *big.Int, userOpHash string) (*relay.UserOpState, error) {
+	row := n.ndb.QueryRow(`
+		SELECT id, pubkey, created_at, kind, content, sig, tags
+		FROM event
+		WHERE kind = $1
+		AND tagvalues @> $2
+		ORDER BY created_at DESC, id ASC
+		LIMIT 1
+	`, nostreth.EventUserOpKind, pq.Array([]string{UserOpIdentifier(chainID, userOpHash)}))
+
+	var event nostr.Event
+
+	err := row.Scan(&event.ID, &event.PubKey, &event.CreatedAt, &event.Kind, &event.Content, &event.Sig, &event.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseUserOpState(&event)
+}
+
+// taggedUserOps selects the user operation events of a sender ($1 kind, $2 sender) with their d tag
+const taggedUserOps = `
+	SELECT e.*, (
+		SELECT tag->>1
+		FROM jsonb_array_elements(e.tags) AS tag
+		WHERE tag->>0 = 'd'
+		LIMIT 1
+	) AS d
+	FROM event e
+	WHERE e.kind = $1
+	AND e.tagvalues @> $2
+`
+
+// CountUserOps returns the number of user operations sent by an account
+func (n *Nostr) CountUserOps(sender string) (int, error) {
+	var count int
+
+	err := n.ndb.QueryRow(`
+		SELECT COUNT(*)
+		FROM (
+			SELECT DISTINCT ON (d) d
+			FROM (`+taggedUserOps+`) AS tagged
+		) AS latest
+	`, nostreth.EventUserOpKind, pq.Array([]string{sender})).Scan(&count)
+
+	return count, err
+}
+
+// GetLatestUserOps returns the latest lifecycle state of each user operation sent by an account
+func (n *Nostr) GetLatestUserOps(sender string, limit, offset int) ([]*relay.UserOpState, error) {
+	states := []*relay.UserOpState{}
+
+	// only keep the newest event for every d tag, older lifecycle states are discarded
+	query := `
+		SELECT id, pubkey, created_at, kind, content, sig, tags
+		FROM (
+			SELECT DISTINCT ON (d) id, pubkey, created_at, kind, content, sig, tags
+			FROM (` + taggedUserOps + `) AS tagged
+			ORDER BY d, created_at DESC, id ASC
+		) AS latest
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := n.ndb.Query(query, nostreth.EventUserOpKind, pq.Array([]string{sender}), limit, offset)
+	if err != nil {
+		return states, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event nostr.Event
+
+		err := rows.Scan(&event.ID, &event.PubKey, &event.CreatedAt, &event.Kind, &event.Content, &event.Sig, &event.Tags)
+		if err != nil {
+			return nil, err
+		}
+
+		state, err := ParseUserOpState(&event)
+		if err != nil {
+			return nil, err
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// ParseUserOpState reads the lifecycle state of a user operation from one of its events
+func ParseUserOpState(event *nostr.Event) (*relay.UserOpState, error) {
+	uop, err := nostreth.ParseUserOpEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &relay.UserOpState{
+		ID:         event.Tags.GetD(),
+		EventID:    event.ID,
+		Sender:     uop.UserOpData.Sender.Hex(),
+		Status:     string(uop.EventType),
+		TxHash:     uop.TxHash,
+		RetryCount: uop.RetryCount,
+		UpdatedAt:  event.CreatedAt.Time().UTC(),
+	}
+
+	if reason := event.Tags.Find("reason"); reason != nil {
+		state.Reason = reason[1]
+	}
+
+	if uop.Paymaster != nil {
+		state.Paymaster = uop.Paymaster.Hex()
+	}
+
+	return state, nil
+}
@@ -0,0 +1,130 @@
+package nostr
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	ethevent "github.com/comunifi/nostr-eth/pkg/event"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// testUserOpEvent builds a lifecycle event of the user op of a sender with a nonce, with its
+// deterministic identifier
+func testUserOpEvent(t *testing.T, chainID *big.Int, sender common.Address, nonce int64, eventType ethevent.EventTypeUserOp, createdAt nostr.Timestamp) (*nostr.Event, string) {
+	t.Helper()
+
+	op := nostreth.UserOp{
+		Sender:               sender,
+		Nonce:                big.NewInt(nonce),
+		InitCode:             []byte{},
+		CallData:             []byte{},
+		CallGasLimit:         big.NewInt(100000),
+		VerificationGasLimit: big.NewInt(100000),
+		PreVerificationGas:   big.NewInt(21000),
+		MaxFeePerGas:         big.NewInt(1),
+		MaxPriorityFeePerGas: big.NewInt(1),
+		PaymasterAndData:     []byte{},
+		Signature:            []byte{},
+	}
+
+	paymaster := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	entryPoint := common.HexToAddress("0x0000000000000000000000000000000000000003")
+
+	ev, err := nostreth.CreateUserOpEvent(chainID, &paymaster, &entryPoint, nil, nil, 0, op, eventType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev.CreatedAt = createdAt
+
+	hash := op.GetHash(chainID)
+
+	return SetUserOpIdentifier(chainID, hash, ev), hash
+}
+
+func TestLatestUserOps(t *testing.T) {
+	n, ndb := newTestNostr(t)
+	ctx := context.Background()
+
+	chainID := big.NewInt(100)
+	sender := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	other := common.HexToAddress("0x0000000000000000000000000000000000000004")
+
+	now := nostr.Now()
+
+	// the lifecycle of the first op is replaced within the same second
+	var first string
+	for _, eventType := range []ethevent.EventTypeUserOp{nostreth.EventTypeUserOpSubmitted, nostreth.EventTypeUserOpExecuted, nostreth.EventTypeUserOpConfirmed} {
+		ev, hash := testUserOpEvent(t, chainID, sender, 0, eventType, now)
+		first = hash
+
+		_, err := n.SignAndReplaceEvent(ctx, ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a stale state of the second op is still stored next to its latest one
+	for i, eventType := range []ethevent.EventTypeUserOp{nostreth.EventTypeUserOpSubmitted, nostreth.EventTypeUserOpFailed} {
+		ev, _ := testUserOpEvent(t, chainID, sender, 1, eventType, now+10+nostr.Timestamp(i))
+
+		err := ev.Sign(n.secretKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ndb.SaveEvent(ctx, ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ev, _ := testUserOpEvent(t, chainID, other, 0, nostreth.EventTypeUserOpSubmitted, now)
+	_, err := n.SignAndReplaceEvent(ctx, ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := n.GetLatestUserOp(chainID, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.ID != UserOpIdentifier(chainID, first) || state.Status != string(nostreth.EventTypeUserOpConfirmed) {
+		t.Fatalf("expected the confirmed state of %s, got %+v", first, state)
+	}
+
+	count, err := n.CountUserOps(sender.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Fatalf("expected 2 user ops, got %d", count)
+	}
+
+	states, err := n.GetLatestUserOps(sender.Hex(), 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a single state per d tag, the latest op first
+	if len(states) != 2 {
+		t.Fatalf("expected 2 states, got %d", len(states))
+	}
+
+	if states[0].Status != string(nostreth.EventTypeUserOpFailed) || states[1].Status != string(nostreth.EventTypeUserOpConfirmed) {
+		t.Fatalf("expected the failed then the confirmed op, got %s and %s", states[0].Status, states[1].Status)
+	}
+
+	page, err := n.GetLatestUserOps(sender.Hex(), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page) != 1 || page[0].ID != states[1].ID {
+		t.Fatalf("expected the second op alone, got %+v", page)
+	}
+}
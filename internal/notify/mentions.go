@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// matches npub and nprofile references in content
+var mentionRegex = regexp.MustCompile(`nostr:(npub1[a-z0-9]+|nprofile1[a-z0-9]+)`)
+
+// matches any nostr uri in content
+var nostrUriRegex = regexp.MustCompile(`nostr:[a-zA-Z0-9]+`)
+
+// ParseMentions returns the pubkeys mentioned in an event through p tags and nostr:npub or nostr:nprofile references
+func ParseMentions(ev *nostr.Event) []string {
+	mentions := []string{}
+
+	for _, tag := range ev.Tags {
+		if len(tag) >= 2 && tag[0] == "p" && nostr.IsValidPublicKey(tag[1]) && !slices.Contains(mentions, tag[1]) {
+			mentions = append(mentions, tag[1])
+		}
+	}
+
+	for _, match := range mentionRegex.FindAllStringSubmatch(ev.Content, -1) {
+		prefix, value, err := nip19.Decode(match[1])
+		if err != nil {
+			continue
+		}
+
+		var pubkey string
+		switch prefix {
+		case "npub":
+			pubkey, _ = value.(string)
+		case "nprofile":
+			if pp, ok := value.(nostr.ProfilePointer); ok {
+				pubkey = pp.PublicKey
+			}
+		}
+
+		if pubkey != "" && !slices.Contains(mentions, pubkey) {
+			mentions = append(mentions, pubkey)
+		}
+	}
+
+	return mentions
+}
+
+// preview returns a short readable version of the content of an event
+func preview(content string) string {
+	content = nostrUriRegex.ReplaceAllString(content, "")
+
+	r := []rune(content)
+	if len(r) > previewLength {
+		return string(r[:previewLength]) + "…"
+	}
+
+	return string(r)
+}
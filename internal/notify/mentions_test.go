@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func generatePubkey(t *testing.T) string {
+	pk, err := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pk
+}
+
+func TestParseMentions(t *testing.T) {
+	pk1 := generatePubkey(t)
+	pk2 := generatePubkey(t)
+	pk3 := generatePubkey(t)
+
+	npub, err := nip19.EncodePublicKey(pk2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nprofile, err := nip19.EncodeProfile(pk3, []string{"wss://relay.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := &nostr.Event{
+		Kind:    9,
+		Content: "hello nostr:" + npub + " and nostr:" + nprofile + " and again nostr:" + npub,
+		Tags: nostr.Tags{
+			{"h", "group"},
+			{"p", pk1},
+			{"p", pk2},
+			{"p", "invalid"},
+		},
+	}
+
+	mentions := ParseMentions(ev)
+
+	expected := []string{pk1, pk2, pk3}
+	if len(mentions) != len(expected) {
+		t.Fatalf("expected %d mentions, got %d: %v", len(expected), len(mentions), mentions)
+	}
+
+	for i, pk := range expected {
+		if mentions[i] != pk {
+			t.Errorf("expected mention %d to be %s, got %s", i, pk, mentions[i])
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	if p := preview("hi nostr:npub1abc"); p != "hi " {
+		t.Errorf("expected nostr uris to be removed, got %q", p)
+	}
+
+	long := ""
+	for range previewLength + 10 {
+		long += "a"
+	}
+
+	if p := preview(long); len([]rune(p)) != previewLength+1 {
+		t.Errorf("expected preview to be truncated, got %d characters", len([]rune(p)))
+	}
+}
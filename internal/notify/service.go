@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/internal/queue"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// max number of characters of a message to show in a notification
+const previewLength = 100
+
+// group content kinds that trigger notifications
+var contentKinds = []int{groups.KindGroupChat, groups.KindGroupReply, groups.KindGroupThreaded, groups.KindGroupChatReply}
+
+// Service sends push notifications for stored group messages
+type Service struct {
+	groups *groups.GroupsService
+	db     *db.DB
+	digest *queue.DigestService
+}
+
+// NewService creates a new notify service
+func NewService(g *groups.GroupsService, db *db.DB, digest *queue.DigestService) *Service {
+	return &Service{
+		groups: g,
+		db:     db,
+		digest: digest,
+	}
+}
+
+// AddHooks registers the notification hooks on the relay
+func (s *Service) AddHooks(relay *khatru.Relay) {
+	relay.OnEventSaved = append(relay.OnEventSaved, s.OnEventSaved)
+}
+
+// OnEventSaved notifies mentioned members immediately and the other members through digests
+func (s *Service) OnEventSaved(ctx context.Context, ev *nostr.Event) {
+	if !slices.Contains(contentKinds, ev.Kind) {
+		return
+	}
+
+	tag := ev.Tags.GetFirst([]string{"h", ""})
+	if tag == nil || len(*tag) < 2 {
+		return
+	}
+	groupID := (*tag)[1]
+
+	groupName := groupID
+	meta, err := s.groups.GetGroupMetadata(ctx, groupID)
+	if err == nil && meta.Name != "" {
+		groupName = meta.Name
+	}
+
+	body := preview(ev.Content)
+
+	// mentions are only sent to members of the group
+	mentions := ParseMentions(ev)
+	mentioned := []string{}
+	for _, pubkey := range mentions {
+		if pubkey == ev.PubKey {
+			continue
+		}
+
+		isMember, err := s.groups.IsMember(ctx, pubkey, groupID)
+		if err != nil {
+			log.Printf("Error checking member status: %v", err)
+			continue
+		}
+		if !isMember {
+			continue
+		}
+
+		mentioned = append(mentioned, pubkey)
+	}
+
+	members, err := s.groups.GetMembers(ctx, groupID)
+	if err != nil {
+		log.Printf("Error fetching group members: %v", err)
+	}
+
+	others := slices.DeleteFunc(members, func(pubkey string) bool {
+		return pubkey == ev.PubKey || slices.Contains(mentions, pubkey)
+	})
+
+	// preferences and tokens of every recipient are loaded at once
+	recipients := slices.Concat(mentioned, others)
+	if len(recipients) == 0 {
+		return
+	}
+
+	prefs, err := s.db.PushPreferenceDB.GetPreferences(recipients)
+	if err != nil {
+		log.Printf("Error fetching push preferences: %v", err)
+		return
+	}
+
+	tokens, err := s.db.NostrPushTokenDB.GetAccountsTokens(recipients)
+	if err != nil {
+		log.Printf("Error fetching push tokens: %v", err)
+		return
+	}
+
+	for _, pubkey := range mentioned {
+		s.notify(prefs[pubkey], tokens[pubkey], &relay.PushNotification{
+			Type:      relay.PushNotificationTypeMention,
+			GroupID:   groupID,
+			GroupName: groupName,
+			Title:     fmt.Sprintf(relay.PushMessageMentionTitle, groupName),
+			Body:      body, // rendered in the locale of the member
+			Data:      []byte(ev.String()),
+		})
+	}
+
+	for _, pubkey := range others {
+		s.notify(prefs[pubkey], tokens[pubkey], &relay.PushNotification{
+			Type:      relay.PushNotificationTypeMessage,
+			GroupID:   groupID,
+			GroupName: groupName,
+			Title:     groupName,
+			Body:      body,
+		})
+	}
+}
+
+// notify sends a notification to a pubkey if their preferences allow it and they have tokens
+func (s *Service) notify(pref *relay.PushPreference, tokens []*relay.PushToken, n *relay.PushNotification) {
+	if !pref.Allows(n.Type) || len(tokens) == 0 {
+		return
+	}
+
+	n.Locale = pref.Locale
+	if n.Type == relay.PushNotificationTypeMention {
+		n.Body = relay.LocalizePush(n.Locale, relay.PushMessageMention, map[string]string{"message": n.Body})
+	}
+
+	n.Account = pref.Pubkey
+	n.Tokens = tokens
+
+	s.digest.Add(n)
+}
@@ -0,0 +1,88 @@
+package onboarding
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// how far a signed onboarding request can be from now
+const requestMaxAge = 5 * time.Minute
+
+var (
+	ErrInvalidRequestSignature = errors.New("invalid request signature")
+	ErrExpiredRequest          = errors.New("request event is expired")
+)
+
+// Onboard sets up the account, group membership and profile of the pubkey that signed the request
+// and returns the state of every step
+func (s *Service) Onboard(w http.ResponseWriter, r *http.Request) {
+	ev, err := s.parseRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var req relay.OnboardingRequest
+	err = json.Unmarshal([]byte(ev.Content), &req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	o, err := s.onboard(r.Context(), ev.PubKey, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidRequest):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidLinkSignature):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errors.Is(err, ErrFactoryNotRegistered):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrRejected):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, ErrAccountUnavailable):
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = com.Body(w, o, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// parseRequest parses and verifies the request event signed by the pubkey being onboarded
+func (s *Service) parseRequest(r *http.Request) (*nostr.Event, error) {
+	var ev nostr.Event
+	err := json.NewDecoder(r.Body).Decode(&ev)
+	if err != nil {
+		return nil, ErrInvalidRequestSignature
+	}
+	defer r.Body.Close()
+
+	ok, err := ev.CheckSignature()
+	if err != nil || !ok {
+		return nil, ErrInvalidRequestSignature
+	}
+
+	err = com.CheckRequestEvent(r, &ev)
+	if err != nil {
+		return nil, ErrInvalidRequestSignature
+	}
+
+	age := s.now().Sub(ev.CreatedAt.Time())
+	if age > requestMaxAge || age < -requestMaxAge {
+		return nil, ErrExpiredRequest
+	}
+
+	return &ev, nil
+}
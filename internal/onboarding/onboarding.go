@@ -0,0 +1,236 @@
+// Package onboarding sets up a new user in a single request instead of the calls a client would
+// otherwise make one after the other.
+//
+// The request is a NIP-98 event signed by the nostr key of the user, its content is a
+// relay.OnboardingRequest. In order, the relay:
+//
+//   - returns the counterfactual smart account of the owner, with a sponsored deployment user op
+//     for the owner to sign and send when the account does not exist yet
+//   - links the pubkey to the account, the owner signs LinkMessage(pubkey) with personal_sign
+//   - publishes the join request, which adds the pubkey to the group right away when it carries a
+//     valid invite code
+//   - publishes the profile (kind 0)
+//
+// Every step can be repeated, a failed onboarding is retried by sending the same request again.
+package onboarding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/groups"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	ErrInvalidRequest       = errors.New("invalid onboarding request")
+	ErrInvalidLinkSignature = errors.New("link signature is not valid for the owner")
+	ErrFactoryNotRegistered = errors.New("factory is not registered")
+	ErrRejected             = errors.New("rejected by the relay")
+	ErrAccountUnavailable   = errors.New("unable to prepare the account")
+)
+
+// Accounts prepares the deployment of the account of an owner
+type Accounts interface {
+	Prepare(f *relay.AccountFactory, owner common.Address, salt *big.Int) (*relay.AccountDeployment, error)
+}
+
+// Groups decides who is a member of a group
+type Groups interface {
+	IsMember(ctx context.Context, pubkey, groupID string) (bool, error)
+}
+
+// Publisher stores events signed by clients through the relay hooks
+type Publisher interface {
+	PublishEvent(ctx context.Context, ev *nostr.Event) error
+}
+
+type Service struct {
+	accounts Accounts
+	db       *db.DB
+	groups   Groups
+	n        Publisher
+
+	now func() time.Time
+}
+
+func NewService(acc Accounts, d *db.DB, g Groups, n Publisher) *Service {
+	return &Service{
+		accounts: acc,
+		db:       d,
+		groups:   g,
+		n:        n,
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// LinkMessage is the message the owner of an account signs to link a pubkey to it
+func LinkMessage(pubkey string) []byte {
+	return []byte("link:" + pubkey)
+}
+
+// onboard runs every step of the onboarding of a pubkey, steps that were already done are skipped
+func (s *Service) onboard(ctx context.Context, pubkey string, req *relay.OnboardingRequest) (*relay.Onboarding, error) {
+	owner, signature, err := checkRequest(pubkey, req)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.db.FactoryDB.GetFactory(com.ChecksumAddress(req.Factory))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrFactoryNotRegistered
+		}
+
+		return nil, err
+	}
+
+	deployment, err := s.accounts.Prepare(f, owner, big.NewInt(req.Salt))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAccountUnavailable, err)
+	}
+
+	link := &relay.AccountLink{
+		Pubkey:    pubkey,
+		Account:   deployment.Address,
+		Owner:     owner.Hex(),
+		Signature: hexutil.Encode(signature),
+		CreatedAt: s.now(),
+	}
+
+	err = s.db.AccountLinkDB.SetLink(link)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &relay.Onboarding{
+		Pubkey:  pubkey,
+		Account: deployment,
+		Link:    link,
+	}
+
+	if req.Join != nil {
+		o.Group = req.Join.Tags.Find("h")[1]
+
+		o.Membership, err = s.join(ctx, o.Group, req.Join)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Profile != nil {
+		err = s.publish(ctx, req.Profile)
+		if err != nil {
+			return nil, err
+		}
+
+		o.Profile = req.Profile.ID
+	}
+
+	return o, nil
+}
+
+// join publishes the join request of a pubkey that isn't a member yet
+func (s *Service) join(ctx context.Context, groupID string, ev *nostr.Event) (string, error) {
+	isMember, err := s.groups.IsMember(ctx, ev.PubKey, groupID)
+	if err != nil {
+		return "", err
+	}
+
+	if !isMember {
+		err = s.publish(ctx, ev)
+		if err != nil {
+			return "", err
+		}
+
+		// a valid invite code made the pubkey a member when the request was saved
+		isMember, err = s.groups.IsMember(ctx, ev.PubKey, groupID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if isMember {
+		return relay.MembershipMember, nil
+	}
+
+	return relay.MembershipPending, nil
+}
+
+// publish stores an event through the relay hooks, an event they reject is an ErrRejected
+func (s *Service) publish(ctx context.Context, ev *nostr.Event) error {
+	err := s.n.PublishEvent(ctx, ev)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrRejected, err)
+	}
+
+	return nil
+}
+
+// checkRequest validates a request and the link signature of its owner
+func checkRequest(pubkey string, req *relay.OnboardingRequest) (common.Address, []byte, error) {
+	if !common.IsHexAddress(req.Owner) || !common.IsHexAddress(req.Factory) || req.Salt < 0 {
+		return common.Address{}, nil, ErrInvalidRequest
+	}
+
+	if req.Join != nil {
+		if req.Join.Kind != groups.KindJoinRequest || req.Join.Tags.Find("h") == nil {
+			return common.Address{}, nil, fmt.Errorf("%w: join must be a join request with a group", ErrInvalidRequest)
+		}
+
+		err := checkEvent(pubkey, req.Join)
+		if err != nil {
+			return common.Address{}, nil, err
+		}
+	}
+
+	if req.Profile != nil {
+		if req.Profile.Kind != nostr.KindProfileMetadata {
+			return common.Address{}, nil, fmt.Errorf("%w: profile must be a kind %d event", ErrInvalidRequest, nostr.KindProfileMetadata)
+		}
+
+		err := checkEvent(pubkey, req.Profile)
+		if err != nil {
+			return common.Address{}, nil, err
+		}
+	}
+
+	owner := common.HexToAddress(req.Owner)
+
+	signature, err := hexutil.Decode(req.Signature)
+	if err != nil {
+		return common.Address{}, nil, ErrInvalidLinkSignature
+	}
+
+	// the account may not be deployed yet, only the owner can sign for it
+	signer, err := com.RecoverPersonalSign(accounts.TextHash(LinkMessage(pubkey)), signature)
+	if err != nil || signer != owner {
+		return common.Address{}, nil, ErrInvalidLinkSignature
+	}
+
+	return owner, signature, nil
+}
+
+// checkEvent checks that an event was signed by the pubkey being onboarded
+func checkEvent(pubkey string, ev *nostr.Event) error {
+	if ev.PubKey != pubkey {
+		return fmt.Errorf("%w: events must be signed by the pubkey being onboarded", ErrInvalidRequest)
+	}
+
+	ok, err := ev.CheckSignature()
+	if err != nil || !ok {
+		return fmt.Errorf("%w: invalid event signature", ErrInvalidRequest)
+	}
+
+	return nil
+}
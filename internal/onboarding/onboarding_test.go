@@ -0,0 +1,201 @@
+package onboarding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// fakePublisher admits the authors of join requests with the code "welcome"
+type fakePublisher struct {
+	groups    *testutil.FakeGroups
+	published []*nostr.Event
+	err       error
+}
+
+func (p *fakePublisher) PublishEvent(ctx context.Context, ev *nostr.Event) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	p.published = append(p.published, ev)
+
+	if code := ev.Tags.Find("code"); code != nil && code[1] == "welcome" {
+		groupID := ev.Tags.Find("h")[1]
+		p.groups.Members[groupID] = append(p.groups.Members[groupID], ev.PubKey)
+	}
+
+	return nil
+}
+
+func signedEvent(t *testing.T, sk string, ev *nostr.Event) *nostr.Event {
+	t.Helper()
+
+	ev.CreatedAt = nostr.Now()
+	err := ev.Sign(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ev
+}
+
+func TestCheckRequest(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+
+	owner, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := func(pubkey string) string {
+		sig, err := crypto.Sign(accounts.TextHash(LinkMessage(pubkey)), owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig[crypto.RecoveryIDOffset] += 27
+
+		return hexutil.Encode(sig)
+	}
+
+	request := func() *relay.OnboardingRequest {
+		return &relay.OnboardingRequest{
+			Owner:     crypto.PubkeyToAddress(owner.PublicKey).Hex(),
+			Factory:   "0x5FbDB2315678afecb367f032d93F642f64180aa3",
+			Signature: link(pk),
+			Join:      signedEvent(t, sk, &nostr.Event{Kind: groups.KindJoinRequest, Tags: nostr.Tags{{"h", "test"}}}),
+			Profile:   signedEvent(t, sk, &nostr.Event{Kind: nostr.KindProfileMetadata, Content: `{"name":"alice"}`}),
+		}
+	}
+
+	addr, _, err := checkRequest(pk, request())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != crypto.PubkeyToAddress(owner.PublicKey) {
+		t.Fatalf("unexpected owner %s", addr)
+	}
+
+	other := nostr.GeneratePrivateKey()
+
+	for name, tc := range map[string]struct {
+		edit func(req *relay.OnboardingRequest)
+		err  error
+	}{
+		"invalid owner": {func(req *relay.OnboardingRequest) { req.Owner = "0x1234" }, ErrInvalidRequest},
+		"negative salt": {func(req *relay.OnboardingRequest) { req.Salt = -1 }, ErrInvalidRequest},
+		"join of another pubkey": {func(req *relay.OnboardingRequest) {
+			req.Join = signedEvent(t, other, &nostr.Event{Kind: groups.KindJoinRequest, Tags: nostr.Tags{{"h", "test"}}})
+		}, ErrInvalidRequest},
+		"join without group": {func(req *relay.OnboardingRequest) {
+			req.Join = signedEvent(t, sk, &nostr.Event{Kind: groups.KindJoinRequest})
+		}, ErrInvalidRequest},
+		"profile of wrong kind":  {func(req *relay.OnboardingRequest) { req.Profile = signedEvent(t, sk, &nostr.Event{Kind: 1}) }, ErrInvalidRequest},
+		"tampered profile":       {func(req *relay.OnboardingRequest) { req.Profile.Content = `{"name":"mallory"}` }, ErrInvalidRequest},
+		"link of another pubkey": {func(req *relay.OnboardingRequest) { req.Signature = link("other") }, ErrInvalidLinkSignature},
+		"link of another owner":  {func(req *relay.OnboardingRequest) { req.Owner = "0x5FbDB2315678afecb367f032d93F642f64180aa3" }, ErrInvalidLinkSignature},
+	} {
+		req := request()
+		tc.edit(req)
+
+		_, _, err := checkRequest(pk, req)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+
+	g := &testutil.FakeGroups{Members: map[string][]string{}}
+	p := &fakePublisher{groups: g}
+	s := NewService(nil, nil, g, p)
+
+	membership, err := s.join(context.Background(), "test", signedEvent(t, sk, &nostr.Event{Kind: groups.KindJoinRequest, Tags: nostr.Tags{{"h", "test"}}}))
+	if err != nil || membership != relay.MembershipPending {
+		t.Fatalf("expected a pending request, got %s %v", membership, err)
+	}
+
+	membership, err = s.join(context.Background(), "test", signedEvent(t, sk, &nostr.Event{Kind: groups.KindJoinRequest, Tags: nostr.Tags{{"h", "test"}, {"code", "welcome"}}}))
+	if err != nil || membership != relay.MembershipMember {
+		t.Fatalf("expected the invite to admit the pubkey, got %s %v", membership, err)
+	}
+
+	// members don't request again
+	membership, err = s.join(context.Background(), "test", signedEvent(t, sk, &nostr.Event{Kind: groups.KindJoinRequest, Tags: nostr.Tags{{"h", "test"}}}))
+	if err != nil || membership != relay.MembershipMember || len(p.published) != 2 {
+		t.Fatalf("expected the member to be left as is, got %s %v after %d requests", membership, err, len(p.published))
+	}
+
+	p.err = errors.New("blocked: invalid invite code")
+
+	_, err = s.join(context.Background(), "test", signedEvent(t, nostr.GeneratePrivateKey(), &nostr.Event{Kind: groups.KindJoinRequest, Tags: nostr.Tags{{"h", "test"}, {"code", "guess"}}}))
+	if !errors.Is(err, ErrRejected) {
+		t.Fatalf("expected ErrRejected, got %v", err)
+	}
+}
+
+func TestOnboardRequestEvent(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	s := NewService(nil, nil, nil, nil)
+
+	for name, tc := range map[string]struct {
+		ev     *nostr.Event
+		status int
+	}{
+		"other endpoint": {
+			ev:     &nostr.Event{Kind: nostr.KindHTTPAuth, Tags: nostr.Tags{{"u", "https://relay.example/v1/accounts/deploy"}, {"method", "POST"}}},
+			status: http.StatusUnauthorized,
+		},
+		"expired": {
+			ev:     &nostr.Event{Kind: nostr.KindHTTPAuth, CreatedAt: nostr.Timestamp(time.Now().Add(-time.Hour).Unix()), Tags: nostr.Tags{{"u", "https://relay.example/v1/onboarding"}, {"method", "POST"}}},
+			status: http.StatusUnauthorized,
+		},
+		"invalid content": {
+			ev:     &nostr.Event{Kind: nostr.KindHTTPAuth, Content: "{", Tags: nostr.Tags{{"u", "https://relay.example/v1/onboarding"}, {"method", "POST"}}},
+			status: http.StatusBadRequest,
+		},
+		"invalid owner": {
+			ev:     &nostr.Event{Kind: nostr.KindHTTPAuth, Content: `{"owner":"0x1234"}`, Tags: nostr.Tags{{"u", "https://relay.example/v1/onboarding"}, {"method", "POST"}}},
+			status: http.StatusBadRequest,
+		},
+	} {
+		if tc.ev.CreatedAt == 0 {
+			tc.ev.CreatedAt = nostr.Now()
+		}
+
+		err := tc.ev.Sign(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(tc.ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodPost, "https://relay.example/v1/onboarding", bytes.NewReader(b))
+		w := httptest.NewRecorder()
+
+		s.Onboard(w, r)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", name, tc.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package oracle
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const aggregatorV3ABI = `[
+	{"inputs":[],"name":"decimals","outputs":[{"internalType":"uint8","name":"","type":"uint8"}],"stateMutability":"view","type":"function"},
+	{"inputs":[],"name":"latestRoundData","outputs":[{"internalType":"uint80","name":"roundId","type":"uint80"},{"internalType":"int256","name":"answer","type":"int256"},{"internalType":"uint256","name":"startedAt","type":"uint256"},{"internalType":"uint256","name":"updatedAt","type":"uint256"},{"internalType":"uint80","name":"answeredInRound","type":"uint80"}],"stateMutability":"view","type":"function"}
+]`
+
+var ErrStalePrice = errors.New("chainlink price is stale")
+
+// Chainlink reads the latest answer of an on-chain price feed.
+// The currency is determined by the feed, e.g. XDAI / EUR.
+type Chainlink struct {
+	evm    relay.EVMRequester
+	feed   common.Address
+	maxAge time.Duration
+	abi    abi.ABI
+}
+
+func NewChainlink(evm relay.EVMRequester, feed common.Address, maxAge time.Duration) (*Chainlink, error) {
+	parsed, err := abi.JSON(strings.NewReader(aggregatorV3ABI))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Chainlink{
+		evm:    evm,
+		feed:   feed,
+		maxAge: maxAge,
+		abi:    parsed,
+	}, nil
+}
+
+func (c *Chainlink) Name() string {
+	return "chainlink"
+}
+
+// Price returns the latest price of the feed, feeds don't expose historical prices by time
+func (c *Chainlink) Price(ctx context.Context, currency string, at time.Time) (*big.Float, error) {
+	decimals, err := c.call("decimals")
+	if err != nil {
+		return nil, err
+	}
+
+	round, err := c.call("latestRoundData")
+	if err != nil {
+		return nil, err
+	}
+
+	answer, ok := round[1].(*big.Int)
+	if !ok || answer.Sign() <= 0 {
+		return nil, errors.New("invalid chainlink answer")
+	}
+
+	updatedAt, ok := round[3].(*big.Int)
+	if ok && c.maxAge > 0 && time.Since(time.Unix(updatedAt.Int64(), 0)) > c.maxAge {
+		return nil, ErrStalePrice
+	}
+
+	d, ok := decimals[0].(uint8)
+	if !ok {
+		return nil, errors.New("invalid chainlink decimals")
+	}
+
+	return ToFiat(answer, int64(d), big.NewFloat(1)), nil
+}
+
+func (c *Chainlink) call(method string) ([]any, error) {
+	data, err := c.abi.Pack(method)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.evm.CallContract(ethereum.CallMsg{To: &c.feed, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.abi.Unpack(method, res)
+}
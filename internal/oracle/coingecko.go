@@ -0,0 +1,97 @@
+package oracle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CoinGecko fetches prices from the CoinGecko HTTP api
+type CoinGecko struct {
+	baseURL string
+	coinID  string
+	client  *http.Client
+}
+
+func NewCoinGecko(baseURL, coinID string) *CoinGecko {
+	return &CoinGecko{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		coinID:  coinID,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *CoinGecko) Name() string {
+	return "coingecko"
+}
+
+func (c *CoinGecko) Price(ctx context.Context, currency string, at time.Time) (*big.Float, error) {
+	vs := strings.ToLower(currency)
+
+	// current prices come from the simple endpoint, older ones from the daily history
+	if time.Since(at) < 24*time.Hour {
+		q := url.Values{}
+		q.Set("ids", c.coinID)
+		q.Set("vs_currencies", vs)
+
+		var resp map[string]map[string]float64
+		err := c.get(ctx, "/simple/price?"+q.Encode(), &resp)
+		if err != nil {
+			return nil, err
+		}
+
+		price, ok := resp[c.coinID][vs]
+		if !ok {
+			return nil, fmt.Errorf("no %s price for %s", vs, c.coinID)
+		}
+
+		return big.NewFloat(price), nil
+	}
+
+	q := url.Values{}
+	q.Set("date", at.UTC().Format("02-01-2006"))
+	q.Set("localization", "false")
+
+	var resp struct {
+		MarketData struct {
+			CurrentPrice map[string]float64 `json:"current_price"`
+		} `json:"market_data"`
+	}
+	err := c.get(ctx, fmt.Sprintf("/coins/%s/history?%s", url.PathEscape(c.coinID), q.Encode()), &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	price, ok := resp.MarketData.CurrentPrice[vs]
+	if !ok {
+		return nil, fmt.Errorf("no %s price for %s on %s", vs, c.coinID, at.Format(time.DateOnly))
+	}
+
+	return big.NewFloat(price), nil
+}
+
+func (c *CoinGecko) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from coingecko: %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
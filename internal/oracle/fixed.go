@@ -0,0 +1,26 @@
+package oracle
+
+import (
+	"context"
+	"math/big"
+	"time"
+)
+
+// Fixed always returns the same configured price
+type Fixed struct {
+	price *big.Float
+}
+
+func NewFixed(price float64) *Fixed {
+	return &Fixed{
+		price: big.NewFloat(price),
+	}
+}
+
+func (f *Fixed) Name() string {
+	return "fixed"
+}
+
+func (f *Fixed) Price(ctx context.Context, currency string, at time.Time) (*big.Float, error) {
+	return f.price, nil
+}
@@ -0,0 +1,150 @@
+package oracle
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// Provider fetches the price of the native token of the chain
+type Provider interface {
+	Name() string
+	Price(ctx context.Context, currency string, at time.Time) (*big.Float, error)
+}
+
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"CHF": "CHF ",
+}
+
+type cachedPrice struct {
+	price     *big.Float
+	fetchedAt time.Time
+}
+
+// Service caches the prices of a provider, recent prices expire after the ttl and historical ones are kept per day
+type Service struct {
+	provider Provider
+	currency string
+	ttl      time.Duration
+
+	mu     sync.Mutex
+	latest *cachedPrice
+	daily  map[string]*big.Float
+}
+
+func NewService(provider Provider, currency string, ttl time.Duration) *Service {
+	return &Service{
+		provider: provider,
+		currency: currency,
+		ttl:      ttl,
+		daily:    map[string]*big.Float{},
+	}
+}
+
+func (s *Service) Currency() string {
+	return s.currency
+}
+
+// Price returns the price of the native token at the given time
+func (s *Service) Price(ctx context.Context, at time.Time) (*big.Float, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// anything from the last day is considered current
+	if now.Sub(at) < 24*time.Hour {
+		if s.latest != nil && now.Sub(s.latest.fetchedAt) < s.ttl {
+			return s.latest.price, nil
+		}
+
+		price, err := s.provider.Price(ctx, s.currency, now)
+		if err != nil {
+			// a stale price is better than no price
+			if s.latest != nil {
+				return s.latest.price, nil
+			}
+
+			return nil, err
+		}
+
+		s.latest = &cachedPrice{price: price, fetchedAt: now}
+
+		return price, nil
+	}
+
+	day := at.UTC().Format(time.DateOnly)
+	if price, ok := s.daily[day]; ok {
+		return price, nil
+	}
+
+	price, err := s.provider.Price(ctx, s.currency, at)
+	if err != nil {
+		return nil, err
+	}
+
+	s.daily[day] = price
+
+	return price, nil
+}
+
+// WeiToFiat converts an amount in wei to fiat at the current price
+func (s *Service) WeiToFiat(ctx context.Context, wei *big.Int) (*big.Float, error) {
+	price, err := s.Price(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return ToFiat(wei, 18, price), nil
+}
+
+// FiatToWei converts a fiat amount to wei at the current price, used for budgets expressed in fiat
+func (s *Service) FiatToWei(ctx context.Context, amount *big.Float) (*big.Int, error) {
+	price, err := s.Price(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if price.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid price from %s: %s", s.provider.Name(), price.String())
+	}
+
+	v := new(big.Float).Quo(amount, price)
+	v.Mul(v, new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)))
+
+	wei, _ := v.Int(nil)
+
+	return wei, nil
+}
+
+// FormatFiat formats an amount of wei as an approximate fiat value, e.g. "~€5.00"
+func (s *Service) FormatFiat(ctx context.Context, wei *big.Int) (string, error) {
+	v, err := s.WeiToFiat(ctx, wei)
+	if err != nil {
+		return "", err
+	}
+
+	return FormatAmount(v, s.currency), nil
+}
+
+// ToFiat converts an amount with the given decimals to fiat
+func ToFiat(amount *big.Int, decimals int64, price *big.Float) *big.Float {
+	v := new(big.Float).SetInt(amount)
+	v.Quo(v, new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(decimals), nil)))
+
+	return v.Mul(v, price)
+}
+
+// FormatAmount formats a fiat amount with its currency symbol
+func FormatAmount(v *big.Float, currency string) string {
+	if symbol, ok := currencySymbols[currency]; ok {
+		return fmt.Sprintf("~%s%s", symbol, v.Text('f', 2))
+	}
+
+	return fmt.Sprintf("~%s %s", v.Text('f', 2), currency)
+}
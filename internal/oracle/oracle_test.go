@@ -0,0 +1,111 @@
+package oracle
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type TestProvider struct {
+	prices []float64
+	err    error
+	calls  int
+}
+
+func (p *TestProvider) Name() string {
+	return "test"
+}
+
+func (p *TestProvider) Price(ctx context.Context, currency string, at time.Time) (*big.Float, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return big.NewFloat(p.prices[(p.calls-1)%len(p.prices)]), nil
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("caches the latest price", func(t *testing.T) {
+		p := &TestProvider{prices: []float64{2, 3}}
+		s := NewService(p, "EUR", time.Minute)
+
+		for range 3 {
+			price, err := s.Price(ctx, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if price.Cmp(big.NewFloat(2)) != 0 {
+				t.Errorf("expected cached price 2, got %s", price.String())
+			}
+		}
+
+		if p.calls != 1 {
+			t.Errorf("expected 1 call, got %d", p.calls)
+		}
+	})
+
+	t.Run("falls back to a stale price", func(t *testing.T) {
+		p := &TestProvider{prices: []float64{2}}
+		s := NewService(p, "EUR", 0)
+
+		_, err := s.Price(ctx, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p.err = errors.New("provider down")
+
+		price, err := s.Price(ctx, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if price.Cmp(big.NewFloat(2)) != 0 {
+			t.Errorf("expected stale price 2, got %s", price.String())
+		}
+	})
+
+	t.Run("caches historical prices per day", func(t *testing.T) {
+		p := &TestProvider{prices: []float64{2, 3}}
+		s := NewService(p, "EUR", time.Minute)
+
+		at := time.Now().AddDate(0, -1, 0)
+
+		s.Price(ctx, at)
+		s.Price(ctx, at.Add(time.Minute))
+
+		if p.calls != 1 {
+			t.Errorf("expected 1 call, got %d", p.calls)
+		}
+	})
+
+	t.Run("converts between wei and fiat", func(t *testing.T) {
+		s := NewService(NewFixed(2), "EUR", time.Minute)
+
+		wei, _ := new(big.Int).SetString("2500000000000000000", 10)
+
+		f, err := s.FormatFiat(ctx, wei)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f != "~€5.00" {
+			t.Errorf("expected ~€5.00, got %s", f)
+		}
+
+		back, err := s.FiatToWei(ctx, big.NewFloat(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if back.Cmp(wei) != 0 {
+			t.Errorf("expected %s wei, got %s", wei.String(), back.String())
+		}
+	})
+}
@@ -0,0 +1,193 @@
+// Package outbox retries the events the relay signs but fails to store, such as the group lists
+// or the lifecycle updates of user ops during a database blip, so that the state they carry
+// eventually materializes instead of being lost with a log line.
+//
+// Failed events are persisted in the outbox table, those the database can't take yet are kept
+// in memory and persisted on the next tick. Retries back off exponentially up to maxBackoff and
+// never give up. Replaceable events are retried with a replace that keeps newer versions, a
+// retried version never overrides a later update.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/eventstore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// most events retried per tick
+	batchSize = 100
+
+	// longest wait between two attempts
+	maxBackoff = time.Hour
+)
+
+// Store persists the events waiting to be stored
+type Store interface {
+	AddOutboxEvent(e *relay.OutboxEvent) error
+	GetDueOutboxEvents(now time.Time, limit int) ([]*relay.OutboxEvent, error)
+	UpdateOutboxAttempt(e *relay.OutboxEvent) error
+	RemoveOutboxEvent(eventID string) error
+}
+
+// Saver stores events that are already signed
+type Saver interface {
+	SaveSignedEvent(ctx context.Context, ev *nostr.Event) error
+	ReplaceSignedEvent(ctx context.Context, ev *nostr.Event) error
+}
+
+type Service struct {
+	ctx      context.Context
+	store    Store
+	n        Saver
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending []*relay.OutboxEvent // not persisted yet
+
+	now func() time.Time
+}
+
+func NewService(ctx context.Context, store Store, n Saver, interval time.Duration) *Service {
+	return &Service{
+		ctx:      ctx,
+		store:    store,
+		n:        n,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Add queues an event that failed to be stored, replace tells whether it replaces older versions
+func (s *Service) Add(ev *nostr.Event, replace bool, cause error) {
+	now := s.now().UTC()
+
+	e := &relay.OutboxEvent{
+		Event:         ev,
+		Replace:       replace,
+		Attempts:      1,
+		LastError:     cause.Error(),
+		NextAttemptAt: now.Add(s.interval),
+		CreatedAt:     now,
+	}
+
+	err := s.store.AddOutboxEvent(e)
+	if err != nil {
+		s.mu.Lock()
+		s.pending = append(s.pending, e)
+		s.mu.Unlock()
+	}
+}
+
+// Start retries the queued events until the context is done
+func (s *Service) Start() error {
+	log.Default().Println("starting outbox")
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Default().Println("stopping outbox")
+			return nil
+		case <-ticker.C:
+			s.Run()
+		}
+	}
+}
+
+// Run persists the events kept in memory and retries the events that are due, it returns the
+// number of events that were stored
+func (s *Service) Run() int {
+	s.persist()
+
+	now := s.now().UTC()
+
+	due, err := s.store.GetDueOutboxEvents(now, batchSize)
+	if err != nil {
+		log.Default().Printf("failed to fetch the outbox: %v", err)
+		return 0
+	}
+
+	stored := 0
+	for _, e := range due {
+		err := s.save(e)
+		if err == nil {
+			stored++
+
+			err = s.store.RemoveOutboxEvent(e.Event.ID)
+			if err != nil {
+				log.Default().Printf("failed to remove %s from the outbox: %v", e.Event.ID, err)
+			}
+
+			continue
+		}
+
+		e.Attempts++
+		e.LastError = err.Error()
+		e.NextAttemptAt = now.Add(backoff(s.interval, e.Attempts))
+
+		log.Default().Printf("failed to store %s from the outbox after %d attempts: %v", e.Event.ID, e.Attempts, err)
+
+		err = s.store.UpdateOutboxAttempt(e)
+		if err != nil {
+			log.Default().Printf("failed to update %s in the outbox: %v", e.Event.ID, err)
+		}
+	}
+
+	return stored
+}
+
+// persist moves the events kept in memory to the store
+func (s *Service) persist() {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	failed := []*relay.OutboxEvent{}
+	for _, e := range pending {
+		err := s.store.AddOutboxEvent(e)
+		if err != nil {
+			failed = append(failed, e)
+		}
+	}
+
+	if len(failed) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	s.pending = append(failed, s.pending...)
+	s.mu.Unlock()
+}
+
+func (s *Service) save(e *relay.OutboxEvent) error {
+	if e.Replace {
+		return s.n.ReplaceSignedEvent(s.ctx, e.Event)
+	}
+
+	err := s.n.SaveSignedEvent(s.ctx, e.Event)
+	if errors.Is(err, eventstore.ErrDupEvent) {
+		return nil
+	}
+
+	return err
+}
+
+// backoff doubles the interval with every attempt
+func backoff(interval time.Duration, attempts int) time.Duration {
+	d := interval
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, maxBackoff)
+}
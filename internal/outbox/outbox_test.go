@@ -0,0 +1,135 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var errDown = errors.New("database is down")
+
+type testStore struct {
+	down   bool
+	events map[string]*relay.OutboxEvent
+}
+
+func (s *testStore) AddOutboxEvent(e *relay.OutboxEvent) error {
+	if s.down {
+		return errDown
+	}
+
+	s.events[e.Event.ID] = e
+	return nil
+}
+
+func (s *testStore) GetDueOutboxEvents(now time.Time, limit int) ([]*relay.OutboxEvent, error) {
+	if s.down {
+		return nil, errDown
+	}
+
+	due := []*relay.OutboxEvent{}
+	for _, e := range s.events {
+		if !e.NextAttemptAt.After(now) {
+			due = append(due, e)
+		}
+	}
+
+	return due, nil
+}
+
+func (s *testStore) UpdateOutboxAttempt(e *relay.OutboxEvent) error {
+	s.events[e.Event.ID] = e
+	return nil
+}
+
+func (s *testStore) RemoveOutboxEvent(eventID string) error {
+	delete(s.events, eventID)
+	return nil
+}
+
+type testSaver struct {
+	fail     bool
+	saved    []string
+	replaced []string
+}
+
+func (s *testSaver) SaveSignedEvent(ctx context.Context, ev *nostr.Event) error {
+	if s.fail {
+		return errDown
+	}
+
+	s.saved = append(s.saved, ev.ID)
+	return nil
+}
+
+func (s *testSaver) ReplaceSignedEvent(ctx context.Context, ev *nostr.Event) error {
+	if s.fail {
+		return errDown
+	}
+
+	s.replaced = append(s.replaced, ev.ID)
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	store := &testStore{down: true, events: map[string]*relay.OutboxEvent{}}
+	saver := &testSaver{fail: true}
+
+	now := time.Unix(1000, 0)
+	s := NewService(context.Background(), store, saver, time.Minute)
+	s.now = func() time.Time { return now }
+
+	// the database can't take the events yet, they are kept until it can
+	s.Add(&nostr.Event{ID: "list", Kind: 39002}, false, errDown)
+	s.Add(&nostr.Event{ID: "userop", Kind: 111001}, true, errDown)
+
+	if s.Run() != 0 || len(s.pending) != 2 {
+		t.Fatalf("expected the events to stay in memory, got %d", len(s.pending))
+	}
+
+	store.down = false
+
+	if s.Run() != 0 || len(s.pending) != 0 || len(store.events) != 2 {
+		t.Fatalf("expected the events to be persisted, got %d", len(store.events))
+	}
+
+	// the first retry isn't due yet
+	now = now.Add(30 * time.Second)
+	if s.Run() != 0 {
+		t.Fatal("expected nothing to be retried")
+	}
+
+	// the retry fails and backs off
+	now = now.Add(30 * time.Second)
+	if s.Run() != 0 {
+		t.Fatal("expected the retries to fail")
+	}
+
+	e := store.events["list"]
+	if e.Attempts != 2 || e.LastError != errDown.Error() || !e.NextAttemptAt.Equal(now.Add(2*time.Minute).UTC()) {
+		t.Fatalf("unexpected attempt %+v", e)
+	}
+
+	saver.fail = false
+	now = now.Add(2 * time.Minute)
+
+	if s.Run() != 2 || len(store.events) != 0 {
+		t.Fatalf("expected both events to be stored, %d left", len(store.events))
+	}
+
+	if len(saver.saved) != 1 || saver.saved[0] != "list" || len(saver.replaced) != 1 || saver.replaced[0] != "userop" {
+		t.Fatalf("expected the list to be saved and the user op replaced, got %v %v", saver.saved, saver.replaced)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 4 * time.Minute, 20: maxBackoff} {
+		if got := backoff(time.Minute, attempts); got != want {
+			t.Errorf("expected %s after %d attempts, got %s", want, attempts, got)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package paymaster
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// KindSponsorshipDenial is the ephemeral kind denials are announced with, wallet developers can
+// subscribe to it filtered by the sender tag
+const KindSponsorshipDenial = 21402
+
+// methods a user op can be denied in
+const (
+	MethodSponsor   = "pm_sponsorUserOperation"
+	MethodOOSponsor = "pm_ooSponsorUserOperation"
+	MethodSend      = "eth_sendUserOperation"
+)
+
+// denials returned by default to admins
+const defaultDenialLimit = 100
+
+// Announcer broadcasts events signed by the relay
+type Announcer interface {
+	SignAndBroadcastEvent(ev *nostr.Event) (*nostr.Event, error)
+}
+
+// Denials records the user ops that paymasters refused to sponsor, so that it is possible to find
+// out why an action of a user doesn't go through after the json-rpc error is gone
+type Denials struct {
+	db *db.DB
+	n  Announcer // nil unless denials are announced
+}
+
+func NewDenials(db *db.DB, n Announcer) *Denials {
+	return &Denials{db: db, n: n}
+}
+
+// Record stores why a user op was denied and announces it, failures are only logged since the
+// user op is refused either way
+func (d *Denials) Record(method string, paymaster common.Address, userop relay.UserOp, reason error) {
+	denial := &relay.SponsorshipDenial{
+		Paymaster: paymaster.Hex(),
+		Sender:    userop.Sender.Hex(),
+		Selector:  callSelector(userop.CallData),
+		Method:    method,
+		Reason:    reason.Error(),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	err := d.db.SponsorshipDenialDB.AddDenial(denial)
+	if err != nil {
+		log.Printf("paymaster: failed to record denial of %s: %v", denial.Sender, err)
+	}
+
+	if d.n == nil {
+		return
+	}
+
+	_, err = d.n.SignAndBroadcastEvent(denialEvent(denial))
+	if err != nil {
+		log.Printf("paymaster: failed to announce denial of %s: %v", denial.Sender, err)
+	}
+}
+
+func denialEvent(d *relay.SponsorshipDenial) *nostr.Event {
+	return &nostr.Event{
+		Kind:      KindSponsorshipDenial,
+		CreatedAt: nostr.Timestamp(d.CreatedAt.Unix()),
+		Content:   d.Reason,
+		Tags: nostr.Tags{
+			{"paymaster", strings.ToLower(d.Paymaster)},
+			{"sender", strings.ToLower(d.Sender)},
+			{"selector", d.Selector},
+			{"method", d.Method},
+		},
+	}
+}
+
+// callSelector returns the selector of the call an account makes, the account function is returned
+// for batches and call data that can't be decoded
+func callSelector(callData []byte) string {
+	if len(callData) < 4 {
+		return ""
+	}
+
+	sig := callData[:4]
+	if !bytes.Equal(sig, relay.FuncSigSingle) && !bytes.Equal(sig, relay.FuncSigSafeExecFromModule) {
+		return hexutil.Encode(sig)
+	}
+
+	// both calls start with the destination, the value and the data
+	values, err := executeArgs.UnpackValues(callData[4:])
+	if err != nil || len(values) < 3 {
+		return hexutil.Encode(sig)
+	}
+
+	data, ok := values[2].([]byte)
+	if !ok || len(data) < 4 {
+		return hexutil.Encode(sig)
+	}
+
+	return hexutil.Encode(data[:4])
+}
+
+// deny records why a user op was refused when it is, the error is returned unchanged
+func (s *Service) deny(method string, paymaster common.Address, userop relay.UserOp, err error) error {
+	if err == nil || s.denials == nil {
+		return err
+	}
+
+	s.denials.Record(method, paymaster, userop, err)
+
+	return err
+}
+
+// Get returns the latest denials, for admins. They can be filtered by paymaster and sender.
+func (d *Denials) Get(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := defaultDenialLimit
+	if l := q.Get("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		limit = v
+	}
+
+	paymaster, ok := addressParam(q.Get("paymaster"))
+	if !ok {
+		http.Error(w, "invalid paymaster", http.StatusBadRequest)
+		return
+	}
+
+	sender, ok := addressParam(q.Get("sender"))
+	if !ok {
+		http.Error(w, "invalid sender", http.StatusBadRequest)
+		return
+	}
+
+	denials, err := d.db.SponsorshipDenialDB.GetDenials(paymaster, sender, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, denials, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// addressParam checksums an optional address filter, addresses are stored checksummed
+func addressParam(v string) (string, bool) {
+	if v == "" {
+		return "", true
+	}
+
+	if !common.IsHexAddress(v) {
+		return "", false
+	}
+
+	return common.HexToAddress(v).Hex(), true
+}
@@ -0,0 +1,45 @@
+package paymaster
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestCallSelector(t *testing.T) {
+	uint8Ty, _ := abi.NewType("uint8", "uint8", nil)
+
+	to := common.HexToAddress("0x5815E61eF72c9E6107b5c5A05FD121F334f7a7f1")
+	transfer := []byte{0xa9, 0x05, 0x9c, 0xbb, 0x00}
+
+	args, err := executeArgs.Pack(to, big.NewInt(0), transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	safeArgs, err := append(append(abi.Arguments{}, executeArgs...), abi.Argument{Type: uint8Ty}).Pack(to, big.NewInt(0), transfer, uint8(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		callData []byte
+		want     string
+	}{
+		{"execute", append(append([]byte{}, relay.FuncSigSingle...), args...), "0xa9059cbb"},
+		{"safe", append(append([]byte{}, relay.FuncSigSafeExecFromModule...), safeArgs...), "0xa9059cbb"},
+		{"batch", append(append([]byte{}, relay.FuncSigBatch...), args...), "0x" + common.Bytes2Hex(relay.FuncSigBatch)},
+		{"undecodable", append(append([]byte{}, relay.FuncSigSingle...), 0x01), "0x" + common.Bytes2Hex(relay.FuncSigSingle)},
+		{"short", []byte{0x01}, ""},
+	}
+
+	for _, c := range cases {
+		if got := callSelector(c.callData); got != c.want {
+			t.Errorf("%s: expected %q, got %q", c.name, c.want, got)
+		}
+	}
+}
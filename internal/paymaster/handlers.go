@@ -1,8 +1,6 @@
 package paymaster
 
 import (
-	"bytes"
-	"context"
 	"encoding/json"
 	"errors"
 	"math/big"
@@ -10,7 +8,6 @@ import (
 	"strconv"
 	"time"
 
-	pay "github.com/citizenwallet/smartcontracts/pkg/contracts/paymaster"
 	"github.com/comunifi/relay/internal/db"
 	comm "github.com/comunifi/relay/pkg/common"
 	"github.com/comunifi/relay/pkg/relay"
@@ -25,22 +22,38 @@ import (
 var (
 	// OO Signature limit in seconds
 	ooSigLimit = int64(60 * 60 * 24 * 7)
+
+	// Signature limit in seconds
+	sponsorValidity = int64(60)
 )
 
 type Service struct {
 	evm relay.EVMRequester
 
 	db *db.DB
+
+	hasher *Hasher
+
+	limits Limits
+
+	denials *Denials // nil unless denials are recorded
 }
 
 // NewService
-func NewService(evm relay.EVMRequester, db *db.DB) *Service {
+func NewService(evm relay.EVMRequester, db *db.DB, chainID *big.Int, limits Limits) *Service {
 	return &Service{
-		evm,
-		db,
+		evm:    evm,
+		db:     db,
+		hasher: NewHasher(evm, chainID),
+		limits: limits,
 	}
 }
 
+// SetDenials records why user ops are refused
+func (s *Service) SetDenials(d *Denials) {
+	s.denials = d
+}
+
 type paymasterType struct {
 	Type string `json:"type"`
 }
@@ -58,19 +71,8 @@ func (s *Service) Sponsor(r *http.Request) (any, error) {
 
 	addr := common.HexToAddress(contractAddr)
 
-	// Get the contract's bytecode
-	bytecode, err := s.evm.CodeAt(context.Background(), addr, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check if the contract is deployed
-	if len(bytecode) == 0 {
-		return nil, errors.New("paymaster contract not deployed")
-	}
-
-	// instantiate paymaster contract
-	pm, err := pay.NewPaymaster(addr, s.evm.Backend())
+	// make sure the paymaster is deployed, the binding is cached after the first request
+	_, err := s.hasher.Paymaster(addr)
 	if err != nil {
 		return nil, err
 	}
@@ -132,163 +134,21 @@ func (s *Service) Sponsor(r *http.Request) (any, error) {
 		return nil, errors.New("error entrypoint address is empty")
 	}
 
-	// verify the nonce
-
-	// get nonce using the account factory since we are not sure if the account has been created yet
-	nonce := userop.Nonce
-
-	// verify the init code
-	initCode := hexutil.Encode(userop.InitCode)
-
-	// if the nonce is not 0, then the init code should be empty
-	if nonce.Cmp(big.NewInt(0)) == 1 && initCode != "0x" {
-		return nil, errors.New("error init code is not empty even though nonce is not 0")
-	}
-
-	// if the nonce is 0, then check that the factory exists
-	if nonce.Cmp(big.NewInt(0)) == 0 && len(userop.InitCode) > 20 {
-		factoryaddr := common.BytesToAddress(userop.InitCode[:20])
-
-		// Get the contract's bytecode
-		bytecode, err := s.evm.CodeAt(context.Background(), factoryaddr, nil)
-		if err != nil {
-			return nil, err
-		}
-
-		// Check if the contract is deployed
-		if len(bytecode) == 0 {
-			return nil, errors.New("error factory contract not found")
-		}
-	}
-
-	if len(userop.CallData) < 4 {
-		return nil, errors.New("error call data is too short")
-	}
-
-	// verify the calldata, it should only be allowed to contain the function signatures we allow
-	funcSig := userop.CallData[:4]
-	if !bytes.Equal(funcSig, relay.FuncSigSingle) && !bytes.Equal(funcSig, relay.FuncSigBatch) && !bytes.Equal(funcSig, relay.FuncSigSafeExecFromModule) {
-		return nil, errors.New("error invalid function signature. supported signatures: execute, executeBatch, execTransactionFromModule")
-	}
-
-	addressArg, _ := abi.NewType("address", "address", nil)
-	uint256Arg, _ := abi.NewType("uint256", "uint256", nil)
-	bytesArg, _ := abi.NewType("bytes", "bytes", nil)
-	callArgs := abi.Arguments{
-		abi.Argument{
-			Type: addressArg,
-		},
-		abi.Argument{
-			Type: uint256Arg,
-		},
-		abi.Argument{
-			Type: bytesArg,
-		},
-	}
-	if pt.Type == "cw-safe" {
-		operationArg, _ := abi.NewType("uint8", "uint8", nil)
-
-		callArgs = abi.Arguments{
-			abi.Argument{
-				Type: addressArg,
-			},
-			abi.Argument{
-				Type: uint256Arg,
-			},
-			abi.Argument{
-				Type: bytesArg,
-			},
-			abi.Argument{
-				Type: operationArg,
-			},
-		}
-	}
-
-	// Unpack the values
-	callValues, err := callArgs.Unpack(userop.CallData[4:])
-	if err != nil {
-		return nil, err
-	}
-
-	// destination address
-	_, ok := callValues[0].(common.Address)
-	if !ok {
-		return nil, errors.New("error invalid destination address")
-	}
-
-	// value in uint256
-	_, ok = callValues[1].(*big.Int)
-	if !ok {
-		// shouldn't have any value
-		return nil, errors.New("error invalid call value")
-	}
-
-	// data in bytes
-	_, ok = callValues[2].([]byte)
-	if !ok {
-		return nil, errors.New("error invalid call data")
-	}
-
-	// validity period
-	now := time.Now().Unix()
-	validUntil := big.NewInt(now + 60)
-	validAfter := big.NewInt(now - 10)
-
-	// Ensure the values fit within 48 bits
-	if validUntil.BitLen() > 48 || validAfter.BitLen() > 48 {
-		return nil, errors.New("error invalid validity period")
-	}
-
-	// Define the arguments
-	uint48Ty, _ := abi.NewType("uint48", "uint48", nil)
-	args := abi.Arguments{
-		abi.Argument{
-			Type: uint48Ty,
-		},
-		abi.Argument{
-			Type: uint48Ty,
-		},
-	}
-
-	// Encode the values
-	validity, err := args.Pack(validUntil, validAfter)
-	if err != nil {
-		return nil, err
-	}
-
-	hash, err := pm.GetHash(nil, pay.UserOperation(userop), validUntil, validAfter)
-	if err != nil {
-		return nil, err
-	}
-
-	// Convert the hash to an Ethereum signed message hash
-	hhash := accounts.TextHash(hash[:])
-
-	// fetch the sponsor's corresponding private key from the db
-	sponsorKey, err := s.db.SponsorDB.GetSponsor(addr.Hex())
+	err = s.checkInitCode(userop)
 	if err != nil {
-		return nil, errors.New("error not allowed to operate this paymaster")
+		return nil, s.deny(MethodSponsor, addr, userop, err)
 	}
 
-	// Generate ecdsa.PrivateKey from bytes
-	privateKey, err := comm.HexToPrivateKey(sponsorKey.PrivateKey)
+	err = CheckCallData(userop.CallData, pt.Type)
 	if err != nil {
-		return nil, errors.New("error invalid private key")
+		return nil, s.deny(MethodSponsor, addr, userop, err)
 	}
 
-	sig, err := crypto.Sign(hhash, privateKey)
+	data, err := s.SponsorUserOp(addr, userop, sponsorValidity)
 	if err != nil {
-		return nil, errors.New("error signing hash")
-	}
-
-	// Ensure the v value is 27 or 28, this is because of the way Ethereum signature recovery works
-	if sig[crypto.RecoveryIDOffset] == 0 || sig[crypto.RecoveryIDOffset] == 1 {
-		sig[crypto.RecoveryIDOffset] += 27
+		return nil, s.deny(MethodSponsor, addr, userop, err)
 	}
 
-	data := append(addr.Bytes(), validity...)
-	data = append(data, sig...)
-
 	pd := &paymasterData{
 		PaymasterAndData:     hexutil.Encode(data),
 		PreVerificationGas:   hexutil.EncodeBig(userop.PreVerificationGas),
@@ -306,20 +166,12 @@ func (s *Service) OOSponsor(r *http.Request) (any, error) {
 
 	addr := common.HexToAddress(contractAddr)
 
-	// Get the contract's bytecode
-	bytecode, err := s.evm.CodeAt(context.Background(), addr, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check if the contract is deployed
-	if len(bytecode) == 0 {
-		return nil, errors.New("error paymaster contract not deployed")
-	}
-
-	// instantiate paymaster contract
-	pm, err := pay.NewPaymaster(addr, s.evm.Backend())
+	// make sure the paymaster is deployed, the binding is cached after the first request
+	_, err := s.hasher.Paymaster(addr)
 	if err != nil {
+		if errors.Is(err, ErrPaymasterNotDeployed) {
+			return nil, errors.New("error paymaster contract not deployed")
+		}
 		return nil, errors.New("error instantiating paymaster contract")
 	}
 
@@ -396,69 +248,14 @@ func (s *Service) OOSponsor(r *http.Request) (any, error) {
 		return nil, errors.New("error entrypoint address is empty")
 	}
 
-	// verify the calldata, it should only be allowed to contain the function signatures we allow
-	funcSig := userop.CallData[:4]
-	if !bytes.Equal(funcSig, relay.FuncSigSingle) && !bytes.Equal(funcSig, relay.FuncSigBatch) && !bytes.Equal(funcSig, relay.FuncSigSafeExecFromModule) {
-		return nil, errors.New("error invalid function signature. supported signatures: execute, executeBatch, execTransactionFromModule")
-
-	}
-
-	addressArg, _ := abi.NewType("address", "address", nil)
-	uint256Arg, _ := abi.NewType("uint256", "uint256", nil)
-	bytesArg, _ := abi.NewType("bytes", "bytes", nil)
-	callArgs := abi.Arguments{
-		abi.Argument{
-			Type: addressArg,
-		},
-		abi.Argument{
-			Type: uint256Arg,
-		},
-		abi.Argument{
-			Type: bytesArg,
-		},
-	}
-	if pt.Type == "cw-safe" {
-		operationArg, _ := abi.NewType("uint8", "uint8", nil)
-
-		callArgs = abi.Arguments{
-			abi.Argument{
-				Type: addressArg,
-			},
-			abi.Argument{
-				Type: uint256Arg,
-			},
-			abi.Argument{
-				Type: bytesArg,
-			},
-			abi.Argument{
-				Type: operationArg,
-			},
-		}
-	}
-
-	// Unpack the values
-	callValues, err := callArgs.Unpack(userop.CallData[4:])
+	err = CheckCallData(userop.CallData, pt.Type)
 	if err != nil {
-		return nil, err
-	}
-
-	// destination address
-	_, ok := callValues[0].(common.Address)
-	if !ok {
-		return nil, errors.New("error invalid destination address")
-	}
-
-	// value in uint256
-	_, ok = callValues[1].(*big.Int)
-	if !ok {
-		// shouldn't have any value
-		return nil, errors.New("error invalid call value")
+		return nil, s.deny(MethodOOSponsor, addr, userop, err)
 	}
 
-	// data in bytes
-	_, ok = callValues[2].([]byte)
-	if !ok {
-		return nil, errors.New("error invalid call data")
+	gas, err := sponsoredGas(amount, userop)
+	if err != nil {
+		return nil, s.deny(MethodOOSponsor, addr, userop, err)
 	}
 
 	// validity period
@@ -496,7 +293,7 @@ func (s *Service) OOSponsor(r *http.Request) (any, error) {
 	}
 
 	// Generate ecdsa.PrivateKey from bytes
-	privateKey, err := comm.HexToPrivateKey(sponsorKey.PrivateKey)
+	privateKey, err := comm.HexToPrivateKey(sponsorKey.SigningKey())
 	if err != nil {
 		return nil, errors.New("error invalid private key")
 	}
@@ -514,7 +311,7 @@ func (s *Service) OOSponsor(r *http.Request) (any, error) {
 
 		op.Nonce = nonce.BigInt()
 
-		hash, err := pm.GetHash(nil, pay.UserOperation(op), validUntil, validAfter)
+		hash, err := s.hasher.Hash(addr, op, validUntil, validAfter)
 		if err != nil {
 			return nil, errors.New("error generating hash")
 		}
@@ -540,5 +337,87 @@ func (s *Service) OOSponsor(r *http.Request) (any, error) {
 		userops = append(userops, &op)
 	}
 
+	// every signed op can be sent, they all count towards the limits
+	err = s.reserve(addr, userop.Sender, len(userops), gas)
+	if err != nil {
+		return nil, s.deny(MethodOOSponsor, addr, userop, err)
+	}
+
 	return userops, nil
 }
+
+// SponsorUserOp returns the paymasterAndData of a user op signed by the sponsor of the paymaster,
+// valid for the given amount of seconds. The op counts towards the sponsorship limits of its sender.
+func (s *Service) SponsorUserOp(addr common.Address, userop relay.UserOp, validFor int64) ([]byte, error) {
+	gas, err := sponsoredGas(1, userop)
+	if err != nil {
+		return nil, err
+	}
+
+	// validity period
+	now := time.Now().Unix()
+	validUntil := big.NewInt(now + validFor)
+	validAfter := big.NewInt(now - 10)
+
+	// Ensure the values fit within 48 bits
+	if validUntil.BitLen() > 48 || validAfter.BitLen() > 48 {
+		return nil, errors.New("error invalid validity period")
+	}
+
+	// Define the arguments
+	uint48Ty, _ := abi.NewType("uint48", "uint48", nil)
+	args := abi.Arguments{
+		abi.Argument{
+			Type: uint48Ty,
+		},
+		abi.Argument{
+			Type: uint48Ty,
+		},
+	}
+
+	// Encode the values
+	validity, err := args.Pack(validUntil, validAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := s.hasher.Hash(addr, userop, validUntil, validAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert the hash to an Ethereum signed message hash
+	hhash := accounts.TextHash(hash[:])
+
+	// fetch the sponsor's corresponding private key from the db
+	sponsorKey, err := s.db.SponsorDB.GetSponsor(addr.Hex())
+	if err != nil {
+		return nil, errors.New("error not allowed to operate this paymaster")
+	}
+
+	// Generate ecdsa.PrivateKey from bytes
+	privateKey, err := comm.HexToPrivateKey(sponsorKey.SigningKey())
+	if err != nil {
+		return nil, errors.New("error invalid private key")
+	}
+
+	sig, err := crypto.Sign(hhash, privateKey)
+	if err != nil {
+		return nil, errors.New("error signing hash")
+	}
+
+	// Ensure the v value is 27 or 28, this is because of the way Ethereum signature recovery works
+	if sig[crypto.RecoveryIDOffset] == 0 || sig[crypto.RecoveryIDOffset] == 1 {
+		sig[crypto.RecoveryIDOffset] += 27
+	}
+
+	err = s.reserve(addr, userop.Sender, 1, gas)
+	if err != nil {
+		return nil, err
+	}
+
+	data := append(addr.Bytes(), validity...)
+	data = append(data, sig...)
+
+	return data, nil
+}
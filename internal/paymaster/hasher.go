@@ -0,0 +1,172 @@
+package paymaster
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	pay "github.com/citizenwallet/smartcontracts/pkg/contracts/paymaster"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// how long a paymaster is trusted to keep the hash layout that was verified against it
+const layoutVerifyInterval = time.Hour
+
+var ErrPaymasterNotDeployed = errors.New("paymaster contract not deployed")
+
+// layout of the hash computed by the verifying paymaster's getHash
+var hashArgs abi.Arguments
+
+func init() {
+	addressTy, _ := abi.NewType("address", "address", nil)
+	uint256Ty, _ := abi.NewType("uint256", "uint256", nil)
+	bytes32Ty, _ := abi.NewType("bytes32", "bytes32", nil)
+	uint48Ty, _ := abi.NewType("uint48", "uint48", nil)
+
+	hashArgs = abi.Arguments{
+		{Type: addressTy}, // sender
+		{Type: uint256Ty}, // nonce
+		{Type: bytes32Ty}, // keccak256(initCode)
+		{Type: bytes32Ty}, // keccak256(callData)
+		{Type: uint256Ty}, // callGasLimit
+		{Type: uint256Ty}, // verificationGasLimit
+		{Type: uint256Ty}, // preVerificationGas
+		{Type: uint256Ty}, // maxFeePerGas
+		{Type: uint256Ty}, // maxPriorityFeePerGas
+		{Type: uint256Ty}, // chain id
+		{Type: addressTy}, // paymaster
+		{Type: uint48Ty},  // validUntil
+		{Type: uint48Ty},  // validAfter
+	}
+}
+
+type remoteHashFunc func(addr common.Address, op relay.UserOp, validUntil, validAfter *big.Int) ([32]byte, error)
+
+type layout struct {
+	local      bool
+	verifiedAt time.Time
+}
+
+// Hasher computes paymaster hashes, locally when the contract is known to use the
+// standard layout, with an eth_call to getHash otherwise
+type Hasher struct {
+	evm     relay.EVMRequester
+	chainID *big.Int
+
+	mu       sync.Mutex
+	bindings map[common.Address]*pay.Paymaster
+	layouts  map[common.Address]layout
+
+	remote remoteHashFunc
+}
+
+func NewHasher(evm relay.EVMRequester, chainID *big.Int) *Hasher {
+	h := &Hasher{
+		evm:      evm,
+		chainID:  chainID,
+		bindings: map[common.Address]*pay.Paymaster{},
+		layouts:  map[common.Address]layout{},
+	}
+
+	h.remote = h.remoteHash
+
+	return h
+}
+
+// Paymaster returns the cached contract binding of a paymaster, checking it is deployed the first time
+func (h *Hasher) Paymaster(addr common.Address) (*pay.Paymaster, error) {
+	h.mu.Lock()
+	pm, ok := h.bindings[addr]
+	h.mu.Unlock()
+
+	if ok {
+		return pm, nil
+	}
+
+	bytecode, err := h.evm.CodeAt(context.Background(), addr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bytecode) == 0 {
+		return nil, ErrPaymasterNotDeployed
+	}
+
+	pm, err = pay.NewPaymaster(addr, h.evm.Backend())
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.bindings[addr] = pm
+	h.mu.Unlock()
+
+	return pm, nil
+}
+
+// Hash returns the hash the paymaster expects the sponsor to sign
+func (h *Hasher) Hash(addr common.Address, op relay.UserOp, validUntil, validAfter *big.Int) ([32]byte, error) {
+	h.mu.Lock()
+	l, ok := h.layouts[addr]
+	h.mu.Unlock()
+
+	if ok && time.Since(l.verifiedAt) < layoutVerifyInterval {
+		if l.local {
+			return h.localHash(addr, op, validUntil, validAfter)
+		}
+
+		return h.remote(addr, op, validUntil, validAfter)
+	}
+
+	// verify the local layout against the contract, the contract always wins
+	remote, err := h.remote(addr, op, validUntil, validAfter)
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	local, err := h.localHash(addr, op, validUntil, validAfter)
+
+	h.mu.Lock()
+	h.layouts[addr] = layout{local: err == nil && local == remote, verifiedAt: time.Now()}
+	h.mu.Unlock()
+
+	return remote, nil
+}
+
+func (h *Hasher) remoteHash(addr common.Address, op relay.UserOp, validUntil, validAfter *big.Int) ([32]byte, error) {
+	pm, err := h.Paymaster(addr)
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	return pm.GetHash(nil, pay.UserOperation(op), validUntil, validAfter)
+}
+
+// localHash computes getHash of a verifying paymaster without calling the contract
+func (h *Hasher) localHash(addr common.Address, op relay.UserOp, validUntil, validAfter *big.Int) ([32]byte, error) {
+	packed, err := hashArgs.Pack(
+		op.Sender,
+		op.Nonce,
+		crypto.Keccak256Hash(op.InitCode),
+		crypto.Keccak256Hash(op.CallData),
+		op.CallGasLimit,
+		op.VerificationGasLimit,
+		op.PreVerificationGas,
+		op.MaxFeePerGas,
+		op.MaxPriorityFeePerGas,
+		h.chainID,
+		addr,
+		validUntil,
+		validAfter,
+	)
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	return crypto.Keccak256Hash(packed), nil
+}
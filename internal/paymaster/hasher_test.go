@@ -0,0 +1,89 @@
+package paymaster
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func testUserOp(nonce int64) relay.UserOp {
+	return relay.UserOp{
+		Sender:               common.HexToAddress("0x5815E61eF72c9E6107b5c5A05FD121F334f7a7f1"),
+		Nonce:                big.NewInt(nonce),
+		InitCode:             []byte{},
+		CallData:             []byte{0xb6, 0x1d, 0x27, 0xf6},
+		CallGasLimit:         big.NewInt(100000),
+		VerificationGasLimit: big.NewInt(100000),
+		PreVerificationGas:   big.NewInt(50000),
+		MaxFeePerGas:         big.NewInt(1000000000),
+		MaxPriorityFeePerGas: big.NewInt(1000000000),
+	}
+}
+
+func TestHasher(t *testing.T) {
+	pm := common.HexToAddress("0x7079253c0358eF9Fd87E16488299Ef6e06F403B6")
+	validUntil, validAfter := big.NewInt(1700000060), big.NewInt(1699999990)
+
+	t.Run("computes locally once the layout is verified", func(t *testing.T) {
+		h := NewHasher(nil, big.NewInt(100))
+
+		calls := 0
+		h.remote = func(addr common.Address, op relay.UserOp, validUntil, validAfter *big.Int) ([32]byte, error) {
+			calls++
+			return h.localHash(addr, op, validUntil, validAfter)
+		}
+
+		for i := int64(0); i < 5; i++ {
+			hash, err := h.Hash(pm, testUserOp(i), validUntil, validAfter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected, _ := h.localHash(pm, testUserOp(i), validUntil, validAfter)
+			if hash != expected {
+				t.Fatalf("unexpected hash for nonce %d", i)
+			}
+		}
+
+		if calls != 1 {
+			t.Fatalf("expected 1 eth_call, got %d", calls)
+		}
+	})
+
+	t.Run("falls back to eth_call for other layouts", func(t *testing.T) {
+		h := NewHasher(nil, big.NewInt(100))
+
+		calls := 0
+		h.remote = func(addr common.Address, op relay.UserOp, validUntil, validAfter *big.Int) ([32]byte, error) {
+			calls++
+			return [32]byte{byte(op.Nonce.Int64() + 1)}, nil
+		}
+
+		for i := int64(0); i < 5; i++ {
+			hash, err := h.Hash(pm, testUserOp(i), validUntil, validAfter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if hash != [32]byte{byte(i + 1)} {
+				t.Fatalf("expected the contract hash for nonce %d", i)
+			}
+		}
+
+		if calls != 5 {
+			t.Fatalf("expected 5 eth_calls, got %d", calls)
+		}
+	})
+
+	t.Run("local hash depends on chain and paymaster", func(t *testing.T) {
+		a, _ := NewHasher(nil, big.NewInt(100)).localHash(pm, testUserOp(0), validUntil, validAfter)
+		b, _ := NewHasher(nil, big.NewInt(1)).localHash(pm, testUserOp(0), validUntil, validAfter)
+		c, _ := NewHasher(nil, big.NewInt(100)).localHash(common.HexToAddress("0x01"), testUserOp(0), validUntil, validAfter)
+
+		if a == b || a == c {
+			t.Fatal("expected different hashes")
+		}
+	})
+}
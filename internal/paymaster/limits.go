@@ -0,0 +1,139 @@
+package paymaster
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// json-rpc error code returned when an account reached its sponsorship limit
+	ErrCodeSponsorLimit = -32096
+
+	// header with the unix time at which the account can be sponsored again
+	SponsorLimitResetHeader = "X-Sponsor-Limit-Reset"
+)
+
+// Limits restricts what a single account can be sponsored by a paymaster within a sliding window,
+// a limit of 0 is not enforced
+type Limits struct {
+	Ops    int
+	Gas    uint64
+	Window time.Duration
+}
+
+var DefaultLimits = Limits{
+	Ops:    1000,
+	Window: 24 * time.Hour,
+}
+
+// ErrGasTooLarge is returned when the gas limits of a user op are too large to be sponsored
+var ErrGasTooLarge = errors.New("error gas limits are too large")
+
+// SponsorLimitError is returned when sponsoring would exceed the limits of an account
+type SponsorLimitError struct {
+	Sender  string
+	ResetAt time.Time
+}
+
+func (e *SponsorLimitError) Error() string {
+	return fmt.Sprintf("sponsorship limit reached for %s, resets at %s", e.Sender, e.ResetAt.UTC().Format(time.RFC3339))
+}
+
+func (e *SponsorLimitError) ErrorCode() int {
+	return ErrCodeSponsorLimit
+}
+
+func (e *SponsorLimitError) Headers() http.Header {
+	h := http.Header{}
+	h.Set(SponsorLimitResetHeader, strconv.FormatInt(e.ResetAt.Unix(), 10))
+
+	return h
+}
+
+// userOpGas is the max gas a user op can use
+func userOpGas(op relay.UserOp) uint64 {
+	gas := new(big.Int)
+	for _, g := range []*big.Int{op.CallGasLimit, op.VerificationGasLimit, op.PreVerificationGas} {
+		if g != nil {
+			gas.Add(gas, g)
+		}
+	}
+
+	if !gas.IsUint64() {
+		return ^uint64(0)
+	}
+
+	return gas.Uint64()
+}
+
+// sponsoredGas is the max gas of a number of copies of a user op, it has to fit in the
+// gas accounted for in the sponsorships
+func sponsoredGas(ops int, op relay.UserOp) (uint64, error) {
+	hi, gas := bits.Mul64(uint64(ops), userOpGas(op))
+	if hi != 0 || gas > math.MaxInt64 {
+		return 0, ErrGasTooLarge
+	}
+
+	return gas, nil
+}
+
+// reserve records the sponsorship of ops for an account, failing when it would exceed the limits
+func (s *Service) reserve(paymaster, sender common.Address, ops int, gas uint64) error {
+	if s.limits.Ops <= 0 && s.limits.Gas == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	ok, usage, err := s.db.SponsorshipDB.Reserve(paymaster.Hex(), sender.Hex(), ops, gas, now, s.limits.Window, s.limits.Ops, s.limits.Gas)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		return nil
+	}
+
+	return s.limitError(sender, usage, now)
+}
+
+// checkLimits fails when an account is over its limits without recording anything, ops signed by
+// the relay were already counted when they were sponsored
+func (s *Service) checkLimits(paymaster, sender common.Address) error {
+	if s.limits.Ops <= 0 && s.limits.Gas == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	usage, err := s.db.SponsorshipDB.GetUsage(paymaster.Hex(), sender.Hex(), now.Add(-s.limits.Window))
+	if err != nil {
+		return err
+	}
+
+	if (s.limits.Ops > 0 && usage.Ops > s.limits.Ops) || (s.limits.Gas > 0 && usage.Gas > s.limits.Gas) {
+		return s.limitError(sender, usage, now)
+	}
+
+	return nil
+}
+
+func (s *Service) limitError(sender common.Address, usage *db.SponsorshipUsage, now time.Time) error {
+	// the window slides, the oldest sponsorship is the first one to expire
+	resetAt := now.Add(s.limits.Window)
+	if usage.Oldest != nil {
+		resetAt = usage.Oldest.Add(s.limits.Window)
+	}
+
+	return &SponsorLimitError{Sender: sender.Hex(), ResetAt: resetAt}
+}
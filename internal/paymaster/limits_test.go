@@ -0,0 +1,63 @@
+package paymaster
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestSponsorLimitError(t *testing.T) {
+	resetAt := time.Unix(1700000000, 0)
+
+	var err error = &SponsorLimitError{Sender: "0x5815E61eF72c9E6107b5c5A05FD121F334f7a7f1", ResetAt: resetAt}
+
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != ErrCodeSponsorLimit {
+		t.Fatalf("expected json-rpc error code %d", ErrCodeSponsorLimit)
+	}
+
+	var hErr relay.HeaderError
+	if !errors.As(err, &hErr) {
+		t.Fatal("expected the error to set headers")
+	}
+
+	if v := hErr.Headers().Get(SponsorLimitResetHeader); v != "1700000000" {
+		t.Fatalf("expected reset header 1700000000, got %s", v)
+	}
+}
+
+func TestUserOpGas(t *testing.T) {
+	op := testUserOp(0)
+
+	if gas := userOpGas(op); gas != 250000 {
+		t.Fatalf("expected 250000 gas, got %d", gas)
+	}
+
+	op.CallGasLimit = new(big.Int).Lsh(big.NewInt(1), 80)
+	if gas := userOpGas(op); gas != ^uint64(0) {
+		t.Fatalf("expected gas to saturate, got %d", gas)
+	}
+}
+
+func TestSponsoredGas(t *testing.T) {
+	op := testUserOp(0)
+
+	gas, err := sponsoredGas(10, op)
+	if err != nil || gas != 2500000 {
+		t.Fatalf("expected 2500000 gas, got %d %v", gas, err)
+	}
+
+	op.CallGasLimit = new(big.Int).Lsh(big.NewInt(1), 62)
+	if _, err := sponsoredGas(4, op); !errors.Is(err, ErrGasTooLarge) {
+		t.Fatalf("expected overflowing gas to be rejected, got %v", err)
+	}
+
+	op.CallGasLimit = new(big.Int).Lsh(big.NewInt(1), 80)
+	if _, err := sponsoredGas(1, op); !errors.Is(err, ErrGasTooLarge) {
+		t.Fatalf("expected saturated gas to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package paymaster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	comm "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jackc/pgx/v5"
+)
+
+// wallet type whose execute function takes an extra operation argument
+const walletTypeSafe = "cw-safe"
+
+// validityArgs is the layout of the validity window in the paymaster data
+var validityArgs abi.Arguments
+
+// executeArgs are the leading arguments of execute and execTransactionFromModule
+var executeArgs abi.Arguments
+
+func init() {
+	uint48Ty, _ := abi.NewType("uint48", "uint48", nil)
+
+	validityArgs = abi.Arguments{
+		{Type: uint48Ty}, // validUntil
+		{Type: uint48Ty}, // validAfter
+	}
+
+	addressTy, _ := abi.NewType("address", "address", nil)
+	uint256Ty, _ := abi.NewType("uint256", "uint256", nil)
+	bytesTy, _ := abi.NewType("bytes", "bytes", nil)
+
+	executeArgs = abi.Arguments{
+		{Type: addressTy}, // dest
+		{Type: uint256Ty}, // value
+		{Type: bytesTy},   // func
+	}
+}
+
+// CheckCallData checks that the call data only calls the account functions sponsored by this relay
+func CheckCallData(callData []byte, walletType string) error {
+	if len(callData) < 4 {
+		return errors.New("error call data is too short")
+	}
+
+	// verify the calldata, it should only be allowed to contain the function signatures we allow
+	funcSig := callData[:4]
+	if !bytes.Equal(funcSig, relay.FuncSigSingle) && !bytes.Equal(funcSig, relay.FuncSigBatch) && !bytes.Equal(funcSig, relay.FuncSigSafeExecFromModule) {
+		return errors.New("error invalid function signature. supported signatures: execute, executeBatch, execTransactionFromModule")
+	}
+
+	addressArg, _ := abi.NewType("address", "address", nil)
+	uint256Arg, _ := abi.NewType("uint256", "uint256", nil)
+	bytesArg, _ := abi.NewType("bytes", "bytes", nil)
+	callArgs := abi.Arguments{
+		abi.Argument{
+			Type: addressArg,
+		},
+		abi.Argument{
+			Type: uint256Arg,
+		},
+		abi.Argument{
+			Type: bytesArg,
+		},
+	}
+	if walletType == walletTypeSafe {
+		operationArg, _ := abi.NewType("uint8", "uint8", nil)
+
+		callArgs = append(callArgs, abi.Argument{
+			Type: operationArg,
+		})
+	}
+
+	// Unpack the values
+	callValues, err := callArgs.Unpack(callData[4:])
+	if err != nil {
+		return err
+	}
+
+	// destination address
+	_, ok := callValues[0].(common.Address)
+	if !ok {
+		return errors.New("error invalid destination address")
+	}
+
+	// value in uint256
+	_, ok = callValues[1].(*big.Int)
+	if !ok {
+		// shouldn't have any value
+		return errors.New("error invalid call value")
+	}
+
+	// data in bytes
+	_, ok = callValues[2].([]byte)
+	if !ok {
+		return errors.New("error invalid call data")
+	}
+
+	return nil
+}
+
+// checkInitCode checks that only new accounts are deployed and only from factories curated by the operator
+func (s *Service) checkInitCode(userop relay.UserOp) error {
+	// get nonce using the account factory since we are not sure if the account has been created yet
+	nonce := userop.Nonce
+	if nonce == nil {
+		return errors.New("error nonce is missing")
+	}
+
+	// verify the init code
+	initCode := hexutil.Encode(userop.InitCode)
+
+	// if the nonce is not 0, then the init code should be empty
+	if nonce.Cmp(big.NewInt(0)) == 1 && initCode != "0x" {
+		return errors.New("error init code is not empty even though nonce is not 0")
+	}
+
+	// if the nonce is 0, then check that the factory exists
+	if nonce.Cmp(big.NewInt(0)) == 0 && len(userop.InitCode) > 20 {
+		factoryaddr := common.BytesToAddress(userop.InitCode[:20])
+
+		// Get the contract's bytecode
+		bytecode, err := s.evm.CodeAt(context.Background(), factoryaddr, nil)
+		if err != nil {
+			return err
+		}
+
+		// Check if the contract is deployed
+		if len(bytecode) == 0 {
+			return errors.New("error factory contract not found")
+		}
+
+		// only accounts from factories curated by the operator can be deployed
+		allowed, err := s.db.FactoryDB.FactoryExists(factoryaddr.Hex())
+		if err != nil {
+			return err
+		}
+
+		if !allowed {
+			return errors.New("error factory is not allowed")
+		}
+	}
+
+	return nil
+}
+
+// Verify checks a user op that is submitted without going through Sponsor: its paymaster data must be
+// signed by the sponsor of the paymaster and still valid, and the op must pass the same policy
+func (s *Service) Verify(addr common.Address, userop relay.UserOp) error {
+	return s.deny(MethodSend, addr, userop, s.verify(addr, userop))
+}
+
+func (s *Service) verify(addr common.Address, userop relay.UserOp) error {
+	if len(userop.PaymasterAndData) < 84+crypto.SignatureLength {
+		return errors.New("invalid paymaster data")
+	}
+
+	validity, err := validityArgs.Unpack(userop.PaymasterAndData[20:84])
+	if err != nil {
+		return err
+	}
+
+	validUntil, ok := validity[0].(*big.Int)
+	if !ok {
+		return errors.New("error unmarshalling validity")
+	}
+
+	validAfter, ok := validity[1].(*big.Int)
+	if !ok {
+		return errors.New("error unmarshalling validity")
+	}
+
+	// check if the signature is theoretically still valid
+	now := time.Now().Unix()
+	if validUntil.Int64() < now {
+		return errors.New("paymaster signature has expired")
+	}
+
+	if validAfter.Int64() > now {
+		return errors.New("paymaster signature is not valid yet")
+	}
+
+	hash, err := s.hasher.Hash(addr, userop, validUntil, validAfter)
+	if err != nil {
+		return err
+	}
+
+	// Convert the hash to an Ethereum signed message hash
+	hhash := accounts.TextHash(hash[:])
+
+	sig := make([]byte, len(userop.PaymasterAndData[84:]))
+	copy(sig, userop.PaymasterAndData[84:])
+
+	// update the signature v to undo the 27/28 addition
+	sig[crypto.RecoveryIDOffset] -= 27
+
+	// recover the public key from the signature
+	sigPublicKey, err := crypto.Ecrecover(hhash, sig)
+	if err != nil {
+		return errors.New("error recovering public key")
+	}
+
+	// fetch the sponsor's corresponding private key from the db
+	sponsorKey, err := s.db.SponsorDB.GetSponsor(addr.Hex())
+	if err == pgx.ErrNoRows {
+		return errors.New("paymaster is not sponsored by this relay")
+	}
+	if err != nil {
+		return errors.New("error getting sponsor key")
+	}
+
+	// Generate ecdsa.PrivateKey from bytes
+	privateKey, err := comm.HexToPrivateKey(sponsorKey.SigningKey())
+	if err != nil {
+		return errors.New("error converting private key")
+	}
+
+	if !bytes.Equal(sigPublicKey, crypto.FromECDSAPub(&privateKey.PublicKey)) {
+		return errors.New("paymaster signature does not match")
+	}
+
+	err = s.checkInitCode(userop)
+	if err != nil {
+		return err
+	}
+
+	// the wallet type is not part of the user op, either call layout is accepted
+	err = CheckCallData(userop.CallData, "")
+	if err != nil && CheckCallData(userop.CallData, walletTypeSafe) != nil {
+		return err
+	}
+
+	return s.checkLimits(addr, userop.Sender)
+}
@@ -0,0 +1,48 @@
+package paymaster
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestCheckCallData(t *testing.T) {
+	addressTy, _ := abi.NewType("address", "address", nil)
+	uint256Ty, _ := abi.NewType("uint256", "uint256", nil)
+	bytesTy, _ := abi.NewType("bytes", "bytes", nil)
+	uint8Ty, _ := abi.NewType("uint8", "uint8", nil)
+
+	to := common.HexToAddress("0x5815E61eF72c9E6107b5c5A05FD121F334f7a7f1")
+
+	args, err := abi.Arguments{{Type: addressTy}, {Type: uint256Ty}, {Type: bytesTy}}.Pack(to, big.NewInt(0), []byte{0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	safeArgs, err := abi.Arguments{{Type: addressTy}, {Type: uint256Ty}, {Type: bytesTy}, {Type: uint8Ty}}.Pack(to, big.NewInt(0), []byte{0x01}, uint8(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckCallData(append(append([]byte{}, relay.FuncSigSingle...), args...), ""); err != nil {
+		t.Fatalf("expected execute to be allowed, got %v", err)
+	}
+
+	if err := CheckCallData(append(append([]byte{}, relay.FuncSigSafeExecFromModule...), safeArgs...), walletTypeSafe); err != nil {
+		t.Fatalf("expected execTransactionFromModule to be allowed, got %v", err)
+	}
+
+	err = CheckCallData(append([]byte{0xde, 0xad, 0xbe, 0xef}, args...), "")
+	if err == nil || !strings.Contains(err.Error(), "invalid function signature") {
+		t.Fatalf("expected other functions to be rejected, got %v", err)
+	}
+
+	err = CheckCallData([]byte{0x01}, "")
+	if err == nil || !strings.Contains(err.Error(), "too short") {
+		t.Fatalf("expected short call data to be rejected, got %v", err)
+	}
+}
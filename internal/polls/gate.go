@@ -0,0 +1,106 @@
+package polls
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/citizenwallet/smartcontracts/pkg/contracts/account"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// returned by isValidSignature for a valid EIP-1271 signature
+var magicValue = [4]byte{0x16, 0x26, 0xba, 0x7e}
+
+// EVM reads the chain to check the balances and accounts of voters on gated polls
+type EVM interface {
+	Backend() bind.ContractBackend
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+	LatestBlock() (*big.Int, error)
+	CallContract(call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// AccountMessage is the message an account signs to vote on a gated poll for a voter
+func AccountMessage(pollID, pubkey string) []byte {
+	return []byte(pollID + ":" + pubkey)
+}
+
+// checkGate checks that the account of a vote is controlled by the voter and held enough tokens at the snapshot
+func (s *Service) checkGate(ctx context.Context, p *Poll, v *Vote) error {
+	ok, err := s.verifyAccount(ctx, *v.Account, accounts.TextHash(AccountMessage(p.Event.ID, v.Event.PubKey)), v.Signature)
+	if err != nil {
+		log.Printf("Error verifying account signature: %v", err)
+		return errors.New("could not verify the account signature")
+	}
+
+	if !ok {
+		return errors.New("account signature is not valid for this vote")
+	}
+
+	balance, err := com.BalanceOf(s.evm, p.Gate.Token, *v.Account, p.Gate.Block)
+	if err != nil {
+		log.Printf("Error getting balance: %v", err)
+		return errors.New("could not get the balance of the account")
+	}
+
+	if balance.Cmp(p.Gate.MinBalance) < 0 {
+		return errors.New("account did not hold enough tokens at the poll snapshot")
+	}
+
+	return nil
+}
+
+// verifyAccount checks a personal_sign signature of an externally owned account, or of a deployed
+// account with EIP-1271
+func (s *Service) verifyAccount(ctx context.Context, addr common.Address, hash, signature []byte) (bool, error) {
+	if len(signature) != crypto.SignatureLength {
+		return false, nil
+	}
+
+	signer, err := com.RecoverPersonalSign(hash, signature)
+	if err == nil && signer == addr {
+		return true, nil
+	}
+
+	bytecode, err := s.evm.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return false, err
+	}
+
+	// not an externally owned account and not deployed
+	if len(bytecode) == 0 {
+		return false, nil
+	}
+
+	acc, err := account.NewAccount(addr, s.evm.Backend())
+	if err != nil {
+		return false, err
+	}
+
+	var h32 [32]byte
+	copy(h32[:], hash)
+
+	v, err := acc.IsValidSignature(&bind.CallOpts{Context: ctx}, h32, signature)
+	if err != nil {
+		// accounts that don't implement EIP-1271 can't vote
+		return false, nil
+	}
+
+	return v == magicValue, nil
+}
+
+func decodeHex(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") {
+		s = "0x" + s
+	}
+
+	return hexutil.Decode(s)
+}
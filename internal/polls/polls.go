@@ -0,0 +1,458 @@
+// Package polls counts the votes on polls posted into groups (NIP-88).
+//
+// A poll is a kind 1068 event with an h tag, the question as content and at least two options:
+//
+//	["option", "<option id>", "<label>"]
+//	["polltype", "singlechoice" | "multiplechoice"]  defaults to singlechoice
+//	["endsAt", "<unix timestamp>"]                   optional cutoff, votes after it are rejected
+//	["gate", "<erc20 address>", "<min balance>", "<block number>"]
+//
+// A vote is a kind 1018 event with the h tag of the group, an e tag with the id of the poll and a
+// response tag per chosen option. Each member votes once, later votes are rejected.
+//
+// Polls with a gate tag only accept votes of members holding at least the minimum balance of the
+// token at the snapshot block. The vote names the account holding the tokens in an account tag,
+// signed by the account with personal_sign over "<poll id>:<voter pubkey>":
+//
+//	["account", "<address>", "<hex signature>"]
+//
+// Deployed accounts are checked with EIP-1271, an account votes once whoever it is linked to.
+//
+// The relay publishes the result as a kind 39032 tally event with the poll id as d tag, replaced
+// as votes are counted.
+package polls
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/big"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/fiatjaf/eventstore"
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	KindPoll     = 1068
+	KindVote     = 1018
+	KindTally    = 39032 // Relay-generated tally of a group poll
+	PollTypeOne  = "singlechoice"
+	PollTypeMany = "multiplechoice"
+)
+
+// Publisher signs and stores events authored by the relay
+type Publisher interface {
+	SignAndReplaceEvent(ctx context.Context, ev *nostr.Event) (*nostr.Event, error)
+}
+
+// Gate restricts the votes on a poll to holders of a token balance at a snapshot block
+type Gate struct {
+	Token      common.Address
+	MinBalance *big.Int
+	Block      *big.Int
+}
+
+// Poll is a group poll
+type Poll struct {
+	Event   *nostr.Event
+	GroupID string
+	Options []string
+	Type    string
+	EndsAt  *time.Time
+	Gate    *Gate
+}
+
+// Vote is a vote on a group poll
+type Vote struct {
+	Event     *nostr.Event
+	GroupID   string
+	PollID    string
+	Responses []string
+	Account   *common.Address
+	Signature []byte
+}
+
+// ParsePoll reads a group poll, an error means the poll is invalid
+func ParsePoll(ev *nostr.Event) (*Poll, error) {
+	p := &Poll{
+		Event:   ev,
+		GroupID: tagValue(ev, "h"),
+		Type:    PollTypeOne,
+	}
+
+	if p.GroupID == "" {
+		return nil, errors.New("poll must be posted into a group")
+	}
+
+	if ev.Content == "" {
+		return nil, errors.New("poll must have a question")
+	}
+
+	for _, tag := range ev.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+
+		switch tag[0] {
+		case "option":
+			if len(tag) < 3 || tag[1] == "" || slices.Contains(p.Options, tag[1]) {
+				return nil, errors.New("poll options must have a unique id and a label")
+			}
+			p.Options = append(p.Options, tag[1])
+		case "polltype":
+			if tag[1] != PollTypeOne && tag[1] != PollTypeMany {
+				return nil, errors.New("poll type must be singlechoice or multiplechoice")
+			}
+			p.Type = tag[1]
+		case "endsAt":
+			ts, err := strconv.ParseInt(tag[1], 10, 64)
+			if err != nil {
+				return nil, errors.New("poll end must be a unix timestamp")
+			}
+			endsAt := time.Unix(ts, 0)
+			p.EndsAt = &endsAt
+		case "gate":
+			gate, err := parseGate(tag)
+			if err != nil {
+				return nil, err
+			}
+			p.Gate = gate
+		}
+	}
+
+	if len(p.Options) < 2 {
+		return nil, errors.New("poll must have at least two options")
+	}
+
+	return p, nil
+}
+
+func parseGate(tag nostr.Tag) (*Gate, error) {
+	if len(tag) < 4 || !common.IsHexAddress(tag[1]) {
+		return nil, errors.New("poll gate must have a token address, a minimum balance and a block")
+	}
+
+	min, ok := new(big.Int).SetString(tag[2], 10)
+	if !ok || min.Sign() <= 0 {
+		return nil, errors.New("poll gate minimum balance must be a positive integer")
+	}
+
+	block, ok := new(big.Int).SetString(tag[3], 10)
+	if !ok || block.Sign() < 0 {
+		return nil, errors.New("poll gate block must be a block number")
+	}
+
+	return &Gate{Token: common.HexToAddress(tag[1]), MinBalance: min, Block: block}, nil
+}
+
+// ParseVote reads a vote on a group poll, the responses are checked against the poll separately
+func ParseVote(ev *nostr.Event) (*Vote, error) {
+	v := &Vote{
+		Event:   ev,
+		GroupID: tagValue(ev, "h"),
+		PollID:  tagValue(ev, "e"),
+	}
+
+	if v.GroupID == "" {
+		return nil, errors.New("vote must be posted into a group")
+	}
+
+	if v.PollID == "" {
+		return nil, errors.New("vote must refer to a poll with an e tag")
+	}
+
+	for _, tag := range ev.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+
+		switch tag[0] {
+		case "response":
+			if slices.Contains(v.Responses, tag[1]) {
+				return nil, errors.New("vote responses must be unique")
+			}
+			v.Responses = append(v.Responses, tag[1])
+		case "account":
+			if len(tag) < 3 || !common.IsHexAddress(tag[1]) {
+				return nil, errors.New("vote account must have an address and a signature")
+			}
+
+			sig, err := decodeHex(tag[2])
+			if err != nil {
+				return nil, errors.New("vote account signature must be hex")
+			}
+
+			account := common.HexToAddress(tag[1])
+			v.Account = &account
+			v.Signature = sig
+		}
+	}
+
+	if len(v.Responses) == 0 {
+		return nil, errors.New("vote must have a response")
+	}
+
+	return v, nil
+}
+
+// check checks that a vote answers the poll
+func (p *Poll) check(v *Vote, now time.Time) error {
+	if v.GroupID != p.GroupID {
+		return errors.New("vote must be posted into the group of the poll")
+	}
+
+	if p.EndsAt != nil && now.After(*p.EndsAt) {
+		return errors.New("poll has ended")
+	}
+
+	if p.Type == PollTypeOne && len(v.Responses) != 1 {
+		return errors.New("poll only accepts one response")
+	}
+
+	for _, r := range v.Responses {
+		if !slices.Contains(p.Options, r) {
+			return errors.New("vote response is not an option of the poll")
+		}
+	}
+
+	if p.Gate != nil && v.Account == nil {
+		return errors.New("poll is gated, vote must name the account holding the tokens")
+	}
+
+	return nil
+}
+
+type Service struct {
+	store eventstore.Store
+	db    *db.DB
+	evm   EVM
+	n     Publisher
+
+	now func() time.Time
+}
+
+// NewService creates a polls service, gated polls are rejected without an evm client
+func NewService(store eventstore.Store, d *db.DB, evm EVM, n Publisher) *Service {
+	return &Service{
+		store: store,
+		db:    d,
+		evm:   evm,
+		n:     n,
+		now:   time.Now,
+	}
+}
+
+// AddHooks registers the poll hooks on the relay, membership is enforced by the groups hook
+func (s *Service) AddHooks(relay *khatru.Relay) {
+	relay.RejectEvent = append(relay.RejectEvent, s.RejectEvent)
+	relay.OnEventSaved = append(relay.OnEventSaved, s.OnEventSaved)
+}
+
+// RejectEvent validates group polls and votes, polls and votes outside of groups are not checked
+func (s *Service) RejectEvent(ctx context.Context, ev *nostr.Event) (bool, string) {
+	if tagValue(ev, "h") == "" {
+		return false, ""
+	}
+
+	switch ev.Kind {
+	case KindPoll:
+		return s.rejectPoll(ctx, ev)
+	case KindVote:
+		return s.rejectVote(ctx, ev)
+	}
+
+	return false, ""
+}
+
+func (s *Service) rejectPoll(ctx context.Context, ev *nostr.Event) (bool, string) {
+	p, err := ParsePoll(ev)
+	if err != nil {
+		return true, "invalid: " + err.Error()
+	}
+
+	if p.EndsAt != nil && !p.EndsAt.After(s.now()) {
+		return true, "invalid: poll must end in the future"
+	}
+
+	if p.Gate != nil {
+		if s.evm == nil {
+			return true, "blocked: token gated polls are not supported by this relay"
+		}
+
+		latest, err := s.evm.LatestBlock()
+		if err != nil {
+			log.Printf("Error getting latest block: %v", err)
+			return true, "error: could not check the snapshot block"
+		}
+
+		// the snapshot must be taken before votes can be cast, otherwise balances could still move
+		if p.Gate.Block.Cmp(latest) > 0 {
+			return true, "invalid: poll gate block must not be in the future"
+		}
+	}
+
+	return false, ""
+}
+
+func (s *Service) rejectVote(ctx context.Context, ev *nostr.Event) (bool, string) {
+	v, err := ParseVote(ev)
+	if err != nil {
+		return true, "invalid: " + err.Error()
+	}
+
+	p, err := s.poll(ctx, v.PollID)
+	if err != nil {
+		log.Printf("Error getting poll: %v", err)
+		return true, "error: could not get the poll"
+	}
+
+	if p == nil {
+		return true, "invalid: poll not found"
+	}
+
+	err = p.check(v, s.now())
+	if err != nil {
+		return true, "invalid: " + err.Error()
+	}
+
+	account := ""
+	if p.Gate != nil {
+		account = v.Account.Hex()
+	}
+
+	voted, err := s.db.PollVoteDB.HasVoted(p.Event.ID, ev.PubKey, account)
+	if err != nil {
+		log.Printf("Error checking votes: %v", err)
+		return true, "error: could not check previous votes"
+	}
+
+	if voted {
+		return true, "duplicate: already voted on this poll"
+	}
+
+	if p.Gate != nil {
+		if s.evm == nil {
+			return true, "blocked: token gated polls are not supported by this relay"
+		}
+
+		err = s.checkGate(ctx, p, v)
+		if err != nil {
+			return true, "restricted: " + err.Error()
+		}
+	}
+
+	return false, ""
+}
+
+// OnEventSaved counts saved votes and publishes the tally of their poll
+func (s *Service) OnEventSaved(ctx context.Context, ev *nostr.Event) {
+	if tagValue(ev, "h") == "" {
+		return
+	}
+
+	switch ev.Kind {
+	case KindPoll:
+		p, err := ParsePoll(ev)
+		if err != nil {
+			return
+		}
+
+		s.publishTally(ctx, p)
+	case KindVote:
+		v, err := ParseVote(ev)
+		if err != nil {
+			return
+		}
+
+		p, err := s.poll(ctx, v.PollID)
+		if err != nil || p == nil {
+			log.Printf("Error getting poll %s: %v", v.PollID, err)
+			return
+		}
+
+		vote := &relay.PollVote{
+			PollID:    p.Event.ID,
+			Pubkey:    ev.PubKey,
+			Options:   v.Responses,
+			EventID:   ev.ID,
+			CreatedAt: ev.CreatedAt.Time().UTC(),
+		}
+		if p.Gate != nil {
+			vote.Account = v.Account.Hex()
+		}
+
+		// concurrent votes of the same member can both pass validation, only the first one counts
+		counted, err := s.db.PollVoteDB.AddVote(vote)
+		if err != nil {
+			log.Printf("Error counting vote: %v", err)
+			return
+		}
+
+		if counted {
+			s.publishTally(ctx, p)
+		}
+	}
+}
+
+// poll returns a group poll by id, nil if there is none
+func (s *Service) poll(ctx context.Context, id string) (*Poll, error) {
+	events, err := s.store.QueryEvents(ctx, nostr.Filter{IDs: []string{id}, Kinds: []int{KindPoll}, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+
+	for ev := range events {
+		p, err := ParsePoll(ev)
+		if err != nil {
+			return nil, nil
+		}
+
+		return p, nil
+	}
+
+	return nil, nil
+}
+
+// publishTally replaces the tally event of a poll with the votes counted so far
+func (s *Service) publishTally(ctx context.Context, p *Poll) {
+	tally, voters, err := s.db.PollVoteDB.GetTally(p.Event.ID)
+	if err != nil {
+		log.Printf("Error getting tally: %v", err)
+		return
+	}
+
+	ev := &nostr.Event{
+		Kind:      KindTally,
+		CreatedAt: nostr.Timestamp(s.now().Unix()),
+		Tags: nostr.Tags{
+			{"d", p.Event.ID},
+			{"e", p.Event.ID},
+			{"h", p.GroupID},
+		},
+	}
+
+	for _, option := range p.Options {
+		ev.Tags = append(ev.Tags, nostr.Tag{"tally", option, strconv.Itoa(tally[option])})
+	}
+	ev.Tags = append(ev.Tags, nostr.Tag{"voters", strconv.Itoa(voters)})
+
+	_, err = s.n.SignAndReplaceEvent(ctx, ev)
+	if err != nil {
+		log.Printf("Error publishing tally: %v", err)
+	}
+}
+
+func tagValue(ev *nostr.Event, name string) string {
+	tag := ev.Tags.GetFirst([]string{name, ""})
+	if tag != nil && len(*tag) >= 2 {
+		return (*tag)[1]
+	}
+	return ""
+}
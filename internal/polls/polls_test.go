@@ -0,0 +1,216 @@
+package polls
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type fakeEVM struct {
+	latest   int64
+	balances map[common.Address]*big.Int
+	block    *big.Int // block of the last balance read
+}
+
+func (e *fakeEVM) Backend() bind.ContractBackend {
+	return nil
+}
+
+func (e *fakeEVM) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return nil, nil
+}
+
+func (e *fakeEVM) LatestBlock() (*big.Int, error) {
+	return big.NewInt(e.latest), nil
+}
+
+func (e *fakeEVM) CallContract(call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	e.block = blockNumber
+
+	balance, ok := e.balances[common.BytesToAddress(call.Data[4:])]
+	if !ok {
+		balance = big.NewInt(0)
+	}
+
+	return common.LeftPadBytes(balance.Bytes(), 32), nil
+}
+
+func pollEvent(tags ...nostr.Tag) *nostr.Event {
+	return &nostr.Event{
+		ID:      "poll",
+		Kind:    KindPoll,
+		Content: "Lunch?",
+		Tags:    append(nostr.Tags{{"h", "group"}, {"option", "yes", "Yes"}, {"option", "no", "No"}}, tags...),
+	}
+}
+
+func voteEvent(tags ...nostr.Tag) *nostr.Event {
+	return &nostr.Event{
+		Kind:   KindVote,
+		PubKey: "voter",
+		Tags:   append(nostr.Tags{{"h", "group"}, {"e", "poll"}}, tags...),
+	}
+}
+
+func TestParsePoll(t *testing.T) {
+	p, err := ParsePoll(pollEvent(nostr.Tag{"polltype", PollTypeMany}, nostr.Tag{"endsAt", "1740853800"}, nostr.Tag{"gate", "0x5FbDB2315678afecb367f032d93F642f64180aa3", "100", "42"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Type != PollTypeMany || len(p.Options) != 2 || p.EndsAt.Unix() != 1740853800 || p.Gate.Block.Int64() != 42 || p.Gate.MinBalance.Int64() != 100 {
+		t.Fatalf("unexpected poll %+v", p)
+	}
+
+	for name, ev := range map[string]*nostr.Event{
+		"no group":          {Kind: KindPoll, Content: "Lunch?", Tags: nostr.Tags{{"option", "yes", "Yes"}, {"option", "no", "No"}}},
+		"no question":       {Kind: KindPoll, Tags: nostr.Tags{{"h", "group"}, {"option", "yes", "Yes"}, {"option", "no", "No"}}},
+		"one option":        {Kind: KindPoll, Content: "Lunch?", Tags: nostr.Tags{{"h", "group"}, {"option", "yes", "Yes"}}},
+		"duplicate option":  pollEvent(nostr.Tag{"option", "yes", "Sure"}),
+		"unknown poll type": pollEvent(nostr.Tag{"polltype", "ranked"}),
+		"invalid end":       pollEvent(nostr.Tag{"endsAt", "tomorrow"}),
+		"invalid gate":      pollEvent(nostr.Tag{"gate", "0x5FbDB2315678afecb367f032d93F642f64180aa3", "0", "42"}),
+	} {
+		_, err := ParsePoll(ev)
+		if err == nil {
+			t.Errorf("%s: expected the poll to be invalid", name)
+		}
+	}
+}
+
+func TestCheckVote(t *testing.T) {
+	now := time.Unix(1740853800, 0)
+
+	single, err := ParsePoll(pollEvent(nostr.Tag{"endsAt", "1740853900"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	many, err := ParsePoll(pollEvent(nostr.Tag{"polltype", PollTypeMany}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		poll  *Poll
+		vote  *nostr.Event
+		now   time.Time
+		valid bool
+	}{
+		{"single", single, voteEvent(nostr.Tag{"response", "yes"}), now, true},
+		{"after the end", single, voteEvent(nostr.Tag{"response", "yes"}), now.Add(time.Hour), false},
+		{"two responses", single, voteEvent(nostr.Tag{"response", "yes"}, nostr.Tag{"response", "no"}), now, false},
+		{"unknown option", single, voteEvent(nostr.Tag{"response", "maybe"}), now, false},
+		{"many", many, voteEvent(nostr.Tag{"response", "yes"}, nostr.Tag{"response", "no"}), now, true},
+		{"other group", many, &nostr.Event{Kind: KindVote, Tags: nostr.Tags{{"h", "other"}, {"e", "poll"}, {"response", "yes"}}}, now, false},
+	} {
+		v, err := ParseVote(tc.vote)
+		if err == nil {
+			err = tc.poll.check(v, tc.now)
+		}
+
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: expected valid=%t, got %v", tc.name, tc.valid, err)
+		}
+	}
+
+	for name, ev := range map[string]*nostr.Event{
+		"no poll":            {Kind: KindVote, Tags: nostr.Tags{{"h", "group"}, {"response", "yes"}}},
+		"no response":        voteEvent(),
+		"duplicate response": voteEvent(nostr.Tag{"response", "yes"}, nostr.Tag{"response", "yes"}),
+		"invalid account":    voteEvent(nostr.Tag{"response", "yes"}, nostr.Tag{"account", "0x1234", "0x00"}),
+	} {
+		_, err := ParseVote(ev)
+		if err == nil {
+			t.Errorf("%s: expected the vote to be invalid", name)
+		}
+	}
+}
+
+func TestRejectGatedPoll(t *testing.T) {
+	s := NewService(nil, nil, &fakeEVM{latest: 100}, nil)
+
+	reject, _ := s.RejectEvent(context.Background(), pollEvent(nostr.Tag{"gate", "0x5FbDB2315678afecb367f032d93F642f64180aa3", "1", "100"}))
+	if reject {
+		t.Fatal("expected a snapshot at the latest block to be accepted")
+	}
+
+	reject, _ = s.RejectEvent(context.Background(), pollEvent(nostr.Tag{"gate", "0x5FbDB2315678afecb367f032d93F642f64180aa3", "1", "101"}))
+	if !reject {
+		t.Fatal("expected a snapshot in the future to be rejected")
+	}
+
+	s = NewService(nil, nil, nil, nil)
+
+	reject, _ = s.RejectEvent(context.Background(), pollEvent(nostr.Tag{"gate", "0x5FbDB2315678afecb367f032d93F642f64180aa3", "1", "1"}))
+	if !reject {
+		t.Fatal("expected gated polls to be rejected without an evm client")
+	}
+}
+
+func TestCheckGate(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder := crypto.PubkeyToAddress(key.PublicKey)
+
+	evm := &fakeEVM{balances: map[common.Address]*big.Int{holder: big.NewInt(100)}}
+	s := NewService(nil, nil, evm, nil)
+
+	p, err := ParsePoll(pollEvent(nostr.Tag{"gate", "0x5FbDB2315678afecb367f032d93F642f64180aa3", "100", "42"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(pubkey string) string {
+		sig, err := crypto.Sign(accounts.TextHash(AccountMessage("poll", pubkey)), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig[crypto.RecoveryIDOffset] += 27
+
+		return hexutil.Encode(sig)
+	}
+
+	vote := func(account, sig string) *Vote {
+		v, err := ParseVote(voteEvent(nostr.Tag{"response", "yes"}, nostr.Tag{"account", account, sig}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	err = s.checkGate(context.Background(), p, vote(holder.Hex(), sign("voter")))
+	if err != nil {
+		t.Fatalf("expected the holder to vote, got %v", err)
+	}
+
+	if evm.block.Int64() != 42 {
+		t.Fatalf("expected the balance at the snapshot, got block %s", evm.block)
+	}
+
+	// a signature made for another voter can't be reused
+	err = s.checkGate(context.Background(), p, vote(holder.Hex(), sign("other")))
+	if err == nil {
+		t.Fatal("expected a signature for another voter to be rejected")
+	}
+
+	evm.balances[holder] = big.NewInt(99)
+
+	err = s.checkGate(context.Background(), p, vote(holder.Hex(), sign("voter")))
+	if err == nil {
+		t.Fatal("expected a balance below the minimum to be rejected")
+	}
+}
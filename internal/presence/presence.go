@@ -0,0 +1,347 @@
+// Package presence relays the online and typing indicators of group members.
+//
+// A member sends an ephemeral event of KindPresence with the h tag of a group and a status tag,
+// online, typing or offline. The relay fans it out to the subscribers that are members of the
+// group and never stores it. The latest indicator of each member is kept in memory until it
+// expires, so that a subscription to the presence of a group starts with who is currently online
+// or typing. Clients refresh their indicators before they expire and treat the ones they received
+// as expired after the same time.
+//
+// Members can't send indicators to a group more often than the configured interval, except for
+// offline which is always accepted.
+package presence
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const KindPresence = 20029
+
+const (
+	StatusOnline  = "online"
+	StatusTyping  = "typing"
+	StatusOffline = "offline"
+)
+
+// how often expired indicators are forgotten
+const sweepInterval = time.Minute
+
+// Members tells whether a pubkey is a member of a group
+type Members interface {
+	IsMember(ctx context.Context, pubkey, groupID string) (bool, error)
+}
+
+// member is the presence of a member in a group
+type member struct {
+	ev      *nostr.Event // latest indicator, nil once offline
+	expires time.Time
+	sent    time.Time // when the member last sent an indicator, for rate limiting
+}
+
+type Service struct {
+	members   Members
+	ttl       time.Duration
+	typingTTL time.Duration
+	interval  time.Duration
+	now       func() time.Time
+
+	mu     sync.Mutex
+	groups map[string]map[string]*member // by group and pubkey
+}
+
+func NewService(members Members, ttl, typingTTL, interval time.Duration) *Service {
+	return &Service{
+		members:   members,
+		ttl:       ttl,
+		typingTTL: typingTTL,
+		interval:  interval,
+		now:       time.Now,
+		groups:    map[string]map[string]*member{},
+	}
+}
+
+// AddHooks relays presence to members only, it is meant to be added whichever hooks are enabled
+// so that presence never reaches non-members by disabling one
+func (s *Service) AddHooks(relay *khatru.Relay) {
+	relay.RejectEvent = append(relay.RejectEvent, s.RejectEvent)
+	relay.RejectFilter = append(relay.RejectFilter, s.RejectFilter)
+	relay.OnEphemeralEvent = append(relay.OnEphemeralEvent, s.OnEphemeralEvent)
+	relay.PreventBroadcast = append(relay.PreventBroadcast, s.PreventBroadcast)
+	relay.QueryEvents = append(relay.QueryEvents, s.QueryEvents)
+}
+
+// Status returns the status of a presence event
+func Status(ev *nostr.Event) string {
+	tag := ev.Tags.Find("status")
+	if tag == nil {
+		return ""
+	}
+
+	return tag[1]
+}
+
+// RejectEvent only accepts presence sent by members to their groups, at most once per interval
+func (s *Service) RejectEvent(ctx context.Context, ev *nostr.Event) (bool, string) {
+	if ev.Kind != KindPresence || khatru.IsInternalCall(ctx) {
+		return false, ""
+	}
+
+	groupID := groupOf(ev)
+	if groupID == "" {
+		return true, "invalid: presence must be sent to a group"
+	}
+
+	status := Status(ev)
+	if !slices.Contains([]string{StatusOnline, StatusTyping, StatusOffline}, status) {
+		return true, fmt.Sprintf("invalid: unknown presence status %q", status)
+	}
+
+	now := s.now()
+	if ev.CreatedAt.Time().Before(now.Add(-s.ttl)) {
+		return true, "invalid: presence is already expired"
+	}
+
+	isMember, err := s.members.IsMember(ctx, ev.PubKey, groupID)
+	if err != nil {
+		log.Default().Printf("failed to check the membership of %s in %s: %v", ev.PubKey, groupID, err)
+		return true, "error: failed to check the membership of the group"
+	}
+
+	if !isMember {
+		return true, "restricted: only members can send their presence to a group"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.member(groupID, ev.PubKey)
+	if status != StatusOffline && now.Sub(m.sent) < s.interval {
+		return true, fmt.Sprintf("rate-limited: presence can be sent to a group every %s", s.interval)
+	}
+
+	m.sent = now
+
+	return false, ""
+}
+
+// OnEphemeralEvent keeps the latest indicator of a member until it expires
+func (s *Service) OnEphemeralEvent(ctx context.Context, ev *nostr.Event) {
+	if ev.Kind != KindPresence {
+		return
+	}
+
+	groupID := groupOf(ev)
+	if groupID == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.member(groupID, ev.PubKey)
+
+	// indicators can arrive out of order, from different connections
+	if m.ev != nil && ev.CreatedAt < m.ev.CreatedAt {
+		return
+	}
+
+	ttl := s.ttl
+	switch Status(ev) {
+	case StatusOffline:
+		m.ev = nil
+		return
+	case StatusTyping:
+		ttl = s.typingTTL
+	}
+
+	// a clock ahead of the relay doesn't keep an indicator for longer
+	from := s.now()
+	if t := ev.CreatedAt.Time(); t.Before(from) {
+		from = t
+	}
+
+	m.ev = ev
+	m.expires = from.Add(ttl)
+}
+
+// RejectFilter only allows members to subscribe to the presence of their groups
+func (s *Service) RejectFilter(ctx context.Context, filter nostr.Filter) (bool, string) {
+	if !slices.Contains(filter.Kinds, KindPresence) {
+		return false, ""
+	}
+
+	groupIDs := filter.Tags["h"]
+	if len(groupIDs) == 0 {
+		return true, "invalid: presence can only be requested for a group"
+	}
+
+	pubkey := khatru.GetAuthed(ctx)
+	if pubkey == "" {
+		khatru.RequestAuth(ctx)
+		return true, "auth-required: presence is only visible to members"
+	}
+
+	for _, groupID := range groupIDs {
+		isMember, err := s.members.IsMember(ctx, pubkey, groupID)
+		if err != nil {
+			log.Default().Printf("failed to check the membership of %s in %s: %v", pubkey, groupID, err)
+			return true, "error: failed to check the membership of the group"
+		}
+
+		if !isMember {
+			return true, "restricted: only members can see the presence of a group"
+		}
+	}
+
+	return false, ""
+}
+
+// PreventBroadcast only sends presence to the members of the group
+func (s *Service) PreventBroadcast(ws *khatru.WebSocket, ev *nostr.Event) bool {
+	if ev.Kind != KindPresence {
+		return false
+	}
+
+	if ws.AuthedPublicKey == "" {
+		return true
+	}
+
+	isMember, err := s.members.IsMember(ws.Context, ws.AuthedPublicKey, groupOf(ev))
+	if err != nil {
+		log.Default().Printf("failed to check the membership of %s: %v", ws.AuthedPublicKey, err)
+		return true
+	}
+
+	return !isMember
+}
+
+// QueryEvents returns the indicators that haven't expired in the groups of the filter the
+// authenticated client is a member of, newest first
+func (s *Service) QueryEvents(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+	events := []*nostr.Event{}
+
+	pubkey := khatru.GetAuthed(ctx)
+	if pubkey != "" && matchesKind(filter) && !khatru.IsInternalCall(ctx) {
+		for _, groupID := range filter.Tags["h"] {
+			isMember, err := s.members.IsMember(ctx, pubkey, groupID)
+			if err != nil {
+				return nil, err
+			}
+
+			if isMember {
+				events = append(events, s.current(groupID, filter)...)
+			}
+		}
+	}
+
+	slices.SortFunc(events, func(a, b *nostr.Event) int {
+		return cmp.Compare(b.CreatedAt, a.CreatedAt)
+	})
+
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+
+	ch := make(chan *nostr.Event, len(events))
+	for _, ev := range events {
+		ch <- ev
+	}
+	close(ch)
+
+	return ch, nil
+}
+
+// Start forgets the expired indicators every sweepInterval until the context is done
+func (s *Service) Start(ctx context.Context) error {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.Expire()
+		}
+	}
+}
+
+// Expire forgets the members whose indicator expired and who can send a new one
+func (s *Service) Expire() {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for groupID, members := range s.groups {
+		for pubkey, m := range members {
+			if m.ev != nil && now.After(m.expires) {
+				m.ev = nil
+			}
+
+			if m.ev == nil && now.Sub(m.sent) >= s.interval {
+				delete(members, pubkey)
+			}
+		}
+
+		if len(members) == 0 {
+			delete(s.groups, groupID)
+		}
+	}
+}
+
+// current returns the indicators of a group that match a filter and haven't expired
+func (s *Service) current(groupID string, filter nostr.Filter) []*nostr.Event {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []*nostr.Event{}
+	for _, m := range s.groups[groupID] {
+		if m.ev != nil && !now.After(m.expires) && filter.Matches(m.ev) {
+			events = append(events, m.ev)
+		}
+	}
+
+	return events
+}
+
+// member returns the presence of a member in a group, s.mu must be held
+func (s *Service) member(groupID, pubkey string) *member {
+	members, ok := s.groups[groupID]
+	if !ok {
+		members = map[string]*member{}
+		s.groups[groupID] = members
+	}
+
+	m, ok := members[pubkey]
+	if !ok {
+		m = &member{}
+		members[pubkey] = m
+	}
+
+	return m
+}
+
+func groupOf(ev *nostr.Event) string {
+	tag := ev.Tags.Find("h")
+	if tag == nil {
+		return ""
+	}
+
+	return tag[1]
+}
+
+func matchesKind(filter nostr.Filter) bool {
+	return len(filter.Kinds) == 0 || slices.Contains(filter.Kinds, KindPresence)
+}
@@ -0,0 +1,144 @@
+package presence
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fiatjaf/khatru"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type members map[string][]string // by group
+
+func (m members) IsMember(ctx context.Context, pubkey, groupID string) (bool, error) {
+	for _, p := range m[groupID] {
+		if p == pubkey {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func indicator(pubkey, groupID, status string, at time.Time) *nostr.Event {
+	return &nostr.Event{
+		Kind:      KindPresence,
+		PubKey:    pubkey,
+		CreatedAt: nostr.Timestamp(at.Unix()),
+		Tags:      nostr.Tags{{"h", groupID}, {"status", status}},
+	}
+}
+
+func newService(now *time.Time) *Service {
+	s := NewService(members{"group": {"alice", "bob"}}, time.Minute, 10*time.Second, 2*time.Second)
+	s.now = func() time.Time { return *now }
+
+	return s
+}
+
+func TestRejectEvent(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := newService(&now)
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		name   string
+		ev     *nostr.Event
+		prefix string
+	}{
+		{"not a member", indicator("mallory", "group", StatusOnline, now), "restricted:"},
+		{"unknown status", indicator("alice", "group", "away", now), "invalid:"},
+		{"expired", indicator("alice", "group", StatusOnline, now.Add(-2*time.Minute)), "invalid:"},
+		{"without a group", &nostr.Event{Kind: KindPresence, PubKey: "alice", CreatedAt: nostr.Timestamp(now.Unix()), Tags: nostr.Tags{{"status", StatusOnline}}}, "invalid:"},
+	} {
+		reject, msg := s.RejectEvent(ctx, c.ev)
+		if !reject || !strings.HasPrefix(msg, c.prefix) {
+			t.Errorf("%s: expected a %s rejection, got %v %q", c.name, c.prefix, reject, msg)
+		}
+	}
+
+	reject, msg := s.RejectEvent(ctx, indicator("alice", "group", StatusTyping, now))
+	if reject {
+		t.Fatalf("expected a member to send their presence, got %q", msg)
+	}
+
+	// too soon after the last one
+	now = now.Add(time.Second)
+	reject, msg = s.RejectEvent(ctx, indicator("alice", "group", StatusTyping, now))
+	if !reject || !strings.HasPrefix(msg, "rate-limited:") {
+		t.Fatalf("expected the indicator to be rate limited, got %v %q", reject, msg)
+	}
+
+	// other members have their own limit, and going offline is always accepted
+	for _, ev := range []*nostr.Event{
+		indicator("bob", "group", StatusOnline, now),
+		indicator("alice", "group", StatusOffline, now),
+	} {
+		reject, msg = s.RejectEvent(ctx, ev)
+		if reject {
+			t.Fatalf("expected %s to be accepted, got %q", Status(ev), msg)
+		}
+	}
+
+	now = now.Add(2 * time.Second)
+	reject, msg = s.RejectEvent(ctx, indicator("alice", "group", StatusOnline, now))
+	if reject {
+		t.Fatalf("expected the indicator to be accepted after the interval, got %q", msg)
+	}
+}
+
+func TestOnEphemeralEvent(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := newService(&now)
+	ctx := context.Background()
+	filter := nostr.Filter{Kinds: []int{KindPresence}, Tags: nostr.TagMap{"h": {"group"}}}
+
+	s.OnEphemeralEvent(ctx, indicator("alice", "group", StatusOnline, now))
+	s.OnEphemeralEvent(ctx, indicator("bob", "group", StatusTyping, now))
+
+	// an older indicator doesn't replace the latest
+	s.OnEphemeralEvent(ctx, indicator("alice", "group", StatusOffline, now.Add(-time.Second)))
+
+	if got := s.current("group", filter); len(got) != 2 {
+		t.Fatalf("expected 2 indicators, got %d", len(got))
+	}
+
+	// typing expires first
+	now = now.Add(11 * time.Second)
+	got := s.current("group", filter)
+	if len(got) != 1 || got[0].PubKey != "alice" {
+		t.Fatalf("expected alice to be online only, got %v", got)
+	}
+
+	s.OnEphemeralEvent(ctx, indicator("alice", "group", StatusOffline, now))
+	if got := s.current("group", filter); len(got) != 0 {
+		t.Fatalf("expected no one online, got %v", got)
+	}
+
+	s.Expire()
+	if len(s.groups) != 0 {
+		t.Fatalf("expected the expired indicators to be forgotten, got %v", s.groups)
+	}
+}
+
+func TestPreventBroadcast(t *testing.T) {
+	now := time.Now()
+	s := newService(&now)
+	ev := indicator("alice", "group", StatusOnline, now)
+
+	for pubkey, prevent := range map[string]bool{
+		"":        true,
+		"mallory": true,
+		"bob":     false,
+	} {
+		if got := s.PreventBroadcast(&khatru.WebSocket{AuthedPublicKey: pubkey}, ev); got != prevent {
+			t.Errorf("expected broadcast to %q to be prevented %v, got %v", pubkey, prevent, got)
+		}
+	}
+
+	if s.PreventBroadcast(&khatru.WebSocket{}, &nostr.Event{Kind: 1}) {
+		t.Error("expected other kinds to be broadcast")
+	}
+}
@@ -0,0 +1,214 @@
+package privacy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/go-chi/chi/v5"
+)
+
+// erasure requests returned by default to admins
+const defaultRequestsLimit = 100
+
+// Export returns the archive of what the relay stores about the pubkey that signed the request
+func (s *Service) Export(w http.ResponseWriter, r *http.Request) {
+	ev, err := com.ParseRequest(r, s.now(), nil)
+	if err != nil {
+		com.WriteRequestError(w, err)
+		return
+	}
+
+	// the archive is built before the headers are sent, a failure can still be reported
+	var buf bytes.Buffer
+	err = s.export(r.Context(), ev.PubKey, &buf)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", ev.PubKey+".zip"))
+	w.Write(buf.Bytes())
+}
+
+// Erase erases what the relay stores about the pubkey that signed the request, a blocked erasure
+// is a conflict whose reason says what to do first
+func (s *Service) Erase(w http.ResponseWriter, r *http.Request) {
+	ev, err := com.ParseRequest(r, s.now(), nil)
+	if err != nil {
+		com.WriteRequestError(w, err)
+		return
+	}
+
+	req, err := s.erase(r.Context(), ev.PubKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if req.Status == relay.ErasureStatusBlocked {
+		status = http.StatusConflict
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(req)
+}
+
+// Requests returns the latest erasure requests, for admins
+func (s *Service) Requests(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRequestsLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	requests, err := s.db.ErasureDB.GetRequests(limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, requests, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// RequestPurge records a purge of the pubkey that signed the request, to be approved by an admin
+func (s *Service) RequestPurge(w http.ResponseWriter, r *http.Request) {
+	var req relay.PurgeRequest
+	ev, err := com.ParseRequest(r, s.now(), &req)
+	if err != nil {
+		com.WriteRequestError(w, err)
+		return
+	}
+
+	p, created, err := s.requestPurge(ev.PubKey, req.Reason)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// a pubkey with a pending purge gets it back
+	if created {
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	err = com.Body(w, p, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Purges returns the latest purges, of the status given in the query or of any status, for admins
+func (s *Service) Purges(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRequestsLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	purges, err := s.db.PurgeDB.GetPurges(relay.PurgeStatus(r.URL.Query().Get("status")), limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, purges, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetPurge returns a purge with its audit trail, for admins
+func (s *Service) GetPurge(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	p, err := s.db.PurgeDB.GetPurge(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if p == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = com.Body(w, p, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ApprovePurge runs a purge and returns it with its audit trail, for admins
+func (s *Service) ApprovePurge(w http.ResponseWriter, r *http.Request) {
+	s.decide(w, r, func(id int64, d *relay.PurgeDecision) (*relay.Purge, error) {
+		return s.approvePurge(r.Context(), id, d.Note)
+	})
+}
+
+// RejectPurge declines a purge, for admins
+func (s *Service) RejectPurge(w http.ResponseWriter, r *http.Request) {
+	s.decide(w, r, func(id int64, d *relay.PurgeDecision) (*relay.Purge, error) {
+		return s.rejectPurge(id, d.Note)
+	})
+}
+
+func (s *Service) decide(w http.ResponseWriter, r *http.Request, decide func(id int64, d *relay.PurgeDecision) (*relay.Purge, error)) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// the note is optional
+	var d relay.PurgeDecision
+	if r.ContentLength != 0 {
+		err = json.NewDecoder(r.Body).Decode(&d)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	p, err := decide(id, &d)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrPurgeNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrPurgeDecided), errors.Is(err, ErrSoleAdmin):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = com.Body(w, p, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
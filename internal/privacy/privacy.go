@@ -0,0 +1,379 @@
+// Package privacy exports and erases what the relay stores about a pubkey.
+//
+// Both requests are NIP-98 events signed by the pubkey. The export is a zip archive with:
+//
+//   - events.json: every event the pubkey signed
+//   - memberships.json: the groups the pubkey is in and the put-user and remove-user events about it
+//   - push.json: push tokens and preference of the pubkey and of its linked account
+//   - blobs.json: the blobs the pubkey uploaded
+//   - account.json: the linked account, email senders and poll votes
+//   - logs.json: the transfers the linked account sent or received
+//
+// The erasure removes the pubkey from its groups with remove-user events signed by the relay and
+// deletes its events, blobs, push tokens, email senders and account link. It is blocked while the
+// pubkey is the only admin of a group, since the group could no longer be moderated: another admin
+// is appointed or the group deleted first. Moderation events (kinds 9000 to 9009) are kept, they
+// are the record of how groups were run, and so are poll votes, which back published tallies.
+// Transfers are on chain and can't be erased.
+//
+// Every erasure request is recorded with its outcome.
+//
+// Purges go further for pubkeys that want to be forgotten, they run once an admin approves them.
+// Messages in groups are replaced by tombstones signed by the relay so that threads keep their
+// shape, and the pubkey is scrubbed from the member and admin lists the relay generated over time.
+// Every decision and step is added to the audit trail of the purge. A failed purge can be approved
+// again, steps that were done find nothing left to do.
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/khatru/blossom"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// moderationKinds are kept on erasure, they record how groups were moderated
+var moderationKinds = []int{
+	groups.KindPutUser,
+	groups.KindRemoveUser,
+	groups.KindEditMetadata,
+	groups.KindDeleteEvent,
+	groups.KindCreateGroup,
+	groups.KindDeleteGroup,
+	groups.KindCreateInvite,
+}
+
+// Groups reads and updates the membership of groups
+type Groups interface {
+	GroupsOf(ctx context.Context, pubkey string) ([]string, error)
+	GetAdmins(ctx context.Context, groupID string) ([]string, error)
+	OnEventSaved(ctx context.Context, event *nostr.Event)
+}
+
+// Store reads and deletes the events of a pubkey and signs the events of the relay
+type Store interface {
+	GetAuthoredEvents(pubkey string) ([]*nostr.Event, error)
+	GetTaggedEvents(pubkey string, kinds []int) ([]*nostr.Event, error)
+	GetAccountLogs(account string) ([]*relay.LegacyLog, error)
+	DeleteEvent(ctx context.Context, ev *nostr.Event) error
+	SignAndSaveEvent(ctx context.Context, ev *nostr.Event) (*nostr.Event, error)
+	PubKey() string
+}
+
+// Blobs lists and deletes the blobs a pubkey uploaded
+type Blobs interface {
+	ListBlobs(ctx context.Context, pubkey string) ([]blossom.BlobDescriptor, error)
+	DeleteBlobs(ctx context.Context, pubkey string) (int, error)
+}
+
+type Service struct {
+	db     *db.DB
+	groups Groups
+	n      Store
+	blobs  Blobs
+
+	now func() time.Time
+}
+
+func NewService(d *db.DB, g Groups, n Store) *Service {
+	return &Service{
+		db:     d,
+		groups: g,
+		n:      n,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// SetBlobs includes uploaded blobs in exports and erasures, blobs are left out when media is disabled
+func (s *Service) SetBlobs(b Blobs) {
+	s.blobs = b
+}
+
+type memberships struct {
+	Groups []string       `json:"groups"`
+	Events []*nostr.Event `json:"events"`
+}
+
+type push struct {
+	Tokens        []*relay.PushToken    `json:"tokens"`
+	Preference    *relay.PushPreference `json:"preference"`
+	AccountTokens []*relay.PushToken    `json:"account_tokens"`
+}
+
+type account struct {
+	Link         *relay.AccountLink   `json:"link"`
+	EmailSenders []*relay.EmailSender `json:"email_senders"`
+	PollVotes    []*relay.PollVote    `json:"poll_votes"`
+}
+
+// export writes the archive of what the relay stores about a pubkey
+func (s *Service) export(ctx context.Context, pubkey string, w io.Writer) error {
+	events, err := s.n.GetAuthoredEvents(pubkey)
+	if err != nil {
+		return err
+	}
+
+	m := &memberships{}
+
+	m.Groups, err = s.groups.GroupsOf(ctx, pubkey)
+	if err != nil {
+		return err
+	}
+
+	m.Events, err = s.n.GetTaggedEvents(pubkey, []int{groups.KindPutUser, groups.KindRemoveUser})
+	if err != nil {
+		return err
+	}
+
+	a := &account{}
+
+	a.Link, err = s.db.AccountLinkDB.GetLink(pubkey)
+	if err != nil {
+		return err
+	}
+
+	a.EmailSenders, err = s.db.EmailSenderDB.GetSendersByPubkey(pubkey)
+	if err != nil {
+		return err
+	}
+
+	a.PollVotes, err = s.db.PollVoteDB.GetVotesByPubkey(pubkey)
+	if err != nil {
+		return err
+	}
+
+	p := &push{AccountTokens: []*relay.PushToken{}}
+
+	p.Tokens, err = s.db.NostrPushTokenDB.GetAccountTokens(pubkey)
+	if err != nil {
+		return err
+	}
+
+	p.Preference, err = s.db.PushPreferenceDB.GetPreference(pubkey)
+	if err != nil {
+		return err
+	}
+
+	logs := []*relay.LegacyLog{}
+
+	if a.Link != nil {
+		for _, ptdb := range s.db.PushTokenDBs() {
+			tokens, err := ptdb.GetAccountTokens(a.Link.Account)
+			if err != nil {
+				return err
+			}
+
+			p.AccountTokens = append(p.AccountTokens, tokens...)
+		}
+
+		logs, err = s.n.GetAccountLogs(a.Link.Account)
+		if err != nil {
+			return err
+		}
+	}
+
+	blobs := []blossom.BlobDescriptor{}
+	if s.blobs != nil {
+		blobs, err = s.blobs.ListBlobs(ctx, pubkey)
+		if err != nil {
+			return err
+		}
+	}
+
+	zw := zip.NewWriter(w)
+
+	for _, f := range []struct {
+		name string
+		v    any
+	}{
+		{"events.json", events},
+		{"memberships.json", m},
+		{"push.json", p},
+		{"blobs.json", blobs},
+		{"account.json", a},
+		{"logs.json", logs},
+	} {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+
+		err = enc.Encode(f.v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// erase removes a pubkey from its groups and deletes what the relay stores about it, the request
+// is recorded whether it was blocked or completed
+func (s *Service) erase(ctx context.Context, pubkey string) (*relay.ErasureRequest, error) {
+	req := &relay.ErasureRequest{
+		Pubkey:      pubkey,
+		Groups:      []string{},
+		RequestedAt: s.now(),
+	}
+
+	memberOf, err := s.groups.GroupsOf(ctx, pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	sole, err := s.soleAdminOf(ctx, pubkey, memberOf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sole) > 0 {
+		req.Status = relay.ErasureStatusBlocked
+		req.Reason = soleAdminReason(sole)
+
+		err = s.db.ErasureDB.AddRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		return req, nil
+	}
+
+	err = s.removeFromGroups(ctx, pubkey, memberOf, "erasure")
+	if err != nil {
+		return nil, err
+	}
+	req.Groups = memberOf
+
+	req.Events, err = s.deleteEvents(ctx, pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.blobs != nil {
+		_, err = s.blobs.DeleteBlobs(ctx, pubkey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.eraseRecords(pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Status = relay.ErasureStatusCompleted
+
+	err = s.db.ErasureDB.AddRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// removeFromGroups removes a pubkey from groups with remove-user events signed by the relay
+func (s *Service) removeFromGroups(ctx context.Context, pubkey string, groupIDs []string, content string) error {
+	for _, groupID := range groupIDs {
+		ev, err := s.n.SignAndSaveEvent(ctx, &nostr.Event{
+			Kind:      groups.KindRemoveUser,
+			CreatedAt: nostr.Timestamp(s.now().Unix()),
+			Tags:      nostr.Tags{{"h", groupID}, {"p", pubkey}},
+			Content:   content,
+		})
+		if err != nil {
+			return err
+		}
+
+		// relay signed events don't go through the relay hooks, the member lists are updated here
+		s.groups.OnEventSaved(ctx, ev)
+	}
+
+	return nil
+}
+
+// eraseRecords deletes the push tokens, email senders and account link of a pubkey
+func (s *Service) eraseRecords(pubkey string) error {
+	_, err := s.removePushTokens(pubkey)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.EmailSenderDB.RemoveSendersByPubkey(pubkey)
+	if err != nil {
+		return err
+	}
+
+	return s.db.AccountLinkDB.RemoveLink(pubkey)
+}
+
+// removePushTokens removes the push tokens and preference of a pubkey and the push tokens of its
+// linked account, it returns how many tokens were removed
+func (s *Service) removePushTokens(pubkey string) (int, error) {
+	removed := 0
+
+	link, err := s.db.AccountLinkDB.GetLink(pubkey)
+	if err != nil {
+		return removed, err
+	}
+
+	if link != nil {
+		for _, ptdb := range s.db.PushTokenDBs() {
+			tokens, err := ptdb.GetAccountTokens(link.Account)
+			if err != nil {
+				return removed, err
+			}
+
+			err = ptdb.RemoveAccountTokens(link.Account)
+			if err != nil {
+				return removed, err
+			}
+			removed += len(tokens)
+		}
+	}
+
+	tokens, err := s.db.NostrPushTokenDB.GetAccountTokens(pubkey)
+	if err != nil {
+		return removed, err
+	}
+
+	err = s.db.NostrPushTokenDB.RemoveAccountTokens(pubkey)
+	if err != nil {
+		return removed, err
+	}
+	removed += len(tokens)
+
+	return removed, s.db.PushPreferenceDB.RemovePreference(pubkey)
+}
+
+func soleAdminReason(sole []string) string {
+	return fmt.Sprintf("only admin of %s, appoint another admin or delete the group first", strings.Join(sole, ", "))
+}
+
+// soleAdminOf returns the groups a pubkey is the only admin of
+func (s *Service) soleAdminOf(ctx context.Context, pubkey string, groupIDs []string) ([]string, error) {
+	sole := []string{}
+	for _, groupID := range groupIDs {
+		admins, err := s.groups.GetAdmins(ctx, groupID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(admins) == 1 && admins[0] == pubkey {
+			sole = append(sole, groupID)
+		}
+	}
+
+	return sole, nil
+}
@@ -0,0 +1,238 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+// fakeStore has no legacy logs
+type fakeStore struct {
+	testutil.FakeStore
+}
+
+func (n *fakeStore) GetAccountLogs(account string) ([]*relay.LegacyLog, error) {
+	return []*relay.LegacyLog{}, nil
+}
+
+func TestSoleAdminOf(t *testing.T) {
+	g := &testutil.FakeGroups{Admins: map[string][]string{
+		"solo":   {"alice"},
+		"shared": {"alice", "bob"},
+		"other":  {"bob"},
+	}}
+
+	s := NewService(nil, g, nil)
+
+	sole, err := s.soleAdminOf(context.Background(), "alice", []string{"other", "shared", "solo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(sole, []string{"solo"}) {
+		t.Fatalf("expected alice to be the only admin of solo, got %v", sole)
+	}
+}
+
+func TestRequestEvent(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	s := NewService(nil, nil, nil)
+
+	for name, tc := range map[string]struct {
+		url string
+		ev  *nostr.Event
+		h   http.HandlerFunc
+	}{
+		"export with the erase request": {
+			url: "https://relay.example/v1/privacy/export",
+			ev:  &nostr.Event{Kind: nostr.KindHTTPAuth, Tags: nostr.Tags{{"u", "https://relay.example/v1/privacy/erase"}, {"method", "POST"}}},
+			h:   s.Export,
+		},
+		"expired erasure": {
+			url: "https://relay.example/v1/privacy/erase",
+			ev:  &nostr.Event{Kind: nostr.KindHTTPAuth, CreatedAt: nostr.Timestamp(time.Now().Add(-time.Hour).Unix()), Tags: nostr.Tags{{"u", "https://relay.example/v1/privacy/erase"}, {"method", "POST"}}},
+			h:   s.Erase,
+		},
+	} {
+		if tc.ev.CreatedAt == 0 {
+			tc.ev.CreatedAt = nostr.Now()
+		}
+
+		err := tc.ev.Sign(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(tc.ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(http.MethodPost, tc.url, bytes.NewReader(b))
+		w := httptest.NewRecorder()
+
+		tc.h(w, r)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected %d, got %d", name, http.StatusUnauthorized, w.Code)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	d := testutil.NewDB(t)
+
+	err := d.AccountLinkDB.SetLink(&relay.AccountLink{Pubkey: "alice", Account: "0xa", Owner: "0xowner", Signature: "0xsig", CreatedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &testutil.FakeGroups{Admins: map[string][]string{"demo": {"bob"}}, Members: map[string][]string{"demo": {"alice"}}}
+	n := &fakeStore{testutil.FakeStore{Events: []*nostr.Event{
+		{ID: "1", PubKey: "alice", Kind: 1},
+		{ID: "2", PubKey: "bob", Kind: groups.KindPutUser, Tags: nostr.Tags{{"h", "demo"}, {"p", "alice", groups.RoleMember}}},
+		{ID: "3", PubKey: "bob", Kind: 1},
+	}}}
+
+	s := NewService(d, g, n)
+
+	var buf bytes.Buffer
+	err = s.export(context.Background(), "alice", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	for _, name := range []string{"events.json", "memberships.json", "push.json", "blobs.json", "account.json", "logs.json"} {
+		if files[name] == nil {
+			t.Fatalf("expected %s in the archive", name)
+		}
+	}
+
+	var m memberships
+	readJSON(t, files["memberships.json"], &m)
+	if !slices.Equal(m.Groups, []string{"demo"}) || len(m.Events) != 1 || m.Events[0].ID != "2" {
+		t.Fatalf("unexpected memberships %+v", m)
+	}
+
+	var events []*nostr.Event
+	readJSON(t, files["events.json"], &events)
+	if len(events) != 1 || events[0].ID != "1" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	var a account
+	readJSON(t, files["account.json"], &a)
+	if a.Link == nil || a.Link.Account != "0xa" {
+		t.Fatalf("unexpected account %+v", a)
+	}
+}
+
+func readJSON(t *testing.T, f *zip.File, v any) {
+	t.Helper()
+
+	r, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	err = json.NewDecoder(r).Decode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestErase(t *testing.T) {
+	d := testutil.NewDB(t)
+
+	err := d.AccountLinkDB.SetLink(&relay.AccountLink{Pubkey: "alice", Account: "0xa", Owner: "0xowner", Signature: "0xsig", CreatedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.EmailSenderDB.AddSender(&relay.EmailSender{GroupID: "demo", Email: "alice@example.com", Pubkey: "alice", CreatedBy: "alice", CreatedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &testutil.FakeGroups{Admins: map[string][]string{"demo": {"alice"}}, Members: map[string][]string{"demo": {"carol"}}}
+	n := &fakeStore{testutil.FakeStore{Events: []*nostr.Event{
+		{ID: "1", PubKey: "alice", Kind: 1, Tags: nostr.Tags{{"h", "demo"}}},
+		{ID: "2", PubKey: "alice", Kind: groups.KindPutUser, Tags: nostr.Tags{{"h", "demo"}, {"p", "carol", groups.RoleMember}}},
+		{ID: "3", PubKey: "alice", Kind: nostr.KindProfileMetadata},
+	}}}
+
+	s := NewService(d, g, n)
+
+	// the only admin of a group keeps it moderated until someone takes over
+	req, err := s.erase(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Status != relay.ErasureStatusBlocked || len(n.Events) != 3 || len(g.Saved) != 0 {
+		t.Fatalf("expected the erasure to be blocked, got %+v with %d events", req, len(n.Events))
+	}
+
+	g.Admins["demo"] = append(g.Admins["demo"], "bob")
+
+	req, err = s.erase(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Status != relay.ErasureStatusCompleted || req.Events != 2 || !slices.Equal(req.Groups, []string{"demo"}) {
+		t.Fatalf("unexpected erasure %+v", req)
+	}
+
+	if len(g.Saved) != 1 || g.Saved[0].Kind != groups.KindRemoveUser || g.Saved[0].Tags.GetFirst([]string{"p", "alice"}) == nil {
+		t.Fatalf("expected alice to be removed from demo, got %+v", g.Saved)
+	}
+
+	// the moderation event of alice and the removal are kept
+	ids := []string{}
+	for _, ev := range n.Events {
+		ids = append(ids, ev.ID)
+	}
+	if len(ids) != 2 || ids[0] != "2" {
+		t.Fatalf("unexpected events left %v", ids)
+	}
+
+	link, err := d.AccountLinkDB.GetLink("alice")
+	if err != nil || link != nil {
+		t.Fatalf("expected the link to be erased, got %+v %v", link, err)
+	}
+
+	senders, err := d.EmailSenderDB.GetSendersByPubkey("alice")
+	if err != nil || len(senders) != 0 {
+		t.Fatalf("expected the email senders to be erased, got %v %v", senders, err)
+	}
+
+	requests, err := d.ErasureDB.GetRequests(10)
+	if err != nil || len(requests) != 2 {
+		t.Fatalf("expected both requests to be recorded, got %v %v", requests, err)
+	}
+}
@@ -0,0 +1,368 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// actions of the audit trail of purges
+const (
+	AuditRequested          = "requested"
+	AuditApproved           = "approved"
+	AuditRejected           = "rejected"
+	AuditBlocked            = "blocked"
+	AuditRemovedFromGroups  = "removed_from_groups"
+	AuditTombstoned         = "tombstoned_messages"
+	AuditDeletedEvents      = "deleted_events"
+	AuditDeletedBlobs       = "deleted_blobs"
+	AuditRemovedPushTokens  = "removed_push_tokens"
+	AuditRemovedRecords     = "removed_records"
+	AuditScrubbedMemberList = "scrubbed_member_lists"
+	AuditCompleted          = "completed"
+	AuditFailed             = "failed"
+)
+
+// TombstoneTag marks the tombstone of a message, its value is the id of the message
+const TombstoneTag = "tombstone"
+
+var (
+	ErrPurgeNotFound    = errors.New("purge not found")
+	ErrPurgeDecided     = errors.New("purge was already decided")
+	ErrSoleAdmin        = errors.New("pubkey is the only admin of a group")
+	ErrPurgeInterrupted = errors.New("purge was interrupted by a restart of the relay")
+)
+
+// requestPurge records a pending purge of a pubkey, a pubkey has a single pending purge at a time
+func (s *Service) requestPurge(pubkey, reason string) (*relay.Purge, bool, error) {
+	p, err := s.db.PurgeDB.GetPendingPurge(pubkey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if p != nil {
+		return p, false, nil
+	}
+
+	p = &relay.Purge{
+		Pubkey:      pubkey,
+		Status:      relay.PurgeStatusPending,
+		Reason:      reason,
+		RequestedAt: s.now(),
+	}
+	p.UpdatedAt = p.RequestedAt
+
+	err = s.db.PurgeDB.AddPurge(p)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = s.audit(p.ID, AuditRequested, 0, reason)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return p, true, nil
+}
+
+// rejectPurge declines a pending purge
+func (s *Service) rejectPurge(id int64, note string) (*relay.Purge, error) {
+	p, err := s.pendingPurge(id)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed, err := s.db.PurgeDB.ClaimStatus(id, p.Status, relay.PurgeStatusRejected, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	if !claimed {
+		return nil, ErrPurgeDecided
+	}
+
+	err = s.audit(id, AuditRejected, 0, note)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.db.PurgeDB.GetPurge(p.ID)
+}
+
+// approvePurge runs a pending or failed purge, a pubkey that is the only admin of a group is not
+// purged and the purge stays pending
+func (s *Service) approvePurge(ctx context.Context, id int64, note string) (*relay.Purge, error) {
+	p, err := s.pendingPurge(id)
+	if err != nil {
+		return nil, err
+	}
+
+	memberOf, err := s.groups.GroupsOf(ctx, p.Pubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	sole, err := s.soleAdminOf(ctx, p.Pubkey, memberOf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sole) > 0 {
+		err = s.audit(id, AuditBlocked, 0, soleAdminReason(sole))
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrSoleAdmin
+	}
+
+	// an admin approving twice at once runs the purge only once
+	claimed, err := s.db.PurgeDB.ClaimStatus(id, p.Status, relay.PurgeStatusRunning, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	if !claimed {
+		return nil, ErrPurgeDecided
+	}
+
+	// from here on the purge is running, any error leaves it failed so that it can be approved again
+	action, err := s.runPurge(ctx, p, memberOf, note)
+	if err != nil {
+		return s.failPurge(id, action, err)
+	}
+
+	return s.db.PurgeDB.GetPurge(id)
+}
+
+// runPurge runs the steps of a claimed purge, it returns the action that failed
+func (s *Service) runPurge(ctx context.Context, p *relay.Purge, memberOf []string, note string) (string, error) {
+	err := s.audit(p.ID, AuditApproved, 0, note)
+	if err != nil {
+		return AuditApproved, err
+	}
+
+	steps := []struct {
+		action string
+		run    func() (int, error)
+	}{
+		{AuditRemovedFromGroups, func() (int, error) {
+			return len(memberOf), s.removeFromGroups(ctx, p.Pubkey, memberOf, "purge")
+		}},
+		{AuditTombstoned, func() (int, error) { return s.tombstoneMessages(ctx, p.Pubkey) }},
+		{AuditDeletedEvents, func() (int, error) { return s.deleteEvents(ctx, p.Pubkey) }},
+		{AuditDeletedBlobs, func() (int, error) {
+			if s.blobs == nil {
+				return 0, nil
+			}
+			return s.blobs.DeleteBlobs(ctx, p.Pubkey)
+		}},
+		{AuditRemovedPushTokens, func() (int, error) { return s.removePushTokens(p.Pubkey) }},
+		{AuditRemovedRecords, func() (int, error) { return 0, s.eraseRecords(p.Pubkey) }},
+		{AuditScrubbedMemberList, func() (int, error) { return s.scrubMemberLists(ctx, p.Pubkey) }},
+	}
+
+	for _, st := range steps {
+		count, err := st.run()
+		if err != nil {
+			return st.action, err
+		}
+
+		err = s.audit(p.ID, st.action, count, "")
+		if err != nil {
+			return st.action, err
+		}
+	}
+
+	err = s.audit(p.ID, AuditCompleted, 0, "")
+	if err != nil {
+		return AuditCompleted, err
+	}
+
+	return AuditCompleted, s.db.PurgeDB.SetStatus(p.ID, relay.PurgeStatusCompleted, s.now())
+}
+
+// failPurge records the step that stopped a purge, the purge can be approved again
+func (s *Service) failPurge(id int64, action string, cause error) (*relay.Purge, error) {
+	// the status comes first, a purge that can't be audited can still be approved again
+	err := s.db.PurgeDB.SetStatus(id, relay.PurgeStatusFailed, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.audit(id, AuditFailed, 0, action+": "+cause.Error())
+	if err != nil {
+		return nil, err
+	}
+
+	return s.db.PurgeDB.GetPurge(id)
+}
+
+// RecoverPurges fails the purges left running by a relay that stopped in the middle of them, so
+// that they can be approved again. It is meant to be called at startup.
+func (s *Service) RecoverPurges() error {
+	for {
+		purges, err := s.db.PurgeDB.GetPurges(relay.PurgeStatusRunning, defaultRequestsLimit)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range purges {
+			_, err = s.failPurge(p.ID, string(relay.PurgeStatusRunning), ErrPurgeInterrupted)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(purges) < defaultRequestsLimit {
+			return nil
+		}
+	}
+}
+
+// pendingPurge returns a purge that can still be decided on
+func (s *Service) pendingPurge(id int64) (*relay.Purge, error) {
+	p, err := s.db.PurgeDB.GetPurge(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if p == nil {
+		return nil, ErrPurgeNotFound
+	}
+
+	if p.Status != relay.PurgeStatusPending && p.Status != relay.PurgeStatusFailed {
+		return nil, ErrPurgeDecided
+	}
+
+	return p, nil
+}
+
+func (s *Service) audit(id int64, action string, count int, detail string) error {
+	return s.db.PurgeDB.AddAuditEntry(id, &relay.PurgeAuditEntry{
+		Action:    action,
+		Count:     count,
+		Detail:    detail,
+		CreatedAt: s.now(),
+	})
+}
+
+// isMessage tells whether an event is part of the history of a group, as opposed to moderation
+// and membership requests
+func isMessage(ev *nostr.Event) bool {
+	if ev.Tags.Find("h") == nil || slices.Contains(moderationKinds, ev.Kind) {
+		return false
+	}
+
+	return ev.Kind != groups.KindJoinRequest && ev.Kind != groups.KindLeaveRequest
+}
+
+// tombstoneMessages replaces the messages of a pubkey in groups with tombstones signed by the
+// relay, a tombstone has the kind and time of the message and keeps the group and thread tags
+func (s *Service) tombstoneMessages(ctx context.Context, pubkey string) (int, error) {
+	events, err := s.n.GetAuthoredEvents(pubkey)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, ev := range events {
+		if !isMessage(ev) {
+			continue
+		}
+
+		tags := nostr.Tags{}
+		for _, tag := range ev.Tags {
+			if len(tag) >= 2 && (tag[0] == "h" || tag[0] == "e") {
+				tags = append(tags, tag)
+			}
+		}
+		tags = append(tags, nostr.Tag{TombstoneTag, ev.ID})
+
+		_, err = s.n.SignAndSaveEvent(ctx, &nostr.Event{
+			Kind:      ev.Kind,
+			CreatedAt: ev.CreatedAt,
+			Tags:      tags,
+		})
+		if err != nil {
+			return count, err
+		}
+
+		err = s.n.DeleteEvent(ctx, ev)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// deleteEvents deletes the events of a pubkey, moderation events are kept
+func (s *Service) deleteEvents(ctx context.Context, pubkey string) (int, error) {
+	events, err := s.n.GetAuthoredEvents(pubkey)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, ev := range events {
+		if slices.Contains(moderationKinds, ev.Kind) {
+			continue
+		}
+
+		err = s.n.DeleteEvent(ctx, ev)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// scrubMemberLists replaces the member and admin lists of the relay that still name a pubkey with
+// copies without it, a copy keeps the time of the list so that newer lists still come first
+func (s *Service) scrubMemberLists(ctx context.Context, pubkey string) (int, error) {
+	lists, err := s.n.GetTaggedEvents(pubkey, []int{groups.KindGroupAdmins, groups.KindGroupMembers})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, ev := range lists {
+		if ev.PubKey != s.n.PubKey() {
+			continue
+		}
+
+		tags := nostr.Tags{}
+		for _, tag := range ev.Tags {
+			if len(tag) >= 2 && tag[0] == "p" && tag[1] == pubkey {
+				continue
+			}
+			tags = append(tags, tag)
+		}
+
+		_, err = s.n.SignAndSaveEvent(ctx, &nostr.Event{
+			Kind:      ev.Kind,
+			CreatedAt: ev.CreatedAt,
+			Tags:      tags,
+			Content:   ev.Content,
+		})
+		if err != nil {
+			return count, err
+		}
+
+		err = s.n.DeleteEvent(ctx, ev)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,176 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestTombstoneMessages(t *testing.T) {
+	n := &fakeStore{testutil.FakeStore{Events: []*nostr.Event{
+		{ID: "1", PubKey: "alice", Kind: groups.KindGroupChat, CreatedAt: 100, Content: "hello", Tags: nostr.Tags{{"h", "demo"}, {"e", "0"}, {"p", "bob"}}},
+		{ID: "2", PubKey: "alice", Kind: groups.KindJoinRequest, Tags: nostr.Tags{{"h", "demo"}}},
+		{ID: "3", PubKey: "alice", Kind: nostr.KindProfileMetadata},
+		{ID: "4", PubKey: "bob", Kind: groups.KindGroupChat, Tags: nostr.Tags{{"h", "demo"}}},
+	}}}
+
+	s := NewService(nil, nil, n)
+
+	count, err := s.tombstoneMessages(context.Background(), "alice")
+	if err != nil || count != 1 {
+		t.Fatalf("expected a single tombstone, got %d %v", count, err)
+	}
+
+	tombstone := n.Events[len(n.Events)-1]
+	if tombstone.PubKey != "relay" || tombstone.Kind != groups.KindGroupChat || tombstone.CreatedAt != 100 || tombstone.Content != "" {
+		t.Fatalf("unexpected tombstone %+v", tombstone)
+	}
+
+	// the group and thread are kept, mentions are not
+	if tombstone.Tags.GetFirst([]string{"h", "demo"}) == nil || tombstone.Tags.GetFirst([]string{"e", "0"}) == nil ||
+		tombstone.Tags.GetFirst([]string{TombstoneTag, "1"}) == nil || tombstone.Tags.Find("p") != nil {
+		t.Fatalf("unexpected tombstone tags %v", tombstone.Tags)
+	}
+
+	for _, ev := range n.Events {
+		if ev.ID == "1" {
+			t.Fatal("expected the message to be replaced")
+		}
+	}
+}
+
+func TestScrubMemberLists(t *testing.T) {
+	n := &fakeStore{testutil.FakeStore{Events: []*nostr.Event{
+		{ID: "1", PubKey: "relay", Kind: groups.KindGroupMembers, CreatedAt: 100, Tags: nostr.Tags{{"d", "demo"}, {"p", "alice"}, {"p", "bob"}}},
+		{ID: "2", PubKey: "relay", Kind: groups.KindGroupAdmins, CreatedAt: 100, Tags: nostr.Tags{{"d", "demo"}, {"p", "alice", "admin"}}},
+		{ID: "3", PubKey: "relay", Kind: groups.KindGroupMembers, CreatedAt: 200, Tags: nostr.Tags{{"d", "demo"}, {"p", "bob"}}},
+		{ID: "4", PubKey: "mallory", Kind: groups.KindGroupMembers, Tags: nostr.Tags{{"d", "demo"}, {"p", "alice"}}},
+	}}}
+
+	s := NewService(nil, nil, n)
+
+	count, err := s.scrubMemberLists(context.Background(), "alice")
+	if err != nil || count != 2 {
+		t.Fatalf("expected both lists of the relay to be scrubbed, got %d %v", count, err)
+	}
+
+	for _, ev := range n.Events {
+		if ev.PubKey == "relay" && ev.Tags.GetFirst([]string{"p", "alice"}) != nil {
+			t.Fatalf("expected alice to be scrubbed from %+v", ev)
+		}
+	}
+
+	members := n.Events[len(n.Events)-2]
+	if members.Kind != groups.KindGroupMembers || members.CreatedAt != 100 || members.Tags.GetFirst([]string{"p", "bob"}) == nil {
+		t.Fatalf("unexpected scrubbed list %+v", members)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	d := testutil.NewDB(t)
+
+	g := &testutil.FakeGroups{Admins: map[string][]string{"demo": {"alice"}}, Members: map[string][]string{"demo": {"carol"}}}
+	n := &fakeStore{testutil.FakeStore{Events: []*nostr.Event{
+		{ID: "1", PubKey: "alice", Kind: groups.KindGroupChat, Tags: nostr.Tags{{"h", "demo"}}},
+		{ID: "2", PubKey: "alice", Kind: nostr.KindProfileMetadata},
+	}}}
+
+	s := NewService(d, g, n)
+
+	p, created, err := s.requestPurge("alice", "leaving")
+	if err != nil || !created {
+		t.Fatalf("expected a purge to be requested, got %v %v", created, err)
+	}
+
+	// asking again returns the pending purge
+	again, created, err := s.requestPurge("alice", "")
+	if err != nil || created || again.ID != p.ID {
+		t.Fatalf("expected the pending purge, got %+v %v %v", again, created, err)
+	}
+
+	_, err = s.approvePurge(context.Background(), p.ID, "")
+	if !errors.Is(err, ErrSoleAdmin) {
+		t.Fatalf("expected the only admin not to be purged, got %v", err)
+	}
+
+	g.Admins["demo"] = append(g.Admins["demo"], "bob")
+
+	p, err = s.approvePurge(context.Background(), p.ID, "ticket 42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != relay.PurgeStatusCompleted {
+		t.Fatalf("expected the purge to complete, got %s", p.Status)
+	}
+
+	actions := map[string]*relay.PurgeAuditEntry{}
+	for _, e := range p.Audit {
+		actions[e.Action] = e
+	}
+
+	for action, count := range map[string]int{
+		AuditRequested:         0,
+		AuditBlocked:           0,
+		AuditApproved:          0,
+		AuditRemovedFromGroups: 1,
+		AuditTombstoned:        1,
+		AuditDeletedEvents:     1,
+		AuditCompleted:         0,
+	} {
+		if actions[action] == nil || actions[action].Count != count {
+			t.Errorf("expected %s with %d in the audit trail, got %+v", action, count, actions[action])
+		}
+	}
+
+	if actions[AuditApproved].Detail != "ticket 42" {
+		t.Errorf("expected the note of the admin, got %q", actions[AuditApproved].Detail)
+	}
+
+	_, err = s.rejectPurge(p.ID, "")
+	if !errors.Is(err, ErrPurgeDecided) {
+		t.Fatalf("expected a completed purge to be decided, got %v", err)
+	}
+
+	_, err = s.approvePurge(context.Background(), p.ID+1, "")
+	if !errors.Is(err, ErrPurgeNotFound) {
+		t.Fatalf("expected ErrPurgeNotFound, got %v", err)
+	}
+}
+
+func TestRecoverPurges(t *testing.T) {
+	d := testutil.NewDB(t)
+
+	g := &testutil.FakeGroups{Admins: map[string][]string{"demo": {"bob"}}, Members: map[string][]string{"demo": {"alice"}}}
+	s := NewService(d, g, &fakeStore{})
+
+	p, _, err := s.requestPurge("alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the relay stopped while the purge was running
+	claimed, err := d.PurgeDB.ClaimStatus(p.ID, relay.PurgeStatusPending, relay.PurgeStatusRunning, s.now())
+	if err != nil || !claimed {
+		t.Fatalf("expected the purge to be claimed, got %v %v", claimed, err)
+	}
+
+	err = s.RecoverPurges()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = d.PurgeDB.GetPurge(p.ID)
+	if err != nil || p.Status != relay.PurgeStatusFailed {
+		t.Fatalf("expected the interrupted purge to fail, got %+v %v", p, err)
+	}
+
+	p, err = s.approvePurge(context.Background(), p.ID, "")
+	if err != nil || p.Status != relay.PurgeStatusCompleted {
+		t.Fatalf("expected the failed purge to be approved again, got %+v %v", p, err)
+	}
+}
@@ -44,14 +44,16 @@ func (s *Service) AddToken(w http.ResponseWriter, r *http.Request) {
 	// parse contract address from url params
 	contractAddr := chi.URLParam(r, "contract_address")
 
-	var pt relay.PushToken
-	err := json.NewDecoder(r.Body).Decode(&pt)
+	var reg relay.PushTokenRegistration
+	err := json.NewDecoder(r.Body).Decode(&reg)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
 
+	pt := reg.PushToken
+
 	// make sure the addresses are EIP55 checksummed
 	pt.Account = com.ChecksumAddress(pt.Account)
 
@@ -79,12 +81,47 @@ func (s *Service) AddToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	_, err = s.updatePreference(pt.Account, "", reg.Locale)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	err = com.Body(w, pt, nil)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// updatePreference changes the mode and locale of an account when they are set and returns its
+// preference, locales without a catalog are ignored and messages stay in the default locale
+func (s *Service) updatePreference(account string, mode relay.PushMode, locale string) (*relay.PushPreference, error) {
+	pref, err := s.db.PushPreferenceDB.GetPreference(account)
+	if err != nil {
+		return nil, err
+	}
+
+	locale, supported := relay.NormalizePushLocale(locale)
+	if mode == "" && (!supported || locale == pref.Locale) {
+		return pref, nil
+	}
+
+	if mode != "" {
+		pref.Mode = mode
+	}
+
+	if supported {
+		pref.Locale = locale
+	}
+
+	err = s.db.PushPreferenceDB.SetPreference(pref)
+	if err != nil {
+		return nil, err
+	}
+
+	return pref, nil
+}
+
 func (s *Service) RemoveAccountToken(w http.ResponseWriter, r *http.Request) {
 	// ensure that the address in the url matches the one in the headers
 	addr, ok := com.GetContextAddress(r.Context())
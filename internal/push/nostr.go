@@ -0,0 +1,148 @@
+package push
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// how far a signed registration event can be from now
+const nostrRegistrationMaxAge = 5 * time.Minute
+
+var (
+	ErrInvalidRegistrationSignature = errors.New("invalid registration signature")
+	ErrExpiredRegistration          = errors.New("registration event is expired")
+)
+
+// parseNostrRegistration parses and verifies a NIP-98 registration event signed by the pubkey in the url
+func parseNostrRegistration(r *http.Request) (*relay.NostrPushRegistration, string, error) {
+	pubkey := chi.URLParam(r, "pubkey")
+
+	var ev nostr.Event
+	err := json.NewDecoder(r.Body).Decode(&ev)
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Body.Close()
+
+	if ev.PubKey != pubkey {
+		return nil, "", ErrInvalidRegistrationSignature
+	}
+
+	ok, err := ev.CheckSignature()
+	if err != nil || !ok {
+		return nil, "", ErrInvalidRegistrationSignature
+	}
+
+	// the event has to be signed for this endpoint, otherwise any auth event of the pubkey could be replayed
+	err = com.CheckRequestEvent(r, &ev)
+	if err != nil {
+		return nil, "", ErrInvalidRegistrationSignature
+	}
+
+	age := time.Since(ev.CreatedAt.Time())
+	if age > nostrRegistrationMaxAge || age < -nostrRegistrationMaxAge {
+		return nil, "", ErrExpiredRegistration
+	}
+
+	var reg relay.NostrPushRegistration
+	err = json.Unmarshal([]byte(ev.Content), &reg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &reg, pubkey, nil
+}
+
+// AddNostrToken registers a push token and optionally the notification mode and locale for a nostr pubkey
+func (s *Service) AddNostrToken(w http.ResponseWriter, r *http.Request) {
+	reg, pubkey, err := parseNostrRegistration(r)
+	if err != nil {
+		if err == ErrInvalidRegistrationSignature || err == ErrExpiredRegistration {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if reg.Token == "" || (reg.Mode != "" && !reg.Mode.IsValid()) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	pt := &relay.PushToken{
+		Token:   reg.Token,
+		Account: pubkey,
+	}
+
+	err = s.db.NostrPushTokenDB.AddToken(pt)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	pref, err := s.updatePreference(pubkey, reg.Mode, reg.Locale)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, pref, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// RemoveNostrToken removes a push token for a nostr pubkey
+func (s *Service) RemoveNostrToken(w http.ResponseWriter, r *http.Request) {
+	reg, pubkey, err := parseNostrRegistration(r)
+	if err != nil {
+		if err == ErrInvalidRegistrationSignature || err == ErrExpiredRegistration {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if reg.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.NostrPushTokenDB.RemoveAccountPushToken(reg.Token, pubkey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, []byte("{}"), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetNostrPreference returns the notification preferences of a nostr pubkey
+func (s *Service) GetNostrPreference(w http.ResponseWriter, r *http.Request) {
+	pubkey := chi.URLParam(r, "pubkey")
+
+	pref, err := s.db.PushPreferenceDB.GetPreference(pubkey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, pref, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	comm "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	verifyAttempts = 5               // lookups of the receipt on the second node, it can be a few blocks behind
+	verifyDelay    = 2 * time.Second // wait between lookups
+)
+
+var ErrReceiptMismatch = errors.New("the receipt doesn't match the one of the second node")
+
+// ReceiptSource is an independent node receipts are verified against
+type ReceiptSource interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// SetReceiptVerifier verifies the receipt of bundles transferring at least threshold against a
+// second node before their ops are confirmed
+func (s *UserOpService) SetReceiptVerifier(src ReceiptSource, threshold *big.Int) {
+	s.verifier = src
+	s.verifyThreshold = threshold
+}
+
+// verifyBundle checks the receipt of a bundle against the second node when its value is above the
+// threshold, a bundle that doesn't need to be verified passes
+func (s *UserOpService) verifyBundle(ops []relay.UserOpMessage, rcpt *types.Receipt) error {
+	if s.verifier == nil {
+		return nil
+	}
+
+	value := s.bundleValue(ops)
+	if value.Cmp(s.verifyThreshold) < 0 {
+		return nil
+	}
+
+	var other *types.Receipt
+	var err error
+	for attempt := range verifyAttempts {
+		if attempt > 0 {
+			select {
+			case <-s.ctx.Done():
+				return s.ctx.Err()
+			case <-time.After(verifyDelay):
+			}
+		}
+
+		other, err = s.verifier.TransactionReceipt(s.ctx, rcpt.TxHash)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return err
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s was not found", ErrReceiptMismatch, rcpt.TxHash.Hex())
+	}
+
+	return compareReceipts(rcpt, other)
+}
+
+// bundleValue sums the amounts the ops of a bundle transfer, ops that aren't transfers count as 0
+func (s *UserOpService) bundleValue(ops []relay.UserOpMessage) *big.Int {
+	value := big.NewInt(0)
+	for _, op := range ops {
+		opevt, err := nostreth.ParseUserOpEvent(op.Event)
+		if err != nil {
+			continue
+		}
+
+		_, _, _, amount, err := comm.ParseERC20Transfer(opevt.UserOpData.CallData, s.evm)
+		if err != nil || amount == nil {
+			continue
+		}
+
+		value.Add(value, amount)
+	}
+
+	return value
+}
+
+// compareReceipts returns an error when two receipts of the same transaction disagree on its outcome
+func compareReceipts(a, b *types.Receipt) error {
+	switch {
+	case a.TxHash != b.TxHash:
+		return fmt.Errorf("%w: transaction %s, got %s", ErrReceiptMismatch, a.TxHash.Hex(), b.TxHash.Hex())
+	case a.Status != b.Status:
+		return fmt.Errorf("%w: status %d, got %d", ErrReceiptMismatch, a.Status, b.Status)
+	case a.BlockHash != b.BlockHash:
+		return fmt.Errorf("%w: block %s, got %s", ErrReceiptMismatch, a.BlockHash.Hex(), b.BlockHash.Hex())
+	case a.GasUsed != b.GasUsed:
+		return fmt.Errorf("%w: gas used %d, got %d", ErrReceiptMismatch, a.GasUsed, b.GasUsed)
+	case len(a.Logs) != len(b.Logs):
+		return fmt.Errorf("%w: %d logs, got %d", ErrReceiptMismatch, len(a.Logs), len(b.Logs))
+	case a.Bloom != b.Bloom:
+		return fmt.Errorf("%w: logs bloom differs", ErrReceiptMismatch)
+	}
+
+	return nil
+}
+
+// logUnverified reports a bundle whose receipt couldn't be verified
+func logUnverified(txHash string, err error) {
+	log.Default().Printf("userop: bundle %s is not confirmed, the receipt couldn't be verified: %v", txHash, err)
+}
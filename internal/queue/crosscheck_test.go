@@ -0,0 +1,40 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestCompareReceipts(t *testing.T) {
+	rcpt := func() *types.Receipt {
+		return &types.Receipt{
+			TxHash:    common.HexToHash("0x01"),
+			BlockHash: common.HexToHash("0x02"),
+			Status:    types.ReceiptStatusSuccessful,
+			GasUsed:   21000,
+			Logs:      []*types.Log{{Index: 0}},
+		}
+	}
+
+	err := compareReceipts(rcpt(), rcpt())
+	if err != nil {
+		t.Fatalf("expected the receipts to match, got %v", err)
+	}
+
+	for name, change := range map[string]func(r *types.Receipt){
+		"status": func(r *types.Receipt) { r.Status = types.ReceiptStatusFailed },
+		"block":  func(r *types.Receipt) { r.BlockHash = common.HexToHash("0x03") },
+		"logs":   func(r *types.Receipt) { r.Logs = nil },
+	} {
+		other := rcpt()
+		change(other)
+
+		err := compareReceipts(rcpt(), other)
+		if !errors.Is(err, ErrReceiptMismatch) {
+			t.Errorf("%s: expected a mismatch, got %v", name, err)
+		}
+	}
+}
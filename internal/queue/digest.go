@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+const (
+	digestMaxItems     = 3                // number of items to show in a digest
+	digestMinFlushTick = 1 * time.Second  // smallest interval at which digests are checked
+	digestMaxFlushTick = 30 * time.Second // largest interval at which digests are checked
+)
+
+// Enqueuer is implemented by queues that accept messages
+type Enqueuer interface {
+	Enqueue(message relay.Message)
+}
+
+type digestKey struct {
+	account string
+	groupID string
+}
+
+type digest struct {
+	tokens    []*relay.PushToken
+	groupName string
+	locale    string
+	count     int
+	items     []string
+	since     time.Time
+}
+
+// DigestService batches activity per account per group into a single push message per window.
+// Mentions and transfers are always pushed immediately.
+type DigestService struct {
+	ctx    context.Context
+	window time.Duration
+	pushq  Enqueuer
+
+	mu      sync.Mutex
+	digests map[digestKey]*digest
+}
+
+// NewDigestService creates a new digest service, a window of 0 disables digests
+func NewDigestService(ctx context.Context, window time.Duration, pushq Enqueuer) *DigestService {
+	return &DigestService{
+		ctx:     ctx,
+		window:  window,
+		pushq:   pushq,
+		digests: map[digestKey]*digest{},
+	}
+}
+
+// Add adds a notification to the digest of the account for the group
+func (s *DigestService) Add(n *relay.PushNotification) {
+	if s.window <= 0 || n.IsImmediate() {
+		s.push(n.Account, n.GroupID, relay.NewPushMessageFromNotification(n))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := digestKey{account: n.Account, groupID: n.GroupID}
+
+	d, ok := s.digests[key]
+	if !ok {
+		d = &digest{since: time.Now()}
+		s.digests[key] = d
+	}
+
+	// always use the latest known tokens, name and locale
+	d.tokens = n.Tokens
+	d.groupName = n.GroupName
+	d.locale = n.Locale
+	d.count++
+	if len(d.items) < digestMaxItems {
+		d.items = append(d.items, n.Body)
+	}
+}
+
+// Pending returns the number of digests waiting to be sent
+func (s *DigestService) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.digests)
+}
+
+// Flush sends all digests whose window has elapsed at the given time
+func (s *DigestService) Flush(now time.Time) {
+	s.mu.Lock()
+	ready := map[digestKey]*digest{}
+	for key, d := range s.digests {
+		if now.Sub(d.since) < s.window {
+			continue
+		}
+
+		ready[key] = d
+		delete(s.digests, key)
+	}
+	s.mu.Unlock()
+
+	for key, d := range ready {
+		s.push(key.account, key.groupID, relay.NewDigestPushMessage(d.tokens, d.locale, d.groupName, d.count, d.items))
+	}
+}
+
+// Start periodically flushes digests until the context is done.
+// Pending digests are flushed before returning.
+func (s *DigestService) Start() error {
+	log.Default().Println("starting digest service")
+
+	tick := min(max(s.window/4, digestMinFlushTick), digestMaxFlushTick)
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			s.Flush(time.Now().Add(s.window))
+			log.Default().Println("stopping digest service")
+			return nil
+		case now := <-ticker.C:
+			s.Flush(now)
+		}
+	}
+}
+
+func (s *DigestService) push(account, groupID string, msg *relay.PushMessage) {
+	if len(msg.Tokens) == 0 {
+		return
+	}
+
+	id := fmt.Sprintf("push:%s:%s:%d", account, groupID, time.Now().UnixNano())
+
+	s.pushq.Enqueue(*relay.NewMessage(id, msg, 0, nil))
+}
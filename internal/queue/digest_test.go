@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+type TestEnqueuer struct {
+	messages []relay.Message
+}
+
+func (e *TestEnqueuer) Enqueue(message relay.Message) {
+	e.messages = append(e.messages, message)
+}
+
+func TestDigest(t *testing.T) {
+	tokens := []*relay.PushToken{{Token: "token", Account: "0x1"}}
+
+	t.Run("batches messages per group", func(t *testing.T) {
+		q := &TestEnqueuer{}
+		s := NewDigestService(context.Background(), 15*time.Minute, q)
+
+		for _, body := range []string{"a", "b", "c", "d"} {
+			s.Add(&relay.PushNotification{
+				Type:      relay.PushNotificationTypeMessage,
+				Tokens:    tokens,
+				Account:   "0x1",
+				GroupID:   "group1",
+				GroupName: "Group 1",
+				Body:      body,
+			})
+		}
+		s.Add(&relay.PushNotification{Type: relay.PushNotificationTypeMessage, Tokens: tokens, Account: "0x1", GroupID: "group2", Body: "e"})
+
+		if s.Pending() != 2 {
+			t.Fatalf("expected 2 pending digests, got %d", s.Pending())
+		}
+
+		// window has not elapsed yet
+		s.Flush(time.Now())
+		if len(q.messages) != 0 {
+			t.Fatalf("expected no messages, got %d", len(q.messages))
+		}
+
+		s.Flush(time.Now().Add(15 * time.Minute))
+		if len(q.messages) != 2 {
+			t.Fatalf("expected 2 messages, got %d", len(q.messages))
+		}
+
+		if s.Pending() != 0 {
+			t.Fatalf("expected no pending digests, got %d", s.Pending())
+		}
+
+		for _, m := range q.messages {
+			msg, ok := m.Message.(*relay.PushMessage)
+			if !ok {
+				t.Fatalf("expected a push message, got %T", m.Message)
+			}
+
+			if msg.Title != "Group 1" {
+				continue
+			}
+
+			if !strings.HasPrefix(msg.Body, "4 new messages") {
+				t.Errorf("expected body to start with count, got %s", msg.Body)
+			}
+
+			if strings.Contains(msg.Body, "d") {
+				t.Errorf("expected at most %d items, got %s", digestMaxItems, msg.Body)
+			}
+		}
+	})
+
+	t.Run("pushes mentions and transfers immediately", func(t *testing.T) {
+		q := &TestEnqueuer{}
+		s := NewDigestService(context.Background(), 15*time.Minute, q)
+
+		s.Add(&relay.PushNotification{Type: relay.PushNotificationTypeMention, Tokens: tokens, Account: "0x1", GroupID: "group1", Body: "hey"})
+		s.Add(&relay.PushNotification{Type: relay.PushNotificationTypeTransfer, Tokens: tokens, Account: "0x1", Body: "10 CTZN received"})
+
+		if len(q.messages) != 2 {
+			t.Fatalf("expected 2 messages, got %d", len(q.messages))
+		}
+
+		if s.Pending() != 0 {
+			t.Fatalf("expected no pending digests, got %d", s.Pending())
+		}
+	})
+
+	t.Run("disabled window pushes immediately", func(t *testing.T) {
+		q := &TestEnqueuer{}
+		s := NewDigestService(context.Background(), 0, q)
+
+		s.Add(&relay.PushNotification{Type: relay.PushNotificationTypeMessage, Tokens: tokens, Account: "0x1", GroupID: "group1", Body: "a"})
+
+		if len(q.messages) != 1 {
+			t.Fatalf("expected 1 message, got %d", len(q.messages))
+		}
+	})
+}
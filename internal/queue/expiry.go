@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	comm "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+const (
+	expiryMinTick = 1 * time.Second  // smallest interval at which the mempool is checked
+	expiryMaxTick = 30 * time.Second // largest interval at which the mempool is checked
+)
+
+// StartExpiry periodically expires user operations that were queued more than ttl ago
+// until the context is done, a ttl of 0 disables expiry
+func (s *UserOpService) StartExpiry(ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	log.Default().Println("starting userop expiry service")
+
+	tick := min(max(ttl/4, expiryMinTick), expiryMaxTick)
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Default().Println("stopping userop expiry service")
+			return nil
+		case <-ticker.C:
+			s.Expire(ttl)
+		}
+	}
+}
+
+// Expire removes the user operations that were queued more than ttl ago, marks them as failed
+// and lets their sender know
+func (s *UserOpService) Expire(ttl time.Duration) {
+	for _, op := range s.mempool.Expire(ttl) {
+		if op.event == nil {
+			continue
+		}
+
+		opevt, err := nostreth.ParseUserOpEvent(op.event)
+		if err != nil {
+			// TODO: log this error somewhere
+			continue
+		}
+
+		s.fail(opevt, op.event, relay.UserOpReasonExpired)
+
+		s.notifyExpired(op, opevt.UserOpData)
+	}
+}
+
+// notifyExpired pushes a notification to the sender of an expired user operation, tokens
+// are registered per token contract which is the destination of the call
+func (s *UserOpService) notifyExpired(op *MempoolOp, userop nostreth.UserOp) {
+	if s.pushq == nil {
+		return
+	}
+
+	dest, err := comm.ParseDestinationFromCallData(userop.CallData)
+	if err != nil {
+		return
+	}
+
+	ptdb, ok := s.db.GetPushTokenDB(dest.Hex())
+	if !ok {
+		return
+	}
+
+	tokens, err := ptdb.GetAccountTokens(op.Sender)
+	if err != nil || len(tokens) == 0 {
+		return
+	}
+
+	locale := relay.PushLocaleDefault
+	pref, err := s.db.PushPreferenceDB.GetPreference(comm.ChecksumAddress(op.Sender))
+	if err == nil {
+		locale = pref.Locale
+	}
+
+	id := fmt.Sprintf("push:%s:expired:%s", op.Sender, op.Hash)
+
+	s.pushq.Enqueue(*relay.NewMessage(id, relay.NewUserOpExpiredPushMessage(tokens, locale, op.Hash), 0, nil))
+}
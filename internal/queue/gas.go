@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// most ops held back at once, the ones above are failed so that their senders can send them again
+const maxHeld = 1000
+
+var ErrTooManyHeld = errors.New("too many user operations are held back while the gas price spikes, try again later")
+
+// GasGuard tells whether the gas price spikes
+type GasGuard interface {
+	Spiking() bool
+}
+
+// SetGasGuard holds back the ops that aren't urgent while the gas price spikes, they are put back
+// on q once it calms down
+func (s *UserOpService) SetGasGuard(g GasGuard, q Enqueuer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gas = g
+	s.requeue = q
+}
+
+// Held returns the number of ops held back until the gas price calms down
+func (s *UserOpService) Held() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.held)
+}
+
+// hold keeps an op back when the gas price spikes and it isn't urgent, it returns whether it did
+// and ErrTooManyHeld once maxHeld ops are held. The sender is told right away that the op is held.
+func (s *UserOpService) hold(message relay.Message, ev *nostr.Event) (bool, error) {
+	s.mu.Lock()
+	if s.gas == nil || !s.gas.Spiking() || isUrgent(ev) {
+		s.mu.Unlock()
+		return false, nil
+	}
+
+	if len(s.held) >= maxHeld {
+		s.mu.Unlock()
+		return false, ErrTooManyHeld
+	}
+
+	s.held = append(s.held, message)
+	s.mu.Unlock()
+
+	message.Respond(relay.UserOpStatusHeld, nil)
+
+	return true, nil
+}
+
+// isUrgent returns whether the sender asked for the op to be submitted whatever the gas price
+func isUrgent(ev *nostr.Event) bool {
+	tag := ev.Tags.Find("urgent")
+	return tag != nil && tag[1] == "true"
+}
+
+// ReleaseHeld puts the held ops back on the queue every interval while the gas price is calm
+func (s *UserOpService) ReleaseHeld(interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.release()
+		}
+	}
+}
+
+func (s *UserOpService) release() {
+	s.mu.Lock()
+	if s.gas == nil || s.gas.Spiking() || len(s.held) == 0 {
+		s.mu.Unlock()
+		return
+	}
+
+	held := s.held
+	s.held = nil
+	q := s.requeue
+	s.mu.Unlock()
+
+	log.Default().Printf("userop: gas price calmed down, releasing %d held ops", len(held))
+
+	for _, message := range held {
+		q.Enqueue(message)
+	}
+}
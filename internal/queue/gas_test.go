@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type spiking bool
+
+func (s spiking) Spiking() bool {
+	return bool(s)
+}
+
+func TestHold(t *testing.T) {
+	s := &UserOpService{}
+	s.SetGasGuard(spiking(true), nil)
+
+	held, err := s.hold(relay.Message{}, &nostr.Event{Tags: nostr.Tags{{"urgent", "true"}}})
+	if err != nil || held {
+		t.Fatalf("expected an urgent op to be submitted, got %v %v", held, err)
+	}
+
+	// a bare tag doesn't make an op urgent, its sender is told it is held
+	respch := make(chan relay.MessageResponse, 1)
+	held, err = s.hold(relay.Message{Response: &respch}, &nostr.Event{Tags: nostr.Tags{{"urgent"}}})
+	if err != nil || !held {
+		t.Fatalf("expected the op to be held, got %v %v", held, err)
+	}
+
+	resp := <-respch
+	if resp.Data != relay.UserOpStatusHeld || resp.Err != nil {
+		t.Fatalf("expected a held reply, got %+v", resp)
+	}
+
+	for s.Held() < maxHeld {
+		s.held = append(s.held, relay.Message{})
+	}
+
+	_, err = s.hold(relay.Message{}, &nostr.Event{})
+	if !errors.Is(err, ErrTooManyHeld) {
+		t.Fatalf("expected the op to be rejected once too many are held, got %v", err)
+	}
+}
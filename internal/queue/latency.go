@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"io"
+	"log"
+	"time"
+
+	"github.com/comunifi/relay/internal/metrics"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+// most recent slow messages kept for /debug/runtime
+const maxSlowMessages = 20
+
+// slowMessage is a message that spent longer than the slow threshold in a queue
+type slowMessage struct {
+	ID      string    `json:"id"`
+	Wait    string    `json:"wait"`
+	Process string    `json:"process"`
+	At      time.Time `json:"at"`
+}
+
+// SetSlowThreshold logs the messages that wait and process for longer than d, 0 disables it
+func (s *Service) SetSlowThreshold(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.slowThreshold = d
+}
+
+// observe records how long the messages of a batch waited in the queue before the batch started
+// and how long the batch took to process
+func (s *Service) observe(batch []relay.Message, start, end time.Time) {
+	process := end.Sub(start)
+
+	s.mu.Lock()
+	threshold := s.slowThreshold
+	s.mu.Unlock()
+
+	for _, msg := range batch {
+		wait := time.Duration(0)
+		if !msg.EnqueuedAt.IsZero() {
+			wait = start.Sub(msg.EnqueuedAt)
+		}
+
+		s.wait.Observe(wait.Seconds())
+		s.process.Observe(process.Seconds())
+
+		if threshold <= 0 || wait+process <= threshold {
+			continue
+		}
+
+		log.Default().Printf("%s queue: slow message %s waited %s and processed in %s", s.name, msg.ID, wait, process)
+
+		s.mu.Lock()
+		s.slow = append(s.slow, slowMessage{ID: msg.ID, Wait: wait.String(), Process: process.String(), At: end.UTC()})
+		if len(s.slow) > maxSlowMessages {
+			s.slow = s.slow[len(s.slow)-maxSlowMessages:]
+		}
+		s.slowCount++
+		s.mu.Unlock()
+	}
+}
+
+// latencyState reports the percentiles of the wait and processing times and the recent slow
+// messages
+func (s *Service) latencyState() map[string]any {
+	s.mu.Lock()
+	slow := append([]slowMessage{}, s.slow...)
+	s.mu.Unlock()
+
+	return map[string]any{
+		"wait_p50":    seconds(s.wait.Quantile(0.5)),
+		"wait_p95":    seconds(s.wait.Quantile(0.95)),
+		"wait_p99":    seconds(s.wait.Quantile(0.99)),
+		"process_p50": seconds(s.process.Quantile(0.5)),
+		"process_p95": seconds(s.process.Quantile(0.95)),
+		"process_p99": seconds(s.process.Quantile(0.99)),
+		"slow":        slow,
+	}
+}
+
+func seconds(v float64) string {
+	return time.Duration(v * float64(time.Second)).String()
+}
+
+// Latencies writes the wait and processing time histograms of queues, each labeled with the name
+// of its queue
+type Latencies []*Service
+
+// WriteMetrics writes the latencies of the queues in the prometheus text format
+func (ls Latencies) WriteMetrics(w io.Writer) {
+	metrics.Help(w, "relay_queue_wait_seconds", "histogram", "time messages wait in a queue before being processed")
+	for _, s := range ls {
+		s.wait.Write(w, "relay_queue_wait_seconds", "queue", s.name)
+	}
+
+	metrics.Help(w, "relay_queue_process_seconds", "histogram", "time the batch a message is processed in takes")
+	for _, s := range ls {
+		s.process.Write(w, "relay_queue_process_seconds", "queue", s.name)
+	}
+
+	metrics.Help(w, "relay_queue_slow_messages_total", "counter", "messages that waited and processed for longer than the slow threshold")
+	for _, s := range ls {
+		s.mu.Lock()
+		count := s.slowCount
+		s.mu.Unlock()
+
+		metrics.Sample(w, "relay_queue_slow_messages_total", float64(count), "queue", s.name)
+	}
+}
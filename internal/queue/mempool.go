@@ -0,0 +1,242 @@
+package queue
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	ErrUserOpNotFound = errors.New("user operation is not in the mempool")
+	ErrUserOpInFlight = errors.New("user operation is already part of a bundle")
+	ErrUserOpDropped  = errors.New("user operation was dropped by an operator")
+	ErrUserOpExpired  = errors.New("user operation expired in the queue")
+)
+
+type MempoolStatus string
+
+const (
+	MempoolQueued   MempoolStatus = "queued"
+	MempoolInFlight MempoolStatus = "in_flight"
+)
+
+// MempoolOp is a user operation that was queued and has not been confirmed or failed yet
+type MempoolOp struct {
+	Hash       string        `json:"hash"`
+	Sender     string        `json:"sender"`
+	Paymaster  string        `json:"paymaster"`
+	Status     MempoolStatus `json:"status"`
+	RetryCount int           `json:"retry_count"`
+	TxHash     *string       `json:"tx_hash,omitempty"`
+	QueuedAt   time.Time     `json:"queued_at"`
+	Age        int64         `json:"age"` // seconds since the op was first queued
+
+	sponsor string
+	event   *nostr.Event
+}
+
+type SponsorMempool struct {
+	Sponsor string       `json:"sponsor"`
+	Ops     []*MempoolOp `json:"ops"`
+}
+
+// Mempool keeps track of the user operations between the moment they are queued and the
+// moment their bundle is mined, so that operators can see and drop them
+type Mempool struct {
+	mu      sync.Mutex
+	ops     map[string]*MempoolOp
+	dropped map[string]error // why an op that is still in the queue should be skipped
+
+	now func() time.Time
+}
+
+func NewMempool() *Mempool {
+	return &Mempool{
+		ops:     map[string]*MempoolOp{},
+		dropped: map[string]error{},
+		now:     time.Now,
+	}
+}
+
+// Add marks a user operation as queued, a resubmitted op keeps the time it was first queued
+func (m *Mempool) Add(sponsor, hash, sender, paymaster string, retryCount int, ev *nostr.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.dropped, hash)
+
+	op, ok := m.ops[hash]
+	if !ok {
+		op = &MempoolOp{
+			Hash:     hash,
+			QueuedAt: m.now().UTC(),
+		}
+		m.ops[hash] = op
+	}
+
+	op.Sender = sender
+	op.Paymaster = paymaster
+	op.Status = MempoolQueued
+	op.RetryCount = retryCount
+	op.TxHash = nil
+	op.sponsor = sponsor
+	op.event = ev
+}
+
+// Begin marks a user operation as picked up by the queue, it returns ErrUserOpDropped or
+// ErrUserOpExpired if the op should be skipped
+func (m *Mempool) Begin(hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err, ok := m.dropped[hash]; ok {
+		delete(m.dropped, hash)
+		return err
+	}
+
+	op, ok := m.ops[hash]
+	if ok {
+		op.Status = MempoolInFlight
+	}
+
+	return nil
+}
+
+// Bundle records the hash of the transaction a user operation was submitted in
+func (m *Mempool) Bundle(hash, txHash string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op, ok := m.ops[hash]
+	if !ok {
+		return
+	}
+
+	op.Status = MempoolInFlight
+	op.TxHash = &txHash
+}
+
+// Remove removes a user operation once it is confirmed, failed or rejected
+func (m *Mempool) Remove(hash string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.ops, hash)
+}
+
+// Drop removes a queued user operation, the queue skips it when it gets to it.
+// Ops that were picked up by the queue can't be dropped anymore.
+func (m *Mempool) Drop(hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	op, ok := m.ops[hash]
+	if !ok {
+		return ErrUserOpNotFound
+	}
+
+	if op.Status != MempoolQueued {
+		return ErrUserOpInFlight
+	}
+
+	delete(m.ops, hash)
+	m.dropped[hash] = ErrUserOpDropped
+
+	return nil
+}
+
+// Expire removes the queued user operations that were first queued more than ttl ago and returns
+// them, the queue skips them when it gets to them
+func (m *Mempool) Expire(ttl time.Duration) []*MempoolOp {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	expired := []*MempoolOp{}
+	for hash, op := range m.ops {
+		if op.Status != MempoolQueued || now.Sub(op.QueuedAt) < ttl {
+			continue
+		}
+
+		delete(m.ops, hash)
+		m.dropped[hash] = ErrUserOpExpired
+
+		cp := *op
+		cp.Age = int64(now.Sub(op.QueuedAt).Seconds())
+		expired = append(expired, &cp)
+	}
+
+	return expired
+}
+
+// Snapshot returns the user operations grouped by sponsor, oldest first
+func (m *Mempool) Snapshot() []*SponsorMempool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	bySponsor := map[string]*SponsorMempool{}
+	for _, op := range m.ops {
+		sm, ok := bySponsor[op.sponsor]
+		if !ok {
+			sm = &SponsorMempool{Sponsor: op.sponsor, Ops: []*MempoolOp{}}
+			bySponsor[op.sponsor] = sm
+		}
+
+		cp := *op
+		cp.Age = int64(now.Sub(op.QueuedAt).Seconds())
+		sm.Ops = append(sm.Ops, &cp)
+	}
+
+	sponsors := make([]*SponsorMempool, 0, len(bySponsor))
+	for _, sm := range bySponsor {
+		sort.Slice(sm.Ops, func(i, j int) bool {
+			if sm.Ops[i].QueuedAt.Equal(sm.Ops[j].QueuedAt) {
+				return sm.Ops[i].Hash < sm.Ops[j].Hash
+			}
+			return sm.Ops[i].QueuedAt.Before(sm.Ops[j].QueuedAt)
+		})
+		sponsors = append(sponsors, sm)
+	}
+
+	sort.Slice(sponsors, func(i, j int) bool {
+		return sponsors[i].Sponsor < sponsors[j].Sponsor
+	})
+
+	return sponsors
+}
+
+// Depth returns the number of user operations that are queued or in flight
+func (m *Mempool) Depth() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.ops)
+}
+
+// DebugState reports how many user operations are in each state and the age of the oldest one
+func (m *Mempool) DebugState() any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	counts := map[MempoolStatus]int{}
+	oldest := 0.0
+	for _, op := range m.ops {
+		counts[op.Status]++
+		oldest = max(oldest, now.Sub(op.QueuedAt).Seconds())
+	}
+
+	return map[string]any{
+		"queued":    counts[MempoolQueued],
+		"in_flight": counts[MempoolInFlight],
+		"dropped":   len(m.dropped),
+		"oldest":    oldest,
+	}
+}
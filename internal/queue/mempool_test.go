@@ -0,0 +1,153 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMempool(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	m := NewMempool()
+	m.now = func() time.Time { return now }
+
+	m.Add("0xSponsorB", "0x01", "0xSender1", "0xPaymaster", 0, nil)
+
+	now = now.Add(5 * time.Second)
+	m.Add("0xSponsorA", "0x02", "0xSender2", "0xPaymaster", 0, nil)
+	m.Add("0xSponsorB", "0x03", "0xSender3", "0xPaymaster", 0, nil)
+
+	now = now.Add(10 * time.Second)
+
+	t.Run("Snapshot", func(t *testing.T) {
+		sponsors := m.Snapshot()
+		if len(sponsors) != 2 {
+			t.Fatalf("expected 2 sponsors, got %d", len(sponsors))
+		}
+
+		if sponsors[0].Sponsor != "0xSponsorA" || len(sponsors[0].Ops) != 1 {
+			t.Fatalf("unexpected first sponsor %+v", sponsors[0])
+		}
+
+		b := sponsors[1]
+		if len(b.Ops) != 2 || b.Ops[0].Hash != "0x01" || b.Ops[1].Hash != "0x03" {
+			t.Fatalf("expected ops of sponsor B oldest first, got %+v", b.Ops)
+		}
+
+		if b.Ops[0].Age != 15 || b.Ops[1].Age != 10 {
+			t.Fatalf("unexpected ages %d and %d", b.Ops[0].Age, b.Ops[1].Age)
+		}
+
+		if b.Ops[0].Status != MempoolQueued || b.Ops[0].TxHash != nil {
+			t.Fatalf("expected op to be queued without a bundle, got %+v", b.Ops[0])
+		}
+	})
+
+	t.Run("Bundle", func(t *testing.T) {
+		if err := m.Begin("0x01"); err != nil {
+			t.Fatalf("expected op to be processed, got %v", err)
+		}
+
+		m.Bundle("0x01", "0xTx")
+
+		op := m.Snapshot()[1].Ops[0]
+		if op.Status != MempoolInFlight || op.TxHash == nil || *op.TxHash != "0xTx" {
+			t.Fatalf("expected op to be in flight in 0xTx, got %+v", op)
+		}
+
+		if err := m.Drop("0x01"); err != ErrUserOpInFlight {
+			t.Fatalf("expected %v, got %v", ErrUserOpInFlight, err)
+		}
+	})
+
+	t.Run("Resubmit", func(t *testing.T) {
+		m.Add("0xSponsorB", "0x01", "0xSender1", "0xPaymaster", 1, nil)
+
+		op := m.Snapshot()[1].Ops[0]
+		if op.Status != MempoolQueued || op.TxHash != nil || op.RetryCount != 1 {
+			t.Fatalf("expected op to be queued again, got %+v", op)
+		}
+
+		if op.Age != 15 {
+			t.Fatalf("expected op to keep its queue time, got age %d", op.Age)
+		}
+	})
+
+	t.Run("Drop", func(t *testing.T) {
+		if err := m.Drop("0x02"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := m.Drop("0x02"); err != ErrUserOpNotFound {
+			t.Fatalf("expected %v, got %v", ErrUserOpNotFound, err)
+		}
+
+		if len(m.Snapshot()) != 1 {
+			t.Fatal("expected dropped op to be removed from the snapshot")
+		}
+
+		if err := m.Begin("0x02"); err != ErrUserOpDropped {
+			t.Fatalf("expected %v, got %v", ErrUserOpDropped, err)
+		}
+
+		// the drop only applies once
+		if err := m.Begin("0x02"); err != nil {
+			t.Fatalf("expected drop to be consumed, got %v", err)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		m.Remove("0x01")
+		m.Remove("0x03")
+
+		if len(m.Snapshot()) != 0 {
+			t.Fatal("expected an empty mempool")
+		}
+	})
+}
+
+func TestMempoolExpire(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	m := NewMempool()
+	m.now = func() time.Time { return now }
+
+	m.Add("0xSponsor", "0x01", "0xSender1", "0xPaymaster", 0, nil)
+	m.Add("0xSponsor", "0x02", "0xSender2", "0xPaymaster", 0, nil)
+
+	now = now.Add(30 * time.Second)
+	m.Add("0xSponsor", "0x03", "0xSender3", "0xPaymaster", 0, nil)
+
+	// in flight ops are no longer waiting in the queue
+	if err := m.Begin("0x02"); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(31 * time.Second)
+
+	expired := m.Expire(time.Minute)
+	if len(expired) != 1 || expired[0].Hash != "0x01" {
+		t.Fatalf("expected only 0x01 to expire, got %+v", expired)
+	}
+
+	if expired[0].Age != 61 {
+		t.Fatalf("expected age 61, got %d", expired[0].Age)
+	}
+
+	if len(m.Expire(time.Minute)) != 0 {
+		t.Fatal("expected ops to expire only once")
+	}
+
+	ops := m.Snapshot()[0].Ops
+	if len(ops) != 2 || ops[0].Hash != "0x02" || ops[1].Hash != "0x03" {
+		t.Fatalf("expected 0x02 and 0x03 to remain, got %+v", ops)
+	}
+
+	if err := m.Begin("0x01"); err != ErrUserOpExpired {
+		t.Fatalf("expected %v, got %v", ErrUserOpExpired, err)
+	}
+
+	if err := m.Drop("0x01"); err != ErrUserOpNotFound {
+		t.Fatalf("expected %v, got %v", ErrUserOpNotFound, err)
+	}
+}
@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/citizenwallet/smartcontracts/pkg/contracts/tokenEntryPoint"
+	comm "github.com/comunifi/relay/pkg/common"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// how long the confirmed nonce of a sponsor is trusted while none of its bundles settles
+const nonceTTL = 30 * time.Second
+
+// entryPointABI is parsed once and reused to pack every bundle
+var entryPointABI = sync.OnceValues(func() (*abi.ABI, error) {
+	return tokenEntryPoint.TokenEntryPointMetaData.GetAbi()
+})
+
+type cachedNonce struct {
+	nonce uint64
+	at    time.Time
+}
+
+// nonceCache keeps the confirmed nonce of sponsors between batches. The relay is the only sender of
+// sponsor transactions, so the nonce only moves when one of its bundles settles, which drops it.
+// It is guarded by the mutex of the service so that it moves together with the bundles in progress.
+type nonceCache struct {
+	nonces map[common.Address]cachedNonce
+	now    func() time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{nonces: map[common.Address]cachedNonce{}, now: time.Now}
+}
+
+// get returns the cached nonce of a sponsor
+func (c *nonceCache) get(sponsor common.Address) (uint64, bool) {
+	n, ok := c.nonces[sponsor]
+	if !ok || c.now().Sub(n.at) > nonceTTL {
+		return 0, false
+	}
+
+	return n.nonce, true
+}
+
+func (c *nonceCache) set(sponsor common.Address, nonce uint64) {
+	c.nonces[sponsor] = cachedNonce{nonce: nonce, at: c.now()}
+}
+
+// drop forgets the nonce of a sponsor, it is read from the chain again for the next bundle
+func (c *nonceCache) drop(sponsor common.Address) {
+	delete(c.nonces, sponsor)
+}
+
+// nextNonce returns the nonce of the next bundle of a sponsor, after the bundles in progress
+func (s *UserOpService) nextNonce(sponsor common.Address) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nonce, ok := s.nonces.get(sponsor)
+	if !ok {
+		var err error
+		nonce, err = s.evm.NonceAt(s.ctx, sponsor, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		s.nonces.set(sponsor, nonce)
+	}
+
+	return nonce + uint64(len(s.inProgress[sponsor])), nil
+}
+
+// settle removes a bundle that was mined or dropped from the ones in progress
+func (s *UserOpService) settle(sponsor common.Address, txHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inProgress[sponsor] = comm.Filter(s.inProgress[sponsor], func(h string) bool {
+		return h != txHash
+	})
+	s.nonces.drop(sponsor)
+}
@@ -0,0 +1,38 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestNonceCache(t *testing.T) {
+	now := time.Now()
+	c := newNonceCache()
+	c.now = func() time.Time { return now }
+
+	sponsor := common.HexToAddress("0x01")
+
+	if _, ok := c.get(sponsor); ok {
+		t.Fatal("expected no cached nonce")
+	}
+
+	c.set(sponsor, 7)
+	if n, ok := c.get(sponsor); !ok || n != 7 {
+		t.Fatalf("expected the cached nonce 7, got %d %t", n, ok)
+	}
+
+	// a settled bundle moves the nonce on chain
+	c.drop(sponsor)
+	if _, ok := c.get(sponsor); ok {
+		t.Fatal("expected the nonce to be dropped")
+	}
+
+	// the nonce is read again once it is too old
+	c.set(sponsor, 8)
+	now = now.Add(nonceTTL + time.Second)
+	if _, ok := c.get(sponsor); ok {
+		t.Fatal("expected the nonce to expire")
+	}
+}
@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Submitter sends signed transactions, to a private mempool when it is used for bundles
+type Submitter interface {
+	SendTransaction(tx *types.Transaction) error
+}
+
+// SetPrivateSubmission sends bundles to a private mempool so that they can't be frontrun, a bundle
+// that isn't mined within timeout is sent to the public mempool. The timeout is waited for in whole
+// seconds.
+func (s *UserOpService) SetPrivateSubmission(p Submitter, timeout time.Duration) {
+	s.private = p
+	s.privateTimeout = timeout
+}
+
+// submit sends a bundle, privately when possible, it returns whether it went to the private mempool
+func (s *UserOpService) submit(tx *types.Transaction) (bool, error) {
+	if s.private != nil {
+		err := s.private.SendTransaction(tx)
+		if err == nil {
+			return true, nil
+		}
+
+		log.Default().Printf("userop: private submission of %s failed, sending it publicly: %v", tx.Hash().Hex(), err)
+	}
+
+	return false, s.evm.SendTransaction(tx)
+}
+
+// waitPrivate waits for a bundle sent to the private mempool, it is sent to the public mempool when
+// it isn't mined in time and waited for again. Any other failure is returned as is, a reverted
+// bundle would only revert again.
+func (s *UserOpService) waitPrivate(tx *types.Transaction, timeout int) (*types.Receipt, error) {
+	rcpt, err := s.evm.WaitForTx(tx, int(s.privateTimeout.Seconds()))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return rcpt, err
+	}
+
+	log.Default().Printf("userop: %s was not mined privately within %s, sending it publicly", tx.Hash().Hex(), s.privateTimeout)
+
+	err = s.evm.SendTransaction(tx)
+	if err != nil {
+		// the node may already know it from the private mempool, waiting tells whether it gets mined
+		log.Default().Printf("userop: public submission of %s failed: %v", tx.Hash().Hex(), err)
+	}
+
+	return s.evm.WaitForTx(tx, timeout)
+}
@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeSubmitter is a private mempool that fails with err
+type fakeSubmitter struct {
+	err  error
+	sent []*types.Transaction
+}
+
+func (p *fakeSubmitter) SendTransaction(tx *types.Transaction) error {
+	p.sent = append(p.sent, tx)
+	return p.err
+}
+
+// waitResult is what WaitForTx returns for one call
+type waitResult struct {
+	rcpt *types.Receipt
+	err  error
+}
+
+// fakeEVM sends transactions publicly and answers the waits for them in order
+type fakeEVM struct {
+	relay.EVMRequester
+
+	sendErr error
+	sent    []*types.Transaction
+
+	waits    []waitResult
+	timeouts []int
+}
+
+func (e *fakeEVM) SendTransaction(tx *types.Transaction) error {
+	e.sent = append(e.sent, tx)
+	return e.sendErr
+}
+
+func (e *fakeEVM) WaitForTx(tx *types.Transaction, timeout int) (*types.Receipt, error) {
+	e.timeouts = append(e.timeouts, timeout)
+
+	w := e.waits[0]
+	e.waits = e.waits[1:]
+
+	return w.rcpt, w.err
+}
+
+func newTestTx() *types.Transaction {
+	return types.NewTx(&types.LegacyTx{Nonce: 1, Gas: 21000, GasPrice: big.NewInt(1)})
+}
+
+func TestSubmit(t *testing.T) {
+	tx := newTestTx()
+
+	tests := []struct {
+		name    string
+		private *fakeSubmitter
+		want    bool
+		public  int
+	}{
+		{"without a private mempool", nil, false, 1},
+		{"private", &fakeSubmitter{}, true, 0},
+		{"private submission failed", &fakeSubmitter{err: errors.New("bundle rejected")}, false, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			evm := &fakeEVM{}
+
+			s := &UserOpService{evm: evm}
+			if tc.private != nil {
+				s.SetPrivateSubmission(tc.private, time.Minute)
+			}
+
+			private, err := s.submit(tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if private != tc.want {
+				t.Errorf("expected private=%t, got %t", tc.want, private)
+			}
+
+			if len(evm.sent) != tc.public {
+				t.Errorf("expected %d public submissions, got %d", tc.public, len(evm.sent))
+			}
+		})
+	}
+
+	// a failed public submission is returned
+	evm := &fakeEVM{sendErr: errors.New("nonce too low")}
+	s := &UserOpService{evm: evm}
+
+	_, err := s.submit(tx)
+	if !errors.Is(err, evm.sendErr) {
+		t.Fatalf("expected %v, got %v", evm.sendErr, err)
+	}
+}
+
+func TestWaitPrivate(t *testing.T) {
+	tx := newTestTx()
+	mined := &types.Receipt{Status: types.ReceiptStatusSuccessful}
+	reverted := &types.Receipt{Status: types.ReceiptStatusFailed}
+	errFailed := errors.New("tx failed")
+
+	tests := []struct {
+		name   string
+		waits  []waitResult
+		rcpt   *types.Receipt
+		err    error
+		public int
+	}{
+		{"mined privately", []waitResult{{mined, nil}}, mined, nil, 0},
+		{"reverted privately", []waitResult{{reverted, errFailed}}, reverted, errFailed, 0},
+		{"node error", []waitResult{{nil, errFailed}}, nil, errFailed, 0},
+		{"not mined in time", []waitResult{{nil, context.DeadlineExceeded}, {mined, nil}}, mined, nil, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			evm := &fakeEVM{waits: tc.waits}
+
+			s := &UserOpService{evm: evm}
+			s.SetPrivateSubmission(&fakeSubmitter{}, 90*time.Second)
+
+			rcpt, err := s.waitPrivate(tx, 12)
+			if rcpt != tc.rcpt || !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v (%v), got %v (%v)", tc.rcpt, tc.err, rcpt, err)
+			}
+
+			if len(evm.sent) != tc.public {
+				t.Errorf("expected %d public submissions, got %d", tc.public, len(evm.sent))
+			}
+
+			// the private timeout first, then the public one
+			if evm.timeouts[0] != 90 || (tc.public == 1 && evm.timeouts[1] != 12) {
+				t.Errorf("unexpected timeouts %v", evm.timeouts)
+			}
+		})
+	}
+
+	// a bundle the node already knows from the private mempool is still waited for
+	evm := &fakeEVM{sendErr: errors.New("already known"), waits: []waitResult{{nil, context.DeadlineExceeded}, {mined, nil}}}
+	s := &UserOpService{evm: evm}
+	s.SetPrivateSubmission(&fakeSubmitter{}, time.Minute)
+
+	rcpt, err := s.waitPrivate(tx, 12)
+	if err != nil || rcpt != mined {
+		t.Fatalf("expected the bundle to be mined, got %v (%v)", rcpt, err)
+	}
+}
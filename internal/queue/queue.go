@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
+	"github.com/comunifi/relay/internal/debug"
+	"github.com/comunifi/relay/internal/metrics"
 	"github.com/comunifi/relay/pkg/relay"
 )
 
@@ -22,6 +25,14 @@ type Service struct {
 
 	ctx context.Context // Context to carry deadlines, cancellation signals, and other request-scoped values across API boundaries and between processes
 	err chan error      // to notify errors
+
+	wait    *metrics.Histogram // seconds from enqueue to the start of processing
+	process *metrics.Histogram // seconds the batch of a message took to process
+
+	mu            sync.Mutex
+	slowThreshold time.Duration // 0 doesn't log slow messages
+	slow          []slowMessage // oldest first, up to maxSlowMessages
+	slowCount     uint64
 }
 
 // Processor is an interface that must be implemented by the consumer of the queue
@@ -41,6 +52,8 @@ func NewService(name string, maxRetries, bufferSize int, ctx context.Context) (*
 		bufferSize: bufferSize,                           // Set the buffer size
 		ctx:        ctx,                                  // Set the context
 		err:        err,                                  // Initialize the error channel
+		wait:       metrics.NewHistogram(metrics.LatencyBuckets),
+		process:    metrics.NewHistogram(metrics.LatencyBuckets),
 	}, err
 }
 
@@ -57,9 +70,24 @@ func (s *Service) Enqueue(message relay.Message) {
 		s.err <- errors.New(fmt.Sprintf("%s queue is full", s.name))
 	}
 
+	message.EnqueuedAt = time.Now()
 	s.queue <- message
 }
 
+// Depth returns the number of messages waiting in the queue
+func (s *Service) Depth() int {
+	return len(s.queue)
+}
+
+// DebugState reports how full the queue is and how long messages spend in it
+func (s *Service) DebugState() any {
+	state := s.latencyState()
+	state["queued"] = len(s.queue)
+	state["capacity"] = s.bufferSize
+
+	return state
+}
+
 // Close method sends a signal to the quit channel to stop the service.
 func (s *Service) Close() {
 	s.quit <- true
@@ -75,7 +103,7 @@ func (s *Service) Start(p Processor) error {
 	for {
 		select {
 		case message := <-s.queue:
-			println("message", message.ID)
+			debug.Debugf("%s queue: message %s", s.name, message.ID)
 			// Create a batch
 			batch := make([]relay.Message, 0, batchSize)
 
@@ -97,9 +125,11 @@ func (s *Service) Start(p Processor) error {
 				}
 			}
 
-			println("batch", len(batch))
+			debug.Debugf("%s queue: processing a batch of %d", s.name, len(batch))
 
+			start := time.Now()
 			msgs, errs := p.Process(batch)
+			s.observe(batch, start, time.Now())
 			for i, msg := range msgs {
 				err := errs[i]
 				if err != nil {
@@ -152,3 +152,29 @@ func TestProcessMessages(t *testing.T) {
 		// TODO: implement
 	})
 }
+
+func TestObserve(t *testing.T) {
+	q, _ := NewService("push", 3, 10, nil)
+	q.SetSlowThreshold(time.Second)
+
+	start := time.Now()
+	q.observe([]relay.Message{
+		{ID: "fast", EnqueuedAt: start.Add(-100 * time.Millisecond)},
+		{ID: "slow", EnqueuedAt: start.Add(-2 * time.Second)},
+	}, start, start.Add(50*time.Millisecond))
+
+	if q.wait.Count() != 2 || q.process.Count() != 2 {
+		t.Fatalf("expected both messages to be observed, got %d and %d", q.wait.Count(), q.process.Count())
+	}
+
+	if len(q.slow) != 1 || q.slow[0].ID != "slow" {
+		t.Fatalf("expected the slow message to be kept, got %+v", q.slow)
+	}
+
+	var b strings.Builder
+	Latencies{q}.WriteMetrics(&b)
+
+	if !strings.Contains(b.String(), `relay_queue_slow_messages_total{queue="push"} 1`) || !strings.Contains(b.String(), `relay_queue_wait_seconds_count{queue="push"} 2`) {
+		t.Fatalf("unexpected metrics\n%s", b.String())
+	}
+}
@@ -2,9 +2,9 @@ package queue
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
+	"log"
 	"math/big"
 	"strings"
 	"sync"
@@ -12,31 +12,51 @@ import (
 
 	"github.com/citizenwallet/smartcontracts/pkg/contracts/tokenEntryPoint"
 	nostreth "github.com/comunifi/nostr-eth"
+	ethevent "github.com/comunifi/nostr-eth/pkg/event"
 	"github.com/comunifi/relay/internal/db"
 	nost "github.com/comunifi/relay/internal/nostr"
+	"github.com/comunifi/relay/internal/signer"
 	comm "github.com/comunifi/relay/pkg/common"
 	"github.com/comunifi/relay/pkg/relay"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/nbd-wtf/go-nostr"
 )
 
 type UserOpService struct {
 	ctx        context.Context
 	inProgress map[common.Address][]string
+	nonces     *nonceCache
+	signers    *signer.Cache
+	mempool    *Mempool
+	pushq      Enqueuer
 	mu         sync.Mutex
 	chainID    *big.Int
 	db         *db.DB
 	n          *nost.Nostr
 	evm        relay.EVMRequester
+
+	verifier        ReceiptSource // nil unless receipts are verified against a second node
+	verifyThreshold *big.Int
+
+	private        Submitter // nil unless bundles go to a private mempool
+	privateTimeout time.Duration
+
+	gas     GasGuard // nil unless ops are held back while the gas price spikes
+	requeue Enqueuer
+	held    []relay.Message
 }
 
 func NewUserOpService(ctx context.Context, chainID *big.Int, db *db.DB, n *nost.Nostr,
-	evm relay.EVMRequester) *UserOpService {
+	evm relay.EVMRequester, mempool *Mempool, pushq Enqueuer) *UserOpService {
 	return &UserOpService{
 		ctx:        ctx,
 		inProgress: map[common.Address][]string{},
+		nonces:     newNonceCache(),
+		signers:    signer.NewCache(nil),
+		mempool:    mempool,
+		pushq:      pushq,
 		chainID:    chainID,
 		db:         db,
 		n:          n,
@@ -44,12 +64,34 @@ func NewUserOpService(ctx context.Context, chainID *big.Int, db *db.DB, n *nost.
 	}
 }
 
+// SetSigners sets where the signers of sponsors come from, remote signers need it to reach AWS KMS
+func (s *UserOpService) SetSigners(c *signer.Cache) {
+	s.signers = c
+}
+
 // Process method processes messages of type []relay.Message and returns processed messages and an errors if any.
 func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Message, errors []error) {
 	println("processing", len(messages), "messages")
 	invalid = []relay.Message{}
 	errors = []error{}
 
+	// ops that were not submitted are no longer pending
+	defer func() {
+		for _, message := range invalid {
+			opm, ok := message.Message.(relay.UserOpMessage)
+			if !ok {
+				continue
+			}
+
+			op, err := nostreth.ParseUserOpEvent(opm.Event)
+			if err != nil {
+				continue
+			}
+
+			s.mempool.Remove(op.UserOpData.GetHash(s.chainID))
+		}
+	}()
+
 	messagesBySponsor := map[common.Address][]relay.Message{}
 	opBySponsor := map[common.Address][]relay.UserOpMessage{}
 
@@ -71,6 +113,28 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 			continue
 		}
 
+		// the op stays pending in the mempool until the gas price calms down
+		held, err := s.hold(message, opm.Event)
+		if err != nil {
+			s.fail(op, opm.Event, relay.UserOpReasonCongested)
+			invalid = append(invalid, message)
+			errors = append(errors, err)
+			continue
+		}
+
+		if held {
+			continue
+		}
+
+		err = s.mempool.Begin(op.UserOpData.GetHash(s.chainID))
+		if err != nil {
+			// expired ops were already marked as failed when they expired
+			if err == ErrUserOpDropped {
+				s.fail(op, opm.Event, relay.UserOpReasonDropped)
+			}
+			continue
+		}
+
 		// Fetch the sponsor's corresponding private key from the database
 		sponsorKey, err := s.db.SponsorDB.GetSponsor(op.Paymaster.Hex())
 		if err != nil {
@@ -79,20 +143,14 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 			continue
 		}
 
-		// Generate ecdsa.PrivateKey from bytes
-		privateKey, err := comm.HexToPrivateKey(sponsorKey.PrivateKey)
+		// the address that submits the bundles, the key may be held by a remote signer
+		sponsor, err := sponsorKey.Address()
 		if err != nil {
 			invalid = append(invalid, message)
 			errors = append(errors, err)
 			continue
 		}
 
-		// Get the public key from the private key
-		publicKey := privateKey.Public().(*ecdsa.PublicKey)
-
-		// Convert the public key to an Ethereum address
-		sponsor := crypto.PubkeyToAddress(*publicKey)
-
 		messagesBySponsor[sponsor] = append(messagesBySponsor[sponsor], message)
 		opBySponsor[sponsor] = append(opBySponsor[sponsor], opm)
 	}
@@ -123,8 +181,8 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 			continue
 		}
 
-		// Generate ecdsa.PrivateKey from bytes
-		privateKey, err := comm.HexToPrivateKey(sponsorKey.PrivateKey)
+		// the signer of the sponsor's bundles, local or remote
+		txSigner, err := s.signers.For(s.ctx, sponsorKey)
 		if err != nil {
 			invalid = append(invalid, msgs...)
 			for range msgs {
@@ -133,8 +191,8 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 			continue
 		}
 
-		// Get the nonce for the sponsor's address
-		nonce, err := s.evm.NonceAt(context.Background(), sponsor, nil)
+		// Get the nonce for the sponsor's address, incremented by the transactions in progress
+		nonce, err := s.nextNonce(sponsor)
 		if err != nil {
 			invalid = append(invalid, msgs...)
 			for range msgs {
@@ -143,12 +201,8 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 			continue
 		}
 
-		// Get the in progress transactions for the entrypoint and increment the nonce
-		inProgress := s.inProgress[sponsor]
-		nonce += uint64(len(inProgress))
-
-		// Parse the contract ABI
-		parsedABI, err := tokenEntryPoint.TokenEntryPointMetaData.GetAbi()
+		// the contract ABI is parsed once
+		parsedABI, err := entryPointABI()
 		if err != nil {
 			invalid = append(invalid, msgs...)
 			for range msgs {
@@ -192,7 +246,7 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 		}
 
 		// Sign the transaction
-		signedTx, err := types.SignTx(tx, types.NewLondonSigner(s.chainID), privateKey)
+		signedTx, err := txSigner.SignTx(s.ctx, tx, s.chainID)
 		if err != nil {
 			invalid = append(invalid, msgs...)
 			for range msgs {
@@ -208,7 +262,16 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 		s.inProgress[sponsor] = append(s.inProgress[sponsor], signedTxHash)
 		s.mu.Unlock()
 
-		insertedLogs := map[common.Address][]*nostreth.Log{}
+		for _, op := range ops {
+			opevt, err := nostreth.ParseUserOpEvent(op.Event)
+			if err != nil {
+				continue
+			}
+
+			s.mempool.Bundle(opevt.UserOpData.GetHash(s.chainID), signedTxHash)
+		}
+
+		insertedLogs := map[common.Address][]*relay.Log{}
 
 		edb := s.db.EventDB
 
@@ -266,7 +329,7 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 				continue
 			}
 
-			log := &nostreth.Log{
+			log := &relay.Log{
 				TxHash:    signedTxHash,
 				ChainID:   s.chainID.String(),
 				CreatedAt: time.Now().UTC(),
@@ -299,7 +362,7 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 			}
 
 			println("creating user op executed event")
-			ev, err := nostreth.UpdateUserOpEvent(s.chainID, userop, &signedTxHash, 0, nostreth.EventTypeUserOpExecuted, op.Event)
+			ev, err := s.updateUserOpEvent(userop, &signedTxHash, 0, nostreth.EventTypeUserOpExecuted, op.Event)
 			if err != nil {
 				// TODO: log this error somewhere
 				continue
@@ -318,7 +381,7 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 		}
 
 		// Send the signed transaction
-		err = s.evm.SendTransaction(signedTx)
+		private, err := s.submit(signedTx)
 		if err != nil {
 			println("error sending transaction", err.Error())
 			// If there's an error, check if it's an RPC error
@@ -337,7 +400,7 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 						}
 						userop := opevt.UserOpData
 
-						ev, err := nostreth.UpdateUserOpEvent(s.chainID, userop, &signedTxHash, opevt.RetryCount+1, nostreth.EventTypeUserOpSubmitted, opm.Event)
+						ev, err := s.updateUserOpEvent(userop, &signedTxHash, opevt.RetryCount+1, nostreth.EventTypeUserOpSubmitted, opm.Event)
 						if err != nil {
 							// TODO: log this error somewhere
 							continue
@@ -358,11 +421,7 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 				}
 
 				// remove from inProgress
-				s.mu.Lock()
-				s.inProgress[sponsor] = comm.Filter(s.inProgress[sponsor], func(s string) bool {
-					return s != signedTxHash
-				})
-				s.mu.Unlock()
+				s.settle(sponsor, signedTxHash)
 				continue
 			}
 			if ok && e.ErrorCode() != -32000 {
@@ -375,11 +434,7 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 				}
 
 				// remove from inProgress
-				s.mu.Lock()
-				s.inProgress[sponsor] = comm.Filter(s.inProgress[sponsor], func(s string) bool {
-					return s != signedTxHash
-				})
-				s.mu.Unlock()
+				s.settle(sponsor, signedTxHash)
 				continue
 			}
 
@@ -394,11 +449,7 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 				}
 
 				// remove from inProgress
-				s.mu.Lock()
-				s.inProgress[sponsor] = comm.Filter(s.inProgress[sponsor], func(s string) bool {
-					return s != signedTxHash
-				})
-				s.mu.Unlock()
+				s.settle(sponsor, signedTxHash)
 				continue
 			}
 
@@ -409,11 +460,7 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 			}
 
 			// remove from inProgress
-			s.mu.Lock()
-			s.inProgress[sponsor] = comm.Filter(s.inProgress[sponsor], func(s string) bool {
-				return s != signedTxHash
-			})
-			s.mu.Unlock()
+			s.settle(sponsor, signedTxHash)
 			continue
 		}
 
@@ -424,7 +471,31 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 
 		go func() {
 			// async wait for the transaction to be mined
-			err = s.evm.WaitForTx(signedTx, 12)
+			wait := s.evm.WaitForTx
+			if private {
+				wait = s.waitPrivate
+			}
+
+			rcpt, err := wait(signedTx, 12)
+			if rcpt != nil {
+				// gas is paid by the sponsor whether the tx succeeded or not
+				err := s.recordSpend(sponsor, signedTxHash, ops, rcpt)
+				if err != nil {
+					// TODO: log this error somewhere
+					log.Default().Printf("error recording sponsor spend: %v", err)
+				}
+			}
+
+			// high value bundles are confirmed once a second node agrees on their receipt
+			reason := ""
+			if err == nil {
+				err = s.verifyBundle(ops, rcpt)
+				if err != nil {
+					logUnverified(signedTxHash, err)
+					reason = relay.UserOpReasonUnverified
+				}
+			}
+
 			if err != nil {
 				// TODO: log this error somewhere, submitted but then was not mined within a reasonable amount of time
 				for _, op := range ops {
@@ -435,12 +506,16 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 					}
 					userop := opevt.UserOpData
 
-					ev, err := nostreth.UpdateUserOpEvent(s.chainID, userop, &signedTxHash, opevt.RetryCount, nostreth.EventTypeUserOpFailed, op.Event)
+					ev, err := s.updateUserOpEvent(userop, &signedTxHash, opevt.RetryCount, nostreth.EventTypeUserOpFailed, op.Event)
 					if err != nil {
 						// TODO: log this error somewhere
 						continue
 					}
 
+					if reason != "" {
+						ev = nost.SetUserOpReason(reason, ev)
+					}
+
 					ev, err = s.n.SignAndReplaceEvent(s.ctx, ev)
 					if err != nil {
 						// TODO: log this error somewhere
@@ -461,7 +536,7 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 					}
 					userop := opevt.UserOpData
 
-					ev, err := nostreth.UpdateUserOpEvent(s.chainID, userop, &signedTxHash, opevt.RetryCount, nostreth.EventTypeUserOpConfirmed, op.Event)
+					ev, err := s.updateUserOpEvent(userop, &signedTxHash, opevt.RetryCount, nostreth.EventTypeUserOpConfirmed, op.Event)
 					if err != nil {
 						// TODO: log this error somewhere
 						continue
@@ -481,14 +556,98 @@ func (s *UserOpService) Process(messages []relay.Message) (invalid []relay.Messa
 				}
 			}
 
+			for _, op := range ops {
+				opevt, err := nostreth.ParseUserOpEvent(op.Event)
+				if err != nil {
+					continue
+				}
+
+				s.mempool.Remove(opevt.UserOpData.GetHash(s.chainID))
+			}
+
 			// remove from inProgress
-			s.mu.Lock()
-			s.inProgress[sponsor] = comm.Filter(s.inProgress[sponsor], func(s string) bool {
-				return s != signedTxHash
-			})
-			s.mu.Unlock()
+			s.settle(sponsor, signedTxHash)
 		}()
 	}
 
 	return invalid, errors
 }
+
+// recordSpend splits the fee of a mined bundle evenly between its user operations and stores it
+func (s *UserOpService) recordSpend(sponsor common.Address, txHash string, ops []relay.UserOpMessage, rcpt *types.Receipt) error {
+	if len(ops) == 0 || rcpt.EffectiveGasPrice == nil {
+		return nil
+	}
+
+	count := uint64(len(ops))
+
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(rcpt.GasUsed), rcpt.EffectiveGasPrice)
+	feeShare, feeRemainder := new(big.Int).DivMod(fee, new(big.Int).SetUint64(count), new(big.Int))
+	gasShare, gasRemainder := rcpt.GasUsed/count, rcpt.GasUsed%count
+
+	spends := []*relay.SponsorSpend{}
+	for i, op := range ops {
+		opevt, err := nostreth.ParseUserOpEvent(op.Event)
+		if err != nil {
+			continue
+		}
+		userop := opevt.UserOpData
+
+		dest, err := comm.ParseDestinationFromCallData(userop.CallData)
+		if err != nil {
+			dest = common.Address{}
+		}
+
+		paymaster := ""
+		if opevt.Paymaster != nil {
+			paymaster = opevt.Paymaster.Hex()
+		}
+
+		sp := &relay.SponsorSpend{
+			TxHash:      txHash,
+			UserOpHash:  userop.GetHash(s.chainID),
+			Paymaster:   paymaster,
+			Sponsor:     sponsor.Hex(),
+			Sender:      userop.Sender.Hex(),
+			Destination: dest.Hex(),
+			GasUsed:     gasShare,
+			FeeWei:      new(big.Int).Set(feeShare),
+			CreatedAt:   time.Now().UTC(),
+		}
+
+		// the first op pays for the rounding
+		if i == 0 {
+			sp.GasUsed += gasRemainder
+			sp.FeeWei.Add(sp.FeeWei, feeRemainder)
+		}
+
+		spends = append(spends, sp)
+	}
+
+	return s.db.SpendDB.AddSpend(spends)
+}
+
+// fail publishes a failed lifecycle update for an op that was never submitted
+func (s *UserOpService) fail(op *ethevent.UserOpEvent, ev *nostr.Event, reason string) {
+	uev, err := s.updateUserOpEvent(op.UserOpData, nil, op.RetryCount, nostreth.EventTypeUserOpFailed, ev)
+	if err != nil {
+		// TODO: log this error somewhere
+		return
+	}
+
+	_, err = s.n.SignAndReplaceEvent(s.ctx, nost.SetUserOpReason(reason, uev))
+	if err != nil {
+		// TODO: log this error somewhere
+		log.Default().Printf("error marking user op as %s: %v", reason, err)
+	}
+}
+
+// updateUserOpEvent creates a lifecycle update for a user operation, addressed by its deterministic identifier
+func (s *UserOpService) updateUserOpEvent(userop nostreth.UserOp, txHash *string, retryCount int, eventType ethevent.EventTypeUserOp, ev *nostr.Event) (*nostr.Event, error) {
+	uev, err := nostreth.UpdateUserOpEvent(s.chainID, userop, txHash, retryCount, eventType, ev)
+	if err != nil {
+		return nil, err
+	}
+
+	return nost.SetUserOpIdentifier(s.chainID, userop.GetHash(s.chainID), uev), nil
+}
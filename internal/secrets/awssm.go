@@ -0,0 +1,115 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// SecretsManager reads secrets from AWS Secrets Manager with the default credential chain, the
+// AWS keys of the relay may themselves be kept there so they can't be used
+type SecretsManager struct {
+	endpoint string
+	region   string
+	creds    aws.CredentialsProvider
+	signer   *v4.Signer
+	client   *http.Client
+}
+
+// NewSecretsManager loads the default credentials, the endpoint defaults to the regional one
+func NewSecretsManager(ctx context.Context, region, endpoint string) (*SecretsManager, error) {
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", awsCfg.Region)
+	}
+
+	return &SecretsManager{
+		endpoint: endpoint,
+		region:   awsCfg.Region,
+		creds:    awsCfg.Credentials,
+		signer:   v4.NewSigner(),
+		client:   &http.Client{Timeout: storeTimeout},
+	}, nil
+}
+
+// Get returns the current version of a secret, a key picks a field of a secret stored as json
+func (s *SecretsManager) Get(ctx context.Context, path, key string) (string, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": path})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	creds, err := s.creds.Retrieve(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(body)
+	err = s.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "secretsmanager", s.region, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(b, &e)
+
+		return "", fmt.Errorf("secrets manager read of %s failed with %d: %s %s", path, resp.StatusCode, e.Type, e.Message)
+	}
+
+	var out struct {
+		SecretString string
+	}
+	err = json.Unmarshal(b, &out)
+	if err != nil {
+		return "", err
+	}
+
+	if key == "" {
+		return out.SecretString, nil
+	}
+
+	var fields map[string]any
+	err = json.Unmarshal([]byte(out.SecretString), &fields)
+	if err != nil {
+		return "", fmt.Errorf("secret %s is not json, it has no field %q", path, key)
+	}
+
+	return field(fields, key)
+}
@@ -0,0 +1,162 @@
+// Package secrets resolves settings that point to where a secret is kept instead of holding it.
+//
+// A setting is read from a file when NAME_FILE is set, the way Docker and Kubernetes mount
+// secrets, and from a secret store when its value is a reference such as
+// "vault:secret/data/relay#db_password" or "awssm:relay/production#db_password". The part after
+// # picks a field of a secret that holds several.
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileSuffix is appended to the name of a setting to read it from a file
+const FileSuffix = "_FILE"
+
+var (
+	ErrUnknownStore = errors.New("unknown secret store")
+	ErrNoField      = errors.New("the secret has no such field")
+)
+
+// Store fetches a secret, key picks a field of the secret and may be empty
+type Store interface {
+	Get(ctx context.Context, path, key string) (string, error)
+}
+
+// Resolver reads secrets from files and from the configured stores
+type Resolver struct {
+	stores map[string]Store
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		stores: map[string]Store{},
+	}
+}
+
+// SetStore makes the references with the scheme resolve with the store
+func (r *Resolver) SetStore(scheme string, s Store) {
+	r.stores[scheme] = s
+}
+
+// HasStore reports whether references with the scheme can be resolved
+func (r *Resolver) HasStore(scheme string) bool {
+	_, ok := r.stores[scheme]
+	return ok
+}
+
+// IsRef reports whether a value references a secret store instead of holding the secret
+func IsRef(v string) bool {
+	scheme, path, ok := strings.Cut(v, ":")
+	if !ok || path == "" {
+		return false
+	}
+
+	switch scheme {
+	case "vault", "awssm":
+		return true
+	}
+
+	return false
+}
+
+// Resolve returns the secret a reference points to
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	if path, ok := strings.CutPrefix(ref, "file:"); ok {
+		return ReadFile(path)
+	}
+
+	scheme, rest, _ := strings.Cut(ref, ":")
+
+	s, ok := r.stores[scheme]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownStore, scheme)
+	}
+
+	path, key, _ := strings.Cut(rest, "#")
+
+	return s.Get(ctx, path, key)
+}
+
+// ReadFile reads a secret from a file, the trailing newline editors and echo add is dropped
+func ReadFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// Watcher resolves secrets again to find the ones that were rotated at the source
+type Watcher struct {
+	r    *Resolver
+	refs map[string]string
+	sums map[string][32]byte
+}
+
+// NewWatcher watches the references by name, values are the secrets they resolved to at startup
+func NewWatcher(r *Resolver, refs map[string]string, values map[string]string) *Watcher {
+	w := &Watcher{
+		r:    r,
+		refs: refs,
+		sums: map[string][32]byte{},
+	}
+
+	for name := range refs {
+		w.sums[name] = sha256.Sum256([]byte(values[name]))
+	}
+
+	return w
+}
+
+// Check returns the names of the secrets whose value changed since the last check, a secret that
+// can't be resolved is reported as an error and checked again next time
+func (w *Watcher) Check(ctx context.Context) ([]string, error) {
+	rotated := []string{}
+	var errs []error
+	for name, ref := range w.refs {
+		v, err := w.r.Resolve(ctx, ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		sum := sha256.Sum256([]byte(v))
+		if sum != w.sums[name] {
+			w.sums[name] = sum
+			rotated = append(rotated, name)
+		}
+	}
+
+	return rotated, errors.Join(errs...)
+}
+
+// Run checks the secrets at every interval until the context is done
+func (w *Watcher) Run(ctx context.Context, interval time.Duration, onRotate func(name string)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			rotated, err := w.Check(ctx)
+			if err != nil {
+				log.Default().Println("unable to check secrets: ", err)
+			}
+
+			for _, name := range rotated {
+				onRotate(name)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/relay":
+			w.Write([]byte(`{"data":{"data":{"db_password":"kv2","relay_key":"abc"},"metadata":{"version":3}}}`))
+		case "/v1/kv/relay":
+			w.Write([]byte(`{"data":{"db_password":"kv1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	r := NewResolver()
+	r.SetStore("vault", NewVault(srv.URL, "token"))
+
+	ctx := context.Background()
+	for ref, want := range map[string]string{
+		"vault:secret/data/relay#db_password": "kv2",
+		"vault:kv/relay#db_password":          "kv1",
+		"vault:kv/relay":                      "kv1",
+	} {
+		got, err := r.Resolve(ctx, ref)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %q, got %q %v", ref, want, got, err)
+		}
+	}
+
+	// a secret with several fields needs one to be picked
+	if _, err := r.Resolve(ctx, "vault:secret/data/relay"); err == nil {
+		t.Error("expected an error without a field")
+	}
+
+	if _, err := r.Resolve(ctx, "vault:secret/data/relay#missing"); !errors.Is(err, ErrNoField) {
+		t.Errorf("expected %v, got %v", ErrNoField, err)
+	}
+
+	if _, err := r.Resolve(ctx, "awssm:relay#db_password"); !errors.Is(err, ErrUnknownStore) {
+		t.Errorf("expected %v, got %v", ErrUnknownStore, err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_password")
+	err := os.WriteFile(path, []byte("first\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewResolver()
+	refs := map[string]string{"DB_PASSWORD": "file:" + path}
+
+	v, err := r.Resolve(context.Background(), refs["DB_PASSWORD"])
+	if err != nil || v != "first" {
+		t.Fatalf("expected the trailing newline to be dropped, got %q %v", v, err)
+	}
+
+	w := NewWatcher(r, refs, map[string]string{"DB_PASSWORD": v})
+
+	rotated, err := w.Check(context.Background())
+	if err != nil || len(rotated) != 0 {
+		t.Fatalf("expected no rotation, got %v %v", rotated, err)
+	}
+
+	err = os.WriteFile(path, []byte("second"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err = w.Check(context.Background())
+	if err != nil || !slices.Equal(rotated, []string{"DB_PASSWORD"}) {
+		t.Fatalf("expected DB_PASSWORD to be rotated, got %v %v", rotated, err)
+	}
+
+	// a rotation is reported once
+	rotated, _ = w.Check(context.Background())
+	if len(rotated) != 0 {
+		t.Fatalf("expected no rotation, got %v", rotated)
+	}
+}
+
+func TestIsRef(t *testing.T) {
+	for v, want := range map[string]bool{
+		"vault:secret/data/relay#key": true,
+		"awssm:relay/production":      true,
+		"vault:":                      false,
+		"https://rpc.example.com":     false,
+		"engine-pass-local":           false,
+	} {
+		if IsRef(v) != want {
+			t.Errorf("%q: expected %v", v, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// how long a single call to a secret store can take
+const storeTimeout = 10 * time.Second
+
+// Vault reads secrets from the kv engine of HashiCorp Vault, both versions of the engine are
+// supported
+type Vault struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+func NewVault(addr, token string) *Vault {
+	return &Vault{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: storeTimeout},
+	}
+}
+
+func (v *Vault) Get(ctx context.Context, path, key string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v1/%s", v.addr, strings.TrimPrefix(path, "/")), nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault read of %s failed with %d", path, resp.StatusCode)
+	}
+
+	var out struct {
+		Data map[string]any `json:"data"`
+	}
+	err = json.Unmarshal(b, &out)
+	if err != nil {
+		return "", err
+	}
+
+	// kv version 2 nests the secret with its metadata
+	fields := out.Data
+	if nested, ok := out.Data["data"].(map[string]any); ok {
+		if _, ok := out.Data["metadata"]; ok {
+			fields = nested
+		}
+	}
+
+	return field(fields, key)
+}
+
+// field picks a field of a secret, a secret with a single field doesn't need the key
+func field(fields map[string]any, key string) (string, error) {
+	if key == "" {
+		if len(fields) != 1 {
+			return "", fmt.Errorf("the secret has %d fields, pick one with #field", len(fields))
+		}
+
+		for k := range fields {
+			key = k
+		}
+	}
+
+	v, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrNoField, key)
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q is not a string", key)
+	}
+
+	return s, nil
+}
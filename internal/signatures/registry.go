@@ -0,0 +1,252 @@
+package signatures
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// UnknownIndexed is used when the number of indexed arguments of an event is not known
+const UnknownIndexed = -1
+
+var ErrSignatureNotFound = errors.New("event signature not found")
+
+// common events, several standards can share a topic0 with a different number of indexed arguments
+var builtin = []string{
+	// ERC-20
+	"Transfer(address indexed from, address indexed to, uint256 value)",
+	"Approval(address indexed owner, address indexed spender, uint256 value)",
+
+	// ERC-721
+	"Transfer(address indexed from, address indexed to, uint256 indexed tokenId)",
+	"Approval(address indexed owner, address indexed approved, uint256 indexed tokenId)",
+	"ApprovalForAll(address indexed owner, address indexed operator, bool approved)",
+
+	// ERC-1155
+	"TransferSingle(address indexed operator, address indexed from, address indexed to, uint256 id, uint256 value)",
+	"TransferBatch(address indexed operator, address indexed from, address indexed to, uint256[] ids, uint256[] values)",
+	"URI(string value, uint256 indexed id)",
+
+	// WETH
+	"Deposit(address indexed dst, uint256 wad)",
+	"Withdrawal(address indexed src, uint256 wad)",
+
+	// ERC-4337
+	"UserOperationEvent(bytes32 indexed userOpHash, address indexed sender, address indexed paymaster, uint256 nonce, bool success, uint256 actualGasCost, uint256 actualGasUsed)",
+	"AccountDeployed(bytes32 indexed userOpHash, address indexed sender, address factory, address paymaster)",
+
+	// access control and proxies
+	"OwnershipTransferred(address indexed previousOwner, address indexed newOwner)",
+	"RoleGranted(bytes32 indexed role, address indexed account, address indexed sender)",
+	"RoleRevoked(bytes32 indexed role, address indexed account, address indexed sender)",
+	"Upgraded(address indexed implementation)",
+	"Paused(address account)",
+	"Unpaused(address account)",
+}
+
+type candidate struct {
+	signature string
+	indexed   int
+}
+
+// Registry resolves topic0 hashes to human readable event signatures from a built-in list
+// and optionally from a signature database (openchain compatible lookup api)
+type Registry struct {
+	client *http.Client
+	dbURL  string
+
+	mu     sync.Mutex
+	known  map[string][]candidate
+	looked map[string][]string // type signatures found in the database, by topic
+}
+
+// NewRegistry creates a new registry, an empty dbURL only uses the built-in signatures
+func NewRegistry(dbURL string) *Registry {
+	r := &Registry{
+		client: &http.Client{Timeout: 10 * time.Second},
+		dbURL:  strings.TrimSuffix(dbURL, "/"),
+		known:  map[string][]candidate{},
+		looked: map[string][]string{},
+	}
+
+	for _, sig := range builtin {
+		r.add(sig)
+	}
+
+	return r
+}
+
+func (r *Registry) add(sig string) {
+	ev := &relay.Event{EventSignature: sig}
+
+	topic := strings.ToLower(ev.GetTopic0FromEventSignature().Hex())
+
+	_, _, argTypes := ev.ParseEventSignature()
+
+	indexed := 0
+	for _, a := range argTypes {
+		if a.Indexed {
+			indexed++
+		}
+	}
+
+	r.known[topic] = append(r.known[topic], candidate{signature: sig, indexed: indexed})
+}
+
+// Resolve returns the signature of a topic0, indexed is the number of indexed arguments
+// as seen in a log (number of topics - 1) or UnknownIndexed
+func (r *Registry) Resolve(ctx context.Context, topic string, indexed int) (string, error) {
+	topic = strings.ToLower(topic)
+
+	r.mu.Lock()
+	candidates, ok := r.known[topic]
+	sigs, looked := r.looked[topic]
+	r.mu.Unlock()
+
+	if !ok && !looked && r.dbURL != "" {
+		found, err := r.lookup(ctx, topic)
+		if err != nil {
+			return "", err
+		}
+
+		// another caller may have looked the topic up meanwhile, the first answer is kept
+		r.mu.Lock()
+		if _, looked = r.looked[topic]; !looked {
+			r.looked[topic] = found
+		}
+		sigs, looked = r.looked[topic], true
+		r.mu.Unlock()
+	}
+
+	if !ok && looked {
+		// the database only knows types, assume indexed arguments come first
+		for _, sig := range sigs {
+			candidates = append(candidates, candidate{signature: withIndexed(sig, indexed), indexed: indexed})
+		}
+		ok = true
+	}
+
+	if !ok || len(candidates) == 0 {
+		return "", ErrSignatureNotFound
+	}
+
+	if indexed == UnknownIndexed {
+		return candidates[0].signature, nil
+	}
+
+	for _, c := range candidates {
+		if c.indexed == indexed {
+			return c.signature, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: no signature with %d indexed arguments", ErrSignatureNotFound, indexed)
+}
+
+type lookupResponse struct {
+	Ok     bool `json:"ok"`
+	Result struct {
+		Event map[string][]struct {
+			Name     string `json:"name"`
+			Filtered bool   `json:"filtered"`
+		} `json:"event"`
+	} `json:"result"`
+}
+
+// lookup fetches the text signatures of a topic0 from the signature database
+func (r *Registry) lookup(ctx context.Context, topic string) ([]string, error) {
+	q := url.Values{}
+	q.Set("event", topic)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.dbURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from signature database: %d", resp.StatusCode)
+	}
+
+	var lr lookupResponse
+	err = json.NewDecoder(resp.Body).Decode(&lr)
+	if err != nil {
+		return nil, err
+	}
+
+	sigs := []string{}
+	for _, s := range lr.Result.Event[topic] {
+		if s.Filtered {
+			continue
+		}
+
+		sigs = append(sigs, s.Name)
+	}
+
+	return sigs, nil
+}
+
+// withIndexed marks the first n arguments of a type only signature as indexed
+// Example: withIndexed("Transfer(address,address,uint256)", 2) = "Transfer(address indexed,address indexed,uint256)"
+func withIndexed(sig string, n int) string {
+	parts := strings.SplitN(sig, "(", 2)
+	if len(parts) != 2 || n <= 0 {
+		return sig
+	}
+
+	args := strings.Split(strings.TrimSuffix(parts[1], ")"), ",")
+	for i := range args {
+		if i < n && args[i] != "" {
+			args[i] += " indexed"
+		}
+	}
+
+	return fmt.Sprintf("%s(%s)", parts[0], strings.Join(args, ","))
+}
+
+// number of recent blocks searched for a sample log
+const sampleBlocks = 10000
+
+// ResolveContract resolves the signature of a topic0 using a recent log of the contract
+// to know how many arguments are indexed
+func (r *Registry) ResolveContract(ctx context.Context, evm relay.EVMRequester, contract, topic string) (string, error) {
+	indexed := UnknownIndexed
+
+	latest, err := evm.LatestBlock()
+	if err == nil {
+		from := new(big.Int).Sub(latest, big.NewInt(sampleBlocks))
+		if from.Sign() < 0 {
+			from = big.NewInt(0)
+		}
+
+		logs, err := evm.FilterLogs(ethereum.FilterQuery{
+			FromBlock: from,
+			ToBlock:   latest,
+			Addresses: []common.Address{common.HexToAddress(contract)},
+			Topics:    [][]common.Hash{{common.HexToHash(topic)}},
+		})
+		if err == nil && len(logs) > 0 {
+			indexed = len(logs[0].Topics) - 1
+		}
+	}
+
+	return r.Resolve(ctx, topic, indexed)
+}
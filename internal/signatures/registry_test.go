@@ -0,0 +1,111 @@
+package signatures
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+const transferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+func TestResolve(t *testing.T) {
+	r := NewRegistry("")
+	ctx := context.Background()
+
+	t.Run("erc20 transfer", func(t *testing.T) {
+		sig, err := r.Resolve(ctx, transferTopic, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sig != "Transfer(address indexed from, address indexed to, uint256 value)" {
+			t.Errorf("unexpected signature %s", sig)
+		}
+	})
+
+	t.Run("erc721 transfer", func(t *testing.T) {
+		sig, err := r.Resolve(ctx, transferTopic, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sig != "Transfer(address indexed from, address indexed to, uint256 indexed tokenId)" {
+			t.Errorf("unexpected signature %s", sig)
+		}
+	})
+
+	t.Run("unknown indexed uses the first candidate", func(t *testing.T) {
+		sig, err := r.Resolve(ctx, transferTopic, UnknownIndexed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sig != "Transfer(address indexed from, address indexed to, uint256 value)" {
+			t.Errorf("unexpected signature %s", sig)
+		}
+	})
+
+	t.Run("unknown topic", func(t *testing.T) {
+		_, err := r.Resolve(ctx, "0x0000000000000000000000000000000000000000000000000000000000000000", UnknownIndexed)
+		if !errors.Is(err, ErrSignatureNotFound) {
+			t.Errorf("expected ErrSignatureNotFound, got %v", err)
+		}
+	})
+}
+
+func TestResolveFromDatabase(t *testing.T) {
+	const topic = "0x1111111111111111111111111111111111111111111111111111111111111111"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"ok":true,"result":{"event":{"%s":[{"name":"Moved(address,uint256)","filtered":false}]}}}`, r.URL.Query().Get("event"))
+	}))
+	defer srv.Close()
+
+	r := NewRegistry(srv.URL)
+	ctx := context.Background()
+
+	// concurrent misses keep a single copy of the signatures
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := r.Resolve(ctx, topic, UnknownIndexed)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(r.looked[topic]) != 1 {
+		t.Fatalf("expected a single signature, got %v", r.looked[topic])
+	}
+
+	// the first caller doesn't decide the indexed arguments of the next ones
+	for indexed, want := range map[int]string{
+		UnknownIndexed: "Moved(address,uint256)",
+		1:              "Moved(address indexed,uint256)",
+		2:              "Moved(address indexed,uint256 indexed)",
+	} {
+		sig, err := r.Resolve(ctx, topic, indexed)
+		if err != nil || sig != want {
+			t.Errorf("expected %s with %d indexed, got %s %v", want, indexed, sig, err)
+		}
+	}
+}
+
+func TestWithIndexed(t *testing.T) {
+	if sig := withIndexed("Transfer(address,address,uint256)", 2); sig != "Transfer(address indexed,address indexed,uint256)" {
+		t.Errorf("unexpected signature %s", sig)
+	}
+
+	if sig := withIndexed("Paused(address)", UnknownIndexed); sig != "Paused(address)" {
+		t.Errorf("unexpected signature %s", sig)
+	}
+}
@@ -0,0 +1,226 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// how long a single call to KMS can take
+const kmsTimeout = 10 * time.Second
+
+// KMSConfig configures the access to AWS KMS, the default credential chain is used when no keys are set
+type KMSConfig struct {
+	Region      string
+	AccessKeyID string
+	SecretKey   string
+	Endpoint    string // defaults to the regional endpoint
+}
+
+// KMS signs with an ECC_SECG_P256K1 key kept in AWS KMS, the key never leaves KMS
+type KMS struct {
+	keyID    string
+	endpoint string
+	region   string
+	creds    aws.CredentialsProvider
+	signer   *v4.Signer
+	client   *http.Client
+
+	addr common.Address
+}
+
+// NewKMS fetches the public key of a KMS key to find the address it signs for
+func NewKMS(ctx context.Context, cfg *KMSConfig, keyID string) (*KMS, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(cfg.Region)}
+	if cfg.AccessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretKey, "")))
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com/", awsCfg.Region)
+	}
+
+	k := &KMS{
+		keyID:    keyID,
+		endpoint: endpoint,
+		region:   awsCfg.Region,
+		creds:    awsCfg.Credentials,
+		signer:   v4.NewSigner(),
+		client:   &http.Client{Timeout: kmsTimeout},
+	}
+
+	var out struct {
+		PublicKey []byte
+	}
+	err = k.call(ctx, "GetPublicKey", map[string]string{"KeyId": keyID}, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	k.addr, err = kmsAddress(out.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (k *KMS) Address() common.Address {
+	return k.addr
+}
+
+func (k *KMS) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signer := types.NewLondonSigner(chainID)
+	hash := signer.Hash(tx)
+
+	var out struct {
+		Signature []byte
+	}
+	err := k.call(ctx, "Sign", map[string]any{
+		"KeyId":            k.keyID,
+		"Message":          hash.Bytes(),
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": "ECDSA_SHA_256",
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := kmsSignature(hash.Bytes(), out.Signature, k.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.WithSignature(signer, sig)
+}
+
+// call sends a request to the KMS json api signed with SigV4
+func (k *KMS) call(ctx context.Context, action string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, kmsTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+
+	creds, err := k.creds.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(body)
+	err = k.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "kms", k.region, time.Now())
+	if err != nil {
+		return err
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(b, &e)
+
+		return fmt.Errorf("kms %s failed with %d: %s %s", action, resp.StatusCode, e.Type, e.Message)
+	}
+
+	return json.Unmarshal(b, out)
+}
+
+// kmsAddress returns the address of a DER encoded public key
+func kmsAddress(der []byte) (common.Address, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+
+	_, err := asn1.Unmarshal(der, &spki)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	pub, err := crypto.UnmarshalPubkey(spki.PublicKey.Bytes)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("kms key is not a secp256k1 key: %w", err)
+	}
+
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// kmsSignature turns a DER encoded signature into the 65 bytes ethereum expects, KMS doesn't return
+// the recovery id so it is found by recovering the address
+func kmsSignature(hash, der []byte, addr common.Address) ([]byte, error) {
+	var rs struct {
+		R, S *big.Int
+	}
+
+	_, err := asn1.Unmarshal(der, &rs)
+	if err != nil {
+		return nil, err
+	}
+
+	// ethereum only accepts the lower of the two valid s values
+	n := crypto.S256().Params().N
+	if rs.S.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		rs.S = new(big.Int).Sub(n, rs.S)
+	}
+
+	sig := make([]byte, crypto.SignatureLength)
+	rs.R.FillBytes(sig[:32])
+	rs.S.FillBytes(sig[32:64])
+
+	for v := byte(0); v < 2; v++ {
+		sig[crypto.RecoveryIDOffset] = v
+
+		pub, err := crypto.SigToPub(hash, sig)
+		if err == nil && crypto.PubkeyToAddress(*pub) == addr {
+			return sig, nil
+		}
+	}
+
+	return nil, errors.New("kms signature does not recover to the key address")
+}
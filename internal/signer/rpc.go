@@ -0,0 +1,116 @@
+package signer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrTxMismatch is returned when a remote signer signs another transaction than the one it was sent
+var ErrTxMismatch = errors.New("remote signer signed a different transaction")
+
+// RPC signs with eth_signTransaction on a json-rpc signer such as web3signer
+type RPC struct {
+	client *rpc.Client
+	addr   common.Address
+}
+
+func NewRPC(ctx context.Context, url string, addr common.Address) (*RPC, error) {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RPC{client: client, addr: addr}, nil
+}
+
+func (r *RPC) Address() common.Address {
+	return r.addr
+}
+
+func (r *RPC) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	args := map[string]any{
+		"from":    r.addr,
+		"to":      tx.To(),
+		"gas":     hexutil.Uint64(tx.Gas()),
+		"nonce":   hexutil.Uint64(tx.Nonce()),
+		"value":   (*hexutil.Big)(tx.Value()),
+		"data":    hexutil.Bytes(tx.Data()),
+		"chainId": (*hexutil.Big)(chainID),
+	}
+
+	if tx.Type() == types.LegacyTxType {
+		args["gasPrice"] = (*hexutil.Big)(tx.GasPrice())
+	} else {
+		args["maxFeePerGas"] = (*hexutil.Big)(tx.GasFeeCap())
+		args["maxPriorityFeePerGas"] = (*hexutil.Big)(tx.GasTipCap())
+	}
+
+	var result json.RawMessage
+	err := r.client.CallContext(ctx, &result, "eth_signTransaction", args)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := rawTx(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.verify(tx, raw, chainID)
+}
+
+// rawTx reads the signed transaction, web3signer returns it as is and geth wraps it in an object
+func rawTx(result json.RawMessage) ([]byte, error) {
+	var raw hexutil.Bytes
+	if err := json.Unmarshal(result, &raw); err == nil {
+		return raw, nil
+	}
+
+	var wrapped struct {
+		Raw hexutil.Bytes `json:"raw"`
+	}
+
+	err := json.Unmarshal(result, &wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped.Raw) == 0 {
+		return nil, errors.New("remote signer returned no transaction")
+	}
+
+	return wrapped.Raw, nil
+}
+
+// verify makes sure the remote signer signed the transaction it was sent with the sponsor key
+func (r *RPC) verify(tx *types.Transaction, raw []byte, chainID *big.Int) (*types.Transaction, error) {
+	signed := new(types.Transaction)
+
+	err := signed.UnmarshalBinary(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := types.NewLondonSigner(chainID)
+	if signer.Hash(signed) != signer.Hash(tx) {
+		return nil, ErrTxMismatch
+	}
+
+	from, err := types.Sender(signer, signed)
+	if err != nil {
+		return nil, err
+	}
+
+	if from != r.addr {
+		return nil, ErrAddressMismatch
+	}
+
+	return signed, nil
+}
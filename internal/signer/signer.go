@@ -0,0 +1,151 @@
+// Package signer signs the bundles of sponsors.
+//
+// A sponsor either has its key in the database, encrypted, or a remote signer that keeps the key
+// out of the relay: a key in AWS KMS (kms:<key id>) or a json-rpc signer such as web3signer
+// (rpc:<url>). Remote signers are created once per sponsor and cached until the sponsor key is
+// rotated.
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	comm "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// schemes of remote signers
+const (
+	SchemeKMS = "kms"
+	SchemeRPC = "rpc"
+)
+
+// ErrAddressMismatch is returned when a remote signer signs for another address than the sponsor's
+var ErrAddressMismatch = errors.New("remote signer address does not match the sponsor")
+
+// Signer signs the transactions of a sponsor
+type Signer interface {
+	Address() common.Address
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// Local signs with a key held by the relay
+type Local struct {
+	key *ecdsa.PrivateKey
+}
+
+func NewLocal(hexKey string) (*Local, error) {
+	key, err := comm.HexToPrivateKey(hexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{key: key}, nil
+}
+
+func (l *Local) Address() common.Address {
+	return crypto.PubkeyToAddress(l.key.PublicKey)
+}
+
+func (l *Local) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.NewLondonSigner(chainID), l.key)
+}
+
+// ParseRemote splits a remote signer into its scheme and target
+func ParseRemote(remote string) (string, string, error) {
+	scheme, target, ok := strings.Cut(remote, ":")
+	if !ok || target == "" {
+		return "", "", fmt.Errorf("invalid remote signer %q, expected kms:<key id> or rpc:<url>", remote)
+	}
+
+	switch scheme {
+	case SchemeKMS, SchemeRPC:
+		return scheme, target, nil
+	}
+
+	return "", "", fmt.Errorf("unknown remote signer %q, expected kms or rpc", scheme)
+}
+
+// NewRemote creates the signer of a remote key, the address is required for json-rpc signers and
+// checked against the key for KMS
+func NewRemote(ctx context.Context, kms *KMSConfig, remote, address string) (Signer, error) {
+	scheme, target, err := ParseRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Signer
+	switch scheme {
+	case SchemeKMS:
+		if kms == nil {
+			return nil, errors.New("kms signers are not configured")
+		}
+
+		s, err = NewKMS(ctx, kms, target)
+	case SchemeRPC:
+		if !common.IsHexAddress(address) {
+			return nil, errors.New("rpc signers require the address they sign for")
+		}
+
+		s, err = NewRPC(ctx, target, common.HexToAddress(address))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if address != "" && s.Address() != common.HexToAddress(address) {
+		return nil, ErrAddressMismatch
+	}
+
+	return s, nil
+}
+
+// Cache creates the signers of sponsors and keeps them until their key is rotated
+type Cache struct {
+	kms *KMSConfig // nil unless kms signers can be used
+
+	mu      sync.Mutex
+	signers map[string]Signer
+}
+
+func NewCache(kms *KMSConfig) *Cache {
+	return &Cache{
+		kms:     kms,
+		signers: map[string]Signer{},
+	}
+}
+
+// For returns the signer of the bundles of a sponsor
+func (c *Cache) For(ctx context.Context, sp *relay.Sponsor) (Signer, error) {
+	if sp.RemoteSigner == "" {
+		return NewLocal(sp.PrivateKey)
+	}
+
+	key := sp.Contract + "|" + sp.RemoteSigner + "|" + sp.KeyRotatedAt.String()
+
+	c.mu.Lock()
+	s, ok := c.signers[key]
+	c.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	s, err := NewRemote(ctx, c.kms, sp.RemoteSigner, sp.RemoteAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.signers[key] = s
+	c.mu.Unlock()
+
+	return s, nil
+}
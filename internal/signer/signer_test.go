@@ -0,0 +1,100 @@
+package signer
+
+import (
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestKMSSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	hash := crypto.Keccak256([]byte("bundle"))
+
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+
+	// KMS returns either of the two valid s values
+	high := new(big.Int).Sub(crypto.S256().Params().N, s)
+
+	for _, s := range []*big.Int{s, high} {
+		der, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := kmsSignature(hash, der, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pub, err := crypto.SigToPub(hash, got)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if crypto.PubkeyToAddress(*pub) != addr {
+			t.Fatal("expected the signature to recover to the key address")
+		}
+	}
+
+	der, _ := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if _, err := kmsSignature(hash, der, common.HexToAddress("0x01")); err == nil {
+		t.Fatal("expected a signature of another key to be refused")
+	}
+}
+
+func TestRPCVerify(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chainID := big.NewInt(100)
+	to := common.HexToAddress("0x5815E61eF72c9E6107b5c5A05FD121F334f7a7f1")
+
+	tx := types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Nonce: 1, To: &to, Gas: 100000, GasFeeCap: big.NewInt(2), GasTipCap: big.NewInt(1)})
+
+	r := &RPC{addr: crypto.PubkeyToAddress(key.PublicKey)}
+
+	sign := func(tx *types.Transaction) []byte {
+		signed, err := types.SignTx(tx, types.NewLondonSigner(chainID), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw, err := signed.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return raw
+	}
+
+	if _, err := r.verify(tx, sign(tx), chainID); err != nil {
+		t.Fatal(err)
+	}
+
+	other := types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Nonce: 2, To: &to, Gas: 100000, GasFeeCap: big.NewInt(2), GasTipCap: big.NewInt(1)})
+	if _, err := r.verify(tx, sign(other), chainID); err != ErrTxMismatch {
+		t.Fatalf("expected %v, got %v", ErrTxMismatch, err)
+	}
+
+	r.addr = common.HexToAddress("0x01")
+	if _, err := r.verify(tx, sign(tx), chainID); err != ErrAddressMismatch {
+		t.Fatalf("expected %v, got %v", ErrAddressMismatch, err)
+	}
+}
@@ -0,0 +1,104 @@
+package startup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	DefaultRetries    = 10
+	DefaultBackoff    = time.Second
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Backoff configures how long to wait between attempts, the wait doubles after every
+// failed attempt up to Max
+type Backoff struct {
+	Retries int
+	Initial time.Duration
+	Max     time.Duration
+}
+
+func (b Backoff) limit() time.Duration {
+	if b.Max <= 0 {
+		return DefaultMaxBackoff
+	}
+
+	return b.Max
+}
+
+func (b Backoff) delay(attempt int) time.Duration {
+	d := b.Initial
+	if d <= 0 {
+		d = DefaultBackoff
+	}
+
+	for i := 0; i < attempt && d < b.limit(); i++ {
+		d *= 2
+	}
+
+	return min(d, b.limit())
+}
+
+// Retry calls fn until it succeeds or the retries are used up, so that the relay can start
+// before the services it depends on are ready
+func Retry(ctx context.Context, name string, b Backoff, fn func() error) error {
+	var err error
+	for attempt := 0; attempt <= b.Retries; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		if attempt == b.Retries {
+			break
+		}
+
+		d := b.delay(attempt)
+		log.Default().Printf("waiting for %s (attempt %d/%d): %v, retrying in %s", name, attempt+1, b.Retries+1, err, d)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+
+	return fmt.Errorf("%s not ready after %d attempts: %w", name, b.Retries+1, err)
+}
+
+// Supervise runs a long running service and restarts it with a backoff when it fails instead
+// of stopping the relay, it only returns once the context is done. The backoff is reset when
+// the service ran for longer than the maximum backoff.
+func Supervise(ctx context.Context, name string, b Backoff, fn func() error) error {
+	attempt := 0
+	for {
+		started := time.Now()
+
+		err := fn()
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if time.Since(started) > b.limit() {
+			attempt = 0
+		}
+
+		d := b.delay(attempt)
+		attempt++
+
+		if err != nil {
+			log.Default().Printf("%s stopped: %v, restarting in %s", name, err, d)
+		} else {
+			log.Default().Printf("%s stopped, restarting in %s", name, d)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d):
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 5 * time.Second}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, d := range expected {
+		if got := b.delay(attempt); got != d {
+			t.Errorf("attempt %d: expected %s, got %s", attempt, d, got)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	b := Backoff{Retries: 3, Initial: time.Millisecond, Max: time.Millisecond}
+
+	calls := 0
+	err := Retry(context.Background(), "db", b, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("expected success on the third call, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = Retry(context.Background(), "db", b, func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	if err == nil || calls != 4 {
+		t.Fatalf("expected an error after 4 calls, got %v after %d calls", err, calls)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Retry(ctx, "rpc", Backoff{Retries: 10, Initial: time.Hour}, func() error {
+		return errors.New("down")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestSupervise(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runs := 0
+	err := Supervise(ctx, "indexer", Backoff{Initial: time.Millisecond, Max: time.Millisecond}, func() error {
+		runs++
+		if runs == 3 {
+			cancel()
+		}
+		return errors.New("rpc unavailable")
+	})
+	if err != nil {
+		t.Fatalf("expected nil once the context is done, got %v", err)
+	}
+
+	if runs != 3 {
+		t.Errorf("expected 3 runs, got %d", runs)
+	}
+}
@@ -0,0 +1,280 @@
+// Package status gathers the state operators need at a glance, queue depths, sponsor balances,
+// indexer lag, recent errors and groups, and serves it as a small dashboard.
+package status
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/indexer"
+	"github.com/comunifi/relay/internal/webhook"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/fiatjaf/eventstore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// KindGroupMetadata is the kind of the metadata the relay publishes for each group
+const KindGroupMetadata = 39000
+
+// how long gathering the state can take before the page is served with what was gathered
+const gatherTimeout = 10 * time.Second
+
+//go:embed status.html
+var page string
+
+var pageTmpl = template.Must(template.New("status").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		return time.Since(t).Truncate(time.Second).String()
+	},
+}).Parse(page))
+
+// Queue is a queue whose depth is reported
+type Queue interface {
+	Depth() int
+}
+
+// Indexer reports how far the logs of registered events were indexed
+type Indexer interface {
+	Progress() []indexer.Progress
+}
+
+// Incidents returns the latest warnings and errors
+type Incidents interface {
+	Recent() []webhook.Incident
+}
+
+type QueueDepth struct {
+	Name  string `json:"name"`
+	Depth int    `json:"depth"`
+}
+
+type SponsorBalance struct {
+	Paymaster       string     `json:"paymaster"`
+	Sponsor         string     `json:"sponsor"`
+	Signer          string     `json:"signer"`  // the sponsor when the paymaster has no signer key
+	Balance         string     `json:"balance"` // in ether
+	KeyRotatedAt    time.Time  `json:"key_rotated_at"`
+	SignerRotatedAt *time.Time `json:"signer_rotated_at,omitempty"`
+}
+
+// Snapshot is the state shown on the dashboard, a section that couldn't be gathered is left empty
+// and the reason is listed in problems
+type Snapshot struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Head        uint64             `json:"head"`
+	Queues      []QueueDepth       `json:"queues"`
+	Sponsors    []SponsorBalance   `json:"sponsors"`
+	Indexer     []indexer.Progress `json:"indexer"`
+	Incidents   []webhook.Incident `json:"incidents"`
+	Groups      int64              `json:"groups"`
+	Problems    []string           `json:"problems"`
+}
+
+type Service struct {
+	db        *db.DB
+	evm       relay.EVMRequester
+	counter   eventstore.Counter
+	incidents Incidents
+
+	// how long the sponsor and signer keys are used before they are due for rotation, 0 never
+	keyRotation    time.Duration
+	signerRotation time.Duration
+
+	mu      sync.Mutex
+	queues  []namedQueue
+	indexer Indexer // nil unless the indexer runs
+}
+
+type namedQueue struct {
+	name string
+	q    Queue
+}
+
+func NewService(d *db.DB, evm relay.EVMRequester, c eventstore.Counter, i Incidents) *Service {
+	return &Service{
+		db:        d,
+		evm:       evm,
+		counter:   c,
+		incidents: i,
+	}
+}
+
+// AddQueue reports the depth of a queue
+func (s *Service) AddQueue(name string, q Queue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queues = append(s.queues, namedQueue{name: name, q: q})
+}
+
+// SetRotation reports the sponsor and signer keys that are older than their rotation schedule
+func (s *Service) SetRotation(key, signer time.Duration) {
+	s.keyRotation = key
+	s.signerRotation = signer
+}
+
+// SetIndexer reports the lag of the indexer
+func (s *Service) SetIndexer(i Indexer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.indexer = i
+}
+
+// Gather collects the current state
+func (s *Service) Gather(ctx context.Context) *Snapshot {
+	ctx, cancel := context.WithTimeout(ctx, gatherTimeout)
+	defer cancel()
+
+	snap := &Snapshot{
+		GeneratedAt: time.Now().UTC(),
+		Queues:      []QueueDepth{},
+		Sponsors:    []SponsorBalance{},
+		Indexer:     []indexer.Progress{},
+		Incidents:   s.incidents.Recent(),
+		Problems:    []string{},
+	}
+
+	s.mu.Lock()
+	queues := append([]namedQueue{}, s.queues...)
+	idx := s.indexer
+	s.mu.Unlock()
+
+	for _, nq := range queues {
+		snap.Queues = append(snap.Queues, QueueDepth{Name: nq.name, Depth: nq.q.Depth()})
+	}
+
+	head, err := s.evm.LatestBlock()
+	if err != nil {
+		snap.Problems = append(snap.Problems, "chain head: "+err.Error())
+	} else {
+		snap.Head = head.Uint64()
+	}
+
+	if idx != nil {
+		snap.Indexer = append(snap.Indexer, idx.Progress()...)
+	}
+
+	sponsors, err := s.sponsorBalances()
+	if err != nil {
+		snap.Problems = append(snap.Problems, "sponsors: "+err.Error())
+	}
+	snap.Sponsors = append(snap.Sponsors, sponsors...)
+	snap.Problems = append(snap.Problems, s.rotationProblems(sponsors, snap.GeneratedAt)...)
+
+	groups, err := s.counter.CountEvents(ctx, nostr.Filter{Kinds: []int{KindGroupMetadata}})
+	if err != nil {
+		snap.Problems = append(snap.Problems, "groups: "+err.Error())
+	}
+	snap.Groups = groups
+
+	return snap
+}
+
+// sponsorBalances returns the native balance of the sponsor of every paymaster, the sponsors that
+// were read before an error are returned with it
+func (s *Service) sponsorBalances() ([]SponsorBalance, error) {
+	sponsors, err := s.db.SponsorDB.GetSponsors()
+	if err != nil {
+		return nil, err
+	}
+
+	balances := []SponsorBalance{}
+	for _, sp := range sponsors {
+		sponsor, err := sp.Address()
+		if err != nil {
+			return balances, err
+		}
+
+		addr := sponsor.Hex()
+
+		signer := addr
+		if sp.SignerKey != "" {
+			skey, err := com.HexToPrivateKey(sp.SignerKey)
+			if err != nil {
+				return balances, err
+			}
+
+			signer = crypto.PubkeyToAddress(skey.PublicKey).Hex()
+		}
+
+		params, err := json.Marshal([]string{addr, "latest"})
+		if err != nil {
+			return balances, err
+		}
+
+		var balance hexutil.Big
+		err = s.evm.Call("eth_getBalance", &balance, params)
+		if err != nil {
+			return balances, err
+		}
+
+		balances = append(balances, SponsorBalance{
+			Paymaster:       sp.Contract,
+			Sponsor:         addr,
+			Signer:          signer,
+			Balance:         formatEther((*big.Int)(&balance)),
+			KeyRotatedAt:    sp.KeyRotatedAt,
+			SignerRotatedAt: sp.SignerRotatedAt,
+		})
+	}
+
+	return balances, nil
+}
+
+// rotationProblems lists the keys that are older than their rotation schedule, a paymaster without
+// a signer key signs with its sponsor key, which then follows both schedules
+func (s *Service) rotationProblems(sponsors []SponsorBalance, now time.Time) []string {
+	problems := []string{}
+	for _, sp := range sponsors {
+		if s.keyRotation > 0 && now.Sub(sp.KeyRotatedAt) > s.keyRotation {
+			problems = append(problems, "sponsors: the sponsor key of "+sp.Paymaster+" is due for rotation")
+		}
+
+		signedAt := sp.KeyRotatedAt
+		if sp.SignerRotatedAt != nil {
+			signedAt = *sp.SignerRotatedAt
+		}
+
+		if s.signerRotation > 0 && now.Sub(signedAt) > s.signerRotation {
+			problems = append(problems, "sponsors: the signer key of "+sp.Paymaster+" is due for rotation")
+		}
+	}
+
+	return problems
+}
+
+// formatEther formats an amount of wei in ether
+func formatEther(wei *big.Int) string {
+	f := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18))
+	return f.Text('f', 6)
+}
+
+// Get returns the current state
+func (s *Service) Get(w http.ResponseWriter, r *http.Request) {
+	err := com.Body(w, s.Gather(r.Context()), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Page serves the current state as a dashboard
+func (s *Service) Page(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	err := pageTmpl.Execute(w, s.Gather(r.Context()))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,249 @@
+// Package testdb runs a throwaway postgres server for SQL-backed unit tests.
+//
+// A local server is started from the postgres binaries (initdb, pg_ctl) found in
+// PG_BIN or in the PATH, no docker required. TEST_DATABASE_URL can point to an
+// existing server instead. Tests are skipped when neither is available.
+package testdb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	user     = "postgres"
+	password = "postgres"
+
+	startTimeout = 30 * time.Second
+)
+
+type Database struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+}
+
+// URL returns the connection url of the database
+func (d *Database) URL() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password),
+		Host:     net.JoinHostPort(d.Host, d.Port),
+		Path:     d.Name,
+		RawQuery: "sslmode=disable",
+	}
+
+	return u.String()
+}
+
+// Pool opens a connection pool to the database, closed when the test ends
+func (d *Database) Pool(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	pool, err := pgxpool.New(context.Background(), d.URL())
+	if err != nil {
+		t.Fatalf("testdb: failed to connect: %v", err)
+	}
+
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+type server struct {
+	host     string
+	port     string
+	user     string
+	password string
+
+	// set when the server was started by this package
+	dataDir string
+	pgCtl   string
+}
+
+var (
+	once      sync.Once
+	shared    *server
+	sharedErr error
+
+	counter atomic.Int64
+)
+
+// New creates an empty database on the shared test server, the test is skipped
+// when no postgres server can be started
+func New(t testing.TB) *Database {
+	t.Helper()
+
+	once.Do(func() {
+		shared, sharedErr = start()
+	})
+
+	if sharedErr != nil {
+		t.Skipf("testdb: postgres not available: %v", sharedErr)
+	}
+
+	name := fmt.Sprintf("test_%d_%d", os.Getpid(), counter.Add(1))
+
+	admin, err := pgxpool.New(context.Background(), shared.url("postgres"))
+	if err != nil {
+		t.Fatalf("testdb: failed to connect: %v", err)
+	}
+	defer admin.Close()
+
+	_, err = admin.Exec(context.Background(), "CREATE DATABASE "+name)
+	if err != nil {
+		t.Fatalf("testdb: failed to create database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		admin, err := pgxpool.New(context.Background(), shared.url("postgres"))
+		if err != nil {
+			return
+		}
+		defer admin.Close()
+
+		admin.Exec(context.Background(), "DROP DATABASE IF EXISTS "+name+" WITH (FORCE)")
+	})
+
+	return &Database{
+		Host:     shared.host,
+		Port:     shared.port,
+		User:     shared.user,
+		Password: shared.password,
+		Name:     name,
+	}
+}
+
+// Main runs the tests of a package and stops the shared server afterwards,
+// call it from TestMain
+func Main(m *testing.M) {
+	code := m.Run()
+
+	if shared != nil {
+		shared.stop()
+	}
+
+	os.Exit(code)
+}
+
+func (s *server) url(name string) string {
+	d := &Database{Host: s.host, Port: s.port, User: s.user, Password: s.password, Name: name}
+	return d.URL()
+}
+
+// start connects to TEST_DATABASE_URL or starts a local server in a temporary directory
+func start() (*server, error) {
+	if raw := os.Getenv("TEST_DATABASE_URL"); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TEST_DATABASE_URL: %w", err)
+		}
+
+		pass, _ := u.User.Password()
+
+		return &server{
+			host:     u.Hostname(),
+			port:     u.Port(),
+			user:     u.User.Username(),
+			password: pass,
+		}, nil
+	}
+
+	initdb, err := binary("initdb")
+	if err != nil {
+		return nil, err
+	}
+
+	pgCtl, err := binary("pg_ctl")
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "relay-testdb-")
+	if err != nil {
+		return nil, err
+	}
+
+	pwfile := filepath.Join(dir, "pwfile")
+	err = os.WriteFile(pwfile, []byte(password), 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	dataDir := filepath.Join(dir, "data")
+
+	out, err := exec.Command(initdb, "-D", dataDir, "-U", user, "--pwfile", pwfile, "--auth", "trust", "-E", "UTF8").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("initdb failed: %w: %s", err, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	opts := fmt.Sprintf("-h 127.0.0.1 -p %d -k %s -F", port, dir)
+
+	out, err = exec.Command(pgCtl, "-D", dataDir, "-o", opts, "-l", filepath.Join(dir, "log"), "-w", "-t", strconv.Itoa(int(startTimeout.Seconds())), "start").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("pg_ctl start failed: %w: %s", err, out)
+	}
+
+	return &server{
+		host:     "127.0.0.1",
+		port:     strconv.Itoa(port),
+		user:     user,
+		password: password,
+		dataDir:  dataDir,
+		pgCtl:    pgCtl,
+	}, nil
+}
+
+// stop stops the server if it was started by this package and removes its files
+func (s *server) stop() {
+	if s.dataDir == "" {
+		return
+	}
+
+	exec.Command(s.pgCtl, "-D", s.dataDir, "-m", "immediate", "stop").Run()
+	os.RemoveAll(filepath.Dir(s.dataDir))
+}
+
+// binary looks up a postgres binary in PG_BIN first, then in the PATH
+func binary(name string) (string, error) {
+	if dir := os.Getenv("PG_BIN"); dir != "" {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+
+	return exec.LookPath(name)
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
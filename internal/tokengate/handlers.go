@@ -0,0 +1,31 @@
+package tokengate
+
+import (
+	"net/http"
+
+	com "github.com/comunifi/relay/pkg/common"
+)
+
+type Handlers struct {
+	s *Syncer
+}
+
+func NewHandlers(s *Syncer) *Handlers {
+	return &Handlers{
+		s: s,
+	}
+}
+
+// Get returns the report of the latest token gate sync
+func (h *Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	report := h.s.Last()
+	if report == nil {
+		http.Error(w, "no token gate sync ran yet", http.StatusNotFound)
+		return
+	}
+
+	err := com.Body(w, report, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
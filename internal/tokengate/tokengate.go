@@ -0,0 +1,428 @@
+// Package tokengate keeps the membership of groups in sync with token holdings.
+//
+// Groups are gated by a json file:
+//
+//	{
+//	  "groups": [
+//	    {
+//	      "group": "demo",
+//	      "standard": "erc20",
+//	      "token": "0x5FbDB2315678afecb367f032d93F642f64180aa3",
+//	      "min_balance": "1000000",
+//	      "grace_period": "72h"
+//	    }
+//	  ]
+//	}
+//
+// Every interval, pending join requests of holders are accepted with a put-user event and members
+// who hold less than the minimum for longer than the grace period are removed with a remove-user
+// event, both signed by the relay. Admins are never removed. The holdings of a pubkey are read
+// from the address of the same secp256k1 key.
+//
+// In dry run, the report lists the changes without making them.
+package tokengate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/groups"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	StandardERC20  = "erc20"
+	StandardERC721 = "erc721"
+)
+
+type GroupConfig struct {
+	Group       string `json:"group"`
+	Standard    string `json:"standard"`
+	Token       string `json:"token"`
+	MinBalance  string `json:"min_balance"`            // base units for erc20, number of tokens for erc721
+	GracePeriod string `json:"grace_period,omitempty"` // members are removed right away when empty
+}
+
+type Config struct {
+	Groups []GroupConfig `json:"groups"`
+}
+
+// LoadConfig reads the gated groups from a json file
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	err = json.Unmarshal(b, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token gate config %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+type gate struct {
+	group      string
+	token      common.Address
+	minBalance *big.Int
+	grace      time.Duration
+}
+
+func newGate(c GroupConfig) (*gate, error) {
+	if c.Group == "" {
+		return nil, errors.New("gate without a group")
+	}
+
+	if c.Standard != StandardERC20 && c.Standard != StandardERC721 {
+		return nil, fmt.Errorf("gate of %s: standard must be erc20 or erc721", c.Group)
+	}
+
+	if !common.IsHexAddress(c.Token) {
+		return nil, fmt.Errorf("gate of %s: invalid token address %q", c.Group, c.Token)
+	}
+
+	min, ok := new(big.Int).SetString(c.MinBalance, 10)
+	if !ok || min.Sign() <= 0 {
+		return nil, fmt.Errorf("gate of %s: min_balance must be a positive integer", c.Group)
+	}
+
+	var grace time.Duration
+	if c.GracePeriod != "" {
+		var err error
+		grace, err = time.ParseDuration(c.GracePeriod)
+		if err != nil || grace < 0 {
+			return nil, fmt.Errorf("gate of %s: invalid grace_period %q", c.Group, c.GracePeriod)
+		}
+	}
+
+	return &gate{group: c.Group, token: common.HexToAddress(c.Token), minBalance: min, grace: grace}, nil
+}
+
+// Groups reads and updates the membership of groups
+type Groups interface {
+	GetMembers(ctx context.Context, groupID string) ([]string, error)
+	IsAdmin(ctx context.Context, pubkey, groupID string) (bool, error)
+	PendingJoinRequests(ctx context.Context, groupID string) ([]string, error)
+	OnEventSaved(ctx context.Context, event *nostr.Event)
+}
+
+// Publisher signs and stores events authored by the relay
+type Publisher interface {
+	SignAndSaveEvent(ctx context.Context, ev *nostr.Event) (*nostr.Event, error)
+}
+
+type Action string
+
+const (
+	ActionAdd    Action = "add"
+	ActionRemove Action = "remove"
+)
+
+// Change is a member added or removed, or that would be in dry run
+type Change struct {
+	Group   string `json:"group"`
+	Pubkey  string `json:"pubkey"`
+	Account string `json:"account"`
+	Balance string `json:"balance"`
+	Action  Action `json:"action"`
+	Applied bool   `json:"applied"`
+}
+
+// Lapse is a member below the minimum balance who is still in the grace period
+type Lapse struct {
+	Group    string    `json:"group"`
+	Pubkey   string    `json:"pubkey"`
+	Account  string    `json:"account"`
+	Balance  string    `json:"balance"`
+	Since    time.Time `json:"since"`
+	RemoveAt time.Time `json:"remove_at"`
+}
+
+type Report struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Duration  float64   `json:"duration"` // seconds
+	DryRun    bool      `json:"dry_run"`
+	Checked   int       `json:"checked"`
+	Changes   []*Change `json:"changes"`
+	Lapses    []*Lapse  `json:"lapses"`
+	Errors    []string  `json:"errors,omitempty"` // groups that could not be synced
+}
+
+type Syncer struct {
+	ctx    context.Context
+	groups Groups
+	db     *db.DB
+	evm    com.ContractCaller
+	n      Publisher
+
+	gates    []*gate
+	interval time.Duration
+	dryRun   bool
+
+	now func() time.Time
+
+	mu   sync.Mutex
+	last *Report
+}
+
+// NewSyncer checks the gates of the config
+func NewSyncer(ctx context.Context, g Groups, d *db.DB, evm com.ContractCaller, n Publisher, cfg *Config, interval time.Duration, dryRun bool) (*Syncer, error) {
+	gates := []*gate{}
+	for _, c := range cfg.Groups {
+		gt, err := newGate(c)
+		if err != nil {
+			return nil, err
+		}
+
+		gates = append(gates, gt)
+	}
+
+	return &Syncer{
+		ctx:      ctx,
+		groups:   g,
+		db:       d,
+		evm:      evm,
+		n:        n,
+		gates:    gates,
+		interval: interval,
+		dryRun:   dryRun,
+		now:      func() time.Time { return time.Now().UTC() },
+	}, nil
+}
+
+// Start syncs every interval
+func (s *Syncer) Start() error {
+	log.Default().Println("starting token gate sync")
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Default().Println("stopping token gate sync")
+			return nil
+		case <-ticker.C:
+			report := s.Run()
+
+			for _, c := range report.Changes {
+				log.Default().Printf("token gate: %s %s in %s (balance %s, applied %t)", c.Action, c.Pubkey, c.Group, c.Balance, c.Applied)
+			}
+
+			for _, e := range report.Errors {
+				log.Default().Printf("token gate: %s", e)
+			}
+		}
+	}
+}
+
+// Run syncs every gated group once, the report is kept as the latest one
+func (s *Syncer) Run() *Report {
+	start := time.Now()
+
+	report := &Report{
+		CheckedAt: start.UTC(),
+		DryRun:    s.dryRun,
+		Changes:   []*Change{},
+		Lapses:    []*Lapse{},
+	}
+
+	for _, gt := range s.gates {
+		err := s.sync(gt, report)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", gt.group, err))
+		}
+	}
+
+	report.Duration = time.Since(start).Seconds()
+
+	s.mu.Lock()
+	s.last = report
+	s.mu.Unlock()
+
+	return report
+}
+
+// Last returns the latest report or nil if no sync ran yet
+func (s *Syncer) Last() *Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last
+}
+
+func (s *Syncer) sync(gt *gate, report *Report) error {
+	members, err := s.groups.GetMembers(s.ctx, gt.group)
+	if err != nil {
+		return err
+	}
+
+	for _, pubkey := range members {
+		isAdmin, err := s.groups.IsAdmin(s.ctx, pubkey, gt.group)
+		if err != nil {
+			return err
+		}
+		if isAdmin {
+			continue
+		}
+
+		account, balance, err := s.balance(gt, pubkey)
+		if err != nil {
+			return err
+		}
+		report.Checked++
+
+		if balance.Cmp(gt.minBalance) >= 0 {
+			err = s.db.TokenGateDB.ClearLapse(gt.group, pubkey)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// lapses are recorded in dry run too so that the report shows when members would be removed
+		now := s.now()
+		since, err := s.db.TokenGateDB.MarkLapsed(gt.group, pubkey, now)
+		if err != nil {
+			return err
+		}
+
+		removeAt := since.Add(gt.grace)
+		if now.Before(removeAt) {
+			report.Lapses = append(report.Lapses, &Lapse{
+				Group:    gt.group,
+				Pubkey:   pubkey,
+				Account:  account.Hex(),
+				Balance:  balance.String(),
+				Since:    since,
+				RemoveAt: removeAt,
+			})
+			continue
+		}
+
+		c := &Change{Group: gt.group, Pubkey: pubkey, Account: account.Hex(), Balance: balance.String(), Action: ActionRemove}
+		report.Changes = append(report.Changes, c)
+
+		if s.dryRun {
+			continue
+		}
+
+		err = s.publish(groups.KindRemoveUser, gt.group, pubkey)
+		if err != nil {
+			return err
+		}
+		c.Applied = true
+
+		err = s.db.TokenGateDB.ClearLapse(gt.group, pubkey)
+		if err != nil {
+			return err
+		}
+	}
+
+	pending, err := s.groups.PendingJoinRequests(s.ctx, gt.group)
+	if err != nil {
+		return err
+	}
+
+	for _, pubkey := range pending {
+		account, balance, err := s.balance(gt, pubkey)
+		if err != nil {
+			return err
+		}
+		report.Checked++
+
+		if balance.Cmp(gt.minBalance) < 0 {
+			continue
+		}
+
+		c := &Change{Group: gt.group, Pubkey: pubkey, Account: account.Hex(), Balance: balance.String(), Action: ActionAdd}
+		report.Changes = append(report.Changes, c)
+
+		if s.dryRun {
+			continue
+		}
+
+		err = s.publish(groups.KindPutUser, gt.group, pubkey)
+		if err != nil {
+			return err
+		}
+		c.Applied = true
+
+		// a lapse left from an earlier membership must not shorten the grace period
+		err = s.db.TokenGateDB.ClearLapse(gt.group, pubkey)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// balance returns the holdings of the address of a pubkey at the latest block
+func (s *Syncer) balance(gt *gate, pubkey string) (common.Address, *big.Int, error) {
+	account, err := Address(pubkey)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	balance, err := com.BalanceOf(s.evm, gt.token, account, nil)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	return account, balance, nil
+}
+
+// publish signs a moderation event with the relay key and applies it to the group
+func (s *Syncer) publish(kind int, groupID, pubkey string) error {
+	tag := nostr.Tag{"p", pubkey}
+	if kind == groups.KindPutUser {
+		tag = append(tag, groups.RoleMember)
+	}
+
+	ev, err := s.n.SignAndSaveEvent(s.ctx, &nostr.Event{
+		Kind:      kind,
+		CreatedAt: nostr.Timestamp(s.now().Unix()),
+		Tags:      nostr.Tags{{"h", groupID}, tag},
+		Content:   "token gate",
+	})
+	if err != nil {
+		return err
+	}
+
+	// relay signed events don't go through the relay hooks, the member lists are updated here
+	s.groups.OnEventSaved(s.ctx, ev)
+
+	return nil
+}
+
+// Address returns the address of the secp256k1 key of a nostr pubkey, which has an even y
+func Address(pubkey string) (common.Address, error) {
+	x, err := hexutil.Decode("0x" + pubkey)
+	if err != nil || len(x) != 32 {
+		return common.Address{}, fmt.Errorf("invalid pubkey %q", pubkey)
+	}
+
+	key, err := secp256k1.ParsePubKey(slices.Concat([]byte{secp256k1.PubKeyFormatCompressedEven}, x))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid pubkey %q: %w", pubkey, err)
+	}
+
+	return crypto.PubkeyToAddress(*key.ToECDSA()), nil
+}
@@ -0,0 +1,161 @@
+package tokengate
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/groups"
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const testToken = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+type fakeEVM map[common.Address]int64
+
+func (e fakeEVM) CallContract(call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return common.LeftPadBytes(big.NewInt(e[common.BytesToAddress(call.Data[4:])]).Bytes(), 32), nil
+}
+
+func newPubkey(t *testing.T) string {
+	t.Helper()
+
+	pk, err := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pk
+}
+
+func TestAddress(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := crypto.HexToECDSA(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, err := Address(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nostr keys are normalized to an even y, the key of the address may be the negated one
+	negated := new(big.Int).Sub(crypto.S256().Params().N, key.D)
+	negatedKey, err := crypto.ToECDSA(common.LeftPadBytes(negated.Bytes(), 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if addr != crypto.PubkeyToAddress(key.PublicKey) && addr != crypto.PubkeyToAddress(negatedKey.PublicKey) {
+		t.Fatalf("unexpected address %s", addr)
+	}
+
+	_, err = Address("npub")
+	if err == nil {
+		t.Fatal("expected an invalid pubkey to be rejected")
+	}
+}
+
+func TestNewSyncer(t *testing.T) {
+	for _, c := range []GroupConfig{
+		{Standard: StandardERC20, Token: testToken, MinBalance: "1"},
+		{Group: "demo", Standard: "erc1155", Token: testToken, MinBalance: "1"},
+		{Group: "demo", Standard: StandardERC20, Token: "0x1234", MinBalance: "1"},
+		{Group: "demo", Standard: StandardERC721, Token: testToken, MinBalance: "0"},
+		{Group: "demo", Standard: StandardERC721, Token: testToken, MinBalance: "1", GracePeriod: "soon"},
+	} {
+		_, err := NewSyncer(context.Background(), nil, nil, nil, nil, &Config{Groups: []GroupConfig{c}}, time.Hour, false)
+		if err == nil {
+			t.Errorf("expected %+v to be rejected", c)
+		}
+	}
+}
+
+func TestSync(t *testing.T) {
+	d := testutil.NewDB(t)
+
+	admin, holder, lapsed, applicant, poor := newPubkey(t), newPubkey(t), newPubkey(t), newPubkey(t), newPubkey(t)
+
+	evm := fakeEVM{}
+	for pk, balance := range map[string]int64{holder: 100, lapsed: 10, applicant: 100, poor: 10} {
+		addr, err := Address(pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evm[addr] = balance
+	}
+
+	g := &testutil.FakeGroups{
+		Admins:  map[string][]string{"demo": {admin}},
+		Members: map[string][]string{"demo": {admin, holder, lapsed}},
+		Pending: map[string][]string{"demo": {applicant, poor}},
+	}
+
+	cfg := &Config{Groups: []GroupConfig{{Group: "demo", Standard: StandardERC20, Token: testToken, MinBalance: "100", GracePeriod: "1h"}}}
+
+	s, err := NewSyncer(context.Background(), g, d, evm, &testutil.FakeStore{}, cfg, time.Hour, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	s.now = func() time.Time { return now }
+
+	// the lapsed member is in the grace period, dry run only reports the applicant
+	report := s.Run()
+	if len(report.Errors) != 0 {
+		t.Fatal(report.Errors)
+	}
+
+	if len(report.Lapses) != 1 || report.Lapses[0].Pubkey != lapsed || !report.Lapses[0].RemoveAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected lapses %+v", report.Lapses)
+	}
+
+	if len(report.Changes) != 1 || report.Changes[0].Pubkey != applicant || report.Changes[0].Action != ActionAdd || report.Changes[0].Applied {
+		t.Fatalf("unexpected changes %+v", report.Changes)
+	}
+
+	if len(g.Saved) != 0 {
+		t.Fatalf("expected no events in dry run, got %d", len(g.Saved))
+	}
+
+	s.dryRun = false
+	now = now.Add(time.Hour)
+
+	report = s.Run()
+	if len(report.Errors) != 0 {
+		t.Fatal(report.Errors)
+	}
+
+	if len(report.Changes) != 2 || !report.Changes[0].Applied || !report.Changes[1].Applied {
+		t.Fatalf("unexpected changes %+v", report.Changes)
+	}
+
+	if len(g.Saved) != 2 {
+		t.Fatalf("expected two events, got %d", len(g.Saved))
+	}
+
+	remove, add := g.Saved[0], g.Saved[1]
+	if remove.Kind != groups.KindRemoveUser || remove.Tags.GetFirst([]string{"p", lapsed}) == nil {
+		t.Fatalf("unexpected removal %+v", remove)
+	}
+	if add.Kind != groups.KindPutUser || add.Tags.GetFirst([]string{"p", applicant, groups.RoleMember}) == nil {
+		t.Fatalf("unexpected addition %+v", add)
+	}
+}
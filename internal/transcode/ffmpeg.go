@@ -0,0 +1,63 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// FFmpeg transcodes videos with a local ffmpeg binary to h264 and aac, at most 720p, with the index
+// at the start of the file so that playback starts before the download ends
+type FFmpeg struct {
+	path string
+}
+
+// NewFFmpeg transcodes with the ffmpeg binary at path, a name is looked up in the PATH
+func NewFFmpeg(path string) *FFmpeg {
+	return &FFmpeg{path: path}
+}
+
+func (f *FFmpeg) Transcode(ctx context.Context, video []byte, mime string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "transcode")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in")
+	out := filepath.Join(dir, "out.mp4")
+
+	err = os.WriteFile(in, video, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, f.path,
+		"-nostdin", "-y", "-loglevel", "error",
+		"-i", in,
+		"-vf", "scale='min(1280,iw)':'min(720,ih)':force_original_aspect_ratio=decrease:force_divisible_by=2",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "26", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "128k",
+		"-movflags", "+faststart",
+		out,
+	)
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	file, err := os.Open(out)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readOutput(file)
+}
@@ -0,0 +1,42 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// HTTP transcodes videos with an external service: the original is posted with its mime type and
+// the service answers with the mp4
+type HTTP struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTP transcodes with the service at url, requests are bound by the transcode timeout
+func NewHTTP(url string) *HTTP {
+	return &HTTP{url: url, client: &http.Client{}}
+}
+
+func (h *HTTP) Transcode(ctx context.Context, video []byte, mime string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(video))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", mime)
+	req.Header.Set("Accept", OutputType)
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("transcoding service answered %s", resp.Status)
+	}
+
+	return readOutput(resp.Body)
+}
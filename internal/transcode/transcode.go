@@ -0,0 +1,262 @@
+// Package transcode converts uploaded videos to an mp4 that plays on phones.
+//
+// Videos are queued when they are stored and converted by a few workers, with ffmpeg or by an
+// external service the original is posted to. The output is stored as a blob of its own, owned by
+// the uploader and kept in the storage of the group, and the transcode of the original records it so
+// that media listings can point to it.
+//
+// Once the output is ready the uploader is notified with a NIP-94 file metadata event (kind 1063)
+// signed by the relay, tagged with the uploader, the group and the hash of the original (ox). The
+// event references the output so it isn't garbage collected.
+//
+// Transcodes are recorded before they run, the ones that didn't finish are queued again when the
+// relay restarts.
+package transcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/khatru/blossom"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// KindFileMetadata is the NIP-94 kind the uploader is notified with
+const KindFileMetadata = 1063
+
+// OutputType is the mime type of transcoded videos
+const OutputType = "video/mp4"
+
+// MaxOutputSize is the largest output kept, an output larger than its original is unusual
+const MaxOutputSize = 100 * 1024 * 1024
+
+// Transcoder converts a video to a mobile friendly mp4
+type Transcoder interface {
+	Transcode(ctx context.Context, video []byte, mime string) ([]byte, error)
+}
+
+// Blobs reads originals and stores outputs
+type Blobs interface {
+	ReadBlob(ctx context.Context, sha256 string) ([]byte, error)
+	StoreDerived(ctx context.Context, pubkey, groupID string, body []byte, mime string) (blossom.BlobDescriptor, error)
+}
+
+// Store signs the notifications of the relay
+type Store interface {
+	SignAndSaveEvent(ctx context.Context, ev *nostr.Event) (*nostr.Event, error)
+}
+
+type Config struct {
+	Workers int
+	Timeout time.Duration // of a single transcode
+	Queue   int
+}
+
+type job struct {
+	sha256  string
+	pubkey  string
+	groupID string
+	mime    string
+}
+
+// Service queues the videos to transcode and runs them
+type Service struct {
+	ctx   context.Context
+	db    *db.DB
+	t     Transcoder
+	blobs Blobs
+	n     Store
+	cfg   *Config
+
+	jobs chan job
+
+	now func() time.Time
+}
+
+// NewService transcodes videos with t, blobs is set once media is enabled
+func NewService(ctx context.Context, d *db.DB, t Transcoder, n Store, cfg *Config) *Service {
+	return &Service{
+		ctx:  ctx,
+		db:   d,
+		t:    t,
+		n:    n,
+		cfg:  cfg,
+		jobs: make(chan job, cfg.Queue),
+		now:  func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// SetBlobs sets the blob storage, it must be set before the service is started
+func (s *Service) SetBlobs(b Blobs) {
+	s.blobs = b
+}
+
+// IsVideo tells whether a blob of this mime type is transcoded
+func IsVideo(mime string) bool {
+	return strings.HasPrefix(mime, "video/")
+}
+
+// Enqueue records a video to transcode and queues it, a video that was already transcoded is left
+// alone. A full queue doesn't block the upload, the transcode runs when the relay restarts.
+func (s *Service) Enqueue(ctx context.Context, sha256, pubkey, groupID, mime string) error {
+	if !IsVideo(mime) {
+		return nil
+	}
+
+	added, err := s.db.TranscodeDB.AddTranscode(&relay.Transcode{
+		SHA256:    sha256,
+		Pubkey:    pubkey,
+		GroupID:   groupID,
+		Mime:      mime,
+		Status:    relay.TranscodeStatusPending,
+		CreatedAt: s.now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if !added {
+		return nil
+	}
+
+	select {
+	case s.jobs <- job{sha256: sha256, pubkey: pubkey, groupID: groupID, mime: mime}:
+	default:
+		log.Printf("transcode queue is full, %s is left for the next restart", sha256)
+	}
+
+	return nil
+}
+
+// Start queues the transcodes that didn't finish and runs the workers until the context is done
+func (s *Service) Start() error {
+	log.Default().Println("starting video transcoding")
+
+	pending, err := s.db.TranscodeDB.GetPendingTranscodes()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < max(s.cfg.Workers, 1); i++ {
+		go s.work()
+	}
+
+	for _, t := range pending {
+		select {
+		case s.jobs <- job{sha256: t.SHA256, pubkey: t.Pubkey, groupID: t.GroupID, mime: t.Mime}:
+		case <-s.ctx.Done():
+			return nil
+		}
+	}
+
+	<-s.ctx.Done()
+	log.Default().Println("stopping video transcoding")
+
+	return nil
+}
+
+func (s *Service) work() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case j := <-s.jobs:
+			err := s.run(j)
+			if err != nil {
+				log.Printf("failed to transcode %s: %v", j.sha256, err)
+
+				err = s.db.TranscodeDB.SetFailed(j.sha256, err.Error(), s.now())
+				if err != nil {
+					log.Printf("failed to record transcode failure of %s: %v", j.sha256, err)
+				}
+			}
+		}
+	}
+}
+
+// run transcodes a video, stores the output and notifies the uploader
+func (s *Service) run(j job) error {
+	ctx, cancel := context.WithTimeout(s.ctx, s.cfg.Timeout)
+	defer cancel()
+
+	video, err := s.blobs.ReadBlob(ctx, j.sha256)
+	if err != nil {
+		return err
+	}
+
+	out, err := s.t.Transcode(ctx, video, j.mime)
+	if err != nil {
+		return err
+	}
+
+	if len(out) == 0 {
+		return errors.New("empty output")
+	}
+
+	bd, err := s.blobs.StoreDerived(ctx, j.pubkey, j.groupID, out, OutputType)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.TranscodeDB.SetReady(j.sha256, bd.SHA256, int64(bd.Size), s.now())
+	if err != nil {
+		return err
+	}
+
+	// the output is ready, a failed notification doesn't fail the transcode
+	err = s.notify(ctx, j, bd)
+	if err != nil {
+		log.Printf("failed to notify the uploader of %s: %v", j.sha256, err)
+	}
+
+	return nil
+}
+
+// notify tells the uploader that the output of its video is ready
+func (s *Service) notify(ctx context.Context, j job, bd blossom.BlobDescriptor) error {
+	tags := nostr.Tags{
+		{"url", bd.URL},
+		{"m", bd.Type},
+		{"x", bd.SHA256},
+		{"ox", j.sha256},
+		{"size", strconv.Itoa(bd.Size)},
+		{"p", j.pubkey},
+	}
+	if j.groupID != "" {
+		tags = append(tags, nostr.Tag{"h", j.groupID})
+	}
+
+	ev, err := s.n.SignAndSaveEvent(ctx, &nostr.Event{
+		Kind:      KindFileMetadata,
+		CreatedAt: nostr.Now(),
+		Tags:      tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	// events of the relay don't go through the hooks that track blob references
+	return s.db.BlobRefDB.AddRefs(ev.ID, j.groupID, []string{bd.SHA256}, s.now())
+}
+
+// readOutput reads the output of a transcoder, up to the max output size
+func readOutput(r io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, MaxOutputSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) > MaxOutputSize {
+		return nil, fmt.Errorf("output is larger than %d bytes", MaxOutputSize)
+	}
+
+	return b, nil
+}
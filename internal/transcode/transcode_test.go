@@ -0,0 +1,127 @@
+package transcode
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/fiatjaf/khatru/blossom"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+type fakeTranscoder struct{}
+
+func (fakeTranscoder) Transcode(ctx context.Context, video []byte, mime string) ([]byte, error) {
+	return append([]byte("mp4:"), video...), nil
+}
+
+type fakeBlobs struct {
+	stored map[string][]byte
+}
+
+func (b *fakeBlobs) ReadBlob(ctx context.Context, sha256 string) ([]byte, error) {
+	return []byte(sha256), nil
+}
+
+func (b *fakeBlobs) StoreDerived(ctx context.Context, pubkey, groupID string, body []byte, mime string) (blossom.BlobDescriptor, error) {
+	b.stored[pubkey] = body
+	return blossom.BlobDescriptor{URL: "https://relay.example/out", SHA256: "out", Size: len(body), Type: mime}, nil
+}
+
+func TestTranscode(t *testing.T) {
+	d := testutil.NewDB(t)
+	ctx := context.Background()
+
+	blobs := &fakeBlobs{stored: map[string][]byte{}}
+	n := &testutil.FakeStore{}
+
+	s := NewService(ctx, d, fakeTranscoder{}, n, &Config{Workers: 1, Timeout: time.Minute, Queue: 10})
+	s.SetBlobs(blobs)
+
+	// only videos are transcoded
+	err := s.Enqueue(ctx, "image", "alice", "demo", "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Enqueue(ctx, "video", "alice", "demo", "video/webm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a video is transcoded once
+	err = s.Enqueue(ctx, "video", "alice", "demo", "video/webm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.jobs) != 1 {
+		t.Fatalf("expected a single job, got %d", len(s.jobs))
+	}
+
+	err = s.run(<-s.jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(blobs.stored["alice"]) != "mp4:video" {
+		t.Fatalf("unexpected output %q", blobs.stored["alice"])
+	}
+
+	tr, err := d.TranscodeDB.GetTranscode("video")
+	if err != nil || tr == nil || tr.Status != relay.TranscodeStatusReady || tr.Output != "out" {
+		t.Fatalf("expected the transcode to be ready, got %+v %v", tr, err)
+	}
+
+	outputs, err := d.TranscodeDB.GetOutputs([]string{"video", "image"})
+	if err != nil || len(outputs) != 1 || outputs["video"] != "out" {
+		t.Fatalf("unexpected outputs %v %v", outputs, err)
+	}
+
+	// the uploader is notified with the hash of the original
+	if len(n.Events) != 1 {
+		t.Fatalf("expected a notification, got %d", len(n.Events))
+	}
+
+	ev := n.Events[0]
+	if ev.Kind != KindFileMetadata || ev.Tags.GetFirst([]string{"ox", "video"}) == nil || ev.Tags.GetFirst([]string{"p", "alice"}) == nil || ev.Tags.GetFirst([]string{"h", "demo"}) == nil {
+		t.Fatalf("unexpected notification %+v", ev)
+	}
+
+	unreferenced, err := d.BlobRefDB.GetUnreferenced([]string{"out"})
+	if err != nil || len(unreferenced) != 0 {
+		t.Fatalf("expected the output to be referenced, got %v %v", unreferenced, err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "video/webm" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		b, _ := io.ReadAll(r.Body)
+		w.Write(append([]byte("mp4:"), b...))
+	}))
+	defer srv.Close()
+
+	out, err := NewHTTP(srv.URL).Transcode(context.Background(), []byte("video"), "video/webm")
+	if err != nil || string(out) != "mp4:video" {
+		t.Fatalf("unexpected output %q %v", out, err)
+	}
+
+	_, err = NewHTTP(srv.URL).Transcode(context.Background(), []byte("video"), "video/ogg")
+	if err == nil {
+		t.Fatal("expected an error when the service rejects the video")
+	}
+}
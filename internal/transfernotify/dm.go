@@ -0,0 +1,41 @@
+package transfernotify
+
+import (
+	"context"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip17"
+)
+
+// Publisher stores events that are already signed
+type Publisher interface {
+	SaveSignedEvent(ctx context.Context, ev *nostr.Event) error
+}
+
+// DMNotifier sends a NIP-17 direct message from the relay, gift wrapped for the pubkey
+type DMNotifier struct {
+	n  Publisher
+	kr nostr.Keyer
+}
+
+func NewDMNotifier(n Publisher, relaySecretKey string) (*DMNotifier, error) {
+	kr, err := keyer.NewPlainKeySigner(relaySecretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DMNotifier{n: n, kr: kr}, nil
+}
+
+func (d *DMNotifier) NotifyTransfer(ctx context.Context, t *relay.TransferNotice) error {
+	content := relay.LocalizePush(t.Locale, relay.PushMessageReceived, map[string]string{"amount": t.Amount, "symbol": t.Symbol})
+
+	_, wrap, err := nip17.PrepareMessage(ctx, content, nostr.Tags{}, d.kr, t.Pubkey, nil)
+	if err != nil {
+		return err
+	}
+
+	return d.n.SaveSignedEvent(ctx, &wrap)
+}
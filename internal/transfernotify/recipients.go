@@ -0,0 +1,36 @@
+package transfernotify
+
+import (
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+// DBRecipients looks recipients up in the push tokens, account links and push preferences of the relay
+type DBRecipients struct {
+	db *db.DB
+}
+
+func NewDBRecipients(d *db.DB) *DBRecipients {
+	return &DBRecipients{db: d}
+}
+
+func (r *DBRecipients) AccountPushTokens(contract, account string) ([]*relay.PushToken, error) {
+	ptdb, ok := r.db.GetPushTokenDB(contract)
+	if !ok {
+		return nil, nil
+	}
+
+	return ptdb.GetAccountTokens(account)
+}
+
+func (r *DBRecipients) LinkedPubkeys(account string) ([]string, error) {
+	return r.db.AccountLinkDB.GetPubkeys(account)
+}
+
+func (r *DBRecipients) PubkeyPushTokens(pubkey string) ([]*relay.PushToken, error) {
+	return r.db.NostrPushTokenDB.GetAccountTokens(pubkey)
+}
+
+func (r *DBRecipients) Preference(pubkey string) (*relay.PushPreference, error) {
+	return r.db.PushPreferenceDB.GetPreference(pubkey)
+}
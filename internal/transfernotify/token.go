@@ -0,0 +1,90 @@
+package transfernotify
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const erc20MetadataABI = `[
+	{"inputs":[],"name":"symbol","outputs":[{"internalType":"string","name":"","type":"string"}],"stateMutability":"view","type":"function"},
+	{"inputs":[],"name":"decimals","outputs":[{"internalType":"uint8","name":"","type":"uint8"}],"stateMutability":"view","type":"function"}
+]`
+
+// ERC20Tokens reads the symbol and decimals of tokens from their contracts, they are cached since
+// they don't change
+type ERC20Tokens struct {
+	evm relay.EVMRequester
+	abi abi.ABI
+
+	mu     sync.Mutex
+	tokens map[string]*Token
+}
+
+func NewERC20Tokens(evm relay.EVMRequester) (*ERC20Tokens, error) {
+	parsed, err := abi.JSON(strings.NewReader(erc20MetadataABI))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ERC20Tokens{evm: evm, abi: parsed, tokens: map[string]*Token{}}, nil
+}
+
+func (e *ERC20Tokens) Token(contract string) (*Token, error) {
+	e.mu.Lock()
+	t, ok := e.tokens[contract]
+	e.mu.Unlock()
+
+	if ok {
+		return t, nil
+	}
+
+	symbol, err := e.call(contract, "symbol")
+	if err != nil {
+		return nil, err
+	}
+
+	decimals, err := e.call(contract, "decimals")
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := symbol[0].(string)
+	if !ok {
+		return nil, errors.New("invalid token symbol")
+	}
+
+	d, ok := decimals[0].(uint8)
+	if !ok {
+		return nil, errors.New("invalid token decimals")
+	}
+
+	t = &Token{Symbol: s, Decimals: int(d)}
+
+	e.mu.Lock()
+	e.tokens[contract] = t
+	e.mu.Unlock()
+
+	return t, nil
+}
+
+func (e *ERC20Tokens) call(contract, method string) ([]any, error) {
+	data, err := e.abi.Pack(method)
+	if err != nil {
+		return nil, err
+	}
+
+	to := common.HexToAddress(contract)
+
+	res, err := e.evm.CallContract(ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.abi.Unpack(method, res)
+}
@@ -0,0 +1,216 @@
+// Package transfernotify lets the recipients of transfers know about them when they registered
+// no push token, so that the first transfers to new users aren't invisible to them.
+//
+// The indexer hands every log it stores to the service. When the recipient of a transfer has no
+// push token for the token contract, each nostr pubkey linked to the recipient account that has
+// no push token either is handed to the notifiers, such as a direct message from the relay.
+// Pubkeys that turned notifications off are skipped.
+package transfernotify
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// most transfers waiting to be notified, the indexer never waits for notifications
+const queueSize = 256
+
+var transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)")).Hex()
+
+// Recipients finds out how the recipient of a transfer can be reached
+type Recipients interface {
+	AccountPushTokens(contract, account string) ([]*relay.PushToken, error)
+	LinkedPubkeys(account string) ([]string, error)
+	PubkeyPushTokens(pubkey string) ([]*relay.PushToken, error)
+	Preference(pubkey string) (*relay.PushPreference, error)
+}
+
+// Tokens describes the token of a contract
+type Tokens interface {
+	Token(contract string) (*Token, error)
+}
+
+type Token struct {
+	Symbol   string
+	Decimals int
+}
+
+// Notifier reaches a pubkey outside of push notifications, e.g. with a direct message or an email
+type Notifier interface {
+	NotifyTransfer(ctx context.Context, t *relay.TransferNotice) error
+}
+
+type transfer struct {
+	contract string
+	from     string
+	to       string
+	value    *big.Int
+	txHash   string
+}
+
+type Service struct {
+	ctx        context.Context
+	recipients Recipients
+	tokens     Tokens
+	notifiers  []Notifier
+
+	queue chan *transfer
+}
+
+func NewService(ctx context.Context, recipients Recipients, tokens Tokens) *Service {
+	return &Service{
+		ctx:        ctx,
+		recipients: recipients,
+		tokens:     tokens,
+		queue:      make(chan *transfer, queueSize),
+	}
+}
+
+// AddNotifier adds a way to reach pubkeys, every notifier is used for each pubkey
+func (s *Service) AddNotifier(n Notifier) {
+	s.notifiers = append(s.notifiers, n)
+}
+
+// OnLog queues the transfers among the logs the indexer stores
+func (s *Service) OnLog(ev *relay.Event, l *relay.Log, topics relay.Topics) {
+	if !strings.EqualFold(ev.Topic, transferTopic) {
+		return
+	}
+
+	t, ok := parseTransfer(topics)
+	if !ok {
+		return
+	}
+
+	t.contract = ev.Contract
+	t.txHash = l.TxHash
+
+	select {
+	case s.queue <- t:
+	default:
+		log.Default().Printf("transfer notifications are behind, skipping %s", t.txHash)
+	}
+}
+
+// Start notifies queued transfers until the context is done
+func (s *Service) Start() error {
+	log.Default().Println("starting transfer notifications")
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			log.Default().Println("stopping transfer notifications")
+			return nil
+		case t := <-s.queue:
+			s.notify(t)
+		}
+	}
+}
+
+// notify hands a transfer to the notifiers for each linked pubkey that can't be reached by push
+func (s *Service) notify(t *transfer) {
+	tokens, err := s.recipients.AccountPushTokens(t.contract, t.to)
+	if err != nil {
+		log.Default().Printf("failed to fetch the push tokens of %s: %v", t.to, err)
+		return
+	}
+
+	if len(tokens) > 0 {
+		return
+	}
+
+	pubkeys, err := s.recipients.LinkedPubkeys(t.to)
+	if err != nil {
+		log.Default().Printf("failed to fetch the pubkeys of %s: %v", t.to, err)
+		return
+	}
+
+	if len(pubkeys) == 0 {
+		return
+	}
+
+	token, err := s.tokens.Token(t.contract)
+	if err != nil {
+		log.Default().Printf("failed to describe the token %s: %v", t.contract, err)
+		return
+	}
+
+	for _, pubkey := range pubkeys {
+		tokens, err := s.recipients.PubkeyPushTokens(pubkey)
+		if err != nil || len(tokens) > 0 {
+			continue
+		}
+
+		pref, err := s.recipients.Preference(pubkey)
+		if err != nil || !pref.Allows(relay.PushNotificationTypeTransfer) {
+			continue
+		}
+
+		notice := &relay.TransferNotice{
+			Pubkey:   pubkey,
+			Account:  t.to,
+			From:     t.from,
+			Contract: t.contract,
+			Amount:   formatUnits(t.value, token.Decimals),
+			Symbol:   token.Symbol,
+			TxHash:   t.txHash,
+			Locale:   pref.Locale,
+		}
+
+		for _, n := range s.notifiers {
+			err := n.NotifyTransfer(s.ctx, notice)
+			if err != nil {
+				log.Default().Printf("failed to notify %s of %s: %v", pubkey, t.txHash, err)
+			}
+		}
+	}
+}
+
+// parseTransfer reads the sender, recipient and value of a transfer from its decoded topics,
+// whatever the arguments were named in the event signature
+func parseTransfer(topics relay.Topics) (*transfer, bool) {
+	addrs := []string{}
+	var value *big.Int
+	for _, topic := range topics {
+		switch v := topic.Value.(type) {
+		case common.Address:
+			addrs = append(addrs, v.Hex())
+		case *big.Int:
+			if value == nil {
+				value = v
+			}
+		}
+	}
+
+	if len(addrs) != 2 || value == nil {
+		return nil, false
+	}
+
+	return &transfer{from: addrs[0], to: addrs[1], value: value}, true
+}
+
+// formatUnits formats an amount of the smallest unit of a token, e.g. 10500000 with 6 decimals is
+// 10.5
+func formatUnits(value *big.Int, decimals int) string {
+	if decimals <= 0 {
+		return value.String()
+	}
+
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(value, unit, new(big.Int))
+
+	if frac.Sign() == 0 {
+		return whole.String()
+	}
+
+	f := strings.TrimRight(frac.String(), "0")
+	f = strings.Repeat("0", decimals-len(frac.String())) + f
+
+	return whole.String() + "." + f
+}
@@ -0,0 +1,166 @@
+package transfernotify
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/keyer"
+	"github.com/nbd-wtf/go-nostr/nip59"
+)
+
+type fakeRecipients struct {
+	accountTokens map[string]int // account -> number of push tokens
+	pubkeys       map[string][]string
+	pubkeyTokens  map[string]int
+	modes         map[string]relay.PushMode
+}
+
+func (f *fakeRecipients) AccountPushTokens(contract, account string) ([]*relay.PushToken, error) {
+	return make([]*relay.PushToken, f.accountTokens[account]), nil
+}
+
+func (f *fakeRecipients) LinkedPubkeys(account string) ([]string, error) {
+	return f.pubkeys[account], nil
+}
+
+func (f *fakeRecipients) PubkeyPushTokens(pubkey string) ([]*relay.PushToken, error) {
+	return make([]*relay.PushToken, f.pubkeyTokens[pubkey]), nil
+}
+
+func (f *fakeRecipients) Preference(pubkey string) (*relay.PushPreference, error) {
+	mode, ok := f.modes[pubkey]
+	if !ok {
+		mode = relay.PushModeAll
+	}
+
+	return &relay.PushPreference{Pubkey: pubkey, Mode: mode, Locale: "fr"}, nil
+}
+
+type fakeTokens struct{}
+
+func (fakeTokens) Token(contract string) (*Token, error) {
+	return &Token{Symbol: "CTZN", Decimals: 6}, nil
+}
+
+type fakeNotifier struct {
+	notices []*relay.TransferNotice
+}
+
+func (f *fakeNotifier) NotifyTransfer(ctx context.Context, t *relay.TransferNotice) error {
+	f.notices = append(f.notices, t)
+	return nil
+}
+
+func transferTopics(from, to string, value int64) relay.Topics {
+	return relay.Topics{
+		{Name: "topic", Type: "bytes32", Value: common.HexToHash(transferTopic)},
+		{Name: "from", Type: "address", Value: common.HexToAddress(from)},
+		{Name: "to", Type: "address", Value: common.HexToAddress(to)},
+		{Name: "value", Type: "uint256", Value: big.NewInt(value)},
+	}
+}
+
+func TestNotify(t *testing.T) {
+	registered := common.HexToAddress("0x1").Hex()
+	unregistered := common.HexToAddress("0x2").Hex()
+
+	r := &fakeRecipients{
+		accountTokens: map[string]int{registered: 1},
+		pubkeys: map[string][]string{
+			registered:   {"alice"},
+			unregistered: {"bob", "carol", "dave"},
+		},
+		pubkeyTokens: map[string]int{"carol": 1},
+		modes:        map[string]relay.PushMode{"dave": relay.PushModeNone},
+	}
+
+	n := &fakeNotifier{}
+	s := NewService(context.Background(), r, fakeTokens{})
+	s.AddNotifier(n)
+
+	ev := &relay.Event{Contract: "0xtoken", Topic: transferTopic}
+	for _, to := range []string{registered, unregistered} {
+		s.OnLog(ev, &relay.Log{TxHash: "0xtx"}, transferTopics("0x3", to, 10500000))
+	}
+
+	// other events are ignored
+	s.OnLog(&relay.Event{Contract: "0xtoken", Topic: "0xother"}, &relay.Log{}, transferTopics("0x3", unregistered, 1))
+
+	for len(s.queue) > 0 {
+		s.notify(<-s.queue)
+	}
+
+	// only bob, carol has a push token and dave turned notifications off
+	if len(n.notices) != 1 {
+		t.Fatalf("expected a single notice, got %d", len(n.notices))
+	}
+
+	got := n.notices[0]
+	if got.Pubkey != "bob" || got.Account != unregistered || got.Amount != "10.5" || got.Symbol != "CTZN" || got.Locale != "fr" {
+		t.Fatalf("unexpected notice %+v", got)
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	for _, c := range []struct {
+		value    int64
+		decimals int
+		want     string
+	}{
+		{10500000, 6, "10.5"},
+		{1000000, 6, "1"},
+		{5, 6, "0.000005"},
+		{42, 0, "42"},
+	} {
+		if got := formatUnits(big.NewInt(c.value), c.decimals); got != c.want {
+			t.Errorf("expected %s, got %s", c.want, got)
+		}
+	}
+}
+
+type testPublisher struct {
+	saved []*nostr.Event
+}
+
+func (p *testPublisher) SaveSignedEvent(ctx context.Context, ev *nostr.Event) error {
+	p.saved = append(p.saved, ev)
+	return nil
+}
+
+func TestDMNotifier(t *testing.T) {
+	ctx := context.Background()
+
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+
+	p := &testPublisher{}
+	d, err := NewDMNotifier(p, nostr.GeneratePrivateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.NotifyTransfer(ctx, &relay.TransferNotice{Pubkey: pk, Amount: "10.5", Symbol: "CTZN", Locale: "fr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.saved) != 1 || p.saved[0].Kind != nostr.KindGiftWrap {
+		t.Fatalf("expected a gift wrap, got %v", p.saved)
+	}
+
+	kr, _ := keyer.NewPlainKeySigner(sk)
+	rumor, err := nip59.GiftUnwrap(*p.saved[0], func(otherpubkey, ciphertext string) (string, error) {
+		return kr.Decrypt(ctx, ciphertext, otherpubkey)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rumor.Content != "10,5 CTZN reçus" {
+		t.Fatalf("unexpected message %q", rumor.Content)
+	}
+}
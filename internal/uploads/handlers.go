@@ -0,0 +1,94 @@
+package uploads
+
+import (
+	"net/http"
+	"strconv"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/go-chi/chi/v5"
+)
+
+// uploads and flags returned by default to admins
+const defaultLimit = 100
+
+// Get returns the latest uploads, for admins. They can be filtered by pubkey, group and client ip,
+// the ip is hashed like the recorded ones.
+func (s *Service) Get(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+
+	ipHash := q.Get("ip_hash")
+	if ip := q.Get("ip"); ip != "" {
+		ipHash = s.HashIP(ip)
+		if ipHash == "" {
+			http.Error(w, "client ips are not recorded", http.StatusBadRequest)
+			return
+		}
+	}
+
+	uploads, err := s.db.UploadDB.GetUploads(q.Get("pubkey"), q.Get("group"), ipHash, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, uploads, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Flags returns the flagged uploaders, for admins
+func (s *Service) Flags(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	flags, err := s.db.UploadDB.GetFlags(limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.Body(w, flags, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ClearFlag clears the flag of an uploader, for admins
+func (s *Service) ClearFlag(w http.ResponseWriter, r *http.Request) {
+	removed, err := s.db.UploadDB.RemoveFlag(chi.URLParam(r, "pubkey"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !removed {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseLimit(r *http.Request) (int, bool) {
+	l := r.URL.Query().Get("limit")
+	if l == "" {
+		return defaultLimit, true
+	}
+
+	limit, err := strconv.Atoi(l)
+	if err != nil || limit <= 0 {
+		return 0, false
+	}
+
+	return limit, true
+}
@@ -0,0 +1,123 @@
+package uploads
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/go-chi/chi/v5"
+)
+
+// blobs of a group returned by default, and at most, in a page of its media
+const (
+	defaultMediaLimit = 50
+	maxMediaLimit     = 100
+)
+
+// Groups checks the membership of groups
+type Groups interface {
+	IsMember(ctx context.Context, pubkey, groupID string) (bool, error)
+}
+
+// SetGroups allows members to list the media of their groups
+func (s *Service) SetGroups(g Groups) {
+	s.groups = g
+}
+
+// Removed marks a blob as removed from the storage, it is no longer listed in the media of its groups
+func (s *Service) Removed(ctx context.Context, sha256 string) error {
+	return s.db.UploadDB.SetRemoved(sha256, s.now())
+}
+
+// Media returns a page of the blobs uploaded to a group, latest first, for its members. The next
+// page starts from the cursor in the meta of the previous one.
+func (s *Service) Media(w http.ResponseWriter, r *http.Request) {
+	limit, before, ok := parseMediaPage(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	groupID := chi.URLParam(r, "group_id")
+
+	_, err := com.ParseMemberRequest(r, s.groups, groupID, s.now(), nil)
+	if err != nil {
+		com.WriteMemberRequestError(w, err)
+		return
+	}
+
+	uploads, err := s.db.UploadDB.GetGroupMedia(groupID, before, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	total, err := s.db.UploadDB.CountGroupMedia(groupID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	shas := make([]string, 0, len(uploads))
+	for _, u := range uploads {
+		shas = append(shas, u.SHA256)
+	}
+
+	transcoded, err := s.db.TranscodeDB.GetOutputs(shas)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	media := make([]*relay.GroupMedia, 0, len(uploads))
+	for _, u := range uploads {
+		media = append(media, &relay.GroupMedia{
+			SHA256:     u.SHA256,
+			Size:       u.Size,
+			Type:       u.Mime,
+			Uploader:   u.Pubkey,
+			CreatedAt:  u.CreatedAt.Unix(),
+			Transcoded: transcoded[u.SHA256],
+		})
+	}
+
+	meta := com.CursorPagination{Limit: limit, Total: total}
+	if len(uploads) == limit {
+		meta.Next = strconv.FormatInt(uploads[len(uploads)-1].ID, 10)
+		meta.HasMore = true
+	}
+
+	err = com.BodyMultiple(w, media, meta)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// parseMediaPage reads the page size and the cursor of a media request
+func parseMediaPage(r *http.Request) (int, int64, bool) {
+	q := r.URL.Query()
+
+	limit := defaultMediaLimit
+	if l := q.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			return 0, 0, false
+		}
+
+		limit = min(limit, maxMediaLimit)
+	}
+
+	var before int64
+	if c := q.Get("cursor"); c != "" {
+		var err error
+		before, err = strconv.ParseInt(c, 10, 64)
+		if err != nil || before <= 0 {
+			return 0, 0, false
+		}
+	}
+
+	return limit, before, true
+}
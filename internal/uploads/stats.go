@@ -0,0 +1,66 @@
+package uploads
+
+import (
+	"net/http"
+	"time"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+const bytesPerGB = 1024 * 1024 * 1024
+
+// StorageCost prices the storage of blobs, per GB and month, to estimate what each group costs
+type StorageCost struct {
+	// ArchiveAfter is the age blobs move to the archive class at, 0 keeps every blob in the standard class
+	ArchiveAfter time.Duration
+
+	Standard float64
+	Archive  float64
+}
+
+// estimate returns the monthly cost of the blobs of a group
+func (c *StorageCost) estimate(gs *relay.GroupStorage) float64 {
+	return float64(gs.StandardBytes)/bytesPerGB*c.Standard + float64(gs.ArchivedBytes)/bytesPerGB*c.Archive
+}
+
+type storageStats struct {
+	Groups      []*relay.GroupStorage `json:"groups"`
+	Blobs       int64                 `json:"blobs"`
+	Bytes       int64                 `json:"bytes"`
+	MonthlyCost float64               `json:"monthly_cost"`
+}
+
+// Stats returns the storage each group takes and an estimate of its monthly cost, for admins
+func (s *Service) Stats(w http.ResponseWriter, r *http.Request) {
+	cost := s.cfg.Cost
+	if cost == nil {
+		cost = &StorageCost{}
+	}
+
+	// without an archive age every blob is counted in the standard class
+	var since time.Time
+	if cost.ArchiveAfter > 0 {
+		since = s.now().Add(-cost.ArchiveAfter)
+	}
+
+	groups, err := s.db.UploadDB.GetGroupStorage(since)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	stats := storageStats{Groups: groups}
+	for _, gs := range groups {
+		gs.MonthlyCost = cost.estimate(gs)
+
+		stats.Blobs += gs.Blobs
+		stats.Bytes += gs.StandardBytes + gs.ArchivedBytes
+		stats.MonthlyCost += gs.MonthlyCost
+	}
+
+	err = com.Body(w, stats, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,133 @@
+// Package uploads keeps a log of the blobs uploaded to the relay for abuse handling.
+//
+// Every upload is recorded with its uploader, group, size, mime type and a hash of the client ip.
+// The ip is hashed with a key of the relay so that uploads from the same client can be matched
+// without keeping the address itself, an ip from an abuse report is hashed the same way to find its
+// uploads.
+//
+// Members of a group can list the media uploaded to it, blobs removed from the storage are left out.
+// Admins can see how much each group stores and an estimate of its monthly cost.
+//
+// An uploader that goes over the number of uploads or bytes allowed within the window is flagged and
+// the operators are warned. Flags don't block uploads, they stay until an admin clears them.
+package uploads
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/pkg/relay"
+)
+
+type Config struct {
+	// uploads are counted within the window, 0 disables flagging
+	Window time.Duration
+
+	// a pubkey is flagged when it uploads more blobs or bytes than this within the window, 0
+	// disables a limit
+	MaxUploads int
+	MaxBytes   int64
+
+	// Cost estimates what the blobs of each group cost to store, nil only reports their size
+	Cost *StorageCost
+}
+
+type Service struct {
+	db     *db.DB
+	key    []byte
+	cfg    *Config
+	w      relay.WebhookMessager
+	groups Groups
+
+	now func() time.Time
+}
+
+// NewService records uploads, client ips are not recorded without a key
+func NewService(d *db.DB, key string, cfg *Config, w relay.WebhookMessager) *Service {
+	return &Service{
+		db:  d,
+		key: []byte(key),
+		cfg: cfg,
+		w:   w,
+		now: func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// HashIP returns the keyed hash of a client ip, empty without a key or an ip
+func (s *Service) HashIP(ip string) string {
+	if len(s.key) == 0 || ip == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(ip))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Record logs an upload from a client ip and flags its uploader when the volume is unusual
+func (s *Service) Record(ctx context.Context, u *relay.Upload, ip string) error {
+	u.IPHash = s.HashIP(ip)
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = s.now()
+	}
+
+	err := s.db.UploadDB.AddUpload(u)
+	if err != nil {
+		return err
+	}
+
+	return s.check(ctx, u.Pubkey)
+}
+
+// check flags a pubkey that went over a limit within the window
+func (s *Service) check(ctx context.Context, pubkey string) error {
+	if s.cfg.Window <= 0 || (s.cfg.MaxUploads <= 0 && s.cfg.MaxBytes <= 0) {
+		return nil
+	}
+
+	count, bytes, err := s.db.UploadDB.GetVolume(pubkey, s.now().Add(-s.cfg.Window))
+	if err != nil {
+		return err
+	}
+
+	reason := overLimit(s.cfg, count, bytes)
+	if reason == "" {
+		return nil
+	}
+
+	added, err := s.db.UploadDB.AddFlag(&relay.UploadFlag{
+		Pubkey:    pubkey,
+		Uploads:   count,
+		Bytes:     bytes,
+		Reason:    reason,
+		FlaggedAt: s.now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// operators are warned once, until the flag is cleared
+	if added && s.w != nil {
+		s.w.NotifyWarning(ctx, fmt.Errorf("uploads of %s flagged: %s", pubkey, reason))
+	}
+
+	return nil
+}
+
+// overLimit returns why a volume is unusual, empty when it isn't
+func overLimit(cfg *Config, count int, bytes int64) string {
+	switch {
+	case cfg.MaxUploads > 0 && count > cfg.MaxUploads:
+		return fmt.Sprintf("%d uploads within %s, over %d", count, cfg.Window, cfg.MaxUploads)
+	case cfg.MaxBytes > 0 && bytes > cfg.MaxBytes:
+		return fmt.Sprintf("%d bytes uploaded within %s, over %d", bytes, cfg.Window, cfg.MaxBytes)
+	}
+
+	return ""
+}
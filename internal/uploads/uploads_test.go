@@ -0,0 +1,274 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/internal/testdb"
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+type fakeWebhook struct {
+	warnings []error
+}
+
+func (w *fakeWebhook) Notify(ctx context.Context, message string) error {
+	return nil
+}
+
+func (w *fakeWebhook) NotifyWarning(ctx context.Context, err error) error {
+	w.warnings = append(w.warnings, err)
+	return nil
+}
+
+func (w *fakeWebhook) NotifyError(ctx context.Context, err error) error {
+	return nil
+}
+
+func TestHashIP(t *testing.T) {
+	s := NewService(nil, "key", &Config{}, nil)
+
+	h := s.HashIP("203.0.113.7")
+	if len(h) != 64 || h != s.HashIP("203.0.113.7") {
+		t.Fatalf("expected a stable hash, got %q", h)
+	}
+
+	if h == s.HashIP("203.0.113.8") || h == NewService(nil, "other", &Config{}, nil).HashIP("203.0.113.7") {
+		t.Fatal("expected the hash to depend on the ip and the key")
+	}
+
+	if NewService(nil, "", &Config{}, nil).HashIP("203.0.113.7") != "" || s.HashIP("") != "" {
+		t.Fatal("expected no hash without a key or an ip")
+	}
+}
+
+func TestOverLimit(t *testing.T) {
+	cfg := &Config{Window: time.Hour, MaxUploads: 10, MaxBytes: 1000}
+
+	for name, tc := range map[string]struct {
+		count   int
+		bytes   int64
+		flagged bool
+	}{
+		"under":          {10, 1000, false},
+		"too many":       {11, 10, true},
+		"too many bytes": {1, 1001, true},
+	} {
+		if got := overLimit(cfg, tc.count, tc.bytes) != ""; got != tc.flagged {
+			t.Errorf("%s: expected flagged %v, got %v", name, tc.flagged, got)
+		}
+	}
+
+	if overLimit(&Config{Window: time.Hour}, 1000, 1000) != "" {
+		t.Fatal("expected no limits to flag nothing")
+	}
+}
+
+func TestRecord(t *testing.T) {
+	d := testutil.NewDB(t)
+	w := &fakeWebhook{}
+
+	s := NewService(d, "key", &Config{Window: time.Hour, MaxUploads: 2}, w)
+
+	for _, sha := range []string{"a", "b", "c", "d"} {
+		err := s.Record(context.Background(), &relay.Upload{SHA256: sha, Pubkey: "alice", GroupID: "demo", Size: 10, Mime: "image/png"}, "203.0.113.7")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := d.UploadDB.GetFlag("alice")
+	if err != nil || f == nil || f.Uploads != 3 {
+		t.Fatalf("expected alice to be flagged on the third upload, got %+v %v", f, err)
+	}
+
+	// operators are warned once
+	if len(w.warnings) != 1 {
+		t.Fatalf("expected a warning, got %v", w.warnings)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/admin/uploads?ip=203.0.113.7&limit=2", nil)
+	rec := httptest.NewRecorder()
+
+	s.Get(rec, r)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	uploads, err := d.UploadDB.GetUploads("", "", s.HashIP("203.0.113.7"), 10)
+	if err != nil || len(uploads) != 4 || uploads[0].SHA256 != "d" {
+		t.Fatalf("unexpected uploads %v %v", uploads, err)
+	}
+}
+
+// listMedia signs a media request the way a client would and sends it to the handler
+func listMedia(t *testing.T, s *Service, sk, query string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	path := "/v1/groups/demo/media/list"
+
+	ev := nostr.Event{
+		Kind:      nostr.KindHTTPAuth,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"u", "http://example.com" + path}, {"method", http.MethodPost}},
+	}
+	err := ev.Sign(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("group_id", "demo")
+
+	r := httptest.NewRequest(http.MethodPost, path+query, bytes.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	s.Media(w, r)
+
+	return w
+}
+
+func TestMedia(t *testing.T) {
+	d := testutil.NewDB(t)
+
+	member := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(member)
+
+	s := NewService(d, "", &Config{}, nil)
+	s.SetGroups(&testutil.FakeGroups{Members: map[string][]string{"demo": {pk}}})
+
+	// b is uploaded twice, c to another group and d is removed
+	for _, u := range []*relay.Upload{
+		{SHA256: "a", Pubkey: pk, GroupID: "demo", Size: 10, Mime: "image/png"},
+		{SHA256: "b", Pubkey: pk, GroupID: "demo", Size: 20, Mime: "image/jpeg"},
+		{SHA256: "b", Pubkey: "bob", GroupID: "demo", Size: 20, Mime: "image/jpeg"},
+		{SHA256: "c", Pubkey: pk, GroupID: "other", Size: 30, Mime: "image/png"},
+		{SHA256: "d", Pubkey: pk, GroupID: "demo", Size: 40, Mime: "video/mp4"},
+		{SHA256: "e", Pubkey: pk, GroupID: "demo", Size: 50, Mime: "video/mp4"},
+	} {
+		err := s.Record(context.Background(), u, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := s.Removed(context.Background(), "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var page struct {
+		Array []*relay.GroupMedia  `json:"array"`
+		Meta  com.CursorPagination `json:"meta"`
+	}
+
+	w := listMedia(t, s, member, "?limit=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	err = json.Unmarshal(w.Body.Bytes(), &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Array) != 2 || page.Array[0].SHA256 != "e" || page.Array[1].SHA256 != "b" || page.Array[1].Uploader != pk {
+		t.Fatalf("unexpected first page %+v", page.Array)
+	}
+
+	if page.Meta.Total != 3 || page.Meta.Next == "" {
+		t.Fatalf("unexpected meta %+v", page.Meta)
+	}
+
+	w = listMedia(t, s, member, "?limit=2&cursor="+page.Meta.Next)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	page.Meta.Next = ""
+	err = json.Unmarshal(w.Body.Bytes(), &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Array) != 1 || page.Array[0].SHA256 != "a" || page.Meta.Next != "" {
+		t.Fatalf("unexpected last page %+v %+v", page.Array, page.Meta)
+	}
+
+	// only members can list the media of a group
+	w = listMedia(t, s, nostr.GeneratePrivateKey(), "")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestStats(t *testing.T) {
+	d := testutil.NewDB(t)
+
+	s := NewService(d, "", &Config{Cost: &StorageCost{ArchiveAfter: 30 * 24 * time.Hour, Standard: 2, Archive: 1}}, nil)
+
+	old := time.Now().UTC().Add(-60 * 24 * time.Hour)
+
+	// a is archived, b is uploaded twice and c is removed
+	for _, u := range []*relay.Upload{
+		{SHA256: "a", Pubkey: "alice", GroupID: "demo", Size: bytesPerGB, CreatedAt: old},
+		{SHA256: "b", Pubkey: "alice", GroupID: "demo", Size: bytesPerGB},
+		{SHA256: "b", Pubkey: "bob", GroupID: "demo", Size: bytesPerGB},
+		{SHA256: "c", Pubkey: "alice", GroupID: "other", Size: bytesPerGB},
+	} {
+		err := s.Record(context.Background(), u, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := s.Removed(context.Background(), "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.Stats(w, httptest.NewRequest(http.MethodGet, "/v1/admin/uploads/stats", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var resp struct {
+		Object storageStats `json:"object"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := resp.Object
+	if len(stats.Groups) != 1 || stats.Blobs != 2 || stats.Bytes != 2*bytesPerGB || stats.MonthlyCost != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	gs := stats.Groups[0]
+	if gs.GroupID != "demo" || gs.StandardBytes != bytesPerGB || gs.ArchivedBytes != bytesPerGB {
+		t.Fatalf("unexpected storage of the group %+v", gs)
+	}
+}
@@ -1,77 +1,77 @@
 package userop
 
 import (
-	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
+	"strconv"
 	"time"
 
-	pay "github.com/citizenwallet/smartcontracts/pkg/contracts/paymaster"
 	nostreth "github.com/comunifi/nostr-eth"
 	"github.com/comunifi/relay/internal/db"
 	nost "github.com/comunifi/relay/internal/nostr"
+	"github.com/comunifi/relay/internal/paymaster"
 	"github.com/comunifi/relay/internal/queue"
 	comm "github.com/comunifi/relay/pkg/common"
 	"github.com/comunifi/relay/pkg/relay"
-	"github.com/ethereum/go-ethereum/accounts"
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5"
 	"github.com/nbd-wtf/go-nostr"
 )
 
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
 type Service struct {
 	evm     relay.EVMRequester
 	db      *db.DB
 	n       *nost.Nostr
+	pm      *paymaster.Service
 	useropq *queue.Service
+	mempool *queue.Mempool
 	chainId *big.Int
+
+	entryPoints []common.Address // entry points ops can target, empty allows any
 }
 
 // NewService
-func NewService(evm relay.EVMRequester, db *db.DB, n *nost.Nostr, useropq *queue.Service, chid *big.Int) *Service {
+func NewService(evm relay.EVMRequester, db *db.DB, n *nost.Nostr, pm *paymaster.Service, useropq *queue.Service, mempool *queue.Mempool, chid *big.Int) *Service {
 	return &Service{
 		evm,
 		db,
 		n,
+		pm,
 		useropq,
+		mempool,
 		chid,
+		nil,
 	}
 }
 
+// SetEntryPoints restricts the entry points user operations can target
+func (s *Service) SetEntryPoints(eps []common.Address) {
+	s.entryPoints = eps
+}
+
+// Send is the json-rpc entry point for user operations, it wraps the operation in a user op
+// event and publishes it through the same path as events sent by nostr clients
 func (s *Service) Send(r *http.Request) (any, error) {
 	// parse contract address from url params
 	contractAddr := chi.URLParam(r, "pm_address")
 
 	addr := common.HexToAddress(contractAddr)
 
-	// Get the contract's bytecode
-	bytecode, err := s.evm.CodeAt(context.Background(), addr, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Check if the contract is deployed
-	if len(bytecode) == 0 {
-		return nil, errors.New("paymaster contract not deployed")
-	}
-
-	// instantiate paymaster contract
-	pm, err := pay.NewPaymaster(addr, s.evm.Backend())
-	if err != nil {
-		return nil, err
-	}
-
 	// parse the incoming params
 
 	var params []any
-	err = json.NewDecoder(r.Body).Decode(&params)
+	err := json.NewDecoder(r.Body).Decode(&params)
 	if err != nil {
 		return nil, err
 	}
@@ -135,88 +135,24 @@ func (s *Service) Send(r *http.Request) (any, error) {
 		return nil, errors.New("error missing entry point address")
 	}
 
-	// check the paymaster signature, make sure it matches the paymaster address
-
-	// unpack the validity and check if it is valid
-	// Define the arguments
-	uint48Ty, _ := abi.NewType("uint48", "uint48", nil)
-	args := abi.Arguments{
-		abi.Argument{
-			Type: uint48Ty,
-		},
-		abi.Argument{
-			Type: uint48Ty,
-		},
-	}
+	entryPoint := common.HexToAddress(epAddr)
 
-	// Encode the values
-	validity, err := args.Unpack(userop.PaymasterAndData[20:84])
+	// convert to nostr event
+	println("creating user op event")
+	ev, err := nostreth.CreateUserOpEvent(s.chainId, &addr, &entryPoint, data, nil, 0, userop, nostreth.EventTypeUserOpSubmitted)
 	if err != nil {
 		return nil, err
 	}
 
-	validUntil, ok := validity[0].(*big.Int)
-	if !ok {
-		return nil, errors.New("error unmarshalling validity")
-	}
-
-	validAfter, ok := validity[1].(*big.Int)
-	if !ok {
-		return nil, errors.New("error unmarshalling validity")
-	}
-
-	// check if the signature is theoretically still valid
-	now := time.Now().Unix()
-	if validUntil.Int64() < now {
-		return nil, errors.New("paymaster signature has expired")
-	}
-
-	if validAfter.Int64() > now {
-		return nil, errors.New("paymaster signature is not valid yet")
-	}
+	// all lifecycle updates of this user op will share the same identifier
+	ev = nost.SetUserOpIdentifier(s.chainId, userop.GetHash(s.chainId), ev)
 
-	// Get the hash of the message that was signed
-	hash, err := pm.GetHash(nil, pay.UserOperation(userop), validUntil, validAfter)
+	// the same checks as for events published by nostr clients
+	err = s.Validate(ev)
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert the hash to an Ethereum signed message hash
-	hhash := accounts.TextHash(hash[:])
-
-	sig := make([]byte, len(userop.PaymasterAndData[84:]))
-	copy(sig, userop.PaymasterAndData[84:])
-
-	// update the signature v to undo the 27/28 addition
-	sig[crypto.RecoveryIDOffset] -= 27
-
-	// recover the public key from the signature
-	sigPublicKey, err := crypto.Ecrecover(hhash, sig)
-	if err != nil {
-		return nil, errors.New("error recovering public key")
-	}
-
-	// fetch the sponsor's corresponding private key from the db
-	sponsorKey, err := s.db.SponsorDB.GetSponsor(addr.Hex())
-	if err != nil {
-		return nil, errors.New("error getting sponsor key")
-	}
-
-	// Generate ecdsa.PrivateKey from bytes
-	privateKey, err := comm.HexToPrivateKey(sponsorKey.PrivateKey)
-	if err != nil {
-		return nil, errors.New("error converting private key")
-	}
-
-	publicKeyBytes := crypto.FromECDSAPub(&privateKey.PublicKey)
-
-	// check if the public key matches the recovered public key
-	matches := bytes.Equal(sigPublicKey, publicKeyBytes)
-	if !matches {
-		return nil, errors.New("paymaster signature does not match")
-	}
-
-	entryPoint := common.HexToAddress(epAddr)
 	if xdata != nil {
 		println("upserting log data")
 		// v1 compatibility, in order for indexing to match this message, we need to store the log data under the user op hash
@@ -230,13 +166,6 @@ func (s *Service) Send(r *http.Request) (any, error) {
 		}
 	}
 
-	// convert to nostr event
-	println("creating user op event")
-	ev, err := nostreth.CreateUserOpEvent(s.chainId, &addr, &entryPoint, data, nil, 0, userop, nostreth.EventTypeUserOpSubmitted)
-	if err != nil {
-		return nil, err
-	}
-
 	// this is a bit special, it is for v1 support
 	// we will save an event in nostr
 	// it will be processed (hopefully within 12 seconds)
@@ -284,11 +213,11 @@ func (s *Service) Process(ctx context.Context, evt *nostr.Event) error {
 		return nil
 	}
 
-	if uop.RetryCount >= 5 {
+	if uop.RetryCount >= maxRetries {
 		return nil
 	}
 
-	_, err = s.db.SponsorDB.GetSponsor(uop.Paymaster.Hex())
+	sponsorKey, err := s.db.SponsorDB.GetSponsor(uop.Paymaster.Hex())
 	if err != nil && err != pgx.ErrNoRows {
 		return err
 	}
@@ -297,14 +226,38 @@ func (s *Service) Process(ctx context.Context, evt *nostr.Event) error {
 		return nil
 	}
 
-	xdata, err := s.db.DataDB.GetData(fmt.Sprintf("userop:%s", uop.UserOpData.GetHash(s.chainId)))
+	sponsor, err := sponsorKey.Address()
+	if err != nil {
+		return err
+	}
+
+	hash := uop.UserOpData.GetHash(s.chainId)
+
+	xdata, err := s.db.DataDB.GetData(fmt.Sprintf("userop:%s", hash))
 	if err != nil && err != pgx.ErrNoRows {
 		return err
 	}
 
+	// events published by clients are re-published by the relay under the identifier shared by
+	// all lifecycle updates, so that an op only ever has a single latest state
+	if evt.PubKey != s.n.PubKey() {
+		ev, err := nostreth.UpdateUserOpEvent(s.chainId, uop.UserOpData, nil, 0, nostreth.EventTypeUserOpSubmitted, evt)
+		if err != nil {
+			return err
+		}
+
+		evt, err = s.n.SignAndReplaceEvent(ctx, nost.SetUserOpIdentifier(s.chainId, hash, ev))
+		if err != nil {
+			return err
+		}
+	}
+
 	// Create a new message
 	message := relay.NewTxMessage(s.chainId, evt, xdata)
 
+	// make the op visible to operators until its bundle is mined
+	s.mempool.Add(sponsor.Hex(), hash, uop.UserOpData.Sender.Hex(), uop.Paymaster.Hex(), uop.RetryCount, evt)
+
 	// Enqueue the message
 	if uop.RetryCount > 0 {
 		go func() {
@@ -319,3 +272,115 @@ func (s *Service) Process(ctx context.Context, evt *nostr.Event) error {
 
 	return nil
 }
+
+// GetLatest returns the latest lifecycle state of a user operation
+func (s *Service) GetLatest(w http.ResponseWriter, r *http.Request) {
+	// parse user op hash from url params
+	hash := chi.URLParam(r, "userop_hash")
+	if hash == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	state, err := s.n.GetLatestUserOp(s.chainId, hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = comm.Body(w, state, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetAccountLatest returns the latest lifecycle state of every user operation sent by an account
+func (s *Service) GetAccountLatest(w http.ResponseWriter, r *http.Request) {
+	// parse account address from url params
+	accaddr := chi.URLParam(r, "acc_addr")
+	if accaddr == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// parse pagination params from url query
+	limitq := r.URL.Query().Get("limit")
+	offsetq := r.URL.Query().Get("offset")
+
+	limit, err := strconv.Atoi(limitq)
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	limit = min(limit, maxLimit)
+
+	offset, err := strconv.Atoi(offsetq)
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	sender := comm.ChecksumAddress(accaddr)
+
+	// one more than requested tells whether there is a next page
+	states, err := s.n.GetLatestUserOps(sender, limit+1, offset)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	total, err := s.n.CountUserOps(sender)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	hasMore := len(states) > limit
+	states = states[:min(len(states), limit)]
+
+	err = comm.BodyMultiple(w, states, comm.Pagination{Limit: limit, Offset: offset, Total: total, HasMore: hasMore})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// GetMempool returns the queued and in-flight user operations grouped by sponsor
+func (s *Service) GetMempool(w http.ResponseWriter, r *http.Request) {
+	sponsors := s.mempool.Snapshot()
+
+	err := comm.BodyMultiple(w, sponsors, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// DropMempoolOp drops a queued user operation before it is bundled
+func (s *Service) DropMempoolOp(w http.ResponseWriter, r *http.Request) {
+	// parse user op hash from url params
+	hash := chi.URLParam(r, "userop_hash")
+	if hash == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err := s.mempool.Drop(hash)
+	if err != nil {
+		switch err {
+		case queue.ErrUserOpNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case queue.ErrUserOpInFlight:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = comm.Body(w, nil, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
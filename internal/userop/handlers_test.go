@@ -0,0 +1,138 @@
+package userop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/comunifi/nostr-eth/pkg/event"
+	nost "github.com/comunifi/relay/internal/nostr"
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/fiatjaf/eventstore/postgresql"
+	"github.com/fiatjaf/khatru"
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMain(m *testing.M) {
+	testdb.Main(m)
+}
+
+func newTestNostr(t *testing.T) *nost.Nostr {
+	t.Helper()
+
+	tdb := testdb.New(t)
+
+	ndb := &postgresql.PostgresBackend{DatabaseURL: tdb.URL()}
+	err := ndb.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ndb.Close)
+
+	return nost.NewNostr(nostr.GeneratePrivateKey(), ndb, khatru.NewRelay(), "ws://localhost:3334")
+}
+
+// accountLatest lists a page of the user ops of an account the way a client would
+func accountLatest(t *testing.T, s *Service, account string, query string) ([]relay.UserOpState, map[string]any) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/accounts/"+account+"/userops?"+query, nil)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("acc_addr", account)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	s.GetAccountLatest(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var resp struct {
+		Array []relay.UserOpState `json:"array"`
+		Meta  map[string]any      `json:"meta"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.Array, resp.Meta
+}
+
+func TestGetAccountLatest(t *testing.T) {
+	n := newTestNostr(t)
+	ctx := context.Background()
+
+	chainID := big.NewInt(100)
+	s := &Service{n: n, chainId: chainID}
+
+	f := testutil.New()
+	sender := testutil.Address("alice")
+	paymaster, entryPoint := testutil.Address("paymaster"), testutil.Address("entrypoint")
+
+	// three ops, the lifecycle of each one replaced twice
+	for nonce := range int64(3) {
+		op := testutil.UserOp(sender, nonce)
+
+		for _, eventType := range []event.EventTypeUserOp{nostreth.EventTypeUserOpSubmitted, nostreth.EventTypeUserOpExecuted, nostreth.EventTypeUserOpConfirmed} {
+			err := n.ReplaceSignedEvent(ctx, f.UserOpEvent(chainID, paymaster, entryPoint, op, nil, eventType))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// another account is not listed
+	err := n.ReplaceSignedEvent(ctx, f.UserOpEvent(chainID, paymaster, entryPoint, testutil.UserOp(testutil.Address("bob"), 0), nil, nostreth.EventTypeUserOpSubmitted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query   string
+		ids     int
+		limit   float64
+		offset  float64
+		hasMore bool
+	}{
+		{"", 3, 20, 0, false},
+		{"limit=2", 2, 2, 0, true},
+		{"limit=2&offset=2", 1, 2, 2, false},
+		{"limit=2&offset=3", 0, 2, 3, false},
+		{"limit=1000&offset=-1", 3, 100, 0, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			states, meta := accountLatest(t, s, sender.Hex(), tc.query)
+
+			if len(states) != tc.ids {
+				t.Fatalf("expected %d states, got %d", tc.ids, len(states))
+			}
+
+			// the latest state of every op, one per d tag
+			seen := map[string]bool{}
+			for _, st := range states {
+				if seen[st.ID] || st.Status != string(nostreth.EventTypeUserOpConfirmed) {
+					t.Fatalf("expected a single confirmed state per op, got %+v", states)
+				}
+				seen[st.ID] = true
+			}
+
+			want := map[string]any{"limit": tc.limit, "offset": tc.offset, "total": float64(3), "has_more": tc.hasMore}
+			if fmt.Sprint(meta) != fmt.Sprint(want) {
+				t.Fatalf("expected meta %v, got %v", want, meta)
+			}
+		})
+	}
+}
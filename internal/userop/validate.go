@@ -0,0 +1,74 @@
+package userop
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	nost "github.com/comunifi/relay/internal/nostr"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// maxRetries is the number of times the queue resubmits a user operation
+const maxRetries = 5
+
+// Reject validates user op events published by nostr clients before they are stored,
+// accepted events are queued by Process
+func (s *Service) Reject(ctx context.Context, evt *nostr.Event) (reject bool, msg string) {
+	if evt.Kind != nostreth.EventUserOpKind {
+		return false, ""
+	}
+
+	err := s.Validate(evt)
+	if err != nil {
+		return true, "invalid: " + err.Error()
+	}
+
+	return false, ""
+}
+
+// Validate checks that a user op event can be submitted: it must be a new submission for this chain,
+// identified by its hash and signed by the sponsor of a deployed paymaster
+func (s *Service) Validate(evt *nostr.Event) error {
+	uop, err := nostreth.ParseUserOpEvent(evt)
+	if err != nil {
+		return errors.New("user operation event could not be parsed")
+	}
+
+	// lifecycle updates are only published by the relay
+	if uop.EventType != nostreth.EventTypeUserOpSubmitted {
+		return errors.New("only submitted user operations can be published")
+	}
+
+	if uop.RetryCount != 0 {
+		return errors.New("retry count is set by the relay")
+	}
+
+	if layer := evt.Tags.Find("layer"); layer != nil && layer[1] != s.chainId.String() {
+		return errors.New("user operation is for another chain")
+	}
+
+	if uop.Paymaster == nil {
+		return errors.New("missing paymaster")
+	}
+
+	if uop.EntryPoint == nil {
+		return errors.New("missing entry point")
+	}
+
+	if len(s.entryPoints) > 0 && !slices.Contains(s.entryPoints, *uop.EntryPoint) {
+		return errors.New("entry point is not supported on this chain")
+	}
+
+	// both the plain hash and the identifier used for lifecycle updates are accepted
+	hash := uop.UserOpData.GetHash(s.chainId)
+	d := evt.Tags.GetD()
+	if d != hash && d != nost.UserOpIdentifier(s.chainId, hash) {
+		return errors.New("d tag does not match the user operation hash")
+	}
+
+	// the op is held to the same signature, policy and limits as ops signed through the paymaster api
+	return s.pm.Verify(*uop.Paymaster, relay.UserOp(uop.UserOpData))
+}
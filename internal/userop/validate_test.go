@@ -0,0 +1,110 @@
+package userop
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/comunifi/nostr-eth/pkg/event"
+	nost "github.com/comunifi/relay/internal/nostr"
+	"github.com/comunifi/relay/internal/paymaster"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func testUserOpEvent(t *testing.T, chainID *big.Int, eventType event.EventTypeUserOp) (*nostr.Event, nostreth.UserOp) {
+	t.Helper()
+
+	userop := nostreth.UserOp{
+		Sender:               common.HexToAddress("0x0000000000000000000000000000000000000001"),
+		Nonce:                big.NewInt(0),
+		InitCode:             []byte{},
+		CallData:             []byte{},
+		CallGasLimit:         big.NewInt(100000),
+		VerificationGasLimit: big.NewInt(100000),
+		PreVerificationGas:   big.NewInt(21000),
+		MaxFeePerGas:         big.NewInt(1),
+		MaxPriorityFeePerGas: big.NewInt(1),
+		PaymasterAndData:     []byte{0x01},
+		Signature:            []byte{},
+	}
+
+	paymaster := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	entryPoint := common.HexToAddress("0x0000000000000000000000000000000000000003")
+
+	ev, err := nostreth.CreateUserOpEvent(chainID, &paymaster, &entryPoint, nil, nil, 0, userop, eventType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ev, userop
+}
+
+func TestValidate(t *testing.T) {
+	chainID := big.NewInt(100)
+
+	s := &Service{chainId: chainID, pm: paymaster.NewService(nil, nil, chainID, paymaster.DefaultLimits)}
+
+	t.Run("Lifecycle update", func(t *testing.T) {
+		ev, _ := testUserOpEvent(t, chainID, nostreth.EventTypeUserOpConfirmed)
+
+		err := s.Validate(ev)
+		if err == nil || !strings.Contains(err.Error(), "only submitted") {
+			t.Fatalf("expected lifecycle updates to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Other chain", func(t *testing.T) {
+		ev, _ := testUserOpEvent(t, big.NewInt(1), nostreth.EventTypeUserOpSubmitted)
+
+		err := s.Validate(ev)
+		if err == nil || !strings.Contains(err.Error(), "another chain") {
+			t.Fatalf("expected op for another chain to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Identifier", func(t *testing.T) {
+		ev, _ := testUserOpEvent(t, chainID, nostreth.EventTypeUserOpSubmitted)
+		ev.Tags = ev.Tags.FilterOut([]string{"d"})
+		ev.Tags = append(ev.Tags, nostr.Tag{"d", "something-else"})
+
+		err := s.Validate(ev)
+		if err == nil || !strings.Contains(err.Error(), "d tag") {
+			t.Fatalf("expected mismatching d tag to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Paymaster data", func(t *testing.T) {
+		// both the plain hash and the lifecycle identifier are accepted, validation
+		// stops at the paymaster data before reaching the chain
+		ev, userop := testUserOpEvent(t, chainID, nostreth.EventTypeUserOpSubmitted)
+
+		err := s.Validate(ev)
+		if err == nil || !strings.Contains(err.Error(), "invalid paymaster data") {
+			t.Fatalf("expected short paymaster data to be rejected, got %v", err)
+		}
+
+		ev = nost.SetUserOpIdentifier(chainID, userop.GetHash(chainID), ev)
+
+		err = s.Validate(ev)
+		if err == nil || !strings.Contains(err.Error(), "invalid paymaster data") {
+			t.Fatalf("expected short paymaster data to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		ev, _ := testUserOpEvent(t, chainID, nostreth.EventTypeUserOpExecuted)
+
+		reject, msg := s.Reject(context.Background(), ev)
+		if !reject || !strings.HasPrefix(msg, "invalid: ") {
+			t.Fatalf("expected event to be rejected, got %v %q", reject, msg)
+		}
+
+		reject, _ = s.Reject(context.Background(), &nostr.Event{Kind: nostr.KindTextNote})
+		if reject {
+			t.Fatal("expected other kinds to pass")
+		}
+	})
+}
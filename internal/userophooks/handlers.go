@@ -0,0 +1,152 @@
+package userophooks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+)
+
+// parseAddress returns the address in the url if the caller can manage its webhooks: the
+// account itself or an operator
+func parseAddress(r *http.Request) (common.Address, int) {
+	addr := chi.URLParam(r, "address")
+	if !common.IsHexAddress(addr) {
+		return common.Address{}, http.StatusBadRequest
+	}
+
+	p, ok := relay.GetPrincipal(r.Context())
+	if !ok {
+		return common.Address{}, http.StatusUnauthorized
+	}
+
+	address := common.HexToAddress(addr)
+	if p.Has(relay.ScopeOperator) {
+		return address, 0
+	}
+
+	if !p.Has(relay.ScopeAccount) || common.HexToAddress(p.Address) != address {
+		return common.Address{}, http.StatusForbidden
+	}
+
+	return address, 0
+}
+
+// Register godoc
+//
+//	@Summary		Register a user op webhook
+//	@Description	post the transitions of the user ops sent or sponsored by an address to a url, the secret signing the deliveries is only returned here
+//	@Tags			userops
+//	@Accept			json
+//	@Produce		json
+//	@Param			address	path		string						true	"Sender or paymaster address"
+//	@Param			webhook	body		relay.UserOpWebhookRequest	true	"Webhook"
+//	@Success		200	{object}	common.Response
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		409
+//	@Failure		500
+//	@Router			/v1/userops/webhooks/{address} [post]
+func (s *Service) Register(w http.ResponseWriter, r *http.Request) {
+	address, status := parseAddress(r)
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	var req relay.UserOpWebhookRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	webhook, err := s.add(address, req.URL)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidURL):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrTooManyWebhooks):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = com.Body(w, webhook, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// List godoc
+//
+//	@Summary		List the user op webhooks of an address
+//	@Tags			userops
+//	@Produce		json
+//	@Param			address	path		string	true	"Sender or paymaster address"
+//	@Success		200	{object}	common.Response
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/v1/userops/webhooks/{address} [get]
+func (s *Service) List(w http.ResponseWriter, r *http.Request) {
+	address, status := parseAddress(r)
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	webhooks, err := s.webhooks(address)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.BodyMultiple(w, webhooks, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Remove godoc
+//
+//	@Summary		Remove a user op webhook
+//	@Tags			userops
+//	@Param			address	path	string	true	"Sender or paymaster address"
+//	@Param			id		path	string	true	"Webhook ID"
+//	@Success		204
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Router			/v1/userops/webhooks/{address}/{id} [delete]
+func (s *Service) Remove(w http.ResponseWriter, r *http.Request) {
+	address, status := parseAddress(r)
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	err := s.remove(address, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,316 @@
+// Package userophooks posts the transitions of user ops to the webhooks of their sender and
+// paymaster, so that backends don't have to poll the status of every user op they send.
+//
+// A sender registers webhooks with a signed request, operators can register them for any
+// address, paymasters included: POST /v1/userops/webhooks/{address} {"url": "https://..."}.
+// The secret returned on registration signs every delivery, the X-Relay-Signature header is the
+// hex HMAC-SHA256 of "<X-Relay-Timestamp>.<body>". Deliveries that fail or get a 5xx or 429
+// answer are retried with an exponential backoff.
+package userophooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	nost "github.com/comunifi/relay/internal/nostr"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// most webhooks of an address
+	maxWebhooks = 5
+
+	// how long a receiver has to answer a delivery
+	deliveryTimeout = 10 * time.Second
+
+	// a delivery is given up on after this many attempts
+	maxAttempts = 5
+
+	// transitions waiting for their deliveries, more are dropped
+	queueSize = 1024
+)
+
+var (
+	ErrInvalidURL       = errors.New("webhook url must be an https url")
+	ErrTooManyWebhooks  = fmt.Errorf("an address can't have more than %d webhooks", maxWebhooks)
+	ErrNotFound         = errors.New("webhook not found")
+	errDeliveryRejected = errors.New("webhook answered with an error")
+)
+
+// Store keeps the webhooks
+type Store interface {
+	AddWebhook(w *relay.UserOpWebhook) error
+	GetWebhooks(addresses ...string) ([]*relay.UserOpWebhook, error)
+	RemoveWebhook(address, id string) (bool, error)
+}
+
+// delivery is a transition posted to a webhook
+type delivery struct {
+	webhook *relay.UserOpWebhook
+	body    []byte
+	attempt int
+}
+
+type Service struct {
+	store  Store
+	client *http.Client
+
+	transitions chan *relay.UserOpTransition
+	retries     chan *delivery
+	backoff     time.Duration // before the first retry, doubled on every attempt
+
+	now func() time.Time
+}
+
+func NewService(store Store) *Service {
+	return &Service{
+		store:       store,
+		client:      &http.Client{Timeout: deliveryTimeout},
+		transitions: make(chan *relay.UserOpTransition, queueSize),
+		retries:     make(chan *delivery, queueSize),
+		backoff:     time.Second,
+		now:         time.Now,
+	}
+}
+
+// add registers a webhook of an address and returns it with its secret
+func (s *Service) add(address common.Address, rawURL string) (*relay.UserOpWebhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+
+	existing, err := s.store.GetWebhooks(address.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(existing) >= maxWebhooks {
+		return nil, ErrTooManyWebhooks
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &relay.UserOpWebhook{
+		ID:        id,
+		Address:   address.Hex(),
+		URL:       u.String(),
+		Secret:    secret,
+		CreatedAt: s.now().UTC(),
+	}
+
+	err = s.store.AddWebhook(w)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// webhooks returns the webhooks of an address without their secrets
+func (s *Service) webhooks(address common.Address) ([]*relay.UserOpWebhook, error) {
+	webhooks, err := s.store.GetWebhooks(address.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range webhooks {
+		w.Secret = ""
+	}
+
+	return webhooks, nil
+}
+
+// remove removes a webhook of an address
+func (s *Service) remove(address common.Address, id string) error {
+	ok, err := s.store.RemoveWebhook(address.Hex(), id)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// OnSaved queues the transitions of the user op events the relay stores, it is meant for
+// nostr.Nostr.OnSaved
+func (s *Service) OnSaved(ctx context.Context, ev *nostr.Event) {
+	if ev.Kind != nostreth.EventUserOpKind {
+		return
+	}
+
+	state, err := nost.ParseUserOpState(ev)
+	if err != nil {
+		log.Default().Printf("failed to parse user op event %s for webhooks: %v", ev.ID, err)
+		return
+	}
+
+	transition := Transition(state)
+	if transition == "" {
+		return
+	}
+
+	select {
+	case s.transitions <- &relay.UserOpTransition{Transition: transition, UserOp: state}:
+	default:
+		log.Default().Printf("user op webhook queue is full, dropping %s of %s", transition, state.ID)
+	}
+}
+
+// Transition returns the transition a user op state is delivered as, empty for the states that
+// aren't delivered
+func Transition(state *relay.UserOpState) string {
+	switch state.Status {
+	case string(nostreth.EventTypeUserOpSubmitted):
+		if state.RetryCount > 0 {
+			return relay.UserOpTransitionReplaced
+		}
+
+		return relay.UserOpTransitionSubmitted
+	case string(nostreth.EventTypeUserOpConfirmed):
+		return relay.UserOpTransitionConfirmed
+	case string(nostreth.EventTypeUserOpFailed), string(nostreth.EventTypeUserOpExpired):
+		return relay.UserOpTransitionFailed
+	}
+
+	return ""
+}
+
+// Start delivers the queued transitions until the context is done
+func (s *Service) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case t := <-s.transitions:
+			s.dispatch(ctx, t)
+		case d := <-s.retries:
+			go s.attempt(ctx, d)
+		}
+	}
+}
+
+// dispatch posts a transition to the webhooks of the sender and the paymaster of the user op
+func (s *Service) dispatch(ctx context.Context, t *relay.UserOpTransition) {
+	addresses := []string{t.UserOp.Sender}
+	if t.UserOp.Paymaster != "" {
+		addresses = append(addresses, t.UserOp.Paymaster)
+	}
+
+	webhooks, err := s.store.GetWebhooks(addresses...)
+	if err != nil {
+		log.Default().Printf("failed to get the webhooks of user op %s: %v", t.UserOp.ID, err)
+		return
+	}
+
+	for _, w := range webhooks {
+		body, err := json.Marshal(&relay.UserOpTransition{
+			WebhookID:  w.ID,
+			Transition: t.Transition,
+			UserOp:     t.UserOp,
+		})
+		if err != nil {
+			log.Default().Printf("failed to encode the transition of user op %s: %v", t.UserOp.ID, err)
+			return
+		}
+
+		// each webhook is attempted in its own goroutine so that a slow receiver doesn't hold
+		// the others back
+		go s.attempt(ctx, &delivery{webhook: w, body: body})
+	}
+}
+
+// attempt posts a delivery and schedules a retry when it fails
+func (s *Service) attempt(ctx context.Context, d *delivery) {
+	d.attempt++
+
+	err := s.post(ctx, d)
+	if err == nil {
+		return
+	}
+
+	if d.attempt >= maxAttempts {
+		log.Default().Printf("giving up on user op webhook %s after %d attempts: %v", d.webhook.ID, d.attempt, err)
+		return
+	}
+
+	wait := s.backoff << (d.attempt - 1)
+	time.AfterFunc(wait, func() {
+		select {
+		case s.retries <- d:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// post sends a delivery signed with the secret of its webhook
+func (s *Service) post(ctx context.Context, d *delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.webhook.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(relay.UserOpWebhookTimestampHeader, timestamp)
+	req.Header.Set(relay.UserOpWebhookSignatureHeader, Sign(d.webhook.Secret, timestamp, d.body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// other client errors won't be fixed by retrying
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %d", errDeliveryRejected, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the signature of a delivery, receivers compute it the same way to check it
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
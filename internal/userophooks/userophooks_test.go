@@ -0,0 +1,191 @@
+package userophooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type fakeStore struct {
+	mu       sync.Mutex
+	webhooks []*relay.UserOpWebhook
+}
+
+func (f *fakeStore) AddWebhook(w *relay.UserOpWebhook) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.webhooks = append(f.webhooks, w)
+	return nil
+}
+
+func (f *fakeStore) GetWebhooks(addresses ...string) ([]*relay.UserOpWebhook, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	webhooks := []*relay.UserOpWebhook{}
+	for _, w := range f.webhooks {
+		if slices.Contains(addresses, w.Address) {
+			c := *w
+			webhooks = append(webhooks, &c)
+		}
+	}
+
+	return webhooks, nil
+}
+
+func (f *fakeStore) RemoveWebhook(address, id string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, w := range f.webhooks {
+		if w.Address == address && w.ID == id {
+			f.webhooks = slices.Delete(f.webhooks, i, i+1)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func TestTransition(t *testing.T) {
+	cases := []struct {
+		status string
+		retry  int
+		want   string
+	}{
+		{string(nostreth.EventTypeUserOpSubmitted), 0, relay.UserOpTransitionSubmitted},
+		{string(nostreth.EventTypeUserOpSubmitted), 2, relay.UserOpTransitionReplaced},
+		{string(nostreth.EventTypeUserOpConfirmed), 0, relay.UserOpTransitionConfirmed},
+		{string(nostreth.EventTypeUserOpFailed), 0, relay.UserOpTransitionFailed},
+		{string(nostreth.EventTypeUserOpExpired), 0, relay.UserOpTransitionFailed},
+		{string(nostreth.EventTypeUserOpExecuted), 0, ""},
+	}
+
+	for _, c := range cases {
+		got := Transition(&relay.UserOpState{Status: c.status, RetryCount: c.retry})
+		if got != c.want {
+			t.Errorf("%s with %d retries: expected %q, got %q", c.status, c.retry, c.want, got)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	s := NewService(&fakeStore{})
+	addr := common.HexToAddress("0x1")
+
+	_, err := s.add(addr, "http://example.com/hook")
+	if !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected plain http to be refused, got %v", err)
+	}
+
+	for i := 0; i < maxWebhooks; i++ {
+		w, err := s.add(addr, "https://example.com/hook")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if w.Secret == "" || w.Address != addr.Hex() {
+			t.Fatalf("unexpected webhook %v", w)
+		}
+	}
+
+	_, err = s.add(addr, "https://example.com/hook")
+	if !errors.Is(err, ErrTooManyWebhooks) {
+		t.Fatalf("expected too many webhooks, got %v", err)
+	}
+
+	webhooks, err := s.webhooks(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, w := range webhooks {
+		if w.Secret != "" {
+			t.Fatal("expected listed webhooks to have no secret")
+		}
+	}
+
+	err = s.remove(addr, "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+
+		// the first attempt fails and is retried
+		if first {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	sender := common.HexToAddress("0x1").Hex()
+	store := &fakeStore{webhooks: []*relay.UserOpWebhook{
+		{ID: "hook", Address: sender, URL: srv.URL, Secret: "secret"},
+	}}
+
+	s := NewService(store)
+	s.backoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go s.Start(ctx)
+
+	s.transitions <- &relay.UserOpTransition{
+		Transition: relay.UserOpTransitionConfirmed,
+		UserOp:     &relay.UserOpState{ID: "0xop", Sender: sender, Status: string(nostreth.EventTypeUserOpConfirmed)},
+	}
+
+	var r *http.Request
+	var body []byte
+	select {
+	case r = <-received:
+		body = <-bodies
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the transition to be delivered")
+	}
+
+	timestamp := r.Header.Get(relay.UserOpWebhookTimestampHeader)
+	if r.Header.Get(relay.UserOpWebhookSignatureHeader) != Sign("secret", timestamp, body) {
+		t.Fatal("expected the delivery to be signed with the secret of the webhook")
+	}
+
+	var got relay.UserOpTransition
+	err := json.Unmarshal(body, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.WebhookID != "hook" || got.Transition != relay.UserOpTransitionConfirmed || got.UserOp.ID != "0xop" {
+		t.Fatalf("unexpected delivery %v", got)
+	}
+}
@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// telegram rejects messages longer than 4096 characters
+const maxTelegramLength = 4096
+
+// DefaultTelegramURL is the base url of the telegram bot api
+const DefaultTelegramURL = "https://api.telegram.org"
+
+// Channel posts messages to a chat outside of nostr
+type Channel interface {
+	Post(ctx context.Context, content string) error
+}
+
+// Discord posts to a discord channel through an incoming webhook
+type Discord struct {
+	URL string
+}
+
+func NewDiscord(url string) *Discord {
+	return &Discord{URL: url}
+}
+
+func (d *Discord) Post(ctx context.Context, content string) error {
+	return postJSON(ctx, d.URL, Message{Content: truncate(content, maxContentLength)})
+}
+
+// Telegram posts to a telegram chat as a bot
+type Telegram struct {
+	BaseURL string
+	Token   string
+	ChatID  string
+}
+
+func NewTelegram(token, chatID string) *Telegram {
+	return &Telegram{
+		BaseURL: DefaultTelegramURL,
+		Token:   token,
+		ChatID:  chatID,
+	}
+}
+
+type telegramMessage struct {
+	ChatID string `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+func (t *Telegram) Post(ctx context.Context, content string) error {
+	url := fmt.Sprintf("%s/bot%s/sendMessage", t.BaseURL, t.Token)
+
+	return postJSON(ctx, url, telegramMessage{ChatID: t.ChatID, Text: truncate(content, maxTelegramLength)})
+}
+
+func truncate(content string, max int) string {
+	if len(content) <= max {
+		return content
+	}
+
+	return content[:max-3] + "..."
+}
+
+// postJSON posts a json body, any 2xx status is a success
+func postJSON(ctx context.Context, url string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("error sending message: status %d", resp.StatusCode)
+	}
+
+	return nil
+}
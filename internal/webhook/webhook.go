@@ -1,124 +1,285 @@
 package webhook
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"net/http"
-
-	"github.com/comunifi/relay/pkg/relay"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Message struct {
 	Content string `json:"content"`
 }
 
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// discord rejects messages longer than 2000 characters
+const maxContentLength = 2000
+
+// warnings and errors kept for the status page
+const maxIncidents = 50
+
+// Limits keeps incidents from flooding the webhook
+type Limits struct {
+	DedupeWindow  time.Duration    // identical messages within the window are collapsed, 0 disables
+	PerMinute     map[Severity]int // messages sent per minute and severity, 0 is unlimited
+	FlushInterval time.Duration    // how often collapsed and dropped messages are summarized
+}
+
+var DefaultLimits = Limits{
+	DedupeWindow: 10 * time.Minute,
+	PerMinute: map[Severity]int{
+		SeverityInfo:    30,
+		SeverityWarning: 10,
+		SeverityError:   10,
+	},
+	FlushInterval: 5 * time.Minute,
+}
+
+// seen is a message that was sent within the dedupe window
+type seen struct {
+	severity Severity
+	text     string
+	sentAt   time.Time
+	repeats  int
+}
+
+// Incident is a warning or an error that was reported, whether or not it was sent
+type Incident struct {
+	Severity Severity  `json:"severity"`
+	Text     string    `json:"text"`
+	At       time.Time `json:"at"`
+}
+
+// rate counts the messages of a severity sent in the current minute
+type rate struct {
+	minute time.Time
+	sent   int
+}
+
 type Messager struct {
 	BaseURL    string
 	ServerName string
 
 	notify bool
+
+	mu      sync.Mutex
+	limits  Limits
+	seen    map[string]*seen
+	rates   map[Severity]*rate
+	dropped map[Severity]int
+
+	incidents []Incident // latest last
+
+	now func() time.Time
 }
 
-func NewMessager(baseURL, serverName string, notify bool) relay.WebhookMessager {
+func NewMessager(baseURL, serverName string, notify bool) *Messager {
 	return &Messager{
 		BaseURL:    baseURL,
 		ServerName: serverName,
 		notify:     notify,
+		limits:     DefaultLimits,
+		seen:       map[string]*seen{},
+		rates:      map[Severity]*rate{},
+		dropped:    map[Severity]int{},
+		now:        time.Now,
 	}
 }
 
-func (b *Messager) Notify(ctx context.Context, message string) error {
-	if !b.notify {
+// SetLimits configures deduplication and rate limiting
+func (b *Messager) SetLimits(l Limits) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.limits = l
+}
+
+// Start sends a summary of the collapsed and dropped messages every flush interval
+func (b *Messager) Start(ctx context.Context) error {
+	if !b.notify || b.limits.FlushInterval <= 0 {
 		return nil
 	}
 
-	data, err := json.Marshal(Message{Content: fmt.Sprintf("[%s] %s", b.ServerName, message)})
-	if err != nil {
-		return err
-	}
+	ticker := time.NewTicker(b.limits.FlushInterval)
+	defer ticker.Stop()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.BaseURL, bytes.NewReader(data))
-	if err != nil {
-		return err
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := b.Flush(ctx)
+			if err != nil {
+				log.Default().Println("failed to flush webhook summary:", err)
+			}
+		}
 	}
+}
 
-	req.Header.Add("Content-Type", "application/json")
+func (b *Messager) Notify(ctx context.Context, message string) error {
+	return b.send(ctx, SeverityInfo, message)
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
+func (b *Messager) NotifyWarning(ctx context.Context, errorMessage error) error {
+	return b.send(ctx, SeverityWarning, errorMessage.Error())
+}
 
-	defer resp.Body.Close()
+func (b *Messager) NotifyError(ctx context.Context, errorMessage error) error {
+	return b.send(ctx, SeverityError, errorMessage.Error())
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.New("error sending message")
+// Flush sends a single message summarizing the messages that were collapsed or dropped since
+// the last flush, nothing is sent when there are none
+func (b *Messager) Flush(ctx context.Context) error {
+	summary := b.summary()
+	if summary == "" {
+		return nil
 	}
 
-	return nil
+	return b.post(ctx, summary)
 }
 
-func (b *Messager) NotifyWarning(ctx context.Context, errorMessage error) error {
+func (b *Messager) send(ctx context.Context, severity Severity, text string) error {
+	if severity != SeverityInfo {
+		b.record(severity, text)
+	}
+
 	if !b.notify {
 		return nil
 	}
 
-	data, err := json.Marshal(Message{Content: fmt.Sprintf("[%s] warning: %s", b.ServerName, errorMessage.Error())})
-	if err != nil {
-		return err
+	if !b.allow(severity, text) {
+		return nil
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.BaseURL, bytes.NewReader(data))
-	if err != nil {
-		return err
+	content := fmt.Sprintf("[%s] %s", b.ServerName, text)
+	if severity != SeverityInfo {
+		content = fmt.Sprintf("[%s] %s: %s", b.ServerName, severity, text)
 	}
 
-	req.Header.Add("Content-Type", "application/json")
+	return b.post(ctx, content)
+}
+
+// record keeps a warning or an error for Recent, the oldest is forgotten once there are too many
+func (b *Messager) record(severity Severity, text string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	b.incidents = append(b.incidents, Incident{Severity: severity, Text: text, At: b.now()})
+	if len(b.incidents) > maxIncidents {
+		b.incidents = b.incidents[len(b.incidents)-maxIncidents:]
 	}
+}
 
-	defer resp.Body.Close()
+// Recent returns the latest warnings and errors, latest first, including the ones that were
+// collapsed, rate limited or not sent because notifications are off
+func (b *Messager) Recent() []Incident {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.New("error sending message")
+	recent := make([]Incident, 0, len(b.incidents))
+	for i := len(b.incidents) - 1; i >= 0; i-- {
+		recent = append(recent, b.incidents[i])
 	}
 
-	return nil
+	return recent
 }
 
-func (b *Messager) NotifyError(ctx context.Context, errorMessage error) error {
-	if !b.notify {
-		return nil
+// allow decides whether a message is sent now, messages that are held back are counted for the
+// next summary
+func (b *Messager) allow(severity Severity, text string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	key := string(severity) + "\x00" + text
+
+	if s, ok := b.seen[key]; ok && now.Sub(s.sentAt) < b.limits.DedupeWindow {
+		s.repeats++
+		return false
 	}
 
-	data, err := json.Marshal(Message{Content: fmt.Sprintf("[%s] error: %s", b.ServerName, errorMessage.Error())})
-	if err != nil {
-		return err
+	if limit := b.limits.PerMinute[severity]; limit > 0 {
+		minute := now.Truncate(time.Minute)
+
+		r, ok := b.rates[severity]
+		if !ok || !r.minute.Equal(minute) {
+			r = &rate{minute: minute}
+			b.rates[severity] = r
+		}
+
+		if r.sent >= limit {
+			b.dropped[severity]++
+			return false
+		}
+
+		r.sent++
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.BaseURL, bytes.NewReader(data))
-	if err != nil {
-		return err
+	if b.limits.DedupeWindow > 0 {
+		b.seen[key] = &seen{severity: severity, text: text, sentAt: now}
 	}
 
-	req.Header.Add("Content-Type", "application/json")
+	return true
+}
+
+func (b *Messager) summary() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	repeated := []*seen{}
+	for key, s := range b.seen {
+		if s.repeats > 0 {
+			repeated = append(repeated, &seen{severity: s.severity, text: s.text, repeats: s.repeats})
+			s.repeats = 0
+		}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+		if now.Sub(s.sentAt) >= b.limits.DedupeWindow {
+			delete(b.seen, key)
+		}
 	}
 
-	defer resp.Body.Close()
+	dropped := []string{}
+	for _, severity := range []Severity{SeverityError, SeverityWarning, SeverityInfo} {
+		if n := b.dropped[severity]; n > 0 {
+			dropped = append(dropped, fmt.Sprintf("%d %s", n, severity))
+		}
+	}
+	b.dropped = map[Severity]int{}
+
+	if len(repeated) == 0 && len(dropped) == 0 {
+		return ""
+	}
+
+	// most repeated first so the noisiest incident survives truncation
+	sort.Slice(repeated, func(i, j int) bool {
+		return repeated[i].repeats > repeated[j].repeats
+	})
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.New("error sending message")
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s] summary:", b.ServerName)
+	for _, s := range repeated {
+		fmt.Fprintf(&sb, "\n- %s: %s (repeated %d more times)", s.severity, s.text, s.repeats)
 	}
+	if len(dropped) > 0 {
+		fmt.Fprintf(&sb, "\n- rate limited: %s messages dropped", strings.Join(dropped, ", "))
+	}
+
+	return truncate(sb.String(), maxContentLength)
+}
 
-	return nil
+func (b *Messager) post(ctx context.Context, content string) error {
+	return postJSON(ctx, b.BaseURL, Message{Content: content})
 }
@@ -0,0 +1,209 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sink struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (s *sink) all() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.messages...)
+}
+
+func newTestMessager(t *testing.T, l Limits) (*Messager, *sink, *time.Time) {
+	t.Helper()
+
+	s := &sink{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m Message
+		json.NewDecoder(r.Body).Decode(&m)
+
+		s.mu.Lock()
+		s.messages = append(s.messages, m.Content)
+		s.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	m := NewMessager(srv.URL, "test", true)
+	m.SetLimits(l)
+	m.now = func() time.Time { return now }
+
+	return m, s, &now
+}
+
+func TestDedupe(t *testing.T) {
+	m, s, now := newTestMessager(t, Limits{DedupeWindow: 10 * time.Minute})
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		m.NotifyError(ctx, errors.New("rpc down"))
+	}
+	m.NotifyWarning(ctx, errors.New("rpc down"))
+
+	if got := s.all(); len(got) != 2 || got[0] != "[test] error: rpc down" || got[1] != "[test] warning: rpc down" {
+		t.Fatalf("expected one message per severity, got %v", got)
+	}
+
+	err := m.Flush(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.all()
+	if len(got) != 3 || !strings.Contains(got[2], "error: rpc down (repeated 4 more times)") {
+		t.Fatalf("expected a summary of the repeats, got %v", got)
+	}
+
+	// the window is still open, a repeat is collapsed again
+	m.NotifyError(ctx, errors.New("rpc down"))
+	if len(s.all()) != 3 {
+		t.Fatal("expected the repeat to be collapsed")
+	}
+
+	*now = now.Add(11 * time.Minute)
+
+	m.NotifyError(ctx, errors.New("rpc down"))
+	if len(s.all()) != 4 {
+		t.Fatal("expected the message to be sent again once the window closed")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	m, s, now := newTestMessager(t, Limits{PerMinute: map[Severity]int{SeverityError: 2}})
+	ctx := context.Background()
+
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		m.NotifyError(ctx, errors.New(msg))
+	}
+	m.Notify(ctx, "info is not limited")
+
+	if got := s.all(); len(got) != 3 {
+		t.Fatalf("expected 2 errors and the info message, got %v", got)
+	}
+
+	m.Flush(ctx)
+
+	got := s.all()
+	if !strings.Contains(got[len(got)-1], "rate limited: 2 error messages dropped") {
+		t.Fatalf("expected the dropped messages to be summarized, got %v", got)
+	}
+
+	*now = now.Add(time.Minute)
+
+	m.NotifyError(ctx, errors.New("e"))
+	if len(s.all()) != 5 {
+		t.Fatal("expected the limit to reset the next minute")
+	}
+}
+
+func TestFlushNothing(t *testing.T) {
+	m, s, _ := newTestMessager(t, DefaultLimits)
+
+	m.Notify(context.Background(), "hello")
+	m.Flush(context.Background())
+
+	if got := s.all(); len(got) != 1 {
+		t.Fatalf("expected no summary without collapsed messages, got %v", got)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	m, s, _ := newTestMessager(t, DefaultLimits)
+	m.notify = false
+
+	m.NotifyError(context.Background(), errors.New("boom"))
+
+	if len(s.all()) != 0 {
+		t.Fatal("expected nothing to be sent when notifications are disabled")
+	}
+}
+
+func TestChannels(t *testing.T) {
+	var got []map[string]string
+	var paths []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]string
+		json.NewDecoder(r.Body).Decode(&m)
+
+		got = append(got, m)
+		paths = append(paths, r.URL.Path)
+
+		// discord replies without content unless asked to wait
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+
+	err := NewDiscord(srv.URL+"/discord").Post(ctx, strings.Repeat("a", 3000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tg := NewTelegram("token", "-100")
+	tg.BaseURL = srv.URL
+
+	err = tg.Post(ctx, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got[0]["content"]) != maxContentLength || !strings.HasSuffix(got[0]["content"], "...") {
+		t.Errorf("expected the discord message to be truncated, got %d characters", len(got[0]["content"]))
+	}
+
+	if paths[1] != "/bottoken/sendMessage" || got[1]["chat_id"] != "-100" || got[1]["text"] != "hello" {
+		t.Errorf("unexpected telegram request %s %v", paths[1], got[1])
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(failing.Close)
+
+	err = NewDiscord(failing.URL).Post(ctx, "hello")
+	if err == nil {
+		t.Error("expected an error for a failed post")
+	}
+}
+
+func TestRecent(t *testing.T) {
+	m, _, _ := newTestMessager(t, Limits{DedupeWindow: 10 * time.Minute})
+	ctx := context.Background()
+
+	m.Notify(ctx, "deployed")
+	m.NotifyError(ctx, errors.New("rpc down"))
+	m.NotifyError(ctx, errors.New("rpc down"))
+	m.NotifyWarning(ctx, errors.New("queue full"))
+
+	// collapsed messages are still recorded, infos are not
+	recent := m.Recent()
+	if len(recent) != 3 || recent[0].Text != "queue full" || recent[2].Severity != SeverityError {
+		t.Fatalf("unexpected incidents %+v", recent)
+	}
+
+	for i := 0; i < maxIncidents+5; i++ {
+		m.NotifyError(ctx, errors.New("rpc down"))
+	}
+
+	if len(m.Recent()) != maxIncidents {
+		t.Fatalf("expected at most %d incidents, got %d", maxIncidents, len(m.Recent()))
+	}
+}
@@ -0,0 +1,64 @@
+package wordfilter
+
+import (
+	"net/http"
+	"time"
+
+	com "github.com/comunifi/relay/pkg/common"
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultSince = 30 * 24 * time.Hour
+	defaultLimit = 100
+	maxLimit     = 500
+)
+
+// Filtered godoc
+//
+//	@Summary		List the filtered messages of a group
+//	@Description	messages that matched a keyword filter of the group, latest first, for its admins
+//	@Tags			groups
+//	@Accept			json
+//	@Produce		json
+//	@Param			group_id	path		string		true	"Group ID"
+//	@Param			request		body		nostr.Event	true	"Request event signed by an admin, its content a relay.FilteredContentRequest"
+//	@Success		200			{object}	common.Response
+//	@Failure		400
+//	@Failure		401
+//	@Failure		403
+//	@Failure		500
+//	@Router			/v1/groups/{group_id}/filtered/list [post]
+func (s *Service) Filtered(w http.ResponseWriter, r *http.Request) {
+	groupID := chi.URLParam(r, "group_id")
+
+	var req relay.FilteredContentRequest
+	_, err := com.ParseAdminRequest(r, s.groups, groupID, s.now(), &req)
+	if err != nil {
+		com.WriteAdminRequestError(w, err)
+		return
+	}
+
+	since := s.now().Add(-defaultSince)
+	if req.Since > 0 {
+		since = time.Unix(req.Since, 0)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	limit = min(limit, maxLimit)
+
+	filtered, err := s.store.GetFiltered(groupID, since.UTC(), limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = com.BodyMultiple(w, filtered, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
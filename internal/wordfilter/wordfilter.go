@@ -0,0 +1,274 @@
+// Package wordfilter filters the messages of groups by keyword.
+//
+// The relay filters the keywords of WORD_FILTER_DEFAULTS in every group. The admins of a group
+// publish the filter settings of their group as an addressable event whose d and h tags are the
+// group id:
+//
+//	{"kind": 31403, "tags": [["d", "<group>"], ["h", "<group>"], ["word", "<keyword>"], ...,
+//	  ["action", "reject|flag"], ["defaults", "off"]]}
+//
+// The words of a group extend the relay defaults, unless the defaults are turned off. Keywords
+// match whole words of the content, subject and title of a message, case insensitively. A message
+// that matches is rejected or, when flagged, stored as usual. Either way it is recorded for the
+// admins of the group, who list the records with a signed request.
+package wordfilter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/fiatjaf/eventstore"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// KindGroupFilters is the addressable event holding the filter settings of a group
+const KindGroupFilters = 31403
+
+const (
+	maxWords        = 500
+	maxWordLength   = 64
+	maxAuditContent = 1000 // characters of a message kept in its record
+)
+
+var ErrInvalidFilters = errors.New("invalid filter settings")
+
+// Groups decides who administers a group
+type Groups interface {
+	IsAdmin(ctx context.Context, pubkey, groupID string) (bool, error)
+}
+
+// Store keeps the records of filtered messages
+type Store interface {
+	AddFiltered(f *relay.FilteredContent) error
+	GetFiltered(groupID string, since time.Time, limit int) ([]*relay.FilteredContent, error)
+}
+
+// Filters are the filter settings of a group
+type Filters struct {
+	Words    []string
+	Action   string // empty uses the relay action
+	Defaults bool   // whether the relay defaults are filtered too
+}
+
+// ParseFilters reads the filter settings of a group from its settings event
+func ParseFilters(ev *nostr.Event) (*Filters, error) {
+	f := &Filters{Defaults: true}
+
+	for _, tag := range ev.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+
+		switch tag[0] {
+		case "word":
+			word := normalize(tag[1])
+			if word == "" || len([]rune(word)) > maxWordLength {
+				return nil, fmt.Errorf("%w: a word must have between 1 and %d characters", ErrInvalidFilters, maxWordLength)
+			}
+
+			f.Words = append(f.Words, word)
+		case "action":
+			if tag[1] != relay.FilterActionReject && tag[1] != relay.FilterActionFlag {
+				return nil, fmt.Errorf("%w: the action must be %s or %s", ErrInvalidFilters, relay.FilterActionReject, relay.FilterActionFlag)
+			}
+
+			f.Action = tag[1]
+		case "defaults":
+			f.Defaults = tag[1] != "off"
+		}
+	}
+
+	if len(f.Words) > maxWords {
+		return nil, fmt.Errorf("%w: at most %d words", ErrInvalidFilters, maxWords)
+	}
+
+	return f, nil
+}
+
+type Service struct {
+	events   eventstore.Store
+	groups   Groups
+	store    Store
+	defaults []string // normalized
+	action   string
+
+	now func() time.Time
+}
+
+func NewService(events eventstore.Store, groups Groups, store Store, defaults []string, action string) *Service {
+	words := []string{}
+	for _, w := range defaults {
+		if w = normalize(w); w != "" {
+			words = append(words, w)
+		}
+	}
+
+	return &Service{
+		events:   events,
+		groups:   groups,
+		store:    store,
+		defaults: words,
+		action:   action,
+		now:      time.Now,
+	}
+}
+
+// RejectEvent checks the filter settings published by admins and filters the other messages of
+// groups, it is called by the groups service once the author may post into the group
+func (s *Service) RejectEvent(ctx context.Context, ev *nostr.Event) (bool, string) {
+	groupID := tagValue(ev, "h")
+	if groupID == "" {
+		return false, ""
+	}
+
+	if ev.Kind == KindGroupFilters {
+		return s.rejectSettings(ctx, ev, groupID)
+	}
+
+	words, action := s.filters(ctx, groupID)
+	if len(words) == 0 {
+		return false, ""
+	}
+
+	word := match(text(ev), words)
+	if word == "" {
+		return false, ""
+	}
+
+	content := ev.Content
+	if r := []rune(content); len(r) > maxAuditContent {
+		content = string(r[:maxAuditContent])
+	}
+
+	err := s.store.AddFiltered(&relay.FilteredContent{
+		GroupID:   groupID,
+		EventID:   ev.ID,
+		Pubkey:    ev.PubKey,
+		Kind:      ev.Kind,
+		Keyword:   word,
+		Action:    action,
+		Content:   content,
+		CreatedAt: s.now().UTC(),
+	})
+	if err != nil {
+		log.Default().Printf("failed to record filtered message %s: %v", ev.ID, err)
+	}
+
+	if action == relay.FilterActionReject {
+		return true, "blocked: this message contains a word filtered in this group"
+	}
+
+	return false, ""
+}
+
+// rejectSettings only accepts valid filter settings from the admins of the group
+func (s *Service) rejectSettings(ctx context.Context, ev *nostr.Event, groupID string) (bool, string) {
+	if tagValue(ev, "d") != groupID {
+		return true, "invalid: the d tag of the filter settings must be the group id"
+	}
+
+	admin, err := s.groups.IsAdmin(ctx, ev.PubKey, groupID)
+	if err != nil {
+		log.Default().Printf("Error checking admin status: %v", err)
+		return true, "error: internal error checking admin status"
+	}
+
+	if !admin {
+		return true, "restricted: only group admins can change the filters"
+	}
+
+	_, err = ParseFilters(ev)
+	if err != nil {
+		return true, "invalid: " + err.Error()
+	}
+
+	return false, ""
+}
+
+// filters returns the words filtered in a group and what happens to the messages matching them,
+// from the latest settings published by its admins
+func (s *Service) filters(ctx context.Context, groupID string) ([]string, string) {
+	ch, err := s.events.QueryEvents(ctx, nostr.Filter{
+		Kinds: []int{KindGroupFilters},
+		Tags:  nostr.TagMap{"d": []string{groupID}},
+	})
+	if err != nil {
+		log.Default().Printf("failed to query the filters of group %s: %v", groupID, err)
+		return s.defaults, s.action
+	}
+
+	var latest *nostr.Event
+	for ev := range ch {
+		if latest == nil || ev.CreatedAt > latest.CreatedAt {
+			latest = ev
+		}
+	}
+
+	if latest == nil {
+		return s.defaults, s.action
+	}
+
+	f, err := ParseFilters(latest)
+	if err != nil {
+		return s.defaults, s.action
+	}
+
+	words := f.Words
+	if f.Defaults {
+		words = append(words, s.defaults...)
+	}
+
+	action := f.Action
+	if action == "" {
+		action = s.action
+	}
+
+	return words, action
+}
+
+// text is what the filters are matched against, the subject and title of a message come first
+func text(ev *nostr.Event) string {
+	parts := []string{}
+	for _, tag := range ev.Tags {
+		if len(tag) >= 2 && (tag[0] == "subject" || tag[0] == "title") {
+			parts = append(parts, tag[1])
+		}
+	}
+
+	return normalize(strings.Join(append(parts, ev.Content), " "))
+}
+
+// match returns the first word found in a normalized text, words of several terms match as a
+// phrase
+func match(text string, words []string) string {
+	padded := " " + text + " "
+	for _, w := range words {
+		if strings.Contains(padded, " "+w+" ") {
+			return w
+		}
+	}
+
+	return ""
+}
+
+// normalize lowercases a text and separates its words by a single space
+func normalize(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func tagValue(ev *nostr.Event, name string) string {
+	tag := ev.Tags.GetFirst([]string{name, ""})
+	if tag != nil && len(*tag) >= 2 {
+		return (*tag)[1]
+	}
+
+	return ""
+}
@@ -0,0 +1,151 @@
+package wordfilter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/comunifi/relay/pkg/relay"
+	"github.com/comunifi/relay/pkg/testutil"
+	"github.com/fiatjaf/eventstore/slicestore"
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type fakeStore struct {
+	filtered []*relay.FilteredContent
+}
+
+func (f *fakeStore) AddFiltered(c *relay.FilteredContent) error {
+	f.filtered = append(f.filtered, c)
+	return nil
+}
+
+func (f *fakeStore) GetFiltered(groupID string, since time.Time, limit int) ([]*relay.FilteredContent, error) {
+	return f.filtered, nil
+}
+
+func message(content string, tags ...nostr.Tag) *nostr.Event {
+	return &nostr.Event{ID: "msg", PubKey: "member", Kind: 9, Content: content, Tags: append(nostr.Tags{{"h", "group"}}, tags...)}
+}
+
+func TestRejectEvent(t *testing.T) {
+	events := &slicestore.SliceStore{}
+	events.Init()
+
+	store := &fakeStore{}
+	s := NewService(events, &testutil.FakeGroups{Admins: map[string][]string{"group": {"admin"}}}, store, []string{"Darn", "  "}, relay.FilterActionReject)
+
+	for content, reject := range map[string]bool{
+		"well DARN it!":   true,
+		"darned machines": false,
+		"all good":        false,
+	} {
+		got, _ := s.RejectEvent(context.Background(), message(content))
+		if got != reject {
+			t.Errorf("expected %q to be rejected: %v, got %v", content, reject, got)
+		}
+	}
+
+	reject, _ := s.RejectEvent(context.Background(), message("hello", nostr.Tag{"subject", "darn"}))
+	if !reject {
+		t.Error("expected the subject to be filtered")
+	}
+
+	if len(store.filtered) != 2 || store.filtered[0].Keyword != "darn" || store.filtered[0].Action != relay.FilterActionReject {
+		t.Fatalf("expected the rejected messages to be recorded, got %v", store.filtered)
+	}
+}
+
+func TestGroupFilters(t *testing.T) {
+	events := &slicestore.SliceStore{}
+	events.Init()
+
+	store := &fakeStore{}
+	s := NewService(events, &testutil.FakeGroups{Admins: map[string][]string{"group": {"admin"}}}, store, []string{"darn"}, relay.FilterActionReject)
+
+	settings := &nostr.Event{
+		ID:        "settings",
+		PubKey:    "member",
+		Kind:      KindGroupFilters,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"d", "group"}, {"h", "group"}, {"word", "Bad Word"}, {"action", "flag"}, {"defaults", "off"}},
+	}
+
+	reject, msg := s.RejectEvent(context.Background(), settings)
+	if !reject || !strings.HasPrefix(msg, "restricted:") {
+		t.Fatalf("expected the settings of a member to be rejected, got %q", msg)
+	}
+
+	settings.PubKey = "admin"
+	reject, _ = s.RejectEvent(context.Background(), settings)
+	if reject {
+		t.Fatal("expected the settings of an admin to be accepted")
+	}
+	events.SaveEvent(context.Background(), settings)
+
+	// the relay defaults are off and matching messages are only flagged
+	reject, _ = s.RejectEvent(context.Background(), message("darn"))
+	if reject {
+		t.Fatal("expected the relay defaults to be off")
+	}
+
+	reject, _ = s.RejectEvent(context.Background(), message("that is a bad, word"))
+	if reject {
+		t.Fatal("expected the message to be flagged")
+	}
+
+	if len(store.filtered) != 1 || store.filtered[0].Keyword != "bad word" || store.filtered[0].Action != relay.FilterActionFlag {
+		t.Fatalf("expected the flagged message to be recorded, got %v", store.filtered)
+	}
+
+	invalid := &nostr.Event{PubKey: "admin", Kind: KindGroupFilters, Tags: nostr.Tags{{"d", "group"}, {"h", "group"}, {"action", "hide"}}}
+	reject, _ = s.RejectEvent(context.Background(), invalid)
+	if !reject {
+		t.Fatal("expected invalid settings to be rejected")
+	}
+}
+
+func TestFilteredInvalidContent(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewService(&slicestore.SliceStore{}, &testutil.FakeGroups{Admins: map[string][]string{"group": {pk}}}, &fakeStore{}, nil, relay.FilterActionReject)
+
+	ev := nostr.Event{
+		Kind:      nostr.KindHTTPAuth,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"u", "http://example.com/v1/groups/group/filtered/list"}, {"method", http.MethodPost}},
+		Content:   `{"limit":"ten"}`,
+	}
+	err = ev.Sign(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("group_id", "group")
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/groups/group/filtered/list", bytes.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	s.Filtered(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a request of the wrong type to be a bad request, got %d", w.Code)
+	}
+}
@@ -193,6 +193,18 @@ func (cm *ConnectionPool) OpenClients(query string) int {
 	return clients
 }
 
+// returns the number of open clients across all queries
+func (cm *ConnectionPool) Connections() int {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	clients := 0
+	for query := range cm.clients {
+		clients += cm.OpenClients(query)
+	}
+	return clients
+}
+
 // returns all queries in the connection pool
 func (cm *ConnectionPool) Queries() []string {
 	cm.mutex.Lock()
@@ -33,6 +33,21 @@ func (p *ConnectionPools) Connect(w http.ResponseWriter, r *http.Request, topic
 	p.pools[topic].Connect(w, r)
 }
 
+// Connections returns the number of clients connected to all topics
+func (p *ConnectionPools) Connections() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, pool := range p.pools {
+		if pool.IsOpen() {
+			n += pool.Connections()
+		}
+	}
+
+	return n
+}
+
 // BroadcastMessage broadcasts a message to all clients in a topic
 func (p *ConnectionPools) BroadcastMessage(t relay.WSMessageType, m relay.WSMessageCreator) {
 	wsm := m.ToWSMessage(t)
@@ -0,0 +1,34 @@
+package common
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// balanceOf(address), shared by erc20 and erc721
+var balanceOfSig = crypto.Keccak256([]byte("balanceOf(address)"))[:4]
+
+// ContractCaller calls a contract at a block, nil is the latest block
+type ContractCaller interface {
+	CallContract(call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// BalanceOf returns the erc20 balance or the number of erc721 tokens of an account at a block
+func BalanceOf(evm ContractCaller, token, account common.Address, block *big.Int) (*big.Int, error) {
+	data := append(append([]byte{}, balanceOfSig...), common.LeftPadBytes(account.Bytes(), 32)...)
+
+	out, err := evm.CallContract(ethereum.CallMsg{To: &token, Data: data}, block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out) < 32 {
+		return nil, errors.New("invalid balanceOf result")
+	}
+
+	return new(big.Int).SetBytes(out[:32]), nil
+}
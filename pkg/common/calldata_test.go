@@ -196,6 +196,16 @@ func (m *MockEVMRequester) StorageAt(addr common.Address, slot common.Hash) ([]b
 }
 
 // WaitForTx implements indexer.EVMRequester.
-func (m *MockEVMRequester) WaitForTx(tx *types.Transaction, timeout int) error {
+func (m *MockEVMRequester) WaitForTx(tx *types.Transaction, timeout int) (*types.Receipt, error) {
+	panic("unimplemented")
+}
+
+// TransactionReceipt implements indexer.EVMRequester.
+func (m *MockEVMRequester) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	panic("unimplemented")
+}
+
+// TransactionSender implements indexer.EVMRequester.
+func (m *MockEVMRequester) TransactionSender(ctx context.Context, txHash, blockHash common.Hash, index uint) (common.Address, error) {
 	panic("unimplemented")
 }
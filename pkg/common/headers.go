@@ -6,8 +6,7 @@ import (
 	"github.com/comunifi/relay/pkg/relay"
 )
 
-// GetContextAddress returns the indexer.ContextKeyAddress from the context
+// GetContextAddress returns the account the request was signed for
 func GetContextAddress(ctx context.Context) (string, bool) {
-	addr, ok := ctx.Value(relay.ContextKeyAddress).(string)
-	return addr, ok
+	return relay.GetAddressFromContext(ctx)
 }
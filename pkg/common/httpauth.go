@@ -0,0 +1,204 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// RequestMaxAge is how far a signed request can be from now
+const RequestMaxAge = 5 * time.Minute
+
+var (
+	ErrRequestEventMismatch    = errors.New("signed event was not made for this request")
+	ErrInvalidRequest          = errors.New("invalid request")
+	ErrInvalidRequestSignature = errors.New("invalid request signature")
+	ErrExpiredRequest          = errors.New("request event is expired")
+	ErrNotGroupAdmin           = errors.New("only group admins can make this request")
+	ErrNotGroupMember          = errors.New("only group members can make this request")
+)
+
+// GroupAdmins tells whether a pubkey is an admin of a group
+type GroupAdmins interface {
+	IsAdmin(ctx context.Context, pubkey, groupID string) (bool, error)
+}
+
+// GroupMembers tells whether a pubkey is a member of a group
+type GroupMembers interface {
+	IsMember(ctx context.Context, pubkey, groupID string) (bool, error)
+}
+
+// CheckRequestEvent checks that a signed event authorizes this request the way NIP-98 does: it must
+// be an http auth event with a u tag for the url and a method tag for the method of the request,
+// so that an event signed for another endpoint can't be replayed. The scheme of the u tag is not
+// compared since tls is usually terminated before the relay.
+func CheckRequestEvent(r *http.Request, ev *nostr.Event) error {
+	if ev.Kind != nostr.KindHTTPAuth {
+		return ErrRequestEventMismatch
+	}
+
+	method := ev.Tags.Find("method")
+	if method == nil || !strings.EqualFold(method[1], r.Method) {
+		return ErrRequestEventMismatch
+	}
+
+	u := ev.Tags.Find("u")
+	if u == nil {
+		return ErrRequestEventMismatch
+	}
+
+	signed, err := url.Parse(u[1])
+	if err != nil {
+		return ErrRequestEventMismatch
+	}
+
+	if !strings.EqualFold(signed.Host, r.Host) || strings.TrimSuffix(signed.Path, "/") != strings.TrimSuffix(r.URL.Path, "/") {
+		return ErrRequestEventMismatch
+	}
+
+	return nil
+}
+
+// ParseAdminRequest reads the request event in the body, signed by an admin of a group for this
+// request within RequestMaxAge of now. A content is decoded into req unless req is nil.
+func ParseAdminRequest(r *http.Request, admins GroupAdmins, groupID string, now time.Time, req any) (*nostr.Event, error) {
+	ev, err := parseRequest(r, now)
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := admins.IsAdmin(r.Context(), ev.PubKey, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !admin {
+		return nil, ErrNotGroupAdmin
+	}
+
+	err = decodeRequestContent(ev, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return ev, nil
+}
+
+// ParseMemberRequest reads the request event in the body, signed by a member of a group for this
+// request within RequestMaxAge of now. A content is decoded into req unless req is nil.
+func ParseMemberRequest(r *http.Request, members GroupMembers, groupID string, now time.Time, req any) (*nostr.Event, error) {
+	ev, err := parseRequest(r, now)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := members.IsMember(r.Context(), ev.PubKey, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !member {
+		return nil, ErrNotGroupMember
+	}
+
+	err = decodeRequestContent(ev, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return ev, nil
+}
+
+// ParseRequest reads the request event in the body, signed for this request within RequestMaxAge
+// of now by any pubkey. A content is decoded into req unless req is nil.
+func ParseRequest(r *http.Request, now time.Time, req any) (*nostr.Event, error) {
+	ev, err := parseRequest(r, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = decodeRequestContent(ev, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return ev, nil
+}
+
+// parseRequest checks the request event in the body, the content is decoded once the signer is
+// known to be allowed
+func parseRequest(r *http.Request, now time.Time) (*nostr.Event, error) {
+	var ev nostr.Event
+	err := json.NewDecoder(r.Body).Decode(&ev)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+	defer r.Body.Close()
+
+	ok, err := ev.CheckSignature()
+	if err != nil || !ok {
+		return nil, ErrInvalidRequestSignature
+	}
+
+	// a request signed for one endpoint can't be replayed against another one
+	err = CheckRequestEvent(r, &ev)
+	if err != nil {
+		return nil, ErrInvalidRequestSignature
+	}
+
+	age := now.Sub(ev.CreatedAt.Time())
+	if age > RequestMaxAge || age < -RequestMaxAge {
+		return nil, ErrExpiredRequest
+	}
+
+	return &ev, nil
+}
+
+// decodeRequestContent decodes the content of a request event into req unless req is nil
+func decodeRequestContent(ev *nostr.Event, req any) error {
+	if req == nil || ev.Content == "" {
+		return nil
+	}
+
+	err := json.Unmarshal([]byte(ev.Content), req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+
+	return nil
+}
+
+// WriteRequestError maps the errors of ParseRequest to a status
+func WriteRequestError(w http.ResponseWriter, err error) {
+	writeRequestError(w, err)
+}
+
+// WriteAdminRequestError maps the errors of ParseAdminRequest to a status
+func WriteAdminRequestError(w http.ResponseWriter, err error) {
+	writeRequestError(w, err)
+}
+
+// WriteMemberRequestError maps the errors of ParseMemberRequest to a status
+func WriteMemberRequestError(w http.ResponseWriter, err error) {
+	writeRequestError(w, err)
+}
+
+func writeRequestError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRequest):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidRequestSignature), errors.Is(err, ErrExpiredRequest):
+		w.WriteHeader(http.StatusUnauthorized)
+	case errors.Is(err, ErrNotGroupAdmin), errors.Is(err, ErrNotGroupMember):
+		w.WriteHeader(http.StatusForbidden)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,201 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestCheckRequestEvent(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "https://relay.example.com/v1/push/nostr/abc", nil)
+
+	tests := []struct {
+		name string
+		ev   nostr.Event
+		ok   bool
+	}{
+		{"valid", nostr.Event{Kind: nostr.KindHTTPAuth, Tags: nostr.Tags{{"u", "https://relay.example.com/v1/push/nostr/abc"}, {"method", "PUT"}}}, true},
+		{"tls terminated before the relay", nostr.Event{Kind: nostr.KindHTTPAuth, Tags: nostr.Tags{{"u", "http://relay.example.com/v1/push/nostr/abc/"}, {"method", "put"}}}, true},
+		{"other kind", nostr.Event{Kind: nostr.KindTextNote, Tags: nostr.Tags{{"u", "https://relay.example.com/v1/push/nostr/abc"}, {"method", "PUT"}}}, false},
+		{"other endpoint", nostr.Event{Kind: nostr.KindHTTPAuth, Tags: nostr.Tags{{"u", "https://relay.example.com/v1/push/nostr/abc/remove"}, {"method", "PUT"}}}, false},
+		{"other host", nostr.Event{Kind: nostr.KindHTTPAuth, Tags: nostr.Tags{{"u", "https://other.example.com/v1/push/nostr/abc"}, {"method", "PUT"}}}, false},
+		{"other method", nostr.Event{Kind: nostr.KindHTTPAuth, Tags: nostr.Tags{{"u", "https://relay.example.com/v1/push/nostr/abc"}, {"method", "POST"}}}, false},
+		{"missing tags", nostr.Event{Kind: nostr.KindHTTPAuth}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckRequestEvent(r, &tc.ev)
+			if (err == nil) != tc.ok {
+				t.Fatalf("expected ok=%t, got %v", tc.ok, err)
+			}
+		})
+	}
+}
+
+type admins string
+
+func (a admins) IsAdmin(ctx context.Context, pubkey, groupID string) (bool, error) {
+	return groupID == "group" && pubkey == string(a), nil
+}
+
+func TestParseAdminRequest(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	request := func(content string, createdAt time.Time) *http.Request {
+		ev := nostr.Event{
+			Kind:      nostr.KindHTTPAuth,
+			CreatedAt: nostr.Timestamp(createdAt.Unix()),
+			Tags:      nostr.Tags{{"u", "https://relay.example.com/v1/groups/group/tokens"}, {"method", "POST"}},
+			Content:   content,
+		}
+		err := ev.Sign(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return httptest.NewRequest(http.MethodPost, "https://relay.example.com/v1/groups/group/tokens", strings.NewReader(ev.String()))
+	}
+
+	tests := []struct {
+		name   string
+		r      *http.Request
+		admins admins
+		status int
+	}{
+		{"valid", request(`{"name":"bot"}`, now), admins(pk), http.StatusOK},
+		{"not an event", httptest.NewRequest(http.MethodPost, "https://relay.example.com/v1/groups/group/tokens", strings.NewReader("[]")), admins(pk), http.StatusBadRequest},
+		{"content of the wrong type", request(`{"name":1}`, now), admins(pk), http.StatusBadRequest},
+		{"expired", request("", now.Add(-time.Hour)), admins(pk), http.StatusUnauthorized},
+		{"not an admin", request("", now), admins("other"), http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var req struct {
+				Name string `json:"name"`
+			}
+
+			_, err := ParseAdminRequest(tc.r, tc.admins, "group", now, &req)
+
+			w := httptest.NewRecorder()
+			if err != nil {
+				WriteAdminRequestError(w, err)
+			}
+
+			if w.Code != tc.status {
+				t.Fatalf("expected %d, got %d (%v)", tc.status, w.Code, err)
+			}
+		})
+	}
+}
+
+type members string
+
+func (m members) IsMember(ctx context.Context, pubkey, groupID string) (bool, error) {
+	return groupID == "group" && pubkey == string(m), nil
+}
+
+func TestParseMemberRequest(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	request := func(createdAt time.Time) *http.Request {
+		ev := nostr.Event{
+			Kind:      nostr.KindHTTPAuth,
+			CreatedAt: nostr.Timestamp(createdAt.Unix()),
+			Tags:      nostr.Tags{{"u", "https://relay.example.com/v1/groups/group/media"}, {"method", "POST"}},
+		}
+		err := ev.Sign(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return httptest.NewRequest(http.MethodPost, "https://relay.example.com/v1/groups/group/media", strings.NewReader(ev.String()))
+	}
+
+	tests := []struct {
+		name    string
+		r       *http.Request
+		members members
+		status  int
+	}{
+		{"valid", request(now), members(pk), http.StatusOK},
+		{"not an event", httptest.NewRequest(http.MethodPost, "https://relay.example.com/v1/groups/group/media", strings.NewReader("{")), members(pk), http.StatusBadRequest},
+		{"expired", request(now.Add(-time.Hour)), members(pk), http.StatusUnauthorized},
+		{"not a member", request(now), members("other"), http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ev, err := ParseMemberRequest(tc.r, tc.members, "group", now, nil)
+
+			w := httptest.NewRecorder()
+			if err != nil {
+				WriteMemberRequestError(w, err)
+			} else if ev.PubKey != pk {
+				t.Fatalf("expected the pubkey of the member, got %s", ev.PubKey)
+			}
+
+			if w.Code != tc.status {
+				t.Fatalf("expected %d, got %d (%v)", tc.status, w.Code, err)
+			}
+		})
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	now := time.Now()
+
+	ev := nostr.Event{
+		Kind:      nostr.KindHTTPAuth,
+		CreatedAt: nostr.Timestamp(now.Unix()),
+		Tags:      nostr.Tags{{"u", "https://relay.example.com/v1/privacy/purge"}, {"method", "POST"}},
+		Content:   `{"reason":"leaving"}`,
+	}
+	err := ev.Sign(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "https://relay.example.com/v1/privacy/purge", strings.NewReader(ev.String()))
+	parsed, err := ParseRequest(r, now, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.PubKey != ev.PubKey || req.Reason != "leaving" {
+		t.Fatalf("expected the request of %s, got %s with %+v", ev.PubKey, parsed.PubKey, req)
+	}
+
+	// an event signed for another endpoint is not accepted
+	r = httptest.NewRequest(http.MethodPost, "https://relay.example.com/v1/privacy/erase", strings.NewReader(ev.String()))
+	_, err = ParseRequest(r, now, &req)
+
+	w := httptest.NewRecorder()
+	WriteRequestError(w, err)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d (%v)", http.StatusUnauthorized, w.Code, err)
+	}
+}
@@ -23,9 +23,19 @@ type AddressResponse struct {
 }
 
 type Pagination struct {
-	Limit  int `json:"limit"`
-	Offset int `json:"offset"`
-	Total  int `json:"total"`
+	Limit   int  `json:"limit"`
+	Offset  int  `json:"offset"`
+	Total   int  `json:"total"`
+	HasMore bool `json:"has_more"` // false on the last page
+}
+
+// CursorPagination describes a page of a list that is paginated with cursors, Next is empty on
+// the last page
+type CursorPagination struct {
+	Limit   int    `json:"limit"`
+	Total   int    `json:"total"`
+	Next    string `json:"next,omitempty"`
+	HasMore bool   `json:"has_more"`
 }
 
 // Response is the default response object
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var ErrInvalidSignatureLength = errors.New("invalid signature length")
+
+// RecoverPersonalSign returns the address that signed a hash with personal_sign, whose v is 27 or
+// 28 where go-ethereum expects 0 or 1. The signature is left untouched.
+func RecoverPersonalSign(hash, signature []byte) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, ErrInvalidSignatureLength
+	}
+
+	sig := make([]byte, len(signature))
+	copy(sig, signature)
+
+	// undo the 27/28 addition of personal_sign
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	pubkey, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
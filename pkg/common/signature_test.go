@@ -0,0 +1,48 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestRecoverPersonalSign(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	hash := accounts.TextHash([]byte("hello"))
+
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wallets add 27 to v, go-ethereum signs with 0 or 1
+	personal := bytes.Clone(sig)
+	personal[crypto.RecoveryIDOffset] += 27
+
+	for name, s := range map[string][]byte{"personal_sign": personal, "raw": sig} {
+		signer, err := RecoverPersonalSign(hash, s)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if signer != addr {
+			t.Errorf("%s: expected %s, got %s", name, addr.Hex(), signer.Hex())
+		}
+	}
+
+	if personal[crypto.RecoveryIDOffset] < 27 {
+		t.Error("expected the signature to be left untouched")
+	}
+
+	_, err = RecoverPersonalSign(hash, sig[:64])
+	if err != ErrInvalidSignatureLength {
+		t.Errorf("expected %v, got %v", ErrInvalidSignatureLength, err)
+	}
+}
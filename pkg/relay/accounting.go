@@ -0,0 +1,43 @@
+package relay
+
+import (
+	"math/big"
+	"time"
+)
+
+// SponsorSpend is the share of a bundle transaction fee paid by a sponsor for a user operation
+type SponsorSpend struct {
+	TxHash      string    `json:"tx_hash"`
+	UserOpHash  string    `json:"userop_hash"`
+	Paymaster   string    `json:"paymaster"`
+	Sponsor     string    `json:"sponsor"`
+	Sender      string    `json:"sender"`
+	Destination string    `json:"destination"`
+	GasUsed     uint64    `json:"gas_used"`
+	FeeWei      *big.Int  `json:"fee_wei"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AccountingLine is the spend of a paymaster for a destination contract and calling account
+type AccountingLine struct {
+	Destination string   `json:"destination"`
+	Sender      string   `json:"sender"`
+	Ops         int64    `json:"ops"`
+	GasUsed     *big.Int `json:"gas_used"`
+	FeeWei      *big.Int `json:"fee_wei"`
+	FeeFiat     string   `json:"fee_fiat"`
+}
+
+// AccountingReport is the monthly spend of a paymaster
+type AccountingReport struct {
+	ChainID   string            `json:"chain_id"`
+	Paymaster string            `json:"paymaster"`
+	Month     string            `json:"month"`
+	Currency  string            `json:"currency"`
+	Price     string            `json:"price"`
+	Ops       int64             `json:"ops"`
+	GasUsed   *big.Int          `json:"gas_used"`
+	FeeWei    *big.Int          `json:"fee_wei"`
+	FeeFiat   string            `json:"fee_fiat"`
+	Lines     []*AccountingLine `json:"lines"`
+}
@@ -0,0 +1,28 @@
+package relay
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// types of the entries of an activity feed
+const (
+	ActivityTransfer  = "transfer"
+	ActivityUserOp    = "userop"
+	ActivityGroupJoin = "group_join"
+	ActivityProfile   = "profile"
+)
+
+// ActivityTypes are the types of entries of an activity feed, in the order they are documented
+var ActivityTypes = []string{ActivityTransfer, ActivityUserOp, ActivityGroupJoin, ActivityProfile}
+
+// Activity is an entry of the activity feed of an account, only the field of its type is set
+type Activity struct {
+	Type      string          `json:"type"`
+	ID        string          `json:"id"` // of the nostr event
+	CreatedAt time.Time       `json:"created_at"`
+	Transfer  *LegacyLog      `json:"transfer,omitempty"`
+	UserOp    *UserOpState    `json:"userop,omitempty"`
+	Group     string          `json:"group,omitempty"`
+	Profile   json.RawMessage `json:"profile,omitempty"`
+}
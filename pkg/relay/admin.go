@@ -0,0 +1,19 @@
+package relay
+
+import "time"
+
+// AdminChallenge is the nonce an operator signs to log in to the admin endpoints, sign-in with
+// Ethereum messages have to be for its domain and chain
+type AdminChallenge struct {
+	Nonce     string    `json:"nonce"`
+	Domain    string    `json:"domain"`
+	ChainID   string    `json:"chain_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AdminSession is a session of an operator, the token is sent as a bearer token
+type AdminSession struct {
+	Token     string    `json:"token"`
+	Subject   string    `json:"subject"` // the address or pubkey that logged in
+	ExpiresAt time.Time `json:"expires_at"`
+}
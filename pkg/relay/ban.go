@@ -0,0 +1,37 @@
+package relay
+
+import "time"
+
+// what a ban applies to
+const (
+	BanKindBlob  = "blob"  // the sha256 of a blob
+	BanKindEvent = "event" // the id of an event
+)
+
+// where a ban comes from
+const (
+	BanSourceOperator = "operator" // added by an operator of the relay
+	BanSourceSync     = "sync"     // synced from the shared denylist, replaced on every sync
+)
+
+// Ban keeps a blob or an event off the relay, across all groups
+type Ban struct {
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	Reason    string    `json:"reason,omitempty"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BanRequest bans a blob or an event
+type BanRequest struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Denylist is the shared list of banned content a relay can sync from
+type Denylist struct {
+	Blobs  []string `json:"blobs"`  // sha256 hashes
+	Events []string `json:"events"` // event ids
+}
@@ -0,0 +1,14 @@
+package relay
+
+// where the name of a contact comes from
+const (
+	ContactSourceAlias   = "alias"   // the address book of the requester
+	ContactSourceProfile = "profile" // the profile of a group member linked to the address
+)
+
+// Contact is the display name of an address within a group
+type Contact struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+}
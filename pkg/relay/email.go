@@ -0,0 +1,19 @@
+package relay
+
+import "time"
+
+// EmailSender maps an email address allowed to post into a group to the member it posts for
+type EmailSender struct {
+	GroupID   string    `json:"group_id"`
+	Email     string    `json:"email"`
+	Pubkey    string    `json:"pubkey"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EmailSenderRequest is the content of the signed request of a group admin managing email senders,
+// the pubkey is only needed to add a sender
+type EmailSenderRequest struct {
+	Email  string `json:"email"`
+	Pubkey string `json:"pubkey,omitempty"`
+}
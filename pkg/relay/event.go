@@ -17,6 +17,8 @@ type Event struct {
 	Alias          string    `json:"alias"`
 	EventSignature string    `json:"event_signature"`
 	Name           string    `json:"name"`
+	GroupID        string    `json:"group_id,omitempty"`
+	ABI            string    `json:"abi,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
@@ -115,6 +117,15 @@ func (e *Event) ParseEventSignature() (string, []string, []ArgType) {
 	return eventName, argNames, argTypes
 }
 
+// GetTopic0 returns the topic0 to filter logs by, events with an ABI use their registered topic
+func (e *Event) GetTopic0() common.Hash {
+	if e.HasABI() {
+		return common.HexToHash(e.Topic)
+	}
+
+	return e.GetTopic0FromEventSignature()
+}
+
 func (e *Event) GetTopic0FromEventSignature() common.Hash {
 	name, _, argTypes := e.ParseEventSignature()
 	if name == "" || len(argTypes) == 0 {
@@ -168,6 +179,9 @@ func (e *Event) ConstructABIFromEventSignature() (string, error) {
 // returned by ParseEventSignature, plus the "topic" field, no more and no less.
 func (e *Event) IsValidData(data map[string]any) bool {
 	_, argNames, _ := e.ParseEventSignature()
+	if e.HasABI() {
+		argNames = e.argNamesFromABI()
+	}
 
 	// Check if the number of keys in data matches the number of argument names plus one (for "topic")
 	if len(data) != len(argNames)+1 {
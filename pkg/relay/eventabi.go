@@ -0,0 +1,238 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// EventsFromABI returns an event for every non-anonymous event in a contract ABI,
+// each event keeps its own ABI fragment so that complex parameters can be decoded
+func EventsFromABI(chainID, contract, rawABI string) ([]*Event, error) {
+	var fragments []json.RawMessage
+	err := json.Unmarshal([]byte(rawABI), &fragments)
+	if err != nil {
+		return nil, fmt.Errorf("invalid abi: %w", err)
+	}
+
+	events := []*Event{}
+	for _, f := range fragments {
+		var entry struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(f, &entry) != nil || entry.Type != "event" {
+			continue
+		}
+
+		ev := &Event{
+			ChainID:  chainID,
+			Contract: contract,
+			ABI:      string(f),
+		}
+
+		parsed, err := ev.parseABI()
+		if err != nil {
+			return nil, err
+		}
+
+		if parsed.Anonymous {
+			continue
+		}
+
+		ev.Topic = parsed.ID.Hex()
+		ev.EventSignature = signatureFromABI(*parsed)
+		ev.Name = parsed.RawName
+
+		events = append(events, ev)
+	}
+
+	if len(events) == 0 {
+		return nil, fmt.Errorf("abi contains no events")
+	}
+
+	return events, nil
+}
+
+// signatureFromABI returns the human readable signature of an ABI event
+func signatureFromABI(ev abi.Event) string {
+	args := make([]string, len(ev.Inputs))
+	for i, input := range ev.Inputs {
+		arg := input.Type.String()
+		if input.Indexed {
+			arg += " indexed"
+		}
+		if input.Name != "" {
+			arg += " " + input.Name
+		}
+
+		args[i] = arg
+	}
+
+	return fmt.Sprintf("%s(%s)", ev.RawName, strings.Join(args, ", "))
+}
+
+// HasABI returns true if the event is decoded using an uploaded ABI instead of its signature
+func (e *Event) HasABI() bool {
+	return e.ABI != ""
+}
+
+// parseABI parses the ABI fragment of the event
+func (e *Event) parseABI() (*abi.Event, error) {
+	parsed, err := abi.JSON(strings.NewReader("[" + e.ABI + "]"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse event abi: %w", err)
+	}
+
+	for _, ev := range parsed.Events {
+		return &ev, nil
+	}
+
+	return nil, fmt.Errorf("event abi contains no event")
+}
+
+// argNamesFromABI returns the names of the arguments, unnamed arguments are named by position
+func (e *Event) argNamesFromABI() []string {
+	ev, err := e.parseABI()
+	if err != nil {
+		return []string{}
+	}
+
+	names := make([]string, len(ev.Inputs))
+	for i, input := range ev.Inputs {
+		names[i] = argName(input, i)
+	}
+
+	return names
+}
+
+func argName(input abi.Argument, i int) string {
+	if input.Name == "" {
+		return fmt.Sprintf("%d", i)
+	}
+
+	return input.Name
+}
+
+// parseTopicsFromABI decodes a log using the ABI fragment of the event
+func parseTopicsFromABI(event *Event, topicHashes []common.Hash, data []byte) (Topics, error) {
+	ev, err := event.parseABI()
+	if err != nil {
+		return nil, err
+	}
+
+	topics := Topics{
+		{
+			Name:  "topic",
+			Type:  "bytes32",
+			Value: topicHashes[0],
+		},
+	}
+
+	// unnamed arguments can't be unpacked into a map, name them by position
+	nonIndexed := abi.Arguments{}
+	for i, input := range ev.Inputs {
+		if !input.Indexed {
+			input.Name = argName(input, i)
+			nonIndexed = append(nonIndexed, input)
+		}
+	}
+
+	unpacked := map[string]any{}
+	err = nonIndexed.UnpackIntoMap(unpacked, data)
+	if err != nil {
+		return nil, err
+	}
+
+	indexedTopicIndex := 1
+	for i, input := range ev.Inputs {
+		t := Topic{
+			Name: argName(input, i),
+			Type: input.Type.String(),
+		}
+
+		if !input.Indexed {
+			t.Value = unpacked[t.Name]
+			topics = append(topics, t)
+			continue
+		}
+
+		if indexedTopicIndex >= len(topicHashes) {
+			return nil, fmt.Errorf("missing topic for indexed argument %s", t.Name)
+		}
+
+		hash := topicHashes[indexedTopicIndex]
+		indexedTopicIndex++
+
+		switch input.Type.T {
+		case abi.TupleTy, abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy:
+			// dynamic indexed values are stored as the hash of their content
+			t.Value = hash
+		default:
+			m := map[string]any{}
+			input.Name = t.Name
+			err = abi.ParseTopicsIntoMap(m, abi.Arguments{input}, []common.Hash{hash})
+			if err != nil {
+				return nil, err
+			}
+
+			t.Value = m[t.Name]
+		}
+
+		topics = append(topics, t)
+	}
+
+	return topics, nil
+}
+
+// normalizeABIValue converts decoded ABI values (tuples, arrays, fixed bytes) into json friendly values
+func normalizeABIValue(v any) any {
+	switch v := v.(type) {
+	case nil, bool, string:
+		return v
+	case *big.Int:
+		return v.String()
+	case []byte:
+		return "0x" + common.Bytes2Hex(v)
+	case common.Address:
+		return v.Hex()
+	case common.Hash:
+		return v.Hex()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array:
+		// fixed size byte arrays (bytesN)
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return "0x" + common.Bytes2Hex(b)
+		}
+		fallthrough
+	case reflect.Slice:
+		values := make([]any, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			values[i] = normalizeABIValue(rv.Index(i).Interface())
+		}
+		return values
+	case reflect.Struct:
+		// tuples are decoded into structs tagged with the abi component names
+		values := map[string]any{}
+		for i := 0; i < rv.NumField(); i++ {
+			field := rv.Type().Field(i)
+			name := field.Tag.Get("json")
+			if name == "" {
+				name = field.Name
+			}
+			values[name] = normalizeABIValue(rv.Field(i).Interface())
+		}
+		return values
+	}
+
+	return v
+}
@@ -0,0 +1,110 @@
+package relay
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+const testOrderABI = `[
+  {"type":"function","name":"order","inputs":[],"outputs":[],"stateMutability":"nonpayable"},
+  {"type":"event","name":"Order","anonymous":false,"inputs":[
+    {"name":"maker","type":"address","indexed":true},
+    {"name":"items","type":"tuple[]","indexed":false,"components":[
+      {"name":"amount","type":"uint256"},
+      {"name":"token","type":"address"}
+    ]},
+    {"name":"note","type":"string","indexed":false}
+  ]},
+  {"type":"event","name":"Hidden","anonymous":true,"inputs":[]}
+]`
+
+func TestEventsFromABI(t *testing.T) {
+	evs, err := EventsFromABI("100", "0x5815E61eF72c9E6107b5c5A05FD121F334f7a7f1", testOrderABI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// functions and anonymous events are skipped
+	assert.Equal(t, 1, len(evs))
+
+	parsed, err := abi.JSON(strings.NewReader(testOrderABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := evs[0]
+	assert.Equal(t, "Order", ev.Name)
+	assert.Equal(t, parsed.Events["Order"].ID.Hex(), ev.Topic)
+	assert.Equal(t, "Order(address indexed maker, (uint256,address)[] items, string note)", ev.EventSignature)
+	assert.True(t, ev.HasABI())
+	assert.Equal(t, parsed.Events["Order"].ID, ev.GetTopic0())
+
+	_, err = EventsFromABI("100", "0x5815E61eF72c9E6107b5c5A05FD121F334f7a7f1", `[{"type":"function","name":"order","inputs":[]}]`)
+	assert.Error(t, err)
+}
+
+func TestParseTopicsFromABI(t *testing.T) {
+	evs, err := EventsFromABI("100", "0x5815E61eF72c9E6107b5c5A05FD121F334f7a7f1", testOrderABI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := evs[0]
+
+	parsed, err := abi.JSON(strings.NewReader(testOrderABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type item struct {
+		Amount *big.Int
+		Token  common.Address
+	}
+
+	token := common.HexToAddress("0x5815E61eF72c9E6107b5c5A05FD121F334f7a7f1")
+
+	data, err := parsed.Events["Order"].Inputs.NonIndexed().Pack([]item{{Amount: big.NewInt(100000), Token: token}}, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topicHashes := []common.Hash{
+		parsed.Events["Order"].ID,
+		common.HexToHash("0x000000000000000000000000a1e4380a3b1f749673e270229993ee55f35663b4"),
+	}
+
+	topics, err := ParseTopicsFromHashes(ev, topicHashes, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 4, len(topics))
+	assert.Equal(t, "maker", topics[1].Name)
+	assert.Equal(t, common.HexToAddress("0xa1e4380a3b1f749673e270229993ee55f35663b4"), topics[1].Value)
+	assert.Equal(t, "note", topics[3].Name)
+	assert.Equal(t, "hello", topics[3].Value)
+
+	b, err := topics.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]any
+	err = json.Unmarshal(b, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []any{map[string]any{"amount": "100000", "token": token.Hex()}}, decoded["items"])
+	assert.True(t, ev.IsValidData(decoded))
+
+	// missing indexed topics are reported instead of panicking
+	_, err = ParseTopicsFromHashes(ev, topicHashes[:1], data)
+	assert.Error(t, err)
+}
@@ -40,7 +40,9 @@ type EVMRequester interface {
 	CallContract(call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
 	ListenForLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) error
 
-	WaitForTx(tx *types.Transaction, timeout int) error
+	WaitForTx(tx *types.Transaction, timeout int) (*types.Receipt, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	TransactionSender(ctx context.Context, txHash, blockHash common.Hash, index uint) (common.Address, error)
 
 	Close()
 }
@@ -0,0 +1,34 @@
+package relay
+
+import "time"
+
+// AccountFactory is a factory that accounts can be deployed from, deployments are
+// sponsored by its paymaster
+type AccountFactory struct {
+	Contract   string    `json:"contract"`
+	Paymaster  string    `json:"paymaster"`
+	EntryPoint string    `json:"entrypoint"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// AccountDeployment is the state of the deployment of an account
+type AccountDeployment struct {
+	Address    string  `json:"address"`
+	Owner      string  `json:"owner"`
+	Factory    string  `json:"factory"`
+	Status     string  `json:"status"`
+	UserOp     *UserOp `json:"user_op,omitempty"`
+	UserOpHash string  `json:"user_op_hash,omitempty"`
+	EntryPoint string  `json:"entrypoint,omitempty"`
+	Paymaster  string  `json:"paymaster,omitempty"`
+}
+
+const (
+	// the account contract exists
+	AccountStatusDeployed = "deployed"
+	// a deployment user op was submitted and is being processed
+	AccountStatusPending = "pending"
+	// a sponsored deployment user op is returned, it must be signed by the owner and sent
+	AccountStatusUndeployed = "undeployed"
+)
@@ -0,0 +1,43 @@
+package relay
+
+import "time"
+
+// Group is the state of a group projected from its moderation events
+type Group struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	About     string    `json:"about"`
+	Picture   string    `json:"picture"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GroupMember is the role of a pubkey in a group projected from its moderation events
+type GroupMember struct {
+	GroupID   string    `json:"group_id"`
+	Pubkey    string    `json:"pubkey"`
+	Role      string    `json:"role"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GroupChange is what a moderation event changes in the state of a group, it is applied at once
+type GroupChange struct {
+	GroupID  string
+	Created  bool   // Metadata is of a new group
+	Metadata *Group // created or edited
+	Put      []*GroupMember
+	Removed  []string // pubkeys
+	Deleted  bool
+	At       time.Time // of the event, older changes never override newer ones
+}
+
+// GroupProfile is the public-facing identity of a group, published as the kind 0 of a key the
+// relay derives for the group
+type GroupProfile struct {
+	Pubkey      string `json:"pubkey,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Contact     string `json:"contact,omitempty"`
+}
@@ -0,0 +1,50 @@
+package relay
+
+import "time"
+
+// GroupTokenScope is what a group token allows its holder to do
+type GroupTokenScope string
+
+const (
+	GroupTokenScopePost      GroupTokenScope = "post"      // publish content into the group as the bot pubkey
+	GroupTokenScopeAnalytics GroupTokenScope = "analytics" // read the group analytics
+	GroupTokenScopeMedia     GroupTokenScope = "media"     // upload media to the group as the bot pubkey
+)
+
+// IsValid returns true if the scope is known
+func (s GroupTokenScope) IsValid() bool {
+	return s == GroupTokenScopePost || s == GroupTokenScopeAnalytics || s == GroupTokenScopeMedia
+}
+
+// NeedsPubkey returns true if the scope acts as a bot pubkey, which then has to be given when minting
+func (s GroupTokenScope) NeedsPubkey() bool {
+	return s == GroupTokenScopePost || s == GroupTokenScopeMedia
+}
+
+// GroupToken is a token minted by a group admin for a bot or an integration, the secret is only
+// returned when it is minted
+type GroupToken struct {
+	ID        string          `json:"id"`
+	GroupID   string          `json:"group_id"`
+	Scope     GroupTokenScope `json:"scope"`
+	Pubkey    string          `json:"pubkey,omitempty"`
+	Name      string          `json:"name"`
+	CreatedBy string          `json:"created_by"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	RevokedAt *time.Time      `json:"revoked_at,omitempty"`
+	Secret    string          `json:"secret,omitempty"`
+}
+
+// Active returns true if the token was not revoked and has not expired at the given time
+func (t *GroupToken) Active(at time.Time) bool {
+	return t.RevokedAt == nil && at.Before(t.ExpiresAt)
+}
+
+// GroupTokenRequest is the content of a signed nostr event used by a group admin to mint a token
+type GroupTokenRequest struct {
+	Scope     GroupTokenScope `json:"scope"`
+	Pubkey    string          `json:"pubkey,omitempty"`
+	Name      string          `json:"name"`
+	ExpiresAt int64           `json:"expires_at,omitempty"` // unix seconds, defaults to 30 days from now
+}
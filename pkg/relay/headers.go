@@ -11,17 +11,25 @@ const (
 	AddressHeader = "X-Address"
 	// AppVersionHeader is the header that contains the app version of the sender
 	AppVersionHeader = "X-App-Version"
+	// APIKeyHeader is the header that contains the api key for operator endpoints
+	APIKeyHeader = "X-API-Key"
+	// GroupTokenHeader is the header that contains a token minted by a group admin
+	GroupTokenHeader = "X-Group-Token"
 )
 
 type ContextKey string
 
 const (
-	ContextKeyAddress   ContextKey = AddressHeader
-	ContextKeySignature ContextKey = SignatureHeader
+	ContextKeySignature  ContextKey = SignatureHeader
+	ContextKeyGroupToken ContextKey = GroupTokenHeader
 )
 
-// get address from context if exists
+// get address from context if exists, the account a request was signed for
 func GetAddressFromContext(ctx context.Context) (string, bool) {
-	addr, ok := ctx.Value(ContextKeyAddress).(string)
-	return addr, ok
+	p, ok := GetPrincipal(ctx)
+	if !ok || !p.Has(ScopeAccount) {
+		return "", false
+	}
+
+	return p.Address, true
 }
@@ -0,0 +1,14 @@
+package relay
+
+// LogIngestRequest is a batch of decoded logs pushed by an external indexer, the hashes of the
+// logs are computed by the relay
+type LogIngestRequest struct {
+	GroupID string `json:"group_id,omitempty"` // scopes the logs to a group, like event registrations do
+	Logs    []*Log `json:"logs"`
+}
+
+// LogIngestResult tells which logs of a batch were stored, in the order of the batch
+type LogIngestResult struct {
+	Created    []string `json:"created"`
+	Duplicates []string `json:"duplicates"` // already stored, by an earlier push or the indexer
+}
@@ -0,0 +1,12 @@
+package relay
+
+import "time"
+
+// AccountLink maps a nostr pubkey to the smart account of its owner, the owner signed the link
+type AccountLink struct {
+	Pubkey    string    `json:"pubkey"`
+	Account   string    `json:"account"`
+	Owner     string    `json:"owner"`
+	Signature string    `json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+}
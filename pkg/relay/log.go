@@ -0,0 +1,98 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Log is the canonical model of an indexed log, it is the content of tx transfer and tx log
+// events. LegacyLog is derived from it for the v1 routes and should not be built by hand.
+type Log = nostreth.Log
+
+// ParseLog reads the log from the content of a tx transfer or tx log event, both kinds store
+// it under log_data
+func ParseLog(content string) (*Log, error) {
+	var c struct {
+		LogData Log `json:"log_data"`
+	}
+
+	err := json.Unmarshal([]byte(content), &c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tx event content: %w", err)
+	}
+
+	return &c.LogData, nil
+}
+
+// NewLogEvent creates the unsigned event of a log, erc20 transfers get their own kind
+func NewLogEvent(l *Log) (*nostr.Event, error) {
+	var ev *nostr.Event
+	var err error
+	switch l.Topic {
+	case nostreth.TopicERC20Transfer:
+		ev, err = nostreth.CreateTxTransferEvent(*l)
+	default:
+		ev, err = nostreth.CreateTxLogEvent(*l)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ev == nil {
+		return nil, errors.New("something went wrong parsing an event from a log")
+	}
+
+	return ev, nil
+}
+
+// NewLegacyLog converts a log to the shape v1 clients expect, logs are only stored once they
+// are mined so they are always successful
+func NewLegacyLog(l *Log, extraData *json.RawMessage) *LegacyLog {
+	return &LegacyLog{
+		Hash:      l.Hash,
+		TxHash:    l.TxHash,
+		CreatedAt: l.CreatedAt,
+		UpdatedAt: l.UpdatedAt,
+		Nonce:     l.Nonce,
+		Sender:    l.Sender,
+		To:        l.To,
+		Value:     l.Value,
+		Data:      l.Data,
+		ExtraData: extraData,
+		Status:    LegacyLogStatusSuccess,
+	}
+}
+
+// Log converts a v1 log back to the canonical model, the chain id and topic are not part of
+// v1 logs. The hash is kept as is and has to be regenerated if the log is stored.
+func (t *LegacyLog) Log(chainID, topic string) *Log {
+	return &Log{
+		Hash:      t.Hash,
+		TxHash:    t.TxHash,
+		ChainID:   chainID,
+		Topic:     topic,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+		Nonce:     t.Nonce,
+		Sender:    t.Sender,
+		To:        t.To,
+		Value:     t.Value,
+		Data:      t.Data,
+	}
+}
+
+// NewExtraData encodes the message of a log as v1 extra data
+func NewExtraData(description string) (*json.RawMessage, error) {
+	b, err := json.Marshal(&ExtraData{Description: description})
+	if err != nil {
+		return nil, err
+	}
+
+	raw := json.RawMessage(b)
+
+	return &raw, nil
+}
@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+)
+
+func testLog(topic string) *Log {
+	data := json.RawMessage(`{"from":"0x1","to":"0x2","value":"10"}`)
+
+	l := &Log{
+		TxHash:    "0x01",
+		ChainID:   "100",
+		Topic:     topic,
+		CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Sender:    "0xsender",
+		To:        "0xtoken",
+		Value:     big.NewInt(0),
+		Data:      &data,
+	}
+	l.Hash = l.GenerateUniqueHash()
+
+	return l
+}
+
+func TestNewLogEvent(t *testing.T) {
+	tests := []struct {
+		topic string
+		kind  int
+	}{
+		{nostreth.TopicERC20Transfer, nostreth.KindTxTransfer},
+		{"0xother", nostreth.KindTxLog},
+	}
+
+	for _, tt := range tests {
+		l := testLog(tt.topic)
+
+		ev, err := NewLogEvent(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ev.Kind != tt.kind {
+			t.Errorf("%s: expected kind %d, got %d", tt.topic, tt.kind, ev.Kind)
+		}
+
+		parsed, err := ParseLog(ev.Content)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if parsed.Hash != l.Hash || parsed.TxHash != l.TxHash || parsed.Topic != l.Topic {
+			t.Errorf("%s: expected %+v, got %+v", tt.topic, l, parsed)
+		}
+	}
+}
+
+func TestParseLogInvalid(t *testing.T) {
+	_, err := ParseLog("not json")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestLegacyLogConversion(t *testing.T) {
+	l := testLog(nostreth.TopicERC20Transfer)
+
+	extra, err := NewExtraData("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ll := NewLegacyLog(l, extra)
+
+	if ll.Status != LegacyLogStatusSuccess || string(*ll.ExtraData) != `{"description":"hello"}` {
+		t.Fatalf("unexpected legacy log %+v", ll)
+	}
+
+	back := ll.Log(l.ChainID, l.Topic)
+	if back.GenerateUniqueHash() != l.Hash {
+		t.Fatal("expected the round trip to keep the log hash")
+	}
+
+	if back.TxHash != l.TxHash || back.Sender != l.Sender || back.To != l.To || !back.CreatedAt.Equal(l.CreatedAt) {
+		t.Fatalf("expected %+v, got %+v", l, back)
+	}
+}
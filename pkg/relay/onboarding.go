@@ -0,0 +1,31 @@
+package relay
+
+import "github.com/nbd-wtf/go-nostr"
+
+const (
+	// the pubkey is a member of the group, either it was already or its invite code was valid
+	MembershipMember = "member"
+	// the join request is waiting for an admin of the group
+	MembershipPending = "pending"
+)
+
+// OnboardingRequest is the content of the request event of a pubkey being onboarded. The owner
+// signs the link of the pubkey to its account, the join request and profile are signed by the pubkey.
+type OnboardingRequest struct {
+	Owner     string       `json:"owner"`
+	Factory   string       `json:"factory"`
+	Salt      int64        `json:"salt"`
+	Signature string       `json:"signature"`
+	Join      *nostr.Event `json:"join,omitempty"`
+	Profile   *nostr.Event `json:"profile,omitempty"`
+}
+
+// Onboarding is the state of every step of an onboarding
+type Onboarding struct {
+	Pubkey     string             `json:"pubkey"`
+	Account    *AccountDeployment `json:"account"`
+	Link       *AccountLink       `json:"link"`
+	Group      string             `json:"group,omitempty"`
+	Membership string             `json:"membership,omitempty"`
+	Profile    string             `json:"profile,omitempty"` // id of the profile event
+}
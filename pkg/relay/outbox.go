@@ -0,0 +1,17 @@
+package relay
+
+import (
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// OutboxEvent is an event the relay signed but failed to store, it is retried until it is stored
+type OutboxEvent struct {
+	Event         *nostr.Event `json:"event"`
+	Replace       bool         `json:"replace"` // replaces older versions instead of being added
+	Attempts      int          `json:"attempts"`
+	LastError     string       `json:"last_error"`
+	NextAttemptAt time.Time    `json:"next_attempt_at"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
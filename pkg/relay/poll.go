@@ -0,0 +1,14 @@
+package relay
+
+import "time"
+
+// PollVote is the vote of a member on a group poll, counted once per member and once per account
+// for polls gated by a token balance
+type PollVote struct {
+	PollID    string    `json:"poll_id"`
+	Pubkey    string    `json:"pubkey"`
+	Account   string    `json:"account,omitempty"`
+	Options   []string  `json:"options"`
+	EventID   string    `json:"event_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
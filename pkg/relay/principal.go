@@ -0,0 +1,45 @@
+package relay
+
+import (
+	"context"
+	"slices"
+)
+
+// Scope is what the principal of a request was authenticated for
+type Scope string
+
+const (
+	ScopeAccount  Scope = "account"  // acts for Address, signed by its key or by a linked pubkey
+	ScopeOperator Scope = "operator" // runs the relay, with the api key or an admin session
+	ScopeIngest   Scope = "ingest"   // pushes logs, with the key of trusted indexers
+)
+
+// GroupScope is the scope of a group token
+func GroupScope(s GroupTokenScope) Scope {
+	return Scope("group:" + string(s))
+}
+
+// Principal is who a request was made by, fields that the credentials don't tell are empty
+type Principal struct {
+	Address string  `json:"address,omitempty"` // ethereum account
+	Pubkey  string  `json:"pubkey,omitempty"`  // nostr pubkey
+	Scopes  []Scope `json:"scopes"`
+}
+
+// Has checks if the principal was authenticated for a scope
+func (p *Principal) Has(s Scope) bool {
+	return slices.Contains(p.Scopes, s)
+}
+
+const contextKeyPrincipal ContextKey = "principal"
+
+// WithPrincipal returns a context for the requests made by a principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKeyPrincipal, p)
+}
+
+// GetPrincipal returns the principal of a request if it was authenticated
+func GetPrincipal(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKeyPrincipal).(*Principal)
+	return p, ok && p != nil
+}
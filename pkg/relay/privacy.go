@@ -0,0 +1,68 @@
+package relay
+
+import "time"
+
+type ErasureStatus string
+
+const (
+	// everything that could be erased was erased
+	ErasureStatusCompleted ErasureStatus = "completed"
+	// nothing was erased, the reason says what the pubkey needs to do first
+	ErasureStatusBlocked ErasureStatus = "blocked"
+)
+
+// ErasureRequest is a request of a pubkey to erase what the relay stores about it, and its outcome
+type ErasureRequest struct {
+	ID          int64         `json:"id"`
+	Pubkey      string        `json:"pubkey"`
+	Status      ErasureStatus `json:"status"`
+	Reason      string        `json:"reason,omitempty"`
+	Events      int           `json:"events"` // events deleted
+	Groups      []string      `json:"groups"` // groups the pubkey was removed from
+	RequestedAt time.Time     `json:"requested_at"`
+}
+
+type PurgeStatus string
+
+const (
+	// requested by the pubkey, waiting for an admin
+	PurgeStatusPending PurgeStatus = "pending"
+	// declined by an admin, nothing was purged
+	PurgeStatusRejected PurgeStatus = "rejected"
+	// approved and being run, it can't be decided on again until it ends
+	PurgeStatusRunning PurgeStatus = "running"
+	// approved and run to the end
+	PurgeStatusCompleted PurgeStatus = "completed"
+	// approved but stopped by an error, it can be approved again
+	PurgeStatusFailed PurgeStatus = "failed"
+)
+
+// Purge is a request of a pubkey to be forgotten, run once an admin approves it
+type Purge struct {
+	ID          int64       `json:"id"`
+	Pubkey      string      `json:"pubkey"`
+	Status      PurgeStatus `json:"status"`
+	Reason      string      `json:"reason,omitempty"` // given by the pubkey
+	RequestedAt time.Time   `json:"requested_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+
+	Audit []*PurgeAuditEntry `json:"audit,omitempty"`
+}
+
+// PurgeAuditEntry records a decision on a purge or a step of it
+type PurgeAuditEntry struct {
+	Action    string    `json:"action"`
+	Count     int       `json:"count"`            // what the step changed, events, blobs or tokens
+	Detail    string    `json:"detail,omitempty"` // admin note or error
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PurgeRequest is the content of the signed request of a pubkey asking to be purged
+type PurgeRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// PurgeDecision is the body of the admin request approving or rejecting a purge
+type PurgeDecision struct {
+	Note string `json:"note,omitempty"`
+}
@@ -3,8 +3,7 @@ package relay
 import (
 	"encoding/json"
 	"fmt"
-
-	nostreth "github.com/comunifi/nostr-eth"
+	"strconv"
 )
 
 type PushToken struct {
@@ -12,6 +11,13 @@ type PushToken struct {
 	Account string
 }
 
+// PushTokenRegistration is the body used to register a push token for an account, optionally
+// with the locale its messages are sent in
+type PushTokenRegistration struct {
+	PushToken
+	Locale string `json:"locale,omitempty"`
+}
+
 type PushMessage struct {
 	Tokens []*PushToken
 	Title  string
@@ -34,10 +40,8 @@ const PushMessageSendingAnonymousBody = "Receiving %s %s..."
 const PushMessageAnonymousDescriptionTitle = "%s %s (%s) received"
 const PushMessageAnonymousDescriptionBody = "%s"
 const PushMessageAnonymousTitle = "%s"
-const PushMessageAnonymousBody = "%s %s received"
 
 const PushMessageTitle = "%s - %s"
-const PushMessageBody = "%s %s received from %s"
 
 // func parseDescriptionFromData(data *json.RawMessage) *string {
 // 	var desc PushDescription
@@ -49,7 +53,7 @@ const PushMessageBody = "%s %s received from %s"
 // 	return &desc.Description
 // }
 
-func NewAnonymousPushMessage(token []*PushToken, community, amount, symbol string, tx *nostreth.Log) *PushMessage {
+func NewAnonymousPushMessage(token []*PushToken, locale, community, amount, symbol string, tx *Log) *PushMessage {
 	mtx, err := json.Marshal(tx)
 	if err != nil {
 		mtx = nil
@@ -58,7 +62,7 @@ func NewAnonymousPushMessage(token []*PushToken, community, amount, symbol strin
 	silent := false
 
 	title := fmt.Sprintf(PushMessageAnonymousTitle, community)
-	description := fmt.Sprintf(PushMessageAnonymousBody, amount, symbol)
+	description := LocalizePush(locale, PushMessageReceived, map[string]string{"amount": amount, "symbol": symbol})
 	// if descriptionData := parseDescriptionFromData(tx.ExtraData); descriptionData != nil {
 	// 	title = fmt.Sprintf(PushMessageAnonymousDescriptionTitle, amount, community, symbol)
 	// 	description = fmt.Sprintf(PushMessageAnonymousDescriptionBody, *descriptionData)
@@ -73,7 +77,7 @@ func NewAnonymousPushMessage(token []*PushToken, community, amount, symbol strin
 	}
 }
 
-func NewSilentPushMessage(token []*PushToken, tx *nostreth.Log) *PushMessage {
+func NewSilentPushMessage(token []*PushToken, tx *Log) *PushMessage {
 	mtx, err := json.Marshal(tx)
 	if err != nil {
 		mtx = nil
@@ -86,10 +90,153 @@ func NewSilentPushMessage(token []*PushToken, tx *nostreth.Log) *PushMessage {
 	}
 }
 
-func NewPushMessage(token []*PushToken, community, name, amount, symbol, username string) *PushMessage {
+func NewPushMessage(token []*PushToken, locale, community, name, amount, symbol, username string) *PushMessage {
 	return &PushMessage{
 		Tokens: token,
 		Title:  fmt.Sprintf(PushMessageTitle, community, name),
-		Body:   fmt.Sprintf(PushMessageBody, amount, symbol, username),
+		Body:   LocalizePush(locale, PushMessageReceivedFrom, map[string]string{"amount": amount, "symbol": symbol, "name": username}),
+	}
+}
+
+type PushUserOpExpired struct {
+	UserOpHash string `json:"user_op_hash"`
+	Reason     string `json:"reason"`
+}
+
+// NewUserOpExpiredPushMessage lets the sender know that a user operation expired before it was submitted
+func NewUserOpExpiredPushMessage(token []*PushToken, locale, userOpHash string) *PushMessage {
+	data, err := json.Marshal(&PushUserOpExpired{UserOpHash: userOpHash, Reason: UserOpReasonExpired})
+	if err != nil {
+		data = nil
+	}
+
+	return &PushMessage{
+		Tokens: token,
+		Title:  LocalizePush(locale, PushMessageUserOpExpired, nil),
+		Body:   LocalizePush(locale, PushMessageUserOpExpiredBody, nil),
+		Data:   data,
+	}
+}
+
+type PushNotificationType string
+
+const (
+	PushNotificationTypeMessage  PushNotificationType = "message"
+	PushNotificationTypeMention  PushNotificationType = "mention"
+	PushNotificationTypeTransfer PushNotificationType = "transfer"
+)
+
+// PushNotification is a single piece of activity destined for an account
+type PushNotification struct {
+	Type      PushNotificationType
+	Tokens    []*PushToken
+	Account   string
+	GroupID   string
+	GroupName string
+	Locale    string // of the account, digests are rendered in it
+	Title     string
+	Body      string
+	Data      []byte
+}
+
+// IsImmediate returns true if the notification should skip the digest
+func (n *PushNotification) IsImmediate() bool {
+	return n.Type == PushNotificationTypeMention || n.Type == PushNotificationTypeTransfer
+}
+
+// mention
+const PushMessageMentionTitle = "%s"
+
+// digest
+const PushMessageDigestTitle = "%s"
+
+// fiat
+const PushMessageFiatEstimate = "%s (%s)"
+
+// WithFiatEstimate appends an approximate fiat value to the body of a push message, e.g. "10 CTZN received (~€5.00)"
+func (m *PushMessage) WithFiatEstimate(fiat string) *PushMessage {
+	if fiat != "" && m.Body != "" {
+		m.Body = fmt.Sprintf(PushMessageFiatEstimate, m.Body, fiat)
 	}
+
+	return m
+}
+
+func NewPushMessageFromNotification(n *PushNotification) *PushMessage {
+	return &PushMessage{
+		Tokens: n.Tokens,
+		Title:  n.Title,
+		Body:   n.Body,
+		Data:   n.Data,
+	}
+}
+
+// NewDigestPushMessage summarizes the activity of a group into a single push message
+func NewDigestPushMessage(token []*PushToken, locale, group string, count int, items []string) *PushMessage {
+	body := LocalizePush(locale, PushMessageDigest, map[string]string{"count": strconv.Itoa(count)})
+	if count == 1 {
+		body = LocalizePush(locale, PushMessageDigestSingle, nil)
+	}
+
+	for _, item := range items {
+		body += "\n" + item
+	}
+
+	return &PushMessage{
+		Tokens: token,
+		Title:  fmt.Sprintf(PushMessageDigestTitle, group),
+		Body:   body,
+	}
+}
+
+// TransferNotice is an incoming transfer for a recipient who registered no push token, it is
+// sent to a nostr pubkey linked to the recipient account
+type TransferNotice struct {
+	Pubkey   string
+	Account  string
+	From     string
+	Contract string
+	Amount   string // formatted with the decimals of the token
+	Symbol   string
+	TxHash   string
+	Locale   string // of the pubkey
+}
+
+type PushMode string
+
+const (
+	PushModeAll      PushMode = "all"      // digests of group activity, mentions and transfers
+	PushModeMentions PushMode = "mentions" // only mentions and transfers
+	PushModeNone     PushMode = "none"     // no notifications
+)
+
+// IsValid returns true if the mode is known
+func (m PushMode) IsValid() bool {
+	return m == PushModeAll || m == PushModeMentions || m == PushModeNone
+}
+
+// PushPreference are the notification preferences of a nostr pubkey
+type PushPreference struct {
+	Pubkey string   `json:"pubkey"`
+	Mode   PushMode `json:"mode"`
+	Locale string   `json:"locale"` // messages are sent in it
+}
+
+// Allows returns true if a notification of the given type should be sent
+func (p *PushPreference) Allows(t PushNotificationType) bool {
+	switch p.Mode {
+	case PushModeNone:
+		return false
+	case PushModeMentions:
+		return t != PushNotificationTypeMessage
+	}
+
+	return true
+}
+
+// NostrPushRegistration is the content of a signed nostr event used to register a push token for a pubkey
+type NostrPushRegistration struct {
+	Token  string   `json:"token"`
+	Mode   PushMode `json:"mode,omitempty"`
+	Locale string   `json:"locale,omitempty"` // language tag, e.g. fr or fr-BE
 }
@@ -0,0 +1,134 @@
+package relay
+
+import (
+	"strings"
+)
+
+// PushLocaleDefault is the locale of push messages for accounts that didn't choose one
+const PushLocaleDefault = "en"
+
+// PushMessageKey identifies a push message in the catalogs
+type PushMessageKey string
+
+const (
+	PushMessageReceived          PushMessageKey = "received"
+	PushMessageReceivedFrom      PushMessageKey = "received_from"
+	PushMessageMention           PushMessageKey = "mention"
+	PushMessageDigest            PushMessageKey = "digest"
+	PushMessageDigestSingle      PushMessageKey = "digest_single"
+	PushMessageUserOpExpired     PushMessageKey = "userop_expired"
+	PushMessageUserOpExpiredBody PushMessageKey = "userop_expired_body"
+)
+
+// pushCatalog holds the push messages of a locale, {name} placeholders are replaced by the
+// values a message is rendered with so that translations can order them as they need
+type pushCatalog struct {
+	decimal  string // separator of the decimals of amounts
+	messages map[PushMessageKey]string
+}
+
+var pushCatalogs = map[string]*pushCatalog{
+	"en": {
+		decimal: ".",
+		messages: map[PushMessageKey]string{
+			PushMessageReceived:          "{amount} {symbol} received",
+			PushMessageReceivedFrom:      "{amount} {symbol} received from {name}",
+			PushMessageMention:           "You were mentioned: {message}",
+			PushMessageDigest:            "{count} new messages",
+			PushMessageDigestSingle:      "1 new message",
+			PushMessageUserOpExpired:     "Transaction expired",
+			PushMessageUserOpExpiredBody: "Your transaction could not be processed in time, please try again",
+		},
+	},
+	"fr": {
+		decimal: ",",
+		messages: map[PushMessageKey]string{
+			PushMessageReceived:          "{amount} {symbol} reçus",
+			PushMessageReceivedFrom:      "{amount} {symbol} reçus de {name}",
+			PushMessageMention:           "Vous avez été mentionné : {message}",
+			PushMessageDigest:            "{count} nouveaux messages",
+			PushMessageDigestSingle:      "1 nouveau message",
+			PushMessageUserOpExpired:     "Transaction expirée",
+			PushMessageUserOpExpiredBody: "Votre transaction n'a pas pu être traitée à temps, veuillez réessayer",
+		},
+	},
+	"nl": {
+		decimal: ",",
+		messages: map[PushMessageKey]string{
+			PushMessageReceived:          "{amount} {symbol} ontvangen",
+			PushMessageReceivedFrom:      "{amount} {symbol} ontvangen van {name}",
+			PushMessageMention:           "Je bent genoemd: {message}",
+			PushMessageDigest:            "{count} nieuwe berichten",
+			PushMessageDigestSingle:      "1 nieuw bericht",
+			PushMessageUserOpExpired:     "Transactie verlopen",
+			PushMessageUserOpExpiredBody: "Je transactie kon niet op tijd worden verwerkt, probeer het opnieuw",
+		},
+	},
+	"es": {
+		decimal: ",",
+		messages: map[PushMessageKey]string{
+			PushMessageReceived:          "{amount} {symbol} recibidos",
+			PushMessageReceivedFrom:      "{amount} {symbol} recibidos de {name}",
+			PushMessageMention:           "Te han mencionado: {message}",
+			PushMessageDigest:            "{count} mensajes nuevos",
+			PushMessageDigestSingle:      "1 mensaje nuevo",
+			PushMessageUserOpExpired:     "Transacción caducada",
+			PushMessageUserOpExpiredBody: "Tu transacción no se pudo procesar a tiempo, inténtalo de nuevo",
+		},
+	},
+}
+
+// NormalizePushLocale returns the supported locale of a language tag such as "fr-BE", false if
+// there is no catalog for its language
+func NormalizePushLocale(tag string) (string, bool) {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+
+	_, ok := pushCatalogs[lang]
+	return lang, ok
+}
+
+// LocalizePush renders a push message in a locale, falling back to the default locale when the
+// locale or the message is missing. The amount value is formatted with the decimal separator of
+// the locale.
+func LocalizePush(locale string, key PushMessageKey, values map[string]string) string {
+	c, ok := pushCatalogs[locale]
+	if !ok || c.messages[key] == "" {
+		c = pushCatalogs[PushLocaleDefault]
+	}
+
+	args := []string{}
+	for name, value := range values {
+		if name == "amount" {
+			value = formatAmount(value, c.decimal)
+		}
+
+		args = append(args, "{"+name+"}", value)
+	}
+
+	return strings.NewReplacer(args...).Replace(c.messages[key])
+}
+
+// formatAmount replaces the decimal point of a plain decimal amount
+func formatAmount(amount, decimal string) string {
+	whole, frac, ok := strings.Cut(amount, ".")
+	if !ok || decimal == "." || !isDigits(whole) || !isDigits(frac) {
+		return amount
+	}
+
+	return whole + decimal + frac
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
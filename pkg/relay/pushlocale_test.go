@@ -0,0 +1,42 @@
+package relay
+
+import "testing"
+
+func TestNormalizePushLocale(t *testing.T) {
+	for tag, want := range map[string]bool{"fr": true, "fr-BE": true, " NL_be ": true, "es": true, "de": false, "": false} {
+		_, ok := NormalizePushLocale(tag)
+		if ok != want {
+			t.Errorf("expected %q to be supported: %v", tag, want)
+		}
+	}
+
+	if locale, _ := NormalizePushLocale("fr-BE"); locale != "fr" {
+		t.Fatalf("expected fr, got %s", locale)
+	}
+}
+
+func TestLocalizePush(t *testing.T) {
+	values := map[string]string{"amount": "10.5", "symbol": "CTZN", "name": "alice"}
+
+	for locale, want := range map[string]string{
+		"en": "10.5 CTZN received from alice",
+		"fr": "10,5 CTZN reçus de alice",
+		"nl": "10,5 CTZN ontvangen van alice",
+		"es": "10,5 CTZN recibidos de alice",
+		"de": "10.5 CTZN received from alice",
+	} {
+		if got := LocalizePush(locale, PushMessageReceivedFrom, values); got != want {
+			t.Errorf("expected %q in %s, got %q", want, locale, got)
+		}
+	}
+
+	// amounts that aren't plain decimals are left as they are
+	if got := LocalizePush("fr", PushMessageReceived, map[string]string{"amount": "1.2e3", "symbol": "CTZN"}); got != "1.2e3 CTZN reçus" {
+		t.Fatalf("unexpected message %q", got)
+	}
+
+	msg := NewDigestPushMessage(nil, "nl", "demo", 4, nil)
+	if msg.Body != "4 nieuwe berichten" {
+		t.Fatalf("unexpected digest %q", msg.Body)
+	}
+}
@@ -17,6 +17,7 @@ type MessageResponse struct {
 type Message struct {
 	ID         string
 	CreatedAt  time.Time
+	EnqueuedAt time.Time // set by the queue, the wait of the message is measured from it
 	RetryCount int
 	Message    any
 	Response   *chan MessageResponse
@@ -35,9 +36,10 @@ func (m *Message) Respond(data any, err error) {
 		}
 	}(m)
 
-	*m.Response <- MessageResponse{
-		Data: data,
-		Err:  err,
+	// a caller that isn't waiting for the reply doesn't block the queue
+	select {
+	case *m.Response <- MessageResponse{Data: data, Err: err}:
+	default:
 	}
 }
 
@@ -95,6 +97,7 @@ func NewTxMessage(chainId *big.Int, event *nostr.Event, extraData *json.RawMessa
 		ExtraData: extraData,
 	}
 
-	respch := make(chan MessageResponse)
+	// the first reply is kept until the caller waits for it
+	respch := make(chan MessageResponse, 1)
 	return NewMessage(op.ID(), op, 0, &respch)
 }
@@ -3,3 +3,9 @@ package relay
 import "net/http"
 
 type RPCHandlerFunc func(r *http.Request) (any, error)
+
+// HeaderError is an error that sets headers on the json-rpc response
+type HeaderError interface {
+	error
+	Headers() http.Header
+}
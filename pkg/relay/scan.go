@@ -0,0 +1,23 @@
+package relay
+
+import "time"
+
+type ScanStatus string
+
+const (
+	ScanStatusPending  ScanStatus = "pending"
+	ScanStatusClean    ScanStatus = "clean"
+	ScanStatusInfected ScanStatus = "infected"
+)
+
+// Scan is the antivirus scan of an uploaded blob, the blob is kept in quarantine until it is clean
+type Scan struct {
+	SHA256    string     `json:"sha256"`
+	Pubkey    string     `json:"pubkey"`
+	GroupID   string     `json:"group_id"`
+	Mime      string     `json:"mime"`
+	Status    ScanStatus `json:"status"`
+	Signature string     `json:"signature,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
@@ -1,10 +1,65 @@
 package relay
 
-import "time"
+import (
+	"errors"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Sponsor holds the keys of a paymaster. The private key submits the bundles, the signer key signs
+// the paymaster data. They are rotated separately, paymasters without a signer key sign with the
+// private key.
+//
+// The bundles of a sponsor with a remote signer are signed outside of the relay, by AWS KMS or a
+// json-rpc signer, and it has no private key in the database.
 type Sponsor struct {
-	Contract   string    `json:"contract"`
-	PrivateKey string    `json:"private_key"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	Contract        string     `json:"contract"`
+	PrivateKey      string     `json:"private_key"`
+	SignerKey       string     `json:"signer_key,omitempty"`
+	RemoteSigner    string     `json:"remote_signer,omitempty"`  // kms:<key id> or rpc:<url>
+	RemoteAddress   string     `json:"remote_address,omitempty"` // of the remote signer
+	KeyRotatedAt    time.Time  `json:"key_rotated_at"`
+	SignerRotatedAt *time.Time `json:"signer_rotated_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// SigningKey returns the key that signs the paymaster data
+func (s *Sponsor) SigningKey() string {
+	if s.SignerKey != "" {
+		return s.SignerKey
+	}
+
+	return s.PrivateKey
+}
+
+// Address returns the address that submits the bundles of the sponsor
+func (s *Sponsor) Address() (common.Address, error) {
+	if s.RemoteSigner != "" {
+		if !common.IsHexAddress(s.RemoteAddress) {
+			return common.Address{}, errors.New("remote signer has no address")
+		}
+
+		return common.HexToAddress(s.RemoteAddress), nil
+	}
+
+	key, err := crypto.HexToECDSA(s.PrivateKey)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// SponsorshipDenial records why a paymaster refused to sponsor a user op
+type SponsorshipDenial struct {
+	ID        int64     `json:"id"`
+	Paymaster string    `json:"paymaster"`
+	Sender    string    `json:"sender"`
+	Selector  string    `json:"selector"` // of the call made by the account, the account function if it can't be decoded
+	Method    string    `json:"method"`   // json-rpc method the user op was sent with
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -11,6 +11,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 type Topic struct {
@@ -30,6 +31,10 @@ func ParseTopicsFromHashes(event *Event, topicHashes []common.Hash, data []byte)
 		return nil, fmt.Errorf("no topic hashes provided")
 	}
 
+	if event.HasABI() {
+		return parseTopicsFromABI(event, topicHashes, data)
+	}
+
 	name, args, argTypes := event.ParseEventSignature()
 	if name == "" || len(args) == 0 || len(argTypes) == 0 {
 		return nil, fmt.Errorf("event name is required")
@@ -141,7 +146,7 @@ func (t *Topic) valueToJsonParseable() any {
 	case common.Hash:
 		return v.Hex()
 	default:
-		return v
+		return normalizeABIValue(v)
 	}
 }
 
@@ -251,3 +256,39 @@ func GenerateJSONBQuery(prefix string, start int, data map[string]any) (string,
 
 	return query.String(), args
 }
+
+// senderTopics maps the topic0 of well known events to the argument that holds the account
+// that initiated them
+var senderTopics = map[string]string{
+	crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)")).Hex():                                        "from",
+	crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)")).Hex():                  "from",
+	crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])")).Hex():               "from",
+	crypto.Keccak256Hash([]byte("Approval(address,address,uint256)")).Hex():                                        "owner",
+	crypto.Keccak256Hash([]byte("UserOperationEvent(bytes32,address,address,uint256,bool,uint256,uint256)")).Hex(): "sender",
+}
+
+// SenderFromTopics returns the sender of a known event from its decoded topics, or an empty
+// string when the event is unknown or the argument is missing
+func SenderFromTopics(topic string, topics Topics) string {
+	name, ok := senderTopics[strings.ToLower(topic)]
+	if !ok {
+		return ""
+	}
+
+	for _, t := range topics {
+		if t.Name != name {
+			continue
+		}
+
+		switch v := t.Value.(type) {
+		case common.Address:
+			return v.Hex()
+		case string:
+			if common.IsHexAddress(v) {
+				return common.HexToAddress(v).Hex()
+			}
+		}
+	}
+
+	return ""
+}
@@ -5,6 +5,7 @@ import (
 	"math/big"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -327,3 +328,23 @@ func TestGenerateJSONBQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestSenderFromTopics(t *testing.T) {
+	from := common.HexToAddress("0xa1e4380a3b1f749673e270229993ee55f35663b4")
+
+	transfer := Topics{
+		{Name: "topic", Type: "bytes32", Value: common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")},
+		{Name: "from", Type: "address", Value: from},
+		{Name: "to", Type: "address", Value: common.HexToAddress("0xbcd4042de499d14e55001ccbb24a551f3b954096")},
+	}
+
+	assert.Equal(t, from.Hex(), SenderFromTopics("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef", transfer))
+	assert.Equal(t, from.Hex(), SenderFromTopics("0xDDF252AD1BE2C89B69C2B068FC378DAA952BA7F163C4A11628F55A4DF523B3EF", transfer))
+
+	approval := Topics{{Name: "owner", Type: "address", Value: strings.ToLower(from.Hex())}}
+	assert.Equal(t, from.Hex(), SenderFromTopics("0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925", approval))
+
+	// unknown events and missing arguments have no sender
+	assert.Equal(t, "", SenderFromTopics("0x1234", transfer))
+	assert.Equal(t, "", SenderFromTopics("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef", Topics{}))
+}
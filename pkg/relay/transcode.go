@@ -0,0 +1,26 @@
+package relay
+
+import "time"
+
+type TranscodeStatus string
+
+const (
+	TranscodeStatusPending TranscodeStatus = "pending"
+	TranscodeStatusReady   TranscodeStatus = "ready"
+	TranscodeStatusFailed  TranscodeStatus = "failed"
+)
+
+// Transcode is the conversion of an uploaded video to a mobile friendly mp4, the output is a blob
+// of its own owned by the uploader
+type Transcode struct {
+	SHA256    string          `json:"sha256"`
+	Pubkey    string          `json:"pubkey"`
+	GroupID   string          `json:"group_id"`
+	Mime      string          `json:"mime"`
+	Status    TranscodeStatus `json:"status"`
+	Output    string          `json:"output,omitempty"`
+	Size      int64           `json:"size,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
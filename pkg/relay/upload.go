@@ -0,0 +1,46 @@
+package relay
+
+import "time"
+
+// Upload records a blob uploaded to the relay, the client ip is only kept as a keyed hash
+type Upload struct {
+	ID        int64     `json:"id"`
+	SHA256    string    `json:"sha256"`
+	Pubkey    string    `json:"pubkey"`
+	GroupID   string    `json:"group_id"`
+	Size      int64     `json:"size"`
+	Mime      string    `json:"mime"`
+	IPHash    string    `json:"ip_hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UploadFlag marks a pubkey that uploaded an unusual volume of blobs, it stays until an admin clears it
+type UploadFlag struct {
+	Pubkey    string    `json:"pubkey"`
+	Uploads   int       `json:"uploads"`
+	Bytes     int64     `json:"bytes"`
+	Reason    string    `json:"reason"`
+	FlaggedAt time.Time `json:"flagged_at"`
+}
+
+// GroupMedia describes a blob uploaded to a group, as listed to its members
+type GroupMedia struct {
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	Type      string `json:"type"`
+	Uploader  string `json:"uploader"`
+	CreatedAt int64  `json:"created_at"`
+
+	// Transcoded is the sha256 of the mobile friendly mp4 of a video, once it is ready
+	Transcoded string `json:"transcoded,omitempty"`
+}
+
+// GroupStorage is what the blobs of a group take in the buckets and an estimate of what they cost,
+// blobs older than the archive age are in the cheaper storage class
+type GroupStorage struct {
+	GroupID       string  `json:"group_id"`
+	Blobs         int64   `json:"blobs"`
+	StandardBytes int64   `json:"standard_bytes"`
+	ArchivedBytes int64   `json:"archived_bytes"`
+	MonthlyCost   float64 `json:"monthly_cost"`
+}
@@ -3,6 +3,7 @@ package relay
 import (
 	"encoding/json"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -112,3 +113,27 @@ func (u *UserOp) Copy() UserOp {
 
 	return copy
 }
+
+// UserOpState is the latest known lifecycle state of a user operation
+type UserOpState struct {
+	ID         string    `json:"id"`
+	EventID    string    `json:"event_id"`
+	Sender     string    `json:"sender"`
+	Paymaster  string    `json:"paymaster,omitempty"`
+	Status     string    `json:"status"`
+	TxHash     *string   `json:"tx_hash,omitempty"`
+	RetryCount int       `json:"retry_count"`
+	Reason     string    `json:"reason,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// reasons attached to failed user operations
+const (
+	UserOpReasonDropped    = "dropped"    // removed from the queue by an operator
+	UserOpReasonExpired    = "expired"    // sat in the queue for too long
+	UserOpReasonUnverified = "unverified" // mined, but a second node didn't confirm the receipt
+	UserOpReasonCongested  = "congested"  // too many ops were held back while the gas price spiked, it can be sent again
+)
+
+// UserOpStatusHeld is the reply to an op held back until the gas price calms down
+const UserOpStatusHeld = "held"
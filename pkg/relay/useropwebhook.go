@@ -0,0 +1,40 @@
+package relay
+
+import "time"
+
+// user op transitions delivered to webhooks
+const (
+	UserOpTransitionSubmitted = "submitted"
+	UserOpTransitionReplaced  = "replaced" // submitted again with another transaction
+	UserOpTransitionConfirmed = "confirmed"
+	UserOpTransitionFailed    = "failed"
+)
+
+const (
+	// UserOpWebhookSignatureHeader holds the hex HMAC-SHA256 of "<timestamp>.<body>" with the secret of the webhook
+	UserOpWebhookSignatureHeader = "X-Relay-Signature"
+	// UserOpWebhookTimestampHeader holds the unix time of a delivery, receivers should refuse old ones
+	UserOpWebhookTimestampHeader = "X-Relay-Timestamp"
+)
+
+// UserOpWebhook receives the transitions of the user ops of a sender or a paymaster, the secret
+// is only returned when the webhook is registered
+type UserOpWebhook struct {
+	ID        string    `json:"id"`
+	Address   string    `json:"address"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserOpWebhookRequest registers a webhook
+type UserOpWebhookRequest struct {
+	URL string `json:"url"`
+}
+
+// UserOpTransition is posted to the webhooks of the sender and the paymaster of a user op
+type UserOpTransition struct {
+	WebhookID  string       `json:"webhook_id"`
+	Transition string       `json:"transition"`
+	UserOp     *UserOpState `json:"user_op"`
+}
@@ -0,0 +1,29 @@
+package relay
+
+import "time"
+
+// what happens to group messages matching a keyword filter
+const (
+	FilterActionReject = "reject" // the message is refused
+	FilterActionFlag   = "flag"   // the message is stored and recorded for the admins
+)
+
+// FilteredContent is the audit record of a group message that matched a keyword filter
+type FilteredContent struct {
+	ID        int64     `json:"id"`
+	GroupID   string    `json:"group_id"`
+	EventID   string    `json:"event_id"`
+	Pubkey    string    `json:"pubkey"`
+	Kind      int       `json:"kind"`
+	Keyword   string    `json:"keyword"`
+	Action    string    `json:"action"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FilteredContentRequest is the content of a signed request listing the filtered messages of a
+// group
+type FilteredContentRequest struct {
+	Since int64 `json:"since,omitempty"` // unix seconds, defaults to 30 days ago
+	Limit int   `json:"limit,omitempty"` // defaults to 100, at most 500
+}
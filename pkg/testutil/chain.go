@@ -0,0 +1,136 @@
+package testutil
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	ethevent "github.com/comunifi/nostr-eth/pkg/event"
+	nost "github.com/comunifi/relay/internal/nostr"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Address derives a stable address from a name
+func Address(name string) common.Address {
+	h := sha256.Sum256([]byte("relay-testutil-address:" + name))
+	return common.BytesToAddress(h[:])
+}
+
+// Hash derives a stable hash from a name
+func Hash(name string) common.Hash {
+	return sha256.Sum256([]byte("relay-testutil-hash:" + name))
+}
+
+// TransferLog builds the log of an erc20 transfer
+func (f *Fixtures) TransferLog(chainID *big.Int, token, from, to common.Address, value *big.Int, txName string) nostreth.Log {
+	data := json.RawMessage(fmt.Sprintf(`{"from":"%s","to":"%s","value":"%s"}`, from.Hex(), to.Hex(), value.String()))
+
+	l := nostreth.Log{
+		TxHash:    Hash(txName).Hex(),
+		ChainID:   chainID.String(),
+		Topic:     nostreth.TopicERC20Transfer,
+		CreatedAt: time.Unix(int64(f.now), 0).UTC(),
+		UpdatedAt: time.Unix(int64(f.now), 0).UTC(),
+		To:        token.Hex(),
+		Value:     big.NewInt(0),
+		Data:      &data,
+	}
+
+	l.Hash = l.GenerateUniqueHash()
+
+	return l
+}
+
+// TxTransfer builds a tx transfer event signed by the relay, optionally scoped to a group
+func (f *Fixtures) TxTransfer(l nostreth.Log, groupID string) *nostr.Event {
+	ev, err := nostreth.CreateTxTransferEvent(l)
+	if err != nil {
+		panic(err)
+	}
+
+	return f.signTx(ev, groupID)
+}
+
+// TxLog builds a tx log event signed by the relay, optionally scoped to a group
+func (f *Fixtures) TxLog(l nostreth.Log, groupID string) *nostr.Event {
+	ev, err := nostreth.CreateTxLogEvent(l)
+	if err != nil {
+		panic(err)
+	}
+
+	return f.signTx(ev, groupID)
+}
+
+func (f *Fixtures) signTx(ev *nostr.Event, groupID string) *nostr.Event {
+	sortDataTags(ev)
+
+	if groupID != "" {
+		ev.Tags = append(ev.Tags, nostr.Tag{"h", groupID})
+	}
+
+	return f.Sign(f.Relay, ev)
+}
+
+// sortDataTags orders the tags nostr-eth flattens from the log data, and the matching lines of the
+// alt tag, which come out in map order, so that the same log always gives the same event
+func sortDataTags(ev *nostr.Event) {
+	i := slices.IndexFunc(ev.Tags, func(t nostr.Tag) bool { return len(t) >= 2 && t[0] == "alt" })
+	if i < 0 {
+		return
+	}
+
+	// the data tags come right before the alt tag, which lists them after its header
+	lines := strings.Split(ev.Tags[i][1], "\n")
+	n := len(lines) - 2
+	if n <= 0 || n > i {
+		return
+	}
+
+	data := ev.Tags[i-n : i]
+	slices.SortFunc(data, func(a, b nostr.Tag) int {
+		return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1]))
+	})
+
+	alt := lines[0] + "\n" + lines[1]
+	for _, tag := range data {
+		alt += fmt.Sprintf("\n %s: %s", tag[0], tag[1])
+	}
+	ev.Tags[i][1] = alt
+}
+
+// UserOp builds a user operation for a sender with a given nonce
+func UserOp(sender common.Address, nonce int64) nostreth.UserOp {
+	return nostreth.UserOp{
+		Sender:               sender,
+		Nonce:                big.NewInt(nonce),
+		InitCode:             []byte{},
+		CallData:             []byte{},
+		CallGasLimit:         big.NewInt(100000),
+		VerificationGasLimit: big.NewInt(100000),
+		PreVerificationGas:   big.NewInt(50000),
+		MaxFeePerGas:         big.NewInt(1000000000),
+		MaxPriorityFeePerGas: big.NewInt(1000000000),
+		PaymasterAndData:     []byte{},
+		Signature:            []byte{},
+	}
+}
+
+// UserOpEvent builds a user op event in a given state, signed by the relay
+func (f *Fixtures) UserOpEvent(chainID *big.Int, paymaster, entryPoint common.Address, op nostreth.UserOp, txHash *string, eventType ethevent.EventTypeUserOp) *nostr.Event {
+	ev, err := nostreth.CreateUserOpEvent(chainID, &paymaster, &entryPoint, nil, txHash, 0, op, eventType)
+	if err != nil {
+		panic(err)
+	}
+
+	// all lifecycle updates of a user op share the same identifier
+	ev = nost.SetUserOpIdentifier(chainID, op.GetHash(chainID), ev)
+
+	return f.Sign(f.Relay, ev)
+}
@@ -0,0 +1,32 @@
+package testutil
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/comunifi/relay/internal/db"
+	"github.com/comunifi/relay/internal/testdb"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// NewDB opens the relay database on an empty test database with a random secret, it is closed
+// when the test ends. The test is skipped when no postgres server is available.
+func NewDB(t testing.TB) *db.DB {
+	t.Helper()
+
+	tdb := testdb.New(t)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := db.NewDB(big.NewInt(100), hex.EncodeToString(crypto.FromECDSA(key)), tdb.User, tdb.Password, tdb.Name, tdb.Port, tdb.Host, tdb.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(d.Close)
+
+	return d
+}
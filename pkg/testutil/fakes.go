@@ -0,0 +1,111 @@
+package testutil
+
+import (
+	"context"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// FakeGroups holds the admins and members of groups in memory, it implements the parts of the
+// groups service that the other services depend on
+type FakeGroups struct {
+	Admins  map[string][]string // by group id
+	Members map[string][]string // by group id, admins are members without being listed
+	Pending map[string][]string // pubkeys waiting to join, by group id
+	Saved   []*nostr.Event      // events passed to OnEventSaved, in order
+}
+
+// GroupExists tells whether a group has admins or members
+func (g *FakeGroups) GroupExists(ctx context.Context, groupID string) (bool, error) {
+	_, admins := g.Admins[groupID]
+	_, members := g.Members[groupID]
+
+	return admins || members, nil
+}
+
+func (g *FakeGroups) IsAdmin(ctx context.Context, pubkey, groupID string) (bool, error) {
+	return slices.Contains(g.Admins[groupID], pubkey), nil
+}
+
+func (g *FakeGroups) IsMember(ctx context.Context, pubkey, groupID string) (bool, error) {
+	return slices.Contains(g.Members[groupID], pubkey) || slices.Contains(g.Admins[groupID], pubkey), nil
+}
+
+func (g *FakeGroups) GetAdmins(ctx context.Context, groupID string) ([]string, error) {
+	return g.Admins[groupID], nil
+}
+
+func (g *FakeGroups) GetMembers(ctx context.Context, groupID string) ([]string, error) {
+	return g.Members[groupID], nil
+}
+
+func (g *FakeGroups) PendingJoinRequests(ctx context.Context, groupID string) ([]string, error) {
+	return g.Pending[groupID], nil
+}
+
+// GroupsOf returns the sorted ids of the groups a pubkey is an admin or a member of
+func (g *FakeGroups) GroupsOf(ctx context.Context, pubkey string) ([]string, error) {
+	ids := []string{}
+	for _, byGroup := range []map[string][]string{g.Admins, g.Members} {
+		for groupID := range byGroup {
+			if ok, _ := g.IsMember(ctx, pubkey, groupID); ok && !slices.Contains(ids, groupID) {
+				ids = append(ids, groupID)
+			}
+		}
+	}
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+func (g *FakeGroups) OnEventSaved(ctx context.Context, event *nostr.Event) {
+	g.Saved = append(g.Saved, event)
+}
+
+// FakeStore keeps in memory the events that a service signs and saves as the relay, whose pubkey
+// is "relay"
+type FakeStore struct {
+	Events []*nostr.Event
+}
+
+func (s *FakeStore) PubKey() string {
+	return "relay"
+}
+
+func (s *FakeStore) SignAndSaveEvent(ctx context.Context, ev *nostr.Event) (*nostr.Event, error) {
+	ev.PubKey = s.PubKey()
+	ev.ID = ev.GetID()
+	s.Events = append(s.Events, ev)
+
+	return ev, nil
+}
+
+func (s *FakeStore) DeleteEvent(ctx context.Context, ev *nostr.Event) error {
+	s.Events = slices.DeleteFunc(s.Events, func(e *nostr.Event) bool { return e.ID == ev.ID })
+	return nil
+}
+
+// GetAuthoredEvents returns the events of an author
+func (s *FakeStore) GetAuthoredEvents(pubkey string) ([]*nostr.Event, error) {
+	events := []*nostr.Event{}
+	for _, ev := range s.Events {
+		if ev.PubKey == pubkey {
+			events = append(events, ev)
+		}
+	}
+
+	return events, nil
+}
+
+// GetTaggedEvents returns the events of some kinds that tag a pubkey
+func (s *FakeStore) GetTaggedEvents(pubkey string, kinds []int) ([]*nostr.Event, error) {
+	events := []*nostr.Event{}
+	for _, ev := range s.Events {
+		if slices.Contains(kinds, ev.Kind) && ev.Tags.GetFirst([]string{"p", pubkey}) != nil {
+			events = append(events, ev)
+		}
+	}
+
+	return events, nil
+}
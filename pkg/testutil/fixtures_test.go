@@ -0,0 +1,75 @@
+package testutil
+
+import (
+	"math/big"
+	"testing"
+
+	nostreth "github.com/comunifi/nostr-eth"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestKeysAreStable(t *testing.T) {
+	if NewKey("alice") != NewKey("alice") {
+		t.Fatal("expected the same name to give the same key")
+	}
+
+	if NewKey("alice").PubKey == NewKey("bob").PubKey {
+		t.Fatal("expected different names to give different keys")
+	}
+}
+
+func TestFixturesAreDeterministic(t *testing.T) {
+	build := func() []*nostr.Event {
+		f := New()
+		alice, bob := NewKey("alice"), NewKey("bob")
+
+		evs := f.GroupWithMembers(alice, "test", bob)
+		evs = append(evs, f.Message(bob, "test", "hello", alice))
+
+		l := f.TransferLog(big.NewInt(100), Address("token"), Address("alice"), Address("bob"), big.NewInt(10), "tx1")
+		evs = append(evs, f.TxTransfer(l, "test"))
+
+		op := UserOp(Address("alice"), 0)
+		evs = append(evs, f.UserOpEvent(big.NewInt(100), Address("paymaster"), Address("entrypoint"), op, nil, nostreth.EventTypeUserOpSubmitted))
+
+		return evs
+	}
+
+	a, b := build(), build()
+	if len(a) != len(b) {
+		t.Fatalf("expected the same number of events, got %d and %d", len(a), len(b))
+	}
+
+	for i := range a {
+		if a[i].ID != b[i].ID {
+			t.Fatalf("event %d: expected stable id, got %s and %s", i, a[i].ID, b[i].ID)
+		}
+
+		ok, err := a[i].CheckSignature()
+		if err != nil || !ok {
+			t.Fatalf("event %d: invalid signature: %v", i, err)
+		}
+
+		if i > 0 && a[i].CreatedAt <= a[i-1].CreatedAt {
+			t.Fatalf("event %d: expected increasing timestamps", i)
+		}
+	}
+}
+
+func TestGroupEventsTargetGroup(t *testing.T) {
+	f := New()
+	admin, user := NewKey("admin"), NewKey("user")
+
+	for _, ev := range []*nostr.Event{
+		f.CreateGroup(admin, "test", "Test"),
+		f.PutUser(admin, "test", user, "member"),
+		f.RemoveUser(admin, "test", user),
+		f.JoinRequest(user, "test"),
+		f.LeaveRequest(user, "test"),
+		f.Message(user, "test", "hi"),
+	} {
+		if h := ev.Tags.GetFirst([]string{"h"}); h == nil || (*h)[1] != "test" {
+			t.Fatalf("kind %d: expected h tag for group test", ev.Kind)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package testutil
+
+import (
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// NIP-29 kinds, duplicated here so that the groups package can use these fixtures in its own tests
+const (
+	KindPutUser      = 9000
+	KindRemoveUser   = 9001
+	KindEditMetadata = 9002
+	KindDeleteEvent  = 9005
+	KindCreateGroup  = 9007
+	KindDeleteGroup  = 9008
+	KindJoinRequest  = 9021
+	KindLeaveRequest = 9022
+
+	KindGroupChat = 9
+)
+
+// CreateGroup creates a group, the author becomes its admin
+func (f *Fixtures) CreateGroup(admin Key, groupID, name string) *nostr.Event {
+	return f.Sign(admin, &nostr.Event{
+		Kind: KindCreateGroup,
+		Tags: nostr.Tags{{"h", groupID}, {"name", name}},
+	})
+}
+
+// PutUser adds a user to a group with a role
+func (f *Fixtures) PutUser(admin Key, groupID string, user Key, role string) *nostr.Event {
+	return f.Sign(admin, &nostr.Event{
+		Kind: KindPutUser,
+		Tags: nostr.Tags{{"h", groupID}, {"p", user.PubKey, role}},
+	})
+}
+
+// RemoveUser removes a user from a group
+func (f *Fixtures) RemoveUser(admin Key, groupID string, user Key) *nostr.Event {
+	return f.Sign(admin, &nostr.Event{
+		Kind: KindRemoveUser,
+		Tags: nostr.Tags{{"h", groupID}, {"p", user.PubKey}},
+	})
+}
+
+// EditMetadata edits the name of a group
+func (f *Fixtures) EditMetadata(admin Key, groupID, name string) *nostr.Event {
+	return f.Sign(admin, &nostr.Event{
+		Kind: KindEditMetadata,
+		Tags: nostr.Tags{{"h", groupID}, {"name", name}},
+	})
+}
+
+// DeleteEvent deletes an event from a group
+func (f *Fixtures) DeleteEvent(admin Key, groupID string, ev *nostr.Event) *nostr.Event {
+	return f.Sign(admin, &nostr.Event{
+		Kind: KindDeleteEvent,
+		Tags: nostr.Tags{{"h", groupID}, {"e", ev.ID}},
+	})
+}
+
+// DeleteGroup deletes a group
+func (f *Fixtures) DeleteGroup(admin Key, groupID string) *nostr.Event {
+	return f.Sign(admin, &nostr.Event{
+		Kind: KindDeleteGroup,
+		Tags: nostr.Tags{{"h", groupID}},
+	})
+}
+
+// JoinRequest asks to join a group
+func (f *Fixtures) JoinRequest(user Key, groupID string) *nostr.Event {
+	return f.Sign(user, &nostr.Event{
+		Kind: KindJoinRequest,
+		Tags: nostr.Tags{{"h", groupID}},
+	})
+}
+
+// LeaveRequest leaves a group
+func (f *Fixtures) LeaveRequest(user Key, groupID string) *nostr.Event {
+	return f.Sign(user, &nostr.Event{
+		Kind: KindLeaveRequest,
+		Tags: nostr.Tags{{"h", groupID}},
+	})
+}
+
+// Message posts a chat message in a group, mentioned keys are added as p tags
+func (f *Fixtures) Message(user Key, groupID, content string, mentions ...Key) *nostr.Event {
+	tags := nostr.Tags{{"h", groupID}}
+	for _, m := range mentions {
+		tags = append(tags, nostr.Tag{"p", m.PubKey})
+	}
+
+	return f.Sign(user, &nostr.Event{
+		Kind:    KindGroupChat,
+		Tags:    tags,
+		Content: content,
+	})
+}
+
+// GroupWithMembers returns the moderation sequence creating a group and adding members to it
+func (f *Fixtures) GroupWithMembers(admin Key, groupID string, members ...Key) []*nostr.Event {
+	evs := []*nostr.Event{f.CreateGroup(admin, groupID, groupID)}
+	for _, m := range members {
+		evs = append(evs, f.PutUser(admin, groupID, m, "member"))
+	}
+
+	return evs
+}